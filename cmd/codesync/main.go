@@ -0,0 +1,1776 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/ci"
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/daemon"
+	"github.com/exitflynn/codesync/internal/discover"
+	"github.com/exitflynn/codesync/internal/githook"
+	"github.com/exitflynn/codesync/internal/github"
+	"github.com/exitflynn/codesync/internal/kube"
+	"github.com/exitflynn/codesync/internal/lsp"
+	"github.com/exitflynn/codesync/internal/operator"
+	"github.com/exitflynn/codesync/internal/redact"
+	"github.com/exitflynn/codesync/internal/secrets"
+	"github.com/exitflynn/codesync/internal/selfupdate"
+	csync "github.com/exitflynn/codesync/internal/sync"
+	"github.com/exitflynn/codesync/internal/telemetry"
+	"github.com/exitflynn/codesync/internal/version"
+	"google.golang.org/grpc"
+	"gopkg.in/yaml.v3"
+)
+
+const usage = `Usage: codesync <command> [flags]
+
+Commands:
+  backups list|restore Show or restore local files that onConflict: theirs backed up
+  bundle create|apply|keygen Carry pending upstream changes into a network without access to the sources
+  check    Check all items (or one with --item) for upstream changes
+  conflicts list|show|resolve|dismiss Triage conflicts found by syncs
+  contribute Open a pull request upstream with an item's local changes
+  daemon   Check items periodically according to syncInterval
+  discover Find functions copied from an upstream repository and suggest sync items
+  export   Archive all synced targets with their upstream provenance for another workspace
+  export-patch Write an item's pending upstream commits as patches for git am
+  gc       Remove state left behind by items no longer in the config
+  hook install Install a git hook that blocks commits editing synced targets
+  import   Restore an archive written by export, e.g. in a workspace without network access
+  login    Log in to GitHub in the browser and store the token in the OS keychain
+  lsp      Serve editors over stdio: which files are synced, from where, how stale
+  rename-item Move an item's state to a new name
+  replay   Re-execute a recorded run offline and verify the targets match what it produced
+  rollout status|approve|retry Show how upstream versions roll out through rings, let a ring have one or resume a halted one
+  self-update Install the latest signed release of codesync
+  status   Show each item's sync state and when the daemon polls it
+  telemetry status Show whether anonymous usage is reported, and what is sent
+  undo     Restore the files and state an item's last sync replaced
+
+Run 'codesync <command> -h' for command flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "backups":
+		err = runBackups(os.Args[2:])
+	case "bundle":
+		err = runBundle(os.Args[2:])
+	case "check":
+		err = runCheck(os.Args[2:])
+	case "conflicts":
+		err = runConflicts(os.Args[2:])
+	case "contribute":
+		err = runContribute(os.Args[2:])
+	case "daemon":
+		err = runDaemon(os.Args[2:])
+	case "discover":
+		err = runDiscover(os.Args[2:])
+	case "export":
+		err = runExport(os.Args[2:])
+	case "export-patch":
+		err = runExportPatch(os.Args[2:])
+	case "gc":
+		err = runGC(os.Args[2:])
+	case "hook":
+		err = runHook(os.Args[2:])
+	case "import":
+		err = runImport(os.Args[2:])
+	case "login":
+		err = runLogin(os.Args[2:])
+	case "lsp":
+		err = runLSP(os.Args[2:])
+	case "rename-item":
+		err = runRenameItem(os.Args[2:])
+	case "replay":
+		err = runReplay(os.Args[2:])
+	case "rollout":
+		err = runRollout(os.Args[2:])
+	case "self-update":
+		err = runSelfUpdate(os.Args[2:])
+	case "status":
+		err = runStatus(os.Args[2:])
+	case "telemetry":
+		err = runTelemetry(os.Args[2:])
+	case "undo":
+		err = runUndo(os.Args[2:])
+	case "-h", "--help", "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+
+		var exit *exitError
+		if errors.As(err, &exit) {
+			os.Exit(exit.code)
+		}
+		os.Exit(1)
+	}
+}
+
+// exitError is an error that sets the process exit code
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// commonFlags are shared by every command
+type commonFlags struct {
+	configPath string
+	stateDir   string
+
+	skipTokenCheck bool
+	color          string // "auto", "always" or "never"
+	logFormat      string // "text" or "json"; empty picks one for the environment
+
+	env           ci.Environment
+	itemsFromCRDs bool // Items come from SyncItem resources, not the config file
+	offline       bool // Only local files and state are used, so no credentials are needed
+	dryRun        bool // Nothing is written to the targets or state
+}
+
+func (c *commonFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&c.configPath, "config", envOr("CODESYNC_CONFIG", "codesync.yaml"), "path to the config file (env CODESYNC_CONFIG)")
+	fs.StringVar(&c.stateDir, "state-dir", envOr("CODESYNC_STATE_DIR", ".codesync"), "directory for sync state (env CODESYNC_STATE_DIR)")
+	fs.BoolVar(&c.skipTokenCheck, "skip-token-check", false, "don't verify at startup that the GitHub token can read every source")
+	fs.StringVar(&c.color, "color", "auto", "colorize output: auto (off in CI and when not a terminal), always or never")
+	fs.StringVar(&c.logFormat, "log-format", "", "log format: text or json (default json in CI, text otherwise)")
+	c.env = ci.Detect()
+}
+
+// colorize reports whether terminal output should be colorized
+func (c *commonFlags) colorize() bool {
+	switch c.color {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	return c.env.Color(os.Stdout)
+}
+
+// setupLogging sends log output through the redactor, as JSON when asked to
+// or when running in CI
+func (c *commonFlags) setupLogging(redactor *redact.Redactor) error {
+	out := redactor.Writer(os.Stderr)
+
+	format := c.logFormat
+	if format == "" {
+		format = c.env.LogFormat()
+	}
+
+	switch format {
+	case "text":
+		log.SetOutput(out)
+	case "json":
+		logger := slog.New(slog.NewJSONHandler(out, nil))
+		if c.env.CI() {
+			logger = logger.With("ci", c.env.Name)
+		}
+		slog.SetDefault(logger)
+	default:
+		return fmt.Errorf("unknown log format: %s", format)
+	}
+	return nil
+}
+
+// envOr returns the named environment variable, or fallback if it is unset
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// newManager loads and validates the config and creates a sync manager
+func (c *commonFlags) newManager() (*config.Config, *csync.SyncManager, error) {
+	if c.color != "auto" && c.color != "always" && c.color != "never" {
+		return nil, nil, fmt.Errorf("unknown color mode: %s", c.color)
+	}
+
+	cfg, err := config.LoadConfig(c.configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	validate := cfg.Validate
+	if c.itemsFromCRDs {
+		validate = cfg.ValidateSettings
+	}
+	if err := validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	var opts []csync.Option
+	if c.offline {
+		opts = append(opts, csync.Offline())
+	}
+	if c.dryRun {
+		opts = append(opts, csync.DryRun())
+	}
+	manager, err := csync.NewSyncManager(cfg, c.stateDir, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := c.setupLogging(manager.Redactor()); err != nil {
+		manager.Close()
+		return nil, nil, err
+	}
+
+	if !c.skipTokenCheck && !c.offline {
+		warnings, err := manager.CheckToken()
+		if err != nil {
+			manager.Close()
+			return nil, nil, fmt.Errorf("token check failed: %w", err)
+		}
+		for _, warning := range warnings {
+			fmt.Fprintln(os.Stderr, "warning:", warning)
+		}
+	}
+
+	return cfg, manager, nil
+}
+
+func runBundle(args []string) error {
+	fs := flag.NewFlagSet("bundle", flag.ExitOnError)
+	var common commonFlags
+	common.register(fs)
+	out := fs.String("out", "", "create: write the bundle to this file")
+	in := fs.String("in", "", "apply: read the bundle from this file")
+	items := fs.String("item", "", "create: comma-separated items to bundle (default: all)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: codesync bundle create|apply|keygen [flags]")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return fmt.Errorf("missing bundle command")
+	}
+	command := args[0]
+	fs.Parse(args[1:])
+
+	switch command {
+	case "keygen":
+		public, private, err := csync.GenerateBundleKey()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("bundles.publicKey:   %s\n", public)
+		fmt.Printf("CODESYNC_BUNDLE_KEY: %s\n", private)
+		return nil
+
+	case "create":
+		if *out == "" {
+			fs.Usage()
+			return fmt.Errorf("bundle create needs --out")
+		}
+		_, manager, err := common.newManager()
+		if err != nil {
+			return err
+		}
+		defer manager.Close()
+
+		var names []string
+		if *items != "" {
+			names = strings.Split(*items, ",")
+		}
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		bundle, err := manager.CreateBundle(f, names)
+		if err != nil {
+			f.Close()
+			os.Remove(*out)
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Printf("bundled %d items to %s\n", len(bundle.Items), *out)
+		return nil
+
+	case "apply":
+		if *in == "" {
+			fs.Usage()
+			return fmt.Errorf("bundle apply needs --in")
+		}
+		// Content comes from the bundle, so no credentials are needed
+		common.offline = true
+		_, manager, err := common.newManager()
+		if err != nil {
+			return err
+		}
+		defer manager.Close()
+
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		bundle, reports, err := manager.ApplyBundle(f)
+		if bundle == nil {
+			return err
+		}
+		for _, name := range bundle.Items {
+			if _, ok := manager.Item(name); !ok {
+				fmt.Fprintf(os.Stderr, "warning: %s isn't in the config, so it wasn't synced\n", name)
+			}
+		}
+
+		printReports(reports, common.colorize())
+		summary := csync.SummarizeRun(reports)
+		if len(reports) > 1 {
+			fmt.Println(summary)
+		}
+		if err != nil {
+			return err
+		}
+		if code := summary.ExitCode(); code != 0 {
+			return &exitError{code: code, err: fmt.Errorf("some items failed to sync: %s", summary)}
+		}
+		return nil
+	}
+
+	fs.Usage()
+	return fmt.Errorf("unknown bundle command: %s", command)
+}
+
+func runCheck(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	var common commonFlags
+	common.register(fs)
+	item := fs.String("item", "", "only check the named item")
+	badges := fs.String("badges", "", "write a shields.io badge JSON file per item to this directory")
+	resume := fs.Bool("resume", false, "continue an interrupted run, skipping items it already synced")
+	fs.BoolVar(&common.dryRun, "dry-run", false, "report what syncing would change without writing to the targets or state")
+	fs.Parse(args)
+
+	if *resume && *item != "" {
+		return errors.New("--resume can't be combined with --item")
+	}
+	if common.dryRun && *badges != "" {
+		return errors.New("--badges can't be combined with --dry-run")
+	}
+
+	_, manager, err := common.newManager()
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	var reports []*csync.SyncReport
+	if *item != "" {
+		report, syncErr := manager.SyncItemByName(*item)
+		if report != nil {
+			reports = append(reports, report)
+		}
+		err = syncErr
+	} else if *resume {
+		reports, err = manager.ResumeAll()
+	} else {
+		reports, err = manager.SyncAll()
+	}
+
+	printReports(reports, common.colorize())
+	summary := csync.SummarizeRun(reports)
+	if len(reports) > 1 {
+		fmt.Println(summary)
+	}
+	if common.dryRun {
+		fmt.Println("dry run: nothing was written")
+	}
+
+	if *badges != "" {
+		if badgeErr := manager.WriteBadges(*badges); badgeErr != nil {
+			return badgeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if code := summary.ExitCode(); code != 0 {
+		return &exitError{code: code, err: fmt.Errorf("some items failed to sync: %s", summary)}
+	}
+
+	return nil
+}
+
+func runConflicts(args []string) error {
+	fs := flag.NewFlagSet("conflicts", flag.ExitOnError)
+	var common commonFlags
+	common.register(fs)
+	all := fs.Bool("all", false, "list: include resolved and dismissed conflicts")
+	take := fs.String("take", "local", "resolve: keep the local target (after merging by hand) or take the upstream version")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: codesync conflicts list|show <id>|resolve <id>|dismiss <id> [flags]")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return fmt.Errorf("missing conflicts command")
+	}
+	command := args[0]
+	fs.Parse(args[1:])
+
+	// Flags may also follow the ID
+	id := fs.Arg(0)
+	if fs.NArg() > 0 {
+		fs.Parse(fs.Args()[1:])
+	}
+	if command != "list" && (id == "" || fs.NArg() > 0) {
+		fs.Usage()
+		return fmt.Errorf("conflicts %s needs a conflict ID", command)
+	}
+
+	// The inbox is local state, so the token isn't checked
+	common.skipTokenCheck = true
+	_, manager, err := common.newManager()
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	switch command {
+	case "list":
+		conflicts, err := manager.Conflicts(*all)
+		if err != nil {
+			return err
+		}
+		for _, c := range conflicts {
+			fmt.Printf("%s  %-9s  %s  %s  upstream %s\n", c.ID, c.Status, c.Detected.Format("2006-01-02 15:04"), c.Item, shortSHA(c.CommitID))
+		}
+		if len(conflicts) == 0 {
+			fmt.Println("no conflicts")
+		}
+		return nil
+
+	case "show":
+		c, err := manager.Conflict(id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("conflict %s (%s)\n", c.ID, c.Status)
+		fmt.Printf("item:     %s\n", c.Item)
+		if item, ok := manager.Item(c.Item); ok && itemContact(item) != "" {
+			fmt.Printf("contact:  %s\n", itemContact(item))
+		}
+		fmt.Printf("upstream: %s\n", c.CommitID)
+		fmt.Printf("detected: %s, last seen %s\n", c.Detected.Format(time.RFC3339), c.LastSeen.Format(time.RFC3339))
+		if c.Resolution != "" {
+			fmt.Printf("resolved: %s at %s\n", c.Resolution, c.Closed.Format(time.RFC3339))
+		}
+		fmt.Printf("\n%s\n", c.Message)
+		return nil
+
+	case "resolve":
+		c, err := manager.ResolveConflict(id, *take)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("resolved conflict %s of %s, taking %s\n", c.ID, c.Item, c.Resolution)
+		return nil
+
+	case "dismiss":
+		c, err := manager.DismissConflict(id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("dismissed conflict %s of %s\n", c.ID, c.Item)
+		return nil
+	}
+
+	fs.Usage()
+	return fmt.Errorf("unknown conflicts command: %s", command)
+}
+
+// shortSHA abbreviates a commit SHA for display
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+func runDaemon(args []string) error {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	var common commonFlags
+	common.register(fs)
+	listen := fs.String("listen", "", "address for the status API, e.g. :8080 (disabled if empty)")
+	grpcListen := fs.String("grpc-listen", "", "address for the gRPC control API, e.g. :9090 (disabled if empty)")
+	leaderElect := fs.Bool("leader-elect", false, "elect a single active replica through a Kubernetes Lease")
+	leaseName := fs.String("lease-name", "codesync", "name of the Lease used for leader election")
+	leaseNamespace := fs.String("lease-namespace", "", "namespace of the Lease (defaults to the pod's namespace)")
+	fs.BoolVar(&common.itemsFromCRDs, "sync-item-crds", false, "define sync items as SyncItem custom resources instead of in the config file")
+	crdNamespace := fs.String("crd-namespace", "", "namespace to watch for SyncItem resources (defaults to the pod's namespace)")
+	slackListen := fs.String("slack-listen", "", "address for Slack slash commands at /slack/commands, e.g. :8081 (disabled if empty)")
+	slackSecretEnv := fs.String("slack-signing-secret-env", "SLACK_SIGNING_SECRET", "environment variable holding the Slack signing secret, required by --slack-listen")
+	apiTokenEnv := fs.String("api-token-env", "CODESYNC_API_TOKEN", "environment variable holding a bearer token the status and gRPC APIs require when set")
+	fs.Parse(args)
+
+	cfg, manager, err := common.newManager()
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	interval := cfg.SyncInterval
+	if interval == "" {
+		interval = "0 0 * * *"
+	}
+
+	schedule, err := daemon.ParseSchedule(interval)
+	if err != nil {
+		return fmt.Errorf("invalid syncInterval: %w", err)
+	}
+
+	d := daemon.New(manager, schedule)
+	if cfg.Scheduler != nil {
+		scheduler, err := daemon.NewScheduler(cfg.Scheduler)
+		if err != nil {
+			return fmt.Errorf("invalid scheduler: %w", err)
+		}
+		d.SetScheduler(scheduler)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Without a token the APIs are open to anyone who can reach them, so they
+	// should only listen where that's trusted
+	token := os.Getenv(*apiTokenEnv)
+	if token != "" {
+		manager.Redactor().Add(token)
+	}
+
+	if *listen != "" {
+		handler := d.Handler()
+		if token != "" {
+			handler = daemon.RequireToken(handler, token)
+		}
+
+		server := &http.Server{Addr: *listen, Handler: handler}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("status API stopped: %v", err)
+			}
+		}()
+		defer server.Shutdown(context.Background())
+		log.Printf("status API listening on %s", *listen)
+	}
+
+	// Slack commands get a listener of their own, so that exposing it to Slack
+	// doesn't expose the APIs too
+	if *slackListen != "" {
+		secret := os.Getenv(*slackSecretEnv)
+		if secret == "" {
+			return fmt.Errorf("--slack-listen needs the Slack signing secret in %s", *slackSecretEnv)
+		}
+		manager.Redactor().Add(secret)
+		mux := http.NewServeMux()
+		mux.Handle("POST /slack/commands", d.SlackHandler(secret))
+
+		server := &http.Server{Addr: *slackListen, Handler: mux}
+		go func() {
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Printf("Slack commands stopped: %v", err)
+			}
+		}()
+		defer server.Shutdown(context.Background())
+		log.Printf("Slack commands listening on %s", *slackListen)
+	}
+
+	if *grpcListen != "" {
+		lis, err := net.Listen("tcp", *grpcListen)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", *grpcListen, err)
+		}
+
+		var opts []grpc.ServerOption
+		if token != "" {
+			opts = daemon.TokenAuth(token)
+		}
+		server := grpc.NewServer(opts...)
+		d.RegisterGRPC(server)
+		go func() {
+			if err := server.Serve(lis); err != nil {
+				log.Printf("gRPC API stopped: %v", err)
+			}
+		}()
+		defer server.Stop()
+		log.Printf("gRPC API listening on %s", *grpcListen)
+	}
+
+	var reconciler *operator.Reconciler
+	if common.itemsFromCRDs {
+		client, err := kube.InClusterClient()
+		if err != nil {
+			return fmt.Errorf("sync item CRDs: %w", err)
+		}
+
+		namespace := *crdNamespace
+		if namespace == "" {
+			namespace = client.Namespace
+		}
+		reconciler = &operator.Reconciler{Client: client, Namespace: namespace, Daemon: d}
+
+		// gc only sees the items of the config file unless told otherwise
+		if err := manager.MarkExternalItems("SyncItem resources in " + namespace); err != nil {
+			return fmt.Errorf("failed to mark the state directory: %w", err)
+		}
+	}
+
+	// run does an initial sync and then follows the schedule
+	run := func(ctx context.Context) error {
+		if reconciler != nil {
+			if err := reconciler.Reconcile(ctx); err != nil {
+				log.Printf("error reconciling sync items: %v", err)
+			}
+			go reconciler.Run(ctx)
+		}
+
+		log.Printf("running initial sync")
+		d.SyncAll("schedule")
+		d.SetReady(true)
+		return d.Run(ctx)
+	}
+
+	if *leaderElect {
+		elector, err := newLeaderElector(*leaseName, *leaseNamespace)
+		if err != nil {
+			return err
+		}
+
+		// Standby replicas serve the API but don't sync, and reject
+		// triggered syncs until they lead
+		d.SetLeader(false)
+		d.SetReady(true)
+		log.Printf("waiting for leader lease %s/%s as %s", elector.Namespace, elector.Name, elector.Identity)
+		err = elector.Run(ctx, func(ctx context.Context) {
+			d.SetLeader(true)
+			defer d.SetLeader(false)
+			if err := run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("sync loop stopped: %v", err)
+			}
+		})
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+		return nil
+	}
+
+	if err := run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	return nil
+}
+
+// newLeaderElector creates a Lease-based elector using the pod's service
+// account. The replica identity is POD_NAME, or the hostname.
+func newLeaderElector(name, namespace string) (*kube.LeaderElector, error) {
+	client, err := kube.InClusterClient()
+	if err != nil {
+		return nil, fmt.Errorf("leader election: %w", err)
+	}
+
+	if namespace == "" {
+		namespace = client.Namespace
+	}
+
+	identity := os.Getenv("POD_NAME")
+	if identity == "" {
+		if identity, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("leader election: %w", err)
+		}
+	}
+
+	return &kube.LeaderElector{
+		Client:    client,
+		Namespace: namespace,
+		Name:      name,
+		Identity:  identity,
+	}, nil
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	var common commonFlags
+	common.register(fs)
+	archive := fs.String("archive", "", "write the archive to this file, e.g. workspace.tar.zst")
+	fs.Parse(args)
+	if *archive == "" {
+		fs.Usage()
+		return fmt.Errorf("export needs --archive")
+	}
+
+	// Only local files and state are archived
+	common.offline = true
+	_, manager, err := common.newManager()
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	f, err := os.Create(*archive)
+	if err != nil {
+		return err
+	}
+	manifest, err := manager.Export(f)
+	if err != nil {
+		f.Close()
+		os.Remove(*archive)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	files := 0
+	for _, item := range manifest.Items {
+		files += len(item.Files)
+	}
+	fmt.Printf("exported %d items, %d files to %s\n", len(manifest.Items), files, *archive)
+	return nil
+}
+
+func runContribute(args []string) error {
+	fs := flag.NewFlagSet("contribute", flag.ExitOnError)
+	var common commonFlags
+	common.register(fs)
+	title := fs.String("title", "", "title and commit message of the pull request (default: Update <upstream path>)")
+	branch := fs.String("branch", "", "branch to create for the change (default: codesync/<item>-<hash>)")
+	fork := fs.String("fork", "auto", "where to push the branch: auto (a fork if the token can't push upstream), always or never")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: codesync contribute [flags] <item>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("contribute needs an item name")
+	}
+
+	_, manager, err := common.newManager()
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	pr, err := manager.Contribute(fs.Arg(0), csync.ContributeOptions{Title: *title, Branch: *branch, Fork: *fork})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("opened pull request #%d from %s: %s\n", pr.Number, pr.Head, pr.URL)
+	return nil
+}
+
+func runExportPatch(args []string) error {
+	fs := flag.NewFlagSet("export-patch", flag.ExitOnError)
+	var common commonFlags
+	common.register(fs)
+	output := fs.String("o", "", "write the patches to this file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: codesync export-patch [flags] <item>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("export-patch needs an item name")
+	}
+
+	_, manager, err := common.newManager()
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	item, ok := manager.Item(fs.Arg(0))
+	if !ok {
+		return fmt.Errorf("item %s not found", fs.Arg(0))
+	}
+	patches, err := manager.PendingPatches(item.Name)
+	if err != nil {
+		return err
+	}
+	if len(patches) == 0 {
+		fmt.Fprintf(os.Stderr, "%s has no pending upstream changes\n", item.Name)
+		return nil
+	}
+
+	if *output == "" {
+		return csync.WritePatches(os.Stdout, item, patches)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := csync.WritePatches(f, item, patches); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "wrote %d patches to %s\n", len(patches), *output)
+	return nil
+}
+
+func runGC(args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	var common commonFlags
+	common.register(fs)
+	dryRun := fs.Bool("dry-run", false, "only report what would be removed")
+	maxAge := fs.Duration("max-age", 30*24*time.Hour, "remove the progress of runs unfinished, and the records of audited runs made, longer ago than this")
+	cacheMaxAge := fs.Duration("cache-max-age", 30*24*time.Hour, "remove clones of git sources and cached GitHub responses unchanged for longer than this (0 keeps them)")
+	cacheMaxSize := fs.Int64("cache-max-size", 0, "remove the least recently changed clones beyond this many bytes (0 for no limit)")
+	backupMaxAge := fs.Duration("backup-max-age", 90*24*time.Hour, "remove backups older than this (0 keeps them)")
+	fs.BoolVar(&common.itemsFromCRDs, "sync-item-crds", false, "keep the state of items defined as SyncItem custom resources, as a daemon with --sync-item-crds uses")
+	crdNamespace := fs.String("crd-namespace", "", "namespace of the SyncItem resources (defaults to the pod's namespace)")
+	fs.Parse(args)
+
+	// Only the items are needed, so no token is required
+	cfg, err := config.LoadConfig(common.configPath)
+	if err != nil {
+		return err
+	}
+	validate := cfg.Validate
+	if common.itemsFromCRDs {
+		validate = cfg.ValidateSettings
+	}
+	if err := validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	items := cfg.Items
+	if common.itemsFromCRDs {
+		client, err := kube.InClusterClient()
+		if err != nil {
+			return fmt.Errorf("sync item CRDs: %w", err)
+		}
+		namespace := *crdNamespace
+		if namespace == "" {
+			namespace = client.Namespace
+		}
+		resources, err := operator.ListItems(context.Background(), client, namespace)
+		if err != nil {
+			return err
+		}
+		items = append(slices.Clip(items), resources...)
+	}
+
+	garbage, err := csync.CollectGarbage(common.stateDir, items, csync.GCOptions{
+		DryRun:        *dryRun,
+		ExternalItems: common.itemsFromCRDs,
+		MaxAge:        *maxAge,
+		CacheMaxAge:   *cacheMaxAge,
+		CacheMaxSize:  *cacheMaxSize,
+		BackupMaxAge:  *backupMaxAge,
+	})
+
+	verb := "removed"
+	if *dryRun {
+		verb = "would remove"
+	}
+	var total int64
+	for _, g := range garbage {
+		fmt.Printf("%s %s (%s)\n", verb, g.Path, g.Reason)
+		total += g.Size
+	}
+	fmt.Printf("%s %d files, %d bytes\n", verb, len(garbage), total)
+
+	return err
+}
+
+func runHook(args []string) error {
+	fs := flag.NewFlagSet("hook", flag.ExitOnError)
+	var common commonFlags
+	common.register(fs)
+	hook := fs.String("hook", "pre-commit", "install: git hook to install: "+strings.Join(githook.Hooks, ", "))
+	force := fs.Bool("force", false, "install: replace a hook that wasn't installed by codesync")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: codesync hook install [flags]")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return fmt.Errorf("missing hook command")
+	}
+
+	switch args[0] {
+	case "install":
+		fs.Parse(args[1:])
+
+		// Git runs hooks from the top of the work tree
+		configPath, err := filepath.Abs(common.configPath)
+		if err != nil {
+			return err
+		}
+		stateDir, err := filepath.Abs(common.stateDir)
+		if err != nil {
+			return err
+		}
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+
+		path, err := githook.Install(*hook, exe, []string{"--config", configPath, "--state-dir", stateDir}, *force)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("installed %s hook at %s\n", *hook, path)
+		return nil
+
+	case "run":
+		// Run by the installed hook, with git's arguments after the flags
+		if len(args) < 2 {
+			return fmt.Errorf("missing hook name")
+		}
+		fs.Parse(args[2:])
+		return checkManagedEdits(&common, args[1], fs.Args())
+	}
+
+	fs.Usage()
+	return fmt.Errorf("unknown hook command: %s", args[0])
+}
+
+// checkManagedEdits fails if the changes a git hook guards edit synced
+// targets without an override marker
+func checkManagedEdits(common *commonFlags, hook string, hookArgs []string) error {
+	if os.Getenv(githook.OverrideEnv) != "" {
+		return nil
+	}
+
+	var changes []githook.Change
+	hint := fmt.Sprintf("add a %q trailer to the commit message", githook.OverrideTrailer+": <reason>")
+	switch hook {
+	case "pre-commit", "commit-msg":
+		change, err := githook.Staged()
+		if err != nil {
+			return err
+		}
+		if hook == "commit-msg" && len(hookArgs) > 0 {
+			message, err := os.ReadFile(hookArgs[0])
+			if err != nil {
+				return err
+			}
+			change.Override = githook.HasOverride(string(message))
+		} else {
+			// The message isn't written yet
+			hint = fmt.Sprintf("set %s=<reason>", githook.OverrideEnv)
+		}
+		changes = []githook.Change{change}
+	case "pre-push":
+		var err error
+		if changes, err = githook.Pushed(os.Stdin); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown hook %q", hook)
+	}
+
+	// Only local state is needed, so the token isn't checked
+	common.skipTokenCheck = true
+	_, manager, err := common.newManager()
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	blocked := 0
+	for _, change := range changes {
+		if change.Override {
+			continue
+		}
+		edits, err := manager.ManagedEdits(change.Paths)
+		if err != nil {
+			return err
+		}
+		for _, edit := range edits {
+			where := edit.Path
+			if change.Commit != "" {
+				where = shortSHA(change.Commit) + ": " + edit.Path
+			}
+			fmt.Fprintf(os.Stderr, "%s is synced from upstream by %s and was edited locally\n", where, edit.Item)
+			blocked++
+		}
+	}
+	if blocked > 0 {
+		verb := "commit"
+		if hook == "pre-push" {
+			verb = "push"
+		}
+		return fmt.Errorf("%d synced files edited locally: change them upstream, or %s to %s anyway", blocked, hint, verb)
+	}
+	return nil
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	var common commonFlags
+	common.register(fs)
+	archive := fs.String("archive", "", "archive written by codesync export")
+	force := fs.Bool("force", false, "replace local files that differ from the archive")
+	fs.Parse(args)
+	if *archive == "" {
+		fs.Usage()
+		return fmt.Errorf("import needs --archive")
+	}
+
+	// The workspace may have no access to the sources
+	common.offline = true
+	_, manager, err := common.newManager()
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	f, err := os.Open(*archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	manifest, err := manager.Import(f, *force)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range manifest.Items {
+		if _, ok := manager.Item(item.Name); !ok {
+			fmt.Printf("warning: %s isn't in %s; its files and state were imported anyway\n", item.Name, common.configPath)
+		}
+		if item.State.LastCommitID == "" {
+			fmt.Printf("%-20s  %s, never synced\n", item.Name, item.Source)
+			continue
+		}
+		fmt.Printf("%-20s  %s at %s\n", item.Name, item.Source, shortSHA(item.State.LastCommitID))
+	}
+	fmt.Printf("imported %d items from %s\n", len(manifest.Items), *archive)
+	return nil
+}
+
+func runLogin(args []string) error {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	var common commonFlags
+	common.register(fs)
+	clientID := fs.String("client-id", os.Getenv("CODESYNC_OAUTH_CLIENT_ID"), "client ID of the OAuth app to log in with (env CODESYNC_OAUTH_CLIENT_ID)")
+	scopes := fs.String("scopes", "repo", "comma-separated scopes to request; repo is needed for private sources")
+	fs.Parse(args)
+
+	// The config file is optional here; it only selects the GitHub instance
+	cfg := &config.Config{}
+	if loaded, err := config.LoadConfig(common.configPath); err == nil {
+		cfg = loaded
+	}
+	host := cfg.GitHubHost()
+
+	flow := &github.DeviceFlow{WebURL: cfg.GitHubWebURL(), ClientID: *clientID}
+	for _, scope := range strings.Split(*scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			flow.Scopes = append(flow.Scopes, scope)
+		}
+	}
+
+	code, err := flow.Start()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Open %s and enter the code %s\n", code.VerificationURI, code.UserCode)
+
+	token, err := flow.Wait(code)
+	if err != nil {
+		return err
+	}
+	if err := secrets.NewKeychain().Login(host, token); err != nil {
+		return fmt.Errorf("error storing the token: %w", err)
+	}
+
+	fmt.Printf("logged in to %s; the token is stored in the keychain\n", host)
+	return nil
+}
+
+func runLSP(args []string) error {
+	fs := flag.NewFlagSet("lsp", flag.ExitOnError)
+	var common commonFlags
+	common.register(fs)
+	fs.Parse(args)
+
+	// Only local state is read, and stdout carries the protocol
+	common.skipTokenCheck = true
+	_, manager, err := common.newManager()
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	return lsp.New(manager, version.Version).Serve(os.Stdin, os.Stdout)
+}
+
+func runRenameItem(args []string) error {
+	fs := flag.NewFlagSet("rename-item", flag.ExitOnError)
+	var common commonFlags
+	common.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: codesync rename-item [flags] <old-name> <new-name>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("rename-item needs the old and new item names")
+	}
+	oldName, newName := fs.Arg(0), fs.Arg(1)
+
+	// The config only supplies the state settings, so no token is required
+	cfg, err := config.LoadConfig(common.configPath)
+	if err != nil {
+		return err
+	}
+
+	renamed, err := csync.RenameItemState(cfg, common.stateDir, oldName, newName)
+	if err != nil {
+		return err
+	}
+	for _, path := range renamed {
+		fmt.Printf("renamed %s\n", path)
+	}
+
+	for _, item := range cfg.Items {
+		if item.Name == oldName {
+			fmt.Printf("%s is still named %s in %s; rename it there too\n", newName, oldName, common.configPath)
+		}
+	}
+	return nil
+}
+
+func runReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	var common commonFlags
+	common.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: codesync replay [flags] [run-id]")
+		fmt.Fprintln(fs.Output(), "Without a run ID, the recorded runs are listed.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return fmt.Errorf("replay takes at most one run ID")
+	}
+
+	// Runs are replayed from their record alone
+	common.offline = true
+	_, manager, err := common.newManager()
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	if fs.NArg() == 0 {
+		runs, err := manager.Runs()
+		if err != nil {
+			return err
+		}
+		if len(runs) == 0 {
+			fmt.Println("no runs recorded; set auditRuns in the config to record them")
+		}
+		for _, id := range runs {
+			fmt.Println(id)
+		}
+		return nil
+	}
+
+	results, err := manager.Replay(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var unreproduced, changed int
+	for _, result := range results {
+		commit := "never synced"
+		if result.Commit != "" {
+			commit = shortSHA(result.Commit)
+		}
+		verdict := "reproduced"
+		if !result.Reproduced {
+			verdict = "NOT reproduced"
+			unreproduced++
+		}
+		if len(result.Changed) > 0 {
+			verdict += ", targets changed since"
+			changed++
+		}
+		fmt.Printf("%-20s  %-12s  %s\n", result.Item, commit, verdict)
+		for _, d := range result.Differences {
+			fmt.Printf("    replay: %s\n", d)
+		}
+		for _, path := range result.Changed {
+			fmt.Printf("    changed: %s\n", path)
+		}
+	}
+
+	switch {
+	case unreproduced > 0:
+		return fmt.Errorf("%d of %d items didn't reproduce run %s", unreproduced, len(results), fs.Arg(0))
+	case changed > 0:
+		return fmt.Errorf("%d of %d items have targets that changed since run %s", changed, len(results), fs.Arg(0))
+	}
+	return nil
+}
+
+func runRollout(args []string) error {
+	fs := flag.NewFlagSet("rollout", flag.ExitOnError)
+	var common commonFlags
+	common.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: codesync rollout status [item] | approve <item> <ring> | retry <item> [flags]")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return fmt.Errorf("missing rollout command")
+	}
+	command := args[0]
+	fs.Parse(args[1:])
+
+	// Rollouts are local state, so the token isn't checked
+	common.skipTokenCheck = true
+	_, manager, err := common.newManager()
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	switch command {
+	case "status":
+		var names []string
+		if fs.NArg() > 0 {
+			names = fs.Args()
+		} else {
+			for _, item := range manager.Items() {
+				if len(item.Target.Rings) > 0 {
+					names = append(names, item.Name)
+				}
+			}
+		}
+		if len(names) == 0 {
+			fmt.Println("no items have rings")
+		}
+		for _, name := range names {
+			commit, rings, err := manager.RolloutProgress(name)
+			if err != nil {
+				return err
+			}
+			if commit == "" {
+				fmt.Printf("%s: nothing rolled out yet\n", name)
+				continue
+			}
+			fmt.Printf("%s: rolling out %s\n", name, shortSHA(commit))
+			for _, ring := range rings {
+				var status string
+				switch {
+				case ring.Unhealthy != "":
+					status = "unhealthy"
+				case !ring.Applied.IsZero():
+					status = "applied " + ring.Applied.Local().Format("2006-01-02 15:04")
+				case ring.Waiting == "approval":
+					status = "awaiting approval"
+				case ring.Waiting == "soak":
+					status = "soaking until " + ring.Opens.Local().Format("2006-01-02 15:04")
+				case ring.Waiting != "":
+					status = "waiting for " + ring.Waiting
+				default:
+					status = "due on the next sync"
+				}
+				fmt.Printf("  %-12s  %-30s  %d files\n", ring.Name, status, len(ring.Files))
+				if ring.Unhealthy != "" {
+					fmt.Printf("    %s\n", ring.Unhealthy)
+				}
+			}
+		}
+		return nil
+
+	case "approve":
+		if fs.NArg() != 2 {
+			fs.Usage()
+			return fmt.Errorf("rollout approve needs an item and a ring")
+		}
+		if err := manager.ApproveRing(fs.Arg(0), fs.Arg(1)); err != nil {
+			return err
+		}
+		fmt.Printf("approved ring %s of %s; it gets the version on the next sync\n", fs.Arg(1), fs.Arg(0))
+		return nil
+
+	case "retry":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return fmt.Errorf("rollout retry needs an item")
+		}
+		if err := manager.RetryRollout(fs.Arg(0)); err != nil {
+			return err
+		}
+		fmt.Printf("cleared the unhealthy rings of %s; the rollout resumes on the next sync\n", fs.Arg(0))
+		return nil
+	}
+
+	fs.Usage()
+	return fmt.Errorf("unknown rollout command: %s", command)
+}
+
+func runDiscover(args []string) error {
+	fs := flag.NewFlagSet("discover", flag.ExitOnError)
+	var common commonFlags
+	common.register(fs)
+	against := fs.String("against", "", "upstream repository as owner/repo (required)")
+	ref := fs.String("ref", "main", "upstream branch to compare against")
+	prefix := fs.String("path", "", "only compare upstream files under this path")
+	dir := fs.String("dir", ".", "local directory to scan")
+	threshold := fs.Float64("threshold", 0.7, "minimum similarity (0-1) to report a match")
+	fs.Parse(args)
+
+	owner, repo, ok := strings.Cut(*against, "/")
+	if !ok || owner == "" || repo == "" {
+		return fmt.Errorf("--against must be owner/repo")
+	}
+
+	// The config file is optional here; it only supplies the token and the
+	// GitHub Enterprise instance
+	token := config.EnvToken()
+	var baseURL, uploadURL string
+	if cfg, err := config.LoadConfig(common.configPath); err == nil {
+		if cfg.GitHubToken != "" {
+			token = cfg.GitHubToken
+		}
+		baseURL, uploadURL = cfg.GitHubBaseURL, cfg.GitHubUploadURL
+	}
+	if token == "" {
+		return fmt.Errorf("GitHub token is required (set GITHUB_TOKEN)")
+	}
+	client := github.NewClient(token)
+	if baseURL != "" {
+		var err error
+		if client, err = github.NewEnterpriseClient(token, baseURL, uploadURL); err != nil {
+			return err
+		}
+	}
+
+	local, err := discover.ScanLocal(client, *dir)
+	if err != nil {
+		return err
+	}
+
+	upstream, err := discover.ScanUpstream(client, owner, repo, *ref, *prefix)
+	if err != nil {
+		return err
+	}
+
+	matches := discover.FindMatches(local, upstream, *threshold)
+	fmt.Fprintf(os.Stderr, "compared %d local with %d upstream functions, %d matches\n", len(local), len(upstream), len(matches))
+
+	items := discover.SuggestItems(matches, owner, repo, *ref)
+	if len(items) > 0 {
+		out, err := yaml.Marshal(map[string]interface{}{"items": items})
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(out)
+	}
+
+	for _, m := range matches {
+		if m.Renamed() {
+			fmt.Printf("# %s:%s resembles %s:%s (%.0f%%) but was renamed, so it can't be synced as-is\n",
+				m.Local.Path, m.Local.Name, m.Upstream.Path, m.Upstream.Name, m.Similarity*100)
+		}
+	}
+
+	return nil
+}
+
+// ANSI colors for item status lines
+const (
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorReset  = "\x1b[0m"
+)
+
+// paint wraps s in an ANSI color when enabled
+func paint(enabled bool, color, s string) string {
+	if !enabled {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// itemContact describes who to ask about an item, if anyone is configured
+func itemContact(item config.SyncItem) string {
+	contacts := strings.Join(item.Contacts, ", ")
+	switch {
+	case item.Owner == "":
+		return contacts
+	case contacts == "":
+		return item.Owner
+	}
+	return item.Owner + " (" + contacts + ")"
+}
+
+// printReports writes a human-readable summary of each item
+func printReports(reports []*csync.SyncReport, color bool) {
+	for _, report := range reports {
+		if report.Relocated != "" {
+			fmt.Printf("→ %s: function moved, now syncing %s\n", report.SyncItem.Name, report.Relocated)
+		}
+
+		switch {
+		case report.Deferred:
+			fmt.Println(paint(color, colorYellow, fmt.Sprintf("… %s (deferred: API call budget exhausted)", report.SyncItem.Name)))
+		case len(report.Errors) > 0:
+			fmt.Println(paint(color, colorRed, fmt.Sprintf("✗ %s (%s)", report.SyncItem.Name, report.Failure)))
+			for _, e := range report.Errors {
+				fmt.Printf("    %s\n", e)
+			}
+			if report.ConflictID != "" {
+				fmt.Printf("    see `codesync conflicts show %s`\n", report.ConflictID)
+			}
+			if contact := itemContact(report.SyncItem); contact != "" {
+				fmt.Printf("    contact %s\n", contact)
+			}
+		case len(report.UpdatedFiles) > 0:
+			fmt.Println(paint(color, colorYellow, "↻ "+report.SyncItem.Name))
+			for _, f := range report.UpdatedFiles {
+				switch {
+				case slices.Contains(report.CreatedFiles, f):
+					fmt.Printf("    created %s\n", f)
+				case slices.Contains(report.DeletedFiles, f):
+					fmt.Printf("    deleted %s\n", f)
+				default:
+					fmt.Printf("    updated %s\n", f)
+				}
+			}
+			if len(report.Owners) > 0 {
+				fmt.Printf("    owners: %s\n", strings.Join(report.Owners, ", "))
+			}
+		default:
+			fmt.Println(paint(color, colorGreen, "✓ "+report.SyncItem.Name))
+		}
+
+		if report.Rollout != "" {
+			fmt.Printf("    rollout: %s\n", report.Rollout)
+		}
+		for _, change := range report.Breaking {
+			fmt.Printf("    ⚠ breaking: %s\n", change)
+		}
+		for _, change := range report.Endpoints {
+			fmt.Printf("    %s\n", change)
+		}
+		for _, path := range report.Stale {
+			fmt.Printf("    ⚠ stale: %s (run `%s`)\n", path, report.SyncItem.Generate.Command)
+		}
+		for _, warning := range report.Warnings {
+			fmt.Printf("    ⚠ %s\n", warning)
+		}
+	}
+
+	// Policy violations get a section of their own, after every item
+	header := false
+	for _, report := range reports {
+		if len(report.Violations) == 0 {
+			continue
+		}
+		if !header {
+			fmt.Println(paint(color, colorRed, "\nPolicy violations:"))
+			header = true
+		}
+		fmt.Printf("  %s\n", report.SyncItem.Name)
+		for _, violation := range report.Violations {
+			fmt.Printf("    - %s\n", violation)
+		}
+	}
+}
+
+func runSelfUpdate(args []string) error {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	check := fs.Bool("check", false, "only report whether a newer release is available")
+	repository := fs.String("repo", selfupdate.DefaultRepository, "repository publishing the releases, as owner/repo")
+	fs.Parse(args)
+
+	result, err := selfupdate.Update(selfupdate.Options{Repository: *repository, CheckOnly: *check})
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case result.Updated:
+		fmt.Printf("updated codesync %s to %s\n", result.Current, result.Latest)
+	case result.Available:
+		fmt.Printf("codesync %s is available (this is %s)\n", result.Latest, result.Current)
+	default:
+		fmt.Printf("codesync %s is up to date\n", result.Current)
+	}
+	return nil
+}
+
+func runStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	var common commonFlags
+	common.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: codesync status [flags]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	// Status is local state, so the token isn't checked
+	common.skipTokenCheck = true
+	cfg, manager, err := common.newManager()
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	var scheduler *daemon.Scheduler
+	if cfg.Scheduler != nil {
+		if scheduler, err = daemon.NewScheduler(cfg.Scheduler); err != nil {
+			return fmt.Errorf("invalid scheduler: %w", err)
+		}
+	} else {
+		interval := cfg.SyncInterval
+		if interval == "" {
+			interval = "0 0 * * *"
+		}
+		fmt.Printf("the daemon syncs all items on %q\n", interval)
+	}
+
+	for _, item := range manager.Items() {
+		state, err := manager.ItemState(item.Name)
+		synced := err == nil && !state.LastSync.IsZero()
+
+		var status string
+		switch {
+		case item.Disabled:
+			status = "disabled"
+		case !synced:
+			status = "never synced"
+		case state.Failing:
+			status = "failing"
+		case state.HasLocalChanges && state.HasRemoteChanges:
+			status = "conflict"
+		case state.CommitsBehind == 1:
+			status = "1 commit behind"
+		case state.CommitsBehind > 1:
+			status = fmt.Sprintf("%d commits behind", state.CommitsBehind)
+		default:
+			status = "up to date"
+		}
+		line := fmt.Sprintf("%-20s  %-16s", item.Name, status)
+		if synced {
+			line += "  synced " + state.LastSync.Local().Format("2006-01-02 15:04")
+			if state.Tag != "" {
+				line += " at " + state.Tag
+			}
+			if state.Available != "" {
+				line += " (" + state.Available + " available)"
+			}
+		}
+		if scheduler != nil && !item.Disabled {
+			line += "  " + describeSchedule(scheduler, item, state, synced)
+		}
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+	return nil
+}
+
+// describeSchedule tells how often the daemon's scheduler polls an item, and
+// what it learned about the item's upstream to choose that
+func describeSchedule(scheduler *daemon.Scheduler, item config.SyncItem, state csync.State, synced bool) string {
+	interval := scheduler.Interval(item, state)
+	schedule := "every " + formatInterval(interval)
+	if synced {
+		schedule += ", next " + state.LastSync.Add(interval).Local().Format("2006-01-02 15:04")
+	}
+
+	var learned []string
+	if changes := state.ChangeInterval(); changes > 0 {
+		learned = append(learned, "upstream changes every "+formatInterval(changes))
+	}
+	switch {
+	case state.QuietSyncs == 1:
+		learned = append(learned, "1 quiet poll")
+	case state.QuietSyncs > 1:
+		learned = append(learned, fmt.Sprintf("%d quiet polls", state.QuietSyncs))
+	}
+	if len(learned) > 0 {
+		schedule += " (" + strings.Join(learned, ", ") + ")"
+	}
+	return schedule
+}
+
+// formatInterval formats a duration to the minute, without zero units
+func formatInterval(d time.Duration) string {
+	if d < time.Minute {
+		return d.Round(time.Second).String()
+	}
+	s := d.Round(time.Minute).String()
+	s = strings.TrimSuffix(s, "0s")
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+func runTelemetry(args []string) error {
+	fs := flag.NewFlagSet("telemetry", flag.ExitOnError)
+	var common commonFlags
+	common.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: codesync telemetry status [flags]")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 || args[0] != "status" {
+		fs.Usage()
+		return fmt.Errorf("unknown telemetry command")
+	}
+	fs.Parse(args[1:])
+
+	// Only the telemetry settings and items are needed, so no token is required
+	cfg, err := config.LoadConfig(common.configPath)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case telemetry.Enabled(cfg.Telemetry):
+		fmt.Printf("telemetry is enabled; after each run, usage like this is sent to %s:\n", cfg.Telemetry.Endpoint)
+	case cfg.Telemetry != nil && cfg.Telemetry.Enabled && cfg.Telemetry.Endpoint != "":
+		fmt.Println("telemetry is disabled by DO_NOT_TRACK; it would send usage like this:")
+	default:
+		fmt.Println("telemetry is disabled; set telemetry.enabled and telemetry.endpoint to send usage like this:")
+	}
+
+	out, err := json.MarshalIndent(telemetry.Collect(cfg.Items), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+func runBackups(args []string) error {
+	fs := flag.NewFlagSet("backups", flag.ExitOnError)
+	var common commonFlags
+	common.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: codesync backups list | restore <backup> [flags]")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return fmt.Errorf("missing backups command")
+	}
+	command := args[0]
+	fs.Parse(args[1:])
+
+	// Backups are kept in the state directory
+	common.offline = true
+	_, manager, err := common.newManager()
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	switch command {
+	case "list":
+		names, err := manager.Backups()
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			fmt.Println("no backups")
+		}
+		for _, name := range names {
+			backup, err := manager.LoadBackup(name)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s  %s  %d file(s)\n", backup.Name, backup.Created.Format(time.RFC3339), len(backup.Files))
+		}
+		return nil
+
+	case "restore":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return fmt.Errorf("restore needs the name of the backup")
+		}
+		restored, err := manager.RestoreBackup(fs.Arg(0))
+		for _, path := range restored {
+			fmt.Printf("restored %s\n", path)
+		}
+		return err
+	}
+
+	fs.Usage()
+	return fmt.Errorf("unknown backups command: %s", command)
+}
+
+func runUndo(args []string) error {
+	fs := flag.NewFlagSet("undo", flag.ExitOnError)
+	var common commonFlags
+	common.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: codesync undo [flags] <item>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("undo needs the name of the item")
+	}
+
+	// What the sync replaced is kept in the state directory
+	common.offline = true
+	_, manager, err := common.newManager()
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	restored, err := manager.Rollback(fs.Arg(0))
+	for _, path := range restored {
+		fmt.Printf("restored %s\n", path)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is back at its previous sync; the next sync applies the upstream change again\n", fs.Arg(0))
+	return nil
+}
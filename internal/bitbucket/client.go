@@ -0,0 +1,332 @@
+// Package bitbucket reads files and history from Bitbucket Cloud repositories
+// through the REST API (2.0), offering the same operations as the GitHub
+// client.
+package bitbucket
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/github"
+)
+
+// DefaultURL is the API root of Bitbucket Cloud
+const DefaultURL = "https://api.bitbucket.org/2.0"
+
+// requestTimeout bounds each API request
+const requestTimeout = 30 * time.Second
+
+// Client wraps the Bitbucket Cloud REST API
+type Client struct {
+	baseURL  string
+	username string
+	password string // App password
+	client   *http.Client
+	ctx      context.Context
+	budget   *github.Budget // Set by SetLimits
+}
+
+// APIError is an unsuccessful response from the API
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Bitbucket API returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Is makes errors.Is match github.ErrNotFound and github.ErrRateLimited for
+// the responses that mean those
+func (e *APIError) Is(target error) bool {
+	kind := github.ErrorForStatus(e.StatusCode)
+	return kind != nil && target == kind
+}
+
+// NewClient creates a client authenticating with a username and app password.
+// Both may be empty for public repositories.
+func NewClient(username, appPassword string) *Client {
+	return &Client{
+		baseURL:  DefaultURL,
+		username: username,
+		password: appPassword,
+		client:   &http.Client{Timeout: requestTimeout},
+		ctx:      context.Background(),
+	}
+}
+
+// SetLimits bounds the client's concurrency, bandwidth and API calls. It
+// should be called before the client is used.
+func (c *Client) SetLimits(limits github.Limits) {
+	c.budget = github.NewBudget(limits)
+	c.client = &http.Client{Transport: c.budget.Transport(c.client.Transport), Timeout: c.client.Timeout}
+}
+
+// ResetBudget starts a new allowance of API calls, e.g. at the start of a run
+func (c *Client) ResetBudget() {
+	if c.budget != nil {
+		c.budget.Reset()
+	}
+}
+
+// BudgetExhausted reports whether the allowance of API calls is used up
+func (c *Client) BudgetExhausted() bool {
+	return c.budget != nil && c.budget.Exhausted()
+}
+
+// SetBaseURL points the client at a different API root
+func (c *Client) SetBaseURL(rawURL string) {
+	c.baseURL = strings.TrimSuffix(rawURL, "/")
+}
+
+// repository returns the API path of a repository
+func repository(workspace, repo string) string {
+	return "/repositories/" + url.PathEscape(workspace) + "/" + url.PathEscape(repo)
+}
+
+// escapePath escapes each segment of a file path
+func escapePath(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// do sends a GET request for a path or, if it starts with the API root, a
+// full URL such as a pagination link
+func (c *Client) do(path string, query url.Values) (*http.Response, error) {
+	u := path
+	if !strings.HasPrefix(path, c.baseURL) {
+		u = c.baseURL + path
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(c.ctx, "GET", u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var body struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: body.Error.Message}
+	}
+	return resp, nil
+}
+
+// get fetches an API path into v
+func (c *Client) get(path string, query url.Values, v interface{}) error {
+	resp, err := c.do(path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("error parsing response: %w", err)
+	}
+	return nil
+}
+
+// getText fetches an API path returning plain text
+func (c *Client) getText(path string, query url.Values) (string, error) {
+	resp, err := c.do(path, query)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response: %w", err)
+	}
+	return string(data), nil
+}
+
+// blobSHA returns the git blob hash of content, as Bitbucket doesn't report it
+func blobSHA(content string) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	io.WriteString(h, content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// GetFile retrieves a file from a Bitbucket repository
+func (c *Client) GetFile(workspace, repo, path, ref string) (*github.FileInfo, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	src := repository(workspace, repo) + "/src/" + url.PathEscape(ref) + "/" + escapePath(path)
+
+	var meta struct {
+		Path   string `json:"path"`
+		Type   string `json:"type"`
+		Commit struct {
+			Hash string `json:"hash"`
+		} `json:"commit"`
+	}
+	if err := c.get(src, url.Values{"format": {"meta"}}, &meta); err != nil {
+		return nil, fmt.Errorf("error getting file content: %w", err)
+	}
+	if meta.Type != "commit_file" {
+		return nil, fmt.Errorf("error getting file content: %s is not a file", path)
+	}
+
+	// Read the commit the metadata came from, in case the ref moved since
+	content, err := c.getText(repository(workspace, repo)+"/src/"+url.PathEscape(meta.Commit.Hash)+"/"+escapePath(path), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error getting file content: %w", err)
+	}
+
+	return &github.FileInfo{
+		Content:  content,
+		Path:     meta.Path,
+		SHA:      blobSHA(content),
+		CommitID: meta.Commit.Hash,
+	}, nil
+}
+
+// GetDirectory retrieves all files below a directory in a Bitbucket repository
+func (c *Client) GetDirectory(workspace, repo, path, ref string) (map[string]*github.FileInfo, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	result := make(map[string]*github.FileInfo)
+	next := repository(workspace, repo) + "/src/" + url.PathEscape(ref) + "/"
+	if dir := escapePath(path); dir != "" {
+		next += dir + "/"
+	}
+	query := url.Values{"max_depth": {"10"}, "pagelen": {"100"}}
+	for next != "" {
+		var page struct {
+			Values []struct {
+				Type string `json:"type"`
+				Path string `json:"path"`
+			} `json:"values"`
+			Next string `json:"next"`
+		}
+		if err := c.get(next, query, &page); err != nil {
+			return nil, fmt.Errorf("error getting directory content: %w", err)
+		}
+
+		for _, entry := range page.Values {
+			if entry.Type != "commit_file" {
+				continue
+			}
+			file, err := c.GetFile(workspace, repo, entry.Path, ref)
+			if err != nil {
+				return nil, fmt.Errorf("error getting %s: %w", entry.Path, err)
+			}
+			result[entry.Path] = file
+		}
+
+		// Pagination links already carry the query
+		next, query = page.Next, nil
+	}
+
+	return result, nil
+}
+
+// GetCommitsSince gets the commits to a file on a branch (or the main branch
+// if ref is empty) since a specific date or commit, newest first. If
+// sinceCommit isn't in the file's history, all commits are returned.
+func (c *Client) GetCommitsSince(workspace, repo, path, ref string, since time.Time, sinceCommit string) ([]github.CommitInfo, error) {
+	var result []github.CommitInfo
+	next := repository(workspace, repo) + "/commits"
+	if ref != "" {
+		next += "/" + url.PathEscape(ref)
+	}
+	query := url.Values{"path": {path}, "pagelen": {"100"}}
+	for next != "" {
+		var page struct {
+			Values []struct {
+				Hash    string    `json:"hash"`
+				Message string    `json:"message"`
+				Date    time.Time `json:"date"`
+				Author  struct {
+					Raw  string `json:"raw"`
+					User *struct {
+						DisplayName string `json:"display_name"`
+					} `json:"user"`
+				} `json:"author"`
+			} `json:"values"`
+			Next string `json:"next"`
+		}
+		if err := c.get(next, query, &page); err != nil {
+			return nil, fmt.Errorf("error listing commits: %w", err)
+		}
+
+		for _, commit := range page.Values {
+			if sinceCommit != "" && commit.Hash == sinceCommit {
+				return result, nil
+			}
+			// Commits are newest first, so the rest are older still
+			if !since.IsZero() && commit.Date.Before(since) {
+				return result, nil
+			}
+
+			author, email := commit.Author.Raw, ""
+			// Raw is "Name <email>" as in the commit
+			if addr, err := mail.ParseAddress(commit.Author.Raw); err == nil {
+				email = addr.Address
+			}
+			if commit.Author.User != nil {
+				author = commit.Author.User.DisplayName
+			}
+			result = append(result, github.CommitInfo{
+				SHA:       commit.Hash,
+				Message:   commit.Message,
+				Author:    author,
+				Email:     email,
+				Timestamp: commit.Date,
+			})
+		}
+
+		next, query = page.Next, nil
+	}
+
+	return result, nil
+}
+
+// GetFileDiff gets the diff between two versions of a file
+func (c *Client) GetFileDiff(workspace, repo, path, baseRef, headRef string) (string, error) {
+	// The spec names the newer revision first; topic=false compares the two
+	// revisions directly rather than against their merge base
+	spec := url.PathEscape(headRef + ".." + baseRef)
+	query := url.Values{"path": {path}, "topic": {"false"}}
+
+	diff, err := c.getText(repository(workspace, repo)+"/diff/"+spec, query)
+	if err != nil {
+		return "", fmt.Errorf("error comparing commits: %w", err)
+	}
+	if diff == "" {
+		return "", fmt.Errorf("file %s was not changed between %s and %s", path, baseRef, headRef)
+	}
+	return diff, nil
+}
@@ -0,0 +1,131 @@
+package bitbucket
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) (*Client, string) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client := NewClient("alice", "app-password")
+	client.SetBaseURL(server.URL)
+	return client, server.URL
+}
+
+func TestGetFile(t *testing.T) {
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "alice" || pass != "app-password" {
+			t.Errorf("Expected app password auth, got %v", r.Header)
+		}
+		switch {
+		case r.URL.Path == "/repositories/acme/utils/src/main/pkg/log.go" && r.URL.Query().Get("format") == "meta":
+			fmt.Fprint(w, `{"path": "pkg/log.go", "type": "commit_file", "commit": {"hash": "c1"}}`)
+		case r.URL.Path == "/repositories/acme/utils/src/c1/pkg/log.go":
+			fmt.Fprint(w, "package log\n")
+		default:
+			t.Errorf("Unexpected request: %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	file, err := client.GetFile("acme", "utils", "pkg/log.go", "main")
+	if err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	if file.Content != "package log\n" || file.CommitID != "c1" || file.SHA != blobSHA("package log\n") {
+		t.Errorf("Unexpected file: %+v", file)
+	}
+	// git hash-object of an empty file
+	if blobSHA("") != "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391" {
+		t.Errorf("Unexpected blob hash of empty content: %s", blobSHA(""))
+	}
+}
+
+func TestGetFileNotFound(t *testing.T) {
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"type": "error", "error": {"message": "No such file or directory: missing.go"}}`)
+	})
+
+	_, err := client.GetFile("acme", "utils", "missing.go", "main")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "No such file or directory: missing.go" {
+		t.Errorf("Expected a 404 APIError, got %v", err)
+	}
+}
+
+func TestGetDirectory(t *testing.T) {
+	var serverURL string
+	client, serverURL := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/repositories/acme/utils/src/main/lib/" && r.URL.Query().Get("page") == "":
+			fmt.Fprintf(w, `{"values": [{"type": "commit_directory", "path": "lib/sub"}, {"type": "commit_file", "path": "lib/a.go"}], "next": "%s/repositories/acme/utils/src/main/lib/?page=2"}`, serverURL)
+		case r.URL.Path == "/repositories/acme/utils/src/main/lib/":
+			fmt.Fprint(w, `{"values": [{"type": "commit_file", "path": "lib/sub/b.go"}]}`)
+		case r.URL.Query().Get("format") == "meta":
+			fmt.Fprint(w, `{"type": "commit_file", "commit": {"hash": "c1"}}`)
+		default:
+			fmt.Fprint(w, "x")
+		}
+	})
+
+	files, err := client.GetDirectory("acme", "utils", "lib", "main")
+	if err != nil {
+		t.Fatalf("GetDirectory failed: %v", err)
+	}
+	if len(files) != 2 || files["lib/a.go"] == nil || files["lib/sub/b.go"] == nil {
+		t.Errorf("Expected files from both pages, got %v", files)
+	}
+}
+
+func TestGetCommitsSince(t *testing.T) {
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("path") != "strings.go" {
+			t.Errorf("Unexpected path filter: %s", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `{"values": [
+			{"hash": "ccc", "message": "Third", "date": "2024-03-03T00:00:00Z", "author": {"raw": "Carol <carol@example.com>", "user": {"display_name": "Carol"}}},
+			{"hash": "bbb", "message": "Second", "date": "2024-03-02T00:00:00Z", "author": {"raw": "Bob <bob@example.com>"}},
+			{"hash": "aaa", "message": "First", "date": "2024-03-01T00:00:00Z", "author": {"raw": "Alice <alice@example.com>"}}
+		]}`)
+	})
+
+	commits, err := client.GetCommitsSince("acme", "utils", "strings.go", "", time.Time{}, "bbb")
+	if err != nil {
+		t.Fatalf("GetCommitsSince failed: %v", err)
+	}
+	if len(commits) != 1 || commits[0].SHA != "ccc" || commits[0].Author != "Carol" {
+		t.Errorf("Expected only the commit after bbb, got %+v", commits)
+	}
+
+	if commits, _ := client.GetCommitsSince("acme", "utils", "strings.go", "", time.Time{}, "gone"); len(commits) != 3 {
+		t.Errorf("Expected all commits when the starting commit is gone, got %d", len(commits))
+	}
+
+	since := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+	if commits, _ := client.GetCommitsSince("acme", "utils", "strings.go", "", since, ""); len(commits) != 2 || commits[1].Author != "Bob <bob@example.com>" {
+		t.Errorf("Expected the commits since March 2, got %+v", commits)
+	}
+}
+
+func TestGetFileDiff(t *testing.T) {
+	client, _ := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repositories/acme/utils/diff/v2..v1" || r.URL.Query().Get("path") != "a.go" {
+			t.Errorf("Unexpected request: %s", r.URL)
+		}
+		if r.URL.Query().Get("path") == "a.go" {
+			fmt.Fprint(w, "@@ -1 +1 @@\n-x\n+y\n")
+		}
+	})
+
+	patch, err := client.GetFileDiff("acme", "utils", "a.go", "v1", "v2")
+	if err != nil || patch != "@@ -1 +1 @@\n-x\n+y\n" {
+		t.Errorf("Unexpected diff: %q, %v", patch, err)
+	}
+}
@@ -0,0 +1,53 @@
+// Package ci detects when codesync runs under a CI system, so defaults can
+// suit a build log rather than a terminal.
+package ci
+
+import "os"
+
+// Environment describes the CI system codesync is running under
+type Environment struct {
+	Name string // "github-actions", "gitlab-ci", "jenkins", "ci" for other systems, or "" outside CI
+}
+
+// Detect inspects the process environment
+func Detect() Environment {
+	return detect(os.Getenv)
+}
+
+func detect(getenv func(string) string) Environment {
+	switch {
+	case getenv("GITHUB_ACTIONS") == "true":
+		return Environment{Name: "github-actions"}
+	case getenv("GITLAB_CI") == "true":
+		return Environment{Name: "gitlab-ci"}
+	case getenv("JENKINS_URL") != "":
+		return Environment{Name: "jenkins"}
+	case getenv("CI") != "" && getenv("CI") != "false":
+		return Environment{Name: "ci"}
+	}
+	return Environment{}
+}
+
+// CI reports whether codesync is running under a CI system
+func (e Environment) CI() bool {
+	return e.Name != ""
+}
+
+// Color reports whether output should be colorized by default: never in CI
+// or when NO_COLOR is set, and otherwise only on a terminal
+func (e Environment) Color(f *os.File) bool {
+	if e.CI() || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// LogFormat returns the default log format: "json" in CI, where logs are
+// usually collected and parsed, and "text" otherwise
+func (e Environment) LogFormat() string {
+	if e.CI() {
+		return "json"
+	}
+	return "text"
+}
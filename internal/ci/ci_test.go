@@ -0,0 +1,43 @@
+package ci
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		want string
+	}{
+		{map[string]string{"GITHUB_ACTIONS": "true", "CI": "true"}, "github-actions"},
+		{map[string]string{"GITLAB_CI": "true", "CI": "true"}, "gitlab-ci"},
+		{map[string]string{"JENKINS_URL": "https://jenkins.example.com/"}, "jenkins"},
+		{map[string]string{"CI": "1"}, "ci"},
+		{map[string]string{"CI": "false"}, ""},
+		{nil, ""},
+	}
+
+	for _, tt := range tests {
+		env := detect(func(name string) string { return tt.env[name] })
+		if env.Name != tt.want {
+			t.Errorf("detect(%v) = %q, want %q", tt.env, env.Name, tt.want)
+		}
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	inCI := Environment{Name: "gitlab-ci"}
+	if inCI.LogFormat() != "json" || (Environment{}).LogFormat() != "text" {
+		t.Error("Expected JSON logs only in CI")
+	}
+
+	f, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if inCI.Color(f) || (Environment{}).Color(f) {
+		t.Error("Expected no color in CI or when not writing to a terminal")
+	}
+}
@@ -0,0 +1,143 @@
+// Package codeowners reads GitHub CODEOWNERS files and finds the owners of
+// paths in a repository
+package codeowners
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Locations lists where GitHub looks for a CODEOWNERS file, in order
+var Locations = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// Rule assigns owners to the paths matching a pattern
+type Rule struct {
+	Pattern string
+	Owners  []string
+	re      *regexp.Regexp
+}
+
+// File is a parsed CODEOWNERS file. Later rules take precedence.
+type File struct {
+	Rules []Rule
+}
+
+// Load reads the CODEOWNERS file of the repository at root. It returns nil
+// if the repository doesn't have one.
+func Load(root string) (*File, error) {
+	for _, location := range Locations {
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(location)))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		f, err := Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", location, err)
+		}
+		return f, nil
+	}
+	return nil, nil
+}
+
+// Parse reads the rules of a CODEOWNERS file
+func Parse(content string) (*File, error) {
+	f := &File{}
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if i := strings.Index(line, " #"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		re, err := compile(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		f.Rules = append(f.Rules, Rule{Pattern: fields[0], Owners: fields[1:], re: re})
+	}
+	return f, scanner.Err()
+}
+
+// Owners returns the owners of a slash-separated path relative to the
+// repository root. The last matching rule wins; it may have no owners.
+func (f *File) Owners(p string) []string {
+	p = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(p)), "/")
+	for i := len(f.Rules) - 1; i >= 0; i-- {
+		if f.Rules[i].re.MatchString(p) {
+			return f.Rules[i].Owners
+		}
+	}
+	return nil
+}
+
+// OwnersOf returns the owners of any of the paths, without duplicates, in
+// the order they are first found
+func (f *File) OwnersOf(paths []string) []string {
+	var owners []string
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		for _, owner := range f.Owners(p) {
+			if !seen[owner] {
+				seen[owner] = true
+				owners = append(owners, owner)
+			}
+		}
+	}
+	return owners
+}
+
+// compile turns a CODEOWNERS pattern, which follows gitignore rules, into a
+// regular expression matching the paths it covers. A pattern matches a file
+// or any file under a matching directory.
+func compile(pattern string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(pattern, "!") || strings.Contains(pattern, "[") {
+		return nil, fmt.Errorf("unsupported pattern '%s'", pattern)
+	}
+
+	// Patterns with a slash other than a trailing one are relative to the
+	// root; others match at any depth
+	trimmed := strings.TrimSuffix(pattern, "/")
+	anchored := strings.Contains(trimmed, "/")
+	trimmed = strings.TrimPrefix(trimmed, "/")
+
+	// "*" and "/" own everything
+	if trimmed == "*" || trimmed == "" {
+		return regexp.Compile("^.*$")
+	}
+
+	var sb strings.Builder
+	sb.WriteString("^")
+	if !anchored {
+		sb.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(trimmed); i++ {
+		switch c := trimmed[i]; {
+		case strings.HasPrefix(trimmed[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(trimmed[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("(?:/.*)?$")
+	return regexp.Compile(sb.String())
+}
@@ -0,0 +1,70 @@
+package codeowners
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const rules = `# Default owners
+*                   @acme/platform
+
+*.js                @acme/frontend
+/docs/              @acme/docs  # Top-level docs only
+apps/**/config.yml  @alice @bob
+build/logs/
+vendor              @acme/deps
+`
+
+func TestOwners(t *testing.T) {
+	f, err := Parse(rules)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	tests := map[string]string{
+		"README.md":                   "@acme/platform",
+		"web/app.js":                  "@acme/frontend",
+		"docs/guide.md":               "@acme/docs",
+		"src/docs/guide.md":           "@acme/platform",
+		"apps/api/prod/config.yml":    "@alice @bob",
+		"apps/config.yml":             "@alice @bob",
+		"build/logs/today.txt":        "",
+		"third_party/vendor/x/lib.go": "@acme/deps",
+		"/web/app.js":                 "@acme/frontend",
+	}
+	for p, want := range tests {
+		if got := strings.Join(f.Owners(p), " "); got != want {
+			t.Errorf("Owners(%q) = %q, want %q", p, got, want)
+		}
+	}
+
+	owners := f.OwnersOf([]string{"web/a.js", "docs/x.md", "web/b.js"})
+	if strings.Join(owners, " ") != "@acme/frontend @acme/docs" {
+		t.Errorf("Unexpected owners: %v", owners)
+	}
+
+	if _, err := Parse("!negated @x\n"); err == nil {
+		t.Error("Expected unsupported pattern to be rejected")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	if f, err := Load(dir); f != nil || err != nil {
+		t.Errorf("Expected no CODEOWNERS, got %v, %v", f, err)
+	}
+
+	os.MkdirAll(filepath.Join(dir, ".github"), 0755)
+	os.WriteFile(filepath.Join(dir, "CODEOWNERS"), []byte("* @root\n"), 0644)
+	os.WriteFile(filepath.Join(dir, ".github", "CODEOWNERS"), []byte("* @github\n"), 0644)
+
+	f, err := Load(dir)
+	if err != nil || f == nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if owners := f.Owners("main.go"); len(owners) != 1 || owners[0] != "@github" {
+		t.Errorf("Expected .github/CODEOWNERS to take precedence, got %v", owners)
+	}
+}
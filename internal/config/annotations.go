@@ -0,0 +1,196 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// annotationPattern matches a codesync directive in a line, single-line or
+// block comment, e.g. "// codesync: from=acme/utils/src/strings.go fn=TrimAll"
+var annotationPattern = regexp.MustCompile(`(?://|#|/\*|--)\s*codesync:\s*(.*?)\s*(?:\*/)?$`)
+
+// annotationLanguages maps file extensions to function sync languages
+var annotationLanguages = map[string]string{
+	".go":  "go",
+	".py":  "python",
+	".js":  "javascript",
+	".mjs": "javascript",
+	".cjs": "javascript",
+	".jsx": "javascript",
+	".ts":  "javascript",
+	".tsx": "javascript",
+}
+
+// ScanAnnotations walks the given directories for files annotated with
+// codesync directives and returns a sync item for each one. A directive
+// names the upstream file and the function to keep in sync:
+//
+//	// codesync: from=owner/repo/path/to/file.go[@branch] fn=Name
+//
+// Optional keys are name, lang, rev and tags (comma-separated). Hidden
+// directories, vendor and node_modules are skipped.
+func ScanAnnotations(dirs []string) ([]SyncItem, error) {
+	var items []SyncItem
+	seen := make(map[string]string)
+
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if d.IsDir() {
+				name := d.Name()
+				if path != dir && (strings.HasPrefix(name, ".") || name == "vendor" || name == "node_modules") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			found, err := scanFile(path)
+			if err != nil {
+				return err
+			}
+
+			for _, item := range found {
+				if other, ok := seen[item.Name]; ok {
+					return fmt.Errorf("%s: annotation name '%s' is already used in %s", path, item.Name, other)
+				}
+				seen[item.Name] = path
+				items = append(items, item)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error scanning annotations: %w", err)
+		}
+	}
+
+	return items, nil
+}
+
+// scanFile returns the sync items declared by annotations in one file
+func scanFile(path string) ([]SyncItem, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var items []SyncItem
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if !strings.Contains(line, "codesync:") {
+			continue
+		}
+
+		m := annotationPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		item, err := parseAnnotation(path, m[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNum, err)
+		}
+		items = append(items, item)
+	}
+
+	// Skip files we can't read line by line, such as minified or binary files
+	if err := scanner.Err(); err == bufio.ErrTooLong {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// parseAnnotation builds a sync item targeting path from a directive's
+// key=value pairs
+func parseAnnotation(path, directive string) (SyncItem, error) {
+	item := SyncItem{
+		Target: SyncTarget{Path: path, Type: "function", Language: annotationLanguages[filepath.Ext(path)]},
+	}
+
+	for _, field := range strings.Fields(directive) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || value == "" {
+			return SyncItem{}, fmt.Errorf("invalid annotation field '%s', expected key=value", field)
+		}
+
+		switch key {
+		case "from":
+			from, branch, _ := strings.Cut(value, "@")
+			parts := strings.SplitN(from, "/", 3)
+			if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+				return SyncItem{}, fmt.Errorf("invalid source '%s', expected owner/repo/path", value)
+			}
+			item.Source.Owner, item.Source.Repo, item.Source.Path = parts[0], parts[1], parts[2]
+			item.Source.Branch = branch
+		case "fn":
+			item.Target.Function = value
+		case "name":
+			item.Name = value
+		case "lang":
+			item.Target.Language = value
+		case "rev":
+			item.Source.Revision = value
+		case "tags":
+			item.Tags = strings.Split(value, ",")
+		default:
+			return SyncItem{}, fmt.Errorf("unknown annotation field '%s'", key)
+		}
+	}
+
+	// A whole-file sync would overwrite the annotation itself, so annotations
+	// always target a function
+	if item.Source.Owner == "" {
+		return SyncItem{}, fmt.Errorf("annotation requires from=owner/repo/path")
+	}
+	if item.Target.Function == "" {
+		return SyncItem{}, fmt.Errorf("annotation requires fn=<function name>")
+	}
+	if item.Target.Language == "" {
+		return SyncItem{}, fmt.Errorf("cannot infer language of %s, set lang=", path)
+	}
+
+	if item.Source.Branch == "" {
+		item.Source.Branch = "main"
+	}
+	if item.Name == "" {
+		item.Name = filepath.ToSlash(path) + "#" + item.Target.Function
+	}
+	item.Description = "Declared by annotation in " + filepath.ToSlash(path)
+
+	return item, nil
+}
+
+// mergeAnnotatedItems appends annotated items to the configured ones. Items
+// from the config file win when both use the same name or target the same
+// function.
+func mergeAnnotatedItems(items, annotated []SyncItem) []SyncItem {
+	names := make(map[string]bool)
+	targets := make(map[string]bool)
+	for _, item := range items {
+		names[item.Name] = true
+		targets[filepath.Clean(item.Target.Path)+"#"+item.Target.Function] = true
+	}
+
+	for _, item := range annotated {
+		if names[item.Name] || targets[filepath.Clean(item.Target.Path)+"#"+item.Target.Function] {
+			continue
+		}
+		items = append(items, item)
+	}
+
+	return items
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestScanAnnotations(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFile(t, filepath.Join(dir, "strings.go"), `package util
+
+// codesync: from=acme/utils/src/strings.go fn=TrimAll
+func TrimAll(s string) string { return s }
+`)
+	writeFile(t, filepath.Join(dir, "py", "parse.py"), `
+# codesync: from=acme/parsers/json/parse.py@develop fn=parse_json name=json-parser tags=core,parsing
+def parse_json(s):
+    pass
+`)
+	writeFile(t, filepath.Join(dir, "web", "fmt.ts"), `/* codesync: from=acme/web/src/fmt.ts fn=formatDate rev=abc123 */`)
+	writeFile(t, filepath.Join(dir, "node_modules", "dep.js"), `// codesync: from=acme/dep/index.js fn=ignored`)
+	writeFile(t, filepath.Join(dir, ".git", "hook.go"), `// codesync: from=acme/dep/hook.go fn=ignored`)
+
+	items, err := ScanAnnotations([]string{dir})
+	if err != nil {
+		t.Fatalf("ScanAnnotations failed: %v", err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("Expected 3 items, got %d: %+v", len(items), items)
+	}
+
+	byFunction := make(map[string]SyncItem)
+	for _, item := range items {
+		byFunction[item.Target.Function] = item
+	}
+
+	goItem := byFunction["TrimAll"]
+	if goItem.Source != (SyncSource{Owner: "acme", Repo: "utils", Path: "src/strings.go", Branch: "main"}) {
+		t.Errorf("Unexpected Go source: %+v", goItem.Source)
+	}
+	if goItem.Target.Type != "function" || goItem.Target.Language != "go" || goItem.Target.Path != filepath.Join(dir, "strings.go") {
+		t.Errorf("Unexpected Go target: %+v", goItem.Target)
+	}
+	if !strings.HasSuffix(goItem.Name, "strings.go#TrimAll") {
+		t.Errorf("Unexpected default name: %s", goItem.Name)
+	}
+
+	pyItem := byFunction["parse_json"]
+	if pyItem.Name != "json-parser" || pyItem.Source.Branch != "develop" || pyItem.Target.Language != "python" || len(pyItem.Tags) != 2 {
+		t.Errorf("Unexpected Python item: %+v", pyItem)
+	}
+
+	tsItem := byFunction["formatDate"]
+	if tsItem.Source.Revision != "abc123" || tsItem.Target.Language != "javascript" {
+		t.Errorf("Unexpected TypeScript item: %+v", tsItem)
+	}
+
+	for _, item := range items {
+		if err := item.Validate(); err != nil {
+			t.Errorf("Annotated item %s is invalid: %v", item.Name, err)
+		}
+	}
+}
+
+func TestScanAnnotationsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"missing function", "// codesync: from=acme/utils/a.go", "requires fn"},
+		{"missing source", "// codesync: fn=Foo", "requires from"},
+		{"bad source", "// codesync: from=acme/utils fn=Foo", "expected owner/repo/path"},
+		{"unknown key", "// codesync: from=acme/utils/a.go fn=Foo mode=fast", "unknown annotation field"},
+		{"bare word", "// codesync: from=acme/utils/a.go Foo", "expected key=value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, "a.go"), "package a\n\n"+tt.content+"\n")
+
+			_, err := ScanAnnotations([]string{dir})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+			if err != nil && !strings.Contains(err.Error(), "a.go:3") {
+				t.Errorf("Expected error to include file and line, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigMergesAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "src", "strings.go"), `package util
+
+// codesync: from=acme/utils/src/strings.go fn=TrimAll
+func TrimAll(s string) string { return s }
+
+// codesync: from=acme/utils/src/strings.go fn=PadLeft
+func PadLeft(s string) string { return s }
+`)
+
+	// The YAML item targets TrimAll too, so its annotation is ignored
+	configPath := filepath.Join(dir, "codesync.yaml")
+	writeFile(t, configPath, `
+version: "1.0"
+annotationPaths: ["`+filepath.Join(dir, "src")+`"]
+items:
+  - name: "trim"
+    source:
+      owner: "acme"
+      repo: "utils"
+      path: "src/strings.go"
+    target:
+      path: "`+filepath.Join(dir, "src", "strings.go")+`"
+      type: "function"
+      language: "go"
+      function: "TrimAll"
+`)
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if len(cfg.Items) != 2 || cfg.Items[0].Name != "trim" || cfg.Items[1].Target.Function != "PadLeft" {
+		t.Errorf("Unexpected merged items: %+v", cfg.Items)
+	}
+}
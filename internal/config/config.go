@@ -1,48 +1,472 @@
 package config
 
 import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
+	"io/fs"
+	"net/mail"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/exitflynn/codesync/internal/merge"
+	"github.com/exitflynn/codesync/internal/structured"
+	"github.com/exitflynn/codesync/internal/version"
+	"github.com/exitflynn/codesync/internal/workflow"
 	"gopkg.in/yaml.v3"
 )
 
 // SyncSource represents a source location for synced code
 type SyncSource struct {
-	Owner    string `yaml:"owner"`    // GitHub owner
-	Repo     string `yaml:"repo"`     // GitHub repository name
-	Path     string `yaml:"path"`     // Path to file or directory in repository
-	Branch   string `yaml:"branch"`   // Branch to track (default: main)
-	Revision string `yaml:"revision"` // Optional specific revision to pin to
+	Provider string `yaml:"provider,omitempty"` // Code host: "github" (default), "gitlab", "bitbucket", "gitea", "gist", "git" or "local"
+	Owner    string `yaml:"owner"`              // Repository owner, GitLab group path or Bitbucket workspace
+	Repo     string `yaml:"repo"`               // Repository name, or gist ID
+	URL      string `yaml:"url,omitempty"`      // Clone URL of a git source, instead of owner and repo
+	Path     string `yaml:"path"`               // Path to file or directory in repository, file name in a gist, or path on disk for local sources
+	Branch   string `yaml:"branch"`             // Branch to track (default: main)
+	Revision string `yaml:"revision,omitempty"` // Optional specific revision to pin to
+	Tag      string `yaml:"tag,omitempty"`      // Tag to sync from instead of the branch head
+	Release  string `yaml:"release,omitempty"`  // Follow the latest release matching a semver range like "^1.2", or "latest", instead of the branch head
+	Update   string `yaml:"update,omitempty"`   // Releases after tag to move to: "pin", "patch", "minor" or "latest"; newer ones are only reported
+	Archive  bool   `yaml:"archive,omitempty"`  // Fetch a directory from one download of the repository tarball rather than file by file
+
+	GitHubBaseURL   string `yaml:"githubBaseURL,omitempty"`   // GitHub Enterprise Server instance of this source (default: the global one)
+	GitHubUploadURL string `yaml:"githubUploadURL,omitempty"` // Upload endpoint of the instance (default: githubBaseURL)
+}
+
+// Supported source providers
+const (
+	ProviderGitHub    = "github"
+	ProviderGitLab    = "gitlab"
+	ProviderBitbucket = "bitbucket"
+	ProviderGitea     = "gitea" // Also Forgejo
+	ProviderGist      = "gist"  // GitHub gists, by ID
+	ProviderGit       = "git"   // Any git remote, cloned locally
+	ProviderLocal     = "local" // Another checkout on disk
+)
+
+// Update policies of sources with a tag: which later releases they move to
+const (
+	UpdatePin    = "pin"    // Stay at the tag
+	UpdatePatch  = "patch"  // Patch releases of the tag's minor version
+	UpdateMinor  = "minor"  // Minor and patch releases of the tag's major version
+	UpdateLatest = "latest" // Every release
+)
+
+// BuiltinProvider reports whether a provider name is one of codesync's own,
+// rather than a provider plugin
+func BuiltinProvider(name string) bool {
+	switch name {
+	case ProviderGitHub, ProviderGitLab, ProviderBitbucket, ProviderGitea, ProviderGist, ProviderGit, ProviderLocal:
+		return true
+	}
+	return false
+}
+
+// ProviderName returns the source's code host, defaulting to GitHub
+func (s SyncSource) ProviderName() string {
+	if s.Provider == "" {
+		return ProviderGitHub
+	}
+	return s.Provider
+}
+
+// Ref returns the ref the source is read at: its tag if it has one, else its
+// branch. Sources following releases get the tag of the release to sync when
+// they are synced.
+func (s SyncSource) Ref() string {
+	if s.Tag != "" {
+		return s.Tag
+	}
+	return s.Branch
 }
 
 // SyncTarget represents a destination location for synced code
 type SyncTarget struct {
 	Path      string `yaml:"path"`                // Local path to sync the code to
-	Type      string `yaml:"type"`                // "file", "directory", or "function"
+	Type      string `yaml:"type"`                // "file", "directory", "function", "openapi", "markdown", "asset", "region" or "workflow"
 	Language  string `yaml:"language,omitempty"`  // Language for function-level sync (python, go, etc.)
 	Function  string `yaml:"function,omitempty"`  // Function name for function-level sync
 	Transform string `yaml:"transform,omitempty"` // Optional transformation script path
+	Mode      string `yaml:"mode,omitempty"`      // Permissions of the target file in octal, e.g. "0755" (default: kept, 0644 for a new file)
+
+	TransformPlugin string `yaml:"transformPlugin,omitempty"` // Optional transform plugin applied to upstream content
+
+	Relocate    string   `yaml:"relocate,omitempty"`    // When a function moved: "suggest" (default), "auto" or "off"
+	SearchPaths []string `yaml:"searchPaths,omitempty"` // Globs searched for a moved function (default: the workspace)
+	Bootstrap   bool     `yaml:"bootstrap,omitempty"`   // Create a missing function target with a minimal file holding the function
+
+	MergeDriver string `yaml:"mergeDriver,omitempty"` // Driver merging local and upstream changes to a file (see MergeDriverRule)
+
+	JSONPath Selectors `yaml:"jsonPath,omitempty"` // Sync only these keys of a JSON file
+	YAMLPath Selectors `yaml:"yamlPath,omitempty"` // Sync only these keys of a YAML file
+
+	OnBreaking string `yaml:"onBreaking,omitempty"` // Breaking .proto changes: "warn" (default), "fail" or "allow"
+
+	Bundle bool `yaml:"bundle,omitempty"` // Inline external $refs of an OpenAPI spec
+
+	Migrations bool `yaml:"migrations,omitempty"` // Treat a directory as database migrations: only add new ones
+
+	Terraform *TerraformConfig `yaml:"terraform,omitempty"` // Vendor a Terraform module into a directory
+
+	Rename []PathRule `yaml:"rename,omitempty"` // Where upstream files of a directory go locally, if not where upstream has them
+
+	Section      string `yaml:"section,omitempty"`      // Upstream markdown heading or anchor to sync
+	LocalSection string `yaml:"localSection,omitempty"` // Local heading to replace (default: section)
+	RewriteLinks string `yaml:"rewriteLinks,omitempty"` // Relative links in a section: "keep" (default), "absolute" or "prefix"
+	LinkPrefix   string `yaml:"linkPrefix,omitempty"`   // Prefix for relative links with rewriteLinks: prefix
+
+	Process []string `yaml:"process,omitempty"` // Commands run over a fetched asset, which is at $ASSET
+
+	Marker     string `yaml:"marker,omitempty"`     // Name of the codesync-begin/codesync-end region a region target syncs
+	PinDigests string `yaml:"pinDigests,omitempty"` // Unpinned base images in a Dockerfile region: "warn" (default), "fail" or "off"
+
+	Keep Selectors `yaml:"keep,omitempty"` // Workflow keys whose local values win (default: on and env)
+
+	Rings           []RingConfig `yaml:"rings,omitempty"`           // Stages a fan-out region target rolls new upstream versions out in
+	RingCheck       string       `yaml:"ringCheck,omitempty"`       // Command that must succeed after a ring gets a version, or the rollout halts
+	RevertOnFailure bool         `yaml:"revertOnFailure,omitempty"` // Restore the files a halted rollout updated
+}
+
+// RingConfig is a stage of a rollout. A ring gets a new upstream version once
+// the ring before it has had it for soak, or once it is approved.
+type RingConfig struct {
+	Name     string   `yaml:"name"`
+	Paths    []string `yaml:"paths,omitempty"`    // Globs of the fan-out files in the ring (default: the files of no other ring)
+	Soak     string   `yaml:"soak,omitempty"`     // How long the previous ring runs a version before this one gets it
+	Approval bool     `yaml:"approval,omitempty"` // Wait for codesync rollout approve, even after soak
+}
+
+// TerraformConfig vendors a Terraform module, pinned by source.revision, into
+// a directory target
+type TerraformConfig struct {
+	Rewrite []string `yaml:"rewrite,omitempty"` // Globs of .tf files whose module sources are pointed at the vendored copy
+	Sources []string `yaml:"sources,omitempty"` // Other addresses of the module to rewrite, such as registry addresses
+}
+
+// Selectors is a list of document paths, written as a single string or a list
+type Selectors []string
+
+// UnmarshalYAML accepts a single selector as well as a list
+func (s *Selectors) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*s = Selectors{value.Value}
+		return nil
+	}
+
+	var list []string
+	if err := value.Decode(&list); err != nil {
+		return err
+	}
+	*s = list
+	return nil
+}
+
+// PathRule maps upstream files of a directory target to local paths, as
+// "from -> to". Both sides are relative to the directories. The sides are
+// exact paths, or prefixes ending in "/", one of which may be empty to strip
+// or add a prefix, or from is a regular expression between slashes whose
+// groups to can use as $1.
+type PathRule string
+
+// Split returns the two sides of a rule
+func (r PathRule) Split() (from, to string, ok bool) {
+	from, to, ok = strings.Cut(string(r), "->")
+	return strings.TrimSpace(from), strings.TrimSpace(to), ok
+}
+
+// Pattern returns the regular expression of a rule, or nil if it has none
+func (r PathRule) Pattern() (*regexp.Regexp, error) {
+	from, _, _ := r.Split()
+	if len(from) < 2 || !strings.HasPrefix(from, "/") || !strings.HasSuffix(from, "/") {
+		return nil, nil
+	}
+	return regexp.Compile(from[1 : len(from)-1])
+}
+
+// validate checks the syntax of a rule
+func (r PathRule) validate() error {
+	from, to, ok := r.Split()
+	if !ok || from == "" && to == "" {
+		return fmt.Errorf("rename rule '%s' must be 'from -> to'", r)
+	}
+	if re, err := r.Pattern(); err != nil || re != nil {
+		if err != nil {
+			return fmt.Errorf("rename rule '%s': %w", r, err)
+		}
+		if to == "" {
+			return fmt.Errorf("rename rule '%s' needs a path to rename to", r)
+		}
+		return nil
+	}
+	if (from == "" || to == "") && !strings.HasSuffix(from+to, "/") {
+		return fmt.Errorf("rename rule '%s' can only strip or add a prefix ending in /", r)
+	}
+	if from != "" && to != "" && strings.HasSuffix(from, "/") != strings.HasSuffix(to, "/") {
+		return fmt.Errorf("rename rule '%s' must map a prefix to a prefix", r)
+	}
+	return nil
+}
+
+// FileMode returns the permissions set by mode, or 0 if the target file's
+// are kept
+func (t *SyncTarget) FileMode() (fs.FileMode, error) {
+	if t.Mode == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(t.Mode, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return 0, fmt.Errorf("invalid mode '%s': want octal permissions like 0644", t.Mode)
+	}
+	return fs.FileMode(mode), nil
+}
+
+// Structured reports whether only selected keys of the target file are synced
+func (t *SyncTarget) Structured() bool {
+	return len(t.JSONPath) > 0 || len(t.YAMLPath) > 0
 }
 
 // SyncItem represents a single sync operation
 type SyncItem struct {
-	Name        string     `yaml:"name"`        // Human-readable name for this sync
-	Description string     `yaml:"description"` // Optional description
-	Source      SyncSource `yaml:"source"`      // Where to sync from
-	Target      SyncTarget `yaml:"target"`      // Where to sync to
-	Disabled    bool       `yaml:"disabled"`    // Whether this sync is currently disabled
+	Name        string     `yaml:"name"`                  // Human-readable name for this sync
+	Description string     `yaml:"description,omitempty"` // Optional description
+	Source      SyncSource `yaml:"source"`                // Where to sync from
+	Target      SyncTarget `yaml:"target"`                // Where to sync to
+	Disabled    bool       `yaml:"disabled,omitempty"`    // Whether this sync is currently disabled
+	Tags        []string   `yaml:"tags,omitempty"`        // Labels used to route notifications
+	Priority    string     `yaml:"priority,omitempty"`    // Polling class under the daemon's scheduler: "critical", "normal" (default) or "low"
+
+	Owner    string   `yaml:"owner,omitempty"`    // Team responsible for the item
+	Contacts []string `yaml:"contacts,omitempty"` // Who to ping when the item needs a human: Slack handles or channels, or email addresses
+
+	Generate *GenerateConfig `yaml:"generate,omitempty"` // Code generated from the synced target
+
+	Changelog bool `yaml:"changelog,omitempty"` // Record applied syncs in CHANGES.codesync.md next to the target
+
+	OnConflict string `yaml:"onConflict,omitempty"` // When both local and upstream changed: "merge" (default), "ours", "theirs" or "fail"
+
+	Branches []BranchTarget `yaml:"branches,omitempty"` // Track several upstream branches, each into its own target
+}
+
+// BranchTarget pairs an upstream branch with the local path it is synced to.
+// An item with branches is split into one item per branch, named
+// "<name>@<branch>", each with its own state. Targets are paths only; local
+// branches aren't checked out or committed to.
+type BranchTarget struct {
+	Source string `yaml:"source"` // Upstream branch
+	Path   string `yaml:"path"`   // Local target path for this branch, e.g. in a worktree of the matching local branch
+}
+
+// ID returns a stable identifier for the item, derived from its name and
+// source, so that machine-readable output can be compared across runs
+func (item SyncItem) ID() string {
+	s := item.Source
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		item.Name, s.ProviderName(), s.Owner, s.Repo, s.URL, s.Path, s.Branch,
+	}, "\x00")))
+	return hex.EncodeToString(sum[:6])
+}
+
+// GenerateConfig describes code generated from a sync target, whose freshness
+// is checked on every sync
+type GenerateConfig struct {
+	Command string   `yaml:"command"`       // Shell command that regenerates the outputs
+	Outputs []string `yaml:"outputs"`       // Generated files, directories or globs
+	Dir     string   `yaml:"dir,omitempty"` // Working directory for the command and outputs
+}
+
+// SecretRef points at a credential held by a secrets provider
+type SecretRef struct {
+	Provider string `yaml:"provider"`          // "env", "file", "vault", "aws", "gcp" or "keychain"
+	Name     string `yaml:"name"`              // Variable name, file path, or secret name/path
+	Key      string `yaml:"key,omitempty"`     // Optional field to pick from a JSON secret
+	Address  string `yaml:"address,omitempty"` // Provider endpoint (e.g. Vault address)
+}
+
+// StateEncryption configures encryption of state files at rest. The key must
+// be base64-encoded and 16, 24 or 32 bytes long (AES-128/192/256).
+type StateEncryption struct {
+	KeyEnv     string     `yaml:"keyEnv,omitempty"`     // Environment variable holding the key
+	KeyCommand string     `yaml:"keyCommand,omitempty"` // Command that prints the key (e.g. a KMS plugin)
+	KeySecret  *SecretRef `yaml:"keySecret,omitempty"`  // Secrets provider holding the key
+}
+
+// BundleConfig configures the keys of air-gapped bundles, which are signed
+// with an Ed25519 private key and only applied if they verify against the
+// public key
+type BundleConfig struct {
+	PublicKey     string `yaml:"publicKey"`               // Base64 Ed25519 public key bundles are verified with
+	PrivateKeyEnv string `yaml:"privateKeyEnv,omitempty"` // Environment variable holding the base64 private key (default: CODESYNC_BUNDLE_KEY)
+}
+
+// PolicyConfig configures Rego policies evaluated with the opa CLI before an
+// upstream change is applied. The query yields the violations, as messages;
+// any violation blocks the change.
+type PolicyConfig struct {
+	Paths []string `yaml:"paths"`           // Rego files or directories of them
+	Query string   `yaml:"query,omitempty"` // Query yielding the violations (default: data.codesync.deny)
+	OPA   string   `yaml:"opa,omitempty"`   // opa binary (default: opa on the PATH)
+}
+
+// NotifierConfig describes a destination for sync notifications
+type NotifierConfig struct {
+	Name   string `yaml:"name"`             // Identifier used in logs
+	Type   string `yaml:"type"`             // "slack", "webhook", "pagerduty", "opsgenie" or "plugin"
+	URL    string `yaml:"url"`              // Webhook URL, or API endpoint override for alerting services
+	Key    string `yaml:"key,omitempty"`    // PagerDuty routing key or Opsgenie API key
+	Plugin string `yaml:"plugin,omitempty"` // Notifier plugin of the plugin type
+
+	// How much of the changed content events carry: "files" (default) names
+	// the files, "stats" adds line counts and "full" adds the diffs
+	Content string `yaml:"content,omitempty"`
+}
+
+// DigestConfig batches routine notifications into scheduled summaries
+type DigestConfig struct {
+	Times []string `yaml:"times"` // Local times of day to send digests ("HH:MM")
+}
+
+// RouteConfig sends matching events to a set of notifiers. Empty match fields
+// match every event.
+type RouteConfig struct {
+	MinSeverity string   `yaml:"minSeverity,omitempty"` // "info", "warning" or "error"
+	Events      []string `yaml:"events,omitempty"`      // Event types ("updated", "conflict", "error", "recovered")
+	Tags        []string `yaml:"tags,omitempty"`        // Item tags, any of which must be present
+	Notifiers   []string `yaml:"notifiers"`             // Names of the notifiers to use
+	Continue    bool     `yaml:"continue,omitempty"`    // Keep evaluating later routes after a match
+}
+
+// NotificationsConfig configures where and how sync events are reported
+type NotificationsConfig struct {
+	Notifiers []NotifierConfig `yaml:"notifiers"`        // Notification destinations
+	Routes    []RouteConfig    `yaml:"routes,omitempty"` // Routing rules; without any, all notifiers get every event
+	Digest    *DigestConfig    `yaml:"digest,omitempty"` // Optional digest scheduling
+}
+
+// LimitsConfig bounds codesync's use of the network and the GitHub API, e.g.
+// on shared CI runners. Zero values mean no limit.
+type LimitsConfig struct {
+	MaxConcurrentDownloads int   `yaml:"maxConcurrentDownloads,omitempty"` // Requests in flight at once
+	MaxBytesPerSecond      int64 `yaml:"maxBytesPerSecond,omitempty"`      // Download bandwidth across all requests
+	MaxAPICalls            int   `yaml:"maxAPICalls,omitempty"`            // API requests per run; later items are deferred
+
+	MaxRateLimitWait string `yaml:"maxRateLimitWait,omitempty"` // Longest wait for a GitHub rate limit to reset, e.g. 10m (default 5m)
+}
+
+// Priority classes of items under the scheduler
+const (
+	PriorityCritical = "critical"
+	PriorityNormal   = "normal"
+	PriorityLow      = "low"
+)
+
+// Conflict strategies of items, for when both local and upstream changed
+const (
+	ConflictMerge  = "merge"  // Merge the two, for file targets; other targets fail
+	ConflictOurs   = "ours"   // Keep the local changes and skip upstream's
+	ConflictTheirs = "theirs" // Back up the local changes and take upstream's
+	ConflictFail   = "fail"   // Leave the conflict for manual resolution
+)
+
+// SchedulerConfig makes the daemon poll each item on its own schedule rather
+// than syncing every item at once on syncInterval
+type SchedulerConfig struct {
+	Intervals         map[string]string `yaml:"intervals,omitempty"`         // Poll interval per priority class, e.g. critical: 5m
+	Jitter            string            `yaml:"jitter,omitempty"`            // Longest random delay added to each poll, e.g. 2m
+	MaxPollsPerMinute int               `yaml:"maxPollsPerMinute,omitempty"` // Items polled per minute at most; the rest wait, most urgent first
+	Adaptive          bool              `yaml:"adaptive,omitempty"`          // Learn each item's poll interval from how often its upstream changes
+}
+
+// PluginConfig declares an external binary that adds a source provider,
+// transform or notifier
+type PluginConfig struct {
+	Name string   `yaml:"name"`           // Provider name, or the name transforms and notifiers refer to
+	Kind string   `yaml:"kind"`           // "provider", "transform" or "notifier"
+	Path string   `yaml:"path,omitempty"` // Binary to run (default: codesync-plugin-<name> in pluginDir)
+	Args []string `yaml:"args,omitempty"` // Arguments passed to the binary
+}
+
+// Plugin kinds
+const (
+	PluginProvider  = "provider"
+	PluginTransform = "transform"
+	PluginNotifier  = "notifier"
+)
+
+// TelemetryConfig opts in to reporting anonymous usage counts after each run
+type TelemetryConfig struct {
+	Enabled  bool   `yaml:"enabled"`  // Off unless set
+	Endpoint string `yaml:"endpoint"` // URL the counts are posted to
+}
+
+// MergeDriverRule selects the merge driver for file targets matching a glob.
+// Patterns without a slash match the file's base name.
+type MergeDriverRule struct {
+	Path   string `yaml:"path"`   // Glob matched against the target path
+	Driver string `yaml:"driver"` // "json-merge", "yaml-merge", "union", "ours" or "theirs"
 }
 
 // Config is the main configuration structure
 type Config struct {
-	Version      string     `yaml:"version"`      // Config schema version
-	ProjectName  string     `yaml:"projectName"`  // Name of this project
-	GitHubToken  string     `yaml:"githubToken"`  // GitHub API token (or use env var)
-	SyncInterval string     `yaml:"syncInterval"` // How often to check for updates (cron format)
-	Items        []SyncItem `yaml:"items"`        // List of things to sync
-	NotifyOnly   bool       `yaml:"notifyOnly"`   // If true, don't auto-generate PRs
+	Version       string     `yaml:"version"`       // Config schema version
+	ProjectName   string     `yaml:"projectName"`   // Name of this project
+	GitHubToken   string     `yaml:"githubToken"`   // GitHub API token (or use env var)
+	GitLabToken   string     `yaml:"gitlabToken"`   // GitLab API token for gitlab sources (or use GITLAB_TOKEN)
+	GitLabURL     string     `yaml:"gitlabURL"`     // GitLab instance for gitlab sources (default: https://gitlab.com)
+	SyncInterval  string     `yaml:"syncInterval"`  // How often to check for updates (cron format)
+	Items         []SyncItem `yaml:"items"`         // List of things to sync
+	NotifyOnly    bool       `yaml:"notifyOnly"`    // If true, don't auto-generate PRs
+	CompressState bool       `yaml:"compressState"` // Store state and snapshots zstd-compressed
+	BlameDiffs    bool       `yaml:"blameDiffs"`    // Attribute added lines in diffs to upstream authors
+	AuditRuns     bool       `yaml:"auditRuns"`     // Record what each sync run fetched and wrote, for codesync replay
+
+	RequiredVersion string `yaml:"requiredVersion,omitempty"` // Versions of codesync that may run this config, e.g. ">= 1.4"
+
+	StateEncryption   *StateEncryption `yaml:"stateEncryption,omitempty"`   // Optional encryption of state at rest
+	GitHubTokenSecret *SecretRef       `yaml:"githubTokenSecret,omitempty"` // Fetch the GitHub token from a secrets provider
+
+	GitHubBaseURL   string `yaml:"githubBaseURL,omitempty"`   // GitHub Enterprise Server instance for github sources (default: github.com)
+	GitHubUploadURL string `yaml:"githubUploadURL,omitempty"` // Upload endpoint of the instance (default: githubBaseURL)
+
+	BitbucketUsername    string `yaml:"bitbucketUsername,omitempty"`    // Bitbucket user for bitbucket sources (or use BITBUCKET_USERNAME)
+	BitbucketAppPassword string `yaml:"bitbucketAppPassword,omitempty"` // App password of the Bitbucket user (or use BITBUCKET_APP_PASSWORD)
+
+	GiteaURL   string `yaml:"giteaURL,omitempty"`   // Gitea or Forgejo instance for gitea sources
+	GiteaToken string `yaml:"giteaToken,omitempty"` // Gitea API token for gitea sources (or use GITEA_TOKEN)
+
+	GitLabTokenSecret          *SecretRef `yaml:"gitlabTokenSecret,omitempty"`          // Fetch the GitLab token from a secrets provider
+	BitbucketAppPasswordSecret *SecretRef `yaml:"bitbucketAppPasswordSecret,omitempty"` // Fetch the Bitbucket app password from a secrets provider
+	GiteaTokenSecret           *SecretRef `yaml:"giteaTokenSecret,omitempty"`           // Fetch the Gitea token from a secrets provider
+
+	Notifications *NotificationsConfig `yaml:"notifications,omitempty"` // Optional notification settings
+
+	AnnotationPaths []string `yaml:"annotationPaths,omitempty"` // Directories scanned for codesync: annotations
+
+	MergeDrivers []MergeDriverRule `yaml:"mergeDrivers,omitempty"` // Merge drivers by path; the first match wins
+
+	Redact []string `yaml:"redact,omitempty"` // Extra regular expressions masked in logs, reports and notifications
+
+	Limits *LimitsConfig `yaml:"limits,omitempty"` // Optional bounds on network and API usage
+
+	Concurrency int `yaml:"concurrency,omitempty"` // Items synced at once (default: 1)
+
+	Scheduler *SchedulerConfig `yaml:"scheduler,omitempty"` // Optional per-item polling for the daemon
+
+	Telemetry *TelemetryConfig `yaml:"telemetry,omitempty"` // Optional anonymous usage reporting
+
+	Bundles *BundleConfig `yaml:"bundles,omitempty"` // Signing keys of air-gapped bundles
+
+	Policies *PolicyConfig `yaml:"policies,omitempty"` // Rego policies upstream changes must pass before they're applied
+
+	PluginDir string         `yaml:"pluginDir,omitempty"` // Where plugin binaries are looked up (default: .codesync/plugins)
+	Plugins   []PluginConfig `yaml:"plugins,omitempty"`   // External providers, transforms and notifiers
 }
 
 // LoadConfig loads the configuration from a YAML file
@@ -59,30 +483,278 @@ func LoadConfig(path string) (*Config, error) {
 	}
 
 	// Parse YAML
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing config file: %w", err)
+	}
+
+	// Substitute ${VAR} references so mounted configs can take values from the
+	// environment. Values are substituted after parsing, so they can't add
+	// keys to the config.
+	if err := expandEnvNode(&doc); err != nil {
+		return nil, err
+	}
+
 	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	if err := doc.Decode(&config); err != nil {
 		return nil, fmt.Errorf("error parsing config file: %w", err)
 	}
 
+	// Refuse configs written for a newer codesync before anything in them is
+	// misread
+	if err := version.Check(config.RequiredVersion); err != nil {
+		return nil, err
+	}
+
 	// Use environment variable for GitHub token if not in config
 	if config.GitHubToken == "" {
-		config.GitHubToken = os.Getenv("GITHUB_TOKEN")
+		config.GitHubToken = EnvToken()
+	}
+	if config.GitLabToken == "" {
+		config.GitLabToken = os.Getenv("GITLAB_TOKEN")
+	}
+	if config.BitbucketUsername == "" {
+		config.BitbucketUsername = os.Getenv("BITBUCKET_USERNAME")
+	}
+	if config.BitbucketAppPassword == "" {
+		config.BitbucketAppPassword = os.Getenv("BITBUCKET_APP_PASSWORD")
+	}
+	if config.GiteaToken == "" {
+		config.GiteaToken = os.Getenv("GITEA_TOKEN")
 	}
 
+	// Add items declared by annotations in source files
+	if len(config.AnnotationPaths) > 0 {
+		annotated, err := ScanAnnotations(config.AnnotationPaths)
+		if err != nil {
+			return nil, err
+		}
+		config.Items = mergeAnnotatedItems(config.Items, annotated)
+	}
+
+	items, err := ExpandBranches(config.Items)
+	if err != nil {
+		return nil, err
+	}
+	config.Items = items
+
 	// Set default values
 	for i := range config.Items {
-		if config.Items[i].Source.Branch == "" {
+		// Gists have no branches, only revisions
+		if config.Items[i].Source.Branch == "" && config.Items[i].Source.ProviderName() != ProviderGist {
 			config.Items[i].Source.Branch = "main"
 		}
+		if config.Items[i].Target.Type == "workflow" {
+			config.Items[i].Target.Path = workflowPath(config.Items[i])
+		}
 	}
 
 	return &config, nil
 }
 
+// ExpandBranches replaces each item tracking several branches with one item
+// per branch, so every branch is synced and has its state independently
+func ExpandBranches(items []SyncItem) ([]SyncItem, error) {
+	var result []SyncItem
+	for _, item := range items {
+		if len(item.Branches) == 0 {
+			result = append(result, item)
+			continue
+		}
+		if item.Source.Tag != "" || item.Source.Release != "" {
+			return nil, fmt.Errorf("item %s: branches can't be combined with a source tag or release", item.Name)
+		}
+
+		seen := make(map[string]bool)
+		for i, branch := range item.Branches {
+			if branch.Source == "" || branch.Path == "" {
+				return nil, fmt.Errorf("item %s: branch %d needs a source branch and a target path", item.Name, i)
+			}
+			if seen[branch.Source] {
+				return nil, fmt.Errorf("item %s: branch %s is listed twice", item.Name, branch.Source)
+			}
+			seen[branch.Source] = true
+
+			expanded := item
+			expanded.Name = item.Name + "@" + branch.Source
+			expanded.Source.Branch = branch.Source
+			expanded.Target.Path = branch.Path
+			expanded.Branches = nil
+			result = append(result, expanded)
+		}
+	}
+	return result, nil
+}
+
+// workflowPath returns where a workflow item is written: its target path,
+// or a file named after the source in .github/workflows when the target path
+// is empty or a directory
+func workflowPath(item SyncItem) string {
+	p := item.Target.Path
+	if p == "" {
+		p = workflow.Dir
+	}
+	if ext := filepath.Ext(p); ext != ".yml" && ext != ".yaml" {
+		p = filepath.Join(p, filepath.Base(item.Source.Path))
+	}
+	return p
+}
+
+// envRefPattern matches ${VAR} and ${VAR:-default}
+var envRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// tokenEnvVars are the environment variables a GitHub token is read from, in
+// order: the one GitHub Actions provides and the one the gh CLI uses, which
+// other CI systems commonly set
+var tokenEnvVars = []string{"GITHUB_TOKEN", "GH_TOKEN"}
+
+// EnvToken returns the GitHub token from the environment, if any
+func EnvToken() string {
+	for _, name := range tokenEnvVars {
+		if token := os.Getenv(name); token != "" {
+			return token
+		}
+	}
+	return ""
+}
+
+// expandEnvNode expands environment variable references in every scalar
+// value of a parsed document. Expanded values lose their tag, so an unquoted
+// ${VAR} can still set a number or boolean.
+func expandEnvNode(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		value, err := expandEnv(n.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		if value != n.Value {
+			n.Value, n.Tag = value, ""
+		}
+		return nil
+	}
+
+	for i, child := range n.Content {
+		// Keys are never expanded
+		if n.Kind == yaml.MappingNode && i%2 == 0 {
+			continue
+		}
+		if err := expandEnvNode(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expandEnv replaces ${VAR} with the value of the environment variable VAR.
+// ${VAR:-default} uses default when VAR is unset or empty. Referencing an
+// unset variable without a default is an error. Other uses of $ are left
+// alone.
+func expandEnv(s string) (string, error) {
+	var missing []string
+	expanded := envRefPattern.ReplaceAllStringFunc(s, func(ref string) string {
+		m := envRefPattern.FindStringSubmatch(ref)
+		value, ok := os.LookupEnv(m[1])
+		if value != "" {
+			return value
+		}
+		if m[2] != "" {
+			return m[3]
+		}
+		if !ok {
+			missing = append(missing, m[1])
+		}
+		return ""
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set and has no default", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// validatePlugins checks the declared plugins, and that notifiers of the
+// plugin type name one
+func (c *Config) validatePlugins() error {
+	names := make(map[string]bool)
+	for i, p := range c.Plugins {
+		if p.Name == "" {
+			return fmt.Errorf("plugin %d: name is required", i)
+		}
+		if names[p.Name] {
+			return fmt.Errorf("plugin %d: duplicate name '%s'", i, p.Name)
+		}
+		names[p.Name] = true
+
+		switch p.Kind {
+		case PluginProvider:
+			if BuiltinProvider(p.Name) {
+				return fmt.Errorf("plugin %d: '%s' is a built-in provider", i, p.Name)
+			}
+		case PluginTransform, PluginNotifier:
+		default:
+			return fmt.Errorf("plugin %d (%s): invalid kind '%s'", i, p.Name, p.Kind)
+		}
+	}
+
+	if c.Notifications != nil {
+		for i, notifier := range c.Notifications.Notifiers {
+			if notifier.Type == "plugin" && !hasPlugin(c.Plugins, notifier.Plugin, PluginNotifier) {
+				return fmt.Errorf("notifier %d (%s): unknown notifier plugin '%s'", i, notifier.Name, notifier.Plugin)
+			}
+		}
+	}
+	return nil
+}
+
+// hasPlugin reports whether a plugin of a kind is declared
+func hasPlugin(plugins []PluginConfig, name, kind string) bool {
+	for _, p := range plugins {
+		if p.Name == name && p.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// validateGitHubURLs checks that GitHub Enterprise URLs, if set, are
+// absolute
+func validateGitHubURLs(baseURL, uploadURL string) error {
+	for name, value := range map[string]string{"githubBaseURL": baseURL, "githubUploadURL": uploadURL} {
+		if value == "" {
+			continue
+		}
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid %s '%s'", name, value)
+		}
+	}
+	if uploadURL != "" && baseURL == "" {
+		return fmt.Errorf("githubUploadURL requires githubBaseURL")
+	}
+	return nil
+}
+
+// GitHubHost returns the host of the GitHub instance items are synced from:
+// github.com, or the Enterprise Server host of githubBaseURL. Tokens stored by
+// codesync login are keyed by it.
+func (c *Config) GitHubHost() string {
+	if u, err := url.Parse(c.GitHubBaseURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return "github.com"
+}
+
+// GitHubWebURL returns the web root of the GitHub instance, where OAuth apps
+// authorize
+func (c *Config) GitHubWebURL() string {
+	if u, err := url.Parse(c.GitHubBaseURL); err == nil && u.Host != "" {
+		return u.Scheme + "://" + u.Host
+	}
+	return "https://github.com"
+}
+
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
-	if c.Version == "" {
-		return fmt.Errorf("config version is required")
+	if err := c.ValidateSettings(); err != nil {
+		return err
 	}
 
 	if len(c.Items) == 0 {
@@ -90,29 +762,562 @@ func (c *Config) Validate() error {
 	}
 
 	for i, item := range c.Items {
-		// Skip disabled items
-		if item.Disabled {
-			continue
+		if err := item.validate(c.Plugins); err != nil {
+			return fmt.Errorf("item %d (%s): %w", i, item.Name, err)
+		}
+		if t := item.Target.TransformPlugin; !item.Disabled && t != "" && !hasPlugin(c.Plugins, t, PluginTransform) {
+			return fmt.Errorf("item %d (%s): unknown transform plugin '%s'", i, item.Name, t)
+		}
+		// Unlike the other hosts, Gitea has no public instance to default to
+		if !item.Disabled && item.Source.ProviderName() == ProviderGitea && c.GiteaURL == "" {
+			return fmt.Errorf("item %d (%s): gitea sources require giteaURL", i, item.Name)
+		}
+	}
+
+	return nil
+}
+
+// ValidateSettings checks everything except the sync items, for when items
+// are defined elsewhere
+func (c *Config) ValidateSettings() error {
+	if c.Version == "" {
+		return fmt.Errorf("config version is required")
+	}
+
+	if enc := c.StateEncryption; enc != nil {
+		if enc.KeyEnv == "" && enc.KeyCommand == "" && enc.KeySecret == nil {
+			return fmt.Errorf("state encryption requires keyEnv, keyCommand or keySecret")
+		}
+		if enc.KeySecret != nil {
+			if err := enc.KeySecret.Validate(); err != nil {
+				return fmt.Errorf("state encryption key: %w", err)
+			}
+		}
+	}
+
+	for _, secret := range []struct {
+		field string
+		ref   *SecretRef
+	}{
+		{"githubTokenSecret", c.GitHubTokenSecret},
+		{"gitlabTokenSecret", c.GitLabTokenSecret},
+		{"bitbucketAppPasswordSecret", c.BitbucketAppPasswordSecret},
+		{"giteaTokenSecret", c.GiteaTokenSecret},
+	} {
+		if secret.ref != nil {
+			if err := secret.ref.Validate(); err != nil {
+				return fmt.Errorf("%s: %w", secret.field, err)
+			}
+		}
+	}
+
+	if err := validateGitHubURLs(c.GitHubBaseURL, c.GitHubUploadURL); err != nil {
+		return err
+	}
+
+	if c.Notifications != nil {
+		if err := c.Notifications.Validate(); err != nil {
+			return fmt.Errorf("notifications: %w", err)
+		}
+	}
+
+	for i, rule := range c.MergeDrivers {
+		if _, err := filepath.Match(rule.Path, ""); err != nil || rule.Path == "" {
+			return fmt.Errorf("merge driver %d: invalid path '%s'", i, rule.Path)
+		}
+		if _, err := merge.Get(rule.Driver); err != nil {
+			return fmt.Errorf("merge driver %d: %w", i, err)
+		}
+	}
+
+	if c.Concurrency < 0 {
+		return fmt.Errorf("concurrency must not be negative")
+	}
+	if l := c.Limits; l != nil && (l.MaxConcurrentDownloads < 0 || l.MaxBytesPerSecond < 0 || l.MaxAPICalls < 0) {
+		return fmt.Errorf("limits must not be negative")
+	}
+	if l := c.Limits; l != nil && l.MaxRateLimitWait != "" {
+		if d, err := time.ParseDuration(l.MaxRateLimitWait); err != nil || d < 0 {
+			return fmt.Errorf("invalid limits.maxRateLimitWait '%s'", l.MaxRateLimitWait)
+		}
+	}
+
+	if s := c.Scheduler; s != nil {
+		for class, interval := range s.Intervals {
+			if !validPriority(class) {
+				return fmt.Errorf("invalid scheduler.intervals class '%s'", class)
+			}
+			if d, err := time.ParseDuration(interval); err != nil || d <= 0 {
+				return fmt.Errorf("invalid scheduler.intervals.%s '%s'", class, interval)
+			}
+		}
+		if s.Jitter != "" {
+			if d, err := time.ParseDuration(s.Jitter); err != nil || d < 0 {
+				return fmt.Errorf("invalid scheduler.jitter '%s'", s.Jitter)
+			}
+		}
+		if s.MaxPollsPerMinute < 0 {
+			return fmt.Errorf("scheduler.maxPollsPerMinute must not be negative")
+		}
+	}
+
+	if err := c.validatePlugins(); err != nil {
+		return err
+	}
+
+	if t := c.Telemetry; t != nil && t.Enabled {
+		if u, err := url.Parse(t.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("telemetry requires an endpoint URL")
+		}
+	}
+
+	if b := c.Bundles; b != nil {
+		if key, err := base64.StdEncoding.DecodeString(b.PublicKey); err != nil || len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("bundles.publicKey must be a base64 Ed25519 public key")
+		}
+	}
+
+	if p := c.Policies; p != nil && len(p.Paths) == 0 {
+		return fmt.Errorf("policies need paths to Rego files")
+	}
+
+	for i, pattern := range c.Redact {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("redact pattern %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// validateRings checks the rollout rings of a target
+func validateRings(target SyncTarget) error {
+	if target.Type != "region" || !strings.ContainsAny(target.Path, "*?[") {
+		return fmt.Errorf("rings only apply to region targets whose path is a glob")
+	}
+	names := make(map[string]bool)
+	for i, ring := range target.Rings {
+		if ring.Name == "" {
+			return fmt.Errorf("ring %d needs a name", i)
+		}
+		if names[ring.Name] {
+			return fmt.Errorf("duplicate ring '%s'", ring.Name)
+		}
+		names[ring.Name] = true
+
+		if len(ring.Paths) == 0 && i != len(target.Rings)-1 {
+			return fmt.Errorf("ring '%s' needs paths: only the last ring takes the remaining files", ring.Name)
+		}
+		for _, pattern := range ring.Paths {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("ring '%s': invalid path '%s'", ring.Name, pattern)
+			}
 		}
+		if i == 0 && (ring.Soak != "" || ring.Approval) {
+			return fmt.Errorf("ring '%s' is the first, so it can't wait for soak or approval", ring.Name)
+		}
+		if ring.Soak != "" {
+			if d, err := time.ParseDuration(ring.Soak); err != nil || d < 0 {
+				return fmt.Errorf("ring '%s': invalid soak '%s'", ring.Name, ring.Soak)
+			}
+		}
+	}
+	return nil
+}
 
-		// Validate source
+// validContact reports whether a contact is a Slack handle or channel, or an
+// email address
+func validContact(contact string) bool {
+	if name, ok := strings.CutPrefix(contact, "@"); ok {
+		return name != "" && !strings.ContainsAny(name, " @")
+	}
+	if name, ok := strings.CutPrefix(contact, "#"); ok {
+		return name != "" && !strings.Contains(name, " ")
+	}
+	addr, err := mail.ParseAddress(contact)
+	return err == nil && addr.Address == contact
+}
+
+// validPriority reports whether class is a priority class
+func validPriority(class string) bool {
+	switch class {
+	case PriorityCritical, PriorityNormal, PriorityLow:
+		return true
+	}
+	return false
+}
+
+// validUpdatePolicy reports whether policy is an update policy
+func validUpdatePolicy(policy string) bool {
+	switch policy {
+	case UpdatePin, UpdatePatch, UpdateMinor, UpdateLatest:
+		return true
+	}
+	return false
+}
+
+// MergeDriverFor returns the merge driver configured for an item: the item's
+// own driver, or the first rule matching its target path. It returns an empty
+// string if none applies.
+func (c *Config) MergeDriverFor(item SyncItem) string {
+	if item.Target.MergeDriver != "" {
+		return item.Target.MergeDriver
+	}
+
+	path := filepath.ToSlash(item.Target.Path)
+	for _, rule := range c.MergeDrivers {
+		name := path
+		if !strings.Contains(rule.Path, "/") {
+			name = filepath.Base(path)
+		}
+		if ok, _ := filepath.Match(rule.Path, name); ok {
+			return rule.Driver
+		}
+	}
+
+	return ""
+}
+
+// Validate checks if the sync item is complete. Disabled items are not
+// checked.
+func (item *SyncItem) Validate() error {
+	return item.validate(nil)
+}
+
+// validate checks an item, accepting the providers of plugins as sources
+func (item *SyncItem) validate(plugins []PluginConfig) error {
+	if item.Disabled {
+		return nil
+	}
+
+	// Validate source
+	switch item.Source.ProviderName() {
+	case ProviderGitHub, ProviderGitLab, ProviderBitbucket, ProviderGitea:
 		if item.Source.Owner == "" || item.Source.Repo == "" || item.Source.Path == "" {
-			return fmt.Errorf("item %d (%s): incomplete source configuration", i, item.Name)
+			return fmt.Errorf("incomplete source configuration")
+		}
+	case ProviderGit:
+		if item.Source.URL == "" || item.Source.Path == "" {
+			return fmt.Errorf("git sources require url and path")
+		}
+	case ProviderGist:
+		if item.Source.Repo == "" || item.Source.Path == "" {
+			return fmt.Errorf("gist sources require the gist ID as repo and a file name as path")
+		}
+		if item.Source.Branch != "" || item.Source.Tag != "" || item.Source.Archive || len(item.Branches) > 0 {
+			return fmt.Errorf("gist sources have no branches, tags or archives")
+		}
+		if item.Target.Type == "directory" {
+			return fmt.Errorf("gist sources sync a single file, not a directory")
+		}
+	case ProviderLocal:
+		if item.Source.Path == "" {
+			return fmt.Errorf("local sources require a path")
 		}
+	default:
+		if !hasPlugin(plugins, item.Source.Provider, PluginProvider) {
+			return fmt.Errorf("invalid source provider '%s'", item.Source.Provider)
+		}
+		if item.Source.Path == "" {
+			return fmt.Errorf("plugin sources require a path")
+		}
+	}
 
-		// Validate target
-		if item.Target.Path == "" || item.Target.Type == "" {
-			return fmt.Errorf("item %d (%s): incomplete target configuration", i, item.Name)
+	if err := validateGitHubURLs(item.Source.GitHubBaseURL, item.Source.GitHubUploadURL); err != nil {
+		return err
+	}
+
+	if item.Source.Archive && (item.Target.Type != "directory" || item.Source.ProviderName() != ProviderGitHub) {
+		return fmt.Errorf("archive only applies to directory targets of github sources")
+	}
+
+	if item.Source.Tag != "" && item.Source.Release != "" {
+		return fmt.Errorf("source tag and release can't both be set")
+	}
+	if item.Source.Release != "" || item.Source.Update != "" {
+		if item.Source.ProviderName() != ProviderGitHub {
+			return fmt.Errorf("release and update only apply to github sources")
+		}
+	}
+	if item.Source.Update != "" {
+		if !validUpdatePolicy(item.Source.Update) {
+			return fmt.Errorf("invalid update policy '%s'", item.Source.Update)
+		}
+		if !version.Valid(item.Source.Tag) {
+			return fmt.Errorf("update policy requires a source tag that is a semantic version")
+		}
+	}
+	if item.Source.Release != "" {
+		if err := version.ValidRange(item.Source.Release); err != nil {
+			return fmt.Errorf("invalid release: %w", err)
+		}
+	}
+
+	if item.Priority != "" && !validPriority(item.Priority) {
+		return fmt.Errorf("invalid priority '%s'", item.Priority)
+	}
+
+	// Validate target
+	if item.Target.Path == "" || item.Target.Type == "" {
+		return fmt.Errorf("incomplete target configuration")
+	}
+
+	switch item.OnConflict {
+	case "", ConflictOurs, ConflictTheirs, ConflictFail:
+	case ConflictMerge:
+		if item.Target.Type != "file" || item.Target.Structured() {
+			return fmt.Errorf("onConflict merge only applies to file targets without selectors")
 		}
+	default:
+		return fmt.Errorf("invalid onConflict strategy '%s'", item.OnConflict)
+	}
+
+	// Validate target type
+	switch item.Target.Type {
+	case "file", "directory", "function", "openapi", "markdown", "asset", "region", "workflow":
+	default:
+		return fmt.Errorf("invalid target type '%s'", item.Target.Type)
+	}
 
-		// Validate target type
-		if item.Target.Type != "file" && item.Target.Type != "directory" && item.Target.Type != "function" {
-			return fmt.Errorf("item %d (%s): invalid target type '%s'", i, item.Name, item.Target.Type)
+	if item.Target.Type == "markdown" {
+		if item.Target.Section == "" {
+			return fmt.Errorf("markdown sync requires a section")
 		}
+		switch item.Target.RewriteLinks {
+		case "", "keep", "absolute":
+		case "prefix":
+			if item.Target.LinkPrefix == "" {
+				return fmt.Errorf("rewriteLinks: prefix requires linkPrefix")
+			}
+		default:
+			return fmt.Errorf("invalid rewriteLinks mode '%s'", item.Target.RewriteLinks)
+		}
+	}
 
-		// Validate function sync
-		if item.Target.Type == "function" && (item.Target.Language == "" || item.Target.Function == "") {
-			return fmt.Errorf("item %d (%s): function sync requires language and function name", i, item.Name)
+	if item.Target.Bundle && item.Target.Type != "openapi" {
+		return fmt.Errorf("bundle only applies to openapi targets")
+	}
+
+	if item.Target.Type == "region" {
+		if item.Target.Marker == "" {
+			return fmt.Errorf("region sync requires a marker")
+		}
+		if _, err := filepath.Match(item.Target.Path, ""); err != nil {
+			return fmt.Errorf("invalid target path '%s': %w", item.Target.Path, err)
+		}
+	}
+
+	if len(item.Target.Rings) > 0 {
+		if err := validateRings(item.Target); err != nil {
+			return err
+		}
+	}
+	if (item.Target.RingCheck != "" || item.Target.RevertOnFailure) && len(item.Target.Rings) == 0 {
+		return fmt.Errorf("ringCheck and revertOnFailure only apply to targets with rings")
+	}
+	if item.Target.RevertOnFailure && item.Target.RingCheck == "" {
+		return fmt.Errorf("revertOnFailure needs a ringCheck")
+	}
+
+	if item.Target.Type == "workflow" && !workflow.IsWorkflowPath(item.Target.Path) {
+		return fmt.Errorf("workflow target must be a .yml or .yaml file directly in %s", workflow.Dir)
+	}
+
+	if len(item.Target.Keep) > 0 {
+		if item.Target.Type != "workflow" {
+			return fmt.Errorf("keep only applies to workflow targets")
+		}
+		for _, selector := range item.Target.Keep {
+			if _, err := structured.ParsePath(selector); err != nil {
+				return err
+			}
+		}
+	}
+
+	if item.Target.Mode != "" {
+		if item.Target.Type == "directory" || item.Target.Type == "region" {
+			return fmt.Errorf("mode only applies to targets that are a single file")
+		}
+		if _, err := item.Target.FileMode(); err != nil {
+			return err
+		}
+	}
+
+	switch item.Target.PinDigests {
+	case "", "warn", "fail", "off":
+	default:
+		return fmt.Errorf("invalid pinDigests policy '%s'", item.Target.PinDigests)
+	}
+
+	if len(item.Target.Process) > 0 && item.Target.Type != "asset" {
+		return fmt.Errorf("process only applies to asset targets")
+	}
+
+	if item.Target.Migrations && item.Target.Type != "directory" {
+		return fmt.Errorf("migrations only applies to directory targets")
+	}
+
+	for _, contact := range item.Contacts {
+		if !validContact(contact) {
+			return fmt.Errorf("invalid contact '%s': expected @handle, #channel or an email address", contact)
+		}
+	}
+
+	if len(item.Target.Rename) > 0 && (item.Target.Type != "directory" || item.Target.Migrations || item.Target.Terraform != nil) {
+		return fmt.Errorf("rename only applies to directory targets without migrations or terraform")
+	}
+	for _, rule := range item.Target.Rename {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+	}
+
+	if tf := item.Target.Terraform; tf != nil {
+		if item.Target.Type != "directory" || item.Target.Migrations {
+			return fmt.Errorf("terraform only applies to directory targets without migrations")
+		}
+		if item.Source.Revision == "" {
+			return fmt.Errorf("terraform vendoring requires a source revision to pin the module")
+		}
+		for _, pattern := range tf.Rewrite {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid terraform rewrite path '%s': %w", pattern, err)
+			}
+		}
+	}
+
+	// Validate function sync
+	if item.Target.Type == "function" && (item.Target.Language == "" || item.Target.Function == "") {
+		return fmt.Errorf("function sync requires language and function name")
+	}
+
+	switch item.Target.Relocate {
+	case "", "suggest", "auto", "off":
+	default:
+		return fmt.Errorf("invalid relocate mode '%s'", item.Target.Relocate)
+	}
+
+	for _, pattern := range item.Target.SearchPaths {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid search path '%s': %w", pattern, err)
+		}
+	}
+
+	if item.Target.Structured() {
+		if item.Target.Type != "file" {
+			return fmt.Errorf("jsonPath and yamlPath only apply to file targets")
+		}
+		if len(item.Target.JSONPath) > 0 && len(item.Target.YAMLPath) > 0 {
+			return fmt.Errorf("jsonPath and yamlPath can't be combined")
+		}
+		for _, selector := range append(item.Target.JSONPath, item.Target.YAMLPath...) {
+			if _, err := structured.ParsePath(selector); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch item.Target.OnBreaking {
+	case "", "warn", "fail", "allow":
+	default:
+		return fmt.Errorf("invalid onBreaking policy '%s'", item.Target.OnBreaking)
+	}
+
+	if gen := item.Generate; gen != nil {
+		if gen.Command == "" || len(gen.Outputs) == 0 {
+			return fmt.Errorf("generate requires a command and outputs")
+		}
+		for _, pattern := range gen.Outputs {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid generate output '%s': %w", pattern, err)
+			}
+		}
+	}
+
+	if item.Target.MergeDriver != "" {
+		if item.Target.Type != "file" {
+			return fmt.Errorf("merge drivers only apply to file targets")
+		}
+		if _, err := merge.Get(item.Target.MergeDriver); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Validate checks if the secret reference is complete
+func (r *SecretRef) Validate() error {
+	switch r.Provider {
+	case "env", "file", "vault", "aws", "gcp", "keychain":
+	default:
+		return fmt.Errorf("invalid secrets provider '%s'", r.Provider)
+	}
+
+	if r.Name == "" {
+		return fmt.Errorf("secret name is required")
+	}
+
+	return nil
+}
+
+// Validate checks if the notification settings are valid
+func (n *NotificationsConfig) Validate() error {
+	names := make(map[string]bool)
+	for i, notifier := range n.Notifiers {
+		switch notifier.Type {
+		case "slack", "webhook":
+			if notifier.URL == "" {
+				return fmt.Errorf("notifier %d (%s): url is required", i, notifier.Name)
+			}
+		case "pagerduty", "opsgenie":
+			if notifier.Key == "" {
+				return fmt.Errorf("notifier %d (%s): key is required", i, notifier.Name)
+			}
+		case "plugin":
+			if notifier.Plugin == "" {
+				return fmt.Errorf("notifier %d (%s): plugin is required", i, notifier.Name)
+			}
+		default:
+			return fmt.Errorf("notifier %d (%s): invalid type '%s'", i, notifier.Name, notifier.Type)
+		}
+		switch notifier.Content {
+		case "", "files", "stats", "full":
+		default:
+			return fmt.Errorf("notifier %d (%s): invalid content '%s', expected files, stats or full", i, notifier.Name, notifier.Content)
+		}
+		names[notifier.Name] = true
+	}
+
+	for i, route := range n.Routes {
+		switch route.MinSeverity {
+		case "", "info", "warning", "error":
+		default:
+			return fmt.Errorf("route %d: invalid severity '%s'", i, route.MinSeverity)
+		}
+		for _, event := range route.Events {
+			if event != "updated" && event != "conflict" && event != "error" && event != "recovered" {
+				return fmt.Errorf("route %d: invalid event type '%s'", i, event)
+			}
+		}
+		if len(route.Notifiers) == 0 {
+			return fmt.Errorf("route %d: no notifiers given", i)
+		}
+		for _, name := range route.Notifiers {
+			if !names[name] {
+				return fmt.Errorf("route %d: unknown notifier '%s'", i, name)
+			}
+		}
+	}
+
+	if n.Digest != nil {
+		if len(n.Digest.Times) == 0 {
+			return fmt.Errorf("digest requires at least one time")
+		}
+		for _, t := range n.Digest.Times {
+			if _, err := time.Parse("15:04", t); err != nil {
+				return fmt.Errorf("invalid digest time '%s', expected HH:MM", t)
+			}
 		}
 	}
 
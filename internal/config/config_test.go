@@ -3,7 +3,11 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/exitflynn/codesync/internal/version"
+	"gopkg.in/yaml.v3"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -113,6 +117,143 @@ items:
 	})
 }
 
+func TestLoadConfigExpandsEnv(t *testing.T) {
+	t.Setenv("CODESYNC_TEST_PROJECT", "from-env")
+	t.Setenv("CODESYNC_TEST_EMPTY", "")
+
+	content := `
+version: "1.0"
+projectName: "${CODESYNC_TEST_PROJECT}"
+syncInterval: "${CODESYNC_TEST_EMPTY:-1h}"
+items:
+  - name: "price$"
+    source:
+      owner: "acme"
+      repo: "utils"
+      path: "${CODESYNC_TEST_INJECTED}"
+    target:
+      path: "pkg/utils.go"
+      type: "file"
+limits:
+  maxAPICalls: ${CODESYNC_TEST_CALLS}
+`
+	// A value can't add keys to the config
+	t.Setenv("CODESYNC_TEST_INJECTED", "log.go\"\n    disabled: true\n#")
+	t.Setenv("CODESYNC_TEST_CALLS", "50")
+
+	configPath := filepath.Join(t.TempDir(), "codesync.yaml")
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	if cfg.ProjectName != "from-env" {
+		t.Errorf("Expected project name from env, got %s", cfg.ProjectName)
+	}
+	if cfg.SyncInterval != "1h" {
+		t.Errorf("Expected default sync interval, got %s", cfg.SyncInterval)
+	}
+	if cfg.Items[0].Name != "price$" || cfg.Items[0].Disabled || !strings.HasPrefix(cfg.Items[0].Source.Path, "log.go\"\n") {
+		t.Errorf("Unexpected item after expansion: %+v", cfg.Items[0])
+	}
+	if cfg.Limits == nil || cfg.Limits.MaxAPICalls != 50 {
+		t.Errorf("Expected an expanded number, got %+v", cfg.Limits)
+	}
+
+	unset := "version: \"1.0\"\nprojectName: \"${CODESYNC_TEST_UNSET}\"\n"
+	if err := os.WriteFile(configPath, []byte(unset), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+	if _, err := LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), "CODESYNC_TEST_UNSET") {
+		t.Errorf("Expected an error for an unset variable, got %v", err)
+	}
+}
+
+func TestLoadConfigExpandsBranches(t *testing.T) {
+	content := `
+version: "1.0"
+items:
+  - name: "logger"
+    source:
+      owner: "acme"
+      repo: "utils"
+      path: "log.go"
+    target:
+      path: "pkg/log.go"
+      type: "file"
+    branches:
+      - source: "main"
+        path: "pkg/log.go"
+      - source: "release-1.x"
+        path: "../release-1.x/pkg/log.go"
+  - name: "other"
+    source:
+      owner: "acme"
+      repo: "utils"
+      path: "other.go"
+    target:
+      path: "pkg/other.go"
+      type: "file"
+`
+	configPath := filepath.Join(t.TempDir(), "codesync.yaml")
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if len(cfg.Items) != 3 {
+		t.Fatalf("Expected one item per branch plus the other item, got %+v", cfg.Items)
+	}
+
+	release := cfg.Items[1]
+	if release.Name != "logger@release-1.x" || release.Source.Branch != "release-1.x" ||
+		release.Target.Path != "../release-1.x/pkg/log.go" || release.Branches != nil {
+		t.Errorf("Unexpected release branch item: %+v", release)
+	}
+	if cfg.Items[2].Name != "other" || cfg.Items[2].Source.Branch != "main" {
+		t.Errorf("Unexpected item without branches: %+v", cfg.Items[2])
+	}
+
+	duplicate := []SyncItem{{Name: "logger", Branches: []BranchTarget{{Source: "main", Path: "a.go"}, {Source: "main", Path: "b.go"}}}}
+	if _, err := ExpandBranches(duplicate); err == nil {
+		t.Error("Expected an error for a branch listed twice")
+	}
+	incomplete := []SyncItem{{Name: "logger", Branches: []BranchTarget{{Source: "main"}}}}
+	if _, err := ExpandBranches(incomplete); err == nil {
+		t.Error("Expected an error for a branch without a target path")
+	}
+}
+
+func TestLoadConfigRequiredVersion(t *testing.T) {
+	old := version.Version
+	t.Cleanup(func() { version.Version = old })
+	version.Version = "v1.3.0"
+
+	configPath := filepath.Join(t.TempDir(), "codesync.yaml")
+	write := func(constraint string) {
+		content := "version: \"1.0\"\nrequiredVersion: \"" + constraint + "\"\n"
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test config file: %v", err)
+		}
+	}
+
+	write(">= 1.4")
+	if _, err := LoadConfig(configPath); err == nil {
+		t.Error("Expected an older binary to refuse the config")
+	}
+	write(">= 1.2, < 2")
+	if _, err := LoadConfig(configPath); err != nil {
+		t.Errorf("Expected the config to load, got %v", err)
+	}
+}
+
 func TestConfigValidation(t *testing.T) {
 	t.Run("Valid Config", func(t *testing.T) {
 		cfg := &Config{
@@ -224,6 +365,502 @@ func TestConfigValidation(t *testing.T) {
 			t.Error("Validation should fail due to missing function details")
 		}
 	})
+
+	t.Run("Invalid Source Provider", func(t *testing.T) {
+		cfg := &Config{
+			Version: "1.0",
+			Items: []SyncItem{{
+				Name:   "test-item",
+				Source: SyncSource{Provider: "svn", Owner: "owner", Repo: "repo", Path: "file.go"},
+				Target: SyncTarget{Path: "file.go", Type: "file"},
+			}},
+		}
+
+		if err := cfg.Validate(); err == nil {
+			t.Error("Validation should fail due to an unknown provider")
+		}
+
+		cfg.Items[0].Source.Provider = "gitlab"
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Validation should pass for gitlab sources, but got error: %v", err)
+		}
+
+		cfg.Items[0].Source.Provider = "bitbucket"
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Validation should pass for bitbucket sources, but got error: %v", err)
+		}
+
+		cfg.Items[0].Source.Provider = "gitea"
+		if err := cfg.Validate(); err == nil {
+			t.Error("Validation should fail for gitea sources without giteaURL")
+		}
+		cfg.GiteaURL = "https://gitea.example.com"
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Validation should pass for gitea sources, but got error: %v", err)
+		}
+
+		cfg.Items[0].Source = SyncSource{Provider: "git", Path: "file.go"}
+		if err := cfg.Validate(); err == nil {
+			t.Error("Validation should fail for git sources without a url")
+		}
+		cfg.Items[0].Source.URL = "ssh://git@git.example.com/utils.git"
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Validation should pass for git sources without owner and repo, but got error: %v", err)
+		}
+
+		cfg.Items[0].Source = SyncSource{Provider: "local"}
+		if err := cfg.Validate(); err == nil {
+			t.Error("Validation should fail for local sources without a path")
+		}
+		cfg.Items[0].Source.Path = "../monorepo/pkg/log.go"
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Validation should pass for local sources, but got error: %v", err)
+		}
+	})
+
+	t.Run("Plugins", func(t *testing.T) {
+		cfg := &Config{
+			Version: "1.0",
+			Plugins: []PluginConfig{{Name: "monorepo", Kind: "provider"}, {Name: "license-header", Kind: "transform"}},
+			Items: []SyncItem{{
+				Name:   "logger",
+				Source: SyncSource{Provider: "monorepo", Path: "pkg/log.go"},
+				Target: SyncTarget{Path: "log.go", Type: "file", TransformPlugin: "license-header"},
+			}},
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Validation should pass for plugin sources and transforms, but got error: %v", err)
+		}
+		if err := cfg.Items[0].Validate(); err == nil {
+			t.Error("Validation of an item on its own should fail for plugin sources")
+		}
+
+		cfg.Items[0].Target.TransformPlugin = "monorepo"
+		if err := cfg.Validate(); err == nil {
+			t.Error("Validation should fail for a transform that isn't a transform plugin")
+		}
+		cfg.Items[0].Target.TransformPlugin = ""
+
+		cfg.Plugins = append(cfg.Plugins, PluginConfig{Name: "github", Kind: "provider"})
+		if err := cfg.Validate(); err == nil {
+			t.Error("Validation should fail for a plugin replacing a built-in provider")
+		}
+		cfg.Plugins[2] = PluginConfig{Name: "chat", Kind: "bot"}
+		if err := cfg.Validate(); err == nil {
+			t.Error("Validation should fail for an invalid plugin kind")
+		}
+		cfg.Plugins[2] = PluginConfig{Name: "chat", Kind: "notifier"}
+
+		cfg.Notifications = &NotificationsConfig{Notifiers: []NotifierConfig{{Name: "chat", Type: "plugin", Plugin: "chatops"}}}
+		if err := cfg.Validate(); err == nil {
+			t.Error("Validation should fail for a notifier naming an unknown plugin")
+		}
+		cfg.Notifications.Notifiers[0].Plugin = "chat"
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Validation should pass for a notifier plugin, but got error: %v", err)
+		}
+		cfg.Notifications.Notifiers[0].Content = "diff"
+		if err := cfg.Validate(); err == nil {
+			t.Error("Validation should fail for an invalid notifier content policy")
+		}
+	})
+
+	t.Run("Telemetry", func(t *testing.T) {
+		cfg := &Config{Version: "1.0", Telemetry: &TelemetryConfig{Enabled: true}}
+		if err := cfg.ValidateSettings(); err == nil {
+			t.Error("Validation should fail for enabled telemetry without an endpoint")
+		}
+		cfg.Telemetry.Endpoint = "https://telemetry.example.com/v1/usage"
+		if err := cfg.ValidateSettings(); err != nil {
+			t.Errorf("Validation should pass with an endpoint, but got error: %v", err)
+		}
+	})
+
+	t.Run("Bundles", func(t *testing.T) {
+		cfg := &Config{Version: "1.0", Bundles: &BundleConfig{PublicKey: "not a key"}}
+		if err := cfg.ValidateSettings(); err == nil {
+			t.Error("Validation should fail for an invalid public key")
+		}
+		cfg.Bundles.PublicKey = "11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="
+		if err := cfg.ValidateSettings(); err != nil {
+			t.Errorf("Validation should pass for an Ed25519 public key, but got error: %v", err)
+		}
+	})
+
+	t.Run("Policies", func(t *testing.T) {
+		cfg := &Config{Version: "1.0", Policies: &PolicyConfig{}}
+		if err := cfg.ValidateSettings(); err == nil {
+			t.Error("Validation should fail for policies without paths")
+		}
+		cfg.Policies.Paths = []string{"policies/"}
+		if err := cfg.ValidateSettings(); err != nil {
+			t.Errorf("Validation should pass for policies, but got error: %v", err)
+		}
+	})
+
+	t.Run("Scheduler", func(t *testing.T) {
+		cfg := &Config{Version: "1.0", Scheduler: &SchedulerConfig{
+			Intervals: map[string]string{"critical": "5m", "low": "6h"},
+			Jitter:    "2m",
+		}}
+		if err := cfg.ValidateSettings(); err != nil {
+			t.Errorf("Validation should pass for a scheduler, but got error: %v", err)
+		}
+		cfg.Scheduler.Intervals["urgent"] = "1m"
+		if err := cfg.ValidateSettings(); err == nil {
+			t.Error("Validation should fail for an unknown priority class")
+		}
+		cfg.Scheduler.Intervals = map[string]string{"normal": "0s"}
+		if err := cfg.ValidateSettings(); err == nil {
+			t.Error("Validation should fail for a zero interval")
+		}
+
+		item := SyncItem{
+			Name:     "item",
+			Source:   SyncSource{Owner: "acme", Repo: "utils", Path: "log.go"},
+			Target:   SyncTarget{Path: "log.go", Type: "file"},
+			Priority: "urgent",
+		}
+		if err := item.Validate(); err == nil {
+			t.Error("Validation should fail for an unknown item priority")
+		}
+	})
+
+	t.Run("OnConflict", func(t *testing.T) {
+		item := SyncItem{
+			Name:       "item",
+			Source:     SyncSource{Owner: "acme", Repo: "utils", Path: "log.go"},
+			Target:     SyncTarget{Path: "log.go", Type: "file"},
+			OnConflict: ConflictMerge,
+		}
+		if err := item.Validate(); err != nil {
+			t.Errorf("Validation should pass for merging a file, but got error: %v", err)
+		}
+		item.OnConflict = "rebase"
+		if err := item.Validate(); err == nil {
+			t.Error("Validation should fail for an unknown conflict strategy")
+		}
+		item.OnConflict = ConflictMerge
+		item.Target.Type = "directory"
+		if err := item.Validate(); err == nil {
+			t.Error("Validation should fail for merging a directory")
+		}
+		item.OnConflict = ConflictTheirs
+		if err := item.Validate(); err != nil {
+			t.Errorf("Validation should pass for taking upstream's directory, but got error: %v", err)
+		}
+	})
+
+	t.Run("Gist", func(t *testing.T) {
+		item := SyncItem{
+			Name:   "retry",
+			Source: SyncSource{Provider: ProviderGist, Owner: "octocat", Repo: "aa5a315d61ae9438b18d", Path: "retry.go"},
+			Target: SyncTarget{Path: "retry.go", Type: "function", Language: "go", Function: "Retry"},
+		}
+		if err := item.Validate(); err != nil {
+			t.Errorf("Validation should pass for a gist file, but got error: %v", err)
+		}
+		if item.Source.Branch = "main"; item.Validate() == nil {
+			t.Error("Validation should fail for the branch of a gist")
+		}
+		item.Source.Branch = ""
+		if item.Source.Repo = ""; item.Validate() == nil {
+			t.Error("Validation should fail without the gist ID")
+		}
+	})
+
+	t.Run("Mode", func(t *testing.T) {
+		item := SyncItem{
+			Name:   "script",
+			Source: SyncSource{Owner: "acme", Repo: "tools", Path: "deploy.sh"},
+			Target: SyncTarget{Path: "deploy.sh", Type: "file", Mode: "0755"},
+		}
+		if err := item.Validate(); err != nil {
+			t.Errorf("Validation should pass for an octal mode, but got error: %v", err)
+		}
+		for _, mode := range []string{"755x", "0", "1777"} {
+			if item.Target.Mode = mode; item.Validate() == nil {
+				t.Errorf("Validation should fail for mode %s", mode)
+			}
+		}
+		item.Target = SyncTarget{Path: "scripts", Type: "directory", Mode: "0755"}
+		if err := item.Validate(); err == nil {
+			t.Error("Validation should fail for the mode of a directory")
+		}
+	})
+
+	t.Run("Archive", func(t *testing.T) {
+		item := SyncItem{
+			Name:   "vpc",
+			Source: SyncSource{Owner: "acme", Repo: "modules", Path: "vpc", Archive: true},
+			Target: SyncTarget{Path: "vendor/vpc", Type: "directory"},
+		}
+		if err := item.Validate(); err != nil {
+			t.Errorf("Validation should pass for an archived directory, but got error: %v", err)
+		}
+		item.Source.Provider = ProviderGitLab
+		if err := item.Validate(); err == nil {
+			t.Error("Validation should fail for an archive of a gitlab source")
+		}
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		item := SyncItem{
+			Name:   "lib",
+			Source: SyncSource{Owner: "acme", Repo: "lib", Path: "lib.go", Release: "^1.2"},
+			Target: SyncTarget{Path: "lib.go", Type: "file"},
+		}
+		if err := item.Validate(); err != nil {
+			t.Errorf("Validation should pass for a release range, but got error: %v", err)
+		}
+		if item.Source.Tag = "v1.2.0"; item.Validate() == nil {
+			t.Error("Validation should fail for both a tag and a release")
+		}
+		item.Source.Tag = ""
+		if item.Source.Release = "^one"; item.Validate() == nil {
+			t.Error("Validation should fail for an invalid release range")
+		}
+	})
+
+	t.Run("Update Policy", func(t *testing.T) {
+		item := SyncItem{
+			Name:   "lib",
+			Source: SyncSource{Owner: "acme", Repo: "lib", Path: "lib.go", Tag: "v1.2.0", Update: UpdateMinor},
+			Target: SyncTarget{Path: "lib.go", Type: "file"},
+		}
+		if err := item.Validate(); err != nil {
+			t.Errorf("Validation should pass for a tag with an update policy, but got error: %v", err)
+		}
+		if item.Source.Update = "major"; item.Validate() == nil {
+			t.Error("Validation should fail for an unknown update policy")
+		}
+		item.Source.Update = UpdatePatch
+		if item.Source.Tag = "stable"; item.Validate() == nil {
+			t.Error("Validation should fail for an update policy of a tag that isn't a version")
+		}
+	})
+
+	t.Run("Rings", func(t *testing.T) {
+		item := SyncItem{
+			Name:   "preamble",
+			Source: SyncSource{Owner: "acme", Repo: "security", Path: "preamble.Dockerfile"},
+			Target: SyncTarget{Path: "services/*/Dockerfile", Type: "region", Marker: "preamble", Rings: []RingConfig{
+				{Name: "canary", Paths: []string{"services/canary/*"}},
+				{Name: "rest", Soak: "24h", Approval: true},
+			}},
+		}
+		if err := item.Validate(); err != nil {
+			t.Errorf("Validation should pass for rings, but got error: %v", err)
+		}
+		for name, edit := range map[string]func(*SyncTarget){
+			"a path that isn't a glob": func(t *SyncTarget) { t.Path = "Dockerfile" },
+			"a soak of the first ring": func(t *SyncTarget) { t.Rings[0].Soak = "1h" },
+			"an invalid soak":          func(t *SyncTarget) { t.Rings[1].Soak = "a day" },
+			"a ring without paths":     func(t *SyncTarget) { t.Rings[0].Paths = nil },
+			"duplicate rings":          func(t *SyncTarget) { t.Rings[1].Name = "canary" },
+			"a revert without a check": func(t *SyncTarget) { t.RevertOnFailure = true },
+			"a check without rings":    func(t *SyncTarget) { t.Rings = nil; t.Path = "Dockerfile"; t.RingCheck = "make" },
+		} {
+			broken := item
+			broken.Target.Rings = append([]RingConfig(nil), item.Target.Rings...)
+			edit(&broken.Target)
+			if broken.Validate() == nil {
+				t.Errorf("Validation should fail for %s", name)
+			}
+		}
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		item := SyncItem{
+			Name:   "tools",
+			Source: SyncSource{Owner: "acme", Repo: "tools", Path: "tools"},
+			Target: SyncTarget{Path: "third_party/tools", Type: "directory", Rename: []PathRule{
+				"src/main.go -> cmd/main.go", "src/ -> ", " -> pkg/", `/^(.*)_gen\.go$/ -> gen/$1.go`,
+			}},
+		}
+		if err := item.Validate(); err != nil {
+			t.Errorf("Validation should pass for rename rules, but got error: %v", err)
+		}
+		for _, rule := range []PathRule{"src/main.go", "main.go -> ", "src/ -> pkg", "/(/ -> x", "/x/ -> "} {
+			broken := item
+			broken.Target.Rename = []PathRule{rule}
+			if broken.Validate() == nil {
+				t.Errorf("Validation should fail for rule '%s'", rule)
+			}
+		}
+		item.Target.Type = "file"
+		if item.Validate() == nil {
+			t.Error("Validation should fail for rename rules on a file target")
+		}
+	})
+
+	t.Run("Contacts", func(t *testing.T) {
+		item := SyncItem{
+			Name:     "billing",
+			Source:   SyncSource{Owner: "acme", Repo: "billing", Path: "client.go"},
+			Target:   SyncTarget{Path: "client.go", Type: "file"},
+			Owner:    "payments",
+			Contacts: []string{"@ana", "#payments-oncall", "payments@example.com"},
+		}
+		if err := item.Validate(); err != nil {
+			t.Errorf("Validation should pass for contacts, but got error: %v", err)
+		}
+		for _, contact := range []string{"ana", "@", "Payments <payments@example.com>", "#pay ments"} {
+			broken := item
+			broken.Contacts = []string{contact}
+			if broken.Validate() == nil {
+				t.Errorf("Validation should fail for contact '%s'", contact)
+			}
+		}
+	})
+
+	t.Run("GitHub Enterprise URLs", func(t *testing.T) {
+		cfg := &Config{Version: "1.0", GitHubBaseURL: "https://github.example.com"}
+		if err := cfg.ValidateSettings(); err != nil {
+			t.Errorf("Validation should pass for an instance URL, but got error: %v", err)
+		}
+		cfg.GitHubBaseURL = "github.example.com"
+		if err := cfg.ValidateSettings(); err == nil {
+			t.Error("Validation should fail for a URL without a scheme")
+		}
+		cfg.GitHubBaseURL = ""
+		cfg.GitHubUploadURL = "https://uploads.github.example.com"
+		if err := cfg.ValidateSettings(); err == nil {
+			t.Error("Validation should fail for an upload URL without a base URL")
+		}
+
+		item := SyncItem{
+			Name:   "logger",
+			Source: SyncSource{Owner: "acme", Repo: "utils", Path: "log.go", GitHubBaseURL: "ftp//bad"},
+			Target: SyncTarget{Path: "log.go", Type: "file"},
+		}
+		if err := item.Validate(); err == nil {
+			t.Error("Validation should fail for an invalid item URL")
+		}
+	})
+
+	t.Run("GitHub host", func(t *testing.T) {
+		cfg := &Config{}
+		if cfg.GitHubHost() != "github.com" || cfg.GitHubWebURL() != "https://github.com" {
+			t.Errorf("Expected github.com, got %s (%s)", cfg.GitHubHost(), cfg.GitHubWebURL())
+		}
+		cfg.GitHubBaseURL = "https://github.example.com/api/v3/"
+		if cfg.GitHubHost() != "github.example.com" || cfg.GitHubWebURL() != "https://github.example.com" {
+			t.Errorf("Expected github.example.com, got %s (%s)", cfg.GitHubHost(), cfg.GitHubWebURL())
+		}
+	})
+
+	t.Run("Invalid Redact Pattern", func(t *testing.T) {
+		cfg := &Config{Version: "1.0", Redact: []string{"tok-[0-9"}}
+
+		if err := cfg.ValidateSettings(); err == nil {
+			t.Error("Validation should fail due to an invalid redact pattern")
+		}
+	})
+}
+
+func TestMergeDriverFor(t *testing.T) {
+	cfg := &Config{
+		Version: "1.0",
+		MergeDrivers: []MergeDriverRule{
+			{Path: "deploy/*.yaml", Driver: "theirs"},
+			{Path: "*.yaml", Driver: "yaml-merge"},
+			{Path: "*.json", Driver: "json-merge"},
+		},
+	}
+	if err := cfg.ValidateSettings(); err != nil {
+		t.Fatalf("Validation should pass, but got error: %v", err)
+	}
+
+	tests := []struct {
+		path   string
+		driver string
+		want   string
+	}{
+		{"deploy/app.yaml", "", "theirs"},
+		{"config/app.yaml", "", "yaml-merge"},
+		{"package.json", "", "json-merge"},
+		{"package.json", "ours", "ours"},
+		{"main.go", "", ""},
+	}
+
+	for _, tt := range tests {
+		item := SyncItem{Target: SyncTarget{Path: tt.path, Type: "file", MergeDriver: tt.driver}}
+		if got := cfg.MergeDriverFor(item); got != tt.want {
+			t.Errorf("MergeDriverFor(%s) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	cfg.MergeDrivers = append(cfg.MergeDrivers, MergeDriverRule{Path: "*.toml", Driver: "toml-merge"})
+	if err := cfg.ValidateSettings(); err == nil {
+		t.Error("Validation should fail due to unknown merge driver")
+	}
+
+	item := SyncItem{
+		Source: SyncSource{Owner: "owner", Repo: "repo", Path: "a.go"},
+		Target: SyncTarget{Path: "a.go", Type: "function", Language: "go", Function: "A", MergeDriver: "union"},
+	}
+	if err := item.Validate(); err == nil {
+		t.Error("Validation should fail due to merge driver on a function target")
+	}
+}
+
+func TestSelectors(t *testing.T) {
+	var target SyncTarget
+	data := "path: package.json\ntype: file\njsonPath: $.engines\n"
+	if err := yaml.Unmarshal([]byte(data), &target); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(target.JSONPath) != 1 || target.JSONPath[0] != "$.engines" || !target.Structured() {
+		t.Errorf("Expected a single selector, got %v", target.JSONPath)
+	}
+
+	data = "path: values.yaml\ntype: file\nyamlPath: [image.tag, probes]\n"
+	target = SyncTarget{}
+	if err := yaml.Unmarshal([]byte(data), &target); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(target.YAMLPath) != 2 {
+		t.Errorf("Expected two selectors, got %v", target.YAMLPath)
+	}
+
+	item := SyncItem{
+		Source: SyncSource{Owner: "owner", Repo: "repo", Path: "values.yaml"},
+		Target: target,
+	}
+	if err := item.Validate(); err != nil {
+		t.Errorf("Validation should pass, but got error: %v", err)
+	}
+
+	item.Target.JSONPath = Selectors{"a[x]"}
+	if err := item.Validate(); err == nil {
+		t.Error("Validation should fail due to combined and invalid selectors")
+	}
+}
+
+func TestSyncItemID(t *testing.T) {
+	item := SyncItem{Name: "logger", Source: SyncSource{Owner: "acme", Repo: "utils", Path: "log.go", Branch: "main"}}
+
+	id := item.ID()
+	if len(id) != 12 || item.ID() != id {
+		t.Errorf("Expected a stable 12 character ID, got %s", id)
+	}
+
+	// The target and other settings don't affect the ID
+	item.Target.Path = "elsewhere.go"
+	item.Tags = []string{"core"}
+	if item.ID() != id {
+		t.Errorf("Expected the ID to ignore the target, got %s", item.ID())
+	}
+
+	item.Source.Branch = "release-1.x"
+	if item.ID() == id {
+		t.Error("Expected a different ID for a different source branch")
+	}
+	renamed := SyncItem{Name: "log", Source: SyncSource{Owner: "acme", Repo: "utils", Path: "log.go", Branch: "main"}}
+	if renamed.ID() == id {
+		t.Error("Expected a different ID for a different name")
+	}
 }
 
 func TestGetAbsolutePath(t *testing.T) {
@@ -270,3 +907,36 @@ func TestGetAbsolutePath(t *testing.T) {
 		}
 	})
 }
+
+func TestWorkflowPath(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"", ".github/workflows/go-ci.yml"},
+		{".github/workflows", ".github/workflows/go-ci.yml"},
+		{".github/workflows/ci.yaml", ".github/workflows/ci.yaml"},
+	}
+
+	for _, tt := range tests {
+		item := SyncItem{
+			Source: SyncSource{Owner: "acme", Repo: "ci", Path: "templates/go-ci.yml"},
+			Target: SyncTarget{Path: tt.target, Type: "workflow"},
+		}
+		item.Target.Path = workflowPath(item)
+		if item.Target.Path != tt.want {
+			t.Errorf("workflowPath(%q) = %q, want %q", tt.target, item.Target.Path, tt.want)
+		}
+		if err := item.Validate(); err != nil {
+			t.Errorf("Expected %q to be valid: %v", item.Target.Path, err)
+		}
+	}
+
+	item := SyncItem{
+		Source: SyncSource{Owner: "acme", Repo: "ci", Path: "go-ci.yml"},
+		Target: SyncTarget{Path: "ci/go-ci.yml", Type: "workflow"},
+	}
+	if err := item.Validate(); err == nil {
+		t.Error("Expected workflow outside .github/workflows to be rejected")
+	}
+}
@@ -0,0 +1,152 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/exitflynn/codesync/internal/config"
+	csync "github.com/exitflynn/codesync/internal/sync"
+)
+
+// ItemStatus describes a sync item and its stored state
+type ItemStatus struct {
+	Name        string       `json:"name"`
+	ID          string       `json:"id"` // Stable ID of the item
+	Description string       `json:"description,omitempty"`
+	Disabled    bool         `json:"disabled,omitempty"`
+	Tags        []string     `json:"tags,omitempty"`
+	Owner       string       `json:"owner,omitempty"`
+	Contacts    []string     `json:"contacts,omitempty"`
+	Source      string       `json:"source"`
+	Target      string       `json:"target"`
+	Type        string       `json:"type"`
+	Conflict    bool         `json:"conflict,omitempty"`
+	State       *csync.State `json:"state,omitempty"`
+}
+
+// Handler returns the daemon's web dashboard and HTTP API:
+//
+//	GET  /                    web dashboard
+//	GET  /healthz             liveness check
+//	GET  /readyz              readiness check
+//	GET  /items               all items with their state
+//	GET  /items/{name}        one item with its state
+//	GET  /items/{name}/badge  shields.io endpoint badge for an item
+//	GET  /runs                recent runs, newest first
+//	GET  /runs/latest         the most recent run
+//	POST /items/{name}/sync   sync one item now
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !d.Ready() {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "starting"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+	})
+
+	mux.HandleFunc("GET /items", func(w http.ResponseWriter, r *http.Request) {
+		statuses := []ItemStatus{}
+		for _, item := range d.manager.Items() {
+			statuses = append(statuses, d.itemStatus(item))
+		}
+		writeJSON(w, http.StatusOK, statuses)
+	})
+
+	mux.HandleFunc("GET /items/{name}", func(w http.ResponseWriter, r *http.Request) {
+		item, ok := d.manager.Item(r.PathValue("name"))
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("%w: %s", csync.ErrUnknownItem, r.PathValue("name")))
+			return
+		}
+		writeJSON(w, http.StatusOK, d.itemStatus(item))
+	})
+
+	mux.HandleFunc("GET /items/{name}/badge", func(w http.ResponseWriter, r *http.Request) {
+		item, ok := d.manager.Item(r.PathValue("name"))
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("%w: %s", csync.ErrUnknownItem, r.PathValue("name")))
+			return
+		}
+		// Shields caches for at least five minutes anyway
+		w.Header().Set("Cache-Control", "max-age=300")
+		writeJSON(w, http.StatusOK, d.manager.Badge(item))
+	})
+
+	mux.HandleFunc("GET /runs", func(w http.ResponseWriter, r *http.Request) {
+		runs := d.Runs()
+		slices.Reverse(runs)
+		writeJSON(w, http.StatusOK, runs)
+	})
+
+	mux.HandleFunc("GET /runs/latest", func(w http.ResponseWriter, r *http.Request) {
+		run, ok := d.LatestRun()
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no runs yet"))
+			return
+		}
+		writeJSON(w, http.StatusOK, run)
+	})
+
+	mux.HandleFunc("POST /items/{name}/sync", func(w http.ResponseWriter, r *http.Request) {
+		run, err := d.SyncItem(r.PathValue("name"), "api")
+		if errors.Is(err, ErrNotLeader) {
+			writeError(w, http.StatusServiceUnavailable, err)
+			return
+		}
+		if errors.Is(err, csync.ErrUnknownItem) {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, run)
+	})
+
+	mux.Handle("GET /", dashboardHandler())
+
+	return mux
+}
+
+// itemStatus builds the status of an item from its config and stored state
+func (d *Daemon) itemStatus(item config.SyncItem) ItemStatus {
+	status := ItemStatus{
+		Name:        item.Name,
+		ID:          item.ID(),
+		Description: item.Description,
+		Disabled:    item.Disabled,
+		Tags:        item.Tags,
+		Owner:       item.Owner,
+		Contacts:    item.Contacts,
+		Source:      fmt.Sprintf("%s/%s/%s@%s", item.Source.Owner, item.Source.Repo, item.Source.Path, item.Source.Ref()),
+		Target:      item.Target.Path,
+		Type:        item.Target.Type,
+	}
+
+	if state, err := d.manager.ItemState(item.Name); err == nil {
+		status.State = &state
+		status.Conflict = state.HasLocalChanges && state.HasRemoteChanges
+	}
+
+	return status
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
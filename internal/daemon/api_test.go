@@ -0,0 +1,147 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/config"
+	csync "github.com/exitflynn/codesync/internal/sync"
+)
+
+func newTestDaemon(t *testing.T) *Daemon {
+	cfg := &config.Config{
+		Version:     "1.0",
+		GitHubToken: "test-token",
+		Items: []config.SyncItem{
+			{
+				Name:   "logger",
+				Tags:   []string{"core"},
+				Source: config.SyncSource{Owner: "acme", Repo: "utils", Path: "logger.go", Branch: "main"},
+				Target: config.SyncTarget{Path: "internal/logger.go", Type: "file"},
+			},
+		},
+	}
+
+	manager, err := csync.NewSyncManager(cfg, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+
+	return New(manager, Interval(0))
+}
+
+func TestAPI(t *testing.T) {
+	d := newTestDaemon(t)
+	server := httptest.NewServer(d.Handler())
+	defer server.Close()
+
+	get := func(path string, v interface{}) int {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+
+		if v != nil {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatalf("GET %s: invalid JSON: %v", path, err)
+			}
+		}
+		return resp.StatusCode
+	}
+
+	var health map[string]string
+	if status := get("/healthz", &health); status != http.StatusOK || health["status"] != "ok" {
+		t.Errorf("Unexpected /healthz response: %d %v", status, health)
+	}
+
+	if status := get("/readyz", nil); status != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 from /readyz before ready, got %d", status)
+	}
+	d.SetReady(true)
+	if status := get("/readyz", nil); status != http.StatusOK {
+		t.Errorf("Expected 200 from /readyz once ready, got %d", status)
+	}
+
+	var items []ItemStatus
+	if status := get("/items", &items); status != http.StatusOK || len(items) != 1 {
+		t.Fatalf("Unexpected /items response: %d %+v", status, items)
+	}
+	if items[0].Name != "logger" || items[0].ID == "" || items[0].Source != "acme/utils/logger.go@main" || items[0].State != nil {
+		t.Errorf("Unexpected item status: %+v", items[0])
+	}
+
+	var item ItemStatus
+	if status := get("/items/logger", &item); status != http.StatusOK || item.Type != "file" {
+		t.Errorf("Unexpected /items/logger response: %d %+v", status, item)
+	}
+
+	if status := get("/items/missing", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown item, got %d", status)
+	}
+
+	var badge csync.Badge
+	if status := get("/items/logger/badge", &badge); status != http.StatusOK || badge.Label != "logger" || badge.Message != "not synced" {
+		t.Errorf("Unexpected /items/logger/badge response: %d %+v", status, badge)
+	}
+	if status := get("/items/missing/badge", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown item badge, got %d", status)
+	}
+
+	if status := get("/runs/latest", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 before any run, got %d", status)
+	}
+
+	var runs []Run
+	if status := get("/runs", &runs); status != http.StatusOK || len(runs) != 0 {
+		t.Errorf("Unexpected /runs response: %d %+v", status, runs)
+	}
+
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("GET / failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("Unexpected dashboard response: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	if status := get("/missing", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown path, got %d", status)
+	}
+
+	resp, err = http.Post(server.URL+"/items/missing/sync", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 syncing unknown item, got %d", resp.StatusCode)
+	}
+
+	d.SetLeader(false)
+	resp, err = http.Post(server.URL+"/items/logger/sync", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 syncing on a standby replica, got %d", resp.StatusCode)
+	}
+	if runs := d.Runs(); len(runs) != 0 {
+		t.Errorf("Expected no run on a standby replica, got %d", len(runs))
+	}
+	d.SetLeader(true)
+
+	resp, err = http.Post(server.URL+"/healthz", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST /healthz, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,85 @@
+package daemon
+
+import (
+	"context"
+	"crypto/subtle"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"github.com/exitflynn/codesync/internal/controlpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RequireToken wraps the HTTP API so that requests must carry token as a
+// bearer token. Health checks, badges and the dashboard's static files stay
+// open; the dashboard passes on a token given as #token=... in its URL.
+func RequireToken(h http.Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !publicRequest(r) && !validToken(r.Header.Get("Authorization"), token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "missing or invalid token"})
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// publicRequest reports whether a request is for a health check, a badge or
+// a file of the dashboard, which don't need a token
+func publicRequest(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	p := r.URL.Path
+	switch {
+	case p == "/healthz", p == "/readyz", p == "/":
+		return true
+	case strings.HasPrefix(p, "/items/") && strings.HasSuffix(p, "/badge"):
+		return true
+	}
+	info, err := fs.Stat(dashboardFiles, "dashboard"+p)
+	return err == nil && !info.IsDir()
+}
+
+// TokenAuth returns the options of a gRPC server whose calls must carry token
+// as a bearer token in their authorization metadata. Health needs none.
+func TokenAuth(token string) []grpc.ServerOption {
+	check := func(ctx context.Context, method string) error {
+		if method == controlpb.Control_Health_FullMethodName {
+			return nil
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, value := range md.Get("authorization") {
+			if validToken(value, token) {
+				return nil
+			}
+		}
+		return status.Error(codes.Unauthenticated, "missing or invalid token")
+	}
+
+	return []grpc.ServerOption{
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if err := check(ctx, info.FullMethod); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := check(ss.Context(), info.FullMethod); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+}
+
+// validToken reports whether an authorization header holds token as a
+// bearer token
+func validToken(header, token string) bool {
+	given, ok := strings.CutPrefix(header, "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
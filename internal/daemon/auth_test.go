@@ -0,0 +1,64 @@
+package daemon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/controlpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRequireToken(t *testing.T) {
+	d := newTestDaemon(t)
+	server := httptest.NewServer(RequireToken(d.Handler(), "secret"))
+	defer server.Close()
+
+	do := func(method, path, token string) int {
+		req, _ := http.NewRequest(method, server.URL+path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for _, path := range []string{"/healthz", "/", "/app.js", "/items/logger/badge"} {
+		if status := do("GET", path, ""); status != http.StatusOK {
+			t.Errorf("Expected %s to be open, got %d", path, status)
+		}
+	}
+	if status := do("GET", "/items", ""); status != http.StatusUnauthorized {
+		t.Errorf("Expected /items to need the token, got %d", status)
+	}
+	if status := do("POST", "/items/logger/sync", "wrong"); status != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong token to be rejected, got %d", status)
+	}
+	if status := do("GET", "/items", "secret"); status != http.StatusOK {
+		t.Errorf("Expected the token to be accepted, got %d", status)
+	}
+}
+
+func TestTokenAuth(t *testing.T) {
+	d := newTestDaemon(t)
+	client := newTestGRPCClient(t, d, TokenAuth("secret")...)
+	ctx := context.Background()
+
+	if _, err := client.Health(ctx, &controlpb.HealthRequest{}); err != nil {
+		t.Errorf("Expected Health to need no token, got %v", err)
+	}
+	if _, err := client.ListItems(ctx, &controlpb.ListItemsRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Expected ListItems to need the token, got %v", err)
+	}
+	authed := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+	if _, err := client.ListItems(authed, &controlpb.ListItemsRequest{}); err != nil {
+		t.Errorf("Expected the token to be accepted, got %v", err)
+	}
+}
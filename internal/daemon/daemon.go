@@ -0,0 +1,377 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/diff"
+	csync "github.com/exitflynn/codesync/internal/sync"
+)
+
+// maxRuns is how many past runs the daemon keeps in memory
+const maxRuns = 20
+
+// ErrNotLeader is returned for syncs triggered on a standby replica, which
+// would otherwise write to the state shared with the leader
+var ErrNotLeader = errors.New("this replica is not the leader; trigger the sync on the leader")
+
+// Run records one execution of the sync loop or a triggered sync
+type Run struct {
+	ID       string              `json:"id"`
+	Trigger  string              `json:"trigger"` // "schedule", "api", "grpc" or "slack:<user>"
+	Started  time.Time           `json:"started"`
+	Finished time.Time           `json:"finished"`
+	Reports  []*csync.SyncReport `json:"-"`
+	Items    []ReportSummary     `json:"items"`
+	Summary  csync.RunSummary    `json:"summary"`
+	Error    string              `json:"error,omitempty"`
+}
+
+// ReportSummary is the machine-readable form of a sync report
+type ReportSummary struct {
+	Item         string            `json:"item"`
+	ID           string            `json:"id"` // Stable ID of the item
+	UpdatedFiles []string          `json:"updatedFiles,omitempty"`
+	CreatedFiles []string          `json:"createdFiles,omitempty"` // Of the updated files, those a directory sync added
+	DeletedFiles []string          `json:"deletedFiles,omitempty"` // Of the updated files, those a directory sync removed
+	Errors       []string          `json:"errors,omitempty"`
+	Conflict     bool              `json:"conflict,omitempty"`
+	Failure      string            `json:"failure,omitempty"`  // "transient", "config", "conflict" or "internal"
+	Deferred     bool              `json:"deferred,omitempty"` // Skipped because the API call budget ran out
+	Recovered    bool              `json:"recovered,omitempty"`
+	Relocated    string            `json:"relocated,omitempty"`  // New target path if the function moved
+	Breaking     []string          `json:"breaking,omitempty"`   // Breaking changes in an upstream .proto file
+	Endpoints    []string          `json:"endpoints,omitempty"`  // Operations added to or removed from an OpenAPI spec
+	Stale        []string          `json:"stale,omitempty"`      // Generated outputs that are out of date
+	Rollout      string            `json:"rollout,omitempty"`    // Why a rollout stopped before the last ring
+	Violations   []string          `json:"violations,omitempty"` // Policies the upstream change violates
+	Warnings     []string          `json:"warnings,omitempty"`   // Problems that didn't stop the sync
+	Owners       []string          `json:"owners,omitempty"`     // CODEOWNERS of the updated files
+	Owner        string            `json:"owner,omitempty"`      // Team responsible for the item
+	Contacts     []string          `json:"contacts,omitempty"`   // Who to ping about the item
+	Diffs        map[string]string `json:"diffs,omitempty"`      // Rendered diff per updated file
+}
+
+// Event types published to subscribers
+const (
+	EventRunStarted  = "run_started"
+	EventItemSynced  = "item_synced"
+	EventRunFinished = "run_finished"
+)
+
+// Event is a live notification about sync progress
+type Event struct {
+	Type   string         `json:"type"`
+	RunID  string         `json:"runId"`
+	Time   time.Time      `json:"time"`
+	Report *ReportSummary `json:"report,omitempty"` // Set for EventItemSynced
+}
+
+// Daemon periodically syncs all items and keeps a history of runs. Syncs are
+// serialized, so scheduled runs and triggered syncs never overlap.
+type Daemon struct {
+	manager   *csync.SyncManager
+	schedule  Schedule
+	scheduler *Scheduler // Polls items one by one instead of following schedule
+
+	ready   atomic.Bool // Reported by /readyz
+	standby atomic.Bool // Set while another replica holds the leader lease
+
+	syncMu  sync.Mutex // Held while a sync is in progress
+	current *Run       // The run in progress, guarded by syncMu
+
+	mu          sync.Mutex // Guards the fields below
+	runs        []*Run
+	nextID      int
+	subscribers map[chan Event]struct{}
+}
+
+// New creates a daemon that syncs on the given schedule
+func New(manager *csync.SyncManager, schedule Schedule) *Daemon {
+	d := &Daemon{
+		manager:     manager,
+		schedule:    schedule,
+		subscribers: make(map[chan Event]struct{}),
+	}
+
+	// Reports arrive while syncMu is held, so reading current is safe
+	manager.OnReport(func(report *csync.SyncReport) {
+		var runID string
+		if d.current != nil {
+			runID = d.current.ID
+		}
+
+		summary := Summarize(report)
+		d.publish(Event{Type: EventItemSynced, RunID: runID, Time: manager.Now(), Report: &summary})
+	})
+
+	return d
+}
+
+// Subscribe returns a channel receiving live sync events and a function that
+// cancels the subscription. Events are dropped for subscribers that fall
+// behind rather than blocking syncs.
+func (d *Daemon) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 64)
+
+	d.mu.Lock()
+	d.subscribers[ch] = struct{}{}
+	d.mu.Unlock()
+
+	cancel := func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		if _, ok := d.subscribers[ch]; ok {
+			delete(d.subscribers, ch)
+			close(ch)
+		}
+	}
+
+	return ch, cancel
+}
+
+// publish sends an event to every subscriber without blocking
+func (d *Daemon) publish(e Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for ch := range d.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// SetReady marks the daemon as ready (or not) to serve traffic, as reported
+// by the /readyz endpoint
+func (d *Daemon) SetReady(ready bool) {
+	d.ready.Store(ready)
+}
+
+// Ready reports whether the daemon has been marked ready
+func (d *Daemon) Ready() bool {
+	return d.ready.Load()
+}
+
+// SetLeader marks the daemon as holding the leader lease (or not). Standby
+// replicas reject triggered syncs with ErrNotLeader. Daemons without leader
+// election are always the leader.
+func (d *Daemon) SetLeader(leader bool) {
+	d.standby.Store(!leader)
+}
+
+// Leader reports whether the daemon may sync
+func (d *Daemon) Leader() bool {
+	return !d.standby.Load()
+}
+
+// Manager returns the sync manager driven by the daemon
+func (d *Daemon) Manager() *csync.SyncManager {
+	return d.manager
+}
+
+// SetScheduler makes Run poll each item when the scheduler says it is due,
+// rather than syncing all items on the daemon's schedule
+func (d *Daemon) SetScheduler(s *Scheduler) {
+	d.scheduler = s
+}
+
+// Run syncs all items on schedule, or the items the scheduler says are due,
+// until the context is cancelled. The next run is planned with the manager's
+// clock.
+func (d *Daemon) Run(ctx context.Context) error {
+	if d.scheduler != nil {
+		return d.runScheduled(ctx)
+	}
+	for {
+		now := d.manager.Now()
+		next := d.schedule.Next(now)
+		if next.IsZero() {
+			return fmt.Errorf("schedule has no upcoming runs")
+		}
+
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+			d.SyncAll("schedule")
+		}
+	}
+}
+
+// runScheduled syncs the items the scheduler says are due, each batch as a
+// run, until the context is cancelled
+func (d *Daemon) runScheduled(ctx context.Context) error {
+	for {
+		now := d.manager.Now()
+		if due := d.scheduler.Due(d.manager.Items(), now); len(due) > 0 {
+			d.syncItems(due, "schedule")
+			continue
+		}
+
+		timer := time.NewTimer(d.scheduler.Wake(d.manager.Items(), now).Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// syncItems syncs the named items and records the run
+func (d *Daemon) syncItems(names []string, trigger string) Run {
+	d.syncMu.Lock()
+	defer d.syncMu.Unlock()
+
+	run := d.startRun(trigger)
+	reports, err := d.manager.SyncItems(names)
+	return d.finishRun(run, reports, err)
+}
+
+// SyncAll syncs every item and records the run
+func (d *Daemon) SyncAll(trigger string) Run {
+	d.syncMu.Lock()
+	defer d.syncMu.Unlock()
+
+	run := d.startRun(trigger)
+	reports, err := d.manager.SyncAll()
+	return d.finishRun(run, reports, err)
+}
+
+// SyncItem syncs a single item by name and records the run
+func (d *Daemon) SyncItem(name, trigger string) (Run, error) {
+	if _, ok := d.manager.Item(name); !ok {
+		return Run{}, fmt.Errorf("%w: %s", csync.ErrUnknownItem, name)
+	}
+	if !d.Leader() {
+		return Run{}, ErrNotLeader
+	}
+
+	d.syncMu.Lock()
+	defer d.syncMu.Unlock()
+
+	run := d.startRun(trigger)
+	report, err := d.manager.SyncItemByName(name)
+
+	var reports []*csync.SyncReport
+	if report != nil {
+		reports = append(reports, report)
+	}
+	return d.finishRun(run, reports, err), nil
+}
+
+// LatestRun returns a copy of the most recently started run
+func (d *Daemon) LatestRun() (Run, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.runs) == 0 {
+		return Run{}, false
+	}
+	return *d.runs[len(d.runs)-1], true
+}
+
+// Runs returns copies of the retained runs, oldest first
+func (d *Daemon) Runs() []Run {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	runs := make([]Run, len(d.runs))
+	for i, run := range d.runs {
+		runs[i] = *run
+	}
+	return runs
+}
+
+func (d *Daemon) startRun(trigger string) *Run {
+	d.mu.Lock()
+	d.nextID++
+	run := &Run{
+		ID:      strconv.Itoa(d.nextID),
+		Trigger: trigger,
+		Started: d.manager.Now(),
+	}
+
+	d.runs = append(d.runs, run)
+	if len(d.runs) > maxRuns {
+		d.runs = d.runs[len(d.runs)-maxRuns:]
+	}
+	d.mu.Unlock()
+
+	d.current = run
+	d.publish(Event{Type: EventRunStarted, RunID: run.ID, Time: run.Started})
+
+	return run
+}
+
+func (d *Daemon) finishRun(run *Run, reports []*csync.SyncReport, err error) Run {
+	d.mu.Lock()
+	run.Finished = d.manager.Now()
+	run.Reports = reports
+	for _, report := range reports {
+		run.Items = append(run.Items, Summarize(report))
+	}
+	run.Summary = csync.SummarizeRun(reports)
+	if err != nil {
+		run.Error = err.Error()
+	}
+	finished := *run
+	d.mu.Unlock()
+
+	d.current = nil
+	d.publish(Event{Type: EventRunFinished, RunID: run.ID, Time: run.Finished})
+
+	// Whatever triggered a sync, the item's next poll counts from it
+	if d.scheduler != nil {
+		for _, report := range reports {
+			d.scheduler.Observe(report, finished.Finished)
+		}
+	}
+
+	return finished
+}
+
+// Summarize converts a sync report into its machine-readable form
+func Summarize(report *csync.SyncReport) ReportSummary {
+	summary := ReportSummary{
+		Item:         report.SyncItem.Name,
+		ID:           report.SyncItem.ID(),
+		UpdatedFiles: report.UpdatedFiles,
+		CreatedFiles: report.CreatedFiles,
+		DeletedFiles: report.DeletedFiles,
+		Errors:       report.Errors,
+		Conflict:     report.Conflict,
+		Failure:      string(report.Failure),
+		Deferred:     report.Deferred,
+		Recovered:    report.Recovered,
+		Relocated:    report.Relocated,
+		Breaking:     report.Breaking,
+		Rollout:      report.Rollout,
+		Violations:   report.Violations,
+		Endpoints:    report.Endpoints,
+		Stale:        report.Stale,
+		Warnings:     report.Warnings,
+		Owners:       report.Owners,
+		Owner:        report.SyncItem.Owner,
+		Contacts:     report.SyncItem.Contacts,
+	}
+
+	for path, d := range report.Diffs {
+		if summary.Diffs == nil {
+			summary.Diffs = make(map[string]string)
+		}
+		summary.Diffs[path] = diff.FormatDiff(d, false)
+	}
+
+	return summary
+}
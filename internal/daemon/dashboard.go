@@ -0,0 +1,20 @@
+package daemon
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// dashboardHandler serves the embedded web dashboard, a static page that
+// talks to the JSON API
+func dashboardHandler() http.Handler {
+	root, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServerFS(root)
+}
@@ -0,0 +1,116 @@
+"use strict";
+
+// Items that haven't synced for this long are shown as stale
+const STALE_MS = 24 * 60 * 60 * 1000;
+
+// A daemon started with an API token is opened as .../#token=<token>
+const TOKEN = new URLSearchParams(location.hash.slice(1)).get("token");
+
+function api(path, options) {
+  const headers = TOKEN ? { Authorization: `Bearer ${TOKEN}` } : {};
+  return fetch(path, { ...options, headers });
+}
+
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  Object.assign(node, attrs || {});
+  for (const child of children) {
+    node.append(child instanceof Node ? child : document.createTextNode(child ?? ""));
+  }
+  return node;
+}
+
+function itemStatus(item) {
+  if (item.disabled) return ["disabled", "disabled"];
+  if (!item.state) return ["unknown", "never synced"];
+  if (item.conflict) return ["conflict", "conflict"];
+  if (item.state.failing) return ["failing", "failing"];
+  if (Date.now() - new Date(item.state.lastSync) > STALE_MS) return ["stale", "stale"];
+  return ["ok", "up to date"];
+}
+
+function formatTime(value) {
+  const time = new Date(value);
+  return isNaN(time) || time.getFullYear() < 2000 ? "-" : time.toLocaleString();
+}
+
+async function syncItem(name, button) {
+  button.disabled = true;
+  button.textContent = "Syncing…";
+  try {
+    await api(`items/${encodeURIComponent(name)}/sync`, { method: "POST" });
+  } finally {
+    await refresh();
+  }
+}
+
+function renderItems(items) {
+  const body = document.getElementById("items");
+  body.replaceChildren(...items.map((item) => {
+    const [cls, label] = itemStatus(item);
+    const button = el("button", { textContent: "Sync", disabled: item.disabled });
+    button.addEventListener("click", () => syncItem(item.name, button));
+
+    return el("tr", null,
+      el("td", { title: item.description || "" }, item.name),
+      el("td", null, item.source),
+      el("td", null, item.target),
+      el("td", null, item.state ? formatTime(item.state.lastSync) : "-"),
+      el("td", null, el("span", { className: `badge ${cls}` }, label)),
+      el("td", null, button));
+  }));
+}
+
+function renderDiff(text) {
+  const pre = el("pre");
+  for (const line of text.split("\n")) {
+    const cls = line.startsWith("+") ? "add" : line.startsWith("-") ? "del" : "";
+    pre.append(el("span", { className: cls }, line + "\n"));
+  }
+  return pre;
+}
+
+function renderRuns(runs) {
+  const container = document.getElementById("runs");
+  if (runs.length === 0) {
+    container.replaceChildren(el("p", null, "No runs yet."));
+    return;
+  }
+
+  container.replaceChildren(...runs.map((run) => {
+    const items = run.items || [];
+    const failed = items.filter((i) => (i.errors || []).length > 0).length;
+    const updated = items.filter((i) => (i.updatedFiles || []).length > 0).length;
+
+    const details = el("details", { className: "run" },
+      el("summary", null,
+        `#${run.id} · ${formatTime(run.started)} · ${run.trigger} · ` +
+        `${items.length} items, ${updated} updated, ${failed} failed`));
+
+    if (run.error) details.append(el("p", { className: "error" }, run.error));
+
+    for (const item of items) {
+      details.append(el("h4", null, item.item + (item.conflict ? " (conflict)" : "")));
+      for (const error of item.errors || []) {
+        details.append(el("p", { className: "error" }, error));
+      }
+      for (const [path, diff] of Object.entries(item.diffs || {})) {
+        details.append(el("p", null, path), renderDiff(diff));
+      }
+    }
+    return details;
+  }));
+}
+
+async function refresh() {
+  const [items, runs] = await Promise.all([
+    api("items").then((r) => r.json()),
+    api("runs").then((r) => r.json()),
+  ]);
+  renderItems(items);
+  renderRuns(runs);
+  document.getElementById("updated").textContent = `Updated ${new Date().toLocaleTimeString()}`;
+}
+
+refresh();
+setInterval(refresh, 30000);
@@ -0,0 +1,158 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+
+	"github.com/exitflynn/codesync/internal/controlpb"
+	csync "github.com/exitflynn/codesync/internal/sync"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+//go:generate sh -c "cd ../.. && buf generate"
+
+// controlServer implements the gRPC control service on top of a daemon
+type controlServer struct {
+	controlpb.UnimplementedControlServer
+	daemon *Daemon
+}
+
+// RegisterGRPC registers the daemon's control service on a gRPC server
+func (d *Daemon) RegisterGRPC(server *grpc.Server) {
+	controlpb.RegisterControlServer(server, &controlServer{daemon: d})
+}
+
+func (s *controlServer) Health(ctx context.Context, req *controlpb.HealthRequest) (*controlpb.HealthResponse, error) {
+	return &controlpb.HealthResponse{Status: "ok"}, nil
+}
+
+func (s *controlServer) ListItems(ctx context.Context, req *controlpb.ListItemsRequest) (*controlpb.ListItemsResponse, error) {
+	resp := &controlpb.ListItemsResponse{}
+	for _, item := range s.daemon.manager.Items() {
+		resp.Items = append(resp.Items, itemToProto(s.daemon.itemStatus(item)))
+	}
+	return resp, nil
+}
+
+func (s *controlServer) GetItem(ctx context.Context, req *controlpb.GetItemRequest) (*controlpb.Item, error) {
+	item, ok := s.daemon.manager.Item(req.GetName())
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "%v: %s", csync.ErrUnknownItem, req.GetName())
+	}
+	return itemToProto(s.daemon.itemStatus(item)), nil
+}
+
+func (s *controlServer) GetLatestRun(ctx context.Context, req *controlpb.GetLatestRunRequest) (*controlpb.Run, error) {
+	run, ok := s.daemon.LatestRun()
+	if !ok {
+		return nil, status.Error(codes.NotFound, "no runs yet")
+	}
+	return runToProto(run), nil
+}
+
+func (s *controlServer) SyncItem(ctx context.Context, req *controlpb.SyncItemRequest) (*controlpb.Run, error) {
+	run, err := s.daemon.SyncItem(req.GetName(), "grpc")
+	if errors.Is(err, ErrNotLeader) {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if errors.Is(err, csync.ErrUnknownItem) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return runToProto(run), nil
+}
+
+func (s *controlServer) WatchEvents(req *controlpb.WatchEventsRequest, stream grpc.ServerStreamingServer[controlpb.SyncEvent]) error {
+	events, cancel := s.daemon.Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case e := <-events:
+			if err := stream.Send(eventToProto(e)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func itemToProto(s ItemStatus) *controlpb.Item {
+	item := &controlpb.Item{
+		Name:        s.Name,
+		Id:          s.ID,
+		Description: s.Description,
+		Disabled:    s.Disabled,
+		Tags:        s.Tags,
+		Source:      s.Source,
+		Target:      s.Target,
+		Type:        s.Type,
+	}
+
+	if s.State != nil {
+		item.State = &controlpb.ItemState{
+			LastSync:         timestamppb.New(s.State.LastSync),
+			LastCommitId:     s.State.LastCommitID,
+			HasLocalChanges:  s.State.HasLocalChanges,
+			HasRemoteChanges: s.State.HasRemoteChanges,
+			Failing:          s.State.Failing,
+		}
+	}
+
+	return item
+}
+
+func runToProto(r Run) *controlpb.Run {
+	run := &controlpb.Run{
+		Id:       r.ID,
+		Trigger:  r.Trigger,
+		Started:  timestamppb.New(r.Started),
+		Finished: timestamppb.New(r.Finished),
+		Error:    r.Error,
+	}
+
+	for _, summary := range r.Items {
+		run.Items = append(run.Items, summaryToProto(summary))
+	}
+
+	return run
+}
+
+func summaryToProto(s ReportSummary) *controlpb.ReportSummary {
+	return &controlpb.ReportSummary{
+		Item:         s.Item,
+		Id:           s.ID,
+		UpdatedFiles: s.UpdatedFiles,
+		Errors:       s.Errors,
+		Conflict:     s.Conflict,
+		Recovered:    s.Recovered,
+	}
+}
+
+func eventToProto(e Event) *controlpb.SyncEvent {
+	event := &controlpb.SyncEvent{
+		RunId: e.RunID,
+		Time:  timestamppb.New(e.Time),
+	}
+
+	switch e.Type {
+	case EventRunStarted:
+		event.Type = controlpb.SyncEvent_TYPE_RUN_STARTED
+	case EventItemSynced:
+		event.Type = controlpb.SyncEvent_TYPE_ITEM_SYNCED
+	case EventRunFinished:
+		event.Type = controlpb.SyncEvent_TYPE_RUN_FINISHED
+	}
+
+	if e.Report != nil {
+		event.Report = summaryToProto(*e.Report)
+	}
+
+	return event
+}
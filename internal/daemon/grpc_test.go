@@ -0,0 +1,104 @@
+package daemon
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/controlpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestGRPCClient(t *testing.T, d *Daemon, opts ...grpc.ServerOption) controlpb.ControlClient {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(opts...)
+	d.RegisterGRPC(server)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return controlpb.NewControlClient(conn)
+}
+
+func TestGRPCControl(t *testing.T) {
+	d := newTestDaemon(t)
+	client := newTestGRPCClient(t, d)
+	ctx := context.Background()
+
+	health, err := client.Health(ctx, &controlpb.HealthRequest{})
+	if err != nil || health.GetStatus() != "ok" {
+		t.Errorf("Unexpected health response: %v %v", health, err)
+	}
+
+	items, err := client.ListItems(ctx, &controlpb.ListItemsRequest{})
+	if err != nil {
+		t.Fatalf("ListItems failed: %v", err)
+	}
+	if len(items.GetItems()) != 1 || items.GetItems()[0].GetName() != "logger" || items.GetItems()[0].GetId() == "" {
+		t.Errorf("Unexpected items: %v", items.GetItems())
+	}
+
+	_, err = client.GetItem(ctx, &controlpb.GetItemRequest{Name: "missing"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound for unknown item, got %v", err)
+	}
+
+	_, err = client.GetLatestRun(ctx, &controlpb.GetLatestRunRequest{})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound before any run, got %v", err)
+	}
+
+	_, err = client.SyncItem(ctx, &controlpb.SyncItemRequest{Name: "missing"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Expected NotFound syncing unknown item, got %v", err)
+	}
+}
+
+func TestGRPCWatchEvents(t *testing.T) {
+	d := newTestDaemon(t)
+	client := newTestGRPCClient(t, d)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchEvents(ctx, &controlpb.WatchEventsRequest{})
+	if err != nil {
+		t.Fatalf("WatchEvents failed: %v", err)
+	}
+
+	// Wait for the subscription to be registered before publishing
+	for {
+		d.mu.Lock()
+		n := len(d.subscribers)
+		d.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	d.publish(Event{Type: EventItemSynced, RunID: "7", Time: time.Now(), Report: &ReportSummary{Item: "logger", Conflict: true}})
+
+	event, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv failed: %v", err)
+	}
+	if event.GetType() != controlpb.SyncEvent_TYPE_ITEM_SYNCED || event.GetRunId() != "7" || !event.GetReport().GetConflict() {
+		t.Errorf("Unexpected event: %v", event)
+	}
+}
@@ -0,0 +1,44 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	base := time.Date(2025, 3, 14, 10, 30, 0, 0, time.UTC) // A Friday
+
+	tests := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"15m", base.Add(15 * time.Minute)},
+		{"0 0 * * *", time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2025, 3, 14, 10, 40, 0, 0, time.UTC)},
+		{"0 */12 * * *", time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2025, 3, 17, 9, 30, 0, 0, time.UTC)},
+		{"0 8 1 * *", time.Date(2025, 4, 1, 8, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2025, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 6,18 * 3 *", time.Date(2025, 3, 14, 18, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		schedule, err := ParseSchedule(tt.spec)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q) failed: %v", tt.spec, err)
+			continue
+		}
+
+		if next := schedule.Next(base); !next.Equal(tt.expected) {
+			t.Errorf("%q: expected next run %v, got %v", tt.spec, tt.expected, next)
+		}
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "a b c d e", "-5m"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
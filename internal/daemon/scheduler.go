@@ -0,0 +1,210 @@
+package daemon
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	csync "github.com/exitflynn/codesync/internal/sync"
+)
+
+// defaultIntervals are the poll intervals of the priority classes unless the
+// config sets them
+var defaultIntervals = map[string]time.Duration{
+	config.PriorityCritical: 15 * time.Minute,
+	config.PriorityNormal:   time.Hour,
+	config.PriorityLow:      6 * time.Hour,
+}
+
+// priorityRank orders the classes from most to least urgent
+var priorityRank = map[string]int{
+	config.PriorityCritical: 0,
+	config.PriorityNormal:   1,
+	config.PriorityLow:      2,
+}
+
+// maxStretch is how often an adaptive interval doubles at most, so that a
+// dormant upstream is still polled every 8 intervals
+const maxStretch = 3
+
+// maxTighten is how often an adaptive interval halves at most, so that a busy
+// upstream is polled no more than 4 times as often as its class
+const maxTighten = 2
+
+// Scheduler plans when the daemon polls each item: items poll at the
+// interval of their priority class plus a random jitter, so that they drift
+// apart rather than hitting the API together, and no more than a number of
+// items poll per minute
+type Scheduler struct {
+	intervals    map[string]time.Duration
+	jitter       time.Duration
+	maxPerMinute int
+	adaptive     bool
+	rand         func(n int64) int64 // Returns a number in [0, n)
+
+	mu     sync.Mutex
+	next   map[string]time.Time   // When each item is due; unplanned items are due now
+	states map[string]csync.State // Each item's state as of its last successful sync
+	polls  []time.Time            // Polls started in the last minute
+}
+
+// NewScheduler creates a scheduler from the daemon's config
+func NewScheduler(cfg *config.SchedulerConfig) (*Scheduler, error) {
+	s := &Scheduler{
+		intervals:    make(map[string]time.Duration, len(defaultIntervals)),
+		maxPerMinute: cfg.MaxPollsPerMinute,
+		adaptive:     cfg.Adaptive,
+		rand:         rand.Int64N,
+		next:         make(map[string]time.Time),
+		states:       make(map[string]csync.State),
+	}
+	for class, d := range defaultIntervals {
+		s.intervals[class] = d
+	}
+	for class, interval := range cfg.Intervals {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval for %s items: %w", class, err)
+		}
+		s.intervals[class] = d
+	}
+	if cfg.Jitter != "" {
+		d, err := time.ParseDuration(cfg.Jitter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jitter: %w", err)
+		}
+		s.jitter = d
+	}
+	return s, nil
+}
+
+// priority returns the class of an item
+func priority(item config.SyncItem) string {
+	if item.Priority == "" {
+		return config.PriorityNormal
+	}
+	return item.Priority
+}
+
+// Interval returns how long an item with the given state waits between
+// polls, before jitter. Adaptive schedules learn it from the upstream
+// activity in the state: each sync in a row that found no upstream change
+// doubles the interval of the item's class, and while upstream keeps
+// changing, the interval shrinks to the average time between its changes.
+func (s *Scheduler) Interval(item config.SyncItem, state csync.State) time.Duration {
+	d := s.intervals[priority(item)]
+	if !s.adaptive {
+		return d
+	}
+	if state.QuietSyncs > 0 {
+		return d << min(state.QuietSyncs, maxStretch)
+	}
+	if changes := state.ChangeInterval(); changes > 0 && changes < d {
+		return max(changes, d>>maxTighten)
+	}
+	return d
+}
+
+// plan schedules an item's next poll an interval plus jitter after now
+func (s *Scheduler) plan(item config.SyncItem, now time.Time) {
+	next := now.Add(s.Interval(item, s.states[item.Name]))
+	if s.jitter > 0 {
+		next = next.Add(time.Duration(s.rand(int64(s.jitter))))
+	}
+	s.next[item.Name] = next
+}
+
+// Due returns the names of the enabled items due at now, most urgent first,
+// as many as the polling rate allows, and plans their next poll
+func (s *Scheduler) Due(items []config.SyncItem, now time.Time) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []config.SyncItem
+	for _, item := range items {
+		if next, ok := s.next[item.Name]; !item.Disabled && (!ok || !next.After(now)) {
+			due = append(due, item)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		a, b := due[i], due[j]
+		if ra, rb := priorityRank[priority(a)], priorityRank[priority(b)]; ra != rb {
+			return ra < rb
+		}
+		return s.next[a.Name].Before(s.next[b.Name])
+	})
+
+	if s.maxPerMinute > 0 {
+		s.expirePolls(now)
+		due = due[:min(len(due), max(s.maxPerMinute-len(s.polls), 0))]
+	}
+
+	names := make([]string, len(due))
+	for i, item := range due {
+		names[i] = item.Name
+		s.polls = append(s.polls, now)
+		s.plan(item, now)
+	}
+	return names
+}
+
+// Wake returns when Due may next return items: when the first item is due,
+// or later if the polling rate doesn't allow more polls by then
+func (s *Scheduler) Wake(items []config.SyncItem, now time.Time) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var wake time.Time
+	for _, item := range items {
+		if item.Disabled {
+			continue
+		}
+		next, ok := s.next[item.Name]
+		if !ok {
+			next = now
+		}
+		if wake.IsZero() || next.Before(wake) {
+			wake = next
+		}
+	}
+	// Without items, look again in case they are added
+	if wake.IsZero() {
+		wake = now.Add(s.intervals[config.PriorityNormal])
+	}
+
+	if s.maxPerMinute > 0 {
+		s.expirePolls(now)
+		if len(s.polls) >= s.maxPerMinute {
+			if allowed := s.polls[len(s.polls)-s.maxPerMinute].Add(time.Minute); allowed.After(wake) {
+				wake = allowed
+			}
+		}
+	}
+	return wake
+}
+
+// expirePolls forgets polls more than a minute before now
+func (s *Scheduler) expirePolls(now time.Time) {
+	i := 0
+	for i < len(s.polls) && !s.polls[i].After(now.Add(-time.Minute)) {
+		i++
+	}
+	s.polls = s.polls[i:]
+}
+
+// Observe plans an item's next poll after it synced, however the sync was
+// triggered, learning its upstream activity from the report's state. Failed
+// syncs say nothing about upstream, so the last state is kept.
+func (s *Scheduler) Observe(report *csync.SyncReport, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item := report.SyncItem
+	if len(report.Errors) == 0 && !report.Deferred {
+		s.states[item.Name] = report.State
+	}
+	s.plan(item, now)
+}
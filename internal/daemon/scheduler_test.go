@@ -0,0 +1,103 @@
+package daemon
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	csync "github.com/exitflynn/codesync/internal/sync"
+)
+
+func schedulerItems() []config.SyncItem {
+	return []config.SyncItem{
+		{Name: "docs", Priority: config.PriorityLow},
+		{Name: "logger"},
+		{Name: "auth", Priority: config.PriorityCritical},
+		{Name: "old", Disabled: true},
+	}
+}
+
+func TestSchedulerDue(t *testing.T) {
+	s, err := NewScheduler(&config.SchedulerConfig{
+		Intervals: map[string]string{"critical": "5m"},
+		Jitter:    "1m",
+	})
+	if err != nil {
+		t.Fatalf("NewScheduler failed: %v", err)
+	}
+	s.rand = func(n int64) int64 { return n / 2 }
+	items := schedulerItems()
+	now := time.Date(2025, 3, 14, 10, 0, 0, 0, time.UTC)
+
+	// Unplanned items are due at once, most urgent first
+	if due := s.Due(items, now); !reflect.DeepEqual(due, []string{"auth", "logger", "docs"}) {
+		t.Fatalf("Expected all enabled items by priority, got %v", due)
+	}
+	if due := s.Due(items, now); len(due) != 0 {
+		t.Errorf("Expected planned items not to be due again, got %v", due)
+	}
+
+	// Each class polls at its interval plus jitter
+	if wake := s.Wake(items, now); !wake.Equal(now.Add(5*time.Minute + 30*time.Second)) {
+		t.Errorf("Expected to wake for the critical item, got %v", wake)
+	}
+	later := now.Add(time.Hour + 30*time.Second)
+	if due := s.Due(items, later); !reflect.DeepEqual(due, []string{"auth", "logger"}) {
+		t.Errorf("Expected the critical and normal items after an hour, got %v", due)
+	}
+}
+
+func TestSchedulerRateLimit(t *testing.T) {
+	s, err := NewScheduler(&config.SchedulerConfig{MaxPollsPerMinute: 2})
+	if err != nil {
+		t.Fatalf("NewScheduler failed: %v", err)
+	}
+	items := schedulerItems()
+	now := time.Date(2025, 3, 14, 10, 0, 0, 0, time.UTC)
+
+	if due := s.Due(items, now); !reflect.DeepEqual(due, []string{"auth", "logger"}) {
+		t.Fatalf("Expected the two most urgent items, got %v", due)
+	}
+	if due := s.Due(items, now.Add(30*time.Second)); len(due) != 0 {
+		t.Errorf("Expected no polls until the minute is over, got %v", due)
+	}
+	if wake := s.Wake(items, now.Add(30*time.Second)); !wake.Equal(now.Add(time.Minute)) {
+		t.Errorf("Expected to wake when the rate allows, got %v", wake)
+	}
+	if due := s.Due(items, now.Add(time.Minute)); !reflect.DeepEqual(due, []string{"docs"}) {
+		t.Errorf("Expected the waiting item a minute later, got %v", due)
+	}
+}
+
+func TestSchedulerAdaptive(t *testing.T) {
+	s, err := NewScheduler(&config.SchedulerConfig{Adaptive: true})
+	if err != nil {
+		t.Fatalf("NewScheduler failed: %v", err)
+	}
+	item := config.SyncItem{Name: "logger"}
+	now := time.Date(2025, 3, 14, 10, 0, 0, 0, time.UTC)
+
+	if got := s.Interval(item, csync.State{QuietSyncs: 5}); got != 8*time.Hour {
+		t.Errorf("Expected a dormant upstream to stretch to 8 intervals, got %v", got)
+	}
+	busy := csync.State{UpstreamChanges: []time.Time{now, now.Add(-20 * time.Minute), now.Add(-40 * time.Minute)}}
+	if got := s.Interval(item, busy); got != 20*time.Minute {
+		t.Errorf("Expected a busy upstream to be polled as often as it changes, got %v", got)
+	}
+	busy.UpstreamChanges = []time.Time{now, now.Add(-time.Minute)}
+	if got := s.Interval(item, busy); got != 15*time.Minute {
+		t.Errorf("Expected the interval to shrink to a quarter at most, got %v", got)
+	}
+
+	s.Observe(&csync.SyncReport{SyncItem: item, State: csync.State{QuietSyncs: 2}}, now)
+	if wake := s.Wake([]config.SyncItem{item}, now); !wake.Equal(now.Add(4 * time.Hour)) {
+		t.Errorf("Expected the next poll a learned interval after the sync, got %v", wake)
+	}
+
+	// A failed sync says nothing about upstream
+	s.Observe(&csync.SyncReport{SyncItem: item, Errors: []string{"timeout"}}, now)
+	if wake := s.Wake([]config.SyncItem{item}, now); !wake.Equal(now.Add(4 * time.Hour)) {
+		t.Errorf("Expected errors to keep the interval, got %v", wake)
+	}
+}
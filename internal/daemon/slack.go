@@ -0,0 +1,220 @@
+package daemon
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// slackMaxSkew is how old a signed Slack request may be before it is
+// rejected as a possible replay
+const slackMaxSkew = 5 * time.Minute
+
+const slackHelp = "Usage:\n" +
+	"• `/codesync status` – list all items\n" +
+	"• `/codesync status <item>` – show one item\n" +
+	"• `/codesync sync <item>` – sync one item now"
+
+// slackResponse is the message body returned to Slack
+type slackResponse struct {
+	ResponseType string `json:"response_type"` // "ephemeral" or "in_channel"
+	Text         string `json:"text"`
+}
+
+// SlackHandler returns an endpoint for Slack slash commands such as
+// `/codesync status` and `/codesync sync <item>`. Requests are authenticated
+// with the app's signing secret. Syncs run in the background and post their
+// result to the command's response URL, since Slack expects an answer within
+// three seconds.
+func (d *Daemon) SlackHandler(signingSecret string) http.Handler {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if err := verifySlackSignature(signingSecret, r.Header, body, d.manager.Now()); err != nil {
+			writeError(w, http.StatusUnauthorized, err)
+			return
+		}
+
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		args := strings.Fields(form.Get("text"))
+		if len(args) == 0 {
+			writeJSON(w, http.StatusOK, slackResponse{ResponseType: "ephemeral", Text: slackHelp})
+			return
+		}
+
+		switch {
+		case args[0] == "status" && len(args) == 1:
+			writeJSON(w, http.StatusOK, slackResponse{ResponseType: "ephemeral", Text: d.slackStatusAll()})
+
+		case args[0] == "status" && len(args) == 2:
+			item, ok := d.manager.Item(args[1])
+			if !ok {
+				writeJSON(w, http.StatusOK, slackResponse{ResponseType: "ephemeral", Text: fmt.Sprintf("Unknown sync item: %s", args[1])})
+				return
+			}
+			writeJSON(w, http.StatusOK, slackResponse{ResponseType: "ephemeral", Text: formatSlackStatus(d.itemStatus(item))})
+
+		case args[0] == "sync" && len(args) == 2:
+			name := args[1]
+			if _, ok := d.manager.Item(name); !ok {
+				writeJSON(w, http.StatusOK, slackResponse{ResponseType: "ephemeral", Text: fmt.Sprintf("Unknown sync item: %s", name)})
+				return
+			}
+			if !d.Leader() {
+				writeJSON(w, http.StatusOK, slackResponse{ResponseType: "ephemeral", Text: ErrNotLeader.Error()})
+				return
+			}
+
+			trigger := "slack"
+			if user := form.Get("user_name"); user != "" {
+				trigger = "slack:" + user
+			}
+
+			responseURL := form.Get("response_url")
+			go func() {
+				run, err := d.SyncItem(name, trigger)
+				text := formatSlackRun(run)
+				if err != nil {
+					text = err.Error()
+				}
+				if responseURL == "" {
+					return
+				}
+				if err := postSlackResponse(client, responseURL, slackResponse{ResponseType: "in_channel", Text: text}); err != nil {
+					log.Printf("failed to post Slack response: %v", err)
+				}
+			}()
+
+			writeJSON(w, http.StatusOK, slackResponse{ResponseType: "in_channel", Text: fmt.Sprintf("Syncing %s…", name)})
+
+		default:
+			writeJSON(w, http.StatusOK, slackResponse{ResponseType: "ephemeral", Text: slackHelp})
+		}
+	})
+}
+
+// verifySlackSignature checks the X-Slack-Signature header, an HMAC-SHA256
+// of "v0:<timestamp>:<body>" keyed with the signing secret
+func verifySlackSignature(secret string, header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	signature := header.Get("X-Slack-Signature")
+	if timestamp == "" || signature == "" {
+		return fmt.Errorf("missing Slack signature headers")
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid Slack request timestamp: %s", timestamp)
+	}
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > slackMaxSkew || skew < -slackMaxSkew {
+		return fmt.Errorf("Slack request timestamp is too old")
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(slackSignature(secret, timestamp, body))) {
+		return fmt.Errorf("invalid Slack signature")
+	}
+
+	return nil
+}
+
+// slackSignature computes the expected X-Slack-Signature value
+func slackSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *Daemon) slackStatusAll() string {
+	var lines []string
+	for _, item := range d.manager.Items() {
+		lines = append(lines, formatSlackStatus(d.itemStatus(item)))
+	}
+	if len(lines) == 0 {
+		return "No sync items configured"
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatSlackStatus renders an item as a single line of Slack markup
+func formatSlackStatus(s ItemStatus) string {
+	state := "never synced"
+	switch {
+	case s.Disabled:
+		state = "disabled"
+	case s.State == nil:
+	case s.Conflict:
+		state = "conflict"
+	case s.State.Failing:
+		state = "failing"
+	default:
+		state = "ok"
+	}
+
+	line := fmt.Sprintf("*%s* (%s → %s): %s", s.Name, s.Source, s.Target, state)
+	if s.State != nil && !s.State.LastSync.IsZero() {
+		line += fmt.Sprintf(", last synced %s", s.State.LastSync.Format(time.RFC3339))
+	}
+	return line
+}
+
+// formatSlackRun renders the outcome of a triggered sync
+func formatSlackRun(run Run) string {
+	if run.Error != "" && len(run.Items) == 0 {
+		return fmt.Sprintf("Sync failed: %s", run.Error)
+	}
+
+	var lines []string
+	for _, item := range run.Items {
+		switch {
+		case len(item.Errors) > 0:
+			lines = append(lines, fmt.Sprintf("✗ *%s*: %s", item.Item, strings.Join(item.Errors, "; ")))
+		case item.Conflict:
+			lines = append(lines, fmt.Sprintf("⚠ *%s*: conflicting local and upstream changes", item.Item))
+		case len(item.UpdatedFiles) > 0:
+			lines = append(lines, fmt.Sprintf("↻ *%s*: updated %s", item.Item, strings.Join(item.UpdatedFiles, ", ")))
+		default:
+			lines = append(lines, fmt.Sprintf("✓ *%s*: up to date", item.Item))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func postSlackResponse(client *http.Client, responseURL string, msg slackResponse) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(responseURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Slack returned status code %d", resp.StatusCode)
+	}
+	return nil
+}
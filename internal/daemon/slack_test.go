@@ -0,0 +1,77 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlackHandler(t *testing.T) {
+	const secret = "signing-secret"
+	server := httptest.NewServer(newTestDaemon(t).SlackHandler(secret))
+	defer server.Close()
+
+	command := func(text string, sign func(req *http.Request, body string)) (int, slackResponse) {
+		body := url.Values{"command": {"/codesync"}, "text": {text}}.Encode()
+		req, _ := http.NewRequest("POST", server.URL, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		sign(req, body)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var msg slackResponse
+		json.NewDecoder(resp.Body).Decode(&msg)
+		return resp.StatusCode, msg
+	}
+
+	signed := func(req *http.Request, body string) {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Slack-Request-Timestamp", ts)
+		req.Header.Set("X-Slack-Signature", slackSignature(secret, ts, []byte(body)))
+	}
+
+	status, msg := command("status", signed)
+	if status != http.StatusOK || !strings.Contains(msg.Text, "*logger*") || !strings.Contains(msg.Text, "never synced") {
+		t.Errorf("Unexpected status response: %d %+v", status, msg)
+	}
+
+	status, msg = command("status logger", signed)
+	if status != http.StatusOK || !strings.Contains(msg.Text, "acme/utils/logger.go@main") {
+		t.Errorf("Unexpected item status response: %d %+v", status, msg)
+	}
+
+	if _, msg = command("sync missing", signed); !strings.Contains(msg.Text, "Unknown sync item") {
+		t.Errorf("Expected unknown item message, got %+v", msg)
+	}
+
+	if _, msg = command("", signed); msg.Text != slackHelp {
+		t.Errorf("Expected help text, got %+v", msg)
+	}
+
+	status, _ = command("status", func(req *http.Request, body string) {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Slack-Request-Timestamp", ts)
+		req.Header.Set("X-Slack-Signature", slackSignature("wrong-secret", ts, []byte(body)))
+	})
+	if status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for bad signature, got %d", status)
+	}
+
+	status, _ = command("status", func(req *http.Request, body string) {
+		ts := strconv.FormatInt(time.Now().Add(-10*time.Minute).Unix(), 10)
+		req.Header.Set("X-Slack-Request-Timestamp", ts)
+		req.Header.Set("X-Slack-Signature", slackSignature(secret, ts, []byte(body)))
+	})
+	if status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for stale request, got %d", status)
+	}
+}
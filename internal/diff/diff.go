@@ -1,14 +1,19 @@
 package diff
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
+// ErrPatchFailed is returned when some hunks of a patch don't apply
+var ErrPatchFailed = errors.New("failed to apply some patches")
+
 // DiffResult represents the difference between two files
 type DiffResult struct {
 	Original string
@@ -23,6 +28,23 @@ type DiffHunk struct {
 	Content   string
 	Added     bool
 	Removed   bool
+	Blame     []*Attribution // Optional upstream authorship per line of an added hunk
+}
+
+// Attribution records who last changed a line upstream
+type Attribution struct {
+	Author string
+	Commit string
+	Date   time.Time
+}
+
+// String renders the attribution as "author, commit, date"
+func (a *Attribution) String() string {
+	commit := a.Commit
+	if len(commit) > 7 {
+		commit = commit[:7]
+	}
+	return fmt.Sprintf("%s, %s, %s", a.Author, commit, a.Date.Format("2006-01-02"))
 }
 
 // DiffStats contains statistics about the differences
@@ -100,22 +122,66 @@ func GenerateUnifiedDiff(original, updated, originalName, updatedName string) st
 	return dmp.PatchToText(patches)
 }
 
+// Delta encodes the line changes from original to updated compactly, for
+// storing a version as a change to the previous one. Undelta reverses it.
+func Delta(original, updated string) string {
+	dmp := diffmatchpatch.New()
+	a, b, lines := dmp.DiffLinesToChars(original, updated)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(a, b, false), lines)
+	return dmp.DiffToDelta(diffs)
+}
+
+// Undelta reconstructs the text a delta from Delta was made for, given the
+// original it was made from
+func Undelta(original, delta string) (string, error) {
+	dmp := diffmatchpatch.New()
+	diffs, err := dmp.DiffFromDelta(original, delta)
+	if err != nil {
+		return "", fmt.Errorf("invalid delta: %w", err)
+	}
+	return dmp.DiffText2(diffs), nil
+}
+
 // ApplyDiff applies the changes from a DiffResult to a string
 func ApplyDiff(original string, result *DiffResult) (string, error) {
+	return applyPatches(original, func(dmp *diffmatchpatch.DiffMatchPatch) []diffmatchpatch.Patch {
+		return dmp.PatchMake(original, result.Updated)
+	})
+}
+
+// applyPatches applies the patches makePatches returns to text, failing if
+// any of them doesn't apply. go-diff panics on some malformed patches and on
+// text that isn't valid UTF-8, which upstream files may be, so its panics
+// fail the same way.
+func applyPatches(text string, makePatches func(*diffmatchpatch.DiffMatchPatch) []diffmatchpatch.Patch) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = "", fmt.Errorf("%w: %v", ErrPatchFailed, r)
+		}
+	}()
+
 	dmp := diffmatchpatch.New()
-	patches := dmp.PatchMake(original, result.Updated)
-	newText, successes := dmp.PatchApply(patches, original)
+	newText, successes := dmp.PatchApply(makePatches(dmp), text)
 
 	// Check if all patches were applied
 	for _, success := range successes {
 		if !success {
-			return "", fmt.Errorf("failed to apply some patches")
+			return "", ErrPatchFailed
 		}
 	}
 
 	return newText, nil
 }
 
+// Rebase carries the change from base to updated over to target, a locally
+// modified copy of base. It fails if any part of the change doesn't apply,
+// e.g. because target changed the same lines.
+func Rebase(base, updated, target string) (string, error) {
+	return applyPatches(target, func(dmp *diffmatchpatch.DiffMatchPatch) []diffmatchpatch.Patch {
+		return dmp.PatchMake(base, updated)
+	})
+}
+
 // ApplyPatch applies a patch in unified diff format to a file
 func ApplyPatch(filePath, patch string) error {
 	// Read the original file
@@ -131,13 +197,11 @@ func ApplyPatch(filePath, patch string) error {
 		return fmt.Errorf("error parsing patch: %w", err)
 	}
 
-	newText, successes := dmp.PatchApply(patches, string(content))
-
-	// Check if all patches were applied
-	for _, success := range successes {
-		if !success {
-			return fmt.Errorf("failed to apply some patches")
-		}
+	newText, err := applyPatches(string(content), func(*diffmatchpatch.DiffMatchPatch) []diffmatchpatch.Patch {
+		return patches
+	})
+	if err != nil {
+		return err
 	}
 
 	// Write the patched content back to the file
@@ -149,6 +213,35 @@ func CompareFunctions(oldFunc, newFunc string) *DiffResult {
 	return GenerateDiff(oldFunc, newFunc)
 }
 
+// Annotate attaches upstream authorship to the added lines of a diff.
+// upstream holds the lines of the upstream file and blame the attribution of
+// each of them. Lines are matched by content in order, so a diff of a
+// function extracted from the upstream file is attributed correctly too.
+func Annotate(result *DiffResult, upstream []string, blame []*Attribution) {
+	next := 0
+	for i := range result.Hunks {
+		hunk := &result.Hunks[i]
+		if !hunk.Added {
+			continue
+		}
+
+		lines := strings.Split(hunk.Content, "\n")
+		hunk.Blame = make([]*Attribution, len(lines))
+		for j, line := range lines {
+			if line == "" {
+				continue
+			}
+			for k := next; k < len(upstream) && k < len(blame); k++ {
+				if upstream[k] == line {
+					hunk.Blame[j] = blame[k]
+					next = k + 1
+					break
+				}
+			}
+		}
+	}
+}
+
 // FormatDiff formats a DiffResult for display
 func FormatDiff(diff *DiffResult, colorize bool) string {
 	var sb strings.Builder
@@ -164,12 +257,15 @@ func FormatDiff(diff *DiffResult, colorize bool) string {
 
 		// Add content with prefixes
 		lines := strings.Split(hunk.Content, "\n")
-		for _, line := range lines {
+		for i, line := range lines {
 			if line == "" {
 				continue
 			}
 
 			if hunk.Added {
+				if i < len(hunk.Blame) && hunk.Blame[i] != nil {
+					line += "    (" + hunk.Blame[i].String() + ")"
+				}
 				if colorize {
 					sb.WriteString("\033[32m+ " + line + "\033[0m\n")
 				} else {
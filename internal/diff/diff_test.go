@@ -1,9 +1,13 @@
 package diff
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 )
 
 func TestGenerateDiff(t *testing.T) {
@@ -182,3 +186,174 @@ func TestWriteDiffToFile(t *testing.T) {
 		t.Errorf("Expected diff file to contain added/removed markers, got:\n%s", string(content))
 	}
 }
+
+func TestAnnotate(t *testing.T) {
+	alice := &Attribution{Author: "alice", Commit: "1a2b3c4d5e6f", Date: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}
+	bob := &Attribution{Author: "bob", Commit: "9f8e7d6c5b4a", Date: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)}
+
+	// The upstream file has a header the local copy lacks
+	upstream := []string{"package utils", "", "func Sum(a, b int) int {", "\treturn a + b", "}"}
+	blame := []*Attribution{alice, alice, alice, bob, alice}
+
+	result := GenerateDiff("func Sum(a, b int) int {\n\treturn a - b\n}\n", "func Sum(a, b int) int {\n\treturn a + b\n}\n")
+	Annotate(result, upstream, blame)
+
+	formatted := FormatDiff(result, false)
+	if !strings.Contains(formatted, "+ \treturn a + b    (bob, 9f8e7d6, 2024-05-02)") {
+		t.Errorf("Expected added line to be attributed to bob, got:\n%s", formatted)
+	}
+	if strings.Contains(formatted, "- \treturn a - b    (") {
+		t.Errorf("Expected removed lines not to be attributed, got:\n%s", formatted)
+	}
+}
+
+func TestRebase(t *testing.T) {
+	base := "a\nb\nc\nd\ne\n"
+	updated := "a\nb\nC\nd\ne\n"
+
+	got, err := Rebase(base, updated, "a\nb\nc\nd\ne\nlocal\n")
+	if err != nil || got != "a\nb\nC\nd\ne\nlocal\n" {
+		t.Errorf("Expected change to carry over: %q %v", got, err)
+	}
+
+	if _, err := Rebase(base, updated, "x\ny\nz\n"); err == nil {
+		t.Error("Expected an error when the change doesn't apply")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	base := "a\nb\nc\nd\ne\nf\n"
+
+	tests := []struct {
+		name          string
+		local, remote string
+		want          string
+		conflict      string
+	}{
+		{"separate changes", "A\nb\nc\nd\ne\nf\n", "a\nb\nc\nd\nE\nf\nremote\n", "A\nb\nc\nd\nE\nf\nremote\n", ""},
+		{"same change", "a\nB\nc\nd\ne\nf\n", "a\nB\nc\nd\ne\nf\nremote\n", "a\nB\nc\nd\ne\nf\nremote\n", ""},
+		{"deletion and edit", "a\nd\ne\nf\n", "a\nb\nc\nd\ne\nF\n", "a\nd\ne\nF\n", ""},
+		{"same line", "a\nb\nlocal\nd\ne\nf\n", "a\nb\nremote\nd\ne\nf\n", "", "line 3"},
+		{"adjacent lines", "a\nB\nc\nd\ne\nf\n", "a\nb\nC\nd\ne\nF\n", "", "lines 2-3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Merge(base, tt.local, tt.remote)
+			if tt.conflict != "" {
+				if !errors.Is(err, ErrConflict) || !strings.HasSuffix(err.Error(), tt.conflict) {
+					t.Errorf("Expected a conflict at %s, got %q, %v", tt.conflict, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Merge() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDelta(t *testing.T) {
+	original := strings.Repeat("unchanged line\n", 50) + "line 2\n"
+	updated := strings.Repeat("unchanged line\n", 50) + "line 2 changed\nline 3 – added\n"
+
+	delta := Delta(original, updated)
+	if len(delta) >= len(updated) {
+		t.Errorf("Expected the delta to be smaller than the text, got %q", delta)
+	}
+
+	got, err := Undelta(original, delta)
+	if err != nil {
+		t.Fatalf("Undelta failed: %v", err)
+	}
+	if got != updated {
+		t.Errorf("Expected %q, got %q", updated, got)
+	}
+
+	if _, err := Undelta("short", delta); err == nil {
+		t.Error("Expected error applying a delta to the wrong original")
+	}
+}
+
+func TestUnified(t *testing.T) {
+	original := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	updated := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm"
+
+	want := `@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -10,3 +10,4 @@
+ j
+ k
+ l
++m
+\ No newline at end of file
+`
+	if got := Unified(original, updated); got != want {
+		t.Errorf("Unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+
+	if got := Unified("", "x\n"); got != "@@ -0,0 +1 @@\n+x\n" {
+		t.Errorf("Unexpected diff of a new file:\n%s", got)
+	}
+	if got := Unified(original, original); got != "" {
+		t.Errorf("Expected no diff of unchanged content, got:\n%s", got)
+	}
+}
+
+func FuzzDelta(f *testing.F) {
+	f.Add("a\nb\nc\n", "a\nB\nc\n")
+	f.Add("", "ünïcödé\r\n\u202e\x00")
+	f.Add(strings.Repeat("{\n", 500), strings.Repeat("{\n", 499)+"}\n")
+
+	f.Fuzz(func(t *testing.T, original, updated string) {
+		if !utf8.ValidString(original) || !utf8.ValidString(updated) {
+			t.Skip("deltas are of text")
+		}
+		got, err := Undelta(original, Delta(original, updated))
+		if err != nil || got != updated {
+			t.Errorf("Expected %q back, got %q (%v)", updated, got, err)
+		}
+	})
+}
+
+func FuzzUndelta(f *testing.F) {
+	f.Add("a\nb\n", "=2\t-2\t+x")
+	f.Add("short", "=100")
+	f.Add("ü", "-1\t+%FF%FE")
+
+	f.Fuzz(func(t *testing.T, original, delta string) {
+		// Deltas are read from disk, so malformed ones must fail cleanly
+		Undelta(original, delta)
+	})
+}
+
+func FuzzApplyPatch(f *testing.F) {
+	f.Add("line1\nline2\nline3\n", "@@ -1,3 +1,3 @@\n line1\n-line2\n+modified line2\n line3\n")
+	f.Add("", "@@ -0,0 +1,1 @@\n+%E2%80%AE\n")
+	f.Add("abc", "@@ -1,99999 +1,0 @@\n-abc\n")
+
+	dir := f.TempDir()
+	f.Fuzz(func(t *testing.T, content, patch string) {
+		path := filepath.Join(dir, "file.txt")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		ApplyPatch(path, patch)
+	})
+}
+
+func FuzzRebase(f *testing.F) {
+	f.Add("a\nb\nc\n", "a\nB\nc\n", "a\nb\nc\nlocal\n")
+	f.Add("", "ünïcödé", "\u202e")
+	f.Add(strings.Repeat("x", 100), strings.Repeat("y", 100), "")
+
+	f.Fuzz(func(t *testing.T, base, updated, target string) {
+		if _, err := Rebase(base, updated, target); err != nil && !errors.Is(err, ErrPatchFailed) {
+			t.Errorf("Expected only ErrPatchFailed, got %v", err)
+		}
+	})
+}
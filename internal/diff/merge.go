@@ -0,0 +1,151 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// ErrConflict is returned when a three-way merge finds lines both sides
+// changed differently
+var ErrConflict = errors.New("conflicting changes")
+
+// lineEdit replaces the base lines [start, end) with lines
+type lineEdit struct {
+	start, end int
+	lines      []string
+}
+
+// Merge combines the changes local and remote made to base line by line, as
+// diff3 does: changes to separate parts of base are both applied, and so are
+// identical changes. Where the two changed the same or adjacent lines
+// differently, it fails with ErrConflict naming those lines of base.
+func Merge(base, local, remote string) (string, error) {
+	switch {
+	case local == remote || remote == base:
+		return local, nil
+	case local == base:
+		return remote, nil
+	}
+
+	baseLines := splitLinesAfter(base)
+	localEdits := lineEdits(base, local)
+	remoteEdits := lineEdits(base, remote)
+
+	var sb strings.Builder
+	var conflicts []string
+	pos, i, j := 0, 0, 0
+	for i < len(localEdits) || j < len(remoteEdits) {
+		// A group starts at the next edit of either side and takes in every
+		// edit that overlaps or touches it
+		var ours, theirs []lineEdit
+		var first lineEdit
+		if j == len(remoteEdits) || (i < len(localEdits) && localEdits[i].start <= remoteEdits[j].start) {
+			first = localEdits[i]
+			ours, i = append(ours, first), i+1
+		} else {
+			first = remoteEdits[j]
+			theirs, j = append(theirs, first), j+1
+		}
+		start, end := first.start, first.end
+		for grown := true; grown; {
+			grown = false
+			if i < len(localEdits) && localEdits[i].start <= end {
+				ours, end, i, grown = append(ours, localEdits[i]), max(end, localEdits[i].end), i+1, true
+			}
+			if j < len(remoteEdits) && remoteEdits[j].start <= end {
+				theirs, end, j, grown = append(theirs, remoteEdits[j]), max(end, remoteEdits[j].end), j+1, true
+			}
+		}
+
+		sb.WriteString(strings.Join(baseLines[pos:start], ""))
+		switch {
+		case len(theirs) == 0:
+			sb.WriteString(applyEdits(baseLines, ours, start, end))
+		case len(ours) == 0:
+			sb.WriteString(applyEdits(baseLines, theirs, start, end))
+		default:
+			merged := applyEdits(baseLines, ours, start, end)
+			if merged != applyEdits(baseLines, theirs, start, end) {
+				conflicts = append(conflicts, lineRange(start, end))
+			}
+			sb.WriteString(merged)
+		}
+		pos = end
+	}
+	sb.WriteString(strings.Join(baseLines[pos:], ""))
+
+	if len(conflicts) > 0 {
+		return "", fmt.Errorf("%w at %s", ErrConflict, strings.Join(conflicts, ", "))
+	}
+	return sb.String(), nil
+}
+
+// lineEdits returns the edits that turn base into updated, in order
+func lineEdits(base, updated string) []lineEdit {
+	dmp := diffmatchpatch.New()
+	a, b, _ := dmp.DiffLinesToRunes(base, updated)
+	updatedLines := splitLinesAfter(updated)
+
+	var edits []lineEdit
+	var current *lineEdit
+	bi, ui := 0, 0
+	for _, d := range dmp.DiffMainRunes(a, b, false) {
+		n := utf8.RuneCountInString(d.Text)
+		if d.Type == diffmatchpatch.DiffEqual {
+			if current != nil {
+				edits = append(edits, *current)
+				current = nil
+			}
+			bi, ui = bi+n, ui+n
+			continue
+		}
+		if current == nil {
+			current = &lineEdit{start: bi, end: bi}
+		}
+		if d.Type == diffmatchpatch.DiffDelete {
+			bi += n
+			current.end = bi
+		} else {
+			current.lines = append(current.lines, updatedLines[ui:ui+n]...)
+			ui += n
+		}
+	}
+	if current != nil {
+		edits = append(edits, *current)
+	}
+	return edits
+}
+
+// applyEdits returns the base lines [start, end) with edits within them applied
+func applyEdits(baseLines []string, edits []lineEdit, start, end int) string {
+	var sb strings.Builder
+	pos := start
+	for _, e := range edits {
+		sb.WriteString(strings.Join(baseLines[pos:e.start], ""))
+		sb.WriteString(strings.Join(e.lines, ""))
+		pos = e.end
+	}
+	sb.WriteString(strings.Join(baseLines[pos:end], ""))
+	return sb.String()
+}
+
+// lineRange names the base lines [start, end), 1-based
+func lineRange(start, end int) string {
+	if end <= start+1 {
+		return fmt.Sprintf("line %d", start+1)
+	}
+	return fmt.Sprintf("lines %d-%d", start+1, end)
+}
+
+// splitLinesAfter splits text into lines that keep their newlines
+func splitLinesAfter(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,113 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// unifiedContext is the number of unchanged lines around each hunk
+const unifiedContext = 3
+
+// diffLine is a line of a line-mode diff
+type diffLine struct {
+	op   diffmatchpatch.Operation
+	text string // Without its newline
+	eol  bool   // Whether the line ends with a newline
+}
+
+// Unified renders the changes from original to updated as the hunks of a
+// unified diff, as diff -u and git print them, with three lines of context.
+// It returns "" if nothing changed.
+func Unified(original, updated string) string {
+	dmp := diffmatchpatch.New()
+	a, b, lines := dmp.DiffLinesToChars(original, updated)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(a, b, false), lines)
+
+	var all []diffLine
+	for _, d := range diffs {
+		text := d.Text
+		for text != "" {
+			line, rest, eol := strings.Cut(text, "\n")
+			all = append(all, diffLine{op: d.Type, text: line, eol: eol})
+			text = rest
+		}
+	}
+
+	var sb strings.Builder
+	for start := 0; start < len(all); {
+		// Find the next change and the end of its hunk, which runs until more
+		// than twice the context separates it from the next change
+		first := start
+		for first < len(all) && all[first].op == diffmatchpatch.DiffEqual {
+			first++
+		}
+		if first == len(all) {
+			break
+		}
+		last := first
+		for i := first; i < len(all); i++ {
+			if all[i].op != diffmatchpatch.DiffEqual {
+				last = i
+			} else if i-last > 2*unifiedContext {
+				break
+			}
+		}
+
+		from := max(first-unifiedContext, start)
+		to := min(last+unifiedContext+1, len(all))
+		writeHunk(&sb, all, from, to)
+		start = to
+	}
+	return sb.String()
+}
+
+// writeHunk writes the lines all[from:to] as a hunk
+func writeHunk(sb *strings.Builder, all []diffLine, from, to int) {
+	// Line numbers of the hunk's first line in each version
+	oldLine, newLine := 1, 1
+	for _, l := range all[:from] {
+		if l.op != diffmatchpatch.DiffInsert {
+			oldLine++
+		}
+		if l.op != diffmatchpatch.DiffDelete {
+			newLine++
+		}
+	}
+
+	var oldCount, newCount int
+	var body strings.Builder
+	for _, l := range all[from:to] {
+		prefix := " "
+		switch l.op {
+		case diffmatchpatch.DiffDelete:
+			prefix = "-"
+			oldCount++
+		case diffmatchpatch.DiffInsert:
+			prefix = "+"
+			newCount++
+		default:
+			oldCount++
+			newCount++
+		}
+		body.WriteString(prefix + l.text + "\n")
+		if !l.eol {
+			body.WriteString("\\ No newline at end of file\n")
+		}
+	}
+
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n%s", hunkRange(oldLine, oldCount), hunkRange(newLine, newCount), body.String())
+}
+
+// hunkRange formats the start and length of a hunk in one version. An empty
+// range starts at the line before it.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
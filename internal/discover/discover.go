@@ -0,0 +1,353 @@
+// Package discover finds local functions that were copied from an upstream
+// repository, so they can be turned into sync items
+package discover
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+)
+
+const (
+	kgramSize   = 5  // Tokens per hashed k-gram
+	windowSize  = 4  // K-grams per winnowing window
+	minTokens   = 25 // Functions shorter than this are too generic to match
+	maxFileSize = 512 * 1024
+)
+
+// languages maps file extensions to the languages functions can be synced in
+var languages = map[string]string{
+	".go":  "go",
+	".py":  "python",
+	".js":  "javascript",
+	".mjs": "javascript",
+	".cjs": "javascript",
+	".jsx": "javascript",
+}
+
+var (
+	pythonFuncPattern = regexp.MustCompile(`(?m)^def\s+([A-Za-z_]\w*)\s*\(`)
+	jsFuncPattern     = regexp.MustCompile(`(?m)^(?:export\s+)?(?:async\s+)?function\s*\*?\s*([A-Za-z_$][\w$]*)\s*\(`)
+	tokenPattern      = regexp.MustCompile(`[A-Za-z_]\w*|\d+|\S`)
+)
+
+// Extractor extracts a named function from source code
+type Extractor interface {
+	ExtractFunction(content, language, functionName string) (string, error)
+}
+
+// Repository lists and reads the files of an upstream repository
+type Repository interface {
+	ListFiles(owner, repo, ref string) ([]github.TreeEntry, error)
+	GetBlob(owner, repo, sha string) ([]byte, error)
+	Extractor
+}
+
+// Function is a top-level function and its fingerprint
+type Function struct {
+	Path     string
+	Name     string
+	Language string
+	Content  string
+
+	fingerprints map[uint64]struct{}
+}
+
+// Match pairs a local function with the upstream function it resembles
+type Match struct {
+	Local      Function
+	Upstream   Function
+	Similarity float64 // Jaccard similarity of the fingerprints, 0 to 1
+}
+
+// Renamed reports whether the local copy has a different name than the
+// upstream function. Function sync uses one name for both sides, so renamed
+// copies can't be synced as-is.
+func (m Match) Renamed() bool {
+	return m.Local.Name != m.Upstream.Name
+}
+
+// Functions returns the fingerprinted top-level functions in a file. Files in
+// unsupported languages and functions too short to fingerprint are skipped.
+func Functions(ex Extractor, path, content string) []Function {
+	language, ok := languages[filepath.Ext(path)]
+	if !ok {
+		return nil
+	}
+
+	var functions []Function
+	for _, name := range functionNames(language, content) {
+		body, err := ex.ExtractFunction(content, language, name)
+		if err != nil {
+			continue
+		}
+
+		fingerprints := fingerprint(body)
+		if fingerprints == nil {
+			continue
+		}
+
+		functions = append(functions, Function{
+			Path:         path,
+			Name:         name,
+			Language:     language,
+			Content:      body,
+			fingerprints: fingerprints,
+		})
+	}
+
+	return functions
+}
+
+// functionNames lists the top-level functions declared in a file
+func functionNames(language, content string) []string {
+	var names []string
+
+	switch language {
+	case "go":
+		file, err := parser.ParseFile(token.NewFileSet(), "", content, 0)
+		if err != nil {
+			return nil
+		}
+		for _, decl := range file.Decls {
+			// Methods can't be targeted by function sync
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil {
+				names = append(names, fn.Name.Name)
+			}
+		}
+	case "python":
+		for _, m := range pythonFuncPattern.FindAllStringSubmatch(content, -1) {
+			names = append(names, m[1])
+		}
+	case "javascript":
+		for _, m := range jsFuncPattern.FindAllStringSubmatch(content, -1) {
+			names = append(names, m[1])
+		}
+	}
+
+	return names
+}
+
+// fingerprint winnows the hashed token k-grams of code, so that matches
+// survive reformatting and small edits. It returns nil for code that is too
+// short to compare meaningfully.
+func fingerprint(code string) map[uint64]struct{} {
+	tokens := tokenPattern.FindAllString(code, -1)
+	if len(tokens) < minTokens {
+		return nil
+	}
+
+	hashes := make([]uint64, 0, len(tokens)-kgramSize+1)
+	for i := 0; i+kgramSize <= len(tokens); i++ {
+		h := fnv.New64a()
+		for _, t := range tokens[i : i+kgramSize] {
+			h.Write([]byte(t))
+			h.Write([]byte{0})
+		}
+		hashes = append(hashes, h.Sum64())
+	}
+
+	fingerprints := make(map[uint64]struct{})
+	for i := 0; i+windowSize <= len(hashes); i++ {
+		lowest := hashes[i]
+		for _, h := range hashes[i+1 : i+windowSize] {
+			if h <= lowest {
+				lowest = h
+			}
+		}
+		fingerprints[lowest] = struct{}{}
+	}
+
+	return fingerprints
+}
+
+// Similarity compares two pieces of code by their fingerprints, from 0 to 1.
+// Code too short to fingerprint only matches itself exactly.
+func Similarity(a, b string) float64 {
+	fa, fb := fingerprint(a), fingerprint(b)
+	if fa == nil || fb == nil {
+		if strings.TrimSpace(a) == strings.TrimSpace(b) {
+			return 1
+		}
+		return 0
+	}
+	return similarity(fa, fb)
+}
+
+// similarity returns the Jaccard similarity of two fingerprint sets
+func similarity(a, b map[uint64]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for h := range a {
+		if _, ok := b[h]; ok {
+			shared++
+		}
+	}
+
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// FindMatches pairs each local function with its most similar upstream
+// function, keeping pairs at or above the threshold, best matches first
+func FindMatches(local, upstream []Function, threshold float64) []Match {
+	// Index upstream functions by fingerprint so only functions sharing at
+	// least one fingerprint are compared
+	index := make(map[uint64][]int)
+	for i, fn := range upstream {
+		for h := range fn.fingerprints {
+			index[h] = append(index[h], i)
+		}
+	}
+
+	var matches []Match
+	for _, fn := range local {
+		candidates := make(map[int]bool)
+		for h := range fn.fingerprints {
+			for _, i := range index[h] {
+				candidates[i] = true
+			}
+		}
+
+		best := Match{}
+		for i := range candidates {
+			if fn.Language != upstream[i].Language {
+				continue
+			}
+			// On ties, prefer the upstream function with the same name
+			s := similarity(fn.fingerprints, upstream[i].fingerprints)
+			if s > best.Similarity || (s == best.Similarity && upstream[i].Name == fn.Name) {
+				best = Match{Local: fn, Upstream: upstream[i], Similarity: s}
+			}
+		}
+
+		if best.Similarity >= threshold && best.Similarity > 0 {
+			matches = append(matches, best)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Similarity > matches[j].Similarity
+	})
+
+	return matches
+}
+
+// ScanLocal fingerprints the functions in every supported file under dir,
+// skipping hidden directories, vendor and node_modules
+func ScanLocal(ex Extractor, dir string) ([]Function, error) {
+	var functions []Function
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			name := d.Name()
+			if path != dir && (strings.HasPrefix(name, ".") || name == "vendor" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if _, ok := languages[filepath.Ext(path)]; !ok {
+			return nil
+		}
+		if info, err := d.Info(); err != nil || info.Size() > maxFileSize {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		functions = append(functions, Functions(ex, path, string(content))...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error scanning %s: %w", dir, err)
+	}
+
+	return functions, nil
+}
+
+// ScanUpstream fingerprints the functions in every supported file of a
+// repository at ref whose path starts with prefix
+func ScanUpstream(repo Repository, owner, name, ref, prefix string) ([]Function, error) {
+	files, err := repo.ListFiles(owner, name, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var functions []Function
+	for _, file := range files {
+		if !strings.HasPrefix(file.Path, prefix) || file.Size > maxFileSize {
+			continue
+		}
+		if _, ok := languages[filepath.Ext(file.Path)]; !ok {
+			continue
+		}
+
+		content, err := repo.GetBlob(owner, name, file.SHA)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", file.Path, err)
+		}
+
+		functions = append(functions, Functions(repo, file.Path, string(content))...)
+	}
+
+	return functions, nil
+}
+
+// SuggestItems turns matches into function sync items, skipping renamed
+// copies. Item names are the function names, made unique with a numeric
+// suffix.
+func SuggestItems(matches []Match, owner, repo, branch string) []config.SyncItem {
+	used := make(map[string]int)
+
+	var items []config.SyncItem
+	for _, m := range matches {
+		if m.Renamed() {
+			continue
+		}
+
+		name := m.Local.Name
+		if used[name]++; used[name] > 1 {
+			name = fmt.Sprintf("%s-%d", name, used[name])
+		}
+
+		items = append(items, config.SyncItem{
+			Name:        name,
+			Description: fmt.Sprintf("%.0f%% similar to %s in %s/%s", m.Similarity*100, m.Upstream.Path, owner, repo),
+			Source: config.SyncSource{
+				Owner:  owner,
+				Repo:   repo,
+				Path:   m.Upstream.Path,
+				Branch: branch,
+			},
+			Target: config.SyncTarget{
+				Path:     filepath.ToSlash(m.Local.Path),
+				Type:     "function",
+				Language: m.Local.Language,
+				Function: m.Local.Name,
+			},
+		})
+	}
+
+	return items
+}
@@ -0,0 +1,157 @@
+package discover
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/github"
+)
+
+const upstreamStrings = `package strings
+
+// TrimAll removes every occurrence of the cutset from both ends of each word
+func TrimAll(words []string, cutset string) []string {
+	result := make([]string, 0, len(words))
+	for _, word := range words {
+		trimmed := strings.Trim(word, cutset)
+		if trimmed == "" {
+			continue
+		}
+		result = append(result, trimmed)
+	}
+	return result
+}
+
+func Reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+`
+
+// The local copy of TrimAll was reformatted and had a comment edited;
+// Unrelated is original code
+const localUtil = `package util
+
+// TrimAll trims words
+func TrimAll(words []string, cutset string) []string {
+	result := make([]string, 0, len(words))
+	for _, word := range words {
+		trimmed := strings.Trim(word, cutset)
+		if trimmed == "" { continue }
+		result = append(result, trimmed)
+	}
+	return result
+}
+
+func Unrelated(config map[string]int) int {
+	total := 0
+	for key, value := range config {
+		if strings.HasPrefix(key, "x-") {
+			total += value * 2
+		}
+	}
+	return total
+}
+
+func Flip(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+`
+
+// fakeRepo serves files from memory, keyed by path and by a fake blob SHA
+type fakeRepo struct {
+	*github.Client
+	files map[string]string
+}
+
+func (f *fakeRepo) ListFiles(owner, repo, ref string) ([]github.TreeEntry, error) {
+	var entries []github.TreeEntry
+	for path, content := range f.files {
+		entries = append(entries, github.TreeEntry{Path: path, SHA: "sha-" + path, Size: len(content)})
+	}
+	return entries, nil
+}
+
+func (f *fakeRepo) GetBlob(owner, repo, sha string) ([]byte, error) {
+	content, ok := f.files[strings.TrimPrefix(sha, "sha-")]
+	if !ok {
+		return nil, fmt.Errorf("blob %s not found", sha)
+	}
+	return []byte(content), nil
+}
+
+func TestDiscover(t *testing.T) {
+	repo := &fakeRepo{
+		Client: github.NewClient(""),
+		files: map[string]string{
+			"src/strings.go": upstreamStrings,
+			"README.md":      "# utils",
+			"cmd/main.go":    "package main\n\nfunc main() {}\n",
+		},
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "util.go"), []byte(localUtil), 0644); err != nil {
+		t.Fatalf("Failed to write local file: %v", err)
+	}
+
+	local, err := ScanLocal(repo, dir)
+	if err != nil {
+		t.Fatalf("ScanLocal failed: %v", err)
+	}
+	if len(local) != 3 {
+		t.Fatalf("Expected 3 local functions, got %d", len(local))
+	}
+
+	upstream, err := ScanUpstream(repo, "acme", "utils", "main", "src/")
+	if err != nil {
+		t.Fatalf("ScanUpstream failed: %v", err)
+	}
+	if len(upstream) != 2 {
+		t.Fatalf("Expected 2 upstream functions under src/, got %d", len(upstream))
+	}
+
+	matches := FindMatches(local, upstream, 0.6)
+	if len(matches) != 2 {
+		t.Fatalf("Expected 2 matches, got %d: %+v", len(matches), matches)
+	}
+
+	names := map[string]Match{}
+	for _, m := range matches {
+		names[m.Local.Name] = m
+	}
+	if m, ok := names["TrimAll"]; !ok || m.Upstream.Name != "TrimAll" || m.Renamed() {
+		t.Errorf("Expected TrimAll to match upstream TrimAll: %+v", m)
+	}
+	if m, ok := names["Flip"]; !ok || m.Upstream.Name != "Reverse" || !m.Renamed() || m.Similarity < 0.9 {
+		t.Errorf("Expected Flip to match upstream Reverse as a renamed copy: %+v", m)
+	}
+
+	items := SuggestItems(matches, "acme", "utils", "main")
+	if len(items) != 1 {
+		t.Fatalf("Expected renamed copies to be skipped, got %+v", items)
+	}
+	item := items[0]
+	if item.Name != "TrimAll" || item.Source.Path != "src/strings.go" || item.Target.Function != "TrimAll" || item.Target.Language != "go" {
+		t.Errorf("Unexpected suggested item: %+v", item)
+	}
+	if err := item.Validate(); err != nil {
+		t.Errorf("Suggested item is invalid: %v", err)
+	}
+}
+
+func TestFingerprintIgnoresShortCode(t *testing.T) {
+	if fingerprint("func f() { return 1 }") != nil {
+		t.Error("Expected short code not to be fingerprinted")
+	}
+}
@@ -0,0 +1,63 @@
+// Package dockerfile inspects the base images of Dockerfiles
+package dockerfile
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+var fromPattern = regexp.MustCompile(`(?i)^\s*FROM\s+(?:--\S+\s+)*(\S+)(?:\s+AS\s+(\S+))?`)
+
+// Image is a base image named by a FROM instruction
+type Image struct {
+	Ref  string // Image reference as written
+	Line int    // 1-based line number
+}
+
+// Pinned reports whether the image is pinned by digest
+func (i Image) Pinned() bool {
+	return strings.Contains(i.Ref, "@sha256:")
+}
+
+// IsName reports whether a file name looks like a Dockerfile
+func IsName(name string) bool {
+	base := strings.ToLower(path.Base(strings.ReplaceAll(name, "\\", "/")))
+	return base == "dockerfile" || base == "containerfile" ||
+		strings.HasPrefix(base, "dockerfile.") || strings.HasSuffix(base, ".dockerfile")
+}
+
+// Images returns the external base images of a Dockerfile. Stages built
+// from earlier stages, scratch, and images named by build arguments, which
+// can't be checked statically, are left out.
+func Images(content string) []Image {
+	var images []Image
+	stages := make(map[string]bool)
+
+	for i, line := range strings.Split(content, "\n") {
+		m := fromPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		ref := m[1]
+		external := !strings.EqualFold(ref, "scratch") && !stages[strings.ToLower(ref)] && !strings.Contains(ref, "$")
+		if m[2] != "" {
+			stages[strings.ToLower(m[2])] = true
+		}
+		if external {
+			images = append(images, Image{Ref: ref, Line: i + 1})
+		}
+	}
+	return images
+}
+
+// Unpinned returns the external base images that aren't pinned by digest
+func Unpinned(content string) []Image {
+	var unpinned []Image
+	for _, image := range Images(content) {
+		if !image.Pinned() {
+			unpinned = append(unpinned, image)
+		}
+	}
+	return unpinned
+}
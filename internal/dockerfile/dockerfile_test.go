@@ -0,0 +1,37 @@
+package dockerfile
+
+import "testing"
+
+func TestImages(t *testing.T) {
+	content := `ARG BASE=debian
+FROM --platform=$BUILDPLATFORM golang:1.22@sha256:0123 AS build
+FROM build AS test
+FROM ${BASE}
+FROM scratch
+from python:3.12-slim as runtime
+`
+	images := Images(content)
+	if len(images) != 2 || images[0].Ref != "golang:1.22@sha256:0123" || images[1].Ref != "python:3.12-slim" || images[1].Line != 6 {
+		t.Fatalf("Unexpected images: %+v", images)
+	}
+
+	unpinned := Unpinned(content)
+	if len(unpinned) != 1 || unpinned[0].Ref != "python:3.12-slim" {
+		t.Errorf("Unexpected unpinned images: %+v", unpinned)
+	}
+}
+
+func TestIsName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"Dockerfile":              true,
+		"services/api/Dockerfile": true,
+		"Dockerfile.dev":          true,
+		"build/app.dockerfile":    true,
+		"Containerfile":           true,
+		"docker-compose.yml":      false,
+	} {
+		if got := IsName(name); got != want {
+			t.Errorf("IsName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
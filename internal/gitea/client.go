@@ -0,0 +1,280 @@
+// Package gitea reads files and history from Gitea and Forgejo repositories
+// through the REST API (v1), offering the same operations as the GitHub
+// client.
+package gitea
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/diff"
+	"github.com/exitflynn/codesync/internal/github"
+)
+
+// requestTimeout bounds each API request
+const requestTimeout = 30 * time.Second
+
+// Client wraps the Gitea REST API
+type Client struct {
+	baseURL string // API root, e.g. https://gitea.example.com/api/v1
+	token   string
+	client  *http.Client
+	ctx     context.Context
+	budget  *github.Budget // Set by SetLimits
+}
+
+// APIError is an unsuccessful response from the API
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Gitea API returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Is makes errors.Is match github.ErrNotFound and github.ErrRateLimited for
+// the responses that mean those
+func (e *APIError) Is(target error) bool {
+	kind := github.ErrorForStatus(e.StatusCode)
+	return kind != nil && target == kind
+}
+
+// NewClient creates a client for the Gitea or Forgejo instance at
+// instanceURL. The token may be empty for public repositories.
+func NewClient(instanceURL, token string) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(instanceURL, "/") + "/api/v1",
+		token:   token,
+		client:  &http.Client{Timeout: requestTimeout},
+		ctx:     context.Background(),
+	}
+}
+
+// SetLimits bounds the client's concurrency, bandwidth and API calls. It
+// should be called before the client is used.
+func (c *Client) SetLimits(limits github.Limits) {
+	c.budget = github.NewBudget(limits)
+	c.client = &http.Client{Transport: c.budget.Transport(c.client.Transport), Timeout: c.client.Timeout}
+}
+
+// ResetBudget starts a new allowance of API calls, e.g. at the start of a run
+func (c *Client) ResetBudget() {
+	if c.budget != nil {
+		c.budget.Reset()
+	}
+}
+
+// BudgetExhausted reports whether the allowance of API calls is used up
+func (c *Client) BudgetExhausted() bool {
+	return c.budget != nil && c.budget.Exhausted()
+}
+
+// repository returns the API path of a repository
+func repository(owner, repo string) string {
+	return "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(repo)
+}
+
+// escapePath escapes each segment of a file path
+func escapePath(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// get fetches an API path into v and returns the response headers
+func (c *Client) get(path string, query url.Values, v interface{}) (http.Header, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(c.ctx, "GET", u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "token "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: body.Message}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return nil, fmt.Errorf("error parsing response: %w", err)
+	}
+	return resp.Header, nil
+}
+
+// contentEntry is a file or directory returned by the contents API
+type contentEntry struct {
+	Type          string `json:"type"`
+	Path          string `json:"path"`
+	SHA           string `json:"sha"`
+	Encoding      string `json:"encoding"`
+	Content       string `json:"content"`
+	LastCommitSHA string `json:"last_commit_sha"`
+}
+
+// GetFile retrieves a file from a Gitea repository
+func (c *Client) GetFile(owner, repo, path, ref string) (*github.FileInfo, error) {
+	query := url.Values{}
+	if ref != "" {
+		query.Set("ref", ref)
+	}
+
+	var file contentEntry
+	if _, err := c.get(repository(owner, repo)+"/contents/"+escapePath(path), query, &file); err != nil {
+		return nil, fmt.Errorf("error getting file content: %w", err)
+	}
+	if file.Type != "file" {
+		return nil, fmt.Errorf("error getting file content: %s is not a file", path)
+	}
+
+	content := file.Content
+	if file.Encoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(file.Content)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding content: %w", err)
+		}
+		content = string(decoded)
+	}
+
+	return &github.FileInfo{
+		Content:  content,
+		Path:     file.Path,
+		SHA:      file.SHA,
+		CommitID: file.LastCommitSHA,
+	}, nil
+}
+
+// GetDirectory retrieves all files below a directory in a Gitea repository
+func (c *Client) GetDirectory(owner, repo, path, ref string) (map[string]*github.FileInfo, error) {
+	query := url.Values{}
+	if ref != "" {
+		query.Set("ref", ref)
+	}
+
+	var entries []contentEntry
+	if _, err := c.get(repository(owner, repo)+"/contents/"+escapePath(path), query, &entries); err != nil {
+		return nil, fmt.Errorf("error getting directory content: %w", err)
+	}
+
+	result := make(map[string]*github.FileInfo)
+	for _, entry := range entries {
+		switch entry.Type {
+		case "file":
+			file, err := c.GetFile(owner, repo, entry.Path, ref)
+			if err != nil {
+				return nil, fmt.Errorf("error getting %s: %w", entry.Path, err)
+			}
+			result[entry.Path] = file
+		case "dir":
+			files, err := c.GetDirectory(owner, repo, entry.Path, ref)
+			if err != nil {
+				return nil, err
+			}
+			for p, file := range files {
+				result[p] = file
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// GetCommitsSince gets the commits to a file on a branch (or the default
+// branch if ref is empty) since a specific date or commit, newest first. If
+// sinceCommit isn't in the file's history, all commits are returned.
+func (c *Client) GetCommitsSince(owner, repo, path, ref string, since time.Time, sinceCommit string) ([]github.CommitInfo, error) {
+	query := url.Values{}
+	query.Set("path", path)
+	query.Set("limit", "50")
+	// File stats and verification aren't needed and are slow to compute
+	query.Set("stat", "false")
+	query.Set("verification", "false")
+	query.Set("files", "false")
+	if ref != "" {
+		query.Set("sha", ref)
+	}
+
+	var result []github.CommitInfo
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+
+		var commits []struct {
+			SHA    string `json:"sha"`
+			Commit struct {
+				Message string `json:"message"`
+				Author  struct {
+					Name  string    `json:"name"`
+					Email string    `json:"email"`
+					Date  time.Time `json:"date"`
+				} `json:"author"`
+			} `json:"commit"`
+		}
+		header, err := c.get(repository(owner, repo)+"/commits", query, &commits)
+		if err != nil {
+			return nil, fmt.Errorf("error listing commits: %w", err)
+		}
+
+		for _, commit := range commits {
+			if sinceCommit != "" && commit.SHA == sinceCommit {
+				return result, nil
+			}
+			// Commits are newest first, so the rest are older still
+			if !since.IsZero() && commit.Commit.Author.Date.Before(since) {
+				return result, nil
+			}
+			result = append(result, github.CommitInfo{
+				SHA:       commit.SHA,
+				Message:   commit.Commit.Message,
+				Author:    commit.Commit.Author.Name,
+				Email:     commit.Commit.Author.Email,
+				Timestamp: commit.Commit.Author.Date,
+			})
+		}
+
+		if header.Get("X-HasMore") != "true" {
+			return result, nil
+		}
+	}
+}
+
+// GetFileDiff gets the diff between two versions of a file. The API has no
+// per-file patches, so both versions are fetched and compared.
+func (c *Client) GetFileDiff(owner, repo, path, baseRef, headRef string) (string, error) {
+	base, err := c.GetFile(owner, repo, path, baseRef)
+	if err != nil {
+		return "", err
+	}
+	head, err := c.GetFile(owner, repo, path, headRef)
+	if err != nil {
+		return "", err
+	}
+
+	if base.SHA == head.SHA {
+		return "", fmt.Errorf("file %s was not changed between %s and %s", path, baseRef, headRef)
+	}
+	return diff.FormatDiff(diff.GenerateDiff(base.Content, head.Content), false), nil
+}
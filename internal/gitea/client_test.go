@@ -0,0 +1,121 @@
+package gitea
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewClient(server.URL+"/", "test-token")
+}
+
+func TestGetFile(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/repos/acme/utils/contents/pkg/log.go" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("ref") != "main" || r.Header.Get("Authorization") != "token test-token" {
+			t.Errorf("Unexpected request: %s %v", r.URL.RawQuery, r.Header)
+		}
+		// "package log\n"
+		fmt.Fprint(w, `{"type": "file", "path": "pkg/log.go", "sha": "b1", "encoding": "base64", "content": "cGFja2FnZSBsb2cK", "last_commit_sha": "c1"}`)
+	})
+
+	file, err := client.GetFile("acme", "utils", "pkg/log.go", "main")
+	if err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	if file.Content != "package log\n" || file.SHA != "b1" || file.CommitID != "c1" {
+		t.Errorf("Unexpected file: %+v", file)
+	}
+}
+
+func TestGetFileNotFound(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "object does not exist [id: , rel_path: missing.go]"}`)
+	})
+
+	_, err := client.GetFile("acme", "utils", "missing.go", "main")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a 404 APIError, got %v", err)
+	}
+}
+
+func TestGetDirectory(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/repos/acme/utils/contents/lib":
+			fmt.Fprint(w, `[{"type": "dir", "path": "lib/sub"}, {"type": "file", "path": "lib/a.go"}]`)
+		case "/api/v1/repos/acme/utils/contents/lib/sub":
+			fmt.Fprint(w, `[{"type": "file", "path": "lib/sub/b.go"}]`)
+		default:
+			fmt.Fprintf(w, `{"type": "file", "path": %q, "content": "x"}`, strings.TrimPrefix(r.URL.Path, "/api/v1/repos/acme/utils/contents/"))
+		}
+	})
+
+	files, err := client.GetDirectory("acme", "utils", "lib", "main")
+	if err != nil {
+		t.Fatalf("GetDirectory failed: %v", err)
+	}
+	if len(files) != 2 || files["lib/a.go"] == nil || files["lib/sub/b.go"] == nil {
+		t.Errorf("Expected files from both directories, got %v", files)
+	}
+}
+
+func TestGetCommitsSince(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("path") != "strings.go" || r.URL.Query().Get("sha") != "release-1.x" {
+			t.Errorf("Unexpected query: %s", r.URL.RawQuery)
+		}
+		if r.URL.Query().Get("page") == "1" {
+			w.Header().Set("X-HasMore", "true")
+			fmt.Fprint(w, `[
+				{"sha": "ccc", "commit": {"message": "Third", "author": {"name": "Carol", "date": "2024-03-03T00:00:00Z"}}},
+				{"sha": "bbb", "commit": {"message": "Second", "author": {"name": "Bob", "date": "2024-03-02T00:00:00Z"}}}
+			]`)
+			return
+		}
+		fmt.Fprint(w, `[{"sha": "aaa", "commit": {"message": "First", "author": {"name": "Alice", "date": "2024-03-01T00:00:00Z"}}}]`)
+	})
+
+	commits, err := client.GetCommitsSince("acme", "utils", "strings.go", "release-1.x", time.Time{}, "bbb")
+	if err != nil {
+		t.Fatalf("GetCommitsSince failed: %v", err)
+	}
+	if len(commits) != 1 || commits[0].SHA != "ccc" || commits[0].Author != "Carol" {
+		t.Errorf("Expected only the commit after bbb, got %+v", commits)
+	}
+
+	if commits, _ := client.GetCommitsSince("acme", "utils", "strings.go", "release-1.x", time.Time{}, "gone"); len(commits) != 3 {
+		t.Errorf("Expected all commits across pages when the starting commit is gone, got %d", len(commits))
+	}
+}
+
+func TestGetFileDiff(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("ref") {
+		case "v1":
+			fmt.Fprint(w, `{"type": "file", "path": "a.go", "sha": "s1", "content": "x\n"}`)
+		default:
+			fmt.Fprint(w, `{"type": "file", "path": "a.go", "sha": "s2", "content": "y\n"}`)
+		}
+	})
+
+	patch, err := client.GetFileDiff("acme", "utils", "a.go", "v1", "v2")
+	if err != nil || !strings.Contains(patch, "- x") || !strings.Contains(patch, "+ y") {
+		t.Errorf("Unexpected diff: %q, %v", patch, err)
+	}
+	if _, err := client.GetFileDiff("acme", "utils", "a.go", "v2", "v2"); err == nil {
+		t.Error("Expected error for an unchanged file")
+	}
+}
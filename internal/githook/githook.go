@@ -0,0 +1,192 @@
+// Package githook installs the git hooks that keep local edits out of
+// codesync-managed paths, and finds the paths the commits they guard change
+package githook
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Hooks lists the git hooks that can be installed
+var Hooks = []string{"pre-commit", "commit-msg", "pre-push"}
+
+// OverrideTrailer is the commit message trailer that allows a commit to
+// change managed paths, e.g. "Codesync-Override: hotfix until upstream lands"
+const OverrideTrailer = "Codesync-Override"
+
+// OverrideEnv allows changes to managed paths when set, for pre-commit hooks
+// that run before the commit message is written
+const OverrideEnv = "CODESYNC_OVERRIDE"
+
+// header marks hooks written by Install, which may be replaced
+const header = "# Installed by codesync hook install; edits are overwritten"
+
+// zeroSHA is what pre-push passes for refs that don't exist on one side
+var zeroSHA = regexp.MustCompile(`^0+$`)
+
+var trailerPattern = regexp.MustCompile(`(?im)^` + OverrideTrailer + `:[ \t]*\S`)
+
+// Change is a set of paths changed together that are checked together
+type Change struct {
+	Commit   string   // Empty for staged changes
+	Paths    []string // Relative to the top of the work tree
+	Override bool     // Whether the change carries an override marker
+}
+
+// Install writes a hook that runs "<command> hook run <hook> <args>" in the
+// repository in the working directory, and returns its path. A hook that
+// wasn't installed by codesync is only replaced if force is set.
+func Install(hook, command string, args []string, force bool) (string, error) {
+	if !known(hook) {
+		return "", fmt.Errorf("unknown hook %q: use one of %s", hook, strings.Join(Hooks, ", "))
+	}
+
+	dir, err := git("rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", err
+	}
+	path, err := filepath.Abs(filepath.Join(strings.TrimSpace(dir), hook))
+	if err != nil {
+		return "", err
+	}
+
+	existing, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	if err == nil && !bytes.Contains(existing, []byte(header)) && !force {
+		return "", fmt.Errorf("%s already exists and wasn't installed by codesync; use --force to replace it", path)
+	}
+
+	words := []string{quote(command), "hook", "run", hook}
+	for _, arg := range args {
+		words = append(words, quote(arg))
+	}
+	script := fmt.Sprintf("#!/bin/sh\n%s\nexec %s \"$@\"\n", header, strings.Join(words, " "))
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		return "", err
+	}
+	// WriteFile keeps the mode of a hook it replaces
+	return path, os.Chmod(path, 0755)
+}
+
+// Staged returns the change staged for the next commit
+func Staged() (Change, error) {
+	out, err := git("diff", "--cached", "--name-only", "--no-renames", "-z")
+	if err != nil {
+		return Change{}, err
+	}
+	return Change{Paths: splitNames(out)}, nil
+}
+
+// Pushed returns a change per commit being pushed, from the ref updates a
+// pre-push hook reads on stdin. Commits already on the remote aren't
+// included.
+func Pushed(updates io.Reader) ([]Change, error) {
+	var changes []Change
+	seen := map[string]bool{}
+
+	scanner := bufio.NewScanner(updates)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 4 {
+			continue
+		}
+		localSHA, remoteSHA := fields[1], fields[3]
+		if zeroSHA.MatchString(localSHA) {
+			continue // A deleted ref pushes no commits
+		}
+
+		revs := []string{"rev-list", localSHA, "--not", "--remotes"}
+		if !zeroSHA.MatchString(remoteSHA) {
+			revs = []string{"rev-list", remoteSHA + ".." + localSHA}
+		}
+		out, err := git(revs...)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, sha := range strings.Fields(out) {
+			if seen[sha] {
+				continue
+			}
+			seen[sha] = true
+
+			change, err := commitChange(sha)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, change)
+		}
+	}
+	return changes, scanner.Err()
+}
+
+// commitChange returns the paths a commit changes, and whether its message
+// has an override marker
+func commitChange(sha string) (Change, error) {
+	names, err := git("diff-tree", "--no-commit-id", "--name-only", "--no-renames", "-r", "-z", "--root", sha)
+	if err != nil {
+		return Change{}, err
+	}
+	message, err := git("log", "-1", "--format=%B", sha)
+	if err != nil {
+		return Change{}, err
+	}
+	return Change{Commit: sha, Paths: splitNames(names), Override: HasOverride(message)}, nil
+}
+
+// HasOverride reports whether a commit message has an override marker
+func HasOverride(message string) bool {
+	return trailerPattern.MatchString(message)
+}
+
+func known(hook string) bool {
+	for _, h := range Hooks {
+		if h == hook {
+			return true
+		}
+	}
+	return false
+}
+
+// splitNames splits NUL-terminated git output
+func splitNames(out string) []string {
+	var names []string
+	for _, name := range strings.Split(out, "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// quote quotes a word for sh
+func quote(word string) string {
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
+
+// git runs a git command in the working directory and returns its output
+func git(args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
@@ -0,0 +1,155 @@
+package githook
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newRepo creates a git repository and makes it the working directory
+func newRepo(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Chdir(t.TempDir())
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_AUTHOR_NAME", "Alice")
+	t.Setenv("GIT_AUTHOR_EMAIL", "alice@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Alice")
+	t.Setenv("GIT_COMMITTER_EMAIL", "alice@example.com")
+	run(t, "init", "-q")
+}
+
+func run(t *testing.T, args ...string) string {
+	t.Helper()
+	out, err := git(args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(out)
+}
+
+func commit(t *testing.T, message string, files map[string]string) string {
+	t.Helper()
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		run(t, "add", name)
+	}
+	run(t, "commit", "-q", "-m", message)
+	return run(t, "rev-parse", "HEAD")
+}
+
+func TestInstall(t *testing.T) {
+	newRepo(t)
+
+	path, err := Install("pre-commit", "/opt/code sync/codesync", []string{"--config", "it's.yaml"}, false)
+	if err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+	script, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `exec '/opt/code sync/codesync' hook run pre-commit '--config' 'it'\''s.yaml' "$@"`
+	if !strings.Contains(string(script), want) {
+		t.Errorf("Unexpected hook script:\n%s", script)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm()&0100 == 0 {
+		t.Errorf("Expected the hook to be executable, got %v", info.Mode())
+	}
+
+	// Reinstalling replaces codesync's hook, but not someone else's
+	if _, err := Install("pre-commit", "codesync", nil, false); err != nil {
+		t.Errorf("Expected codesync's hook to be replaced, got %v", err)
+	}
+	if err := os.WriteFile(path, []byte("#!/bin/sh\nmake lint\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Install("pre-commit", "codesync", nil, false); err == nil {
+		t.Error("Expected another hook not to be replaced")
+	}
+	if _, err := Install("pre-commit", "codesync", nil, true); err != nil {
+		t.Errorf("Expected --force to replace another hook, got %v", err)
+	}
+
+	if _, err := Install("post-merge", "codesync", nil, false); err == nil {
+		t.Error("Expected an unknown hook to fail")
+	}
+}
+
+func TestStaged(t *testing.T) {
+	newRepo(t)
+	commit(t, "initial", map[string]string{"vendor/log.go": "package log\n", "main.go": "package main\n"})
+
+	if err := os.WriteFile("vendor/log.go", []byte("package log // edited\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run(t, "add", "vendor/log.go")
+	if err := os.WriteFile("main.go", []byte("package main // unstaged\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	change, err := Staged()
+	if err != nil {
+		t.Fatalf("Staged failed: %v", err)
+	}
+	if len(change.Paths) != 1 || change.Paths[0] != "vendor/log.go" || change.Override {
+		t.Errorf("Unexpected staged change: %+v", change)
+	}
+}
+
+func TestPushed(t *testing.T) {
+	newRepo(t)
+	base := commit(t, "initial", map[string]string{"main.go": "package main\n"})
+	edit := commit(t, "Patch the logger\n\nCodesync-Override: upstream fix is pending", map[string]string{"vendor/log.go": "package log\n"})
+	tip := commit(t, "Update main", map[string]string{"main.go": "package main // updated\n"})
+
+	updates := strings.NewReader("refs/heads/main " + tip + " refs/heads/main " + base + "\n")
+	changes, err := Pushed(updates)
+	if err != nil {
+		t.Fatalf("Pushed failed: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("Expected the two new commits, got %+v", changes)
+	}
+	byCommit := map[string]Change{}
+	for _, c := range changes {
+		byCommit[c.Commit] = c
+	}
+	if c := byCommit[edit]; !c.Override || len(c.Paths) != 1 || c.Paths[0] != "vendor/log.go" {
+		t.Errorf("Unexpected change for the overridden commit: %+v", c)
+	}
+	if c := byCommit[tip]; c.Override || len(c.Paths) != 1 || c.Paths[0] != "main.go" {
+		t.Errorf("Unexpected change for the last commit: %+v", c)
+	}
+
+	// A new branch pushes every commit not on a remote; a deleted one none
+	zero := strings.Repeat("0", 40)
+	updates = strings.NewReader("refs/heads/topic " + tip + " refs/heads/topic " + zero + "\n(delete) " + zero + " refs/heads/old " + base + "\n")
+	if changes, err = Pushed(updates); err != nil || len(changes) != 3 {
+		t.Errorf("Expected all three commits of a new branch, got %d: %v", len(changes), err)
+	}
+}
+
+func TestHasOverride(t *testing.T) {
+	tests := map[string]bool{
+		"Fix logging\n\nCodesync-Override: hotfix\n":  true,
+		"Fix logging\n\ncodesync-override: hotfix\n":  true,
+		"Fix logging\n\nCodesync-Override:\nmore\n":   false,
+		"Fix logging\n# Codesync-Override: hotfix\n":  false,
+		"Fix logging without Codesync-Override: here": false,
+	}
+	for message, want := range tests {
+		if got := HasOverride(message); got != want {
+			t.Errorf("HasOverride(%q) = %v, want %v", message, got, want)
+		}
+	}
+}
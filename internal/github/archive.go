@@ -0,0 +1,104 @@
+package github
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v52/github"
+)
+
+// GetArchive retrieves all files below a directory from a tarball of the
+// repository at ref, in one download rather than a request per file. The
+// result is the same as GetDirectory's.
+func (c *Client) GetArchive(owner, repo, path, ref string) (map[string]*FileInfo, error) {
+	link, _, err := c.client.Repositories.GetArchiveLink(c.ctx, owner, repo, github.Tarball, &github.RepositoryContentGetOptions{Ref: ref}, false)
+	if err != nil {
+		return nil, fmt.Errorf("error getting archive link: %w", classify(err))
+	}
+
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, link.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	// Archives are too large to cache, and a pinned ref never changes
+	req.Header.Set("Cache-Control", "no-store")
+
+	resp, err := c.raw.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading archive: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error downloading archive: %w", statusError(resp.StatusCode))
+	}
+
+	files, err := extractTarball(resp.Body, path)
+	if err != nil {
+		return nil, err
+	}
+	// Archives hold Git LFS pointers unless the repository includes the
+	// objects. Like GetDirectory, a file that can't be fetched fails it all.
+	for name, file := range files {
+		content, err := c.resolveLFS(owner, repo, []byte(file.Content))
+		if err != nil {
+			return nil, fmt.Errorf("error getting %s: %w", name, err)
+		}
+		file.Content = string(content)
+	}
+	return files, nil
+}
+
+// extractTarball returns the regular files below dir in a gzipped tarball
+// whose entries are all in a single top-level directory, as GitHub's are,
+// keyed by their path in the repository
+func extractTarball(r io.Reader, dir string) (map[string]*FileInfo, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading archive: %w", err)
+	}
+	defer gz.Close()
+
+	prefix := strings.Trim(dir, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	result := make(map[string]*FileInfo)
+	isDir := prefix == ""
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading archive: %w", err)
+		}
+
+		// Drop the top-level directory, named after the repository and commit
+		_, name, ok := strings.Cut(header.Name, "/")
+		if !ok || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		isDir = true
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s from archive: %w", name, err)
+		}
+		result[name] = &FileInfo{Content: string(content), Path: name}
+	}
+
+	if !isDir {
+		return nil, errors.New("path does not point to a directory")
+	}
+	return result, nil
+}
@@ -0,0 +1,82 @@
+package github
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// tarball builds a gzipped tarball of files in a top-level directory, like
+// GitHub's archives
+func tarball(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: "acme-utils-abc123/", Typeflag: tar.TypeDir, Mode: 0755}); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		header := &tar.Header{Name: "acme-utils-abc123/" + name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGetArchive(t *testing.T) {
+	archive := tarball(t, map[string]string{
+		"README.md":          "# utils\n",
+		"modules/vpc/a.tf":   "a\n",
+		"modules/vpc/b/c.tf": "c\n",
+		"modules/vpc2/d.tf":  "d\n",
+	})
+
+	var requests []string
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/repos/acme/utils/tarball/v1.2.0":
+			w.Header().Set("Location", server.URL+"/codeload/acme/utils/tar.gz/v1.2.0")
+			w.WriteHeader(http.StatusFound)
+		case "/codeload/acme/utils/tar.gz/v1.2.0":
+			w.Write(archive)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	files, err := client.GetArchive("acme", "utils", "modules/vpc", "v1.2.0")
+	if err != nil {
+		t.Fatalf("GetArchive failed: %v", err)
+	}
+	if len(files) != 2 || files["modules/vpc/a.tf"].Content != "a\n" || files["modules/vpc/b/c.tf"].Content != "c\n" {
+		t.Errorf("Expected the files below modules/vpc, got %+v", files)
+	}
+	if len(requests) != 2 {
+		t.Errorf("Expected the link and one download, got %v", requests)
+	}
+
+	if _, err := client.GetArchive("acme", "utils", "README.md", "v1.2.0"); err == nil {
+		t.Error("Expected an error for a path that isn't a directory")
+	}
+}
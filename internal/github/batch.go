@@ -0,0 +1,180 @@
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBatchFiles bounds the files fetched by one GraphQL query, to stay within
+// GitHub's query limits
+const maxBatchFiles = 50
+
+// FileRead names a file to fetch in a batch
+type FileRead struct {
+	Owner string
+	Repo  string
+	Path  string
+	Ref   string // Branch, tag or commit; empty for the default branch
+}
+
+// prefetched holds files fetched in a batch, keyed by the commit that last
+// changed them, which is what GetFile is asked for once the commits are known
+type prefetched struct {
+	mu    sync.Mutex
+	files map[string]*FileInfo
+}
+
+func prefetchKey(owner, repo, path, commit string) string {
+	return strings.Join([]string{owner, repo, path, commit}, "\x00")
+}
+
+func (p *prefetched) get(owner, repo, path, ref string) (*FileInfo, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	file, ok := p.files[prefetchKey(owner, repo, path, ref)]
+	return file, ok
+}
+
+// PrefetchFiles fetches files with a GraphQL query per repository and ref,
+// rather than a few REST requests per file. Later GetFile calls for a file at
+// the commit that last changed it are answered from the batch. Files the
+// query can't return, such as binary or very large ones, are left to GetFile.
+// Each call replaces the files of the previous one. Clients with an API call
+// budget don't batch, so that the budget runs out between items rather than
+// part way through them.
+func (c *Client) PrefetchFiles(reads []FileRead) error {
+	files := make(map[string]*FileInfo)
+	if c.budget.limited() {
+		reads = nil
+	}
+
+	groups := make(map[FileRead][]string)
+	var order []FileRead
+	for _, r := range reads {
+		key := FileRead{Owner: r.Owner, Repo: r.Repo, Ref: r.Ref}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], r.Path)
+	}
+
+	var firstErr error
+	for _, group := range order {
+		paths := groups[group]
+		for start := 0; start < len(paths); start += maxBatchFiles {
+			batch := paths[start:min(start+maxBatchFiles, len(paths))]
+			if err := c.fetchBatch(group, batch, files); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	c.prefetched.mu.Lock()
+	c.prefetched.files = files
+	c.prefetched.mu.Unlock()
+	return firstErr
+}
+
+// fetchBatch fetches the files at paths in one repository and ref with a
+// single query, adding those it gets to files
+func (c *Client) fetchBatch(group FileRead, paths []string, files map[string]*FileInfo) error {
+	ref := group.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	// Each file is a pair of aliased fields: its blob at the ref, and the
+	// last commit to change it
+	var params, blobs, histories strings.Builder
+	variables := map[string]string{"owner": group.Owner, "repo": group.Repo, "ref": ref}
+	params.WriteString("$owner: String!, $repo: String!, $ref: String!")
+	for i, path := range paths {
+		fmt.Fprintf(&params, ", $e%d: String!, $p%d: String!", i, i)
+		fmt.Fprintf(&blobs, "    f%d: object(expression: $e%d) { ... on Blob { oid text isBinary isTruncated } }\n", i, i)
+		fmt.Fprintf(&histories, "        h%d: history(first: 1, path: $p%d) { nodes { oid committedDate } }\n", i, i)
+		variables[fmt.Sprintf("e%d", i)] = ref + ":" + path
+		variables[fmt.Sprintf("p%d", i)] = path
+	}
+	query := fmt.Sprintf("query(%s) {\n  repository(owner: $owner, name: $repo) {\n%s    commit: object(expression: $ref) {\n      ... on Commit {\n%s      }\n    }\n  }\n}", params.String(), blobs.String(), histories.String())
+
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return fmt.Errorf("error encoding batch query: %w", err)
+	}
+	req, err := http.NewRequestWithContext(c.ctx, "POST", c.graphqlURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Client().Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp.StatusCode)
+	}
+
+	type blob struct {
+		OID         string  `json:"oid"`
+		Text        *string `json:"text"`
+		IsBinary    bool    `json:"isBinary"`
+		IsTruncated bool    `json:"isTruncated"`
+	}
+	type history struct {
+		Nodes []struct {
+			OID           string    `json:"oid"`
+			CommittedDate time.Time `json:"committedDate"`
+		} `json:"nodes"`
+	}
+	var result struct {
+		Data struct {
+			Repository map[string]json.RawMessage `json:"repository"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("error parsing batch response: %w", err)
+	}
+	// Missing files are errors too, but don't spoil the rest of the batch
+	if result.Data.Repository == nil && len(result.Errors) > 0 {
+		return fmt.Errorf("error fetching files: %s", result.Errors[0].Message)
+	}
+
+	var commit map[string]history
+	if raw, ok := result.Data.Repository["commit"]; ok {
+		json.Unmarshal(raw, &commit)
+	}
+	for i, path := range paths {
+		var b *blob
+		if raw, ok := result.Data.Repository[fmt.Sprintf("f%d", i)]; ok {
+			json.Unmarshal(raw, &b)
+		}
+		h := commit[fmt.Sprintf("h%d", i)]
+		if b == nil || b.Text == nil || b.IsBinary || b.IsTruncated || len(h.Nodes) == 0 {
+			continue
+		}
+		// Git LFS pointers are resolved by GetFile
+		if _, ok := parseLFSPointer([]byte(*b.Text)); ok {
+			continue
+		}
+
+		last := h.Nodes[0]
+		files[prefetchKey(group.Owner, group.Repo, path, last.OID)] = &FileInfo{
+			Content:  *b.Text,
+			Path:     path,
+			SHA:      b.OID,
+			Updated:  last.CommittedDate,
+			CommitID: last.OID,
+		}
+	}
+	return nil
+}
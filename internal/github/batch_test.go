@@ -0,0 +1,91 @@
+package github
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPrefetchFiles(t *testing.T) {
+	var requests []string
+	var variables map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		if r.URL.Path != "/graphql" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body struct {
+			Variables map[string]string `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		variables = body.Variables
+		w.Write([]byte(`{"data": {"repository": {
+			"f0": {"oid": "b0", "text": "package log\n", "isBinary": false, "isTruncated": false},
+			"f1": {"oid": "b1", "text": null, "isBinary": true, "isTruncated": false},
+			"commit": {
+				"h0": {"nodes": [{"oid": "c0", "committedDate": "2024-05-01T12:00:00Z"}]},
+				"h1": {"nodes": [{"oid": "c1", "committedDate": "2024-05-01T12:00:00Z"}]}
+			}
+		}}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.SetBaseURL(server.URL)
+
+	err := client.PrefetchFiles([]FileRead{
+		{Owner: "acme", Repo: "utils", Path: "log.go", Ref: "main"},
+		{Owner: "acme", Repo: "utils", Path: "logo.png", Ref: "main"},
+	})
+	if err != nil {
+		t.Fatalf("PrefetchFiles failed: %v", err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("Expected a single query, got %v", requests)
+	}
+	if variables["e0"] != "main:log.go" || variables["p1"] != "logo.png" {
+		t.Errorf("Unexpected query variables: %v", variables)
+	}
+
+	file, err := client.GetFile("acme", "utils", "log.go", "c0")
+	if err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	if file.Content != "package log\n" || file.SHA != "b0" || file.CommitID != "c0" {
+		t.Errorf("Unexpected prefetched file: %+v", file)
+	}
+	if len(requests) != 1 {
+		t.Errorf("Expected the prefetched file not to be requested again, got %v", requests)
+	}
+
+	// Binary files aren't batched
+	if _, err := client.GetFile("acme", "utils", "logo.png", "c1"); err == nil {
+		t.Error("Expected the binary file to be requested from the server")
+	}
+	if len(requests) == 1 {
+		t.Error("Expected a request for the binary file")
+	}
+}
+
+func TestPrefetchFilesWithBudget(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.SetBaseURL(server.URL)
+	client.SetLimits(Limits{MaxAPICalls: 10})
+
+	err := client.PrefetchFiles([]FileRead{
+		{Owner: "acme", Repo: "utils", Path: "a.go"},
+		{Owner: "acme", Repo: "utils", Path: "b.go"},
+	})
+	if err != nil || calls != 0 {
+		t.Errorf("Expected a budgeted client not to batch, got %d calls and error %v", calls, err)
+	}
+}
@@ -0,0 +1,200 @@
+package github
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Limits bound the client's use of the network. Zero values mean no limit.
+type Limits struct {
+	MaxConcurrent  int   // Requests in flight at once; others wait for a slot
+	MaxBytesPerSec int64 // Response bytes read per second across all requests
+	MaxAPICalls    int   // API requests between calls to ResetBudget
+}
+
+// ErrBudgetExhausted is returned for API requests made after MaxAPICalls
+var ErrBudgetExhausted = errors.New("API call budget exhausted")
+
+// budget enforces Limits for every request the client makes
+type budget struct {
+	mu     sync.Mutex
+	limits Limits
+	slots  chan struct{} // Semaphore for MaxConcurrent, nil without a limit
+	calls  int
+	next   time.Time // When reading more bytes is next allowed
+}
+
+func (b *budget) setLimits(limits Limits) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.limits = limits
+	b.slots = nil
+	if limits.MaxConcurrent > 0 {
+		b.slots = make(chan struct{}, limits.MaxConcurrent)
+	}
+}
+
+// spendCall counts an API request, failing once the budget is used up
+func (b *budget) spendCall() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.limits.MaxAPICalls > 0 && b.calls >= b.limits.MaxAPICalls {
+		return ErrBudgetExhausted
+	}
+	b.calls++
+	return nil
+}
+
+// throttle sleeps long enough that n more bytes keep reads within
+// MaxBytesPerSec
+func (b *budget) throttle(n int) {
+	b.mu.Lock()
+	rate := b.limits.MaxBytesPerSec
+	if rate <= 0 || n <= 0 {
+		b.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	if b.next.Before(now) {
+		b.next = now
+	}
+	b.next = b.next.Add(time.Duration(float64(n) / float64(rate) * float64(time.Second)))
+	wait := b.next.Sub(now)
+	b.mu.Unlock()
+
+	time.Sleep(wait)
+}
+
+// budgetTransport applies a budget to the requests of an HTTP client. Only
+// requests to the API count as calls; raw downloads are limited in
+// concurrency and bandwidth alone.
+type budgetTransport struct {
+	budget *budget
+	next   http.RoundTripper
+	api    bool
+}
+
+func (t *budgetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.api {
+		if err := t.budget.spendCall(); err != nil {
+			return nil, err
+		}
+	}
+
+	t.budget.mu.Lock()
+	slots := t.budget.slots
+	t.budget.mu.Unlock()
+
+	release := func() {}
+	if slots != nil {
+		select {
+		case slots <- struct{}{}:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		var once sync.Once
+		release = func() { once.Do(func() { <-slots }) }
+	}
+
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	// The slot is held until the body has been read and closed
+	resp.Body = &budgetBody{ReadCloser: resp.Body, budget: t.budget, release: release}
+	return resp, nil
+}
+
+type budgetBody struct {
+	io.ReadCloser
+	budget  *budget
+	release func()
+}
+
+func (b *budgetBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.budget.throttle(n)
+	return n, err
+}
+
+func (b *budgetBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+// SetLimits bounds the client's concurrency, bandwidth and API calls. It
+// should be called before the client is used.
+func (c *Client) SetLimits(limits Limits) {
+	c.budget.setLimits(limits)
+}
+
+// ResetBudget starts a new allowance of API calls, e.g. at the start of a run
+func (c *Client) ResetBudget() {
+	c.budget.reset()
+}
+
+// BudgetExhausted reports whether the allowance of API calls is used up
+func (c *Client) BudgetExhausted() bool {
+	return c.budget.exhausted()
+}
+
+// limited reports whether API calls are limited
+func (b *budget) limited() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.limits.MaxAPICalls > 0
+}
+
+func (b *budget) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = 0
+}
+
+func (b *budget) exhausted() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.limits.MaxAPICalls > 0 && b.calls >= b.limits.MaxAPICalls
+}
+
+// Budget applies Limits to the HTTP clients of other code hosts, so that
+// they share the settings of the GitHub client. Every request through it
+// counts as an API call.
+type Budget struct {
+	budget budget
+}
+
+// NewBudget creates a budget with the given limits
+func NewBudget(limits Limits) *Budget {
+	b := &Budget{}
+	b.budget.setLimits(limits)
+	return b
+}
+
+// Transport returns a transport sending requests through next (or
+// http.DefaultTransport if nil) within the budget
+func (b *Budget) Transport(next http.RoundTripper) http.RoundTripper {
+	return &budgetTransport{budget: &b.budget, next: next, api: true}
+}
+
+// Reset starts a new allowance of API calls
+func (b *Budget) Reset() {
+	b.budget.reset()
+}
+
+// Exhausted reports whether the allowance of API calls is used up
+func (b *Budget) Exhausted() bool {
+	return b.budget.exhausted()
+}
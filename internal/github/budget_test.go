@@ -0,0 +1,112 @@
+package github
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAPICallBudget(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(`{"name": "utils", "owner": {"login": "acme"}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.SetBaseURL(server.URL)
+	client.SetLimits(Limits{MaxAPICalls: 2})
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetRepository("acme", "utils"); err != nil {
+			t.Fatalf("Call %d failed: %v", i+1, err)
+		}
+	}
+	if !client.BudgetExhausted() {
+		t.Error("Expected the budget to be exhausted")
+	}
+	if _, err := client.GetRepository("acme", "utils"); !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("Expected ErrBudgetExhausted, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected the over-budget call not to be sent, got %d calls", calls.Load())
+	}
+
+	client.ResetBudget()
+	if _, err := client.GetRepository("acme", "utils"); err != nil {
+		t.Errorf("Expected a reset budget to allow calls: %v", err)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		inFlight.Add(-1)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	b := &budget{}
+	b.setLimits(Limits{MaxConcurrent: 2})
+	client := &http.Client{Transport: &budgetTransport{budget: b}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Errorf("GET failed: %v", err)
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	if peak.Load() > 2 {
+		t.Errorf("Expected at most 2 requests in flight, saw %d", peak.Load())
+	}
+}
+
+func TestBandwidthLimit(t *testing.T) {
+	body := strings.Repeat("x", 2000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	b := &budget{}
+	b.setLimits(Limits{MaxBytesPerSec: 20000})
+	client := &http.Client{Transport: &budgetTransport{budget: b}}
+
+	start := time.Now()
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	// 2000 bytes at 20000 bytes/s takes about 100ms
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("Expected the download to be throttled, took %v", elapsed)
+	}
+}
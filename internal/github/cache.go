@@ -0,0 +1,141 @@
+package github
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Cache stores responses so that requests for unchanged content can be
+// answered from it when GitHub replies 304 Not Modified, which doesn't count
+// against the rate limit
+type Cache interface {
+	Load(key string) ([]byte, error)
+	Save(key string, data []byte) error
+}
+
+// SetCache makes the client send conditional requests, keyed by ETag, for
+// what it reads. It should be called before the client is used.
+func (c *Client) SetCache(cache Cache) {
+	c.cache.cache = cache
+}
+
+// responseCache holds the cache of a client's transports, which is set after
+// they are created
+type responseCache struct {
+	cache Cache
+}
+
+// cachedResponse is a response stored in the cache
+type cachedResponse struct {
+	ETag   string      `json:"etag"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// maxCachedSize bounds the size of cached responses, so that huge raw files
+// aren't kept in the state directory
+const maxCachedSize = 8 << 20
+
+// cacheKey identifies a request in the cache. The Accept header picks the
+// representation, e.g. raw content or JSON.
+func cacheKey(req *http.Request) string {
+	sum := sha256.Sum256([]byte(req.URL.String() + "\n" + req.Header.Get("Accept")))
+	return fmt.Sprintf("%x", sum[:16])
+}
+
+// cacheTransport sends conditional requests for GETs it has a cached
+// response to, and replays that response when the content is unchanged.
+// Requests sent with Cache-Control: no-store bypass it.
+type cacheTransport struct {
+	cache *responseCache
+	next  http.RoundTripper
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	cache := t.cache.cache
+	if cache == nil || req.Method != http.MethodGet || req.Header.Get("Range") != "" || req.Header.Get("Cache-Control") == "no-store" {
+		return next.RoundTrip(req)
+	}
+
+	key := cacheKey(req)
+	var cached *cachedResponse
+	if data, err := cache.Load(key); err == nil {
+		var c cachedResponse
+		if json.Unmarshal(data, &c) == nil && c.ETag != "" {
+			cached = &c
+		}
+	}
+
+	if cached != nil {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		header := cached.Header.Clone()
+		// The rate limit headers are current
+		for name, values := range resp.Header {
+			if strings.HasPrefix(name, "X-Ratelimit-") {
+				header[name] = values
+			}
+		}
+		return &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(cached.Body)),
+			ContentLength: int64(len(cached.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" || resp.ContentLength > maxCachedSize {
+		return resp, nil
+	}
+
+	// The response is cached once it has been read in full
+	resp.Body = &cachingBody{ReadCloser: resp.Body, save: func(body []byte) {
+		data, err := json.Marshal(cachedResponse{ETag: etag, Header: resp.Header, Body: body})
+		if err == nil {
+			// Failing to cache only costs a full request next time
+			cache.Save(key, data)
+		}
+	}}
+	return resp, nil
+}
+
+// cachingBody passes a response body through, saving it once it has been
+// read to the end
+type cachingBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	save func([]byte)
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF && b.save != nil {
+		b.save(b.buf.Bytes())
+		b.save = nil
+	}
+	return n, err
+}
@@ -0,0 +1,87 @@
+package github
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// memoryCache is a Cache kept in memory
+type memoryCache map[string][]byte
+
+func (m memoryCache) Load(key string) ([]byte, error) {
+	data, ok := m[key]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+	return data, nil
+}
+
+func (m memoryCache) Save(key string, data []byte) error {
+	m[key] = data
+	return nil
+}
+
+func TestConditionalRequests(t *testing.T) {
+	var full, notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"name": "utils", "owner": {"login": "acme"}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.SetBaseURL(server.URL)
+	cache := memoryCache{}
+	client.SetCache(cache)
+
+	for i := 0; i < 3; i++ {
+		repo, err := client.GetRepository("acme", "utils")
+		if err != nil {
+			t.Fatalf("Call %d failed: %v", i+1, err)
+		}
+		if repo.Name != "utils" {
+			t.Errorf("Call %d: expected the cached repository, got %+v", i+1, repo)
+		}
+	}
+	if full.Load() != 1 || notModified.Load() != 2 {
+		t.Errorf("Expected 1 full response and 2 not modified, got %d and %d", full.Load(), notModified.Load())
+	}
+	if len(cache) != 1 {
+		t.Errorf("Expected one cached response, got %d", len(cache))
+	}
+}
+
+func TestConditionalRequestsWithoutETag(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("If-None-Match") != "" {
+			t.Error("Expected no conditional request")
+		}
+		w.Write([]byte(`{"name": "utils", "owner": {"login": "acme"}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.SetBaseURL(server.URL)
+	cache := memoryCache{}
+	client.SetCache(cache)
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetRepository("acme", "utils"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(cache) != 0 || calls.Load() != 2 {
+		t.Errorf("Expected responses without an ETag not to be cached, got %d cached, %d calls", len(cache), calls.Load())
+	}
+}
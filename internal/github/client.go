@@ -1,11 +1,14 @@
 package github
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
@@ -13,16 +16,34 @@ import (
 	"go/parser"
 	"go/token"
 
+	"github.com/exitflynn/codesync/internal/diff"
 	"github.com/google/go-github/v52/github"
 	sitter "github.com/smacker/go-tree-sitter"
 	"github.com/smacker/go-tree-sitter/javascript"
 	"golang.org/x/oauth2"
 )
 
+// Default endpoints on github.com
+const (
+	defaultGraphQLURL = "https://api.github.com/graphql" // Used for blame and batches
+	defaultRawURL     = "https://raw.githubusercontent.com"
+)
+
 // Client wraps the GitHub API client
 type Client struct {
-	client *github.Client
-	ctx    context.Context
+	client     *github.Client
+	raw        *http.Client // For raw file downloads
+	lfs        *http.Client // For Git LFS requests, which authenticate themselves
+	ctx        context.Context
+	token      string
+	graphqlURL string
+	rawURL     string
+	webURL     string // Web host, for Git LFS and submodule URLs
+	budget     *budget
+	limiter    *rateLimiter
+	cache      *responseCache
+	prefetched prefetched    // Files fetched by PrefetchFiles
+	gists      gistRevisions // Gist revisions fetched by Gists
 }
 
 // FileInfo represents information about a file in a GitHub repository
@@ -34,32 +55,126 @@ type FileInfo struct {
 	CommitID string
 }
 
+// TreeEntry represents a file in a repository tree
+type TreeEntry struct {
+	Path string
+	SHA  string
+	Size int
+}
+
+// ReleaseInfo represents a published release
+type ReleaseInfo struct {
+	Tag  string
+	Name string
+	Body string // Release notes, in markdown
+	URL  string
+
+	Prerelease bool
+}
+
 // CommitInfo represents information about a commit
 type CommitInfo struct {
 	SHA       string
 	Message   string
 	Author    string
+	Email     string // Author's email, if the provider reports it
 	Timestamp time.Time
 }
 
 // NewClient creates a new GitHub API client
 func NewClient(token string) *Client {
+	c, tc := newClient(token)
+	c.client = github.NewClient(tc)
+	// Raw files on github.com are fetched without the token
+	c.raw = &http.Client{Transport: &budgetTransport{budget: c.budget, next: &cacheTransport{cache: c.cache, next: &rateLimitTransport{limiter: c.limiter}}}}
+	return c
+}
+
+// NewEnterpriseClient creates a client for a GitHub Enterprise Server
+// instance. baseURL is the instance (e.g. https://github.example.com); the
+// API path is added if it is missing. uploadURL defaults to baseURL.
+func NewEnterpriseClient(token, baseURL, uploadURL string) (*Client, error) {
+	if uploadURL == "" {
+		uploadURL = baseURL
+	}
+
+	c, tc := newClient(token)
+	client, err := github.NewEnterpriseClient(baseURL, uploadURL, tc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub Enterprise URL: %w", err)
+	}
+	c.client = client
+
+	// The API lives under /api/v3 and raw files under /raw on the same host,
+	// which needs the token for private instances
+	host := &url.URL{Scheme: client.BaseURL.Scheme, Host: client.BaseURL.Host}
+	c.graphqlURL = host.String() + "/api/graphql"
+	c.rawURL = host.String() + "/raw"
+	c.webURL = host.String()
+	c.raw = tc
+	return c, nil
+}
+
+// newClient creates a client with github.com endpoints and the HTTP client
+// that authenticates its API requests
+func newClient(token string) (*Client, *http.Client) {
 	ctx := context.Background()
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: token},
 	)
+	b := &budget{}
+	limiter := newRateLimiter()
+	cache := &responseCache{}
 	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
+	// Retries after a rate limit count as a single call
+	tc.Transport = &budgetTransport{budget: b, next: &cacheTransport{cache: cache, next: &rateLimitTransport{limiter: limiter, next: tc.Transport}}, api: true}
 
 	return &Client{
-		client: client,
-		ctx:    ctx,
+		// LFS objects can be large, so they aren't cached
+		lfs:        &http.Client{Transport: &budgetTransport{budget: b, next: &rateLimitTransport{limiter: limiter}}},
+		ctx:        ctx,
+		token:      token,
+		graphqlURL: defaultGraphQLURL,
+		rawURL:     defaultRawURL,
+		webURL:     DefaultWebURL,
+		budget:     b,
+		limiter:    limiter,
+		cache:      cache,
+	}, tc
+}
+
+// SetBaseURL points the client's API requests at another endpoint, such as a
+// test server. GraphQL requests go to its graphql path, as on api.github.com,
+// and Git LFS requests to the endpoint itself.
+func (c *Client) SetBaseURL(rawURL string) error {
+	if !strings.HasSuffix(rawURL, "/") {
+		rawURL += "/"
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid base URL: %w", err)
 	}
+	c.client.BaseURL = u
+	c.graphqlURL = rawURL + "graphql"
+	c.webURL = strings.TrimSuffix(rawURL, "/")
+	return nil
+}
+
+// SetContext sets the context the client's requests are made with. Once it
+// is cancelled or past its deadline, requests in flight and waits for a rate
+// limit to reset fail with its error.
+func (c *Client) SetContext(ctx context.Context) {
+	c.ctx = ctx
 }
 
 // GetFile retrieves a file from a GitHub repository
 func (c *Client) GetFile(owner, repo, path, ref string) (*FileInfo, error) {
-	fileContent, directoryContent, _, err := c.client.Repositories.GetContents(
+	if file, ok := c.prefetched.get(owner, repo, path, ref); ok {
+		copied := *file
+		return &copied, nil
+	}
+
+	fileContent, directoryContent, resp, err := c.client.Repositories.GetContents(
 		c.ctx,
 		owner,
 		repo,
@@ -72,19 +187,43 @@ func (c *Client) GetFile(owner, repo, path, ref string) (*FileInfo, error) {
 		return nil, errors.New("path points to a directory, not a file")
 	}
 
+	// Files in a submodule aren't in the repository's tree, so they are
+	// fetched from the submodule's repository at the pinned commit
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		if sub, subErr := c.resolveSubmodule(owner, repo, path, ref); subErr != nil {
+			return nil, subErr
+		} else if sub != nil && sub.Path != "" {
+			file, err := c.GetFile(sub.Owner, sub.Repo, sub.Path, sub.Ref)
+			if err != nil {
+				return nil, fmt.Errorf("submodule %s: %w", sub.mount(path), err)
+			}
+			file.Path = path
+			return file, nil
+		}
+	}
+
 	// Handle file case
 	if err != nil {
-		return nil, fmt.Errorf("error getting file content: %w", err)
+		return nil, fmt.Errorf("error getting file content: %w", classify(err))
 	}
 
 	if fileContent == nil {
-		return nil, fmt.Errorf("file not found: %s", path)
+		return nil, fmt.Errorf("file %w: %s", ErrNotFound, path)
+	}
+	if fileContent.GetType() == "submodule" {
+		return nil, fmt.Errorf("path points to a submodule, not a file: %s", path)
 	}
 
 	content, err := fileContent.GetContent()
 	if err != nil {
 		return nil, fmt.Errorf("error decoding content: %w", err)
 	}
+	// Files stored with Git LFS come back as pointers to the object
+	resolved, err := c.resolveLFS(owner, repo, []byte(content))
+	if err != nil {
+		return nil, err
+	}
+	content = string(resolved)
 
 	// Get commit information for the file
 	commits, _, err := c.client.Repositories.ListCommits(
@@ -117,8 +256,94 @@ func (c *Client) GetFile(owner, repo, path, ref string) (*FileInfo, error) {
 	}, nil
 }
 
-// GetDirectory retrieves all files from a directory in a GitHub repository
+// GetDirectory retrieves all files below a directory in a GitHub repository.
+// The files are listed with a single recursive Trees API call and fetched as
+// blobs, so their CommitID and Updated aren't set.
 func (c *Client) GetDirectory(owner, repo, path, ref string) (map[string]*FileInfo, error) {
+	treeRef := ref
+	if treeRef == "" {
+		treeRef = "HEAD"
+	}
+	tree, _, err := c.client.Git.GetTree(c.ctx, owner, repo, treeRef, true)
+	if err != nil {
+		return nil, fmt.Errorf("error getting directory content: %w", classify(err))
+	}
+	// Trees too large for one response are walked directory by directory
+	if tree.GetTruncated() {
+		return c.getDirectoryContents(owner, repo, path, ref)
+	}
+
+	prefix := strings.Trim(path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	// Only a directory has entries below it
+	isDir := prefix == ""
+	result := make(map[string]*FileInfo)
+	for _, entry := range tree.Entries {
+		if !strings.HasPrefix(entry.GetPath(), prefix) {
+			continue
+		}
+		isDir = true
+		// Submodules are tree entries of type commit, whose files are in the
+		// submodule's repository
+		if entry.GetType() == "commit" {
+			files, err := c.getDirectoryOfSubmodule(owner, repo, entry.GetPath(), ref)
+			if err != nil {
+				return nil, fmt.Errorf("error getting submodule %s: %w", entry.GetPath(), err)
+			}
+			for p, file := range files {
+				result[p] = file
+			}
+			continue
+		}
+		if entry.GetType() != "blob" {
+			continue
+		}
+
+		content, err := c.GetBlob(owner, repo, entry.GetSHA())
+		if err == nil {
+			content, err = c.resolveLFS(owner, repo, content)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error getting %s: %w", entry.GetPath(), err)
+		}
+		result[entry.GetPath()] = &FileInfo{
+			Content: string(content),
+			Path:    entry.GetPath(),
+			SHA:     entry.GetSHA(),
+		}
+	}
+
+	if !isDir {
+		// The path may be in a submodule, or be one
+		sub, err := c.resolveSubmodule(owner, repo, path, ref)
+		if err != nil {
+			return nil, err
+		}
+		if sub == nil {
+			return nil, errors.New("path does not point to a directory")
+		}
+		return c.getSubmoduleDirectory(sub, sub.mount(path))
+	}
+	return result, nil
+}
+
+// getDirectoryOfSubmodule retrieves all files of the submodule at mount
+func (c *Client) getDirectoryOfSubmodule(owner, repo, mount, ref string) (map[string]*FileInfo, error) {
+	sub, err := c.resolveSubmodule(owner, repo, mount, ref)
+	if err != nil {
+		return nil, err
+	}
+	if sub == nil {
+		return nil, fmt.Errorf("%s is not a submodule", mount)
+	}
+	return c.getSubmoduleDirectory(sub, mount)
+}
+
+// getDirectoryContents retrieves all files below a directory with a Contents
+// API call per directory and per file
+func (c *Client) getDirectoryContents(owner, repo, path, ref string) (map[string]*FileInfo, error) {
 	result := make(map[string]*FileInfo)
 
 	_, directoryContent, _, err := c.client.Repositories.GetContents(
@@ -130,7 +355,7 @@ func (c *Client) GetDirectory(owner, repo, path, ref string) (map[string]*FileIn
 	)
 
 	if err != nil {
-		return nil, fmt.Errorf("error getting directory content: %w", err)
+		return nil, fmt.Errorf("error getting directory content: %w", classify(err))
 	}
 
 	// If it's not a directory
@@ -145,15 +370,15 @@ func (c *Client) GetDirectory(owner, repo, path, ref string) (map[string]*FileIn
 			// Get the file content
 			fileInfo, err := c.GetFile(owner, repo, item.GetPath(), ref)
 			if err != nil {
-				continue // Skip files that can't be retrieved
+				return nil, fmt.Errorf("error getting %s: %w", item.GetPath(), err)
 			}
 			result[item.GetPath()] = fileInfo
 
 		case "dir":
 			// Recursively get the directory content
-			subdir, err := c.GetDirectory(owner, repo, item.GetPath(), ref)
+			subdir, err := c.getDirectoryContents(owner, repo, item.GetPath(), ref)
 			if err != nil {
-				continue // Skip directories that can't be retrieved
+				return nil, err
 			}
 			// Add all files from subdirectory
 			for k, v := range subdir {
@@ -165,11 +390,15 @@ func (c *Client) GetDirectory(owner, repo, path, ref string) (map[string]*FileIn
 	return result, nil
 }
 
-// GetCommitsSince gets all commits for a file since a specific date or commit
-func (c *Client) GetCommitsSince(owner, repo, path string, since time.Time, sinceCommit string) ([]CommitInfo, error) {
+// GetCommitsSince gets the commits to a file on a branch (or the default
+// branch if ref is empty) since a specific date or commit, newest first. If
+// sinceCommit isn't in the file's history, for example after a force push, all
+// commits are returned.
+func (c *Client) GetCommitsSince(owner, repo, path, ref string, since time.Time, sinceCommit string) ([]CommitInfo, error) {
 	var result []CommitInfo
 
 	options := &github.CommitsListOptions{
+		SHA:  ref,
 		Path: path,
 		ListOptions: github.ListOptions{
 			PerPage: 100,
@@ -180,29 +409,22 @@ func (c *Client) GetCommitsSince(owner, repo, path string, since time.Time, sinc
 		options.Since = since
 	}
 
-	foundSinceCommit := sinceCommit == ""
+	foundSinceCommit := false
 	page := 1
 
 	for {
 		options.Page = page
 		commits, resp, err := c.client.Repositories.ListCommits(c.ctx, owner, repo, options)
 		if err != nil {
-			return nil, fmt.Errorf("error listing commits: %w", err)
+			return nil, fmt.Errorf("error listing commits: %w", classify(err))
 		}
 
 		for _, commit := range commits {
-			// If tracking since a specific commit, skip until we find it
-			if !foundSinceCommit {
-				if commit.GetSHA() == sinceCommit {
-					foundSinceCommit = true
-					break
-				}
-				continue
-			}
-
-			// Skip the sinceCommit itself
-			if commit.GetSHA() == sinceCommit {
-				continue
+			// Commits are listed newest first, so everything before
+			// sinceCommit is new
+			if sinceCommit != "" && commit.GetSHA() == sinceCommit {
+				foundSinceCommit = true
+				break
 			}
 
 			// Add commit info
@@ -210,6 +432,7 @@ func (c *Client) GetCommitsSince(owner, repo, path string, since time.Time, sinc
 				SHA:     commit.GetSHA(),
 				Message: commit.Commit.GetMessage(),
 				Author:  commit.Commit.Author.GetName(),
+				Email:   commit.Commit.Author.GetEmail(),
 			}
 
 			if commit.Commit.Author != nil {
@@ -227,6 +450,18 @@ func (c *Client) GetCommitsSince(owner, repo, path string, since time.Time, sinc
 		page = resp.NextPage
 	}
 
+	// Files in a submodule have no history in the repository, which only
+	// records the commits that move the submodule to another commit
+	if len(result) == 0 && !foundSinceCommit {
+		sub, err := c.resolveSubmodule(owner, repo, path, ref)
+		if err != nil {
+			return nil, err
+		}
+		if sub != nil && sub.Path != "" {
+			return c.GetCommitsSince(owner, repo, sub.mount(path), ref, since, sinceCommit)
+		}
+	}
+
 	return result, nil
 }
 
@@ -243,7 +478,7 @@ func (c *Client) GetFileDiff(owner, repo, path, baseRef, headRef string) (string
 	)
 
 	if err != nil {
-		return "", fmt.Errorf("error comparing commits: %w", err)
+		return "", fmt.Errorf("error comparing commits: %w", classify(err))
 	}
 
 	// Find the file in the comparison files
@@ -264,20 +499,258 @@ func (c *Client) GetFileDiff(owner, repo, path, baseRef, headRef string) (string
 	return "", fmt.Errorf("file %s was not changed between %s and %s", path, baseRef, headRef)
 }
 
+// ListFiles lists every file in a repository at the given ref. Very large
+// repositories may be truncated by the API.
+func (c *Client) ListFiles(owner, repo, ref string) ([]TreeEntry, error) {
+	tree, _, err := c.client.Git.GetTree(c.ctx, owner, repo, ref, true)
+	if err != nil {
+		return nil, fmt.Errorf("error getting repository tree: %w", classify(err))
+	}
+
+	var files []TreeEntry
+	for _, entry := range tree.Entries {
+		if entry.GetType() != "blob" {
+			continue
+		}
+		files = append(files, TreeEntry{Path: entry.GetPath(), SHA: entry.GetSHA(), Size: entry.GetSize()})
+	}
+
+	return files, nil
+}
+
+// GetBlob gets the content of a file by its blob SHA
+func (c *Client) GetBlob(owner, repo, sha string) ([]byte, error) {
+	content, _, err := c.client.Git.GetBlobRaw(c.ctx, owner, repo, sha)
+	if err != nil {
+		return nil, fmt.Errorf("error getting blob: %w", classify(err))
+	}
+	return content, nil
+}
+
+// GetRelease gets the release published for a tag. It returns nil if the tag
+// has no release.
+func (c *Client) GetRelease(owner, repo, tag string) (*ReleaseInfo, error) {
+	release, resp, err := c.client.Repositories.GetReleaseByTag(c.ctx, owner, repo, tag)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting release: %w", classify(err))
+	}
+
+	return &ReleaseInfo{
+		Tag:  release.GetTagName(),
+		Name: release.GetName(),
+		Body: release.GetBody(),
+		URL:  release.GetHTMLURL(),
+	}, nil
+}
+
+// ListReleases lists the published releases of a repository, newest first.
+// Drafts aren't listed.
+func (c *Client) ListReleases(owner, repo string) ([]*ReleaseInfo, error) {
+	var result []*ReleaseInfo
+	options := &github.ListOptions{PerPage: 100}
+	for {
+		releases, resp, err := c.client.Repositories.ListReleases(c.ctx, owner, repo, options)
+		if err != nil {
+			return nil, fmt.Errorf("error listing releases: %w", classify(err))
+		}
+		for _, release := range releases {
+			if release.GetDraft() {
+				continue
+			}
+			result = append(result, &ReleaseInfo{
+				Tag:        release.GetTagName(),
+				Name:       release.GetName(),
+				Body:       release.GetBody(),
+				URL:        release.GetHTMLURL(),
+				Prerelease: release.GetPrerelease(),
+			})
+		}
+		if resp.NextPage == 0 {
+			return result, nil
+		}
+		options.Page = resp.NextPage
+	}
+}
+
+// RepositoryInfo represents the access details of a repository
+type RepositoryInfo struct {
+	Owner   string
+	Name    string
+	Private bool
+}
+
+// GetRepository gets a repository's details. It returns nil if the repository
+// doesn't exist or the token can't see it, which GitHub doesn't distinguish.
+func (c *Client) GetRepository(owner, repo string) (*RepositoryInfo, error) {
+	repository, resp, err := c.client.Repositories.Get(c.ctx, owner, repo)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting repository: %w", classify(err))
+	}
+
+	return &RepositoryInfo{
+		Owner:   repository.GetOwner().GetLogin(),
+		Name:    repository.GetName(),
+		Private: repository.GetPrivate(),
+	}, nil
+}
+
+// ErrBadCredentials is returned when GitHub rejects the token
+var ErrBadCredentials = errors.New("GitHub rejected the token (invalid, expired or revoked)")
+
+// TokenScopes returns the OAuth scopes granted to the token. ok is false for
+// tokens that don't report scopes, such as fine-grained personal access
+// tokens and GitHub App installation tokens.
+func (c *Client) TokenScopes() (scopes []string, ok bool, err error) {
+	_, resp, err := c.client.Users.Get(c.ctx, "")
+	if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+		return nil, false, ErrBadCredentials
+	}
+	// Installation tokens can't read /user but still carry a (missing)
+	// scopes header
+	if err != nil && (resp == nil || resp.StatusCode != http.StatusForbidden) {
+		return nil, false, fmt.Errorf("error checking token: %w", err)
+	}
+
+	header, ok := resp.Header["X-Oauth-Scopes"]
+	if !ok {
+		return nil, false, nil
+	}
+	for _, value := range header {
+		for _, scope := range strings.Split(value, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes, true, nil
+}
+
+// blameQuery fetches the blame ranges of a file at a ref
+const blameQuery = `query($owner: String!, $repo: String!, $ref: String!, $path: String!) {
+  repository(owner: $owner, name: $repo) {
+    object(expression: $ref) {
+      ... on Commit {
+        blame(path: $path) {
+          ranges {
+            startingLine
+            endingLine
+            commit {
+              oid
+              committedDate
+              author { name user { login } }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// GetBlame returns who last changed each line of a file at ref, indexed by
+// line number minus one. Blame is only available through the GraphQL API.
+func (c *Client) GetBlame(owner, repo, path, ref string) ([]*diff.Attribution, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"query": blameQuery,
+		"variables": map[string]string{
+			"owner": owner,
+			"repo":  repo,
+			"ref":   ref,
+			"path":  path,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error encoding blame query: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(c.ctx, "POST", c.graphqlURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp.StatusCode)
+	}
+
+	var result struct {
+		Data struct {
+			Repository struct {
+				Object struct {
+					Blame struct {
+						Ranges []struct {
+							StartingLine int `json:"startingLine"`
+							EndingLine   int `json:"endingLine"`
+							Commit       struct {
+								OID           string    `json:"oid"`
+								CommittedDate time.Time `json:"committedDate"`
+								Author        struct {
+									Name string `json:"name"`
+									User *struct {
+										Login string `json:"login"`
+									} `json:"user"`
+								} `json:"author"`
+							} `json:"commit"`
+						} `json:"ranges"`
+					} `json:"blame"`
+				} `json:"object"`
+			} `json:"repository"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error parsing blame response: %w", err)
+	}
+	if len(result.Errors) > 0 {
+		return nil, fmt.Errorf("error getting blame: %s", result.Errors[0].Message)
+	}
+
+	var lines []*diff.Attribution
+	for _, r := range result.Data.Repository.Object.Blame.Ranges {
+		author := r.Commit.Author.Name
+		if r.Commit.Author.User != nil && r.Commit.Author.User.Login != "" {
+			author = r.Commit.Author.User.Login
+		}
+
+		attribution := &diff.Attribution{Author: author, Commit: r.Commit.OID, Date: r.Commit.CommittedDate}
+		for line := r.StartingLine; line <= r.EndingLine && line > 0; line++ {
+			for len(lines) < line {
+				lines = append(lines, nil)
+			}
+			lines[line-1] = attribution
+		}
+	}
+
+	return lines, nil
+}
+
 // GetRawFile gets the raw content of a file without processing
 func (c *Client) GetRawFile(owner, repo, path, ref string) ([]byte, error) {
 	// Construct the raw URL
-	url := fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/%s/%s",
-		owner, repo, ref, path)
+	rawURL := fmt.Sprintf("%s/%s/%s/%s/%s",
+		c.rawURL, owner, repo, ref, path)
 
 	// Create a new request
-	req, err := http.NewRequestWithContext(c.ctx, "GET", url, nil)
+	req, err := http.NewRequestWithContext(c.ctx, "GET", rawURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
 
 	// Send the request
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.raw.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("error sending request: %w", err)
 	}
@@ -285,7 +758,7 @@ func (c *Client) GetRawFile(owner, repo, path, ref string) ([]byte, error) {
 
 	// Check status code
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("received status code %d", resp.StatusCode)
+		return nil, statusError(resp.StatusCode)
 	}
 
 	// Read the response body
@@ -294,11 +767,18 @@ func (c *Client) GetRawFile(owner, repo, path, ref string) ([]byte, error) {
 		return nil, fmt.Errorf("error reading response body: %w", err)
 	}
 
-	return body, nil
+	return c.resolveLFS(owner, repo, body)
 }
 
 // ExtractFunction attempts to extract a function from a file
 func (c *Client) ExtractFunction(content, language, functionName string) (string, error) {
+	return ExtractFunction(content, language, functionName)
+}
+
+// ExtractFunction extracts a function from source code in one of the
+// supported languages. Parsing is local, so it works for content from any
+// code host.
+func ExtractFunction(content, language, functionName string) (string, error) {
 	switch language {
 	case "go":
 		return extractGoFunction(content, functionName)
@@ -307,26 +787,26 @@ func (c *Client) ExtractFunction(content, language, functionName string) (string
 	case "javascript", "js":
 		return extractJavaScriptFunction(content, functionName)
 	default:
-		return "", fmt.Errorf("unsupported language: %s", language)
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedLanguage, language)
 	}
 }
 
 // isNamedFunction checks if a node is a function declaration with the given name.
-func isNamedFunction(node *sitter.Node, name string) bool {
+func isNamedFunction(node *sitter.Node, source []byte, name string) bool {
 	if node.Type() == "function_declaration" {
 		identifier := node.ChildByFieldName("name")
-		return identifier != nil && identifier.Content([]byte(name)) == name
+		return identifier != nil && identifier.Content(source) == name
 	}
 
 	return false
 }
 
-func walk(n *sitter.Node, result **sitter.Node, functionName string) {
+func walk(n *sitter.Node, source []byte, result **sitter.Node, functionName string) {
 	if *result != nil {
 		return // already found
 	}
 
-	if isNamedFunction(n, functionName) {
+	if isNamedFunction(n, source, functionName) {
 		*result = n
 		return
 	}
@@ -334,7 +814,7 @@ func walk(n *sitter.Node, result **sitter.Node, functionName string) {
 	for i := 0; i < int(n.ChildCount()); i++ {
 		child := n.Child(i)
 		if child != nil {
-			walk(child, result, functionName)
+			walk(child, source, result, functionName)
 		}
 	}
 }
@@ -363,7 +843,7 @@ func extractGoFunction(content, functionName string) (string, error) {
 	})
 
 	if funcDecl == nil {
-		return "", fmt.Errorf("function %s not found", functionName)
+		return "", fmt.Errorf("function %s %w", functionName, ErrNotFound)
 	}
 
 	// Get the function's position in the source
@@ -391,13 +871,24 @@ func extractPythonFunction(content, functionName string) (string, error) {
 	lines := strings.Split(content, "\n")
 
 	start := -1
-	inFunction := false
+	last := -1
 	indent := -1
-	docstring := false
+	docstring := "" // Delimiter of the triple-quoted string a line is in
+	parens := 0     // Brackets the signature has left open
 
 	for i, line := range lines {
 		trimmedLine := strings.TrimSpace(line)
 
+		// Lines of a multi-line string belong to the function, whatever
+		// their indentation
+		if docstring != "" {
+			if strings.Contains(trimmedLine, docstring) {
+				docstring = ""
+			}
+			last = i
+			continue
+		}
+
 		// Skip empty lines and comments
 		if trimmedLine == "" || strings.HasPrefix(trimmedLine, "#") {
 			continue
@@ -407,35 +898,45 @@ func extractPythonFunction(content, functionName string) (string, error) {
 		lineIndent := len(line) - len(strings.TrimLeft(line, " \t"))
 
 		// Look for function definition
-		if !inFunction && strings.HasPrefix(trimmedLine, "def "+functionName+"(") {
-			start = i
-			inFunction = true
-			indent = lineIndent
+		if start == -1 {
+			if strings.HasPrefix(trimmedLine, "def "+functionName+"(") {
+				start, last, indent = i, i, lineIndent
+				parens = strings.Count(line, "(") - strings.Count(line, ")")
+			}
 			continue
 		}
 
-		// Handle docstrings
-		if inFunction && (strings.HasPrefix(trimmedLine, `"""`) || strings.HasPrefix(trimmedLine, `'''`)) {
-			docstring = !docstring
+		// The rest of a signature split over lines may be indented like the
+		// def, like its closing parenthesis usually is
+		if parens > 0 {
+			parens += strings.Count(line, "(") - strings.Count(line, ")")
+			last = i
 			continue
 		}
 
-		// If we're in a function and hit a line with same or less indentation, we're done
-		if inFunction && !docstring && lineIndent <= indent && !strings.HasPrefix(trimmedLine, "#") {
-			return strings.Join(lines[start:i], "\n"), nil
+		// A line with the same or less indentation ends the function, which
+		// ends at its last line that isn't blank or a comment
+		if lineIndent <= indent {
+			break
+		}
+		last = i
+
+		// A triple quote left open starts a multi-line string
+		for _, quote := range []string{`"""`, `'''`} {
+			if strings.Count(trimmedLine, quote)%2 == 1 {
+				docstring = quote
+				break
+			}
 		}
 	}
 
 	if start == -1 {
-		return "", fmt.Errorf("function %s not found", functionName)
+		return "", fmt.Errorf("function %s %w", functionName, ErrNotFound)
 	}
-
-	// If we reached the end of the file while still in the function
-	if inFunction {
-		return strings.Join(lines[start:], "\n"), nil
+	if docstring != "" {
+		return "", fmt.Errorf("function %s seems incomplete", functionName)
 	}
-
-	return "", fmt.Errorf("function %s seems incomplete", functionName)
+	return strings.Join(lines[start:last+1], "\n"), nil
 }
 
 func extractJavaScriptFunction(content, functionName string) (string, error) {
@@ -444,7 +945,8 @@ func extractJavaScriptFunction(content, functionName string) (string, error) {
 	parser.SetLanguage(javascript.GetLanguage())
 
 	// Parse the content
-	tree, err := parser.ParseCtx(context.Background(), nil, []byte(content))
+	source := []byte(content)
+	tree, err := parser.ParseCtx(context.Background(), nil, source)
 	if err != nil {
 		return "", fmt.Errorf("error parsing JavaScript content: %w", err)
 	}
@@ -452,10 +954,10 @@ func extractJavaScriptFunction(content, functionName string) (string, error) {
 
 	// Find the function node
 	var functionNode *sitter.Node
-	walk(tree.RootNode(), &functionNode, functionName)
+	walk(tree.RootNode(), source, &functionNode, functionName)
 
 	if functionNode == nil {
-		return "", fmt.Errorf("function %s not found", functionName)
+		return "", fmt.Errorf("function %s %w", functionName, ErrNotFound)
 	}
 
 	// Extract the function content
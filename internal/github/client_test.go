@@ -2,9 +2,15 @@ package github
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-github/v52/github"
 )
@@ -69,6 +75,28 @@ def another_func():
 		t.Errorf("Expected:\n%s\n\nGot:\n%s", expected, result)
 	}
 
+	// Test a split signature and a docstring whose lines aren't indented
+	code = `
+def split_func(
+    a,
+):
+    """First line
+of the docstring
+    """
+    return a
+
+def another_func():
+    return "hello"
+`
+	result, err = extractPythonFunction(code, "split_func")
+	if err != nil {
+		t.Fatalf("Failed to extract function: %v", err)
+	}
+	expected = strings.TrimSpace(code[:strings.Index(code, "def another_func")])
+	if result != expected {
+		t.Errorf("Expected:\n%s\n\nGot:\n%s", expected, result)
+	}
+
 	// Test function not found
 	_, err = extractPythonFunction(code, "non_existent_func")
 	if err == nil {
@@ -117,6 +145,64 @@ const obj = {
 	}
 }
 
+// FuzzExtractFunction feeds malformed and pathological source to the parsers,
+// which run on whatever upstream files contain
+func FuzzExtractFunction(f *testing.F) {
+	f.Add("package main\n\nfunc Add(a, b int) int {\n\treturn a + b\n}\n", uint8(0), "Add")
+	f.Add("def add(a, b):\n    \"\"\"Adds\"\"\"\n    return a + b\n", uint8(1), "add")
+	f.Add("function add(a, b) {\n  return a + b;\n}\n", uint8(2), "add")
+	f.Add("function ünïcödé() { return '\u202e'; }", uint8(2), "ünïcödé")
+	f.Add("func F() {"+strings.Repeat("{", 1000), uint8(0), "F")
+	f.Add("function f() {"+strings.Repeat("(", 1000), uint8(2), "f")
+	f.Add("def f(:\n\t\x00\xff", uint8(1), "f")
+
+	languages := []string{"go", "python", "javascript"}
+	f.Fuzz(func(t *testing.T, content string, language uint8, name string) {
+		function, err := ExtractFunction(content, languages[int(language)%len(languages)], name)
+		if err == nil && !strings.Contains(content, function) {
+			t.Errorf("Extracted function %q isn't part of the source", function)
+		}
+	})
+}
+
+func TestCancelledRequests(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Never answer until the client gives up
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := NewClient("test-token")
+	client.SetBaseURL(server.URL)
+	client.rawURL = server.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	client.SetContext(ctx)
+	start := time.Now()
+	if _, err := client.GetFile("owner", "repo", "file.go", "main"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected GetFile to fail with the deadline, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected GetFile to give up at the deadline, took %s", elapsed)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	client.SetContext(ctx)
+	if _, err := client.GetRawFile("owner", "repo", "file.go", "main"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected GetRawFile to fail as cancelled, got %v", err)
+	}
+	if _, err := client.GetDirectory("owner", "repo", "src", "main"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected GetDirectory to fail as cancelled, got %v", err)
+	}
+}
+
 // Mock server for testing HTTP requests
 func setupMockServer() (*httptest.Server, *Client) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -179,16 +265,238 @@ func TestGetFile(t *testing.T) {
 }
 
 func TestGetDirectory(t *testing.T) {
-	// This would need mocking the GitHub API
-	t.Skip("Requires mocking GitHub API")
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/repos/acme/utils/git/trees/main":
+			if r.URL.Query().Get("recursive") == "" {
+				t.Errorf("Expected a recursive tree request, got %s", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `{"sha": "root", "truncated": false, "tree": [
+				{"path": "README.md", "type": "blob", "sha": "b0"},
+				{"path": "lib", "type": "tree", "sha": "t1"},
+				{"path": "lib/a.go", "type": "blob", "sha": "b1"},
+				{"path": "lib/sub", "type": "tree", "sha": "t2"},
+				{"path": "lib/sub/b.go", "type": "blob", "sha": "b2"},
+				{"path": "library.go", "type": "blob", "sha": "b3"}
+			]}`)
+		case "/repos/acme/utils/git/blobs/b1":
+			fmt.Fprint(w, "package lib\n")
+		case "/repos/acme/utils/git/blobs/b2":
+			fmt.Fprint(w, "package sub\n")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	files, err := client.GetDirectory("acme", "utils", "lib", "main")
+	if err != nil {
+		t.Fatalf("GetDirectory failed: %v", err)
+	}
+	if len(files) != 2 || files["lib/a.go"].Content != "package lib\n" || files["lib/sub/b.go"].SHA != "b2" {
+		t.Errorf("Expected the files below lib, got %+v", files)
+	}
+	if len(requests) != 3 {
+		t.Errorf("Expected one tree and two blob requests, got %v", requests)
+	}
+
+	if _, err := client.GetDirectory("acme", "utils", "library.go", "main"); err == nil {
+		t.Error("Expected an error for a path that isn't a directory")
+	}
+}
+
+func TestListReleases(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/acme/lib/releases" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `[{"tag_name": "v1.0.0"}]`)
+			return
+		}
+		w.Header().Set("Link", fmt.Sprintf(`<%s/repos/acme/lib/releases?page=2>; rel="next"`, "http://"+r.Host))
+		fmt.Fprint(w, `[
+			{"tag_name": "v2.0.0", "draft": true},
+			{"tag_name": "v1.1.0-rc.1", "prerelease": true},
+			{"tag_name": "v1.0.1", "html_url": "https://github.com/acme/lib/releases/v1.0.1"}
+		]`)
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.SetBaseURL(server.URL)
+
+	releases, err := client.ListReleases("acme", "lib")
+	if err != nil {
+		t.Fatalf("ListReleases failed: %v", err)
+	}
+	var tags []string
+	for _, release := range releases {
+		tags = append(tags, release.Tag)
+	}
+	if fmt.Sprint(tags) != "[v1.1.0-rc.1 v1.0.1 v1.0.0]" || !releases[0].Prerelease {
+		t.Errorf("Expected the published releases of both pages, got %v", tags)
+	}
 }
 
 func TestGetCommitsSince(t *testing.T) {
-	// This would need mocking the GitHub API
-	t.Skip("Requires mocking GitHub API")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("path") != "strings.go" {
+			t.Errorf("Unexpected path filter: %s", r.URL.RawQuery)
+		}
+		if r.URL.Query().Get("sha") == "release-1.x" {
+			fmt.Fprint(w, `[{"sha": "rrr", "commit": {"message": "Backport", "author": {"name": "Rita", "date": "2024-03-04T00:00:00Z"}}}]`)
+			return
+		}
+		fmt.Fprint(w, `[
+			{"sha": "ccc", "commit": {"message": "Third", "author": {"name": "Carol", "date": "2024-03-03T00:00:00Z"}}},
+			{"sha": "bbb", "commit": {"message": "Second", "author": {"name": "Bob", "date": "2024-03-02T00:00:00Z"}}},
+			{"sha": "aaa", "commit": {"message": "First", "author": {"name": "Alice", "date": "2024-03-01T00:00:00Z"}}}
+		]`)
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	commits, err := client.GetCommitsSince("acme", "utils", "strings.go", "", time.Time{}, "bbb")
+	if err != nil {
+		t.Fatalf("GetCommitsSince failed: %v", err)
+	}
+	if len(commits) != 1 || commits[0].SHA != "ccc" || commits[0].Author != "Carol" {
+		t.Errorf("Expected only the commit after bbb, got %+v", commits)
+	}
+
+	if commits, _ := client.GetCommitsSince("acme", "utils", "strings.go", "", time.Time{}, ""); len(commits) != 3 {
+		t.Errorf("Expected all commits without a starting commit, got %d", len(commits))
+	}
+	if commits, _ := client.GetCommitsSince("acme", "utils", "strings.go", "", time.Time{}, "rewritten"); len(commits) != 3 {
+		t.Errorf("Expected all commits when the starting commit is gone, got %d", len(commits))
+	}
+	if commits, _ := client.GetCommitsSince("acme", "utils", "strings.go", "release-1.x", time.Time{}, ""); len(commits) != 1 {
+		t.Errorf("Expected only the commits on release-1.x, got %d", len(commits))
+	}
+}
+
+func TestNewEnterpriseClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			t.Errorf("Expected the token on %s", r.URL.Path)
+		}
+		switch r.URL.Path {
+		case "/api/v3/repos/acme/utils/commits":
+			fmt.Fprint(w, `[{"sha": "aaa", "commit": {"message": "First", "author": {"name": "Alice", "date": "2024-03-01T00:00:00Z"}}}]`)
+		case "/raw/acme/utils/main/strings.go":
+			fmt.Fprint(w, "package strings\n")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client, err := NewEnterpriseClient("test-token", server.URL, "")
+	if err != nil {
+		t.Fatalf("NewEnterpriseClient failed: %v", err)
+	}
+	if client.graphqlURL != server.URL+"/api/graphql" {
+		t.Errorf("Unexpected GraphQL URL: %s", client.graphqlURL)
+	}
+
+	if commits, err := client.GetCommitsSince("acme", "utils", "strings.go", "", time.Time{}, ""); err != nil || len(commits) != 1 {
+		t.Errorf("Expected commits from the API path, got %+v, %v", commits, err)
+	}
+	raw, err := client.GetRawFile("acme", "utils", "strings.go", "main")
+	if err != nil || string(raw) != "package strings\n" {
+		t.Errorf("Expected the raw file from the instance, got %q, %v", raw, err)
+	}
+
+	if _, err := NewEnterpriseClient("test-token", "://bad", ""); err == nil {
+		t.Error("Expected an invalid URL to fail")
+	}
+}
+
+func TestTokenScopes(t *testing.T) {
+	header := "repo, workflow"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/user":
+			if header != "" {
+				w.Header().Set("X-OAuth-Scopes", header)
+			}
+			fmt.Fprint(w, `{"login": "octocat"}`)
+		case "/repos/acme/utils":
+			fmt.Fprint(w, `{"name": "utils", "owner": {"login": "acme"}, "private": true}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.client.BaseURL, _ = url.Parse(server.URL + "/")
+
+	scopes, ok, err := client.TokenScopes()
+	if err != nil || !ok || len(scopes) != 2 || scopes[1] != "workflow" {
+		t.Errorf("Unexpected scopes: %v %v %v", scopes, ok, err)
+	}
+
+	header = ""
+	if _, ok, err := client.TokenScopes(); err != nil || ok {
+		t.Errorf("Expected unknown scopes without the header, got %v %v", ok, err)
+	}
+
+	repo, err := client.GetRepository("acme", "utils")
+	if err != nil || repo == nil || !repo.Private {
+		t.Errorf("Unexpected repository: %+v %v", repo, err)
+	}
+	if repo, err := client.GetRepository("acme", "secret"); err != nil || repo != nil {
+		t.Errorf("Expected nil for an invisible repository, got %+v %v", repo, err)
+	}
 }
 
 func TestGetFileDiff(t *testing.T) {
 	// This would need mocking the GitHub API
 	t.Skip("Requires mocking GitHub API")
 }
+
+func TestGetBlame(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Variables map[string]string `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Variables["path"] != "strings.go" || req.Variables["ref"] != "abc123" {
+			t.Errorf("Unexpected query variables: %v", req.Variables)
+		}
+
+		fmt.Fprint(w, `{"data": {"repository": {"object": {"blame": {"ranges": [
+			{"startingLine": 1, "endingLine": 2, "commit": {"oid": "1111111aaaa", "committedDate": "2024-03-01T10:00:00Z", "author": {"name": "Alice", "user": {"login": "alice"}}}},
+			{"startingLine": 3, "endingLine": 3, "commit": {"oid": "2222222bbbb", "committedDate": "2024-05-02T10:00:00Z", "author": {"name": "Bob", "user": null}}}
+		]}}}}}`)
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.graphqlURL = server.URL
+
+	lines, err := client.GetBlame("acme", "utils", "strings.go", "abc123")
+	if err != nil {
+		t.Fatalf("GetBlame failed: %v", err)
+	}
+
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 attributed lines, got %d", len(lines))
+	}
+	if lines[0].Author != "alice" || lines[1] != lines[0] {
+		t.Errorf("Unexpected attribution for lines 1-2: %+v %+v", lines[0], lines[1])
+	}
+	if lines[2].Author != "Bob" || lines[2].Commit != "2222222bbbb" {
+		t.Errorf("Expected author name when there is no user: %+v", lines[2])
+	}
+}
@@ -0,0 +1,142 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/v52/github"
+)
+
+// Fork strategies of a contribution
+const (
+	ForkAuto   = "auto"   // Fork only if the token can't push to the repository
+	ForkAlways = "always" // Push to a fork of the token's user
+	ForkNever  = "never"  // Push to the repository itself
+)
+
+// Contribution is a change to a file proposed to a repository as a pull
+// request
+type Contribution struct {
+	Owner   string
+	Repo    string
+	Base    string // Branch the pull request targets (default: the repository's default branch)
+	Parent  string // Commit the change applies to, which the new branch starts from
+	Branch  string // Branch created for the change
+	Path    string
+	Content string
+	Title   string // Also the commit message
+	Body    string
+	Fork    string // ForkAuto (default), ForkAlways or ForkNever
+}
+
+// PullRequest is a pull request opened by Contribute
+type PullRequest struct {
+	Number int
+	URL    string
+	Head   string // owner:branch the pull request merges
+}
+
+// forkAttempts and forkWait bound how long Contribute waits for a new fork,
+// which GitHub creates in the background
+var (
+	forkAttempts = 10
+	forkWait     = 2 * time.Second
+)
+
+// Contribute opens a pull request with a change to a file: it creates a
+// branch from the change's parent commit, in the repository or a fork as the
+// fork strategy says, commits the new content to it and opens the pull
+// request against the base branch. Starting from the parent means the pull
+// request only carries the change, even if the base branch moved on since.
+func (c *Client) Contribute(contribution Contribution) (*PullRequest, error) {
+	upstream, _, err := c.client.Repositories.Get(c.ctx, contribution.Owner, contribution.Repo)
+	if err != nil {
+		return nil, fmt.Errorf("error getting repository: %w", classify(err))
+	}
+	base := contribution.Base
+	if base == "" {
+		base = upstream.GetDefaultBranch()
+	}
+
+	headOwner, headRepo := contribution.Owner, contribution.Repo
+	canPush := upstream.GetPermissions()["push"]
+	switch contribution.Fork {
+	case ForkAlways:
+		canPush = false
+	case ForkNever:
+		if !canPush {
+			return nil, fmt.Errorf("the token can't push to %s/%s", contribution.Owner, contribution.Repo)
+		}
+	}
+	if !canPush {
+		fork, _, err := c.client.Repositories.CreateFork(c.ctx, contribution.Owner, contribution.Repo, nil)
+		var accepted *github.AcceptedError
+		if err != nil && !errors.As(err, &accepted) {
+			return nil, fmt.Errorf("error forking %s/%s: %w", contribution.Owner, contribution.Repo, classify(err))
+		}
+		headOwner, headRepo = fork.GetOwner().GetLogin(), fork.GetName()
+	}
+
+	if err := c.createBranch(headOwner, headRepo, contribution.Branch, contribution.Parent, headRepo != contribution.Repo || headOwner != contribution.Owner); err != nil {
+		return nil, err
+	}
+
+	options := &github.RepositoryContentFileOptions{
+		Message: github.String(contribution.Title),
+		Content: []byte(contribution.Content),
+		Branch:  github.String(contribution.Branch),
+	}
+	existing, _, resp, err := c.client.Repositories.GetContents(c.ctx, headOwner, headRepo, contribution.Path,
+		&github.RepositoryContentGetOptions{Ref: contribution.Branch})
+	switch {
+	case err == nil && existing == nil:
+		err = errors.New("it is a directory")
+	case err == nil:
+		options.SHA = existing.SHA
+		_, _, err = c.client.Repositories.UpdateFile(c.ctx, headOwner, headRepo, contribution.Path, options)
+	case resp != nil && resp.StatusCode == http.StatusNotFound:
+		_, _, err = c.client.Repositories.CreateFile(c.ctx, headOwner, headRepo, contribution.Path, options)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error committing %s: %w", contribution.Path, classify(err))
+	}
+
+	head := headOwner + ":" + contribution.Branch
+	pull, _, err := c.client.PullRequests.Create(c.ctx, contribution.Owner, contribution.Repo, &github.NewPullRequest{
+		Title:               github.String(contribution.Title),
+		Head:                github.String(head),
+		Base:                github.String(base),
+		Body:                github.String(contribution.Body),
+		MaintainerCanModify: github.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error opening pull request: %w", classify(err))
+	}
+	return &PullRequest{Number: pull.GetNumber(), URL: pull.GetHTMLURL(), Head: head}, nil
+}
+
+// createBranch creates a branch at a commit. A fork may not be ready yet, so
+// creating a branch in one is retried while the fork can't be found.
+func (c *Client) createBranch(owner, repo, branch, sha string, fork bool) error {
+	ref := &github.Reference{Ref: github.String("refs/heads/" + branch), Object: &github.GitObject{SHA: github.String(sha)}}
+	for attempt := 1; ; attempt++ {
+		_, resp, err := c.client.Git.CreateRef(c.ctx, owner, repo, ref)
+		if err == nil {
+			return nil
+		}
+		switch {
+		case resp != nil && resp.StatusCode == http.StatusUnprocessableEntity:
+			return fmt.Errorf("can't create branch %s in %s/%s, it may already exist: %w", branch, owner, repo, err)
+		case fork && attempt < forkAttempts && resp != nil && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusConflict):
+			select {
+			case <-time.After(forkWait):
+			case <-c.ctx.Done():
+				return c.ctx.Err()
+			}
+		default:
+			return fmt.Errorf("error creating branch %s: %w", branch, classify(err))
+		}
+	}
+}
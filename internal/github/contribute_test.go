@@ -0,0 +1,80 @@
+package github
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestContribute(t *testing.T) {
+	forkReady := false
+	var requests []string
+	var committed, opened map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "GET /repos/acme/lib":
+			w.Write([]byte(`{"name": "lib", "default_branch": "main", "permissions": {"pull": true, "push": false}}`))
+		case "POST /repos/acme/lib/forks":
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte(`{"name": "lib", "owner": {"login": "ana"}}`))
+		case "POST /repos/ana/lib/git/refs":
+			// The fork takes a moment to be ready
+			if !forkReady {
+				forkReady = true
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"message": "Not Found"}`))
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ref": "refs/heads/fix"}`))
+		case "GET /repos/ana/lib/contents/lib.go":
+			w.Write([]byte(`{"type": "file", "sha": "blob1", "path": "lib.go", "encoding": "base64", "content": ""}`))
+		case "PUT /repos/ana/lib/contents/lib.go":
+			json.Unmarshal(body, &committed)
+			w.Write([]byte(`{}`))
+		case "POST /repos/acme/lib/pulls":
+			json.Unmarshal(body, &opened)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"number": 7, "html_url": "https://github.com/acme/lib/pull/7"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	defer func(wait time.Duration) { forkWait = wait }(forkWait)
+	forkWait = time.Millisecond
+	client := NewClient("test-token")
+	if err := client.SetBaseURL(server.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	pr, err := client.Contribute(Contribution{
+		Owner: "acme", Repo: "lib", Parent: "c1", Branch: "fix",
+		Path: "lib.go", Content: "package lib // fixed\n", Title: "Fix lib", Body: "From billing",
+	})
+	if err != nil {
+		t.Fatalf("Contribute failed: %v", err)
+	}
+	if pr.Number != 7 || pr.Head != "ana:fix" {
+		t.Errorf("Unexpected pull request %+v", pr)
+	}
+	if committed["sha"] != "blob1" || committed["branch"] != "fix" || committed["message"] != "Fix lib" {
+		t.Errorf("Unexpected commit %v", committed)
+	}
+	if opened["head"] != "ana:fix" || opened["base"] != "main" || opened["body"] != "From billing" {
+		t.Errorf("Unexpected pull request request %v", opened)
+	}
+
+	// Without a fork, a token that can't push can't contribute
+	_, err = client.Contribute(Contribution{Owner: "acme", Repo: "lib", Parent: "c1", Branch: "fix2", Path: "lib.go", Fork: ForkNever})
+	if err == nil {
+		t.Error("Expected contributing without push access to fail")
+	}
+}
@@ -0,0 +1,173 @@
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultWebURL is the web host of github.com, where OAuth apps authorize
+const DefaultWebURL = "https://github.com"
+
+// OAuthClientID is the client ID of the OAuth app codesync logs in with, set
+// at build time with
+// -ldflags "-X github.com/exitflynn/codesync/internal/github.OAuthClientID=...".
+// The app needs the device flow enabled.
+var OAuthClientID = ""
+
+// ErrAuthorizationExpired is returned when the user didn't enter the code in
+// time
+var ErrAuthorizationExpired = errors.New("the device code expired before it was authorized; run login again")
+
+// ErrAuthorizationDenied is returned when the user cancelled the authorization
+var ErrAuthorizationDenied = errors.New("authorization was denied")
+
+// DeviceCode is the code the user enters to authorize a device flow login
+type DeviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int    `json:"expires_in"` // Seconds
+	Interval        int    `json:"interval"`   // Minimum seconds between polls
+}
+
+// DeviceFlow logs in with OAuth's device authorization grant: the user enters
+// a code on the web host while the flow polls for the token.
+type DeviceFlow struct {
+	WebURL   string       // Default: DefaultWebURL
+	ClientID string       // Default: OAuthClientID
+	Scopes   []string     // Scopes the token is requested with
+	Client   *http.Client // Default: a client with a 30 second timeout
+
+	sleep func(time.Duration) // time.Sleep if nil
+}
+
+// tokenResponse is the reply to a poll; Error is set until the user has
+// authorized the device
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+	Interval    int    `json:"interval"`
+}
+
+// Start requests a device code for the user to enter
+func (f *DeviceFlow) Start() (*DeviceCode, error) {
+	clientID := f.ClientID
+	if clientID == "" {
+		clientID = OAuthClientID
+	}
+	if clientID == "" {
+		return nil, fmt.Errorf("no OAuth client ID; pass --client-id or set CODESYNC_OAUTH_CLIENT_ID")
+	}
+
+	form := url.Values{"client_id": {clientID}}
+	if len(f.Scopes) > 0 {
+		form.Set("scope", strings.Join(f.Scopes, " "))
+	}
+
+	var code DeviceCode
+	if err := f.post("/login/device/code", form, &code); err != nil {
+		return nil, fmt.Errorf("error requesting a device code: %w", err)
+	}
+	if code.DeviceCode == "" || code.UserCode == "" {
+		return nil, fmt.Errorf("error requesting a device code: empty response")
+	}
+	return &code, nil
+}
+
+// Wait polls until the user has authorized the device code and returns the
+// access token
+func (f *DeviceFlow) Wait(code *DeviceCode) (string, error) {
+	clientID := f.ClientID
+	if clientID == "" {
+		clientID = OAuthClientID
+	}
+	sleep := f.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	// The deadline is counted in polling time, so it holds with a fake sleep
+	remaining := time.Duration(code.ExpiresIn) * time.Second
+
+	form := url.Values{
+		"client_id":   {clientID},
+		"device_code": {code.DeviceCode},
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+	}
+	for {
+		if code.ExpiresIn > 0 && remaining <= 0 {
+			return "", ErrAuthorizationExpired
+		}
+		sleep(interval)
+		remaining -= interval
+
+		var resp tokenResponse
+		if err := f.post("/login/oauth/access_token", form, &resp); err != nil {
+			return "", fmt.Errorf("error polling for the token: %w", err)
+		}
+
+		switch resp.Error {
+		case "":
+			if resp.AccessToken == "" {
+				return "", fmt.Errorf("error polling for the token: empty response")
+			}
+			return resp.AccessToken, nil
+		case "authorization_pending":
+		case "slow_down":
+			// The server asks for a longer interval, 5 seconds more by default
+			if resp.Interval > 0 {
+				interval = time.Duration(resp.Interval) * time.Second
+			} else {
+				interval += 5 * time.Second
+			}
+		case "expired_token":
+			return "", ErrAuthorizationExpired
+		case "access_denied":
+			return "", ErrAuthorizationDenied
+		default:
+			if resp.Description != "" {
+				return "", fmt.Errorf("login failed: %s: %s", resp.Error, resp.Description)
+			}
+			return "", fmt.Errorf("login failed: %s", resp.Error)
+		}
+	}
+}
+
+// post sends a form to the web host and decodes the JSON reply
+func (f *DeviceFlow) post(path string, form url.Values, v any) error {
+	webURL := f.WebURL
+	if webURL == "" {
+		webURL = DefaultWebURL
+	}
+	client := f.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimSuffix(webURL, "/")+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("received status code %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
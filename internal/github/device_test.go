@@ -0,0 +1,116 @@
+package github
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeviceFlow(t *testing.T) {
+	var polls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("client_id") != "client-123" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/login/device/code":
+			if r.Form.Get("scope") != "repo read:org" {
+				t.Errorf("Unexpected scope %q", r.Form.Get("scope"))
+			}
+			w.Write([]byte(`{"device_code": "dev-1", "user_code": "ABCD-1234", "verification_uri": "https://github.com/login/device", "expires_in": 900, "interval": 5}`))
+		case "/login/oauth/access_token":
+			if r.Form.Get("device_code") != "dev-1" {
+				t.Errorf("Unexpected device code %q", r.Form.Get("device_code"))
+			}
+			switch polls.Add(1) {
+			case 1:
+				w.Write([]byte(`{"error": "authorization_pending"}`))
+			case 2:
+				w.Write([]byte(`{"error": "slow_down", "interval": 10}`))
+			default:
+				w.Write([]byte(`{"access_token": "gho_token", "token_type": "bearer"}`))
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	var slept []time.Duration
+	flow := &DeviceFlow{
+		WebURL:   server.URL,
+		ClientID: "client-123",
+		Scopes:   []string{"repo", "read:org"},
+		sleep:    func(d time.Duration) { slept = append(slept, d) },
+	}
+
+	code, err := flow.Start()
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if code.UserCode != "ABCD-1234" {
+		t.Errorf("Expected user code ABCD-1234, got %q", code.UserCode)
+	}
+
+	token, err := flow.Wait(code)
+	if err != nil {
+		t.Fatalf("Wait failed: %v", err)
+	}
+	if token != "gho_token" {
+		t.Errorf("Expected gho_token, got %q", token)
+	}
+
+	expected := []time.Duration{5 * time.Second, 5 * time.Second, 10 * time.Second}
+	if len(slept) != len(expected) {
+		t.Fatalf("Expected %d polls, got %d", len(expected), len(slept))
+	}
+	for i := range expected {
+		if slept[i] != expected[i] {
+			t.Errorf("Poll %d: expected to wait %v, got %v", i+1, expected[i], slept[i])
+		}
+	}
+}
+
+func TestDeviceFlowErrors(t *testing.T) {
+	tests := []struct {
+		reply    string
+		expected error
+	}{
+		{`{"error": "access_denied"}`, ErrAuthorizationDenied},
+		{`{"error": "expired_token"}`, ErrAuthorizationExpired},
+	}
+
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(tt.reply))
+		}))
+
+		flow := &DeviceFlow{WebURL: server.URL, ClientID: "client-123", sleep: func(time.Duration) {}}
+		_, err := flow.Wait(&DeviceCode{DeviceCode: "dev-1", ExpiresIn: 900, Interval: 5})
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("Reply %s: expected %v, got %v", tt.reply, tt.expected, err)
+		}
+		server.Close()
+	}
+
+	// Pending until the code expires
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error": "authorization_pending"}`))
+	}))
+	defer server.Close()
+
+	flow := &DeviceFlow{WebURL: server.URL, ClientID: "client-123", sleep: func(time.Duration) {}}
+	if _, err := flow.Wait(&DeviceCode{DeviceCode: "dev-1", ExpiresIn: 15, Interval: 5}); !errors.Is(err, ErrAuthorizationExpired) {
+		t.Errorf("Expected ErrAuthorizationExpired, got %v", err)
+	}
+
+	if _, err := (&DeviceFlow{WebURL: server.URL}).Start(); err == nil {
+		t.Error("Expected error without a client ID")
+	}
+}
@@ -0,0 +1,80 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/v52/github"
+)
+
+// ErrNotFound is matched by errors for files, directories, functions and
+// repositories that don't exist
+var ErrNotFound = errors.New("not found")
+
+// ErrRateLimited is matched by errors for requests that hit a rate limit.
+// errors.As finds a *RateLimitedError if the client gave up waiting for it.
+var ErrRateLimited = errors.New("rate limited")
+
+// ErrUnsupportedLanguage is matched by errors for functions in languages that
+// can't be parsed
+var ErrUnsupportedLanguage = errors.New("unsupported language")
+
+// Is makes errors.Is match ErrRateLimited
+func (e *RateLimitedError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// ErrorForStatus returns the error matching an unsuccessful HTTP status:
+// ErrNotFound for 404, ErrRateLimited for 429, or nil. Other providers'
+// clients use it so that their errors match the same errors.
+func ErrorForStatus(code int) error {
+	switch code {
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusTooManyRequests:
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// kindError is an error that also matches one of the errors above, while
+// errors.As still finds the error it wraps, e.g. go-github's
+type kindError struct {
+	err  error
+	kind error
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.err, e.kind} }
+
+// classify makes an error from the GitHub API match ErrNotFound or
+// ErrRateLimited if it is one of those
+func classify(err error) error {
+	var (
+		response  *github.ErrorResponse
+		rateLimit *github.RateLimitError
+		abuse     *github.AbuseRateLimitError
+		kind      error
+	)
+	switch {
+	case errors.As(err, &rateLimit), errors.As(err, &abuse):
+		kind = ErrRateLimited
+	case errors.As(err, &response) && response.Response != nil:
+		kind = ErrorForStatus(response.Response.StatusCode)
+	}
+	if kind == nil {
+		return err
+	}
+	return &kindError{err: err, kind: kind}
+}
+
+// statusError is the error for an unsuccessful response to a request made
+// without go-github
+func statusError(code int) error {
+	err := fmt.Errorf("received status code %d", code)
+	if kind := ErrorForStatus(code); kind != nil {
+		return &kindError{err: err, kind: kind}
+	}
+	return err
+}
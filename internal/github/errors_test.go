@@ -0,0 +1,44 @@
+package github
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v52/github"
+)
+
+func TestErrorsMatchSentinels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	client := NewClient("test-token")
+	client.SetBaseURL(server.URL)
+	client.rawURL = server.URL
+
+	_, err := client.GetFile("owner", "repo", "missing.go", "main")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected an error matching ErrNotFound, got %v", err)
+	}
+	var response *github.ErrorResponse
+	if !errors.As(err, &response) || response.Response.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected the go-github error to still be found, got %v", err)
+	}
+
+	if _, err := client.GetRawFile("owner", "repo", "missing.bin", "main"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected a raw 404 to match ErrNotFound, got %v", err)
+	}
+
+	if _, err := client.ExtractFunction("", "cobol", "main"); !errors.Is(err, ErrUnsupportedLanguage) {
+		t.Errorf("Expected an error matching ErrUnsupportedLanguage, got %v", err)
+	}
+
+	if err := error(&RateLimitedError{}); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected RateLimitedError to match ErrRateLimited")
+	}
+	if errors.Is(statusError(http.StatusInternalServerError), ErrNotFound) {
+		t.Errorf("Expected a 500 not to match ErrNotFound")
+	}
+}
@@ -0,0 +1,285 @@
+package github
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/diff"
+	"github.com/google/go-github/v52/github"
+)
+
+// Gists reads files and revisions of gists with the client's token and
+// budget. Repository names passed to its methods are gist IDs, owners are
+// ignored, paths are file names in the gist and refs are revisions, the
+// latest if empty.
+type Gists struct {
+	client *Client
+}
+
+// Gists returns the source for the gists of the client's instance
+func (c *Client) Gists() *Gists {
+	return &Gists{client: c}
+}
+
+// gistRevisions holds gist revisions already fetched, which never change
+type gistRevisions struct {
+	mu        sync.Mutex
+	revisions map[string]*github.Gist // By gist ID and revision
+}
+
+func (r *gistRevisions) get(id, version string) (*github.Gist, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	gist, ok := r.revisions[id+"@"+version]
+	return gist, ok
+}
+
+func (r *gistRevisions) put(id, version string, gist *github.Gist) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.revisions == nil {
+		r.revisions = make(map[string]*github.Gist)
+	}
+	r.revisions[id+"@"+version] = gist
+}
+
+// BudgetExhausted reports whether the client's allowance of API calls is used up
+func (g *Gists) BudgetExhausted() bool {
+	return g.client.BudgetExhausted()
+}
+
+// latest returns the newest revision of a gist
+func (g *Gists) latest(id string) (*github.GistCommit, error) {
+	commits, _, err := g.client.client.Gists.ListCommits(g.client.ctx, id, &github.ListOptions{PerPage: 1})
+	if err != nil {
+		return nil, fmt.Errorf("error listing gist revisions: %w", classify(err))
+	}
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("gist %w: %s", ErrNotFound, id)
+	}
+	return commits[0], nil
+}
+
+// revision fetches a gist as of a revision
+func (g *Gists) revision(id, version string) (*github.Gist, error) {
+	if gist, ok := g.client.gists.get(id, version); ok {
+		return gist, nil
+	}
+	gist, _, err := g.client.client.Gists.GetRevision(g.client.ctx, id, version)
+	if err != nil {
+		return nil, fmt.Errorf("error getting gist revision: %w", classify(err))
+	}
+	g.client.gists.put(id, version, gist)
+	return gist, nil
+}
+
+// content returns a file of a gist revision, downloading it if the API
+// truncated it, or false if the revision has no such file
+func (g *Gists) content(gist *github.Gist, name string) (string, bool, error) {
+	file, ok := gist.Files[github.GistFilename(name)]
+	if !ok {
+		return "", false, nil
+	}
+	content := file.GetContent()
+	if len(content) >= file.GetSize() || file.GetRawURL() == "" {
+		return content, true, nil
+	}
+
+	req, err := http.NewRequestWithContext(g.client.ctx, "GET", file.GetRawURL(), nil)
+	if err != nil {
+		return "", false, fmt.Errorf("error creating request: %w", err)
+	}
+	resp, err := g.client.raw.Do(req)
+	if err != nil {
+		return "", false, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", false, statusError(resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", false, fmt.Errorf("error reading response body: %w", err)
+	}
+	return string(body), true, nil
+}
+
+// GetFile retrieves a file of a gist. Its CommitID is the revision.
+func (g *Gists) GetFile(owner, id, name, ref string) (*FileInfo, error) {
+	var updated time.Time
+	if ref == "" {
+		commit, err := g.latest(id)
+		if err != nil {
+			return nil, err
+		}
+		ref = commit.GetVersion()
+		updated = commit.GetCommittedAt().Time
+	}
+
+	gist, err := g.revision(id, ref)
+	if err != nil {
+		return nil, err
+	}
+	content, ok, err := g.content(gist, name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("file %w: %s in gist %s", ErrNotFound, name, id)
+	}
+
+	return &FileInfo{
+		Content:  content,
+		Path:     name,
+		SHA:      blobSHA(content),
+		Updated:  updated,
+		CommitID: ref,
+	}, nil
+}
+
+// GetDirectory retrieves every file of a gist, which has no directories, so
+// path must be empty or "."
+func (g *Gists) GetDirectory(owner, id, path, ref string) (map[string]*FileInfo, error) {
+	if path != "" && path != "." {
+		return nil, fmt.Errorf("gists have no directories: %s", path)
+	}
+	if ref == "" {
+		commit, err := g.latest(id)
+		if err != nil {
+			return nil, err
+		}
+		ref = commit.GetVersion()
+	}
+
+	gist, err := g.revision(id, ref)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*FileInfo, len(gist.Files))
+	for name := range gist.Files {
+		content, _, err := g.content(gist, string(name))
+		if err != nil {
+			return nil, err
+		}
+		result[string(name)] = &FileInfo{Content: content, Path: string(name), SHA: blobSHA(content), CommitID: ref}
+	}
+	return result, nil
+}
+
+// GetCommitsSince gets the revisions of a gist that changed a file, newest
+// first, up to ref if it is set, since a specific date or revision. A gist's
+// history covers all its files, so the revisions are compared to find those
+// that changed the file; an empty name keeps every revision.
+func (g *Gists) GetCommitsSince(owner, id, name, ref string, since time.Time, sinceCommit string) ([]CommitInfo, error) {
+	// The revisions to report, and the one before them, if there is one
+	var revisions []*github.GistCommit
+	var base *github.GistCommit
+
+	options := &github.ListOptions{PerPage: 100}
+	reached := ref == ""
+list:
+	for {
+		commits, resp, err := g.client.client.Gists.ListCommits(g.client.ctx, id, options)
+		if err != nil {
+			return nil, fmt.Errorf("error listing gist revisions: %w", classify(err))
+		}
+		for _, commit := range commits {
+			if !reached {
+				if reached = commit.GetVersion() == ref; !reached {
+					continue
+				}
+			}
+			if (sinceCommit != "" && commit.GetVersion() == sinceCommit) ||
+				(!since.IsZero() && commit.GetCommittedAt().Before(since)) {
+				base = commit
+				break list
+			}
+			revisions = append(revisions, commit)
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		options.Page = resp.NextPage
+	}
+
+	var result []CommitInfo
+	for i, commit := range revisions {
+		if name != "" {
+			older := base
+			if i+1 < len(revisions) {
+				older = revisions[i+1]
+			}
+			changed, err := g.changed(id, name, commit, older)
+			if err != nil {
+				return nil, err
+			}
+			if !changed {
+				continue
+			}
+		}
+		result = append(result, CommitInfo{
+			SHA:       commit.GetVersion(),
+			Message:   fmt.Sprintf("Changes to %s in gist %s", name, id),
+			Author:    commit.GetUser().GetLogin(),
+			Timestamp: commit.GetCommittedAt().Time,
+		})
+	}
+	return result, nil
+}
+
+// changed reports whether a revision changed a file from the revision before
+// it, which is nil for the first
+func (g *Gists) changed(id, name string, commit, older *github.GistCommit) (bool, error) {
+	gist, err := g.revision(id, commit.GetVersion())
+	if err != nil {
+		return false, err
+	}
+	content, exists, err := g.content(gist, name)
+	if err != nil {
+		return false, err
+	}
+	if older == nil {
+		return exists, nil
+	}
+
+	previous, err := g.revision(id, older.GetVersion())
+	if err != nil {
+		return false, err
+	}
+	previousContent, existed, err := g.content(previous, name)
+	if err != nil {
+		return false, err
+	}
+	return exists != existed || content != previousContent, nil
+}
+
+// GetFileDiff gets the diff between two revisions of a file of a gist
+func (g *Gists) GetFileDiff(owner, id, name, baseRef, headRef string) (string, error) {
+	base, err := g.GetFile(owner, id, name, baseRef)
+	if err != nil {
+		return "", err
+	}
+	head, err := g.GetFile(owner, id, name, headRef)
+	if err != nil {
+		return "", err
+	}
+
+	if base.SHA == head.SHA {
+		return "", fmt.Errorf("file %s was not changed between %s and %s", name, baseRef, headRef)
+	}
+	return diff.FormatDiff(diff.GenerateDiff(base.Content, head.Content), false), nil
+}
+
+// blobSHA returns the git blob hash of content, which is what file SHAs are
+// elsewhere
+func blobSHA(content string) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	io.WriteString(h, content)
+	return hex.EncodeToString(h.Sum(nil))
+}
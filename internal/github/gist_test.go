@@ -0,0 +1,102 @@
+package github
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGists(t *testing.T) {
+	// Revisions newest first: v3 only changed another file
+	revisions := []struct {
+		version string
+		files   map[string]string
+	}{
+		{"v3", map[string]string{"retry.go": "func Retry() { /* v2 */ }\n", "notes.md": "updated\n"}},
+		{"v2", map[string]string{"retry.go": "func Retry() { /* v2 */ }\n", "notes.md": "notes\n"}},
+		{"v1", map[string]string{"retry.go": "func Retry() {}\n"}},
+	}
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch {
+		case r.URL.Path == "/gists/abc/commits":
+			var commits []map[string]any
+			for i, rev := range revisions {
+				commits = append(commits, map[string]any{
+					"version":      rev.version,
+					"user":         map[string]any{"login": "octocat"},
+					"committed_at": time.Date(2024, 5, 3-i, 0, 0, 0, 0, time.UTC),
+				})
+			}
+			if r.URL.Query().Get("per_page") == "1" {
+				commits = commits[:1]
+			}
+			json.NewEncoder(w).Encode(commits)
+		case strings.HasPrefix(r.URL.Path, "/gists/abc/"):
+			version := strings.TrimPrefix(r.URL.Path, "/gists/abc/")
+			for _, rev := range revisions {
+				if rev.version != version {
+					continue
+				}
+				files := make(map[string]any)
+				for name, content := range rev.files {
+					files[name] = map[string]any{"filename": name, "content": content, "size": len(content)}
+				}
+				json.NewEncoder(w).Encode(map[string]any{"id": "abc", "files": files})
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.SetBaseURL(server.URL)
+	gists := client.Gists()
+
+	// Only revisions that changed the file are its commits
+	commits, err := gists.GetCommitsSince("octocat", "abc", "retry.go", "", time.Time{}, "")
+	if err != nil {
+		t.Fatalf("GetCommitsSince failed: %v", err)
+	}
+	if len(commits) != 2 || commits[0].SHA != "v2" || commits[1].SHA != "v1" || commits[0].Author != "octocat" {
+		t.Errorf("Expected the revisions changing retry.go, got %+v", commits)
+	}
+	if commits, err := gists.GetCommitsSince("octocat", "abc", "retry.go", "", time.Time{}, "v2"); err != nil || len(commits) != 0 {
+		t.Errorf("Expected no change since v2, got %+v, %v", commits, err)
+	}
+	if commits, err := gists.GetCommitsSince("octocat", "abc", "notes.md", "", time.Time{}, "v2"); err != nil || len(commits) != 1 {
+		t.Errorf("Expected v3 to change notes.md, got %+v, %v", commits, err)
+	}
+
+	file, err := gists.GetFile("octocat", "abc", "retry.go", "v1")
+	if err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	if file.Content != "func Retry() {}\n" || file.CommitID != "v1" || file.SHA == "" {
+		t.Errorf("Expected retry.go at v1, got %+v", file)
+	}
+	if file, err := gists.GetFile("octocat", "abc", "retry.go", ""); err != nil || file.CommitID != "v3" {
+		t.Errorf("Expected the latest revision, got %+v, %v", file, err)
+	}
+	if _, err := gists.GetFile("octocat", "abc", "notes.md", "v1"); err == nil {
+		t.Error("Expected a file missing from the revision to fail")
+	}
+
+	// Revisions don't change, so each is fetched once
+	fetched := make(map[string]int)
+	for _, path := range requests {
+		fetched[path]++
+	}
+	for _, rev := range revisions {
+		if n := fetched["/gists/abc/"+rev.version]; n != 1 {
+			t.Errorf("Expected revision %s to be fetched once, got %d", rev.version, n)
+		}
+	}
+}
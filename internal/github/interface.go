@@ -2,17 +2,15 @@ package github
 
 import "time"
 
-type FileContent struct {
-	Content string
-}
-
-type Commit struct {
-	SHA  string
-	Date time.Time
-}
-
+// GitHubClient is the part of Client that syncing needs: the source
+// operations every code host offers, plus function extraction. It lets tests
+// swap in a double for the GitHub API.
 type GitHubClient interface {
-	GetFile(owner, repo, path, revision string) (*FileContent, error)
-	GetCommitsSince(owner, repo, path string, since time.Time, until string) ([]Commit, error)
+	GetFile(owner, repo, path, ref string) (*FileInfo, error)
+	GetDirectory(owner, repo, path, ref string) (map[string]*FileInfo, error)
+	GetCommitsSince(owner, repo, path, ref string, since time.Time, sinceCommit string) ([]CommitInfo, error)
+	GetFileDiff(owner, repo, path, baseRef, headRef string) (string, error)
 	ExtractFunction(content, language, functionName string) (string, error)
 }
+
+var _ GitHubClient = (*Client)(nil)
@@ -0,0 +1,151 @@
+package github
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// lfsPointerVersion starts every Git LFS pointer file
+const lfsPointerVersion = "version https://git-lfs.github.com/spec/v1\n"
+
+// maxLFSPointerSize bounds the size of pointer files; Git LFS keeps them
+// well under it
+const maxLFSPointerSize = 1024
+
+// lfsPointer is a Git LFS pointer file, which git stores in place of a file
+// kept in LFS storage
+type lfsPointer struct {
+	OID  string `json:"oid"` // SHA-256 of the object, in hex
+	Size int64  `json:"size"`
+}
+
+// parseLFSPointer parses content as a Git LFS pointer file
+func parseLFSPointer(content []byte) (lfsPointer, bool) {
+	if len(content) > maxLFSPointerSize || !bytes.HasPrefix(content, []byte(lfsPointerVersion)) {
+		return lfsPointer{}, false
+	}
+
+	var p lfsPointer
+	for _, line := range strings.Split(string(content), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "oid":
+			p.OID, _ = strings.CutPrefix(value, "sha256:")
+		case "size":
+			p.Size, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	if len(p.OID) != sha256.Size*2 || p.Size < 0 {
+		return lfsPointer{}, false
+	}
+	return p, true
+}
+
+// resolveLFS returns the object a Git LFS pointer file points to, or content
+// itself if it isn't a pointer
+func (c *Client) resolveLFS(owner, repo string, content []byte) ([]byte, error) {
+	pointer, ok := parseLFSPointer(content)
+	if !ok {
+		return content, nil
+	}
+	object, err := c.getLFSObject(owner, repo, pointer)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching LFS object %s: %w", pointer.OID, err)
+	}
+	return object, nil
+}
+
+// getLFSObject downloads an object from a repository's LFS storage: the LFS
+// batch API returns where to download it from
+func (c *Client) getLFSObject(owner, repo string, pointer lfsPointer) ([]byte, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"operation": "download",
+		"transfers": []string{"basic"},
+		"objects":   []lfsPointer{pointer},
+	})
+	if err != nil {
+		return nil, err
+	}
+	batchURL := fmt.Sprintf("%s/%s/%s.git/info/lfs/objects/batch", c.webURL, owner, repo)
+	req, err := http.NewRequestWithContext(c.ctx, "POST", batchURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.git-lfs+json")
+	req.Header.Set("Content-Type", "application/vnd.git-lfs+json")
+	if c.token != "" {
+		// LFS takes the token as the password of HTTP basic auth
+		req.SetBasicAuth("x-access-token", c.token)
+	}
+
+	resp, err := c.lfs.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("LFS batch API: %w", statusError(resp.StatusCode))
+	}
+
+	var batch struct {
+		Objects []struct {
+			OID     string `json:"oid"`
+			Actions struct {
+				Download *struct {
+					Href   string            `json:"href"`
+					Header map[string]string `json:"header"`
+				} `json:"download"`
+			} `json:"actions"`
+			Error *struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"objects"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		return nil, fmt.Errorf("error parsing LFS batch response: %w", err)
+	}
+	if len(batch.Objects) != 1 || batch.Objects[0].OID != pointer.OID {
+		return nil, fmt.Errorf("LFS batch response doesn't list the object")
+	}
+	object := batch.Objects[0]
+	if object.Error != nil {
+		return nil, fmt.Errorf("%s (%d)", object.Error.Message, object.Error.Code)
+	}
+	if object.Actions.Download == nil {
+		return nil, fmt.Errorf("LFS batch response has no download link")
+	}
+
+	req, err = http.NewRequestWithContext(c.ctx, "GET", object.Actions.Download.Href, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	for name, value := range object.Actions.Download.Header {
+		req.Header.Set(name, value)
+	}
+	resp, err = c.lfs.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading object: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("object download: %w", statusError(resp.StatusCode))
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, pointer.Size+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading object: %w", err)
+	}
+	sum := sha256.Sum256(content)
+	if int64(len(content)) != pointer.Size || hex.EncodeToString(sum[:]) != pointer.OID {
+		return nil, fmt.Errorf("downloaded object doesn't match its pointer")
+	}
+	return content, nil
+}
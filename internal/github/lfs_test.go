@@ -0,0 +1,98 @@
+package github
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetFileResolvesLFSPointer(t *testing.T) {
+	object := []byte("\x89PNG\r\n\x1a\n binary image data")
+	sum := sha256.Sum256(object)
+	oid := hex.EncodeToString(sum[:])
+	pointer := fmt.Sprintf("version https://git-lfs.github.com/spec/v1\noid sha256:%s\nsize %d\n", oid, len(object))
+	served := object
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/acme/assets/contents/logo.png":
+			json.NewEncoder(w).Encode(map[string]string{
+				"type":     "file",
+				"encoding": "base64",
+				"path":     "logo.png",
+				"content":  base64.StdEncoding.EncodeToString([]byte(pointer)),
+			})
+		case "/repos/acme/assets/commits":
+			w.Write([]byte(`[]`))
+		case "/acme/assets.git/info/lfs/objects/batch":
+			if _, password, ok := r.BasicAuth(); !ok || password != "test-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintf(w, `{"objects": [{"oid": %q, "size": %d, "actions": {"download": {"href": %q, "header": {"X-Signature": "signed"}}}}]}`,
+				oid, len(object), server.URL+"/storage/"+oid)
+		case "/storage/" + oid:
+			if r.Header.Get("X-Signature") != "signed" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write(served)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.SetBaseURL(server.URL)
+
+	file, err := client.GetFile("acme", "assets", "logo.png", "main")
+	if err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	if file.Content != string(object) {
+		t.Errorf("Expected the LFS object, got %q", file.Content)
+	}
+
+	// Storage that serves the wrong bytes doesn't pass as the object
+	served = []byte("\x89PNG\r\n\x1a\n corrupted image data")
+	if _, err := client.GetFile("acme", "assets", "logo.png", "main"); err == nil {
+		t.Error("Expected an error for an object that doesn't match its pointer")
+	}
+}
+
+func TestParseLFSPointer(t *testing.T) {
+	oid := "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+	if p, ok := parseLFSPointer([]byte("version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 12345\n")); !ok || p.OID != oid || p.Size != 12345 {
+		t.Errorf("Expected a pointer, got %+v, %v", p, ok)
+	}
+	for _, content := range []string{
+		"package main\n",
+		"version https://git-lfs.github.com/spec/v1\noid sha256:abc\nsize 1\n",
+		"",
+	} {
+		if _, ok := parseLFSPointer([]byte(content)); ok {
+			t.Errorf("Expected %q not to be a pointer", content)
+		}
+	}
+}
+
+func FuzzParseLFSPointer(f *testing.F) {
+	f.Add([]byte("version https://git-lfs.github.com/spec/v1\noid sha256:" + strings.Repeat("a", 64) + "\nsize 12\n"))
+	f.Add([]byte("version https://git-lfs.github.com/spec/v1\noid sha256:\nsize -1\n"))
+	f.Add([]byte("version https://git-lfs.github.com/spec/v1\n\x00\xff oid"))
+
+	f.Fuzz(func(t *testing.T, content []byte) {
+		pointer, ok := parseLFSPointer(content)
+		if ok && (len(pointer.OID) != sha256.Size*2 || pointer.Size < 0 || len(content) > maxLFSPointerSize) {
+			t.Errorf("Parsed an invalid pointer %+v from %q", pointer, content)
+		}
+	})
+}
@@ -0,0 +1,216 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRateLimitWait is how long a request waits for a rate limit to reset
+// unless SetRateLimitWait says otherwise
+const DefaultRateLimitWait = 5 * time.Minute
+
+// maxRateLimitRetries bounds how often a request is retried after hitting a
+// rate limit
+const maxRateLimitRetries = 3
+
+// secondaryBackoff is the first wait after a secondary rate limit without a
+// Retry-After header; it doubles with each retry
+const secondaryBackoff = time.Minute
+
+// RateLimitedError is returned for requests that hit a rate limit which
+// doesn't reset within the client's wait budget
+type RateLimitedError struct {
+	Reset     time.Time // When requests are allowed again
+	Secondary bool      // A secondary limit on bursts, rather than the hourly quota
+}
+
+func (e *RateLimitedError) Error() string {
+	kind := "rate limit"
+	if e.Secondary {
+		kind = "secondary rate limit"
+	}
+	return fmt.Sprintf("GitHub %s exceeded until %s", kind, e.Reset.Format(time.RFC3339))
+}
+
+// rateLimiter waits out GitHub's rate limits for a client's requests
+type rateLimiter struct {
+	mu      sync.Mutex
+	maxWait time.Duration
+	until   time.Time // Requests wait until then once the quota is used up
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{maxWait: DefaultRateLimitWait, now: time.Now, sleep: sleepContext}
+}
+
+// wait blocks until reset, or fails if that is beyond the wait budget
+func (l *rateLimiter) wait(ctx context.Context, reset time.Time, secondary bool) error {
+	l.mu.Lock()
+	d := reset.Sub(l.now())
+	maxWait := l.maxWait
+	l.mu.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+	if d > maxWait {
+		return &RateLimitedError{Reset: reset, Secondary: secondary}
+	}
+	return l.sleep(ctx, d)
+}
+
+// exhausted returns when the quota resets if it is used up
+func (l *rateLimiter) exhausted() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.until
+}
+
+// exhaust makes requests wait until reset
+func (l *rateLimiter) exhaust(reset time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.until = reset
+}
+
+// observe records a quota that a response says is used up
+func (l *rateLimiter) observe(resp *http.Response) {
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		return
+	}
+	reset, ok := resetTime(resp)
+	if !ok {
+		return
+	}
+
+	l.exhaust(reset)
+
+	// go-github refuses requests until the reset itself; drop the header so
+	// that the next request waits here instead, within the wait budget
+	resp.Header.Del("X-RateLimit-Reset")
+}
+
+// rateLimitTransport retries requests that hit a rate limit once it resets,
+// honoring Retry-After and the X-RateLimit headers
+type rateLimitTransport struct {
+	limiter *rateLimiter
+	next    http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := t.limiter.wait(req.Context(), t.limiter.exhausted(), false); err != nil {
+			return nil, err
+		}
+
+		send := req
+		if attempt > 0 {
+			send = req.Clone(req.Context())
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				send.Body = body
+			}
+		}
+
+		resp, err := next.RoundTrip(send)
+		if err != nil {
+			return nil, err
+		}
+
+		reset, secondary, limited := t.rateLimited(resp, attempt)
+		if !limited {
+			t.limiter.observe(resp)
+			return resp, nil
+		}
+		resp.Body.Close()
+		if !secondary {
+			t.limiter.exhaust(reset)
+		}
+
+		// A request whose body can't be sent again can't be retried
+		if attempt == maxRateLimitRetries || req.Body != nil && req.GetBody == nil {
+			return nil, &RateLimitedError{Reset: reset, Secondary: secondary}
+		}
+		if err := t.limiter.wait(req.Context(), reset, secondary); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// rateLimited reports whether a response was refused by a rate limit, and
+// when to try again. The body of other 403 and 429 responses is kept intact.
+func (t *rateLimitTransport) rateLimited(resp *http.Response, attempt int) (time.Time, bool, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return time.Time{}, false, false
+	}
+	now := t.limiter.now()
+
+	if after := resp.Header.Get("Retry-After"); after != "" {
+		if seconds, err := strconv.Atoi(after); err == nil {
+			return now.Add(time.Duration(seconds) * time.Second), true, true
+		}
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, ok := resetTime(resp); ok {
+			return reset, false, true
+		}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err == nil && strings.Contains(strings.ToLower(string(body)), "secondary rate limit") {
+		return now.Add(secondaryBackoff << attempt), true, true
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return now.Add(secondaryBackoff << attempt), true, true
+	}
+	return time.Time{}, false, false
+}
+
+// resetTime parses the X-RateLimit-Reset header
+func resetTime(resp *http.Response) (time.Time, bool) {
+	seconds, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0), true
+}
+
+// sleepContext sleeps for d, or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetRateLimitWait sets how long a request may wait for a rate limit to
+// reset before failing with a RateLimitedError. Zero fails at once.
+func (c *Client) SetRateLimitWait(d time.Duration) {
+	c.limiter.mu.Lock()
+	defer c.limiter.mu.Unlock()
+	c.limiter.maxWait = d
+}
@@ -0,0 +1,153 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeSleep records waits and advances the client's clock instead of
+// sleeping
+func fakeSleep(client *Client, now time.Time) *[]time.Duration {
+	var waits []time.Duration
+	client.limiter.now = func() time.Time { return now }
+	client.limiter.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		now = now.Add(d)
+		return nil
+	}
+	return &waits
+}
+
+func TestRateLimitWait(t *testing.T) {
+	now := time.Now()
+	reset := now.Add(30 * time.Second).Truncate(time.Second)
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			// The last call of the quota
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		case 2:
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message": "API rate limit exceeded"}`))
+			return
+		case 3:
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message": "You have exceeded a secondary rate limit"}`))
+			return
+		}
+		w.Write([]byte(`{"name": "utils", "owner": {"login": "acme"}}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.SetBaseURL(server.URL)
+	waits := fakeSleep(client, now)
+
+	if _, err := client.GetRepository("acme", "utils"); err != nil {
+		t.Fatalf("First call failed: %v", err)
+	}
+	// The used up quota is waited for, and the secondary limit retried
+	if _, err := client.GetRepository("acme", "utils"); err != nil {
+		t.Fatalf("Expected the rate limits to be waited out, got %v", err)
+	}
+	if calls.Load() != 4 {
+		t.Errorf("Expected 4 requests, got %d", calls.Load())
+	}
+	want := []time.Duration{reset.Sub(now), 5 * time.Second}
+	if len(*waits) != len(want) {
+		t.Fatalf("Expected waits %v, got %v", want, *waits)
+	}
+	for i := range want {
+		if (*waits)[i] != want[i] {
+			t.Errorf("Wait %d: expected %v, got %v", i, want[i], (*waits)[i])
+		}
+	}
+}
+
+func TestRateLimitBudget(t *testing.T) {
+	reset := time.Now().Add(time.Hour)
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message": "API rate limit exceeded"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.SetBaseURL(server.URL)
+	client.SetRateLimitWait(10 * time.Minute)
+	waits := fakeSleep(client, time.Now())
+
+	_, err := client.GetRepository("acme", "utils")
+	var limited *RateLimitedError
+	if !errors.As(err, &limited) || limited.Secondary || limited.Reset.Unix() != reset.Unix() {
+		t.Fatalf("Expected a RateLimitedError, got %v", err)
+	}
+
+	// Later requests fail without being sent
+	if _, err := client.GetRepository("acme", "utils"); !errors.As(err, &limited) {
+		t.Errorf("Expected a RateLimitedError, got %v", err)
+	}
+	if calls.Load() != 1 || len(*waits) != 0 {
+		t.Errorf("Expected a single request and no waiting, got %d requests and waits %v", calls.Load(), *waits)
+	}
+}
+
+func TestForbiddenIsNotRateLimited(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "4000")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message": "Resource not accessible by personal access token"}`))
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.SetBaseURL(server.URL)
+	waits := fakeSleep(client, time.Now())
+
+	_, err := client.GetRepository("acme", "utils")
+	var limited *RateLimitedError
+	if err == nil || errors.As(err, &limited) || len(*waits) != 0 {
+		t.Errorf("Expected the 403 to be returned as is, got %v (waits %v)", err, *waits)
+	}
+}
+
+func TestRateLimitWaitIsCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.SetBaseURL(server.URL)
+	client.SetRateLimitWait(2 * time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	client.SetContext(ctx)
+
+	start := time.Now()
+	_, err := client.GetRepository("acme", "utils")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the wait to end at the deadline, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the wait to end at the deadline, took %s", elapsed)
+	}
+}
@@ -0,0 +1,66 @@
+package github
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// FileStat describes a file without its content
+type FileStat struct {
+	Size   int64  // Size in bytes, or -1 if unknown
+	SHA256 string // SHA-256 of the content in hex, if known without reading it
+	ETag   string // Entity tag of the raw file, if the server sent one
+}
+
+// StatFile describes a file from a ranged read of its first bytes, rather
+// than downloading all of it. That is enough to tell its size and entity
+// tag, and to recognize a Git LFS pointer, which gives the hash and size of
+// the object it points to.
+func (c *Client) StatFile(owner, repo, path, ref string) (*FileStat, error) {
+	rawURL := fmt.Sprintf("%s/%s/%s/%s/%s", c.rawURL, owner, repo, ref, path)
+	req, err := http.NewRequestWithContext(c.ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", maxLFSPointerSize-1))
+
+	resp, err := c.raw.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	stat := &FileStat{Size: -1, ETag: resp.Header.Get("ETag")}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// Content-Range is "bytes 0-1023/<size>"
+		if _, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/"); ok {
+			if size, err := strconv.ParseInt(total, 10, 64); err == nil {
+				stat.Size = size
+			}
+		}
+	case http.StatusOK:
+		// The server sent the whole file rather than the range
+		stat.Size = resp.ContentLength
+	default:
+		return nil, statusError(resp.StatusCode)
+	}
+
+	// Only the range is read, even if the server sent more
+	prefix, err := io.ReadAll(io.LimitReader(resp.Body, maxLFSPointerSize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	if stat.Size < 0 && len(prefix) < maxLFSPointerSize {
+		stat.Size = int64(len(prefix))
+	}
+
+	if pointer, ok := parseLFSPointer(prefix); ok && stat.Size == int64(len(prefix)) {
+		stat.Size = pointer.Size
+		stat.SHA256 = pointer.OID
+	}
+	return stat, nil
+}
@@ -0,0 +1,66 @@
+package github
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatFile(t *testing.T) {
+	large := strings.Repeat("x", 10<<20)
+	oid := "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+	files := map[string]string{
+		"/acme/ml/main/model.bin": large,
+		"/acme/ml/main/weights":   "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 734003200\n",
+	}
+	var sent int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", `"abc"`)
+		counter := &countingWriter{ResponseWriter: w}
+		http.ServeContent(counter, r, "", time.Time{}, bytes.NewReader([]byte(content)))
+		sent += counter.n
+	}))
+	defer server.Close()
+
+	client := NewClient("test-token")
+	client.rawURL = server.URL
+
+	stat, err := client.StatFile("acme", "ml", "model.bin", "main")
+	if err != nil {
+		t.Fatalf("StatFile failed: %v", err)
+	}
+	if stat.Size != int64(len(large)) || stat.ETag != `"abc"` || stat.SHA256 != "" {
+		t.Errorf("Unexpected stat of a large file: %+v", stat)
+	}
+	if sent > maxLFSPointerSize {
+		t.Errorf("Expected only the first bytes to be sent, got %d", sent)
+	}
+
+	stat, err = client.StatFile("acme", "ml", "weights", "main")
+	if err != nil {
+		t.Fatalf("StatFile failed: %v", err)
+	}
+	if stat.Size != 734003200 || stat.SHA256 != oid {
+		t.Errorf("Expected the stat of the LFS object, got %+v", stat)
+	}
+}
+
+// countingWriter counts the bytes of a response body
+type countingWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
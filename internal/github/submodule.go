@@ -0,0 +1,146 @@
+package github
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// location is a path in a repository at a ref
+type location struct {
+	Owner string
+	Repo  string
+	Path  string
+	Ref   string
+}
+
+// contentEntry is the part of a Contents API response that tells what a
+// path is. go-github doesn't decode the URL of submodules.
+type contentEntry struct {
+	Type            string `json:"type"` // "file", "dir", "symlink" or "submodule"
+	SHA             string `json:"sha"`  // For submodules, the commit the repository pins
+	SubmoduleGitURL string `json:"submodule_git_url"`
+}
+
+// getContentEntry tells what a path in a repository is. It returns nil if
+// the path doesn't exist.
+func (c *Client) getContentEntry(owner, repo, p, ref string) (*contentEntry, error) {
+	u := fmt.Sprintf("repos/%s/%s/contents/%s", owner, repo, (&url.URL{Path: p}).EscapedPath())
+	if ref != "" {
+		u += "?ref=" + url.QueryEscape(ref)
+	}
+	req, err := c.client.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	var raw json.RawMessage
+	resp, err := c.client.Do(c.ctx, req, &raw)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting content: %w", classify(err))
+	}
+
+	// Directories are listed as an array of their entries
+	if strings.HasPrefix(strings.TrimSpace(string(raw)), "[") {
+		return &contentEntry{Type: "dir"}, nil
+	}
+	var entry contentEntry
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		return nil, fmt.Errorf("error parsing content: %w", err)
+	}
+	return &entry, nil
+}
+
+// resolveSubmodule finds the submodule that a path crosses into, or is, and
+// returns where to fetch the path from instead: the submodule's repository at
+// the commit the outer repository pins, and the rest of the path. It returns
+// nil if the path doesn't cross into a submodule.
+func (c *Client) resolveSubmodule(owner, repo, p, ref string) (*location, error) {
+	parts := strings.Split(strings.Trim(p, "/"), "/")
+	for i := 1; i <= len(parts); i++ {
+		prefix := strings.Join(parts[:i], "/")
+		entry, err := c.getContentEntry(owner, repo, prefix, ref)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil || (entry.Type != "dir" && entry.Type != "submodule") {
+			return nil, nil
+		}
+		if entry.Type == "dir" {
+			continue
+		}
+
+		subOwner, subRepo, err := c.submoduleRepository(entry.SubmoduleGitURL, owner, repo)
+		if err != nil {
+			return nil, fmt.Errorf("submodule %s: %w", prefix, err)
+		}
+		return &location{
+			Owner: subOwner,
+			Repo:  subRepo,
+			Path:  strings.Join(parts[i:], "/"),
+			Ref:   entry.SHA,
+		}, nil
+	}
+	return nil, nil
+}
+
+// submoduleRepository returns the repository a submodule URL points to. The
+// URL may be relative to the outer repository, as in .gitmodules, and must be
+// on the same host as the outer repository.
+func (c *Client) submoduleRepository(gitURL, owner, repo string) (string, string, error) {
+	var host, repoPath string
+	switch {
+	case strings.HasPrefix(gitURL, "./") || strings.HasPrefix(gitURL, "../"):
+		repoPath = path.Join(owner, repo, gitURL)
+	case !strings.Contains(gitURL, "://") && strings.Contains(gitURL, ":"):
+		// scp-like syntax, e.g. git@github.com:acme/lib.git
+		userHost, p, _ := strings.Cut(gitURL, ":")
+		_, host, _ = strings.Cut(userHost, "@")
+		if host == "" {
+			host = userHost
+		}
+		repoPath = p
+	default:
+		u, err := url.Parse(gitURL)
+		if err != nil || u.Host == "" {
+			return "", "", fmt.Errorf("unsupported URL %q", gitURL)
+		}
+		host, repoPath = u.Hostname(), u.Path
+	}
+
+	if web, err := url.Parse(c.webURL); host != "" && (err != nil || !strings.EqualFold(host, web.Hostname())) {
+		return "", "", fmt.Errorf("%s isn't hosted on %s", gitURL, c.webURL)
+	}
+	subOwner, subRepo, ok := strings.Cut(strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git"), "/")
+	if !ok || subOwner == "" || subRepo == "" || strings.Contains(subRepo, "/") {
+		return "", "", fmt.Errorf("unsupported URL %q", gitURL)
+	}
+	return subOwner, subRepo, nil
+}
+
+// mount returns the path of the submodule that p was resolved into
+func (l *location) mount(p string) string {
+	return strings.Trim(strings.TrimSuffix(strings.Trim(p, "/"), l.Path), "/")
+}
+
+// getSubmoduleDirectory retrieves the files below a directory in a submodule,
+// keyed by their path in the outer repository, which has the submodule at
+// mount
+func (c *Client) getSubmoduleDirectory(sub *location, mount string) (map[string]*FileInfo, error) {
+	files, err := c.GetDirectory(sub.Owner, sub.Repo, sub.Path, sub.Ref)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]*FileInfo, len(files))
+	for p, file := range files {
+		file.Path = path.Join(mount, p)
+		result[file.Path] = file
+	}
+	return result, nil
+}
@@ -0,0 +1,102 @@
+package github
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// submoduleServer serves acme/app, which has acme/lib as a submodule at
+// vendor/lib pinned to commit "pinned"
+func submoduleServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path + "?" + r.URL.Query().Get("ref") + r.URL.Query().Get("path") {
+		case "/repos/acme/app/contents/vendor?main":
+			fmt.Fprint(w, `[{"type": "file", "name": "lib", "path": "vendor/lib"}]`)
+		case "/repos/acme/app/contents/vendor/lib?main":
+			fmt.Fprint(w, `{"type": "submodule", "path": "vendor/lib", "sha": "pinned", "submodule_git_url": "../lib.git"}`)
+		case "/repos/acme/lib/contents/log.go?pinned":
+			fmt.Fprintf(w, `{"type": "file", "encoding": "base64", "path": "log.go", "sha": "b1", "content": %q}`,
+				base64.StdEncoding.EncodeToString([]byte("package log\n")))
+		case "/repos/acme/lib/commits?", "/repos/acme/app/commits?vendor/lib/log.go":
+			fmt.Fprint(w, `[]`)
+		case "/repos/acme/app/commits?vendor/lib":
+			fmt.Fprint(w, `[{"sha": "bump", "commit": {"message": "Bump lib", "author": {"name": "Bob", "date": "2024-05-01T12:00:00Z"}}}]`)
+		case "/repos/acme/app/git/trees/main?":
+			fmt.Fprint(w, `{"sha": "root", "truncated": false, "tree": [
+				{"path": "README.md", "type": "blob", "sha": "b0"},
+				{"path": "vendor", "type": "tree", "sha": "t1"},
+				{"path": "vendor/lib", "type": "commit", "sha": "pinned"}
+			]}`)
+		case "/repos/acme/lib/git/trees/pinned?":
+			fmt.Fprint(w, `{"sha": "pinned", "truncated": false, "tree": [{"path": "log.go", "type": "blob", "sha": "b1"}]}`)
+		case "/repos/acme/lib/git/blobs/b1?":
+			fmt.Fprint(w, "package log\n")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestGetFileInSubmodule(t *testing.T) {
+	server := submoduleServer()
+	defer server.Close()
+	client := NewClient("test-token")
+	client.SetBaseURL(server.URL)
+
+	file, err := client.GetFile("acme", "app", "vendor/lib/log.go", "main")
+	if err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	if file.Content != "package log\n" || file.Path != "vendor/lib/log.go" {
+		t.Errorf("Expected the file from the submodule, got %+v", file)
+	}
+
+	// Upstream changes are the commits that move the submodule
+	commits, err := client.GetCommitsSince("acme", "app", "vendor/lib/log.go", "main", time.Time{}, "")
+	if err != nil {
+		t.Fatalf("GetCommitsSince failed: %v", err)
+	}
+	if len(commits) != 1 || commits[0].SHA != "bump" {
+		t.Errorf("Expected the commit that moved the submodule, got %+v", commits)
+	}
+
+	files, err := client.GetDirectory("acme", "app", "vendor", "main")
+	if err != nil {
+		t.Fatalf("GetDirectory failed: %v", err)
+	}
+	if len(files) != 1 || files["vendor/lib/log.go"].Content != "package log\n" {
+		t.Errorf("Expected the submodule's files below vendor, got %+v", files)
+	}
+}
+
+func TestSubmoduleRepository(t *testing.T) {
+	client := NewClient("test-token")
+	for _, tt := range []struct {
+		url         string
+		owner, repo string
+	}{
+		{"https://github.com/acme/lib.git", "acme", "lib"},
+		{"https://github.com/other/lib", "other", "lib"},
+		{"git@github.com:acme/lib.git", "acme", "lib"},
+		{"ssh://git@github.com/acme/lib.git", "acme", "lib"},
+		{"../lib.git", "acme", "lib"},
+		{"../../other/lib.git", "other", "lib"},
+		{"https://gitlab.com/acme/lib.git", "", ""},
+		{"git@gitlab.com:acme/lib.git", "", ""},
+	} {
+		owner, repo, err := client.submoduleRepository(tt.url, "acme", "app")
+		if tt.owner == "" {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s/%s", tt.url, owner, repo)
+			}
+			continue
+		}
+		if err != nil || owner != tt.owner || repo != tt.repo {
+			t.Errorf("%s: expected %s/%s, got %s/%s (%v)", tt.url, tt.owner, tt.repo, owner, repo, err)
+		}
+	}
+}
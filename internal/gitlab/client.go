@@ -0,0 +1,284 @@
+// Package gitlab reads files and history from GitLab projects through the
+// REST API (v4), offering the same operations as the GitHub client.
+package gitlab
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/github"
+)
+
+// DefaultURL is the GitLab instance used when none is configured
+const DefaultURL = "https://gitlab.com"
+
+// requestTimeout bounds each API request
+const requestTimeout = 30 * time.Second
+
+// Client wraps the GitLab REST API
+type Client struct {
+	baseURL string // API root, e.g. https://gitlab.com/api/v4
+	token   string
+	client  *http.Client
+	ctx     context.Context
+	budget  *github.Budget // Set by SetLimits
+}
+
+// APIError is an unsuccessful response from the API
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("GitLab API returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Is makes errors.Is match github.ErrNotFound and github.ErrRateLimited for
+// the responses that mean those
+func (e *APIError) Is(target error) bool {
+	kind := github.ErrorForStatus(e.StatusCode)
+	return kind != nil && target == kind
+}
+
+// NewClient creates a client for the GitLab instance at instanceURL, or
+// gitlab.com if it is empty. The token may be empty for public projects.
+func NewClient(instanceURL, token string) *Client {
+	if instanceURL == "" {
+		instanceURL = DefaultURL
+	}
+
+	return &Client{
+		baseURL: strings.TrimSuffix(instanceURL, "/") + "/api/v4",
+		token:   token,
+		client:  &http.Client{Timeout: requestTimeout},
+		ctx:     context.Background(),
+	}
+}
+
+// SetLimits bounds the client's concurrency, bandwidth and API calls. It
+// should be called before the client is used.
+func (c *Client) SetLimits(limits github.Limits) {
+	c.budget = github.NewBudget(limits)
+	c.client = &http.Client{Transport: c.budget.Transport(c.client.Transport), Timeout: c.client.Timeout}
+}
+
+// ResetBudget starts a new allowance of API calls, e.g. at the start of a run
+func (c *Client) ResetBudget() {
+	if c.budget != nil {
+		c.budget.Reset()
+	}
+}
+
+// BudgetExhausted reports whether the allowance of API calls is used up
+func (c *Client) BudgetExhausted() bool {
+	return c.budget != nil && c.budget.Exhausted()
+}
+
+// project returns the URL-encoded ID of a project. The owner may be a group
+// path with subgroups.
+func project(owner, repo string) string {
+	return url.PathEscape(owner + "/" + repo)
+}
+
+// get fetches an API path into v and returns the response headers
+func (c *Client) get(path string, query url.Values, v interface{}) (http.Header, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(c.ctx, "GET", u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	if c.token != "" {
+		req.Header.Set("PRIVATE-TOKEN", c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body struct {
+			Message interface{} `json:"message"`
+			Error   string      `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		message := body.Error
+		if body.Message != nil {
+			message = fmt.Sprint(body.Message)
+		}
+		return nil, &APIError{StatusCode: resp.StatusCode, Message: message}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return nil, fmt.Errorf("error parsing response: %w", err)
+	}
+	return resp.Header, nil
+}
+
+// GetFile retrieves a file from a GitLab project
+func (c *Client) GetFile(owner, repo, path, ref string) (*github.FileInfo, error) {
+	var file struct {
+		FilePath     string `json:"file_path"`
+		Encoding     string `json:"encoding"`
+		Content      string `json:"content"`
+		BlobID       string `json:"blob_id"`
+		LastCommitID string `json:"last_commit_id"`
+	}
+
+	query := url.Values{}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	query.Set("ref", ref)
+
+	if _, err := c.get(fmt.Sprintf("/projects/%s/repository/files/%s", project(owner, repo), url.PathEscape(path)), query, &file); err != nil {
+		return nil, fmt.Errorf("error getting file content: %w", err)
+	}
+
+	content := file.Content
+	if file.Encoding == "base64" {
+		decoded, err := base64.StdEncoding.DecodeString(file.Content)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding content: %w", err)
+		}
+		content = string(decoded)
+	}
+
+	return &github.FileInfo{
+		Content:  content,
+		Path:     file.FilePath,
+		SHA:      file.BlobID,
+		CommitID: file.LastCommitID,
+	}, nil
+}
+
+// GetDirectory retrieves all files below a directory in a GitLab project
+func (c *Client) GetDirectory(owner, repo, path, ref string) (map[string]*github.FileInfo, error) {
+	query := url.Values{}
+	query.Set("path", path)
+	query.Set("recursive", "true")
+	query.Set("per_page", "100")
+	if ref != "" {
+		query.Set("ref", ref)
+	}
+
+	result := make(map[string]*github.FileInfo)
+	for page := "1"; page != ""; {
+		query.Set("page", page)
+
+		var entries []struct {
+			Type string `json:"type"`
+			Path string `json:"path"`
+		}
+		header, err := c.get(fmt.Sprintf("/projects/%s/repository/tree", project(owner, repo)), query, &entries)
+		if err != nil {
+			return nil, fmt.Errorf("error getting directory content: %w", err)
+		}
+
+		for _, entry := range entries {
+			if entry.Type != "blob" {
+				continue
+			}
+			file, err := c.GetFile(owner, repo, entry.Path, ref)
+			if err != nil {
+				return nil, fmt.Errorf("error getting %s: %w", entry.Path, err)
+			}
+			result[entry.Path] = file
+		}
+
+		page = header.Get("X-Next-Page")
+	}
+
+	return result, nil
+}
+
+// GetCommitsSince gets the commits to a file on a branch (or the default
+// branch if ref is empty) since a specific date or commit, newest first. If
+// sinceCommit isn't in the file's history, all commits are returned.
+func (c *Client) GetCommitsSince(owner, repo, path, ref string, since time.Time, sinceCommit string) ([]github.CommitInfo, error) {
+	query := url.Values{}
+	query.Set("path", path)
+	if ref != "" {
+		query.Set("ref_name", ref)
+	}
+	query.Set("per_page", "100")
+	if !since.IsZero() {
+		query.Set("since", since.Format(time.RFC3339))
+	}
+
+	var result []github.CommitInfo
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+
+		var commits []struct {
+			ID           string    `json:"id"`
+			Message      string    `json:"message"`
+			AuthorName   string    `json:"author_name"`
+			AuthorEmail  string    `json:"author_email"`
+			AuthoredDate time.Time `json:"authored_date"`
+		}
+		header, err := c.get(fmt.Sprintf("/projects/%s/repository/commits", project(owner, repo)), query, &commits)
+		if err != nil {
+			return nil, fmt.Errorf("error listing commits: %w", err)
+		}
+
+		for _, commit := range commits {
+			if sinceCommit != "" && commit.ID == sinceCommit {
+				return result, nil
+			}
+			result = append(result, github.CommitInfo{
+				SHA:       commit.ID,
+				Message:   commit.Message,
+				Author:    commit.AuthorName,
+				Email:     commit.AuthorEmail,
+				Timestamp: commit.AuthoredDate,
+			})
+		}
+
+		if header.Get("X-Next-Page") == "" {
+			return result, nil
+		}
+	}
+}
+
+// GetFileDiff gets the diff between two versions of a file
+func (c *Client) GetFileDiff(owner, repo, path, baseRef, headRef string) (string, error) {
+	query := url.Values{}
+	query.Set("from", baseRef)
+	query.Set("to", headRef)
+
+	var comparison struct {
+		Diffs []struct {
+			OldPath string `json:"old_path"`
+			NewPath string `json:"new_path"`
+			Diff    string `json:"diff"`
+		} `json:"diffs"`
+	}
+	if _, err := c.get(fmt.Sprintf("/projects/%s/repository/compare", project(owner, repo)), query, &comparison); err != nil {
+		return "", fmt.Errorf("error comparing commits: %w", err)
+	}
+
+	for _, d := range comparison.Diffs {
+		if d.NewPath == path || d.OldPath == path {
+			if d.Diff != "" {
+				return d.Diff, nil
+			}
+			return fmt.Sprintf("File %s was changed (no text diff available)", path), nil
+		}
+	}
+
+	return "", fmt.Errorf("file %s was not changed between %s and %s", path, baseRef, headRef)
+}
@@ -0,0 +1,152 @@
+package gitlab
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/github"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewClient(server.URL, "test-token")
+}
+
+func TestGetFile(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/api/v4/projects/acme%2Fplatform%2Futils/repository/files/pkg%2Flog.go" {
+			t.Errorf("Unexpected path: %s", r.URL.EscapedPath())
+		}
+		if r.URL.Query().Get("ref") != "main" || r.Header.Get("PRIVATE-TOKEN") != "test-token" {
+			t.Errorf("Unexpected request: %s %v", r.URL.RawQuery, r.Header)
+		}
+		// "package log\n"
+		fmt.Fprint(w, `{"file_path": "pkg/log.go", "encoding": "base64", "content": "cGFja2FnZSBsb2cK", "blob_id": "b1", "last_commit_id": "c1"}`)
+	})
+
+	file, err := client.GetFile("acme/platform", "utils", "pkg/log.go", "main")
+	if err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	if file.Content != "package log\n" || file.SHA != "b1" || file.CommitID != "c1" {
+		t.Errorf("Unexpected file: %+v", file)
+	}
+}
+
+func TestGetFileNotFound(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "404 File Not Found"}`)
+	})
+
+	_, err := client.GetFile("acme", "utils", "missing.go", "main")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "404 File Not Found" {
+		t.Errorf("Expected a 404 APIError, got %v", err)
+	}
+}
+
+func TestGetDirectory(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/acme%2Futils/repository/tree":
+			if r.URL.Query().Get("page") == "1" {
+				w.Header().Set("X-Next-Page", "2")
+				fmt.Fprint(w, `[{"type": "tree", "path": "lib/sub"}, {"type": "blob", "path": "lib/a.go"}]`)
+			} else {
+				fmt.Fprint(w, `[{"type": "blob", "path": "lib/sub/b.go"}]`)
+			}
+		default:
+			fmt.Fprint(w, `{"encoding": "text", "content": "x"}`)
+		}
+	})
+
+	files, err := client.GetDirectory("acme", "utils", "lib", "main")
+	if err != nil {
+		t.Fatalf("GetDirectory failed: %v", err)
+	}
+	if len(files) != 2 || files["lib/a.go"] == nil || files["lib/sub/b.go"] == nil {
+		t.Errorf("Expected files from both pages, got %v", files)
+	}
+}
+
+func TestGetCommitsSince(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("path") != "strings.go" {
+			t.Errorf("Unexpected path filter: %s", r.URL.RawQuery)
+		}
+		if r.URL.Query().Get("ref_name") == "release-1.x" {
+			fmt.Fprint(w, `[{"id": "rrr", "message": "Backport", "author_name": "Rita", "authored_date": "2024-03-04T00:00:00Z"}]`)
+			return
+		}
+		fmt.Fprint(w, `[
+			{"id": "ccc", "message": "Third", "author_name": "Carol", "authored_date": "2024-03-03T00:00:00Z"},
+			{"id": "bbb", "message": "Second", "author_name": "Bob", "authored_date": "2024-03-02T00:00:00Z"},
+			{"id": "aaa", "message": "First", "author_name": "Alice", "authored_date": "2024-03-01T00:00:00Z"}
+		]`)
+	})
+
+	commits, err := client.GetCommitsSince("acme", "utils", "strings.go", "", time.Time{}, "bbb")
+	if err != nil {
+		t.Fatalf("GetCommitsSince failed: %v", err)
+	}
+	if len(commits) != 1 || commits[0].SHA != "ccc" || commits[0].Author != "Carol" {
+		t.Errorf("Expected only the commit after bbb, got %+v", commits)
+	}
+
+	if commits, _ := client.GetCommitsSince("acme", "utils", "strings.go", "", time.Time{}, "gone"); len(commits) != 3 {
+		t.Errorf("Expected all commits when the starting commit is gone, got %d", len(commits))
+	}
+	if commits, _ := client.GetCommitsSince("acme", "utils", "strings.go", "release-1.x", time.Time{}, ""); len(commits) != 1 {
+		t.Errorf("Expected only the commits on release-1.x, got %d", len(commits))
+	}
+}
+
+func TestGetFileDiff(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("from") != "v1" || r.URL.Query().Get("to") != "v2" {
+			t.Errorf("Unexpected refs: %s", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `{"diffs": [{"old_path": "a.go", "new_path": "a.go", "diff": "@@ -1 +1 @@\n-x\n+y\n"}]}`)
+	})
+
+	patch, err := client.GetFileDiff("acme", "utils", "a.go", "v1", "v2")
+	if err != nil || patch != "@@ -1 +1 @@\n-x\n+y\n" {
+		t.Errorf("Unexpected diff: %q, %v", patch, err)
+	}
+	if _, err := client.GetFileDiff("acme", "utils", "b.go", "v1", "v2"); err == nil {
+		t.Error("Expected error for an unchanged file")
+	}
+}
+func TestLimits(t *testing.T) {
+	calls := 0
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprint(w, `{"file_path": "log.go", "encoding": "base64", "content": "", "blob_id": "b1", "last_commit_id": "c1"}`)
+	})
+	client.SetLimits(github.Limits{MaxAPICalls: 1})
+
+	if _, err := client.GetFile("acme", "utils", "log.go", "main"); err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	if !client.BudgetExhausted() {
+		t.Error("Expected the budget to be exhausted")
+	}
+	if _, err := client.GetFile("acme", "utils", "log.go", "main"); !errors.Is(err, github.ErrBudgetExhausted) {
+		t.Errorf("Expected ErrBudgetExhausted, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected the over-budget call not to be sent, got %d calls", calls)
+	}
+
+	client.ResetBudget()
+	if client.BudgetExhausted() {
+		t.Error("Expected a fresh budget after ResetBudget")
+	}
+}
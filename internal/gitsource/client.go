@@ -0,0 +1,313 @@
+// Package gitsource reads files and history from any git remote, such as a
+// bare git server or an SSH-only host, through a shallow local clone. It
+// offers the same operations as the GitHub client and keeps serving them from
+// the clone when the remote can't be reached.
+package gitsource
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/diff"
+	"github.com/exitflynn/codesync/internal/github"
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// DefaultDepth is how many commits of each branch are fetched
+const DefaultDepth = 100
+
+// Client keeps shallow bare clones of git remotes in a cache directory
+type Client struct {
+	cacheDir string
+	depth    int
+
+	mu    sync.Mutex
+	repos map[string]*git.Repository // By remote URL
+}
+
+// NewClient creates a client cloning into cacheDir. With an empty cacheDir,
+// clones are kept in memory.
+func NewClient(cacheDir string) *Client {
+	return &Client{
+		cacheDir: cacheDir,
+		depth:    DefaultDepth,
+		repos:    make(map[string]*git.Repository),
+	}
+}
+
+// SetDepth changes how many commits of each branch are fetched
+func (c *Client) SetDepth(depth int) {
+	c.depth = depth
+}
+
+// Remote returns the source for a remote URL. Owner and repository names
+// passed to its methods are ignored, as the URL identifies the repository.
+func (c *Client) Remote(url string) *Remote {
+	return &Remote{client: c, url: url}
+}
+
+// Remote reads from one git remote
+type Remote struct {
+	client *Client
+	url    string
+}
+
+// CacheKey returns the name of the directory a remote is cloned into
+func CacheKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:8])
+}
+
+// repository opens or clones the remote's repository
+func (c *Client) repository(url string) (*git.Repository, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if repo, ok := c.repos[url]; ok {
+		return repo, nil
+	}
+
+	var repo *git.Repository
+	var err error
+	if c.cacheDir == "" {
+		repo, err = git.Init(memory.NewStorage(), nil)
+	} else {
+		dir := filepath.Join(c.cacheDir, CacheKey(url))
+		repo, err = git.PlainOpen(dir)
+		if errors.Is(err, git.ErrRepositoryNotExists) {
+			repo, err = git.PlainInit(dir, true)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening clone: %w", err)
+	}
+
+	if _, err := repo.Remote(git.DefaultRemoteName); errors.Is(err, git.ErrRemoteNotFound) {
+		_, err = repo.CreateRemote(&gitconfig.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{url}})
+		if err != nil {
+			return nil, fmt.Errorf("error adding remote: %w", err)
+		}
+	}
+
+	c.repos[url] = repo
+	return repo, nil
+}
+
+// fetch updates a branch of the clone, or the remote's default branch if ref
+// is empty
+func (r *Remote) fetch(repo *git.Repository, ref string) error {
+	spec := "+refs/heads/" + ref + ":refs/remotes/origin/" + ref
+	if ref == "" {
+		spec = "+HEAD:refs/remotes/origin/HEAD"
+	}
+
+	err := repo.Fetch(&git.FetchOptions{
+		RefSpecs: []gitconfig.RefSpec{gitconfig.RefSpec(spec)},
+		Depth:    r.client.depth,
+		Tags:     git.NoTags,
+		Force:    true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("error fetching %s: %w", r.url, err)
+	}
+	return nil
+}
+
+// resolve returns the commit a branch, commit hash or empty ref (the default
+// branch) points at. Refs missing from the clone are fetched first.
+func (r *Remote) resolve(repo *git.Repository, ref string, fetched bool) (*object.Commit, error) {
+	name := "origin/HEAD"
+	if ref != "" {
+		name = "origin/" + ref
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(name))
+	if err != nil && plumbing.IsHash(ref) {
+		hash, err = repo.ResolveRevision(plumbing.Revision(ref))
+		if err == nil {
+			if _, err = repo.CommitObject(*hash); err != nil {
+				hash = nil
+			}
+		}
+	}
+	if err != nil || hash == nil {
+		if fetched || plumbing.IsHash(ref) {
+			return nil, fmt.Errorf("revision %s not found in %s", refName(ref), r.url)
+		}
+		if err := r.fetch(repo, ref); err != nil {
+			return nil, err
+		}
+		return r.resolve(repo, ref, true)
+	}
+
+	return repo.CommitObject(*hash)
+}
+
+func refName(ref string) string {
+	if ref == "" {
+		return "HEAD"
+	}
+	return ref
+}
+
+// GetFile retrieves a file at a branch or commit
+func (r *Remote) GetFile(owner, repo, path, ref string) (*github.FileInfo, error) {
+	clone, err := r.client.repository(r.url)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := r.resolve(clone, ref, false)
+	if err != nil {
+		return nil, fmt.Errorf("error getting file content: %w", err)
+	}
+
+	file, err := commit.File(strings.Trim(path, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("error getting file content: %s: %w", path, err)
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	return &github.FileInfo{
+		Content:  content,
+		Path:     file.Name,
+		SHA:      file.Hash.String(),
+		CommitID: commit.Hash.String(),
+	}, nil
+}
+
+// GetDirectory retrieves all files below a directory at a branch or commit
+func (r *Remote) GetDirectory(owner, repo, path, ref string) (map[string]*github.FileInfo, error) {
+	clone, err := r.client.repository(r.url)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := r.resolve(clone, ref, false)
+	if err != nil {
+		return nil, fmt.Errorf("error getting directory content: %w", err)
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("error getting directory content: %w", err)
+	}
+	prefix := strings.Trim(path, "/")
+	if prefix != "" {
+		if tree, err = tree.Tree(prefix); err != nil {
+			return nil, fmt.Errorf("error getting directory content: %s: %w", path, err)
+		}
+		prefix += "/"
+	}
+
+	result := make(map[string]*github.FileInfo)
+	err = tree.Files().ForEach(func(file *object.File) error {
+		content, err := file.Contents()
+		if err != nil {
+			return fmt.Errorf("%s: %w", prefix+file.Name, err)
+		}
+		result[prefix+file.Name] = &github.FileInfo{
+			Content:  content,
+			Path:     prefix + file.Name,
+			SHA:      file.Hash.String(),
+			CommitID: commit.Hash.String(),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting directory content: %w", err)
+	}
+
+	return result, nil
+}
+
+// GetCommitsSince gets the commits to a file or directory on a branch (or the
+// default branch if ref is empty) since a specific date or commit, newest
+// first. The branch is fetched first; if the remote can't be reached, the
+// clone's last copy of it is used. If sinceCommit isn't in the fetched
+// history, all fetched commits are returned.
+func (r *Remote) GetCommitsSince(owner, repo, path, ref string, since time.Time, sinceCommit string) ([]github.CommitInfo, error) {
+	clone, err := r.client.repository(r.url)
+	if err != nil {
+		return nil, err
+	}
+
+	fetchErr := r.fetch(clone, ref)
+	head, err := r.resolve(clone, ref, true)
+	if err != nil {
+		if fetchErr != nil {
+			return nil, fetchErr
+		}
+		return nil, fmt.Errorf("error listing commits: %w", err)
+	}
+
+	path = strings.Trim(path, "/")
+	options := &git.LogOptions{
+		From: head.Hash,
+		PathFilter: func(p string) bool {
+			return path == "" || p == path || strings.HasPrefix(p, path+"/")
+		},
+	}
+	if !since.IsZero() {
+		options.Since = &since
+	}
+
+	commits, err := clone.Log(options)
+	if err != nil {
+		return nil, fmt.Errorf("error listing commits: %w", err)
+	}
+	defer commits.Close()
+
+	var result []github.CommitInfo
+	for {
+		commit, err := commits.Next()
+		// History ends early in a shallow clone
+		if err == io.EOF || errors.Is(err, plumbing.ErrObjectNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error listing commits: %w", err)
+		}
+		if sinceCommit != "" && commit.Hash.String() == sinceCommit {
+			break
+		}
+		result = append(result, github.CommitInfo{
+			SHA:       commit.Hash.String(),
+			Message:   commit.Message,
+			Author:    commit.Author.Name,
+			Email:     commit.Author.Email,
+			Timestamp: commit.Author.When,
+		})
+	}
+
+	return result, nil
+}
+
+// GetFileDiff gets the diff between two versions of a file
+func (r *Remote) GetFileDiff(owner, repo, path, baseRef, headRef string) (string, error) {
+	base, err := r.GetFile(owner, repo, path, baseRef)
+	if err != nil {
+		return "", err
+	}
+	head, err := r.GetFile(owner, repo, path, headRef)
+	if err != nil {
+		return "", err
+	}
+
+	if base.SHA == head.SHA {
+		return "", fmt.Errorf("file %s was not changed between %s and %s", path, baseRef, headRef)
+	}
+	return diff.FormatDiff(diff.GenerateDiff(base.Content, head.Content), false), nil
+}
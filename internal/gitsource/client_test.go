@@ -0,0 +1,139 @@
+package gitsource
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// upstream is a git repository on disk to clone from
+type upstream struct {
+	t    *testing.T
+	dir  string
+	repo *git.Repository
+	when time.Time
+}
+
+func newUpstream(t *testing.T) *upstream {
+	t.Helper()
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &upstream{t: t, dir: dir, repo: repo, when: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+// commit writes files and commits them, returning the commit hash
+func (u *upstream) commit(message string, files map[string]string) string {
+	u.t.Helper()
+	worktree, err := u.repo.Worktree()
+	if err != nil {
+		u.t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(u.dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			u.t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			u.t.Fatal(err)
+		}
+		if _, err := worktree.Add(name); err != nil {
+			u.t.Fatal(err)
+		}
+	}
+
+	u.when = u.when.Add(24 * time.Hour)
+	hash, err := worktree.Commit(message, &git.CommitOptions{
+		Author: &object.Signature{Name: "Alice", Email: "alice@example.com", When: u.when},
+	})
+	if err != nil {
+		u.t.Fatal(err)
+	}
+	return hash.String()
+}
+
+func TestRemote(t *testing.T) {
+	up := newUpstream(t)
+	first := up.commit("Add log", map[string]string{"log/log.go": "package log\n", "README": "hi\n"})
+	up.commit("Update README", map[string]string{"README": "hello\n"})
+	third := up.commit("Add level", map[string]string{"log/log.go": "package log\n\nvar Level = 1\n", "log/sub/x.go": "package sub\n"})
+
+	remote := NewClient(t.TempDir()).Remote(up.dir)
+
+	commits, err := remote.GetCommitsSince("", "", "log", "", time.Time{}, "")
+	if err != nil {
+		t.Fatalf("GetCommitsSince failed: %v", err)
+	}
+	if len(commits) != 2 || commits[0].SHA != third || commits[1].SHA != first || commits[0].Author != "Alice" {
+		t.Errorf("Expected the two commits touching log/, got %+v", commits)
+	}
+	if commits, _ := remote.GetCommitsSince("", "", "log/log.go", "", time.Time{}, first); len(commits) != 1 || commits[0].SHA != third {
+		t.Errorf("Expected only the commit after the first, got %+v", commits)
+	}
+
+	file, err := remote.GetFile("", "", "log/log.go", third)
+	if err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	if file.Content != "package log\n\nvar Level = 1\n" || file.CommitID != third {
+		t.Errorf("Unexpected file: %+v", file)
+	}
+	if old, err := remote.GetFile("", "", "log/log.go", first); err != nil || old.Content != "package log\n" {
+		t.Errorf("Expected the first version, got %+v, %v", old, err)
+	}
+
+	files, err := remote.GetDirectory("", "", "log", "")
+	if err != nil {
+		t.Fatalf("GetDirectory failed: %v", err)
+	}
+	if len(files) != 2 || files["log/log.go"] == nil || files["log/sub/x.go"] == nil {
+		t.Errorf("Expected both files below log/, got %v", files)
+	}
+
+	patch, err := remote.GetFileDiff("", "", "log/log.go", first, third)
+	if err != nil || !strings.Contains(patch, "+ var Level = 1") {
+		t.Errorf("Unexpected diff: %q, %v", patch, err)
+	}
+}
+
+func TestRemoteBranchAndOffline(t *testing.T) {
+	up := newUpstream(t)
+	up.commit("Add log", map[string]string{"log.go": "v1\n"})
+
+	head, err := up.repo.Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	branch := plumbing.NewBranchReferenceName("release-1.x")
+	if err := up.repo.Storer.SetReference(plumbing.NewHashReference(branch, head.Hash())); err != nil {
+		t.Fatal(err)
+	}
+	up.commit("Update log", map[string]string{"log.go": "v2\n"})
+
+	cache := t.TempDir()
+	remote := NewClient(cache).Remote(up.dir)
+	if file, err := remote.GetFile("", "", "log.go", "release-1.x"); err != nil || file.Content != "v1\n" {
+		t.Errorf("Expected the release branch version, got %+v, %v", file, err)
+	}
+	if commits, err := remote.GetCommitsSince("", "", "log.go", "", time.Time{}, ""); err != nil || len(commits) != 2 {
+		t.Fatalf("Expected both commits on the default branch, got %+v, %v", commits, err)
+	}
+
+	// The clone keeps serving the source once the remote is gone
+	os.RemoveAll(up.dir)
+	offline := NewClient(cache).Remote(up.dir)
+	if commits, err := offline.GetCommitsSince("", "", "log.go", "", time.Time{}, ""); err != nil || len(commits) != 2 {
+		t.Errorf("Expected the cached commits offline, got %+v, %v", commits, err)
+	}
+	if file, err := offline.GetFile("", "", "log.go", ""); err != nil || file.Content != "v2\n" {
+		t.Errorf("Expected the cached file offline, got %+v, %v", file, err)
+	}
+}
@@ -0,0 +1,151 @@
+// Package kube is a minimal client for the Kubernetes API, covering what
+// codesync needs when it runs inside a cluster
+package kube
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir is where Kubernetes mounts the pod's service account
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// ErrNotFound is returned when the requested object does not exist
+var ErrNotFound = errors.New("not found")
+
+// ErrConflict is returned when an update is based on a stale resourceVersion
+var ErrConflict = errors.New("conflict")
+
+// Client talks to the Kubernetes API server with a bearer token
+type Client struct {
+	BaseURL   string // e.g. https://10.0.0.1:443
+	Token     string
+	Namespace string // Namespace the pod runs in
+	HTTP      *http.Client
+}
+
+// InClusterClient creates a client from the service account mounted into the
+// pod and the KUBERNETES_SERVICE_HOST/PORT environment variables
+func InClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster")
+	}
+
+	token, err := os.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading service account token: %w", err)
+	}
+
+	namespace, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading service account namespace: %w", err)
+	}
+
+	ca, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading cluster CA: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("invalid cluster CA certificate")
+	}
+
+	return &Client{
+		BaseURL:   "https://" + net.JoinHostPort(host, port),
+		Token:     strings.TrimSpace(string(token)),
+		Namespace: strings.TrimSpace(string(namespace)),
+		HTTP: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+	}, nil
+}
+
+// Get fetches the object at path into v
+func (c *Client) Get(ctx context.Context, path string, v interface{}) error {
+	return c.do(ctx, "GET", path, "", nil, v)
+}
+
+// Create posts obj to the collection at path and decodes the result into v
+func (c *Client) Create(ctx context.Context, path string, obj, v interface{}) error {
+	return c.do(ctx, "POST", path, "application/json", obj, v)
+}
+
+// Update replaces the object at path and decodes the result into v
+func (c *Client) Update(ctx context.Context, path string, obj, v interface{}) error {
+	return c.do(ctx, "PUT", path, "application/json", obj, v)
+}
+
+func (c *Client) do(ctx context.Context, method, path, contentType string, obj, v interface{}) error {
+	var body io.Reader
+	if obj != nil {
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return fmt.Errorf("error encoding request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%s %s: %w", method, path, ErrNotFound)
+	case resp.StatusCode == http.StatusConflict:
+		return fmt.Errorf("%s %s: %w", method, path, ErrConflict)
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		var status struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(data, &status)
+		return fmt.Errorf("%s %s: API server returned status code %d: %s", method, path, resp.StatusCode, status.Message)
+	}
+
+	if v != nil {
+		if err := json.Unmarshal(data, v); err != nil {
+			return fmt.Errorf("error parsing response: %w", err)
+		}
+	}
+
+	return nil
+}
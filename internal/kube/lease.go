@@ -0,0 +1,297 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// microTimeLayout is the wire format of metav1.MicroTime
+const microTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+// MicroTime is a timestamp with microsecond precision, as used by leases
+type MicroTime struct {
+	time.Time
+}
+
+// MarshalJSON encodes the time in UTC with microsecond precision
+func (t MicroTime) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + t.UTC().Format(microTimeLayout) + `"`), nil
+}
+
+// UnmarshalJSON decodes an RFC 3339 timestamp
+func (t *MicroTime) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	parsed, err := time.Parse(`"`+time.RFC3339Nano+`"`, string(data))
+	if err != nil {
+		return err
+	}
+	t.Time = parsed
+	return nil
+}
+
+// ObjectMeta holds the metadata fields codesync reads and writes
+type ObjectMeta struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	Generation      int64  `json:"generation,omitempty"`
+}
+
+// Lease is a coordination.k8s.io/v1 Lease
+type Lease struct {
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Metadata   ObjectMeta `json:"metadata"`
+	Spec       LeaseSpec  `json:"spec"`
+}
+
+// LeaseSpec is the spec of a Lease
+type LeaseSpec struct {
+	HolderIdentity       string     `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int        `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          *MicroTime `json:"acquireTime,omitempty"`
+	RenewTime            *MicroTime `json:"renewTime,omitempty"`
+	LeaseTransitions     int        `json:"leaseTransitions,omitempty"`
+}
+
+// LeaderElector elects a single leader among replicas using a Lease object.
+// The leader renews the lease periodically and steps down once it hasn't
+// renewed it for RenewDeadline. Other replicas take over once they have seen
+// the lease unchanged for LeaseDuration, by their own clock, so the leader
+// has stopped by then whatever the clocks of the two say.
+type LeaderElector struct {
+	Client    *Client
+	Namespace string
+	Name      string // Name of the Lease object
+	Identity  string // Unique identity of this replica, usually the pod name
+
+	LeaseDuration time.Duration // How long a lease is valid without renewal, default 15s
+	RenewDeadline time.Duration // How long the leader tries to renew before stepping down, default 10s
+	RetryPeriod   time.Duration // How often to try to acquire or renew, default 2s
+
+	now func() time.Time
+
+	observed   string    // Resource version of the lease last seen
+	observedAt time.Time // When it was first seen, by the local clock
+}
+
+// Run blocks until ctx is cancelled, calling lead with a context that is
+// cancelled when leadership is lost. The lease is released on shutdown so
+// another replica can take over immediately.
+func (e *LeaderElector) Run(ctx context.Context, lead func(ctx context.Context)) error {
+	retry := e.retryPeriod()
+	if e.renewDeadline() >= e.leaseDuration() || retry >= e.renewDeadline() {
+		return fmt.Errorf("leader election needs retry period < renew deadline < lease duration, got %s, %s and %s", retry, e.renewDeadline(), e.leaseDuration())
+	}
+
+	for {
+		if err := e.waitForLease(ctx, retry); err != nil {
+			return err
+		}
+
+		log.Printf("acquired leader lease %s/%s as %s", e.Namespace, e.Name, e.Identity)
+		leaderCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			lead(leaderCtx)
+		}()
+
+		err := e.renewLoop(leaderCtx, retry)
+		cancel()
+		<-done
+
+		if ctx.Err() != nil {
+			e.release()
+			return ctx.Err()
+		}
+		log.Printf("lost leader lease %s/%s: %v", e.Namespace, e.Name, err)
+	}
+}
+
+// waitForLease retries until the lease is acquired or ctx is cancelled
+func (e *LeaderElector) waitForLease(ctx context.Context, retry time.Duration) error {
+	ticker := time.NewTicker(retry)
+	defer ticker.Stop()
+
+	for {
+		acquired, err := e.tryAcquireOrRenew(ctx)
+		if err != nil {
+			log.Printf("error acquiring leader lease: %v", err)
+		}
+		if acquired {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// renewLoop renews the lease until ctx is cancelled, another replica holds
+// it, or renewal has failed for longer than the renew deadline. Renewals count
+// from when they were sent, the earliest other replicas may have seen them.
+func (e *LeaderElector) renewLoop(ctx context.Context, retry time.Duration) error {
+	ticker := time.NewTicker(retry)
+	defer ticker.Stop()
+
+	lastRenew := e.clock()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		attempt := e.clock()
+		renewCtx, cancel := context.WithDeadline(ctx, lastRenew.Add(e.renewDeadline()))
+		renewed, err := e.tryAcquireOrRenew(renewCtx)
+		cancel()
+		switch {
+		case renewed:
+			lastRenew = attempt
+		case err == nil:
+			return fmt.Errorf("lease is held by another replica")
+		case e.clock().Sub(lastRenew) >= e.renewDeadline():
+			return fmt.Errorf("failed to renew within %s: %w", e.renewDeadline(), err)
+		default:
+			log.Printf("error renewing leader lease: %v", err)
+		}
+	}
+}
+
+// tryAcquireOrRenew takes the lease if it is free, expired or already ours,
+// and reports whether this replica now holds it
+func (e *LeaderElector) tryAcquireOrRenew(ctx context.Context) (bool, error) {
+	now := MicroTime{e.clock()}
+	path := e.path()
+
+	var lease Lease
+	err := e.Client.Get(ctx, path, &lease)
+	if errors.Is(err, ErrNotFound) {
+		lease = Lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   ObjectMeta{Name: e.Name, Namespace: e.Namespace},
+			Spec: LeaseSpec{
+				HolderIdentity:       e.Identity,
+				LeaseDurationSeconds: int(e.leaseDuration() / time.Second),
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		err := e.Client.Create(ctx, e.collectionPath(), &lease, nil)
+		if errors.Is(err, ErrConflict) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+	e.observe(lease)
+
+	holder := lease.Spec.HolderIdentity
+	if holder != "" && holder != e.Identity && !e.expired(lease) {
+		return false, nil
+	}
+
+	if holder != e.Identity {
+		lease.Spec.HolderIdentity = e.Identity
+		lease.Spec.AcquireTime = &now
+		lease.Spec.LeaseTransitions++
+	}
+	lease.Spec.RenewTime = &now
+	lease.Spec.LeaseDurationSeconds = int(e.leaseDuration() / time.Second)
+
+	err = e.Client.Update(ctx, path, &lease, nil)
+	if errors.Is(err, ErrConflict) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// release gives up the lease if this replica still holds it
+func (e *LeaderElector) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var lease Lease
+	if err := e.Client.Get(ctx, e.path(), &lease); err != nil || lease.Spec.HolderIdentity != e.Identity {
+		return
+	}
+
+	lease.Spec.HolderIdentity = ""
+	lease.Spec.RenewTime = nil
+	if err := e.Client.Update(ctx, e.path(), &lease, nil); err != nil {
+		log.Printf("error releasing leader lease: %v", err)
+	}
+}
+
+// observe records when a version of the lease was first seen
+func (e *LeaderElector) observe(lease Lease) {
+	if lease.Metadata.ResourceVersion != e.observed || e.observedAt.IsZero() {
+		e.observed = lease.Metadata.ResourceVersion
+		e.observedAt = e.clock()
+	}
+}
+
+// expired reports whether the lease, as last observed, has gone unrenewed
+// for its duration. The holder's RenewTime is from its own clock, so only
+// how long the lease has been seen unchanged here counts.
+func (e *LeaderElector) expired(lease Lease) bool {
+	if lease.Spec.RenewTime == nil {
+		return true
+	}
+
+	duration := time.Duration(lease.Spec.LeaseDurationSeconds) * time.Second
+	if duration == 0 {
+		duration = e.leaseDuration()
+	}
+	return e.clock().Sub(e.observedAt) > duration
+}
+
+func (e *LeaderElector) collectionPath() string {
+	return fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", e.Namespace)
+}
+
+func (e *LeaderElector) path() string {
+	return e.collectionPath() + "/" + e.Name
+}
+
+func (e *LeaderElector) leaseDuration() time.Duration {
+	if e.LeaseDuration > 0 {
+		return e.LeaseDuration
+	}
+	return 15 * time.Second
+}
+
+func (e *LeaderElector) renewDeadline() time.Duration {
+	if e.RenewDeadline > 0 {
+		return e.RenewDeadline
+	}
+	return 10 * time.Second
+}
+
+func (e *LeaderElector) retryPeriod() time.Duration {
+	if e.RetryPeriod > 0 {
+		return e.RetryPeriod
+	}
+	return 2 * time.Second
+}
+
+func (e *LeaderElector) clock() time.Time {
+	if e.now != nil {
+		return e.now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,199 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLeaseServer stores a single lease and enforces resourceVersion checks
+type fakeLeaseServer struct {
+	mu      sync.Mutex
+	lease   *Lease
+	version int
+}
+
+func (f *fakeLeaseServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case "GET":
+		if f.lease == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(f.lease)
+
+	case "POST", "PUT":
+		var lease Lease
+		json.NewDecoder(r.Body).Decode(&lease)
+
+		if r.Method == "POST" && f.lease != nil {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if r.Method == "PUT" && (f.lease == nil || lease.Metadata.ResourceVersion != f.lease.Metadata.ResourceVersion) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		f.version++
+		lease.Metadata.ResourceVersion = strconv.Itoa(f.version)
+		f.lease = &lease
+		json.NewEncoder(w).Encode(f.lease)
+	}
+}
+
+func (f *fakeLeaseServer) holder() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.lease == nil {
+		return ""
+	}
+	return f.lease.Spec.HolderIdentity
+}
+
+func TestLeaderElection(t *testing.T) {
+	fake := &fakeLeaseServer{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	client := &Client{BaseURL: server.URL}
+
+	a := &LeaderElector{Client: client, Namespace: "default", Name: "codesync", Identity: "a", now: clock}
+	skewed := func() time.Time { return now.Add(time.Hour) }
+	b := &LeaderElector{Client: client, Namespace: "default", Name: "codesync", Identity: "b", now: skewed}
+
+	ctx := context.Background()
+	if ok, err := a.tryAcquireOrRenew(ctx); !ok || err != nil {
+		t.Fatalf("Expected a to acquire the free lease: %v %v", ok, err)
+	}
+	if ok, err := b.tryAcquireOrRenew(ctx); ok || err != nil {
+		t.Fatalf("Expected b not to acquire a held lease: %v %v", ok, err)
+	}
+	if ok, err := a.tryAcquireOrRenew(ctx); !ok || err != nil {
+		t.Fatalf("Expected a to renew its lease: %v %v", ok, err)
+	}
+
+	// Expiry is judged by how long b has seen the lease unchanged, not by
+	// the renew time a's clock wrote, so b's clock being ahead doesn't matter
+	if ok, err := b.tryAcquireOrRenew(ctx); ok || err != nil {
+		t.Fatalf("Expected b not to acquire a lease it has just seen renewed: %v %v", ok, err)
+	}
+	now = now.Add(10 * time.Second)
+	if ok, _ := b.tryAcquireOrRenew(ctx); ok {
+		t.Fatal("Expected b not to acquire a lease seen unchanged for less than its duration")
+	}
+
+	// Once a stops renewing, b takes over
+	now = now.Add(10 * time.Second)
+	if ok, err := b.tryAcquireOrRenew(ctx); !ok || err != nil {
+		t.Fatalf("Expected b to acquire the expired lease: %v %v", ok, err)
+	}
+	if fake.holder() != "b" || fake.lease.Spec.LeaseTransitions != 1 {
+		t.Errorf("Unexpected lease after takeover: %+v", fake.lease.Spec)
+	}
+	if ok, _ := a.tryAcquireOrRenew(ctx); ok {
+		t.Error("Expected a to lose the lease")
+	}
+}
+
+func TestLeaderElectorRunReleasesLease(t *testing.T) {
+	fake := &fakeLeaseServer{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	e := &LeaderElector{
+		Client:      &Client{BaseURL: server.URL},
+		Namespace:   "default",
+		Name:        "codesync",
+		Identity:    "a",
+		RetryPeriod: 10 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leading := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- e.Run(ctx, func(ctx context.Context) {
+			close(leading)
+			<-ctx.Done()
+		})
+	}()
+
+	select {
+	case <-leading:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for leadership")
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if holder := fake.holder(); holder != "" {
+		t.Errorf("Expected lease to be released, held by %q", holder)
+	}
+}
+
+func TestLeaderElectorStepsDownBeforeExpiry(t *testing.T) {
+	fake := &fakeLeaseServer{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	e := &LeaderElector{
+		Client:        &Client{BaseURL: server.URL},
+		Namespace:     "default",
+		Name:          "codesync",
+		Identity:      "a",
+		LeaseDuration: 300 * time.Millisecond,
+		RenewDeadline: 100 * time.Millisecond,
+		RetryPeriod:   10 * time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopped := make(chan time.Time, 1)
+	go e.Run(ctx, func(ctx context.Context) {
+		// The API server goes away while a leads
+		server.Close()
+		start := time.Now()
+		<-ctx.Done()
+		stopped <- start
+	})
+
+	select {
+	case start := <-stopped:
+		if elapsed := time.Since(start); elapsed >= e.LeaseDuration {
+			t.Errorf("Expected to step down within the renew deadline, took %s", elapsed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the leader to step down")
+	}
+}
+
+func TestMicroTimeRoundTrip(t *testing.T) {
+	in := MicroTime{time.Date(2025, 1, 1, 12, 0, 0, 123456000, time.UTC)}
+
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(data) != `"2025-01-01T12:00:00.123456Z"` {
+		t.Errorf("Unexpected encoding: %s", data)
+	}
+
+	var out MicroTime
+	if err := json.Unmarshal(data, &out); err != nil || !out.Equal(in.Time) {
+		t.Errorf("Round trip failed: %v %v", out, err)
+	}
+}
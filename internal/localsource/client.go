@@ -0,0 +1,186 @@
+// Package localsource reads files from another checkout on disk, such as a
+// monorepo a package was extracted from. Paths are filesystem paths, relative
+// to the working directory unless absolute. There is no history to read, so
+// a change is detected from file modification times and content hashes: the
+// "commit" of a file or directory is a hash of its content.
+package localsource
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/github"
+)
+
+// Client reads from the local filesystem. Owner, repository and ref
+// arguments are ignored; only the current content of a path can be read.
+type Client struct{}
+
+// NewClient creates a client for the local filesystem
+func NewClient() *Client {
+	return &Client{}
+}
+
+// GetFile reads a file
+func (c *Client) GetFile(owner, repo, filePath, ref string) (*github.FileInfo, error) {
+	content, err := os.ReadFile(filepath.FromSlash(filePath))
+	if err != nil {
+		return nil, fmt.Errorf("error getting file content: %w", err)
+	}
+
+	sha := contentHash(content)
+	return &github.FileInfo{
+		Content:  string(content),
+		Path:     filePath,
+		SHA:      sha,
+		CommitID: sha,
+	}, nil
+}
+
+// GetDirectory reads all files below a directory. Hidden files and
+// directories, such as .git, are skipped.
+func (c *Client) GetDirectory(owner, repo, dirPath, ref string) (map[string]*github.FileInfo, error) {
+	files, err := walk(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("error getting directory content: %w", err)
+	}
+
+	commitID := treeHash(files)
+	result := make(map[string]*github.FileInfo, len(files))
+	for name, file := range files {
+		key := path.Join(filepath.ToSlash(dirPath), name)
+		result[key] = &github.FileInfo{
+			Content:  string(file.content),
+			Path:     key,
+			SHA:      contentHash(file.content),
+			CommitID: commitID,
+		}
+	}
+	return result, nil
+}
+
+// GetCommitsSince returns a single synthetic commit if a file or directory
+// changed: its content hash differs from sinceCommit, and it was modified
+// after since. The commit's SHA is the content hash and its timestamp the
+// latest modification time.
+func (c *Client) GetCommitsSince(owner, repo, filePath, ref string, since time.Time, sinceCommit string) ([]github.CommitInfo, error) {
+	info, err := os.Stat(filepath.FromSlash(filePath))
+	if err != nil {
+		return nil, fmt.Errorf("error listing commits: %w", err)
+	}
+
+	var sha string
+	modified := info.ModTime()
+	if info.IsDir() {
+		files, err := walk(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("error listing commits: %w", err)
+		}
+		sha = treeHash(files)
+		modified = time.Time{}
+		for _, file := range files {
+			if file.modified.After(modified) {
+				modified = file.modified
+			}
+		}
+	} else {
+		content, err := os.ReadFile(filepath.FromSlash(filePath))
+		if err != nil {
+			return nil, fmt.Errorf("error listing commits: %w", err)
+		}
+		sha = contentHash(content)
+	}
+
+	if sha == sinceCommit || (!since.IsZero() && !modified.After(since)) {
+		return nil, nil
+	}
+
+	return []github.CommitInfo{{
+		SHA:       sha,
+		Message:   "Local changes to " + filePath,
+		Timestamp: modified,
+	}}, nil
+}
+
+// GetFileDiff gets the diff between two versions of a file. Only the current
+// version can be read, so baseRef must be its hash.
+func (c *Client) GetFileDiff(owner, repo, filePath, baseRef, headRef string) (string, error) {
+	file, err := c.GetFile(owner, repo, filePath, headRef)
+	if err != nil {
+		return "", err
+	}
+	if baseRef == file.SHA {
+		return "", fmt.Errorf("file %s was not changed between %s and %s", filePath, baseRef, headRef)
+	}
+	return "", fmt.Errorf("previous versions of local file %s are not available", filePath)
+}
+
+type localFile struct {
+	content  []byte
+	modified time.Time
+}
+
+// walk reads the files below a directory, keyed by slash-separated paths
+// relative to it
+func walk(dirPath string) (map[string]localFile, error) {
+	root := filepath.FromSlash(dirPath)
+	files := make(map[string]localFile)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = localFile{content: content, modified: info.ModTime()}
+		return nil
+	})
+	return files, err
+}
+
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:20])
+}
+
+// treeHash hashes the names and content of a directory's files
+func treeHash(files map[string]localFile) string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(h, "%s\x00%s\x00", name, contentHash(files[name].content))
+	}
+	return hex.EncodeToString(h.Sum(nil)[:20])
+}
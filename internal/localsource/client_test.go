@@ -0,0 +1,93 @@
+package localsource
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string, modified time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetFileAndCommits(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log.go")
+	written := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	writeFile(t, path, "package log\n", written)
+
+	c := NewClient()
+	file, err := c.GetFile("", "", path, "")
+	if err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	if file.Content != "package log\n" || file.CommitID != file.SHA {
+		t.Errorf("Unexpected file: %+v", file)
+	}
+
+	commits, err := c.GetCommitsSince("", "", path, "", time.Time{}, "")
+	if err != nil {
+		t.Fatalf("GetCommitsSince failed: %v", err)
+	}
+	if len(commits) != 1 || commits[0].SHA != file.SHA || !commits[0].Timestamp.Equal(written) {
+		t.Fatalf("Expected one commit for the current content, got %+v", commits)
+	}
+
+	// Unchanged content, or no modification since a date, is no change
+	if commits, _ := c.GetCommitsSince("", "", path, "", time.Time{}, file.SHA); len(commits) != 0 {
+		t.Errorf("Expected no commits for unchanged content, got %+v", commits)
+	}
+	if commits, _ := c.GetCommitsSince("", "", path, "", written, ""); len(commits) != 0 {
+		t.Errorf("Expected no commits without a newer modification, got %+v", commits)
+	}
+
+	writeFile(t, path, "package log\n\nfunc Info() {}\n", written.Add(time.Hour))
+	commits, err = c.GetCommitsSince("", "", path, "", written, file.SHA)
+	if err != nil || len(commits) != 1 || commits[0].SHA == file.SHA {
+		t.Errorf("Expected a commit for the changed content, got %+v, %v", commits, err)
+	}
+}
+
+func TestGetDirectory(t *testing.T) {
+	dir := t.TempDir()
+	written := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	writeFile(t, filepath.Join(dir, "pkg", "a.go"), "package pkg\n", written)
+	writeFile(t, filepath.Join(dir, "pkg", "sub", "b.go"), "package sub\n", written.Add(time.Hour))
+	writeFile(t, filepath.Join(dir, "pkg", ".git", "HEAD"), "ref: refs/heads/main\n", written)
+
+	c := NewClient()
+	root := filepath.ToSlash(filepath.Join(dir, "pkg"))
+	files, err := c.GetDirectory("", "", root, "")
+	if err != nil {
+		t.Fatalf("GetDirectory failed: %v", err)
+	}
+	if len(files) != 2 || files[root+"/a.go"] == nil || files[root+"/sub/b.go"].Content != "package sub\n" {
+		t.Fatalf("Unexpected files: %v", files)
+	}
+
+	commits, err := c.GetCommitsSince("", "", root, "", time.Time{}, "")
+	if err != nil || len(commits) != 1 {
+		t.Fatalf("Expected one commit, got %+v, %v", commits, err)
+	}
+	if commits[0].SHA != files[root+"/a.go"].CommitID || !commits[0].Timestamp.Equal(written.Add(time.Hour)) {
+		t.Errorf("Expected the tree hash and latest modification time, got %+v", commits[0])
+	}
+
+	// Renaming a file changes the tree hash
+	if err := os.Rename(filepath.Join(dir, "pkg", "a.go"), filepath.Join(dir, "pkg", "c.go")); err != nil {
+		t.Fatal(err)
+	}
+	if renamed, _ := c.GetCommitsSince("", "", root, "", time.Time{}, commits[0].SHA); len(renamed) != 1 {
+		t.Errorf("Expected a commit after a rename, got %+v", renamed)
+	}
+}
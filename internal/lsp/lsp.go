@@ -0,0 +1,352 @@
+// Package lsp is a minimal language server that tells editors which files
+// codesync manages, where their code comes from and how stale it is. It
+// publishes a diagnostic on each managed file that is opened or saved, and
+// answers codesync/managed requests with the details as JSON.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	csync "github.com/exitflynn/codesync/internal/sync"
+)
+
+// Diagnostic severities
+const (
+	severityWarning     = 2
+	severityInformation = 3
+)
+
+// JSON-RPC error codes
+const (
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// message is a JSON-RPC request, response or notification
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  any              `json:"result,omitempty"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Position is a zero-based line and character in a document
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range is a span of a document
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Diagnostic is a message an editor shows on a range of a document
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+type textDocument struct {
+	URI  string `json:"uri"`
+	Text string `json:"text,omitempty"`
+}
+
+type documentParams struct {
+	TextDocument textDocument `json:"textDocument"`
+}
+
+// Server answers an editor's requests about the files of a sync manager
+type Server struct {
+	manager *csync.SyncManager
+	version string
+
+	mu  sync.Mutex // Serializes writes
+	out io.Writer
+}
+
+// New creates a server for the items of manager
+func New(manager *csync.SyncManager, version string) *Server {
+	return &Server{manager: manager, version: version}
+}
+
+// Serve reads requests from in and writes responses and notifications to out
+// until the editor sends exit or closes in
+func (s *Server) Serve(in io.Reader, out io.Writer) error {
+	s.out = out
+	r := bufio.NewReader(in)
+	for {
+		msg, err := readMessage(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			return nil
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// handle answers a request or acts on a notification
+func (s *Server) handle(msg *message) error {
+	var result any
+	var rpcErr *responseError
+
+	switch msg.Method {
+	case "initialize":
+		result = map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync": map[string]any{"openClose": true, "save": true},
+			},
+			"serverInfo": map[string]string{"name": "codesync", "version": s.version},
+		}
+	case "shutdown":
+		result = nil
+	case "textDocument/didOpen", "textDocument/didSave":
+		var params documentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil
+		}
+		return s.publish(params.TextDocument)
+	case "textDocument/didClose":
+		var params documentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil
+		}
+		return s.notify("textDocument/publishDiagnostics", map[string]any{"uri": params.TextDocument.URI, "diagnostics": []Diagnostic{}})
+	case "codesync/managed":
+		var params documentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			rpcErr = &responseError{Code: codeInvalidParams, Message: err.Error()}
+			break
+		}
+		managed, err := s.managed(params.TextDocument.URI)
+		if err != nil {
+			rpcErr = &responseError{Code: codeInternalError, Message: err.Error()}
+			break
+		}
+		result = managed
+	default:
+		if msg.ID == nil {
+			return nil // Notifications the server doesn't need
+		}
+		rpcErr = &responseError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method}
+	}
+
+	if msg.ID == nil {
+		return nil
+	}
+	return s.write(&message{JSONRPC: "2.0", ID: msg.ID, Result: result, Error: rpcErr})
+}
+
+// publish sends the diagnostics of a document
+func (s *Server) publish(doc textDocument) error {
+	managed, err := s.managed(doc.URI)
+	if err != nil {
+		return s.notify("window/logMessage", map[string]any{"type": 1, "message": "codesync: " + err.Error()})
+	}
+
+	text := doc.Text
+	if text == "" {
+		if path, err := filePath(doc.URI); err == nil {
+			content, _ := os.ReadFile(path)
+			text = string(content)
+		}
+	}
+
+	diagnostics := []Diagnostic{}
+	for _, m := range managed {
+		diagnostics = append(diagnostics, diagnose(m, text))
+	}
+	return s.notify("textDocument/publishDiagnostics", map[string]any{"uri": doc.URI, "diagnostics": diagnostics})
+}
+
+// managed returns the items that sync into the file of a document
+func (s *Server) managed(uri string) ([]csync.ManagedFile, error) {
+	path, err := filePath(uri)
+	if err != nil {
+		return nil, err
+	}
+	managed, err := s.manager.Managed(path)
+	if managed == nil {
+		managed = []csync.ManagedFile{}
+	}
+	return managed, err
+}
+
+// diagnose describes an item syncing into a document, on the line where its
+// function or region starts, or the first line
+func diagnose(m csync.ManagedFile, text string) Diagnostic {
+	line := 0
+	switch {
+	case m.Function != "":
+		line = findLine(text, regexp.MustCompile(`\b(func|def|function|fn)\b.*\b`+regexp.QuoteMeta(m.Function)+`\s*[(<\[]`))
+	case m.Marker != "":
+		line = findLine(text, regexp.MustCompile(`codesync-begin\s+`+regexp.QuoteMeta(m.Marker)+`\b`))
+	}
+
+	what := "This file"
+	if m.Function != "" {
+		what = "Function " + m.Function
+	} else if m.Marker != "" {
+		what = "Region " + m.Marker
+	}
+	msg := fmt.Sprintf("%s is synced from %s by codesync item %s", what, m.Source, m.Item)
+	if m.LastSync.IsZero() {
+		msg += "; it hasn't synced yet"
+	} else {
+		msg += fmt.Sprintf("; last synced %s", m.LastSync.Format("2006-01-02"))
+		if m.LastCommitID != "" {
+			msg += " at " + shortSHA(m.LastCommitID)
+		}
+	}
+
+	severity := severityInformation
+	if m.CommitsBehind > 0 {
+		severity = severityWarning
+		msg += fmt.Sprintf(". %d upstream %s not applied yet", m.CommitsBehind, plural(m.CommitsBehind, "commit is", "commits are"))
+	}
+	if m.Edited {
+		severity = severityWarning
+		msg += ". It was edited locally; make the change upstream, or it will conflict with upstream updates"
+	}
+	if m.Conflict != "" {
+		severity = severityWarning
+		msg += fmt.Sprintf(". Conflict %s is open: run codesync conflicts show %s", m.Conflict, m.Conflict)
+	}
+
+	return Diagnostic{
+		Range:    Range{Start: Position{Line: line}, End: Position{Line: line + 1}},
+		Severity: severity,
+		Source:   "codesync",
+		Message:  msg,
+	}
+}
+
+// findLine returns the first line of text matching re, or 0
+func findLine(text string, re *regexp.Regexp) int {
+	for i, line := range strings.Split(text, "\n") {
+		if re.MatchString(line) {
+			return i
+		}
+	}
+	return 0
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
+// filePath returns the path of a file URI
+func filePath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", fmt.Errorf("invalid document URI %q: %w", uri, err)
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("unsupported document URI %q", uri)
+	}
+	return u.Path, nil
+}
+
+// notify sends a notification to the editor
+func (s *Server) notify(method string, params any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return s.write(&message{JSONRPC: "2.0", Method: method, Params: data})
+}
+
+// write sends a message with its Content-Length header
+func (s *Server) write(msg *message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	// A response without an error has a result, even if it is null
+	if msg.ID != nil && msg.Error == nil && msg.Result == nil {
+		data, err = json.Marshal(struct {
+			JSONRPC string           `json:"jsonrpc"`
+			ID      *json.RawMessage `json:"id"`
+			Result  any              `json:"result"`
+		}{msg.JSONRPC, msg.ID, nil})
+		if err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+// readMessage reads a message with its headers
+func readMessage(r *bufio.Reader) (*message, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok && strings.EqualFold(name, "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("invalid Content-Length %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("message without Content-Length")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, fmt.Errorf("invalid message: %w", err)
+	}
+	return &msg, nil
+}
@@ -0,0 +1,130 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	csync "github.com/exitflynn/codesync/internal/sync"
+)
+
+func request(id int, method string, params any) string {
+	data, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+	return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+func notification(method string, params any) string {
+	data, _ := json.Marshal(map[string]any{"jsonrpc": "2.0", "method": method, "params": params})
+	return fmt.Sprintf("Content-Length: %d\r\n\r\n%s", len(data), data)
+}
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	content := "package util\n\n// TrimAll trims\nfunc TrimAll(s string) string {\n\treturn s\n}\n"
+	if err := os.WriteFile("strings.go", []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Version: "1.0", GitHubToken: "test-token", Items: []config.SyncItem{{
+		Name:   "trim",
+		Source: config.SyncSource{Owner: "acme", Repo: "utils", Path: "strings.go", Branch: "main"},
+		Target: config.SyncTarget{Path: "strings.go", Type: "function", Language: "go", Function: "TrimAll"},
+	}}}
+	stateDir := filepath.Join(dir, ".codesync")
+	state := fmt.Sprintf(`{"lastSync": "2024-03-01T00:00:00Z", "lastCommitID": "abc1234", "currentLocalHash": "%x", "commitsBehind": 2}`, len(content))
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stateDir, "trim.json"), []byte(state), 0644); err != nil {
+		t.Fatal(err)
+	}
+	manager, err := csync.NewSyncManager(cfg, stateDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uri := "file://" + filepath.Join(dir, "strings.go")
+	other := "file://" + filepath.Join(dir, "main.go")
+	in := strings.Join([]string{
+		request(1, "initialize", map[string]any{}),
+		notification("initialized", map[string]any{}),
+		notification("textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": uri, "text": content}}),
+		notification("textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": other, "text": "package util\n"}}),
+		request(2, "codesync/managed", map[string]any{"textDocument": map[string]any{"uri": uri}}),
+		request(3, "textDocument/hover", map[string]any{}),
+		request(4, "shutdown", nil),
+		notification("exit", nil),
+	}, "")
+
+	var out bytes.Buffer
+	if err := New(manager, "v1.2.3").Serve(strings.NewReader(in), &out); err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+
+	raw := out.String()
+	var replies []message
+	r := bufio.NewReader(&out)
+	for {
+		msg, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		replies = append(replies, *msg)
+	}
+	if len(replies) != 6 {
+		t.Fatalf("Expected 6 messages, got %d: %s", len(replies), raw)
+	}
+
+	var diagnostics struct {
+		URI         string       `json:"uri"`
+		Diagnostics []Diagnostic `json:"diagnostics"`
+	}
+	if err := json.Unmarshal(replies[1].Params, &diagnostics); err != nil || replies[1].Method != "textDocument/publishDiagnostics" {
+		t.Fatalf("Expected diagnostics, got %+v", replies[1])
+	}
+	if len(diagnostics.Diagnostics) != 1 {
+		t.Fatalf("Expected a diagnostic for the synced function, got %+v", diagnostics)
+	}
+	d := diagnostics.Diagnostics[0]
+	if d.Range.Start.Line != 3 || d.Severity != severityWarning || !strings.Contains(d.Message, "acme/utils/strings.go@main") || !strings.Contains(d.Message, "2 upstream commits") {
+		t.Errorf("Unexpected diagnostic: %+v", d)
+	}
+
+	if err := json.Unmarshal(replies[2].Params, &diagnostics); err != nil || len(diagnostics.Diagnostics) != 0 {
+		t.Errorf("Expected no diagnostics for an unmanaged file, got %+v", diagnostics)
+	}
+
+	data, _ := json.Marshal(replies[3].Result)
+	var managed []csync.ManagedFile
+	if err := json.Unmarshal(data, &managed); err != nil || len(managed) != 1 || managed[0].Item != "trim" || managed[0].Edited || managed[0].LastSync != time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC) {
+		t.Errorf("Unexpected managed items: %s", data)
+	}
+
+	if replies[4].Error == nil || replies[4].Error.Code != codeMethodNotFound {
+		t.Errorf("Expected an unknown request to fail, got %+v", replies[4])
+	}
+	if !strings.Contains(raw, `{"jsonrpc":"2.0","id":4,"result":null}`) {
+		t.Errorf("Expected a null result for shutdown, got %s", raw)
+	}
+}
+
+func TestDiagnoseEdited(t *testing.T) {
+	d := diagnose(csync.ManagedFile{Item: "preamble", Source: "acme/ci/lint.sh", Marker: "preamble", Edited: true, Conflict: "3f9a1c2e"},
+		"#!/bin/sh\n# codesync-begin preamble\nset -eu\n# codesync-end preamble\n")
+	if d.Range.Start.Line != 1 || d.Severity != severityWarning {
+		t.Errorf("Unexpected diagnostic: %+v", d)
+	}
+	for _, want := range []string{"Region preamble", "hasn't synced yet", "edited locally", "conflicts show 3f9a1c2e"} {
+		if !strings.Contains(d.Message, want) {
+			t.Errorf("Expected %q in %q", want, d.Message)
+		}
+	}
+}
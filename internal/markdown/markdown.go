@@ -0,0 +1,174 @@
+// Package markdown extracts and replaces sections of markdown documents and
+// rewrites their relative links
+package markdown
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	headingPattern = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?[ \t#]*$`)
+	fencePattern   = regexp.MustCompile("^ {0,3}(```|~~~)")
+	slugStrip      = regexp.MustCompile(`[^\p{L}\p{N}\- ]`)
+
+	// Inline links and images: [text](url "title") and ![alt](url)
+	inlineLinkPattern = regexp.MustCompile(`(!?)\[([^\]]*)\]\(\s*<?([^)\s>]+)>?((?:\s+"[^"]*")?\s*)\)`)
+	// Reference definitions: [label]: url
+	refLinkPattern = regexp.MustCompile(`^( {0,3}\[[^\]]+\]:\s*)(\S+)(.*)$`)
+)
+
+// Slug returns the anchor GitHub generates for a heading
+func Slug(heading string) string {
+	slug := strings.ToLower(strings.TrimSpace(heading))
+	slug = slugStrip.ReplaceAllString(slug, "")
+	return strings.ReplaceAll(slug, " ", "-")
+}
+
+// heading is an ATX heading in a document
+type heading struct {
+	line  int
+	level int
+	text  string
+}
+
+// headings lists the headings in lines, skipping fenced code blocks
+func headings(lines []string) []heading {
+	var result []heading
+	fence := ""
+	for i, line := range lines {
+		if m := fencePattern.FindStringSubmatch(line); m != nil {
+			switch fence {
+			case "":
+				fence = m[1]
+			case m[1]:
+				fence = ""
+			}
+			continue
+		}
+		if fence != "" {
+			continue
+		}
+		if m := headingPattern.FindStringSubmatch(line); m != nil {
+			result = append(result, heading{line: i, level: len(m[1]), text: m[2]})
+		}
+	}
+	return result
+}
+
+// matches reports whether a heading is the one a selector names: its text
+// (ignoring case) or its anchor, with or without the leading #
+func (h heading) matches(selector string) bool {
+	selector = strings.TrimSpace(selector)
+	if strings.EqualFold(h.text, selector) {
+		return true
+	}
+	return Slug(h.text) == strings.TrimPrefix(selector, "#")
+}
+
+// findSection returns the line range of the section starting at the heading
+// named by selector and ending before the next heading of the same or a
+// higher level
+func findSection(lines []string, selector string) (int, int, error) {
+	hs := headings(lines)
+	for i, h := range hs {
+		if !h.matches(selector) {
+			continue
+		}
+		end := len(lines)
+		for _, next := range hs[i+1:] {
+			if next.level <= h.level {
+				end = next.line
+				break
+			}
+		}
+		return h.line, end, nil
+	}
+	return 0, 0, fmt.Errorf("section %q not found", selector)
+}
+
+// Section returns the section of a document under the heading named by
+// selector, including the heading itself
+func Section(doc, selector string) (string, error) {
+	lines := strings.Split(doc, "\n")
+	start, end, err := findSection(lines, selector)
+	if err != nil {
+		return "", err
+	}
+	return trimSection(lines[start:end]), nil
+}
+
+// ReplaceSection replaces the section named by selector with content. If the
+// document doesn't have the section, content is appended.
+func ReplaceSection(doc, selector, content string) string {
+	content = strings.TrimRight(content, "\n") + "\n"
+
+	lines := strings.Split(doc, "\n")
+	start, end, err := findSection(lines, selector)
+	if err != nil {
+		doc = strings.TrimRight(doc, "\n")
+		if doc == "" {
+			return content
+		}
+		return doc + "\n\n" + content
+	}
+
+	// Sections are separated from the next heading by one blank line
+	out := append([]string{}, lines[:start]...)
+	out = append(out, strings.Split(strings.TrimRight(content, "\n"), "\n")...)
+	out = append(out, "")
+	out = append(out, lines[end:]...)
+	return strings.Join(out, "\n")
+}
+
+// trimSection joins section lines without the trailing blank lines
+func trimSection(lines []string) string {
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n \t") + "\n"
+}
+
+// RewriteLinks passes the target of every relative link and image in doc
+// through rewrite. Absolute URLs, in-page anchors and links inside code
+// blocks are left alone. image is true for image targets.
+func RewriteLinks(doc string, rewrite func(target string, image bool) string) string {
+	lines := strings.Split(doc, "\n")
+	fence := ""
+	for i, line := range lines {
+		if m := fencePattern.FindStringSubmatch(line); m != nil {
+			switch fence {
+			case "":
+				fence = m[1]
+			case m[1]:
+				fence = ""
+			}
+			continue
+		}
+		if fence != "" {
+			continue
+		}
+
+		line = inlineLinkPattern.ReplaceAllStringFunc(line, func(link string) string {
+			m := inlineLinkPattern.FindStringSubmatch(link)
+			if !isRelative(m[3]) {
+				return link
+			}
+			return m[1] + "[" + m[2] + "](" + rewrite(m[3], m[1] == "!") + m[4] + ")"
+		})
+		if m := refLinkPattern.FindStringSubmatch(line); m != nil && isRelative(m[2]) {
+			line = m[1] + rewrite(m[2], false) + m[3]
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// isRelative reports whether a link target is a path relative to the document
+func isRelative(target string) bool {
+	if target == "" || strings.HasPrefix(target, "#") || strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") {
+		return false
+	}
+	if i := strings.IndexAny(target, ":/?#"); i > 0 && target[i] == ':' {
+		return false // Has a scheme, like https: or mailto:
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+const readme = "# Project\n\nIntro.\n\n## Installation\n\nRun the installer:\n\n```sh\n# not a heading\n./install.sh\n```\n\n### From source\n\nSee [building](docs/BUILD.md) and ![logo](img/logo.png \"Logo\").\n\n[ref]: ../LICENSE\n\n## Usage\n\nVisit [the site](https://example.com) or [below](#usage).\n"
+
+func TestSlug(t *testing.T) {
+	tests := map[string]string{
+		"Installation":         "installation",
+		"From source":          "from-source",
+		"What's new in v2.0?":  "whats-new-in-v20",
+		"  Spaced   Heading  ": "spaced---heading",
+	}
+	for in, want := range tests {
+		if got := Slug(in); got != want {
+			t.Errorf("Slug(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSection(t *testing.T) {
+	for _, selector := range []string{"Installation", "installation", "#installation"} {
+		section, err := Section(readme, selector)
+		if err != nil {
+			t.Fatalf("Section(%q) failed: %v", selector, err)
+		}
+		if !strings.HasPrefix(section, "## Installation\n") || !strings.Contains(section, "### From source") || strings.Contains(section, "## Usage") {
+			t.Errorf("Unexpected section for %q:\n%s", selector, section)
+		}
+		if !strings.HasSuffix(section, "[ref]: ../LICENSE\n") {
+			t.Errorf("Expected trailing blank lines to be trimmed:\n%q", section)
+		}
+	}
+
+	if _, err := Section(readme, "not a heading"); err == nil {
+		t.Error("Expected headings in code blocks to be ignored")
+	}
+}
+
+func TestReplaceSection(t *testing.T) {
+	local := "# Docs\n\n## Installation\n\nOld steps.\n\n## Support\n\nAsk us.\n"
+
+	got := ReplaceSection(local, "installation", "## Installation\n\nNew steps.\n")
+	want := "# Docs\n\n## Installation\n\nNew steps.\n\n## Support\n\nAsk us.\n"
+	if got != want {
+		t.Errorf("Unexpected replacement:\n%q\nwant:\n%q", got, want)
+	}
+
+	got = ReplaceSection(local, "Support", "## Support\n\nFile an issue.")
+	if !strings.HasSuffix(got, "## Support\n\nFile an issue.\n") {
+		t.Errorf("Unexpected replacement of the last section:\n%q", got)
+	}
+
+	got = ReplaceSection("# Docs\n", "Installation", "## Installation\n\nSteps.\n")
+	if got != "# Docs\n\n## Installation\n\nSteps.\n" {
+		t.Errorf("Expected missing section to be appended:\n%q", got)
+	}
+}
+
+func TestRewriteLinks(t *testing.T) {
+	got := RewriteLinks(readme, func(target string, image bool) string {
+		if image {
+			return "IMG:" + target
+		}
+		return "LINK:" + target
+	})
+
+	for _, want := range []string{
+		"[building](LINK:docs/BUILD.md)",
+		`![logo](IMG:img/logo.png "Logo")`,
+		"[ref]: LINK:../LICENSE",
+		"[the site](https://example.com)",
+		"[below](#usage)",
+		"./install.sh",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Expected %q in:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+// Package merge provides structure-aware three-way merge drivers
+package merge
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrConflict is returned when both sides changed the same thing
+var ErrConflict = errors.New("merge conflict")
+
+// Driver merges local and upstream changes made to a common base
+type Driver interface {
+	Merge(base, local, remote []byte) ([]byte, error)
+}
+
+// DriverFunc adapts a function to the Driver interface
+type DriverFunc func(base, local, remote []byte) ([]byte, error)
+
+// Merge calls f
+func (f DriverFunc) Merge(base, local, remote []byte) ([]byte, error) {
+	return f(base, local, remote)
+}
+
+var (
+	driversMu sync.RWMutex
+	drivers   = map[string]Driver{
+		"json-merge": DriverFunc(mergeJSON),
+		"yaml-merge": DriverFunc(mergeYAML),
+		"union":      DriverFunc(mergeUnion),
+		"ours":       DriverFunc(func(base, local, remote []byte) ([]byte, error) { return local, nil }),
+		"theirs":     DriverFunc(func(base, local, remote []byte) ([]byte, error) { return remote, nil }),
+	}
+)
+
+// Register makes a driver available under a name, replacing any existing
+// driver with that name
+func Register(name string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	drivers[name] = driver
+}
+
+// Get returns the named driver
+func Get(name string) (Driver, error) {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	driver, ok := drivers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown merge driver: %s", name)
+	}
+	return driver, nil
+}
+
+// Names lists the registered drivers
+func Names() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	var names []string
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mergeJSON merges JSON documents key by key
+func mergeJSON(base, local, remote []byte) ([]byte, error) {
+	var b, l, r interface{}
+	if err := json.Unmarshal(base, &b); err != nil {
+		return nil, fmt.Errorf("error parsing base JSON: %w", err)
+	}
+	if err := json.Unmarshal(local, &l); err != nil {
+		return nil, fmt.Errorf("error parsing local JSON: %w", err)
+	}
+	if err := json.Unmarshal(remote, &r); err != nil {
+		return nil, fmt.Errorf("error parsing upstream JSON: %w", err)
+	}
+
+	merged, err := mergeValues("", b, l, r)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := json.MarshalIndent(merged, "", detectIndent(local))
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// mergeYAML merges YAML documents key by key. Comments are not preserved.
+func mergeYAML(base, local, remote []byte) ([]byte, error) {
+	var b, l, r interface{}
+	if err := yaml.Unmarshal(base, &b); err != nil {
+		return nil, fmt.Errorf("error parsing base YAML: %w", err)
+	}
+	if err := yaml.Unmarshal(local, &l); err != nil {
+		return nil, fmt.Errorf("error parsing local YAML: %w", err)
+	}
+	if err := yaml.Unmarshal(remote, &r); err != nil {
+		return nil, fmt.Errorf("error parsing upstream YAML: %w", err)
+	}
+
+	merged, err := mergeValues("", b, l, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(merged)
+}
+
+// mergeValues merges decoded documents. A value changed on one side only
+// takes that side; objects changed on both sides are merged per key.
+func mergeValues(path string, base, local, remote interface{}) (interface{}, error) {
+	switch {
+	case reflect.DeepEqual(local, remote):
+		return local, nil
+	case reflect.DeepEqual(base, local):
+		return remote, nil
+	case reflect.DeepEqual(base, remote):
+		return local, nil
+	}
+
+	l, lok := local.(map[string]interface{})
+	r, rok := remote.(map[string]interface{})
+	if !lok || !rok {
+		if path == "" {
+			path = "document root"
+		}
+		return nil, fmt.Errorf("%w at %s", ErrConflict, path)
+	}
+	b, _ := base.(map[string]interface{})
+
+	keys := make(map[string]bool)
+	for k := range l {
+		keys[k] = true
+	}
+	for k := range r {
+		keys[k] = true
+	}
+
+	merged := make(map[string]interface{})
+	for k := range keys {
+		bv, inBase := b[k]
+		lv, inLocal := l[k]
+		rv, inRemote := r[k]
+
+		switch {
+		case !inLocal && !inRemote:
+			continue
+		case !inLocal && inBase && reflect.DeepEqual(bv, rv):
+			continue // Deleted locally
+		case !inRemote && inBase && reflect.DeepEqual(bv, lv):
+			continue // Deleted upstream
+		case !inLocal && !inBase:
+			merged[k] = rv
+			continue
+		case !inRemote && !inBase:
+			merged[k] = lv
+			continue
+		case !inLocal || !inRemote:
+			return nil, fmt.Errorf("%w at %s: deleted on one side and changed on the other", ErrConflict, joinPath(path, k))
+		}
+
+		v, err := mergeValues(joinPath(path, k), bv, lv, rv)
+		if err != nil {
+			return nil, err
+		}
+		merged[k] = v
+	}
+
+	return merged, nil
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// detectIndent returns the indentation used by a JSON document, defaulting
+// to two spaces
+func detectIndent(data []byte) string {
+	for _, line := range bytes.Split(data, []byte("\n"))[1:] {
+		trimmed := bytes.TrimLeft(line, " \t")
+		if len(trimmed) < len(line) {
+			return string(line[:len(line)-len(trimmed)])
+		}
+	}
+	return "  "
+}
+
+// mergeUnion merges line lists, such as dependency or ignore lists: lines
+// added on either side are kept and lines removed on either side are dropped
+func mergeUnion(base, local, remote []byte) ([]byte, error) {
+	baseLines := lineSet(base)
+	remoteLines := lineSet(remote)
+
+	var out []string
+	seen := make(map[string]bool)
+	for _, line := range splitLines(local) {
+		// Removed upstream
+		if baseLines[line] && !remoteLines[line] {
+			continue
+		}
+		out = append(out, line)
+		seen[line] = true
+	}
+
+	localLines := lineSet(local)
+	for _, line := range splitLines(remote) {
+		// Removed locally, or already kept
+		if (baseLines[line] && !localLines[line]) || seen[line] {
+			continue
+		}
+		out = append(out, line)
+		seen[line] = true
+	}
+
+	if len(out) == 0 {
+		return nil, nil
+	}
+	return []byte(strings.Join(out, "\n") + "\n"), nil
+}
+
+func splitLines(data []byte) []string {
+	text := strings.TrimSuffix(string(data), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+func lineSet(data []byte) map[string]bool {
+	set := make(map[string]bool)
+	for _, line := range splitLines(data) {
+		set[line] = true
+	}
+	return set
+}
@@ -0,0 +1,130 @@
+package merge
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMergeJSON(t *testing.T) {
+	driver, err := Get("json-merge")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+
+	base := `{"name": "app", "deps": {"a": "1.0", "b": "1.0"}, "debug": false}`
+	local := `{
+    "name": "app",
+    "deps": {"a": "1.0", "b": "1.0", "local": "2.0"},
+    "debug": true
+}`
+	remote := `{"name": "app", "deps": {"a": "1.1"}, "debug": false}`
+
+	merged, err := driver.Merge([]byte(base), []byte(local), []byte(remote))
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	want := `{
+    "debug": true,
+    "deps": {
+        "a": "1.1",
+        "local": "2.0"
+    },
+    "name": "app"
+}
+`
+	if string(merged) != want {
+		t.Errorf("Unexpected merge result:\n%s", merged)
+	}
+}
+
+func TestMergeJSONConflict(t *testing.T) {
+	driver, _ := Get("json-merge")
+
+	tests := []struct {
+		name   string
+		local  string
+		remote string
+		want   string
+	}{
+		{"same key", `{"a": {"b": 2}}`, `{"a": {"b": 3}}`, "a.b"},
+		{"deleted and changed", `{"a": {}}`, `{"a": {"b": 3}}`, "a.b"},
+		{"type change", `{"a": [1]}`, `{"a": {"b": 2}}`, "at a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := driver.Merge([]byte(`{"a": {"b": 1}}`), []byte(tt.local), []byte(tt.remote))
+			if !errors.Is(err, ErrConflict) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected conflict at %s, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestMergeYAML(t *testing.T) {
+	driver, _ := Get("yaml-merge")
+
+	base := "replicas: 1\nimage: app:1.0\n"
+	local := "replicas: 3\nimage: app:1.0\n"
+	remote := "replicas: 1\nimage: app:1.1\nport: 8080\n"
+
+	merged, err := driver.Merge([]byte(base), []byte(local), []byte(remote))
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	want := "image: app:1.1\nport: 8080\nreplicas: 3\n"
+	if string(merged) != want {
+		t.Errorf("Unexpected merge result:\n%s", merged)
+	}
+}
+
+func TestMergeUnion(t *testing.T) {
+	driver, _ := Get("union")
+
+	base := "a\nb\nc\n"
+	local := "a\nc\nlocal\n"
+	remote := "a\nb\nremote\n"
+
+	merged, err := driver.Merge([]byte(base), []byte(local), []byte(remote))
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+
+	// b was removed locally and c upstream
+	if want := "a\nlocal\nremote\n"; string(merged) != want {
+		t.Errorf("Expected %q, got %q", want, merged)
+	}
+}
+
+func TestOursTheirs(t *testing.T) {
+	ours, _ := Get("ours")
+	theirs, _ := Get("theirs")
+
+	if got, _ := ours.Merge([]byte("base"), []byte("local"), []byte("remote")); string(got) != "local" {
+		t.Errorf("Expected ours to keep local, got %s", got)
+	}
+	if got, _ := theirs.Merge([]byte("base"), []byte("local"), []byte("remote")); string(got) != "remote" {
+		t.Errorf("Expected theirs to take remote, got %s", got)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	if _, err := Get("custom"); err == nil {
+		t.Fatal("Expected unknown driver error")
+	}
+
+	Register("custom", DriverFunc(func(base, local, remote []byte) ([]byte, error) {
+		return append(local, remote...), nil
+	}))
+
+	driver, err := Get("custom")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if got, _ := driver.Merge(nil, []byte("a"), []byte("b")); string(got) != "ab" {
+		t.Errorf("Unexpected custom merge result: %s", got)
+	}
+}
@@ -0,0 +1,149 @@
+// Package migrations plans the sync of a directory of database migrations.
+// Migrations that exist locally are assumed to be applied, so they are never
+// changed; only new migrations that sort after them are added.
+package migrations
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// versionPattern matches the version prefix of a migration file name, as in
+// 0001_init.sql, 20240101120000_add_users.up.sql or V3__seed.sql
+var versionPattern = regexp.MustCompile(`^[Vv]?(\d+)[_.-]+(.*)$`)
+
+// Migration is a migration file
+type Migration struct {
+	Name        string // File name
+	Version     string // Numeric version without leading zeros
+	Description string // The rest of the name, e.g. add_users.sql
+	Content     string
+}
+
+// Parse splits a file name into a migration. It returns false for files
+// without a version prefix, which aren't migrations.
+func Parse(name, content string) (Migration, bool) {
+	m := versionPattern.FindStringSubmatch(name)
+	if m == nil {
+		return Migration{}, false
+	}
+
+	version := strings.TrimLeft(m[1], "0")
+	if version == "" {
+		version = "0"
+	}
+	return Migration{Name: name, Version: version, Description: m[2], Content: content}, true
+}
+
+// Less orders migrations by version, then by name
+func Less(a, b Migration) bool {
+	if len(a.Version) != len(b.Version) {
+		return len(a.Version) < len(b.Version)
+	}
+	if a.Version != b.Version {
+		return a.Version < b.Version
+	}
+	return a.Name < b.Name
+}
+
+// Rename is a migration that upstream gave a different name
+type Rename struct {
+	From string // Local name
+	To   string // Upstream name
+}
+
+// Plan is the outcome of comparing local and upstream migrations
+type Plan struct {
+	Add        []Migration // New upstream migrations to write, in order
+	Modified   []string    // Local migrations whose upstream content changed
+	Renumbered []Rename    // Local migrations that upstream renamed or renumbered
+	OutOfOrder []string    // New upstream migrations that sort before existing ones
+}
+
+// Safe reports whether the new migrations can be added. Renumbered or
+// out-of-order migrations would be applied twice or out of sequence.
+func (p *Plan) Safe() bool {
+	return len(p.Renumbered) == 0 && len(p.OutOfOrder) == 0
+}
+
+// Problems describes what the plan refuses to do
+func (p *Plan) Problems() []string {
+	var problems []string
+	for _, name := range p.Modified {
+		problems = append(problems, fmt.Sprintf("refusing to modify applied migration %s, which changed upstream", name))
+	}
+	for _, r := range p.Renumbered {
+		problems = append(problems, fmt.Sprintf("migration %s was renumbered to %s upstream", r.From, r.To))
+	}
+	for _, name := range p.OutOfOrder {
+		problems = append(problems, fmt.Sprintf("new migration %s sorts before existing migrations", name))
+	}
+	return problems
+}
+
+// Compare plans the sync of upstream migrations into the local ones. Both
+// map file names to content; files without a version prefix are ignored.
+func Compare(local, upstream map[string]string) *Plan {
+	localMigrations := parseAll(local)
+	upstreamMigrations := parseAll(upstream)
+
+	var latest *Migration
+	if n := len(localMigrations); n > 0 {
+		latest = &localMigrations[n-1]
+	}
+
+	// Index local migrations by content and description to spot renames
+	byContent := make(map[string]string)
+	byDescription := make(map[string]string)
+	for _, m := range localMigrations {
+		if _, ok := upstream[m.Name]; ok {
+			continue
+		}
+		byContent[m.Content] = m.Name
+		byDescription[m.Description] = m.Name
+	}
+
+	plan := &Plan{}
+	for _, m := range upstreamMigrations {
+		if content, ok := local[m.Name]; ok {
+			if content != m.Content {
+				plan.Modified = append(plan.Modified, m.Name)
+			}
+			continue
+		}
+
+		if from, ok := byContent[m.Content]; ok {
+			plan.Renumbered = append(plan.Renumbered, Rename{From: from, To: m.Name})
+			continue
+		}
+		if from, ok := byDescription[m.Description]; ok {
+			plan.Renumbered = append(plan.Renumbered, Rename{From: from, To: m.Name})
+			continue
+		}
+
+		if latest != nil && !Less(*latest, m) {
+			plan.OutOfOrder = append(plan.OutOfOrder, m.Name)
+			continue
+		}
+
+		plan.Add = append(plan.Add, m)
+	}
+
+	return plan
+}
+
+// parseAll returns the migrations among files, sorted
+func parseAll(files map[string]string) []Migration {
+	var migrations []Migration
+	for name, content := range files {
+		if m, ok := Parse(name, content); ok {
+			migrations = append(migrations, m)
+		}
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return Less(migrations[i], migrations[j])
+	})
+	return migrations
+}
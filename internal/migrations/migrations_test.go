@@ -0,0 +1,99 @@
+package migrations
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     string
+		description string
+	}{
+		{"0001_init.sql", "1", "init.sql"},
+		{"20240101120000_add_users.up.sql", "20240101120000", "add_users.up.sql"},
+		{"V3__seed.sql", "3", "seed.sql"},
+		{"000_base.sql", "0", "base.sql"},
+	}
+
+	for _, tt := range tests {
+		m, ok := Parse(tt.name, "")
+		if !ok || m.Version != tt.version || m.Description != tt.description {
+			t.Errorf("Parse(%s) = %+v, %v", tt.name, m, ok)
+		}
+	}
+
+	for _, name := range []string{"README.md", "init.sql", "V_1.sql"} {
+		if _, ok := Parse(name, ""); ok {
+			t.Errorf("Expected %s not to be a migration", name)
+		}
+	}
+}
+
+func TestLess(t *testing.T) {
+	a, _ := Parse("9_a.sql", "")
+	b, _ := Parse("10_b.sql", "")
+	if !Less(a, b) || Less(b, a) {
+		t.Error("Expected versions to compare numerically")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	local := map[string]string{
+		"0001_init.sql":  "CREATE TABLE a;",
+		"0002_users.sql": "CREATE TABLE users;",
+		"README.md":      "local notes",
+	}
+
+	t.Run("append", func(t *testing.T) {
+		plan := Compare(local, map[string]string{
+			"0001_init.sql":   "CREATE TABLE a;",
+			"0002_users.sql":  "CREATE TABLE users;",
+			"0004_orders.sql": "CREATE TABLE orders;",
+			"0003_index.sql":  "CREATE INDEX;",
+			"README.md":       "upstream notes",
+		})
+		if !plan.Safe() || len(plan.Problems()) != 0 {
+			t.Fatalf("Expected a clean plan, got %v", plan.Problems())
+		}
+		if len(plan.Add) != 2 || plan.Add[0].Name != "0003_index.sql" || plan.Add[1].Name != "0004_orders.sql" {
+			t.Errorf("Expected new migrations in order, got %+v", plan.Add)
+		}
+	})
+
+	t.Run("modified", func(t *testing.T) {
+		plan := Compare(local, map[string]string{
+			"0001_init.sql":  "CREATE TABLE a (id int);",
+			"0002_users.sql": "CREATE TABLE users;",
+			"0003_index.sql": "CREATE INDEX;",
+		})
+		if !plan.Safe() || len(plan.Modified) != 1 || len(plan.Add) != 1 {
+			t.Errorf("Expected the edit to be refused and the new migration added: %+v", plan)
+		}
+		if problems := plan.Problems(); len(problems) != 1 || !strings.Contains(problems[0], "0001_init.sql") {
+			t.Errorf("Unexpected problems: %v", problems)
+		}
+	})
+
+	t.Run("renumbered", func(t *testing.T) {
+		plan := Compare(local, map[string]string{
+			"0001_init.sql":  "CREATE TABLE a;",
+			"0002_seed.sql":  "INSERT;",
+			"0003_users.sql": "CREATE TABLE users;",
+		})
+		if plan.Safe() || len(plan.Renumbered) != 1 || plan.Renumbered[0] != (Rename{From: "0002_users.sql", To: "0003_users.sql"}) {
+			t.Errorf("Expected renumbering to be flagged: %+v", plan)
+		}
+		if len(plan.OutOfOrder) != 1 || plan.OutOfOrder[0] != "0002_seed.sql" {
+			t.Errorf("Expected the inserted migration to be out of order: %+v", plan)
+		}
+	})
+
+	t.Run("empty local", func(t *testing.T) {
+		plan := Compare(map[string]string{}, map[string]string{"0001_init.sql": "CREATE TABLE a;"})
+		if !plan.Safe() || len(plan.Add) != 1 {
+			t.Errorf("Expected everything to be added: %+v", plan)
+		}
+	})
+}
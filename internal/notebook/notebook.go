@@ -0,0 +1,115 @@
+// Package notebook normalizes Jupyter notebooks so that syncs and diffs see
+// cell sources rather than execution outputs and editor metadata
+package notebook
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// keptMetadata lists the notebook-level metadata that survives stripping.
+// Everything else (language versions, widget state, editor settings) changes
+// whenever someone opens the notebook.
+var keptMetadata = []string{"kernelspec"}
+
+// keptCellMetadata lists the cell metadata that survives stripping. Tags
+// drive tools like papermill, so they are content.
+var keptCellMetadata = []string{"tags"}
+
+// Strip removes outputs, execution counts and volatile metadata from a
+// notebook and encodes it the way Jupyter does, with sorted keys and
+// one-space indentation
+func Strip(data []byte) ([]byte, error) {
+	var nb map[string]interface{}
+	if err := json.Unmarshal(data, &nb); err != nil {
+		return nil, fmt.Errorf("error parsing notebook: %w", err)
+	}
+
+	cells, ok := nb["cells"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("not a notebook: no cells")
+	}
+
+	for _, c := range cells {
+		cell, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if cell["cell_type"] == "code" {
+			cell["outputs"] = []interface{}{}
+			cell["execution_count"] = nil
+		}
+		if _, ok := cell["metadata"]; ok {
+			cell["metadata"] = keep(cell["metadata"], keptCellMetadata)
+		}
+	}
+	if _, ok := nb["metadata"]; ok {
+		nb["metadata"] = keep(nb["metadata"], keptMetadata)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", " ")
+	if err := enc.Encode(nb); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// keep returns a copy of a metadata object with only the given keys
+func keep(metadata interface{}, keys []string) map[string]interface{} {
+	out := make(map[string]interface{})
+	m, _ := metadata.(map[string]interface{})
+	for _, k := range keys {
+		if v, ok := m[k]; ok {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// Render turns a notebook into plain text, one section per cell, so that a
+// line diff of two renderings reads as a cell-level diff
+func Render(data []byte) (string, error) {
+	var nb struct {
+		Cells []struct {
+			CellType string      `json:"cell_type"`
+			Source   interface{} `json:"source"`
+		} `json:"cells"`
+	}
+	if err := json.Unmarshal(data, &nb); err != nil {
+		return "", fmt.Errorf("error parsing notebook: %w", err)
+	}
+
+	var sb strings.Builder
+	for _, cell := range nb.Cells {
+		fmt.Fprintf(&sb, "# ---- %s cell ----\n", cell.CellType)
+
+		source := sourceText(cell.Source)
+		sb.WriteString(source)
+		if source != "" && !strings.HasSuffix(source, "\n") {
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String(), nil
+}
+
+// sourceText joins a cell source, which may be a string or a list of lines
+func sourceText(source interface{}) string {
+	switch s := source.(type) {
+	case string:
+		return s
+	case []interface{}:
+		var sb strings.Builder
+		for _, line := range s {
+			if str, ok := line.(string); ok {
+				sb.WriteString(str)
+			}
+		}
+		return sb.String()
+	}
+	return ""
+}
@@ -0,0 +1,78 @@
+package notebook
+
+import (
+	"strings"
+	"testing"
+)
+
+const executed = `{
+ "cells": [
+  {
+   "cell_type": "markdown",
+   "metadata": {"collapsed": true},
+   "source": ["# Analysis\n", "Load <data> & plot"]
+  },
+  {
+   "cell_type": "code",
+   "execution_count": 7,
+   "metadata": {"scrolled": true, "tags": ["parameters"]},
+   "outputs": [{"output_type": "stream", "name": "stdout", "text": ["answer\n"]}],
+   "source": "x = 42\nprint(x)"
+  }
+ ],
+ "metadata": {
+  "kernelspec": {"display_name": "Python 3", "language": "python", "name": "python3"},
+  "language_info": {"name": "python", "version": "3.11.4"}
+ },
+ "nbformat": 4,
+ "nbformat_minor": 5
+}`
+
+func TestStrip(t *testing.T) {
+	stripped, err := Strip([]byte(executed))
+	if err != nil {
+		t.Fatalf("Strip failed: %v", err)
+	}
+
+	out := string(stripped)
+	for _, gone := range []string{"answer", `"execution_count": 7`, "scrolled", "collapsed", "language_info"} {
+		if strings.Contains(out, gone) {
+			t.Errorf("Expected %s to be stripped:\n%s", gone, out)
+		}
+	}
+	for _, kept := range []string{`"execution_count": null`, `"parameters"`, "kernelspec", "Load <data> & plot"} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("Expected %s to be kept:\n%s", kept, out)
+		}
+	}
+
+	// Rerunning the notebook doesn't change the stripped form
+	rerun := strings.Replace(executed, `"execution_count": 7`, `"execution_count": 12`, 1)
+	rerun = strings.Replace(rerun, `"3.11.4"`, `"3.12.0"`, 1)
+	again, _ := Strip([]byte(rerun))
+	if string(again) != out {
+		t.Error("Expected execution counts and versions to be ignored")
+	}
+
+	// Stripping is idempotent
+	twice, _ := Strip(stripped)
+	if string(twice) != out {
+		t.Errorf("Expected stripping twice to be a no-op:\n%s", twice)
+	}
+
+	if _, err := Strip([]byte(`{"not": "a notebook"}`)); err == nil {
+		t.Error("Expected an error for a non-notebook")
+	}
+}
+
+func TestRender(t *testing.T) {
+	rendered, err := Render([]byte(executed))
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+
+	want := "# ---- markdown cell ----\n# Analysis\nLoad <data> & plot\n# ---- code cell ----\nx = 42\nprint(x)\n"
+	if rendered != want {
+		t.Errorf("Unexpected rendering:\n%s", rendered)
+	}
+}
@@ -0,0 +1,138 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	defaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+	defaultOpsgenieURL  = "https://api.opsgenie.com/v2/alerts"
+)
+
+// dedupKey identifies the alert for a sync item so that repeated failures
+// update one incident and a later success can resolve it
+func dedupKey(item string) string {
+	return "codesync-" + item
+}
+
+// PagerDutyNotifier raises PagerDuty incidents through the Events API v2.
+// Conflicts and errors trigger an incident per item, recoveries resolve it,
+// and routine events are ignored.
+type PagerDutyNotifier struct {
+	RoutingKey string
+	URL        string
+	Client     *http.Client
+}
+
+// NewPagerDutyNotifier creates a PagerDuty notifier; an empty endpoint uses
+// the public Events API
+func NewPagerDutyNotifier(routingKey, endpoint string) *PagerDutyNotifier {
+	if endpoint == "" {
+		endpoint = defaultPagerDutyURL
+	}
+
+	return &PagerDutyNotifier{RoutingKey: routingKey, URL: endpoint, Client: &http.Client{Timeout: requestTimeout}}
+}
+
+// Notify triggers or resolves incidents for the events
+func (p *PagerDutyNotifier) Notify(events []Event) error {
+	var errs []error
+
+	for _, e := range events {
+		payload := map[string]interface{}{
+			"routing_key": p.RoutingKey,
+			"dedup_key":   dedupKey(e.Item),
+		}
+
+		switch {
+		case e.Type == EventRecovered:
+			payload["event_action"] = "resolve"
+		case e.Urgent():
+			payload["event_action"] = "trigger"
+			payload["payload"] = map[string]interface{}{
+				"summary":  fmt.Sprintf("codesync %s for %s: %s", e.Type, e.Item, e.Message),
+				"source":   "codesync",
+				"severity": e.Severity.String(),
+				"custom_details": map[string]interface{}{
+					"item":     e.Item,
+					"id":       e.ItemID,
+					"type":     e.Type,
+					"tags":     e.Tags,
+					"owners":   e.Owners,
+					"owner":    e.Owner,
+					"contacts": e.Contacts,
+					"files":    e.Files,
+				},
+			}
+		default:
+			continue
+		}
+
+		if err := postJSON(p.Client, p.URL, payload); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.Item, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// OpsgenieNotifier creates Opsgenie alerts aliased per item. Conflicts and
+// errors open an alert, recoveries close it, and routine events are ignored.
+type OpsgenieNotifier struct {
+	APIKey string
+	URL    string
+	Client *http.Client
+}
+
+// NewOpsgenieNotifier creates an Opsgenie notifier; an empty endpoint uses the
+// public alerts API (set it to the EU endpoint if needed)
+func NewOpsgenieNotifier(apiKey, endpoint string) *OpsgenieNotifier {
+	if endpoint == "" {
+		endpoint = defaultOpsgenieURL
+	}
+
+	return &OpsgenieNotifier{APIKey: apiKey, URL: strings.TrimRight(endpoint, "/"), Client: &http.Client{Timeout: requestTimeout}}
+}
+
+// Notify opens or closes alerts for the events
+func (o *OpsgenieNotifier) Notify(events []Event) error {
+	var errs []error
+	auth := []string{"Authorization", "GenieKey " + o.APIKey}
+
+	for _, e := range events {
+		var err error
+		alias := dedupKey(e.Item)
+
+		switch {
+		case e.Type == EventRecovered:
+			closeURL := fmt.Sprintf("%s/%s/close?identifierType=alias", o.URL, url.PathEscape(alias))
+			err = postJSON(o.Client, closeURL, map[string]string{"source": "codesync", "note": e.Message}, auth...)
+		case e.Urgent():
+			priority := "P3"
+			if e.Severity >= SeverityError {
+				priority = "P2"
+			}
+			err = postJSON(o.Client, o.URL, map[string]interface{}{
+				"message":     fmt.Sprintf("codesync %s for %s", e.Type, e.Item),
+				"alias":       alias,
+				"description": e.Message,
+				"tags":        e.Tags,
+				"details":     map[string]string{"owner": e.Owner, "contacts": strings.Join(e.Contacts, ", ")},
+				"priority":    priority,
+				"source":      "codesync",
+			}, auth...)
+		default:
+			continue
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", e.Item, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,89 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// capturedRequest is a request received by the alerting test server
+type capturedRequest struct {
+	Path string
+	Auth string
+	Body map[string]interface{}
+}
+
+func newCaptureServer(t *testing.T) (*httptest.Server, *[]capturedRequest) {
+	var requests []capturedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := capturedRequest{Path: r.URL.RequestURI(), Auth: r.Header.Get("Authorization")}
+		if err := json.Unmarshal(body, &req.Body); err != nil {
+			t.Errorf("Invalid JSON body: %v", err)
+		}
+		requests = append(requests, req)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	return server, &requests
+}
+
+func TestPagerDutyNotifier(t *testing.T) {
+	server, requests := newCaptureServer(t)
+	defer server.Close()
+
+	pd := NewPagerDutyNotifier("routing-key", server.URL)
+	err := pd.Notify([]Event{
+		NewEvent("policies", EventError, "failed to fetch"),
+		NewEvent("logger", EventUpdated, "updated"),
+		NewEvent("policies", EventRecovered, ""),
+	})
+	if err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	if len(*requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(*requests))
+	}
+
+	trigger, resolve := (*requests)[0].Body, (*requests)[1].Body
+	if trigger["event_action"] != "trigger" || trigger["dedup_key"] != "codesync-policies" || trigger["routing_key"] != "routing-key" {
+		t.Errorf("Unexpected trigger payload: %v", trigger)
+	}
+	if details, ok := trigger["payload"].(map[string]interface{}); !ok || details["severity"] != "error" {
+		t.Errorf("Unexpected trigger details: %v", trigger["payload"])
+	}
+	if resolve["event_action"] != "resolve" || resolve["dedup_key"] != "codesync-policies" {
+		t.Errorf("Unexpected resolve payload: %v", resolve)
+	}
+}
+
+func TestOpsgenieNotifier(t *testing.T) {
+	server, requests := newCaptureServer(t)
+	defer server.Close()
+
+	og := NewOpsgenieNotifier("api-key", server.URL+"/v2/alerts")
+	err := og.Notify([]Event{
+		NewEvent("policies", EventConflict, "both changed"),
+		NewEvent("policies", EventRecovered, ""),
+	})
+	if err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	if len(*requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(*requests))
+	}
+
+	create, closeReq := (*requests)[0], (*requests)[1]
+	if create.Path != "/v2/alerts" || create.Auth != "GenieKey api-key" {
+		t.Errorf("Unexpected create request: %+v", create)
+	}
+	if create.Body["alias"] != "codesync-policies" || create.Body["priority"] != "P3" {
+		t.Errorf("Unexpected create payload: %v", create.Body)
+	}
+	if closeReq.Path != "/v2/alerts/codesync-policies/close?identifierType=alias" {
+		t.Errorf("Unexpected close path: %s", closeReq.Path)
+	}
+}
@@ -0,0 +1,174 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Storage persists a digest's state between runs. Load returns an error
+// matching fs.ErrNotExist when nothing has been saved yet.
+type Storage interface {
+	Load() ([]byte, error)
+	Save(data []byte) error
+}
+
+// FileStorage keeps the digest state in a plain file at the given path
+type FileStorage string
+
+func (f FileStorage) Load() ([]byte, error) {
+	return os.ReadFile(string(f))
+}
+
+func (f FileStorage) Save(data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(string(f)), 0755); err != nil {
+		return fmt.Errorf("error creating digest directory: %w", err)
+	}
+	return os.WriteFile(string(f), data, 0644)
+}
+
+// Digest batches routine events and sends them as one summary at scheduled
+// times of day. Conflicts, errors and recoveries bypass the digest and are
+// sent at once so that alerts open and resolve promptly.
+type Digest struct {
+	notifier Notifier
+	times    []time.Time // Only hour and minute are used
+	storage  Storage
+	now      func() time.Time
+
+	state digestState
+}
+
+// digestState is what the digest persists between runs
+type digestState struct {
+	Pending   []Event   `json:"pending"`
+	LastFlush time.Time `json:"lastFlush"`
+}
+
+// NewDigest wraps notifier with digest scheduling. Pending events are kept in
+// storage so that they survive between one-shot runs; a nil storage keeps
+// them in memory only. Scheduled times are checked against now, or time.Now
+// if it is nil.
+func NewDigest(notifier Notifier, times []string, storage Storage, now func() time.Time) (*Digest, error) {
+	if now == nil {
+		now = time.Now
+	}
+	d := &Digest{
+		notifier: notifier,
+		storage:  storage,
+		now:      now,
+	}
+
+	for _, t := range times {
+		parsed, err := time.Parse("15:04", t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid digest time '%s': %w", t, err)
+		}
+		d.times = append(d.times, parsed)
+	}
+
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Notify sends urgent events right away and queues the rest, then flushes the
+// queue if a scheduled digest time has passed
+func (d *Digest) Notify(events []Event) error {
+	var urgent []Event
+	for _, e := range events {
+		if e.Urgent() || e.Type == EventRecovered {
+			urgent = append(urgent, e)
+		} else {
+			d.state.Pending = append(d.state.Pending, e)
+		}
+	}
+
+	var sendErr error
+	if len(urgent) > 0 {
+		sendErr = d.notifier.Notify(urgent)
+	}
+
+	if err := d.FlushIfDue(); err != nil {
+		return err
+	}
+
+	if err := d.save(); err != nil {
+		return err
+	}
+
+	return sendErr
+}
+
+// FlushIfDue sends the queued events if a digest time has passed since the
+// last flush
+func (d *Digest) FlushIfDue() error {
+	now := d.now()
+	if !d.due(now) {
+		return nil
+	}
+
+	if len(d.state.Pending) > 0 {
+		if err := d.notifier.Notify(d.state.Pending); err != nil {
+			return fmt.Errorf("error sending digest: %w", err)
+		}
+	}
+
+	d.state.Pending = nil
+	d.state.LastFlush = now
+	return d.save()
+}
+
+// due reports whether a scheduled time falls between the last flush and now
+func (d *Digest) due(now time.Time) bool {
+	for _, day := range []time.Time{now, now.AddDate(0, 0, -1)} {
+		for _, t := range d.times {
+			scheduled := time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+			if !scheduled.After(now) && scheduled.After(d.state.LastFlush) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (d *Digest) load() error {
+	if d.storage == nil {
+		d.state.LastFlush = d.now()
+		return nil
+	}
+
+	data, err := d.storage.Load()
+	if errors.Is(err, fs.ErrNotExist) {
+		d.state.LastFlush = d.now()
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading digest state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &d.state); err != nil {
+		return fmt.Errorf("error parsing digest state: %w", err)
+	}
+
+	return nil
+}
+
+func (d *Digest) save() error {
+	if d.storage == nil {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(d.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding digest state: %w", err)
+	}
+
+	return d.storage.Save(data)
+}
@@ -0,0 +1,335 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+// requestTimeout bounds each request a notifier sends
+const requestTimeout = 10 * time.Second
+
+// EventType describes what happened to a sync item
+type EventType string
+
+const (
+	EventUpdated   EventType = "updated"   // Upstream changes were applied
+	EventConflict  EventType = "conflict"  // Local and upstream both changed
+	EventError     EventType = "error"     // The sync failed
+	EventRecovered EventType = "recovered" // The sync succeeded after failing
+)
+
+// Severity ranks how much attention an event needs
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+// String returns the configuration name of the severity
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return "info"
+	}
+}
+
+// MarshalText encodes the severity by name
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a severity name
+func (s *Severity) UnmarshalText(text []byte) error {
+	parsed, err := ParseSeverity(string(text))
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
+
+// ParseSeverity converts a severity name into a Severity
+func ParseSeverity(name string) (Severity, error) {
+	switch name {
+	case "info", "":
+		return SeverityInfo, nil
+	case "warning":
+		return SeverityWarning, nil
+	case "error":
+		return SeverityError, nil
+	default:
+		return SeverityInfo, fmt.Errorf("unknown severity: %s", name)
+	}
+}
+
+// SeverityFor returns the default severity for an event type
+func SeverityFor(t EventType) Severity {
+	switch t {
+	case EventConflict:
+		return SeverityWarning
+	case EventError:
+		return SeverityError
+	default:
+		return SeverityInfo
+	}
+}
+
+// Event is a single notification about a sync item
+type Event struct {
+	Item       string    `json:"item"`
+	ItemID     string    `json:"itemId,omitempty"` // Stable ID of the item, see config.SyncItem.ID
+	Type       EventType `json:"type"`
+	Severity   Severity  `json:"severity"`
+	Tags       []string  `json:"tags,omitempty"`
+	Owners     []string  `json:"owners,omitempty"`     // CODEOWNERS of the updated files
+	Owner      string    `json:"owner,omitempty"`      // Team responsible for the item
+	Contacts   []string  `json:"contacts,omitempty"`   // Who to ping about the item
+	ConflictID string    `json:"conflictId,omitempty"` // Conflict in the inbox, for conflict events
+	Message    string    `json:"message"`
+	Files      []File    `json:"files,omitempty"` // Files an update changed, as much as the notifier's content policy allows
+	Time       time.Time `json:"time"`
+}
+
+// File is a file an update changed
+type File struct {
+	Path    string `json:"path"`
+	Added   int    `json:"added,omitempty"`
+	Removed int    `json:"removed,omitempty"`
+	Diff    string `json:"diff,omitempty"`
+}
+
+// Content policies of notifiers: how much of the changed content they get
+const (
+	ContentFiles = "files" // Paths only
+	ContentStats = "stats" // Paths and line counts
+	ContentFull  = "full"  // Paths, line counts and diffs
+)
+
+// withContent strips the files of events down to what a content policy
+// allows before passing them on
+type withContent struct {
+	notifier Notifier
+	content  string
+}
+
+func (w withContent) Notify(events []Event) error {
+	if w.content == ContentFull {
+		return w.notifier.Notify(events)
+	}
+
+	stripped := make([]Event, len(events))
+	for i, e := range events {
+		if len(e.Files) > 0 {
+			files := make([]File, len(e.Files))
+			for j, f := range e.Files {
+				files[j] = File{Path: f.Path}
+				if w.content == ContentStats {
+					files[j].Added, files[j].Removed = f.Added, f.Removed
+				}
+			}
+			e.Files = files
+		}
+		stripped[i] = e
+	}
+	return w.notifier.Notify(stripped)
+}
+
+// NewEvent creates an event with the default severity for its type
+func NewEvent(item string, t EventType, message string) Event {
+	return Event{
+		Item:     item,
+		Type:     t,
+		Severity: SeverityFor(t),
+		Message:  message,
+		Time:     time.Now(),
+	}
+}
+
+// Urgent reports whether the event must be delivered right away
+func (e Event) Urgent() bool {
+	return e.Severity >= SeverityWarning
+}
+
+// Notifier delivers events to a destination
+type Notifier interface {
+	Notify(events []Event) error
+}
+
+// SlackNotifier posts events to a Slack incoming webhook
+type SlackNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify posts a single message summarizing the events
+func (s *SlackNotifier) Notify(events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	return postJSON(s.Client, s.URL, map[string]string{"text": FormatEvents(events)})
+}
+
+// WebhookNotifier posts events as JSON to an arbitrary endpoint
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify posts the events as a JSON object with an "events" array
+func (w *WebhookNotifier) Notify(events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	return postJSON(w.Client, w.URL, map[string][]Event{"events": events})
+}
+
+// Multi fans events out to several notifiers
+type Multi []Notifier
+
+// Notify sends events to every notifier, returning all failures
+func (m Multi) Notify(events []Event) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(events); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// New builds the notifier described by the configuration. If a digest is
+// configured, pending events are persisted in digestStorage between runs and
+// its schedule follows now. Notifiers of the plugin type use the notifier
+// plugins by name.
+func New(cfg *config.NotificationsConfig, digestStorage Storage, plugins map[string]Notifier, now func() time.Time) (Notifier, error) {
+	named := make(map[string]Notifier)
+	var all Multi
+
+	for _, nc := range cfg.Notifiers {
+		var n Notifier
+		switch nc.Type {
+		case "slack":
+			n = &SlackNotifier{URL: nc.URL, Client: &http.Client{Timeout: requestTimeout}}
+		case "webhook":
+			n = &WebhookNotifier{URL: nc.URL, Client: &http.Client{Timeout: requestTimeout}}
+		case "pagerduty":
+			n = NewPagerDutyNotifier(nc.Key, nc.URL)
+		case "opsgenie":
+			n = NewOpsgenieNotifier(nc.Key, nc.URL)
+		case "plugin":
+			if n = plugins[nc.Plugin]; n == nil {
+				return nil, fmt.Errorf("notifier plugin %s is not loaded", nc.Plugin)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported notifier type: %s", nc.Type)
+		}
+		// Without a policy, source code never leaves
+		content := nc.Content
+		if content == "" {
+			content = ContentFiles
+		}
+		n = withContent{notifier: n, content: content}
+		named[nc.Name] = n
+		all = append(all, n)
+	}
+
+	var notifier Notifier = all
+	if len(cfg.Routes) > 0 {
+		router, err := NewRouter(named, cfg.Routes)
+		if err != nil {
+			return nil, err
+		}
+		notifier = router
+	}
+
+	if cfg.Digest == nil {
+		return notifier, nil
+	}
+
+	return NewDigest(notifier, cfg.Digest.Times, digestStorage, now)
+}
+
+// FormatEvents renders events as human-readable text
+func FormatEvents(events []Event) string {
+	var sb strings.Builder
+
+	for _, e := range events {
+		sb.WriteString(fmt.Sprintf("[%s] %s", e.Type, e.Item))
+		if len(e.Tags) > 0 {
+			sb.WriteString(" (" + strings.Join(e.Tags, ", ") + ")")
+		}
+		if e.Message != "" {
+			sb.WriteString(": " + e.Message)
+		}
+		if len(e.Owners) > 0 {
+			sb.WriteString(" (owners: " + strings.Join(e.Owners, ", ") + ")")
+		}
+		if e.Owner != "" {
+			sb.WriteString(" (owned by " + e.Owner + ")")
+		}
+		// Only what needs a human pings anyone
+		if e.Urgent() && len(e.Contacts) > 0 {
+			sb.WriteString(" cc " + strings.Join(e.Contacts, " "))
+		}
+		sb.WriteString("\n")
+
+		// The message already names the files, so they're only listed with
+		// more to say about them
+		for _, f := range e.Files {
+			if f.Added == 0 && f.Removed == 0 && f.Diff == "" {
+				continue
+			}
+			sb.WriteString(fmt.Sprintf("  %s (+%d -%d)\n", f.Path, f.Added, f.Removed))
+			if f.Diff != "" {
+				sb.WriteString("```\n" + strings.TrimRight(f.Diff, "\n") + "\n```\n")
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+// postJSON sends payload as a JSON POST request with optional extra headers
+func postJSON(client *http.Client, url string, payload interface{}, headers ...string) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notification endpoint returned status code %d", resp.StatusCode)
+	}
+
+	return nil
+}
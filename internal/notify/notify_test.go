@@ -0,0 +1,273 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+// recorder is a Notifier that remembers every batch it was sent
+type recorder struct {
+	batches [][]Event
+}
+
+func (r *recorder) Notify(events []Event) error {
+	r.batches = append(r.batches, events)
+	return nil
+}
+
+func TestSlackAndWebhookNotifiers(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+
+	n, err := New(&config.NotificationsConfig{
+		Notifiers: []config.NotifierConfig{
+			{Name: "slack", Type: "slack", URL: server.URL},
+			{Name: "hook", Type: "webhook", URL: server.URL},
+		},
+	}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	events := []Event{{Item: "logger", Type: EventUpdated, Message: "updated internal/logger/logger.go", Owners: []string{"@acme/core"}}}
+	if err := n.Notify(events); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	if len(bodies) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(bodies))
+	}
+
+	var slack map[string]string
+	if err := json.Unmarshal([]byte(bodies[0]), &slack); err != nil {
+		t.Fatalf("Invalid slack payload: %v", err)
+	}
+	if !strings.Contains(slack["text"], "[updated] logger") || !strings.Contains(slack["text"], "owners: @acme/core") {
+		t.Errorf("Unexpected slack text: %q", slack["text"])
+	}
+
+	var hook struct {
+		Events []Event `json:"events"`
+	}
+	if err := json.Unmarshal([]byte(bodies[1]), &hook); err != nil {
+		t.Fatalf("Invalid webhook payload: %v", err)
+	}
+	if len(hook.Events) != 1 || hook.Events[0].Item != "logger" || len(hook.Events[0].Owners) != 1 {
+		t.Errorf("Unexpected webhook events: %+v", hook.Events)
+	}
+}
+
+func TestNotifierErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	n := &WebhookNotifier{URL: server.URL, Client: server.Client()}
+	if err := n.Notify([]Event{{Item: "x", Type: EventError}}); err == nil {
+		t.Error("Expected error for failed request")
+	}
+}
+
+func TestDigest(t *testing.T) {
+	rec := &recorder{}
+	path := filepath.Join(t.TempDir(), "digest.json")
+
+	now := time.Date(2025, 1, 10, 8, 0, 0, 0, time.Local)
+	newDigest := func() *Digest {
+		d, err := NewDigest(rec, []string{"09:00", "17:00"}, FileStorage(path), func() time.Time { return now })
+		if err != nil {
+			t.Fatalf("NewDigest failed: %v", err)
+		}
+		return d
+	}
+
+	d := newDigest()
+	d.state.LastFlush = now
+
+	// Routine events are queued, urgent ones pass straight through
+	err := d.Notify([]Event{
+		NewEvent("a", EventUpdated, ""),
+		NewEvent("b", EventConflict, ""),
+	})
+	if err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if len(rec.batches) != 1 || rec.batches[0][0].Item != "b" {
+		t.Fatalf("Expected only the conflict to be sent, got %+v", rec.batches)
+	}
+
+	// Pending events survive a restart
+	now = now.Add(30 * time.Minute)
+	d = newDigest()
+	if err := d.Notify([]Event{NewEvent("c", EventUpdated, "")}); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if len(rec.batches) != 1 {
+		t.Fatalf("Expected no digest before 09:00, got %d batches", len(rec.batches))
+	}
+
+	// Passing a scheduled time sends everything queued in one batch
+	now = now.Add(time.Hour)
+	d = newDigest()
+	if err := d.FlushIfDue(); err != nil {
+		t.Fatalf("FlushIfDue failed: %v", err)
+	}
+	if len(rec.batches) != 2 || len(rec.batches[1]) != 2 {
+		t.Fatalf("Expected a digest of 2 events, got %+v", rec.batches)
+	}
+
+	// Nothing more is sent until the next scheduled time
+	if err := d.FlushIfDue(); err != nil {
+		t.Fatalf("FlushIfDue failed: %v", err)
+	}
+	if len(rec.batches) != 2 {
+		t.Errorf("Expected no additional batches, got %d", len(rec.batches))
+	}
+}
+
+func TestNewDigestInvalidTime(t *testing.T) {
+	if _, err := NewDigest(&recorder{}, []string{"9am"}, nil, nil); err == nil {
+		t.Error("Expected error for invalid time")
+	}
+}
+
+func TestRouter(t *testing.T) {
+	payments, general, pager := &recorder{}, &recorder{}, &recorder{}
+
+	router, err := NewRouter(map[string]Notifier{
+		"payments": payments,
+		"general":  general,
+		"pager":    pager,
+	}, []config.RouteConfig{
+		{MinSeverity: "error", Notifiers: []string{"pager"}, Continue: true},
+		{Events: []string{"conflict"}, Tags: []string{"payments"}, Notifiers: []string{"payments"}},
+		{Notifiers: []string{"general"}},
+	})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+
+	conflict := NewEvent("billing", EventConflict, "")
+	conflict.Tags = []string{"payments"}
+	failure := NewEvent("billing", EventError, "")
+	failure.Tags = []string{"payments"}
+
+	events := []Event{
+		conflict,
+		failure,
+		NewEvent("logger", EventUpdated, ""),
+		NewEvent("logger", EventConflict, ""),
+	}
+	if err := router.Notify(events); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	count := func(r *recorder) int {
+		n := 0
+		for _, b := range r.batches {
+			n += len(b)
+		}
+		return n
+	}
+
+	if count(pager) != 1 || pager.batches[0][0].Type != EventError {
+		t.Errorf("Expected pager to get only the error, got %+v", pager.batches)
+	}
+	if count(payments) != 1 || payments.batches[0][0].Item != "billing" {
+		t.Errorf("Expected payments to get only the tagged conflict, got %+v", payments.batches)
+	}
+	// The error continues past the pager route and falls through to general
+	if count(general) != 3 {
+		t.Errorf("Expected general to get 3 events, got %+v", general.batches)
+	}
+}
+
+func TestNewRouterUnknownNotifier(t *testing.T) {
+	_, err := NewRouter(map[string]Notifier{}, []config.RouteConfig{{Notifiers: []string{"missing"}}})
+	if err == nil {
+		t.Error("Expected error for unknown notifier")
+	}
+}
+
+func TestFormatEventsContacts(t *testing.T) {
+	updated := NewEvent("billing", EventUpdated, "updated client.go")
+	conflict := NewEvent("billing", EventConflict, "both changed")
+	for _, e := range []*Event{&updated, &conflict} {
+		e.Owner = "payments"
+		e.Contacts = []string{"@ana", "#payments-oncall"}
+	}
+
+	text := FormatEvents([]Event{updated, conflict})
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected a line per event, got %q", text)
+	}
+	if !strings.Contains(lines[0], "(owned by payments)") || strings.Contains(lines[0], "@ana") {
+		t.Errorf("Expected an update to name the owner without pinging anyone, got %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], "(owned by payments) cc @ana #payments-oncall") {
+		t.Errorf("Expected a conflict to ping the contacts, got %q", lines[1])
+	}
+}
+
+func TestContentPolicies(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+
+	n, err := New(&config.NotificationsConfig{
+		Notifiers: []config.NotifierConfig{
+			{Name: "slack", Type: "slack", URL: server.URL},
+			{Name: "team", Type: "slack", URL: server.URL, Content: ContentStats},
+			{Name: "review", Type: "webhook", URL: server.URL, Content: ContentFull},
+		},
+	}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	event := NewEvent("logger", EventUpdated, "updated logger.go")
+	event.Files = []File{{Path: "logger.go", Added: 2, Removed: 1, Diff: "+func Secret() {}\n"}}
+	if err := n.Notify([]Event{event}); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+	if len(bodies) != 3 {
+		t.Fatalf("Expected 3 requests, got %d", len(bodies))
+	}
+
+	// Without a policy, only the files are named
+	if strings.Contains(bodies[0], "Secret") || strings.Contains(bodies[0], "+2 -1") {
+		t.Errorf("Expected no content by default, got %s", bodies[0])
+	}
+	if !strings.Contains(bodies[1], "logger.go (+2 -1)") || strings.Contains(bodies[1], "Secret") {
+		t.Errorf("Expected stats without the diff, got %s", bodies[1])
+	}
+	var hook struct {
+		Events []Event `json:"events"`
+	}
+	if err := json.Unmarshal([]byte(bodies[2]), &hook); err != nil {
+		t.Fatalf("Invalid webhook payload: %v", err)
+	}
+	if len(hook.Events) != 1 || len(hook.Events[0].Files) != 1 || hook.Events[0].Files[0].Diff != event.Files[0].Diff {
+		t.Errorf("Expected the full diff, got %+v", hook.Events)
+	}
+	if event.Files[0].Diff == "" {
+		t.Error("Expected the sent events to be left alone")
+	}
+}
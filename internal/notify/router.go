@@ -0,0 +1,131 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+// route is a compiled routing rule
+type route struct {
+	minSeverity Severity
+	events      map[EventType]bool
+	tags        map[string]bool
+	notifiers   []string
+	cont        bool
+}
+
+// matches reports whether an event satisfies every condition of the route
+func (r *route) matches(e Event) bool {
+	if e.Severity < r.minSeverity {
+		return false
+	}
+
+	if len(r.events) > 0 && !r.events[e.Type] {
+		return false
+	}
+
+	if len(r.tags) > 0 {
+		for _, tag := range e.Tags {
+			if r.tags[tag] {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// Router sends each event to the notifiers of the routes it matches. Routes
+// are evaluated in order and the first match wins unless it is marked to
+// continue. Events matching no route are dropped.
+type Router struct {
+	notifiers map[string]Notifier
+	routes    []route
+}
+
+// NewRouter compiles routing rules over a set of named notifiers
+func NewRouter(notifiers map[string]Notifier, routes []config.RouteConfig) (*Router, error) {
+	r := &Router{notifiers: notifiers}
+
+	for i, rc := range routes {
+		severity, err := ParseSeverity(rc.MinSeverity)
+		if err != nil {
+			return nil, fmt.Errorf("route %d: %w", i, err)
+		}
+
+		compiled := route{
+			minSeverity: severity,
+			events:      make(map[EventType]bool),
+			tags:        make(map[string]bool),
+			notifiers:   rc.Notifiers,
+			cont:        rc.Continue,
+		}
+		for _, e := range rc.Events {
+			compiled.events[EventType(e)] = true
+		}
+		for _, t := range rc.Tags {
+			compiled.tags[t] = true
+		}
+		for _, name := range rc.Notifiers {
+			if _, ok := notifiers[name]; !ok {
+				return nil, fmt.Errorf("route %d: unknown notifier %s", i, name)
+			}
+		}
+
+		r.routes = append(r.routes, compiled)
+	}
+
+	return r, nil
+}
+
+// Notify groups events by destination and sends one batch per notifier
+func (r *Router) Notify(events []Event) error {
+	batches := make(map[string][]Event)
+	var order []string
+
+	for _, e := range events {
+		for _, name := range r.destinations(e) {
+			if _, ok := batches[name]; !ok {
+				order = append(order, name)
+			}
+			batches[name] = append(batches[name], e)
+		}
+	}
+
+	var errs []error
+	for _, name := range order {
+		if err := r.notifiers[name].Notify(batches[name]); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// destinations returns the notifiers an event should be sent to
+func (r *Router) destinations(e Event) []string {
+	var names []string
+	seen := make(map[string]bool)
+
+	for _, rt := range r.routes {
+		if !rt.matches(e) {
+			continue
+		}
+
+		for _, name := range rt.notifiers {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+
+		if !rt.cont {
+			break
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,370 @@
+// Package openapi validates OpenAPI documents, bundles their external
+// references and compares the operations of two versions
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// methods lists the keys of a path item that are operations
+var methods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// Document is a parsed OpenAPI or Swagger document
+type Document struct {
+	Root map[string]interface{}
+	JSON bool // The source was JSON, so it's written back as JSON
+}
+
+// Operation identifies an API operation
+type Operation struct {
+	Method      string
+	Path        string
+	OperationID string
+}
+
+func (o Operation) String() string {
+	return strings.ToUpper(o.Method) + " " + o.Path
+}
+
+// Parse reads a JSON or YAML document
+func Parse(data []byte) (*Document, error) {
+	var value interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return nil, fmt.Errorf("error parsing spec: %w", err)
+	}
+	root, ok := normalize(value).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("spec is not an object")
+	}
+
+	trimmed := strings.TrimSpace(string(data))
+	return &Document{Root: root, JSON: strings.HasPrefix(trimmed, "{")}, nil
+}
+
+// Marshal encodes the document in its source format
+func (d *Document) Marshal() ([]byte, error) {
+	if d.JSON {
+		out, err := json.MarshalIndent(d.Root, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(out, '\n'), nil
+	}
+	return yaml.Marshal(d.Root)
+}
+
+// Validate checks the structure an OpenAPI 3 or Swagger 2 document needs:
+// its version, info, paths and responses, unique operation IDs, and that
+// every local $ref points at something
+func (d *Document) Validate() error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	version, _ := d.Root["openapi"].(string)
+	swagger, _ := d.Root["swagger"].(string)
+	switch {
+	case strings.HasPrefix(version, "3."):
+	case swagger == "2.0":
+	default:
+		problem("missing or unsupported openapi version")
+	}
+
+	info, _ := d.Root["info"].(map[string]interface{})
+	if info == nil {
+		problem("info is required")
+	} else {
+		if title, _ := info["title"].(string); title == "" {
+			problem("info.title is required")
+		}
+		if _, ok := info["version"]; !ok {
+			problem("info.version is required")
+		}
+	}
+
+	paths, ok := d.Root["paths"].(map[string]interface{})
+	if !ok {
+		// OpenAPI 3.1 allows webhook-only documents
+		if _, hasWebhooks := d.Root["webhooks"]; !hasWebhooks {
+			problem("paths is required")
+		}
+	}
+
+	ids := make(map[string]string)
+	for _, p := range sortedKeys(paths) {
+		if !strings.HasPrefix(p, "/") {
+			problem("path %q must start with /", p)
+		}
+		item, _ := paths[p].(map[string]interface{})
+		for _, method := range methods {
+			op, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name := strings.ToUpper(method) + " " + p
+			if _, ok := op["responses"]; !ok {
+				problem("%s has no responses", name)
+			}
+			if id, _ := op["operationId"].(string); id != "" {
+				if other, dup := ids[id]; dup {
+					problem("operationId %q is used by %s and %s", id, other, name)
+				}
+				ids[id] = name
+			}
+		}
+	}
+
+	walkRefs(d.Root, func(ref string) {
+		if strings.HasPrefix(ref, "#") {
+			if _, err := d.resolvePointer(ref[1:]); err != nil {
+				problem("unresolved $ref %q", ref)
+			}
+		}
+	})
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid spec: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Operations lists the operations in the document, sorted by path and method
+func (d *Document) Operations() []Operation {
+	paths, _ := d.Root["paths"].(map[string]interface{})
+
+	var ops []Operation
+	for _, p := range sortedKeys(paths) {
+		item, _ := paths[p].(map[string]interface{})
+		for _, method := range methods {
+			if op, ok := item[method].(map[string]interface{}); ok {
+				id, _ := op["operationId"].(string)
+				ops = append(ops, Operation{Method: method, Path: p, OperationID: id})
+			}
+		}
+	}
+	return ops
+}
+
+// Changes lists the operations added and removed between two documents
+type Changes struct {
+	Added   []Operation
+	Removed []Operation
+}
+
+// Compare returns the operations in after that aren't in before, and the
+// other way around
+func Compare(before, after *Document) Changes {
+	index := func(ops []Operation) map[string]bool {
+		set := make(map[string]bool)
+		for _, op := range ops {
+			set[op.String()] = true
+		}
+		return set
+	}
+
+	beforeOps, afterOps := before.Operations(), after.Operations()
+	inBefore, inAfter := index(beforeOps), index(afterOps)
+
+	var changes Changes
+	for _, op := range afterOps {
+		if !inBefore[op.String()] {
+			changes.Added = append(changes.Added, op)
+		}
+	}
+	for _, op := range beforeOps {
+		if !inAfter[op.String()] {
+			changes.Removed = append(changes.Removed, op)
+		}
+	}
+	return changes
+}
+
+// Bundle replaces references to other files with the content they point at,
+// so the document stands alone. fetch reads a file given its path relative
+// to the document. References inside fetched files are resolved relative to
+// those files.
+func (d *Document) Bundle(fetch func(file string) ([]byte, error)) error {
+	b := &bundler{fetch: fetch, files: make(map[string]*Document)}
+	root, err := b.inline(d.Root, ".", nil)
+	if err != nil {
+		return err
+	}
+	d.Root = root.(map[string]interface{})
+	return nil
+}
+
+type bundler struct {
+	fetch func(file string) ([]byte, error)
+	files map[string]*Document
+}
+
+// inline walks a value, replacing external references found in file. Local
+// references in fetched files are inlined too, since they'd point at the
+// wrong document once bundled. stack guards against reference cycles.
+func (b *bundler) inline(value interface{}, file string, stack []string) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok && (file != "." || !strings.HasPrefix(ref, "#")) {
+			return b.resolve(ref, file, stack)
+		}
+		for k, child := range v {
+			resolved, err := b.inline(child, file, stack)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = resolved
+		}
+	case []interface{}:
+		for i, child := range v {
+			resolved, err := b.inline(child, file, stack)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = resolved
+		}
+	}
+	return value, nil
+}
+
+func (b *bundler) resolve(ref, from string, stack []string) (interface{}, error) {
+	target, pointer, _ := strings.Cut(ref, "#")
+	if strings.Contains(target, "://") {
+		return nil, fmt.Errorf("can't bundle remote $ref %q", ref)
+	}
+
+	file := from
+	if target != "" {
+		file = path.Clean(path.Join(path.Dir(from), target))
+	}
+
+	key := file + "#" + pointer
+	for _, seen := range stack {
+		if seen == key {
+			return nil, fmt.Errorf("circular $ref %q", ref)
+		}
+	}
+
+	doc, ok := b.files[file]
+	if !ok {
+		data, err := b.fetch(file)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching $ref %q: %w", ref, err)
+		}
+		if doc, err = Parse(data); err != nil {
+			return nil, fmt.Errorf("$ref %q: %w", ref, err)
+		}
+		b.files[file] = doc
+	}
+
+	value, err := doc.resolvePointer(pointer)
+	if err != nil {
+		return nil, fmt.Errorf("$ref %q: %w", ref, err)
+	}
+
+	return b.inline(deepCopy(value), file, append(stack, key))
+}
+
+// resolvePointer follows a JSON pointer such as /components/schemas/User
+func (d *Document) resolvePointer(pointer string) (interface{}, error) {
+	var value interface{} = d.Root
+	if pointer == "" || pointer == "/" {
+		return value, nil
+	}
+
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			next, ok := v[token]
+			if !ok {
+				return nil, fmt.Errorf("%s not found", pointer)
+			}
+			value = next
+		case []interface{}:
+			var i int
+			if _, err := fmt.Sscanf(token, "%d", &i); err != nil || i < 0 || i >= len(v) {
+				return nil, fmt.Errorf("%s not found", pointer)
+			}
+			value = v[i]
+		default:
+			return nil, fmt.Errorf("%s not found", pointer)
+		}
+	}
+	return value, nil
+}
+
+// walkRefs calls fn with every $ref in a value
+func walkRefs(value interface{}, fn func(ref string)) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["$ref"].(string); ok {
+			fn(ref)
+		}
+		for _, child := range v {
+			walkRefs(child, fn)
+		}
+	case []interface{}:
+		for _, child := range v {
+			walkRefs(child, fn)
+		}
+	}
+}
+
+// normalize converts mappings with non-string keys, such as unquoted YAML
+// response codes, to string-keyed maps
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = normalize(child)
+		}
+		return v
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			out[fmt.Sprint(k)] = normalize(child)
+		}
+		return out
+	case []interface{}:
+		for i, child := range v {
+			v[i] = normalize(child)
+		}
+		return v
+	}
+	return value
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			out[k] = deepCopy(child)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, child := range v {
+			out[i] = deepCopy(child)
+		}
+		return out
+	}
+	return value
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,167 @@
+package openapi
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const petstore = `openapi: 3.0.3
+info:
+  title: Petstore
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      responses:
+        200:
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/Pets"
+    post:
+      operationId: createPet
+      responses:
+        "201":
+          description: Created
+  /pets/{id}:
+    get:
+      operationId: getPet
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: "schemas/pet.yaml#/Pet"
+components:
+  schemas:
+    Pets:
+      type: array
+      items:
+        $ref: "schemas/pet.yaml#/Pet"
+`
+
+func TestValidate(t *testing.T) {
+	doc, err := Parse([]byte(petstore))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if err := doc.Validate(); err != nil {
+		t.Errorf("Expected valid spec, got %v", err)
+	}
+
+	tests := []struct {
+		name string
+		edit func(string) string
+		want string
+	}{
+		{"version", func(s string) string { return strings.Replace(s, "openapi: 3.0.3", "openapi: 1.0", 1) }, "unsupported openapi version"},
+		{"title", func(s string) string { return strings.Replace(s, "title: Petstore", "title: \"\"", 1) }, "info.title"},
+		{"responses", func(s string) string {
+			return strings.Replace(s, "      responses:\n        \"201\":\n          description: Created\n", "", 1)
+		}, "POST /pets has no responses"},
+		{"operation ID", func(s string) string { return strings.Replace(s, "operationId: getPet", "operationId: listPets", 1) }, "operationId \"listPets\""},
+		{"local ref", func(s string) string {
+			return strings.Replace(s, "#/components/schemas/Pets", "#/components/schemas/Missing", 1)
+		}, "unresolved $ref"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse([]byte(tt.edit(petstore)))
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if err := doc.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	before, _ := Parse([]byte(petstore))
+	after, _ := Parse([]byte(strings.Replace(petstore, "    post:\n      operationId: createPet", "    put:\n      operationId: createPet", 1)))
+
+	changes := Compare(before, after)
+	if len(changes.Added) != 1 || changes.Added[0].String() != "PUT /pets" {
+		t.Errorf("Unexpected added operations: %v", changes.Added)
+	}
+	if len(changes.Removed) != 1 || changes.Removed[0].String() != "POST /pets" {
+		t.Errorf("Unexpected removed operations: %v", changes.Removed)
+	}
+}
+
+func TestBundle(t *testing.T) {
+	files := map[string]string{
+		"schemas/pet.yaml": `Pet:
+  type: object
+  properties:
+    name:
+      type: string
+    tag:
+      $ref: "#/Tag"
+    owner:
+      $ref: "../common.yaml#/Owner"
+Tag:
+  type: string
+`,
+		"common.yaml": "Owner:\n  type: string\n",
+	}
+	var fetched []string
+	fetch := func(file string) ([]byte, error) {
+		fetched = append(fetched, file)
+		content, ok := files[file]
+		if !ok {
+			return nil, fmt.Errorf("%s not found", file)
+		}
+		return []byte(content), nil
+	}
+
+	doc, _ := Parse([]byte(petstore))
+	if err := doc.Bundle(fetch); err != nil {
+		t.Fatalf("Bundle failed: %v", err)
+	}
+	if err := doc.Validate(); err != nil {
+		t.Errorf("Expected bundled spec to be valid: %v", err)
+	}
+
+	out, err := doc.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if strings.Contains(string(out), "pet.yaml") || strings.Contains(string(out), "common.yaml") {
+		t.Errorf("Expected external refs to be inlined:\n%s", out)
+	}
+	if !strings.Contains(string(out), "#/components/schemas/Pets") {
+		t.Errorf("Expected local refs to be kept:\n%s", out)
+	}
+	if len(fetched) != 2 {
+		t.Errorf("Expected each file to be fetched once, got %v", fetched)
+	}
+
+	// Cycles are reported rather than followed forever
+	files["schemas/pet.yaml"] = "Pet:\n  $ref: \"#/Pet\"\n"
+	doc, _ = Parse([]byte(petstore))
+	if err := doc.Bundle(fetch); err == nil || !strings.Contains(err.Error(), "circular") {
+		t.Errorf("Expected circular ref error, got %v", err)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	doc, err := Parse([]byte(`{"swagger": "2.0", "info": {"title": "API", "version": "1"}, "paths": {}}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if !doc.JSON || doc.Validate() != nil {
+		t.Errorf("Expected a valid JSON document: %+v", doc)
+	}
+
+	out, _ := doc.Marshal()
+	if !strings.HasPrefix(string(out), "{\n") {
+		t.Errorf("Expected JSON output, got %s", out)
+	}
+}
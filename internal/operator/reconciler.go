@@ -0,0 +1,246 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/daemon"
+	"github.com/exitflynn/codesync/internal/kube"
+)
+
+// Reconciler keeps the daemon's sync items in line with the SyncItem
+// resources in a namespace and reports each item's outcome in its status.
+// New or changed resources are synced right away; the rest follow the
+// daemon's schedule.
+type Reconciler struct {
+	Client    *kube.Client
+	Namespace string
+	Daemon    *daemon.Daemon
+	Interval  time.Duration // How often to re-list resources, default 30s
+
+	mu      sync.Mutex
+	reports map[string]daemon.ReportSummary // Latest report per item
+	now     func() time.Time
+}
+
+// Run reconciles until ctx is cancelled
+func (r *Reconciler) Run(ctx context.Context) error {
+	events, cancel := r.Daemon.Subscribe()
+	defer cancel()
+
+	interval := r.Interval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.Reconcile(ctx); err != nil {
+			log.Printf("error reconciling sync items: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case e := <-events:
+			r.record(e)
+			r.drain(events)
+		}
+	}
+}
+
+// drain records every event already queued, so a burst of reports leads to
+// a single status update
+func (r *Reconciler) drain(events <-chan daemon.Event) {
+	for {
+		select {
+		case e := <-events:
+			r.record(e)
+		default:
+			return
+		}
+	}
+}
+
+// record keeps the latest report for each item
+func (r *Reconciler) record(e daemon.Event) {
+	if e.Type == daemon.EventItemSynced && e.Report != nil {
+		r.recordReport(*e.Report)
+	}
+}
+
+func (r *Reconciler) recordReport(report daemon.ReportSummary) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.reports == nil {
+		r.reports = make(map[string]daemon.ReportSummary)
+	}
+	r.reports[report.Item] = report
+}
+
+// Reconcile lists the SyncItem resources once, updates the daemon's items,
+// syncs items whose spec changed and writes their status
+func (r *Reconciler) Reconcile(ctx context.Context) error {
+	list, err := listResources(ctx, r.Client, r.Namespace)
+	if err != nil {
+		return err
+	}
+
+	var items []config.SyncItem
+	invalid := make(map[string]error)
+	for _, resource := range list.Items {
+		item := resource.ToConfig()
+		if err := item.Validate(); err != nil {
+			invalid[item.Name] = err
+			continue
+		}
+		items = append(items, item)
+	}
+	r.Daemon.Manager().SetItems(items)
+
+	for _, resource := range list.Items {
+		name := resource.Metadata.Name
+
+		if err, ok := invalid[name]; ok {
+			r.updateStatus(ctx, resource, r.invalidStatus(resource, err))
+			continue
+		}
+
+		if resource.Status.ObservedGeneration != resource.Metadata.Generation && !resource.Spec.Disabled {
+			run, err := r.Daemon.SyncItem(name, "operator")
+			if err != nil {
+				log.Printf("error syncing %s: %v", name, err)
+			}
+			for _, report := range run.Items {
+				r.recordReport(report)
+			}
+		}
+
+		r.updateStatus(ctx, resource, r.itemStatus(resource))
+	}
+
+	return nil
+}
+
+// itemStatus derives a resource's status from the stored state and the
+// latest report
+func (r *Reconciler) itemStatus(resource SyncItem) SyncItemStatus {
+	now := r.clock()
+	status := resource.Status
+	status.Conditions = append([]Condition(nil), status.Conditions...)
+	status.ObservedGeneration = resource.Metadata.Generation
+
+	name := resource.Metadata.Name
+	r.mu.Lock()
+	report, hasReport := r.reports[name]
+	r.mu.Unlock()
+
+	state, err := r.Daemon.Manager().ItemState(name)
+	if err == nil {
+		lastSync := state.LastSync
+		status.LastSync = &lastSync
+		status.LastCommitID = state.LastCommitID
+	}
+
+	conflict := Condition{Type: ConditionConflict, Status: "False", Reason: "NoConflict"}
+	if err == nil && state.HasLocalChanges && state.HasRemoteChanges {
+		conflict = Condition{
+			Type:    ConditionConflict,
+			Status:  "True",
+			Reason:  "DivergedChanges",
+			Message: "both the local copy and upstream have changed since the last sync",
+		}
+	}
+
+	ready := Condition{Type: ConditionReady, Status: "True", Reason: "Synced"}
+	switch {
+	case resource.Spec.Disabled:
+		ready = Condition{Type: ConditionReady, Status: "False", Reason: "Disabled", Message: "item is disabled"}
+	case hasReport && len(report.Errors) > 0:
+		ready = Condition{Type: ConditionReady, Status: "False", Reason: "SyncFailed", Message: strings.Join(report.Errors, "; ")}
+	case err == nil && state.Failing:
+		ready = Condition{Type: ConditionReady, Status: "False", Reason: "SyncFailed", Message: "the last sync failed"}
+	case conflict.Status == "True":
+		ready = Condition{Type: ConditionReady, Status: "False", Reason: "Conflict", Message: conflict.Message}
+	case err != nil:
+		ready = Condition{Type: ConditionReady, Status: "Unknown", Reason: "Pending", Message: "item has not been synced yet"}
+	}
+
+	status.setCondition(ready, now)
+	status.setCondition(conflict, now)
+	return status
+}
+
+// invalidStatus reports a spec that failed validation
+func (r *Reconciler) invalidStatus(resource SyncItem, err error) SyncItemStatus {
+	status := resource.Status
+	status.Conditions = append([]Condition(nil), status.Conditions...)
+	status.ObservedGeneration = resource.Metadata.Generation
+	status.setCondition(Condition{Type: ConditionReady, Status: "False", Reason: "InvalidSpec", Message: err.Error()}, r.clock())
+	return status
+}
+
+// updateStatus writes the status subresource if it changed
+func (r *Reconciler) updateStatus(ctx context.Context, resource SyncItem, status SyncItemStatus) {
+	// Compare the encoded forms, since timestamps read back from the API
+	// server differ in location and monotonic clock readings
+	before, _ := json.Marshal(resource.Status)
+	after, _ := json.Marshal(status)
+	if bytes.Equal(before, after) {
+		return
+	}
+
+	resource.Status = status
+	err := r.Client.Update(ctx, r.collectionPath()+"/"+resource.Metadata.Name+"/status", &resource, nil)
+	if err != nil && !errors.Is(err, kube.ErrConflict) {
+		log.Printf("error updating status of %s: %v", resource.Metadata.Name, err)
+	}
+}
+
+func (r *Reconciler) collectionPath() string {
+	return collectionPath(r.Namespace)
+}
+
+// ListItems returns the sync items defined as SyncItem resources in a
+// namespace, including those whose spec is invalid
+func ListItems(ctx context.Context, client *kube.Client, namespace string) ([]config.SyncItem, error) {
+	list, err := listResources(ctx, client, namespace)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]config.SyncItem, 0, len(list.Items))
+	for _, resource := range list.Items {
+		items = append(items, resource.ToConfig())
+	}
+	return items, nil
+}
+
+func listResources(ctx context.Context, client *kube.Client, namespace string) (*SyncItemList, error) {
+	var list SyncItemList
+	if err := client.Get(ctx, collectionPath(namespace), &list); err != nil {
+		return nil, fmt.Errorf("error listing sync items: %w", err)
+	}
+	return &list, nil
+}
+
+func collectionPath(namespace string) string {
+	return fmt.Sprintf("/apis/%s/%s/namespaces/%s/%s", Group, Version, namespace, Resource)
+}
+
+func (r *Reconciler) clock() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
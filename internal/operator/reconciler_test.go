@@ -0,0 +1,154 @@
+package operator
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/daemon"
+	"github.com/exitflynn/codesync/internal/kube"
+	csync "github.com/exitflynn/codesync/internal/sync"
+)
+
+// fakeAPIServer serves a fixed list of SyncItems and records status updates
+type fakeAPIServer struct {
+	items []SyncItem
+
+	mu       sync.Mutex
+	statuses map[string]SyncItemStatus
+}
+
+func (f *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const prefix = "/apis/" + Group + "/" + Version + "/namespaces/default/" + Resource
+
+	switch {
+	case r.Method == "GET" && r.URL.Path == prefix:
+		json.NewEncoder(w).Encode(SyncItemList{Items: f.items})
+
+	case r.Method == "PUT" && strings.HasSuffix(r.URL.Path, "/status"):
+		var item SyncItem
+		json.NewDecoder(r.Body).Decode(&item)
+
+		f.mu.Lock()
+		f.statuses[item.Metadata.Name] = item.Status
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(item)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func condition(status SyncItemStatus, conditionType string) Condition {
+	for _, c := range status.Conditions {
+		if c.Type == conditionType {
+			return c
+		}
+	}
+	return Condition{}
+}
+
+func TestReconcile(t *testing.T) {
+	source := config.SyncSource{Owner: "acme", Repo: "utils", Path: "logger.go"}
+	fake := &fakeAPIServer{
+		statuses: make(map[string]SyncItemStatus),
+		items: []SyncItem{
+			{
+				Metadata: kube.ObjectMeta{Name: "logger", Generation: 1},
+				Spec: SyncItemSpec{
+					Source: source,
+					Target: config.SyncTarget{Path: "internal/logger.go", Type: "file"},
+				},
+				// Already observed, so the reconciler doesn't trigger a sync
+				Status: SyncItemStatus{ObservedGeneration: 1},
+			},
+			{
+				Metadata: kube.ObjectMeta{Name: "paused", Generation: 1},
+				Spec: SyncItemSpec{
+					Source:   source,
+					Target:   config.SyncTarget{Path: "internal/paused.go", Type: "file"},
+					Disabled: true,
+				},
+			},
+			{
+				Metadata: kube.ObjectMeta{Name: "broken", Generation: 2},
+				Spec: SyncItemSpec{
+					Source: source,
+					Target: config.SyncTarget{Path: "internal/broken.go", Type: "symlink"},
+				},
+			},
+		},
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	cfg := &config.Config{Version: "1.0", GitHubToken: "test-token"}
+	manager, err := csync.NewSyncManager(cfg, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	r := &Reconciler{
+		Client:    &kube.Client{BaseURL: server.URL},
+		Namespace: "default",
+		Daemon:    daemon.New(manager, daemon.Interval(time.Hour)),
+		now:       func() time.Time { return now },
+	}
+
+	if err := r.Reconcile(context.Background()); err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+
+	items := manager.Items()
+	if len(items) != 2 || items[0].Name != "logger" || items[0].Source.Branch != "main" || items[1].Name != "paused" {
+		t.Errorf("Unexpected manager items: %+v", items)
+	}
+
+	if c := condition(fake.statuses["logger"], ConditionReady); c.Status != "Unknown" || c.Reason != "Pending" {
+		t.Errorf("Unexpected Ready condition for logger: %+v", c)
+	}
+	if c := condition(fake.statuses["logger"], ConditionConflict); c.Status != "False" || !c.LastTransitionTime.Equal(now) {
+		t.Errorf("Unexpected Conflict condition for logger: %+v", c)
+	}
+	if c := condition(fake.statuses["paused"], ConditionReady); c.Status != "False" || c.Reason != "Disabled" {
+		t.Errorf("Unexpected Ready condition for paused: %+v", c)
+	}
+
+	broken := fake.statuses["broken"]
+	if c := condition(broken, ConditionReady); c.Reason != "InvalidSpec" || !strings.Contains(c.Message, "symlink") {
+		t.Errorf("Unexpected Ready condition for broken: %+v", c)
+	}
+	if broken.ObservedGeneration != 2 {
+		t.Errorf("Expected observed generation 2, got %d", broken.ObservedGeneration)
+	}
+}
+
+func TestSetCondition(t *testing.T) {
+	t1 := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	t2 := t1.Add(time.Hour)
+
+	var status SyncItemStatus
+	if !status.setCondition(Condition{Type: ConditionReady, Status: "True", Reason: "Synced"}, t1) {
+		t.Error("Expected adding a condition to report a change")
+	}
+	if status.setCondition(Condition{Type: ConditionReady, Status: "True", Reason: "Synced"}, t2) {
+		t.Error("Expected an identical condition to report no change")
+	}
+
+	status.setCondition(Condition{Type: ConditionReady, Status: "True", Reason: "Synced", Message: "ok"}, t2)
+	if !status.Conditions[0].LastTransitionTime.Equal(t1) {
+		t.Error("Expected transition time to be kept when the status is unchanged")
+	}
+
+	status.setCondition(Condition{Type: ConditionReady, Status: "False", Reason: "SyncFailed"}, t2)
+	if len(status.Conditions) != 1 || !status.Conditions[0].LastTransitionTime.Equal(t2) {
+		t.Errorf("Expected transition time to change with the status: %+v", status.Conditions)
+	}
+}
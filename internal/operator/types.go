@@ -0,0 +1,109 @@
+// Package operator defines sync items as Kubernetes custom resources and
+// reconciles them with the daemon
+package operator
+
+import (
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/kube"
+)
+
+// API group and version of the SyncItem custom resource
+const (
+	Group      = "codesync.exitflynn.github.io"
+	Version    = "v1alpha1"
+	APIVersion = Group + "/" + Version
+	Kind       = "SyncItem"
+	Resource   = "syncitems"
+)
+
+// Condition types reported in a SyncItem's status
+const (
+	ConditionReady    = "Ready"    // The last sync succeeded and there is no conflict
+	ConditionConflict = "Conflict" // Local and upstream changes diverged
+)
+
+// SyncItem is a sync item defined as a custom resource. The resource name is
+// the item name.
+type SyncItem struct {
+	APIVersion string          `json:"apiVersion"`
+	Kind       string          `json:"kind"`
+	Metadata   kube.ObjectMeta `json:"metadata"`
+	Spec       SyncItemSpec    `json:"spec"`
+	Status     SyncItemStatus  `json:"status,omitempty"`
+}
+
+// SyncItemList is the response to listing SyncItems
+type SyncItemList struct {
+	Items []SyncItem `json:"items"`
+}
+
+// SyncItemSpec mirrors config.SyncItem
+type SyncItemSpec struct {
+	Description string            `json:"description,omitempty"`
+	Source      config.SyncSource `json:"source"`
+	Target      config.SyncTarget `json:"target"`
+	Disabled    bool              `json:"disabled,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+}
+
+// SyncItemStatus is written by the reconciler
+type SyncItemStatus struct {
+	ObservedGeneration int64       `json:"observedGeneration,omitempty"`
+	LastSync           *time.Time  `json:"lastSync,omitempty"`
+	LastCommitID       string      `json:"lastCommitID,omitempty"`
+	Conditions         []Condition `json:"conditions,omitempty"`
+}
+
+// Condition follows the Kubernetes status condition conventions
+type Condition struct {
+	Type               string    `json:"type"`
+	Status             string    `json:"status"` // "True", "False" or "Unknown"
+	Reason             string    `json:"reason,omitempty"`
+	Message            string    `json:"message,omitempty"`
+	LastTransitionTime time.Time `json:"lastTransitionTime"`
+}
+
+// ToConfig converts the resource into a config sync item
+func (s *SyncItem) ToConfig() config.SyncItem {
+	item := config.SyncItem{
+		Name:        s.Metadata.Name,
+		Description: s.Spec.Description,
+		Source:      s.Spec.Source,
+		Target:      s.Spec.Target,
+		Disabled:    s.Spec.Disabled,
+		Tags:        s.Spec.Tags,
+	}
+
+	if item.Source.Branch == "" {
+		item.Source.Branch = "main"
+	}
+
+	return item
+}
+
+// setCondition adds or updates a condition, keeping its transition time when
+// the status is unchanged. It reports whether anything changed.
+func (s *SyncItemStatus) setCondition(c Condition, now time.Time) bool {
+	for i, existing := range s.Conditions {
+		if existing.Type != c.Type {
+			continue
+		}
+
+		if existing.Status == c.Status && existing.Reason == c.Reason && existing.Message == c.Message {
+			return false
+		}
+
+		c.LastTransitionTime = existing.LastTransitionTime
+		if existing.Status != c.Status {
+			c.LastTransitionTime = now
+		}
+		s.Conditions[i] = c
+		return true
+	}
+
+	c.LastTransitionTime = now
+	s.Conditions = append(s.Conditions, c)
+	return true
+}
@@ -0,0 +1,24 @@
+package plugin
+
+import "github.com/exitflynn/codesync/internal/notify"
+
+// NotifyArgs are the arguments of Notifier.Notify
+type NotifyArgs struct {
+	Events []notify.Event
+}
+
+// Notifier sends notifications through a plugin
+type Notifier struct {
+	client *Client
+}
+
+// NewNotifier uses a plugin as a notifier
+func NewNotifier(client *Client) *Notifier {
+	return &Notifier{client: client}
+}
+
+// Notify passes events to the plugin
+func (n *Notifier) Notify(events []notify.Event) error {
+	var reply bool
+	return n.client.Call("Notifier.Notify", NotifyArgs{events}, &reply)
+}
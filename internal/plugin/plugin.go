@@ -0,0 +1,179 @@
+// Package plugin runs external binaries that add source providers,
+// transforms and notifiers to codesync without recompiling it.
+//
+// A plugin is an executable that speaks JSON-RPC 1.0 (as implemented by
+// net/rpc/jsonrpc) on its stdin and stdout, and exits when stdin is closed.
+// Depending on its kind it serves these methods:
+//
+//	provider:  Provider.GetFile, Provider.GetDirectory,
+//	           Provider.GetCommitsSince, Provider.GetFileDiff
+//	transform: Transform.Apply
+//	notifier:  Notifier.Notify
+//
+// The argument and reply types are declared in this package. Plugins written
+// in Go can implement them on a type and call Serve.
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+// DefaultDir is where plugin binaries are looked up if the config doesn't set
+// pluginDir
+const DefaultDir = ".codesync/plugins"
+
+// BinaryPrefix starts the file name of a plugin binary in the plugin
+// directory: codesync-plugin-<name>
+const BinaryPrefix = "codesync-plugin-"
+
+// Client runs a plugin binary and calls its methods. The process is started
+// on the first call and restarted if it exits.
+type Client struct {
+	name string
+	path string
+	args []string
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	client *rpc.Client
+}
+
+// NewClient creates a client for a plugin binary
+func NewClient(name, path string, args ...string) *Client {
+	return &Client{name: name, path: path, args: args}
+}
+
+// Load creates a client for a plugin declared in the config. Without an
+// explicit path the binary is looked up in the plugin directory.
+func Load(cfg *config.Config, p config.PluginConfig) (*Client, error) {
+	path := p.Path
+	if path == "" {
+		dir := cfg.PluginDir
+		if dir == "" {
+			dir = DefaultDir
+		}
+		path = filepath.Join(dir, BinaryPrefix+p.Name)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", p.Name, err)
+	}
+	if info.IsDir() || info.Mode()&0111 == 0 {
+		return nil, fmt.Errorf("plugin %s: %s is not executable", p.Name, path)
+	}
+
+	return NewClient(p.Name, path, p.Args...), nil
+}
+
+// Name returns the plugin's name from the config
+func (c *Client) Name() string {
+	return c.name
+}
+
+// Call invokes a method of the plugin, starting it if needed. A plugin that
+// exited is restarted once.
+func (c *Client) Call(method string, args, reply any) error {
+	for attempt := 0; ; attempt++ {
+		client, err := c.start()
+		if err != nil {
+			return err
+		}
+
+		err = client.Call(method, args, reply)
+		if attempt == 0 && (errors.Is(err, rpc.ErrShutdown) || errors.Is(err, io.ErrUnexpectedEOF)) {
+			c.stop(client)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("plugin %s: %s: %w", c.name, method, err)
+		}
+		return nil
+	}
+}
+
+// Close stops the plugin
+func (c *Client) Close() error {
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+	if client == nil {
+		return nil
+	}
+	return c.stop(client)
+}
+
+// start launches the plugin if it isn't running
+func (c *Client) start() (*rpc.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client != nil {
+		return c.client, nil
+	}
+
+	cmd := exec.Command(c.path, c.args...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", c.name, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: %w", c.name, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("plugin %s: failed to start: %w", c.name, err)
+	}
+
+	c.cmd = cmd
+	c.client = jsonrpc.NewClient(&pipe{ReadCloser: stdout, WriteCloser: stdin})
+	return c.client, nil
+}
+
+// stop closes the plugin's stdin, which tells it to exit, and waits for it
+func (c *Client) stop(client *rpc.Client) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client != client {
+		return nil // Already restarted
+	}
+
+	err := client.Close()
+	c.cmd.Wait()
+	c.client, c.cmd = nil, nil
+	return err
+}
+
+// pipe joins a process's stdout and stdin into one connection
+type pipe struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+func (p *pipe) Close() error {
+	err := p.WriteCloser.Close()
+	p.ReadCloser.Close()
+	return err
+}
+
+// Serve serves a plugin's methods on stdin and stdout until stdin is closed.
+// name is the service the methods of rcvr are registered under: "Provider",
+// "Transform" or "Notifier".
+func Serve(name string, rcvr any) error {
+	server := rpc.NewServer()
+	if err := server.RegisterName(name, rcvr); err != nil {
+		return err
+	}
+	server.ServeCodec(jsonrpc.NewServerCodec(&pipe{ReadCloser: os.Stdin, WriteCloser: os.Stdout}))
+	return nil
+}
@@ -0,0 +1,141 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+	"github.com/exitflynn/codesync/internal/notify"
+)
+
+// The test binary doubles as a plugin when CODESYNC_TEST_PLUGIN is set
+func TestMain(m *testing.M) {
+	switch os.Getenv("CODESYNC_TEST_PLUGIN") {
+	case "provider":
+		Serve("Provider", &testProvider{})
+		os.Exit(0)
+	case "transform":
+		Serve("Transform", &testTransform{})
+		os.Exit(0)
+	case "notifier":
+		Serve("Notifier", &testNotifier{})
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+type testProvider struct{}
+
+func (p *testProvider) GetFile(args FileArgs, reply *github.FileInfo) error {
+	if args.Path == "missing.go" {
+		return fmt.Errorf("file not found: %s", args.Path)
+	}
+	*reply = github.FileInfo{Content: "package " + args.Repo + "\n", Path: args.Path, SHA: "f1", CommitID: args.Ref}
+	return nil
+}
+
+func (p *testProvider) GetCommitsSince(args CommitsArgs, reply *[]github.CommitInfo) error {
+	*reply = []github.CommitInfo{{SHA: "c2", Message: "since " + args.SinceCommit}}
+	return nil
+}
+
+type testTransform struct{}
+
+func (t *testTransform) Apply(args TransformArgs, reply *string) error {
+	if args.Content == "crash" {
+		os.Exit(1)
+	}
+	*reply = strings.ToUpper(args.Content)
+	return nil
+}
+
+type testNotifier struct{}
+
+func (n *testNotifier) Notify(args NotifyArgs, reply *bool) error {
+	if len(args.Events) != 1 || args.Events[0].Item != "logger" {
+		return fmt.Errorf("unexpected events: %+v", args.Events)
+	}
+	return nil
+}
+
+func testClient(t *testing.T, kind string) *Client {
+	t.Helper()
+	t.Setenv("CODESYNC_TEST_PLUGIN", kind)
+	client := NewClient(kind, os.Args[0])
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestProvider(t *testing.T) {
+	provider := NewProvider(testClient(t, "provider"))
+
+	file, err := provider.GetFile("acme", "utils", "log.go", "abc")
+	if err != nil {
+		t.Fatalf("GetFile failed: %v", err)
+	}
+	if file.Content != "package utils\n" || file.CommitID != "abc" {
+		t.Errorf("Unexpected file: %+v", file)
+	}
+	if _, err := provider.GetFile("acme", "utils", "missing.go", "abc"); err == nil || !strings.Contains(err.Error(), "file not found") {
+		t.Errorf("Expected the plugin's error, got %v", err)
+	}
+
+	commits, err := provider.GetCommitsSince("acme", "utils", "log.go", "main", time.Time{}, "c1")
+	if err != nil || len(commits) != 1 || commits[0].Message != "since c1" {
+		t.Errorf("Unexpected commits: %+v, %v", commits, err)
+	}
+
+	// Methods the plugin doesn't serve fail
+	if _, err := provider.GetFileDiff("acme", "utils", "log.go", "a", "b"); err == nil {
+		t.Error("Expected an unserved method to fail")
+	}
+}
+
+func TestTransformRestartsCrashedPlugin(t *testing.T) {
+	transform := NewTransform(testClient(t, "transform"))
+
+	if got, err := transform.Apply("logger", "log.go", "package log"); err != nil || got != "PACKAGE LOG" {
+		t.Fatalf("Unexpected transform: %q, %v", got, err)
+	}
+	if _, err := transform.Apply("logger", "log.go", "crash"); err == nil {
+		t.Fatal("Expected a crashing plugin to fail")
+	}
+	if got, err := transform.Apply("logger", "log.go", "again"); err != nil || got != "AGAIN" {
+		t.Errorf("Expected the plugin to be restarted, got %q, %v", got, err)
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	notifier := NewNotifier(testClient(t, "notifier"))
+	if err := notifier.Notify([]notify.Event{{Item: "logger", Type: notify.EventUpdated}}); err != nil {
+		t.Errorf("Notify failed: %v", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{PluginDir: dir}
+
+	if _, err := Load(cfg, config.PluginConfig{Name: "mono", Kind: "provider"}); err == nil {
+		t.Error("Expected a missing binary to fail")
+	}
+
+	path := filepath.Join(dir, BinaryPrefix+"mono")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(cfg, config.PluginConfig{Name: "mono", Kind: "provider"}); err == nil {
+		t.Error("Expected a binary that isn't executable to fail")
+	}
+
+	os.Chmod(path, 0755)
+	client, err := Load(cfg, config.PluginConfig{Name: "mono", Kind: "provider"})
+	if err != nil || client.path != path {
+		t.Errorf("Expected the binary from the plugin directory, got %v", err)
+	}
+}
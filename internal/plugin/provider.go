@@ -0,0 +1,81 @@
+package plugin
+
+import (
+	"time"
+
+	"github.com/exitflynn/codesync/internal/github"
+)
+
+// FileArgs identifies a file or directory at a ref
+type FileArgs struct {
+	Owner string
+	Repo  string
+	Path  string
+	Ref   string
+}
+
+// CommitsArgs are the arguments of Provider.GetCommitsSince
+type CommitsArgs struct {
+	Owner       string
+	Repo        string
+	Path        string
+	Ref         string
+	Since       time.Time
+	SinceCommit string
+}
+
+// DiffArgs are the arguments of Provider.GetFileDiff
+type DiffArgs struct {
+	Owner   string
+	Repo    string
+	Path    string
+	BaseRef string
+	HeadRef string
+}
+
+// Provider is a source provider implemented by a plugin
+type Provider struct {
+	client *Client
+}
+
+// NewProvider uses a plugin as a source provider
+func NewProvider(client *Client) *Provider {
+	return &Provider{client: client}
+}
+
+// GetFile retrieves a file
+func (p *Provider) GetFile(owner, repo, path, ref string) (*github.FileInfo, error) {
+	var reply github.FileInfo
+	if err := p.client.Call("Provider.GetFile", FileArgs{owner, repo, path, ref}, &reply); err != nil {
+		return nil, err
+	}
+	return &reply, nil
+}
+
+// GetDirectory retrieves all files below a directory
+func (p *Provider) GetDirectory(owner, repo, path, ref string) (map[string]*github.FileInfo, error) {
+	var reply map[string]*github.FileInfo
+	if err := p.client.Call("Provider.GetDirectory", FileArgs{owner, repo, path, ref}, &reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// GetCommitsSince gets the commits to a path since a date or commit, newest
+// first
+func (p *Provider) GetCommitsSince(owner, repo, path, ref string, since time.Time, sinceCommit string) ([]github.CommitInfo, error) {
+	var reply []github.CommitInfo
+	if err := p.client.Call("Provider.GetCommitsSince", CommitsArgs{owner, repo, path, ref, since, sinceCommit}, &reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// GetFileDiff gets the diff between two versions of a file
+func (p *Provider) GetFileDiff(owner, repo, path, baseRef, headRef string) (string, error) {
+	var reply string
+	if err := p.client.Call("Provider.GetFileDiff", DiffArgs{owner, repo, path, baseRef, headRef}, &reply); err != nil {
+		return "", err
+	}
+	return reply, nil
+}
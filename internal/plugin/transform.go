@@ -0,0 +1,28 @@
+package plugin
+
+// TransformArgs are the arguments of Transform.Apply: upstream content of an
+// item, before it is written to the target
+type TransformArgs struct {
+	Item    string // Item name
+	Path    string // Target path
+	Content string
+}
+
+// Transform rewrites upstream content with a plugin
+type Transform struct {
+	client *Client
+}
+
+// NewTransform uses a plugin as a transform
+func NewTransform(client *Client) *Transform {
+	return &Transform{client: client}
+}
+
+// Apply returns the transformed content
+func (t *Transform) Apply(item, path, content string) (string, error) {
+	var reply string
+	if err := t.client.Call("Transform.Apply", TransformArgs{item, path, content}, &reply); err != nil {
+		return "", err
+	}
+	return reply, nil
+}
@@ -0,0 +1,148 @@
+package protocheck
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Change is a breaking change between two versions of a file
+type Change struct {
+	Element     string // The affected definition, e.g. "message User" or "field User.email"
+	Description string
+}
+
+func (c Change) String() string {
+	return c.Element + ": " + c.Description
+}
+
+// Breaking parses two versions of a .proto file and returns the changes in
+// the new version that break existing clients or stored data
+func Breaking(oldSrc, newSrc string) ([]Change, error) {
+	oldFile, err := Parse(oldSrc)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing current version: %w", err)
+	}
+	newFile, err := Parse(newSrc)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing new version: %w", err)
+	}
+
+	return Compare(oldFile, newFile), nil
+}
+
+// Compare returns the breaking changes from before to after: removed or retyped
+// definitions, fields and enum values whose numbers weren't reserved, and
+// changed RPC signatures. Additions are never breaking.
+func Compare(before, after *File) []Change {
+	var changes []Change
+	add := func(element, format string, args ...interface{}) {
+		changes = append(changes, Change{Element: element, Description: fmt.Sprintf(format, args...)})
+	}
+
+	if before.Package != after.Package {
+		add("package", "changed from %q to %q", before.Package, after.Package)
+	}
+
+	for _, name := range sortedKeys(before.Messages) {
+		om := before.Messages[name]
+		nm, ok := after.Messages[name]
+		if !ok {
+			add("message "+name, "removed")
+			continue
+		}
+
+		for _, number := range sortedKeys(om.Fields) {
+			of := om.Fields[number]
+			element := fmt.Sprintf("field %s.%s", name, of.Name)
+
+			nf, ok := nm.Fields[number]
+			if !ok {
+				if !nm.Reserved.number(number) {
+					add(element, "field %d removed without reserving its number", number)
+				}
+				continue
+			}
+
+			if of.Type != nf.Type {
+				add(element, "type changed from %s to %s", of.Type, nf.Type)
+			}
+			if of.Label != nf.Label && !(isSingular(of.Label) && isSingular(nf.Label)) {
+				add(element, "changed from %s to %s", labelName(of.Label), labelName(nf.Label))
+			}
+			if of.Name != nf.Name {
+				add(element, "renamed to %s, which breaks JSON encoding", nf.Name)
+			}
+			if of.Oneof != nf.Oneof && of.Oneof != "" {
+				add(element, "moved out of oneof %s", of.Oneof)
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(before.Enums) {
+		oe := before.Enums[name]
+		ne, ok := after.Enums[name]
+		if !ok {
+			add("enum "+name, "removed")
+			continue
+		}
+
+		for _, number := range sortedKeys(oe.Values) {
+			if _, ok := ne.Values[number]; !ok && !ne.Reserved.number(number) {
+				add(fmt.Sprintf("enum value %s.%s", name, oe.Values[number]), "value %d removed without reserving it", number)
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(before.Services) {
+		oldService := before.Services[name]
+		newService, ok := after.Services[name]
+		if !ok {
+			add("service "+name, "removed")
+			continue
+		}
+
+		for _, method := range sortedKeys(oldService.Methods) {
+			om := oldService.Methods[method]
+			element := fmt.Sprintf("rpc %s.%s", name, method)
+
+			nm, ok := newService.Methods[method]
+			if !ok {
+				add(element, "removed")
+				continue
+			}
+			if om.Input != nm.Input {
+				add(element, "request type changed from %s to %s", om.Input, nm.Input)
+			}
+			if om.Output != nm.Output {
+				add(element, "response type changed from %s to %s", om.Output, nm.Output)
+			}
+			if om.ClientStreaming != nm.ClientStreaming || om.ServerStreaming != nm.ServerStreaming {
+				add(element, "streaming changed")
+			}
+		}
+	}
+
+	return changes
+}
+
+// isSingular reports whether a label describes a non-repeated field. Moving
+// between implicit and explicit presence keeps the wire format.
+func isSingular(label string) bool {
+	return label != "repeated"
+}
+
+func labelName(label string) string {
+	if label == "repeated" {
+		return "repeated"
+	}
+	return "singular"
+}
+
+func sortedKeys[K int | string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
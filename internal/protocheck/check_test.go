@@ -0,0 +1,157 @@
+package protocheck
+
+import (
+	"strings"
+	"testing"
+)
+
+const userV1 = `
+syntax = "proto3";
+
+package acme.users.v1;
+
+import "google/protobuf/timestamp.proto";
+
+option go_package = "example.com/users;users";
+
+// A user account
+message User {
+  string id = 1;
+  string email = 2 [deprecated = true];
+  repeated string roles = 3;
+  map<string, string> labels = 4;
+  Status status = 5;
+  oneof contact {
+    string phone = 6;
+    string pager = 7;
+  }
+
+  message Address {
+    string city = 1;
+  }
+  Address address = 8;
+}
+
+enum Status {
+  STATUS_UNSPECIFIED = 0;
+  STATUS_ACTIVE = 1;
+  STATUS_BANNED = 2;
+}
+
+service Users {
+  rpc GetUser(GetUserRequest) returns (User);
+  rpc Watch(GetUserRequest) returns (stream User) {
+    option (google.api.http) = { get: "/v1/users/{id}:watch" };
+  }
+}
+
+message GetUserRequest {
+  string id = 1;
+}
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse(userV1)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if f.Package != "acme.users.v1" {
+		t.Errorf("Unexpected package %q", f.Package)
+	}
+
+	user := f.Messages["User"]
+	if user == nil || len(user.Fields) != 8 {
+		t.Fatalf("Expected User with 8 fields, got %+v", user)
+	}
+	if field := user.Fields[4]; field.Type != "map<string, string>" || field.Name != "labels" {
+		t.Errorf("Unexpected map field: %+v", field)
+	}
+	if field := user.Fields[7]; field.Oneof != "contact" {
+		t.Errorf("Expected pager in oneof contact: %+v", field)
+	}
+	if f.Messages["User.Address"] == nil {
+		t.Error("Expected nested message User.Address")
+	}
+	if len(f.Enums["Status"].Values) != 3 {
+		t.Errorf("Unexpected enum: %+v", f.Enums["Status"])
+	}
+	if watch := f.Services["Users"].Methods["Watch"]; watch == nil || !watch.ServerStreaming || watch.ClientStreaming {
+		t.Errorf("Unexpected Watch method: %+v", watch)
+	}
+}
+
+func TestBreaking(t *testing.T) {
+	tests := []struct {
+		name   string
+		edit   func(string) string
+		expect string // Substring of the only expected change, or empty for none
+	}{
+		{"unchanged", func(s string) string { return s }, ""},
+		{"field added", func(s string) string {
+			return strings.Replace(s, "Address address = 8;", "Address address = 8;\n  string name = 9;", 1)
+		}, ""},
+		{"field removed", func(s string) string {
+			return strings.Replace(s, "repeated string roles = 3;", "", 1)
+		}, "field User.roles: field 3 removed"},
+		{"field removed and reserved", func(s string) string {
+			return strings.Replace(s, "repeated string roles = 3;", "reserved 3;", 1)
+		}, ""},
+		{"type changed", func(s string) string {
+			return strings.Replace(s, "string id = 1;\n  string email", "int64 id = 1;\n  string email", 1)
+		}, "field User.id: type changed from string to int64"},
+		{"label changed", func(s string) string {
+			return strings.Replace(s, "repeated string roles", "string roles", 1)
+		}, "changed from repeated to singular"},
+		{"optional added", func(s string) string {
+			return strings.Replace(s, "Status status = 5;", "optional Status status = 5;", 1)
+		}, ""},
+		{"renamed", func(s string) string {
+			return strings.Replace(s, "string email = 2", "string mail = 2", 1)
+		}, "renamed to mail"},
+		{"enum value removed", func(s string) string {
+			return strings.Replace(s, "STATUS_BANNED = 2;", "", 1)
+		}, "enum value Status.STATUS_BANNED"},
+		{"nested message removed", func(s string) string {
+			return strings.Replace(s, "message Address {\n    string city = 1;\n  }", "", 1)
+		}, "message User.Address: removed"},
+		{"rpc removed", func(s string) string {
+			return strings.Replace(s, "rpc GetUser(GetUserRequest) returns (User);", "", 1)
+		}, "rpc Users.GetUser: removed"},
+		{"streaming changed", func(s string) string {
+			return strings.Replace(s, "returns (stream User)", "returns (User)", 1)
+		}, "rpc Users.Watch: streaming changed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := Breaking(userV1, tt.edit(userV1))
+			if err != nil {
+				t.Fatalf("Breaking failed: %v", err)
+			}
+
+			if tt.expect == "" {
+				if len(changes) != 0 {
+					t.Errorf("Expected no breaking changes, got %v", changes)
+				}
+				return
+			}
+			if len(changes) != 1 || !strings.Contains(changes[0].String(), tt.expect) {
+				t.Errorf("Expected one change containing %q, got %v", tt.expect, changes)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		"message User { string id = ; }",
+		"message User { string id = 1;",
+		"service S { rpc Get(Req) (Resp); }",
+		"bogus",
+	} {
+		if _, err := Parse(src); err == nil {
+			t.Errorf("Expected Parse(%q) to fail", src)
+		}
+	}
+}
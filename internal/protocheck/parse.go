@@ -0,0 +1,489 @@
+// Package protocheck finds breaking changes between two versions of a .proto
+// file
+package protocheck
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// File is the subset of a .proto file that matters for compatibility.
+// Messages and enums are keyed by their name within the file, with nested
+// types written as Outer.Inner.
+type File struct {
+	Package  string
+	Messages map[string]*Message
+	Enums    map[string]*Enum
+	Services map[string]*Service
+}
+
+// Message is a message definition
+type Message struct {
+	Name     string
+	Fields   map[int]*Field
+	Reserved reserved
+}
+
+// Field is a message field
+type Field struct {
+	Name   string
+	Type   string
+	Label  string // "repeated", "optional", "required" or empty
+	Number int
+	Oneof  string // Enclosing oneof, if any
+}
+
+// Enum is an enum definition
+type Enum struct {
+	Name     string
+	Values   map[int]string
+	Reserved reserved
+}
+
+// Service is a service definition
+type Service struct {
+	Name    string
+	Methods map[string]*Method
+}
+
+// Method is a service RPC
+type Method struct {
+	Name            string
+	Input           string
+	Output          string
+	ClientStreaming bool
+	ServerStreaming bool
+}
+
+// reserved holds the numbers and names a message or enum reserves
+type reserved struct {
+	ranges [][2]int
+	names  map[string]bool
+}
+
+func (r reserved) number(n int) bool {
+	for _, rg := range r.ranges {
+		if n >= rg[0] && n <= rg[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse reads the definitions in a .proto file. Options, imports and
+// extensions are skipped.
+func Parse(src string) (*File, error) {
+	p := &parser{tokens: tokenize(src)}
+	f := &File{
+		Messages: make(map[string]*Message),
+		Enums:    make(map[string]*Enum),
+		Services: make(map[string]*Service),
+	}
+
+	for !p.done() {
+		switch tok := p.next(); tok {
+		case ";":
+		case "package":
+			f.Package = p.next()
+			if err := p.expect(";"); err != nil {
+				return nil, err
+			}
+		case "syntax", "edition", "import", "option":
+			p.skipStatement()
+		case "message":
+			if err := p.parseMessage(f, ""); err != nil {
+				return nil, err
+			}
+		case "enum":
+			if err := p.parseEnum(f, ""); err != nil {
+				return nil, err
+			}
+		case "service":
+			if err := p.parseService(f); err != nil {
+				return nil, err
+			}
+		case "extend":
+			p.next()
+			if err := p.skipBlock(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %q at top level", tok)
+		}
+	}
+
+	return f, nil
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) next() string {
+	if p.done() {
+		return ""
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+	return tok
+}
+
+func (p *parser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) expect(tok string) error {
+	if got := p.next(); got != tok {
+		return fmt.Errorf("expected %q, got %q", tok, got)
+	}
+	return nil
+}
+
+// skipStatement skips to the end of the current statement, including any
+// bracketed or braced option values
+func (p *parser) skipStatement() {
+	depth := 0
+	for !p.done() {
+		switch p.next() {
+		case "{", "[", "(":
+			depth++
+		case "}", "]", ")":
+			depth--
+		case ";":
+			if depth <= 0 {
+				return
+			}
+		}
+	}
+}
+
+// skipBlock skips a braced block, starting at its opening brace
+func (p *parser) skipBlock() error {
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for depth := 1; depth > 0; {
+		if p.done() {
+			return fmt.Errorf("unterminated block")
+		}
+		switch p.next() {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseMessage(f *File, prefix string) error {
+	name := prefix + p.next()
+	m := &Message{Name: name, Fields: make(map[int]*Field), Reserved: reserved{names: make(map[string]bool)}}
+	f.Messages[name] = m
+
+	if err := p.expect("{"); err != nil {
+		return fmt.Errorf("message %s: %w", name, err)
+	}
+	if err := p.parseMessageBody(f, m, ""); err != nil {
+		return fmt.Errorf("message %s: %w", name, err)
+	}
+	return nil
+}
+
+// parseMessageBody reads message members up to the closing brace. Inside a
+// oneof, oneof names the group.
+func (p *parser) parseMessageBody(f *File, m *Message, oneof string) error {
+	for {
+		if p.done() {
+			return fmt.Errorf("unterminated message")
+		}
+
+		switch tok := p.peek(); tok {
+		case "}":
+			p.next()
+			return nil
+		case ";":
+			p.next()
+		case "option", "extensions":
+			p.skipStatement()
+		case "reserved":
+			p.next()
+			if err := p.parseReserved(&m.Reserved); err != nil {
+				return err
+			}
+		case "message":
+			p.next()
+			if err := p.parseMessage(f, m.Name+"."); err != nil {
+				return err
+			}
+		case "enum":
+			p.next()
+			if err := p.parseEnum(f, m.Name+"."); err != nil {
+				return err
+			}
+		case "extend":
+			p.next()
+			p.next()
+			if err := p.skipBlock(); err != nil {
+				return err
+			}
+		case "oneof":
+			p.next()
+			group := p.next()
+			if err := p.expect("{"); err != nil {
+				return err
+			}
+			if err := p.parseMessageBody(f, m, group); err != nil {
+				return err
+			}
+		default:
+			field, err := p.parseField()
+			if err != nil {
+				return err
+			}
+			field.Oneof = oneof
+			m.Fields[field.Number] = field
+		}
+	}
+}
+
+// parseField reads "[label] type name = number [options];"
+func (p *parser) parseField() (*Field, error) {
+	field := &Field{}
+
+	switch p.peek() {
+	case "repeated", "optional", "required":
+		field.Label = p.next()
+	}
+
+	field.Type = p.next()
+	if field.Type == "map" {
+		// map<K, V> is written out as one type
+		var sb strings.Builder
+		sb.WriteString("map")
+		for tok := p.next(); ; tok = p.next() {
+			if tok == "" {
+				return nil, fmt.Errorf("unterminated map type")
+			}
+			sb.WriteString(tok)
+			if tok == ">" {
+				break
+			}
+			if tok == "," {
+				sb.WriteString(" ")
+			}
+		}
+		field.Type = sb.String()
+	}
+
+	field.Name = p.next()
+	if err := p.expect("="); err != nil {
+		return nil, fmt.Errorf("field %s: %w", field.Name, err)
+	}
+
+	number, err := strconv.Atoi(p.next())
+	if err != nil {
+		return nil, fmt.Errorf("field %s: invalid number", field.Name)
+	}
+	field.Number = number
+
+	p.skipStatement()
+	return field, nil
+}
+
+// parseReserved reads "reserved 2, 15, 9 to 11;" or "reserved "foo", "bar";"
+func (p *parser) parseReserved(r *reserved) error {
+	for {
+		tok := p.next()
+		switch {
+		case tok == ";":
+			return nil
+		case tok == ",":
+		case tok == "":
+			return fmt.Errorf("unterminated reserved statement")
+		case strings.HasPrefix(tok, `"`) || strings.HasPrefix(tok, "'"):
+			r.names[strings.Trim(tok, `"'`)] = true
+		default:
+			start, err := strconv.Atoi(tok)
+			if err != nil {
+				// Editions reserve names as bare identifiers
+				r.names[tok] = true
+				continue
+			}
+			end := start
+			if p.peek() == "to" {
+				p.next()
+				if limit := p.next(); limit == "max" {
+					end = 1<<29 - 1
+				} else if end, err = strconv.Atoi(limit); err != nil {
+					return fmt.Errorf("invalid reserved range end %q", limit)
+				}
+			}
+			r.ranges = append(r.ranges, [2]int{start, end})
+		}
+	}
+}
+
+func (p *parser) parseEnum(f *File, prefix string) error {
+	name := prefix + p.next()
+	e := &Enum{Name: name, Values: make(map[int]string), Reserved: reserved{names: make(map[string]bool)}}
+	f.Enums[name] = e
+
+	if err := p.expect("{"); err != nil {
+		return fmt.Errorf("enum %s: %w", name, err)
+	}
+
+	for {
+		switch tok := p.next(); tok {
+		case "":
+			return fmt.Errorf("enum %s: unterminated", name)
+		case "}":
+			return nil
+		case ";":
+		case "option":
+			p.skipStatement()
+		case "reserved":
+			if err := p.parseReserved(&e.Reserved); err != nil {
+				return fmt.Errorf("enum %s: %w", name, err)
+			}
+		default:
+			if err := p.expect("="); err != nil {
+				return fmt.Errorf("enum %s: %w", name, err)
+			}
+			value := p.next()
+			if value == "-" {
+				value += p.next()
+			}
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("enum %s: invalid value for %s", name, tok)
+			}
+			e.Values[number] = tok
+			p.skipStatement()
+		}
+	}
+}
+
+func (p *parser) parseService(f *File) error {
+	s := &Service{Name: p.next(), Methods: make(map[string]*Method)}
+	f.Services[s.Name] = s
+
+	if err := p.expect("{"); err != nil {
+		return fmt.Errorf("service %s: %w", s.Name, err)
+	}
+
+	for {
+		switch tok := p.next(); tok {
+		case "":
+			return fmt.Errorf("service %s: unterminated", s.Name)
+		case "}":
+			return nil
+		case ";":
+		case "option":
+			p.skipStatement()
+		case "rpc":
+			m := &Method{Name: p.next()}
+			var err error
+			if m.Input, m.ClientStreaming, err = p.parseMethodType(); err != nil {
+				return fmt.Errorf("rpc %s: %w", m.Name, err)
+			}
+			if err := p.expect("returns"); err != nil {
+				return fmt.Errorf("rpc %s: %w", m.Name, err)
+			}
+			if m.Output, m.ServerStreaming, err = p.parseMethodType(); err != nil {
+				return fmt.Errorf("rpc %s: %w", m.Name, err)
+			}
+			if p.peek() == "{" {
+				if err := p.skipBlock(); err != nil {
+					return err
+				}
+			} else {
+				p.skipStatement()
+			}
+			s.Methods[m.Name] = m
+		default:
+			return fmt.Errorf("service %s: unexpected %q", s.Name, tok)
+		}
+	}
+}
+
+// parseMethodType reads "(stream Type)"
+func (p *parser) parseMethodType() (string, bool, error) {
+	if err := p.expect("("); err != nil {
+		return "", false, err
+	}
+	streaming := false
+	typ := p.next()
+	if typ == "stream" && p.peek() != ")" {
+		streaming = true
+		typ = p.next()
+	}
+	if err := p.expect(")"); err != nil {
+		return "", false, err
+	}
+	return typ, streaming, nil
+}
+
+// tokenize splits proto source into identifiers, numbers, strings and
+// punctuation, dropping comments
+func tokenize(src string) []string {
+	var tokens []string
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := strings.Index(src[i+2:], "*/")
+			if end == -1 {
+				i = len(src)
+			} else {
+				i += end + 4
+			}
+		case unicode.IsSpace(rune(c)):
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(src) && src[j] != c {
+				if src[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j < len(src) {
+				j++
+			}
+			tokens = append(tokens, src[i:j])
+			i = j
+		case isIdentChar(c):
+			j := i
+			for j < len(src) && isIdentChar(src[j]) {
+				j++
+			}
+			tokens = append(tokens, src[i:j])
+			i = j
+		default:
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+	return tokens
+}
+
+// isIdentChar matches identifier characters, including the dots of
+// qualified names and number literals
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '.' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,103 @@
+// Package redact masks secrets in text that leaves the process: log lines,
+// report errors and notification payloads.
+package redact
+
+import (
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Mask replaces redacted text
+const Mask = "[REDACTED]"
+
+// minSecretLength is the shortest configured value that is masked; shorter
+// values would mask unrelated text
+const minSecretLength = 6
+
+// builtinPatterns match common token formats. Text matched by a pattern's
+// first and second groups, if any, is kept around the mask so the result
+// stays readable.
+var builtinPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+	regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}\b`),
+	regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+	regexp.MustCompile(`(https://hooks\.slack\.com/services/)[A-Za-z0-9/]+`),
+	regexp.MustCompile(`(?i)(\b(?:bearer|token)\s+)[A-Za-z0-9._~+/=-]{16,}`),
+	regexp.MustCompile(`(://[^/\s:@]+:)[^/\s@]+(@)`),
+	regexp.MustCompile(`(?i)([?&](?:access_token|token|key|secret|sig|signature)=)[^&\s"]+`),
+}
+
+// Redactor masks configured secret values and common token patterns
+type Redactor struct {
+	secrets  []string
+	patterns []*regexp.Regexp
+}
+
+// New creates a redactor for the given secret values and extra regular
+// expressions, whose groups are kept like those of the built-in patterns.
+// Empty and very short secrets are ignored.
+func New(secrets []string, patterns []string) (*Redactor, error) {
+	r := &Redactor{patterns: append([]*regexp.Regexp(nil), builtinPatterns...)}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	r.Add(secrets...)
+	return r, nil
+}
+
+// Add registers more secret values to mask
+func (r *Redactor) Add(secrets ...string) {
+	for _, secret := range secrets {
+		if len(secret) >= minSecretLength {
+			r.secrets = append(r.secrets, secret)
+		}
+	}
+	// Longest first, so a secret containing another is masked whole
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+}
+
+// String returns s with secrets masked. A nil redactor returns s unchanged.
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, Mask)
+	}
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, "${1}"+Mask+"${2}")
+	}
+	return s
+}
+
+// Strings masks secrets in each string in place
+func (r *Redactor) Strings(values []string) {
+	for i, value := range values {
+		values[i] = r.String(value)
+	}
+}
+
+// Writer returns a writer that masks secrets before writing to w. Each write
+// is redacted on its own, which suits the log package's one write per line.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	return &writer{r: r, w: w}
+}
+
+type writer struct {
+	r *Redactor
+	w io.Writer
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, w.r.String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
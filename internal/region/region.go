@@ -0,0 +1,86 @@
+// Package region finds and replaces marker-delimited regions of text files:
+//
+//	# codesync-begin preamble
+//	...
+//	# codesync-end preamble
+//
+// Markers can use any comment syntax, since only the text after the comment
+// leader is matched.
+package region
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var markerPattern = regexp.MustCompile(`^\s*(?:#|//|--|;|<!--|/\*)\s*codesync-(begin|end)\s+(\S+)`)
+
+// find returns the lines holding the begin and end markers of a region
+func find(lines []string, name string) (int, int, error) {
+	begin := -1
+	for i, line := range lines {
+		m := markerPattern.FindStringSubmatch(line)
+		if m == nil || m[2] != name {
+			continue
+		}
+		switch {
+		case m[1] == "begin" && begin < 0:
+			begin = i
+		case m[1] == "begin":
+			return 0, 0, fmt.Errorf("region %q begins twice", name)
+		default:
+			if begin < 0 {
+				return 0, 0, fmt.Errorf("region %q ends before it begins", name)
+			}
+			return begin, i, nil
+		}
+	}
+	if begin >= 0 {
+		return 0, 0, fmt.Errorf("region %q has no end marker", name)
+	}
+	return 0, 0, ErrNotFound
+}
+
+// ErrNotFound is returned for content without the region's markers
+var ErrNotFound = fmt.Errorf("region markers not found")
+
+// Has reports whether content has the markers of a region
+func Has(content, name string) bool {
+	_, _, err := find(strings.Split(content, "\n"), name)
+	return err == nil
+}
+
+// Extract returns the content between a region's markers
+func Extract(content, name string) (string, error) {
+	lines := strings.Split(content, "\n")
+	begin, end, err := find(lines, name)
+	if err != nil {
+		return "", err
+	}
+	return joinLines(lines[begin+1 : end]), nil
+}
+
+// Replace swaps the content between a region's markers for body, keeping the
+// markers and everything outside them
+func Replace(content, name, body string) (string, error) {
+	lines := strings.Split(content, "\n")
+	begin, end, err := find(lines, name)
+	if err != nil {
+		return "", err
+	}
+
+	out := append([]string{}, lines[:begin+1]...)
+	if body = strings.TrimSuffix(body, "\n"); body != "" {
+		out = append(out, strings.Split(body, "\n")...)
+	}
+	out = append(out, lines[end:]...)
+	return strings.Join(out, "\n"), nil
+}
+
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
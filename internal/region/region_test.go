@@ -0,0 +1,55 @@
+package region
+
+import (
+	"errors"
+	"testing"
+)
+
+const dockerfile = `# syntax=docker/dockerfile:1
+# codesync-begin preamble
+FROM alpine:3.19
+# codesync-end preamble
+RUN make
+`
+
+func TestExtract(t *testing.T) {
+	got, err := Extract(dockerfile, "preamble")
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	if got != "FROM alpine:3.19\n" {
+		t.Errorf("Unexpected region: %q", got)
+	}
+
+	if _, err := Extract(dockerfile, "other"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := Extract("// codesync-begin x\nbody\n", "x"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected missing end marker error, got %v", err)
+	}
+	if !Has("<!-- codesync-begin x -->\n<!-- codesync-end x -->\n", "x") {
+		t.Error("Expected HTML comment markers to be recognized")
+	}
+}
+
+func TestReplace(t *testing.T) {
+	got, err := Replace(dockerfile, "preamble", "FROM alpine:3.20@sha256:abc\nUSER app\n")
+	if err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+	want := `# syntax=docker/dockerfile:1
+# codesync-begin preamble
+FROM alpine:3.20@sha256:abc
+USER app
+# codesync-end preamble
+RUN make
+`
+	if got != want {
+		t.Errorf("Unexpected result:\n%s\nwant:\n%s", got, want)
+	}
+
+	got, _ = Replace(dockerfile, "preamble", "")
+	if got != "# syntax=docker/dockerfile:1\n# codesync-begin preamble\n# codesync-end preamble\nRUN make\n" {
+		t.Errorf("Unexpected result for empty body:\n%s", got)
+	}
+}
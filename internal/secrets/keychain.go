@@ -0,0 +1,160 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// KeychainService is the service name codesync's keychain entries are stored
+// under
+const KeychainService = "codesync"
+
+// Keychain stores secrets in the OS credential store: the login keychain on
+// macOS (through the security tool) and the Secret Service on Linux (through
+// secret-tool from libsecret). Names are account names, such as the GitHub
+// host a token is for. Secrets are passed to the tools on stdin, so they
+// don't show up in process listings.
+type Keychain struct {
+	Service string
+	OS      string // runtime.GOOS if empty
+	Logins  string // File listing the hosts codesync login stored a token for
+
+	// run executes a tool with input on stdin; exec.Command if nil
+	run func(input string, args ...string) (string, error)
+}
+
+// NewKeychain returns the keychain of the current OS
+func NewKeychain() *Keychain {
+	k := &Keychain{Service: KeychainService}
+	if dir, err := os.UserConfigDir(); err == nil {
+		k.Logins = filepath.Join(dir, "codesync", "logins")
+	}
+	return k
+}
+
+// Login stores the token codesync login obtained for a host and records the
+// host, so that later runs know to look it up
+func (k *Keychain) Login(host, token string) error {
+	if err := k.SetSecret(host, token); err != nil {
+		return err
+	}
+	if k.Logins == "" {
+		return fmt.Errorf("no config directory to record the login in")
+	}
+
+	hosts, err := k.loggedIn()
+	if err != nil {
+		return err
+	}
+	if slices.Contains(hosts, host) {
+		return nil
+	}
+	hosts = append(hosts, host)
+
+	if err := os.MkdirAll(filepath.Dir(k.Logins), 0700); err != nil {
+		return fmt.Errorf("error recording login: %w", err)
+	}
+	if err := os.WriteFile(k.Logins, []byte(strings.Join(hosts, "\n")+"\n"), 0600); err != nil {
+		return fmt.Errorf("error recording login: %w", err)
+	}
+	return nil
+}
+
+// LoginToken returns the token codesync login stored for a host, or "" if
+// there was no login. The keychain is only queried after a login, so runs
+// in CI or a daemon without one never call out to the keychain tools.
+func (k *Keychain) LoginToken(host string) (string, error) {
+	hosts, err := k.loggedIn()
+	if err != nil || !slices.Contains(hosts, host) {
+		return "", err
+	}
+	return k.GetSecret(host)
+}
+
+// loggedIn returns the hosts recorded by Login
+func (k *Keychain) loggedIn() ([]string, error) {
+	if k.Logins == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(k.Logins)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading logins: %w", err)
+	}
+	return strings.Fields(string(data)), nil
+}
+
+// GetSecret returns the secret stored for an account
+func (k *Keychain) GetSecret(name string) (string, error) {
+	var args []string
+	switch k.os() {
+	case "darwin":
+		args = []string{"security", "find-generic-password", "-s", k.Service, "-a", name, "-w"}
+	case "linux":
+		args = []string{"secret-tool", "lookup", "service", k.Service, "account", name}
+	default:
+		return "", fmt.Errorf("no keychain support on %s", k.os())
+	}
+
+	value, err := k.exec("", args...)
+	if err != nil {
+		return "", err
+	}
+	if value == "" {
+		return "", fmt.Errorf("no %s entry for %s in the keychain", k.Service, name)
+	}
+	return value, nil
+}
+
+// SetSecret stores a secret for an account, replacing any existing one
+func (k *Keychain) SetSecret(name, value string) error {
+	switch k.os() {
+	case "darwin":
+		// In interactive mode the command, and so the password, is read from
+		// stdin
+		command := fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n", quote(k.Service), quote(name), quote(value))
+		_, err := k.exec(command, "security", "-i")
+		return err
+	case "linux":
+		_, err := k.exec(value, "secret-tool", "store", "--label", k.Service+" "+name, "service", k.Service, "account", name)
+		return err
+	default:
+		return fmt.Errorf("no keychain support on %s", k.os())
+	}
+}
+
+func (k *Keychain) os() string {
+	if k.OS != "" {
+		return k.OS
+	}
+	return runtime.GOOS
+}
+
+func (k *Keychain) exec(input string, args ...string) (string, error) {
+	if k.run != nil {
+		return k.run(input, args...)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(input)
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("%s failed: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("%s failed: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// quote quotes an argument for the security tool's interactive mode
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
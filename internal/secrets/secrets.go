@@ -0,0 +1,205 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+// Provider fetches secret values from an external store
+type Provider interface {
+	GetSecret(name string) (string, error)
+}
+
+// EnvProvider reads secrets from environment variables
+type EnvProvider struct{}
+
+// GetSecret returns the value of the named environment variable
+func (EnvProvider) GetSecret(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// FileProvider reads secrets from files, such as mounted Kubernetes secrets
+type FileProvider struct{}
+
+// GetSecret returns the trimmed contents of the file at name
+func (FileProvider) GetSecret(name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", fmt.Errorf("error reading secret file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// VaultProvider reads secrets from HashiCorp Vault over its HTTP API. Names are
+// API paths relative to /v1, e.g. "secret/data/codesync" for a KV v2 mount.
+type VaultProvider struct {
+	Address string
+	Token   string
+	Client  *http.Client
+}
+
+// NewVaultProvider creates a Vault provider, falling back to the standard
+// VAULT_ADDR and VAULT_TOKEN environment variables
+func NewVaultProvider(address string) *VaultProvider {
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+
+	return &VaultProvider{
+		Address: strings.TrimRight(address, "/"),
+		Token:   os.Getenv("VAULT_TOKEN"),
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// GetSecret returns the secret data at the given path as JSON
+func (v *VaultProvider) GetSecret(name string) (string, error) {
+	if v.Address == "" {
+		return "", fmt.Errorf("vault address is not configured")
+	}
+
+	url := v.Address + "/v1/" + strings.TrimLeft(name, "/")
+	req, err := http.NewRequestWithContext(context.Background(), "GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned status code %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response body: %w", err)
+	}
+
+	var secret struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("error parsing vault response: %w", err)
+	}
+
+	// KV v2 nests the secret under another "data" key
+	var nested struct {
+		Data     json.RawMessage `json:"data"`
+		Metadata json.RawMessage `json:"metadata"`
+	}
+	if json.Unmarshal(secret.Data, &nested) == nil && nested.Data != nil && nested.Metadata != nil {
+		return string(nested.Data), nil
+	}
+
+	return string(secret.Data), nil
+}
+
+// CommandProvider reads secrets by running a CLI tool. It backs the AWS and
+// GCP providers so that codesync doesn't need to vendor the cloud SDKs; the
+// tools pick up credentials the same way they do for operators.
+type CommandProvider struct {
+	Command func(name string) []string
+}
+
+// GetSecret runs the command for name and returns its trimmed output
+func (c CommandProvider) GetSecret(name string) (string, error) {
+	args := c.Command(name)
+
+	out, err := exec.Command(args[0], args[1:]...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("%s failed: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("%s failed: %w", args[0], err)
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+// AWSProvider reads secrets from AWS Secrets Manager using the aws CLI
+var AWSProvider = CommandProvider{
+	Command: func(name string) []string {
+		return []string{"aws", "secretsmanager", "get-secret-value",
+			"--secret-id", name, "--query", "SecretString", "--output", "text"}
+	},
+}
+
+// GCPProvider reads secrets from GCP Secret Manager using the gcloud CLI.
+// Names may include a version as "name@version"; the default is "latest".
+var GCPProvider = CommandProvider{
+	Command: func(name string) []string {
+		version := "latest"
+		if i := strings.LastIndex(name, "@"); i != -1 {
+			name, version = name[:i], name[i+1:]
+		}
+		return []string{"gcloud", "secrets", "versions", "access", version, "--secret", name}
+	},
+}
+
+// NewProvider returns the provider for a secret reference
+func NewProvider(ref *config.SecretRef) (Provider, error) {
+	switch ref.Provider {
+	case "env":
+		return EnvProvider{}, nil
+	case "file":
+		return FileProvider{}, nil
+	case "vault":
+		return NewVaultProvider(ref.Address), nil
+	case "aws":
+		return AWSProvider, nil
+	case "gcp":
+		return GCPProvider, nil
+	case "keychain":
+		return NewKeychain(), nil
+	default:
+		return nil, fmt.Errorf("unsupported secrets provider: %s", ref.Provider)
+	}
+}
+
+// Resolve fetches the secret a reference points at, picking the configured
+// key out of JSON secrets
+func Resolve(ref *config.SecretRef) (string, error) {
+	provider, err := NewProvider(ref)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := provider.GetSecret(ref.Name)
+	if err != nil {
+		return "", fmt.Errorf("error fetching secret %s: %w", ref.Name, err)
+	}
+
+	if ref.Key == "" {
+		return value, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object: %w", ref.Name, err)
+	}
+
+	field, ok := fields[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %s", ref.Name, ref.Key)
+	}
+
+	return fmt.Sprint(field), nil
+}
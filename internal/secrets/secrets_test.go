@@ -0,0 +1,192 @@
+package secrets
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+func TestResolveEnvAndFile(t *testing.T) {
+	t.Setenv("TEST_SECRET", "env-token")
+
+	value, err := Resolve(&config.SecretRef{Provider: "env", Name: "TEST_SECRET"})
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if value != "env-token" {
+		t.Errorf("Expected 'env-token', got %q", value)
+	}
+
+	if _, err := Resolve(&config.SecretRef{Provider: "env", Name: "TEST_SECRET_MISSING"}); err == nil {
+		t.Error("Expected error for unset variable")
+	}
+
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte(`{"token": "file-token"}`+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write secret file: %v", err)
+	}
+
+	value, err = Resolve(&config.SecretRef{Provider: "file", Name: path, Key: "token"})
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if value != "file-token" {
+		t.Errorf("Expected 'file-token', got %q", value)
+	}
+
+	if _, err := Resolve(&config.SecretRef{Provider: "file", Name: path, Key: "missing"}); err == nil {
+		t.Error("Expected error for missing key")
+	}
+}
+
+func TestVaultProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v1/secret/data/codesync":
+			w.Write([]byte(`{"data": {"data": {"token": "kv2-token"}, "metadata": {"version": 1}}}`))
+		case "/v1/kv/codesync":
+			w.Write([]byte(`{"data": {"token": "kv1-token"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("VAULT_TOKEN", "vault-token")
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"secret/data/codesync", "kv2-token"},
+		{"kv/codesync", "kv1-token"},
+	}
+
+	for _, tt := range tests {
+		value, err := Resolve(&config.SecretRef{Provider: "vault", Name: tt.name, Key: "token", Address: server.URL})
+		if err != nil {
+			t.Fatalf("Resolve(%s) failed: %v", tt.name, err)
+		}
+		if value != tt.expected {
+			t.Errorf("Resolve(%s): expected %q, got %q", tt.name, tt.expected, value)
+		}
+	}
+
+	if _, err := NewVaultProvider(server.URL).GetSecret("secret/data/missing"); err == nil {
+		t.Error("Expected error for missing secret")
+	}
+}
+
+func TestCommandProviders(t *testing.T) {
+	aws := AWSProvider.Command("prod/codesync")
+	if aws[0] != "aws" || aws[4] != "prod/codesync" {
+		t.Errorf("Unexpected aws command: %v", aws)
+	}
+
+	gcp := GCPProvider.Command("codesync-token@3")
+	if gcp[0] != "gcloud" || gcp[4] != "3" || gcp[6] != "codesync-token" {
+		t.Errorf("Unexpected gcloud command: %v", gcp)
+	}
+
+	echo := CommandProvider{Command: func(name string) []string { return []string{"echo", name} }}
+	value, err := echo.GetSecret("hello")
+	if err != nil {
+		t.Fatalf("GetSecret failed: %v", err)
+	}
+	if value != "hello" {
+		t.Errorf("Expected 'hello', got %q", value)
+	}
+}
+
+func TestNewProviderUnsupported(t *testing.T) {
+	if _, err := NewProvider(&config.SecretRef{Provider: "keepass", Name: "x"}); err == nil {
+		t.Error("Expected error for unsupported provider")
+	}
+}
+
+func TestKeychainLogin(t *testing.T) {
+	stored := map[string]string{}
+	var calls []string
+	k := &Keychain{
+		Service: "codesync",
+		OS:      "linux",
+		Logins:  filepath.Join(t.TempDir(), "codesync", "logins"),
+		run: func(input string, args ...string) (string, error) {
+			calls = append(calls, args[1])
+			account := args[len(args)-1]
+			switch args[1] {
+			case "store":
+				stored[account] = input
+				return "", nil
+			case "lookup":
+				return stored[account], nil
+			}
+			return "", fmt.Errorf("unexpected command %v", args)
+		},
+	}
+
+	token, err := k.LoginToken("github.com")
+	if err != nil || token != "" {
+		t.Fatalf("Expected no token before login, got %q, %v", token, err)
+	}
+	if len(calls) != 0 {
+		t.Errorf("Expected the keychain not to be queried before login, got %v", calls)
+	}
+
+	if err := k.Login("github.com", "gho_token"); err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if err := k.Login("github.com", "gho_token2"); err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+
+	token, err = k.LoginToken("github.com")
+	if err != nil {
+		t.Fatalf("LoginToken failed: %v", err)
+	}
+	if token != "gho_token2" {
+		t.Errorf("Expected gho_token2, got %q", token)
+	}
+
+	data, err := os.ReadFile(k.Logins)
+	if err != nil {
+		t.Fatalf("Failed to read logins: %v", err)
+	}
+	if string(data) != "github.com\n" {
+		t.Errorf("Expected one recorded host, got %q", data)
+	}
+}
+
+func TestKeychainDarwin(t *testing.T) {
+	var input string
+	k := &Keychain{
+		Service: "codesync",
+		OS:      "darwin",
+		run: func(in string, args ...string) (string, error) {
+			input = in
+			return "", nil
+		},
+	}
+
+	if err := k.SetSecret("github.com", `to"ken`); err != nil {
+		t.Fatalf("SetSecret failed: %v", err)
+	}
+	expected := `add-generic-password -U -s "codesync" -a "github.com" -w "to\"ken"` + "\n"
+	if input != expected {
+		t.Errorf("Expected %q on stdin, got %q", expected, input)
+	}
+
+	if _, err := (&Keychain{Service: "codesync", OS: "plan9"}).GetSecret("github.com"); err == nil {
+		t.Error("Expected error for an unsupported OS")
+	}
+}
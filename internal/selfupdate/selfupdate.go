@@ -0,0 +1,238 @@
+// Package selfupdate replaces the running codesync binary with the latest
+// release. Releases publish a binary per platform, named like
+// codesync-Linux-x86_64, with an Ed25519 signature of it in <name>.sig; a
+// binary is only installed if its signature verifies against the release key
+// built into the running binary.
+package selfupdate
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/version"
+)
+
+// DefaultAPIURL is where releases are looked up
+const DefaultAPIURL = "https://api.github.com"
+
+// DefaultRepository publishes the releases
+const DefaultRepository = "exitflynn/codesync"
+
+// ReleaseKey is the base64 Ed25519 public key releases are signed with, set
+// at build time with
+// -ldflags "-X github.com/exitflynn/codesync/internal/selfupdate.ReleaseKey=...".
+// Without it, binaries can't be verified and self-update refuses to run.
+var ReleaseKey = ""
+
+// ErrNoReleaseKey is returned by builds without a release key
+var ErrNoReleaseKey = errors.New("this build has no release signing key, so updates can't be verified; download a release instead")
+
+// Options configures an update
+type Options struct {
+	APIURL     string       // Default: DefaultAPIURL
+	Repository string       // owner/repo; default: DefaultRepository
+	Executable string       // Binary to replace; default: the running one
+	Client     *http.Client // Default: a client with a 5 minute timeout
+	CheckOnly  bool         // Only look up the latest release
+}
+
+// Result describes an update
+type Result struct {
+	Current   string // Version of the running binary
+	Latest    string // Latest release
+	Available bool   // Whether the latest release is newer
+	Updated   bool   // Whether the binary was replaced
+}
+
+// asset is a file attached to a release
+type asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+type release struct {
+	Tag    string  `json:"tag_name"`
+	Assets []asset `json:"assets"`
+}
+
+// Update installs the latest release over the executable if it is newer than
+// the running version
+func Update(opts Options) (*Result, error) {
+	if opts.APIURL == "" {
+		opts.APIURL = DefaultAPIURL
+	}
+	if opts.Repository == "" {
+		opts.Repository = DefaultRepository
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 5 * time.Minute}
+	}
+
+	latest, err := latestRelease(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Development builds are always replaced by a release
+	result := &Result{
+		Current:   version.Version,
+		Latest:    latest.Tag,
+		Available: !version.Release() || version.Compare(latest.Tag, version.Version) > 0,
+	}
+	if !result.Available || opts.CheckOnly {
+		return result, nil
+	}
+
+	key, err := releaseKey()
+	if err != nil {
+		return nil, err
+	}
+
+	name := AssetName(runtime.GOOS, runtime.GOARCH)
+	binary, err := download(opts.Client, latest, name)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := download(opts.Client, latest, name+".sig")
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature of %s: %w", name, err)
+	}
+	if !ed25519.Verify(key, binary, signature) {
+		return nil, fmt.Errorf("signature of %s %s doesn't match the release key", name, latest.Tag)
+	}
+
+	exe := opts.Executable
+	if exe == "" {
+		if exe, err = os.Executable(); err != nil {
+			return nil, fmt.Errorf("failed to find the running binary: %w", err)
+		}
+		if exe, err = filepath.EvalSymlinks(exe); err != nil {
+			return nil, fmt.Errorf("failed to find the running binary: %w", err)
+		}
+	}
+	if err := replace(exe, binary); err != nil {
+		return nil, err
+	}
+
+	result.Updated = true
+	return result, nil
+}
+
+// AssetName returns the name of the release binary for a platform, which
+// follows uname: codesync-Linux-x86_64, codesync-Darwin-arm64 and so on
+func AssetName(goos, goarch string) string {
+	system := map[string]string{"linux": "Linux", "darwin": "Darwin", "windows": "Windows", "freebsd": "FreeBSD"}[goos]
+	if system == "" {
+		system = goos
+	}
+
+	machine := goarch
+	switch {
+	case goarch == "amd64":
+		machine = "x86_64"
+	case goarch == "386":
+		machine = "i386"
+	case goarch == "arm64" && goos == "linux":
+		machine = "aarch64"
+	}
+
+	name := "codesync-" + system + "-" + machine
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+func releaseKey() (ed25519.PublicKey, error) {
+	if ReleaseKey == "" {
+		return nil, ErrNoReleaseKey
+	}
+	key, err := base64.StdEncoding.DecodeString(ReleaseKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid release key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// latestRelease looks up the latest published release
+func latestRelease(opts Options) (*release, error) {
+	url := strings.TrimSuffix(opts.APIURL, "/") + "/repos/" + opts.Repository + "/releases/latest"
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := opts.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up the latest release: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error looking up the latest release: received status code %d", resp.StatusCode)
+	}
+
+	var latest release
+	if err := json.NewDecoder(resp.Body).Decode(&latest); err != nil {
+		return nil, fmt.Errorf("error decoding release: %w", err)
+	}
+	return &latest, nil
+}
+
+// download fetches an asset of a release
+func download(client *http.Client, r *release, name string) ([]byte, error) {
+	for _, a := range r.Assets {
+		if a.Name != name {
+			continue
+		}
+		resp, err := client.Get(a.URL)
+		if err != nil {
+			return nil, fmt.Errorf("error downloading %s: %w", name, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("error downloading %s: received status code %d", name, resp.StatusCode)
+		}
+		return io.ReadAll(resp.Body)
+	}
+	return nil, fmt.Errorf("release %s has no %s", r.Tag, name)
+}
+
+// replace swaps the executable for a new binary. The binary is written next
+// to it first, so the executable is never left half-written.
+func replace(exe string, binary []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".codesync-update-*")
+	if err != nil {
+		return fmt.Errorf("failed to write the update: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write the update: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write the update: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return fmt.Errorf("failed to write the update: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", exe, err)
+	}
+	return nil
+}
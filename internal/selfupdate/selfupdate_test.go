@@ -0,0 +1,118 @@
+package selfupdate
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/version"
+)
+
+// releaseServer publishes a release of binary signed with key
+func releaseServer(t *testing.T, tag string, binary []byte, key ed25519.PrivateKey) *httptest.Server {
+	t.Helper()
+	name := AssetName(runtime.GOOS, runtime.GOARCH)
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, binary))
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/acme/codesync/releases/latest":
+			fmt.Fprintf(w, `{"tag_name": %q, "assets": [
+				{"name": %q, "browser_download_url": "%s/download/bin"},
+				{"name": %q, "browser_download_url": "%s/download/sig"}
+			]}`, tag, name, server.URL, name+".sig", server.URL)
+		case "/download/bin":
+			w.Write(binary)
+		case "/download/sig":
+			fmt.Fprintln(w, signature)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func setVersions(t *testing.T, current string, key ed25519.PublicKey) {
+	oldVersion, oldKey := version.Version, ReleaseKey
+	t.Cleanup(func() { version.Version, ReleaseKey = oldVersion, oldKey })
+	version.Version = current
+	ReleaseKey = base64.StdEncoding.EncodeToString(key)
+}
+
+func TestUpdate(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(nil)
+	setVersions(t, "v1.0.0", public)
+	server := releaseServer(t, "v1.1.0", []byte("new binary"), private)
+
+	exe := filepath.Join(t.TempDir(), "codesync")
+	if err := os.WriteFile(exe, []byte("old binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{APIURL: server.URL, Repository: "acme/codesync", Executable: exe}
+
+	opts.CheckOnly = true
+	result, err := Update(opts)
+	if err != nil || !result.Available || result.Updated {
+		t.Fatalf("Expected a newer release to be reported, got %+v, %v", result, err)
+	}
+
+	opts.CheckOnly = false
+	if result, err = Update(opts); err != nil || !result.Updated || result.Latest != "v1.1.0" {
+		t.Fatalf("Expected an update, got %+v, %v", result, err)
+	}
+	if got, _ := os.ReadFile(exe); string(got) != "new binary" {
+		t.Errorf("Expected the binary to be replaced, got %q", got)
+	}
+
+	version.Version = "v1.1.0"
+	if result, err = Update(opts); err != nil || result.Available || result.Updated {
+		t.Errorf("Expected no update to the same version, got %+v, %v", result, err)
+	}
+}
+
+func TestAssetName(t *testing.T) {
+	for _, tt := range [][3]string{
+		{"linux", "amd64", "codesync-Linux-x86_64"},
+		{"linux", "arm64", "codesync-Linux-aarch64"},
+		{"darwin", "arm64", "codesync-Darwin-arm64"},
+		{"windows", "amd64", "codesync-Windows-x86_64.exe"},
+	} {
+		if got := AssetName(tt[0], tt[1]); got != tt[2] {
+			t.Errorf("AssetName(%s, %s) = %s, want %s", tt[0], tt[1], got, tt[2])
+		}
+	}
+}
+
+func TestUpdateRejectsBadSignatures(t *testing.T) {
+	public, _, _ := ed25519.GenerateKey(nil)
+	_, other, _ := ed25519.GenerateKey(nil)
+	setVersions(t, "v1.0.0", public)
+	server := releaseServer(t, "v1.1.0", []byte("tampered binary"), other)
+
+	exe := filepath.Join(t.TempDir(), "codesync")
+	if err := os.WriteFile(exe, []byte("old binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{APIURL: server.URL, Repository: "acme/codesync", Executable: exe}
+
+	if _, err := Update(opts); err == nil {
+		t.Fatal("Expected a binary signed with another key to be refused")
+	}
+	if got, _ := os.ReadFile(exe); string(got) != "old binary" {
+		t.Errorf("Expected the binary to be kept, got %q", got)
+	}
+
+	ReleaseKey = ""
+	if _, err := Update(opts); !errors.Is(err, ErrNoReleaseKey) {
+		t.Errorf("Expected builds without a release key to refuse, got %v", err)
+	}
+}
@@ -0,0 +1,308 @@
+package structured
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SyncJSON copies the values at the selected paths from upstream into local.
+// Everything else in local, including its formatting, is left untouched. A
+// selected key missing locally is added to its parent object.
+func SyncJSON(local, upstream []byte, selectors []string) ([]byte, error) {
+	paths, err := parsePaths(selectors)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(local) {
+		return nil, fmt.Errorf("local file is not valid JSON")
+	}
+	if !json.Valid(upstream) {
+		return nil, fmt.Errorf("upstream file is not valid JSON")
+	}
+
+	out := local
+	for _, path := range paths {
+		start, end, err := findJSON(upstream, path)
+		if err != nil {
+			return nil, &notFoundError{path: path, doc: "upstream"}
+		}
+		value := upstream[start:end]
+
+		out, err = replaceJSON(out, path, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+// SelectJSON returns the selected values of a document in a canonical form,
+// so that changes outside the selection can be ignored
+func SelectJSON(data []byte, selectors []string) (string, error) {
+	paths, err := parsePaths(selectors)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, path := range paths {
+		sb.WriteString(path.String() + "=")
+		if start, end, err := findJSON(data, path); err == nil {
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, data[start:end]); err != nil {
+				return "", err
+			}
+			sb.Write(compact.Bytes())
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
+// replaceJSON splices value into data at path, re-indenting it to fit
+func replaceJSON(data []byte, path Path, value []byte) ([]byte, error) {
+	start, end, err := findJSON(data, path)
+	if err == nil {
+		indented := reindentJSON(value, lineIndent(data, start), indentUnit(data))
+		return splice(data, start, end, indented), nil
+	}
+
+	// Add a missing key to its parent object
+	last := path[len(path)-1]
+	if last.Key == "" {
+		return nil, &notFoundError{path: path, doc: "local"}
+	}
+	pstart, pend, err := findJSON(data, path[:len(path)-1])
+	if err != nil || data[pstart] != '{' {
+		return nil, &notFoundError{path: path, doc: "local"}
+	}
+
+	key, _ := json.Marshal(last.Key)
+	closing := pend - 1
+	inner := bytes.TrimSpace(data[pstart+1 : closing])
+	parentIndent := lineIndent(data, pstart)
+	unit := indentUnit(data)
+
+	// Match the layout of the parent: one member per line or all on one line
+	multiline := bytes.Contains(data[pstart:pend], []byte("\n")) || len(inner) == 0 && unit != ""
+	var member []byte
+	if multiline {
+		memberIndent := parentIndent + unit
+		member = []byte("\n" + memberIndent + string(key) + ": " + string(reindentJSON(value, memberIndent, unit)))
+	} else {
+		member = []byte(" " + string(key) + ": " + string(value))
+	}
+
+	// Insert after the last member, keeping any whitespace before the brace
+	insertAt := closing
+	for insertAt > pstart+1 && isSpace(data[insertAt-1]) {
+		insertAt--
+	}
+	if len(inner) > 0 {
+		member = append([]byte(","), member...)
+	} else if multiline {
+		member = append(member, []byte("\n"+parentIndent)...)
+	} else {
+		member = append(member, ' ')
+	}
+
+	return splice(data, insertAt, insertAt, member), nil
+}
+
+// findJSON returns the byte range of the value at path
+func findJSON(data []byte, path Path) (int, int, error) {
+	s := &jsonScanner{data: data}
+	s.skipSpace()
+	start := s.pos
+
+	for _, seg := range path {
+		s.pos = start
+		found := false
+
+		if seg.Key != "" {
+			if !s.consume('{') {
+				return 0, 0, errNotFound
+			}
+			for s.skipSpace(); !s.consume('}'); {
+				keyStart := s.pos
+				if err := s.skipValue(); err != nil {
+					return 0, 0, err
+				}
+				var key string
+				if err := json.Unmarshal(data[keyStart:s.pos], &key); err != nil {
+					return 0, 0, err
+				}
+				s.skipSpace()
+				if !s.consume(':') {
+					return 0, 0, fmt.Errorf("expected : at offset %d", s.pos)
+				}
+				s.skipSpace()
+				if key == seg.Key {
+					start, found = s.pos, true
+					break
+				}
+				if err := s.skipValue(); err != nil {
+					return 0, 0, err
+				}
+				s.skipSpace()
+				s.consume(',')
+				s.skipSpace()
+			}
+		} else {
+			if !s.consume('[') {
+				return 0, 0, errNotFound
+			}
+			for i := 0; ; i++ {
+				s.skipSpace()
+				if s.consume(']') {
+					break
+				}
+				if i == seg.Index {
+					start, found = s.pos, true
+					break
+				}
+				if err := s.skipValue(); err != nil {
+					return 0, 0, err
+				}
+				s.skipSpace()
+				s.consume(',')
+			}
+		}
+
+		if !found {
+			return 0, 0, errNotFound
+		}
+	}
+
+	s.pos = start
+	if err := s.skipValue(); err != nil {
+		return 0, 0, err
+	}
+	return start, s.pos, nil
+}
+
+var errNotFound = errors.New("not found")
+
+// jsonScanner skips over JSON values in valid input
+type jsonScanner struct {
+	data []byte
+	pos  int
+}
+
+func (s *jsonScanner) skipSpace() {
+	for s.pos < len(s.data) && isSpace(s.data[s.pos]) {
+		s.pos++
+	}
+}
+
+func (s *jsonScanner) consume(c byte) bool {
+	if s.pos < len(s.data) && s.data[s.pos] == c {
+		s.pos++
+		return true
+	}
+	return false
+}
+
+func (s *jsonScanner) skipValue() error {
+	if s.pos >= len(s.data) {
+		return fmt.Errorf("unexpected end of JSON")
+	}
+
+	switch s.data[s.pos] {
+	case '"':
+		for s.pos++; s.pos < len(s.data); s.pos++ {
+			switch s.data[s.pos] {
+			case '\\':
+				s.pos++
+			case '"':
+				s.pos++
+				return nil
+			}
+		}
+		return fmt.Errorf("unterminated string")
+	case '{', '[':
+		depth := 0
+		for ; s.pos < len(s.data); s.pos++ {
+			switch s.data[s.pos] {
+			case '"':
+				if err := s.skipValue(); err != nil {
+					return err
+				}
+				s.pos--
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					s.pos++
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("unterminated %c", s.data[s.pos-1])
+	default:
+		for s.pos < len(s.data) && !isSpace(s.data[s.pos]) && !strings.ContainsRune(",]}", rune(s.data[s.pos])) {
+			s.pos++
+		}
+		return nil
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// lineIndent returns the leading whitespace of the line containing offset
+func lineIndent(data []byte, offset int) string {
+	lineStart := bytes.LastIndexByte(data[:offset], '\n') + 1
+	end := lineStart
+	for end < len(data) && (data[end] == ' ' || data[end] == '\t') {
+		end++
+	}
+	return string(data[lineStart:end])
+}
+
+// indentUnit guesses the indentation step of a document from its first
+// indented line, or returns an empty string for single-line documents
+func indentUnit(data []byte) string {
+	for _, line := range bytes.Split(data, []byte("\n"))[1:] {
+		trimmed := bytes.TrimLeft(line, " \t")
+		if len(trimmed) < len(line) && len(trimmed) > 0 {
+			return string(line[:len(line)-len(trimmed)])
+		}
+	}
+	return ""
+}
+
+// reindentJSON formats a value for insertion at a given indentation. Scalars
+// and single-line values are kept as they are.
+func reindentJSON(value []byte, prefix, unit string) []byte {
+	if !bytes.Contains(value, []byte("\n")) || unit == "" {
+		return value
+	}
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, compactJSON(value), prefix, unit); err != nil {
+		return value
+	}
+	return out.Bytes()
+}
+
+func compactJSON(value []byte) []byte {
+	var out bytes.Buffer
+	if err := json.Compact(&out, value); err != nil {
+		return value
+	}
+	return out.Bytes()
+}
+
+func splice(data []byte, start, end int, value []byte) []byte {
+	out := make([]byte, 0, len(data)-(end-start)+len(value))
+	out = append(out, data[:start]...)
+	out = append(out, value...)
+	return append(out, data[end:]...)
+}
@@ -0,0 +1,109 @@
+// Package structured syncs selected keys of JSON and YAML documents, leaving
+// the rest of the local document as it is
+package structured
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Segment is one step of a path: an object key, or an array index when Key
+// is empty
+type Segment struct {
+	Key   string
+	Index int
+}
+
+// Path selects a value in a document
+type Path []Segment
+
+func (p Path) String() string {
+	var sb strings.Builder
+	sb.WriteString("$")
+	for _, seg := range p {
+		if seg.Key == "" {
+			fmt.Fprintf(&sb, "[%d]", seg.Index)
+		} else if strings.ContainsAny(seg.Key, ".[]") {
+			fmt.Fprintf(&sb, "[%q]", seg.Key)
+		} else {
+			sb.WriteString("." + seg.Key)
+		}
+	}
+	return sb.String()
+}
+
+// ParsePath parses a selector such as $.dependencies.react, scripts.build,
+// $.servers[0].url or $["key.with.dots"]. The leading $ is optional.
+func ParsePath(s string) (Path, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(s), "$")
+
+	var path Path
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("invalid path %q: unclosed [", s)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+
+			if key, err := strconv.Unquote(inner); err == nil {
+				path = append(path, Segment{Key: key})
+				continue
+			}
+			if strings.HasPrefix(inner, "'") && strings.HasSuffix(inner, "'") && len(inner) >= 2 {
+				path = append(path, Segment{Key: inner[1 : len(inner)-1]})
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("invalid path %q: bad index [%s]", s, inner)
+			}
+			path = append(path, Segment{Index: index})
+			continue
+		}
+
+		end := strings.IndexAny(rest, ".[")
+		if end == -1 {
+			end = len(rest)
+		}
+		if end == 0 {
+			return nil, fmt.Errorf("invalid path %q: empty key", s)
+		}
+		path = append(path, Segment{Key: rest[:end]})
+		rest = rest[end:]
+	}
+
+	if len(path) == 0 {
+		return nil, fmt.Errorf("invalid path %q: selects the whole document", s)
+	}
+
+	return path, nil
+}
+
+// parsePaths parses a list of selectors
+func parsePaths(selectors []string) ([]Path, error) {
+	paths := make([]Path, 0, len(selectors))
+	for _, s := range selectors {
+		p, err := ParsePath(s)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+// notFoundError reports a path missing from a document
+type notFoundError struct {
+	path Path
+	doc  string
+}
+
+func (e *notFoundError) Error() string {
+	return fmt.Sprintf("%s not found in %s document", e.path, e.doc)
+}
@@ -0,0 +1,153 @@
+package structured
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"$.dependencies.react", "$.dependencies.react"},
+		{"scripts.build", "$.scripts.build"},
+		{"$.servers[0].url", "$.servers[0].url"},
+		{`$["key.with.dots"].x`, `$["key.with.dots"].x`},
+		{"$['quoted']", "$.quoted"},
+	}
+
+	for _, tt := range tests {
+		path, err := ParsePath(tt.in)
+		if err != nil {
+			t.Errorf("ParsePath(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if path.String() != tt.want {
+			t.Errorf("ParsePath(%q) = %s, want %s", tt.in, path, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"$", "", "a..b", "a[x]", "a[0"} {
+		if _, err := ParsePath(bad); err == nil {
+			t.Errorf("Expected ParsePath(%q) to fail", bad)
+		}
+	}
+}
+
+func TestSyncJSON(t *testing.T) {
+	local := `{
+  // not JSON, so the local file is rejected
+}`
+	if _, err := SyncJSON([]byte(local), []byte(`{}`), []string{"a"}); err == nil {
+		t.Error("Expected invalid local JSON to fail")
+	}
+
+	local = `{
+  "name": "my-app",
+  "version": "0.1.0",
+  "engines": {"node": ">=16"},
+  "scripts": {
+    "test": "jest"
+  }
+}
+`
+	upstream := `{"name":"template","engines":{"node":">=20","npm":">=9"},"scripts":{"lint":"eslint ."},"license":"MIT"}`
+
+	got, err := SyncJSON([]byte(local), []byte(upstream), []string{"$.engines.node", "$.scripts.lint", "license"})
+	if err != nil {
+		t.Fatalf("SyncJSON failed: %v", err)
+	}
+
+	want := `{
+  "name": "my-app",
+  "version": "0.1.0",
+  "engines": {"node": ">=20"},
+  "scripts": {
+    "test": "jest",
+    "lint": "eslint ."
+  },
+  "license": "MIT"
+}
+`
+	if string(got) != want {
+		t.Errorf("Unexpected result:\n%s\nwant:\n%s", got, want)
+	}
+
+	if _, err := SyncJSON([]byte(local), []byte(upstream), []string{"$.missing"}); err == nil || !strings.Contains(err.Error(), "upstream") {
+		t.Errorf("Expected missing upstream key to fail, got %v", err)
+	}
+}
+
+func TestSyncJSONReindentsObjects(t *testing.T) {
+	local := "{\n    \"config\": {\n        \"a\": 1\n    }\n}\n"
+	upstream := "{\n  \"config\": {\n    \"a\": 2,\n    \"b\": [1, 2]\n  }\n}\n"
+
+	got, err := SyncJSON([]byte(local), []byte(upstream), []string{"config"})
+	if err != nil {
+		t.Fatalf("SyncJSON failed: %v", err)
+	}
+
+	want := "{\n    \"config\": {\n        \"a\": 2,\n        \"b\": [\n            1,\n            2\n        ]\n    }\n}\n"
+	if string(got) != want {
+		t.Errorf("Unexpected result:\n%s", got)
+	}
+}
+
+func TestSelectJSON(t *testing.T) {
+	a, _ := SelectJSON([]byte(`{"keep": 1, "x": {"y": [1, 2]}}`), []string{"x.y"})
+	b, _ := SelectJSON([]byte("{\n  \"keep\": 2,\n  \"x\": {\"y\": [1,2]}\n}"), []string{"x.y"})
+	if a != b {
+		t.Errorf("Expected changes outside the selection to be ignored: %q != %q", a, b)
+	}
+
+	c, _ := SelectJSON([]byte(`{"x": {"y": [1, 3]}}`), []string{"x.y"})
+	if a == c {
+		t.Error("Expected changes inside the selection to be seen")
+	}
+}
+
+func TestSyncYAML(t *testing.T) {
+	local := `# Local settings
+name: my-service
+image:
+  repository: example/app # pinned by us
+  tag: "1.0"
+resources:
+  limits:
+    cpu: 500m
+`
+	upstream := `name: template
+image:
+  repository: example/base
+  tag: "1.2"
+probes:
+  path: /healthz
+`
+
+	got, err := SyncYAML([]byte(local), []byte(upstream), []string{"$.image.tag", "probes"})
+	if err != nil {
+		t.Fatalf("SyncYAML failed: %v", err)
+	}
+
+	want := `# Local settings
+name: my-service
+image:
+  repository: example/app # pinned by us
+  tag: "1.2"
+resources:
+  limits:
+    cpu: 500m
+probes:
+  path: /healthz
+`
+	if string(got) != want {
+		t.Errorf("Unexpected result:\n%s\nwant:\n%s", got, want)
+	}
+
+	a, _ := SelectYAML([]byte(local), []string{"image.tag"})
+	b, _ := SelectYAML(got, []string{"image.tag"})
+	if a == b {
+		t.Error("Expected the selected value to differ after syncing")
+	}
+}
@@ -0,0 +1,158 @@
+package structured
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SyncYAML copies the values at the selected paths from upstream into local.
+// Comments and key order in local are kept, though the document is
+// re-encoded, so unusual spacing may be normalized. A selected key missing
+// locally is added to its parent mapping.
+func SyncYAML(local, upstream []byte, selectors []string) ([]byte, error) {
+	paths, err := parsePaths(selectors)
+	if err != nil {
+		return nil, err
+	}
+
+	var localDoc, upstreamDoc yaml.Node
+	if err := yaml.Unmarshal(local, &localDoc); err != nil {
+		return nil, fmt.Errorf("error parsing local YAML: %w", err)
+	}
+	if err := yaml.Unmarshal(upstream, &upstreamDoc); err != nil {
+		return nil, fmt.Errorf("error parsing upstream YAML: %w", err)
+	}
+
+	for _, path := range paths {
+		value := findYAML(&upstreamDoc, path)
+		if value == nil {
+			return nil, &notFoundError{path: path, doc: "upstream"}
+		}
+
+		if target := findYAML(&localDoc, path); target != nil {
+			// Keep comments attached to the local value
+			head, line, foot := target.HeadComment, target.LineComment, target.FootComment
+			*target = *value
+			if value.HeadComment == "" {
+				target.HeadComment = head
+			}
+			if value.LineComment == "" {
+				target.LineComment = line
+			}
+			if value.FootComment == "" {
+				target.FootComment = foot
+			}
+			continue
+		}
+
+		last := path[len(path)-1]
+		parent := findYAML(&localDoc, path[:len(path)-1])
+		if last.Key == "" || parent == nil || parent.Kind != yaml.MappingNode {
+			return nil, &notFoundError{path: path, doc: "local"}
+		}
+		parent.Content = append(parent.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: last.Key},
+			value,
+		)
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(yamlIndent(local))
+	if err := enc.Encode(&localDoc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// SelectYAML returns the selected values of a document in a canonical form,
+// so that changes outside the selection can be ignored
+func SelectYAML(data []byte, selectors []string) (string, error) {
+	paths, err := parsePaths(selectors)
+	if err != nil {
+		return "", err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, path := range paths {
+		sb.WriteString(path.String() + "=")
+		if node := findYAML(&doc, path); node != nil {
+			var value interface{}
+			if err := node.Decode(&value); err != nil {
+				return "", err
+			}
+			out, err := yaml.Marshal(value)
+			if err != nil {
+				return "", err
+			}
+			sb.Write(out)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
+// findYAML returns the node at path, or nil
+func findYAML(doc *yaml.Node, path Path) *yaml.Node {
+	node := doc
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return nil
+		}
+		node = node.Content[0]
+	}
+
+	for _, seg := range path {
+		for node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+
+		switch {
+		case seg.Key != "" && node.Kind == yaml.MappingNode:
+			var next *yaml.Node
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == seg.Key {
+					next = node.Content[i+1]
+					break
+				}
+			}
+			if next == nil {
+				return nil
+			}
+			node = next
+		case seg.Key == "" && node.Kind == yaml.SequenceNode:
+			if seg.Index >= len(node.Content) {
+				return nil
+			}
+			node = node.Content[seg.Index]
+		default:
+			return nil
+		}
+	}
+
+	return node
+}
+
+// yamlIndent guesses the indentation width of a document, defaulting to two
+// spaces
+func yamlIndent(data []byte) int {
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if n := len(line) - len(trimmed); n > 0 && trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			return n
+		}
+	}
+	return 2
+}
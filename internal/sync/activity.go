@@ -0,0 +1,52 @@
+package sync
+
+import (
+	"sort"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/github"
+)
+
+// maxUpstreamChanges is how many upstream changes an item's state remembers
+// to learn how often its upstream changes
+const maxUpstreamChanges = 10
+
+// observeActivity records the upstream commits a sync found, newest first.
+// Commits found by earlier syncs, such as those of an item that conflicted,
+// aren't counted again.
+func (s *State) observeActivity(commits []github.CommitInfo) {
+	var latest time.Time
+	if len(s.UpstreamChanges) > 0 {
+		latest = s.UpstreamChanges[0]
+	}
+
+	var changes []time.Time
+	for _, commit := range commits {
+		if commit.Timestamp.After(latest) {
+			changes = append(changes, commit.Timestamp.UTC())
+		}
+	}
+	if len(changes) == 0 {
+		s.QuietSyncs++
+		return
+	}
+
+	s.QuietSyncs = 0
+	s.UpstreamChanges = append(changes, s.UpstreamChanges...)
+	sort.Slice(s.UpstreamChanges, func(i, j int) bool {
+		return s.UpstreamChanges[i].After(s.UpstreamChanges[j])
+	})
+	if len(s.UpstreamChanges) > maxUpstreamChanges {
+		s.UpstreamChanges = s.UpstreamChanges[:maxUpstreamChanges]
+	}
+}
+
+// ChangeInterval returns the average time between the upstream changes the
+// state remembers, or zero if it knows fewer than two
+func (s State) ChangeInterval() time.Duration {
+	n := len(s.UpstreamChanges)
+	if n < 2 {
+		return 0
+	}
+	return s.UpstreamChanges[0].Sub(s.UpstreamChanges[n-1]) / time.Duration(n-1)
+}
@@ -0,0 +1,41 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/github"
+)
+
+func TestObserveActivity(t *testing.T) {
+	now := time.Date(2025, 3, 14, 10, 0, 0, 0, time.UTC)
+	var state State
+
+	state.observeActivity([]github.CommitInfo{
+		{SHA: "c", Timestamp: now.Add(-time.Hour)},
+		{SHA: "b", Timestamp: now.Add(-2 * time.Hour)},
+		{SHA: "a", Timestamp: now.Add(-4 * time.Hour)},
+	})
+	if got := state.ChangeInterval(); got != 90*time.Minute {
+		t.Errorf("Expected changes 90 minutes apart on average, got %v", got)
+	}
+
+	// An item that conflicted finds the same commits again
+	state.observeActivity([]github.CommitInfo{{SHA: "c", Timestamp: now.Add(-time.Hour)}})
+	state.observeActivity(nil)
+	if state.QuietSyncs != 2 || len(state.UpstreamChanges) != 3 {
+		t.Errorf("Expected two quiet syncs and no new changes, got %+v", state)
+	}
+
+	state.observeActivity([]github.CommitInfo{{SHA: "d", Timestamp: now}})
+	if state.QuietSyncs != 0 || !state.UpstreamChanges[0].Equal(now) {
+		t.Errorf("Expected a new change to end the quiet syncs, got %+v", state)
+	}
+
+	for i := range 20 {
+		state.observeActivity([]github.CommitInfo{{Timestamp: now.Add(time.Duration(i+1) * time.Minute)}})
+	}
+	if len(state.UpstreamChanges) != maxUpstreamChanges {
+		t.Errorf("Expected the latest %d changes to be kept, got %d", maxUpstreamChanges, len(state.UpstreamChanges))
+	}
+}
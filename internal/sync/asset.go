@@ -0,0 +1,99 @@
+package sync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+// assetHash returns the content hash of an asset. Assets are binary, so they
+// are compared by hash rather than diffed.
+func assetHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// largeAssetSize is the size from which assets are fingerprinted from their
+// metadata rather than downloaded to tell whether they changed
+const largeAssetSize = 8 << 20
+
+// assetFingerprint returns a hash that changes with the content of an
+// upstream asset, without downloading it: the SHA-256 of a Git LFS object,
+// which is what assetHash returns for its content, or the size and strong
+// entity tag of a large raw file. It returns false if the asset has to be
+// downloaded to hash it.
+func (sm *SyncManager) assetFingerprint(item config.SyncItem, ref string) (string, bool) {
+	statter, ok := sm.source(item).(FileStatter)
+	if !ok {
+		return "", false
+	}
+	stat, err := statter.StatFile(item.Source.Owner, item.Source.Repo, item.Source.Path, ref)
+	if err != nil {
+		return "", false
+	}
+
+	switch {
+	case stat.SHA256 != "":
+		return stat.SHA256, true
+	case stat.Size >= largeAssetSize && stat.ETag != "" && !strings.HasPrefix(stat.ETag, "W/"):
+		// Weak entity tags don't promise the same bytes
+		return fmt.Sprintf("%d:%s", stat.Size, stat.ETag), true
+	}
+	return "", false
+}
+
+// downloadAsset downloads an asset that was fingerprinted, once it has to be
+// written
+func (sm *SyncManager) downloadAsset(item config.SyncItem, ref string) (string, error) {
+	statter, ok := sm.source(item).(FileStatter)
+	if !ok {
+		return "", fmt.Errorf("provider can't download raw files")
+	}
+	content, err := statter.GetRawFile(item.Source.Owner, item.Source.Repo, item.Source.Path, ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to download asset: %w", err)
+	}
+	return sm.applyTransform(item, string(content))
+}
+
+// processAsset runs an asset item's process commands over the fetched
+// content and returns the result. Each command edits the file named by
+// $ASSET in place; the file has the target's extension so tools like svgo
+// recognize it.
+func processAsset(item config.SyncItem, content string) (string, error) {
+	if len(item.Target.Process) == 0 {
+		return content, nil
+	}
+
+	dir, err := os.MkdirTemp("", "codesync-asset-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "asset"+filepath.Ext(item.Target.Path))
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return "", fmt.Errorf("failed to write asset: %w", err)
+	}
+
+	for _, command := range item.Target.Process {
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Env = append(os.Environ(), "ASSET="+path)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return "", fmt.Errorf("process command '%s' failed: %w: %s", command, err, bytes.TrimSpace(out))
+		}
+	}
+
+	processed, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read processed asset: %w", err)
+	}
+	return string(processed), nil
+}
@@ -0,0 +1,115 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+	"github.com/exitflynn/codesync/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestProcessAsset(t *testing.T) {
+	item := config.SyncItem{
+		Target: config.SyncTarget{
+			Path:    "assets/logo.svg",
+			Type:    "asset",
+			Process: []string{`case "$ASSET" in *.svg) ;; *) exit 1;; esac`, `tr -d ' ' < "$ASSET" > "$ASSET.tmp" && mv "$ASSET.tmp" "$ASSET"`},
+		},
+	}
+
+	got, err := processAsset(item, "<svg> <path/> </svg>")
+	if err != nil {
+		t.Fatalf("processAsset failed: %v", err)
+	}
+	if got != "<svg><path/></svg>" {
+		t.Errorf("Unexpected processed asset: %q", got)
+	}
+
+	item.Target.Process = []string{"echo broken >&2; exit 1"}
+	if _, err := processAsset(item, "<svg/>"); err == nil {
+		t.Error("Expected failing process command to be reported")
+	}
+
+	if assetHash("a") == assetHash("b") {
+		t.Error("Expected different content to hash differently")
+	}
+}
+
+// statProvider serves an asset that is fingerprinted from its metadata
+type statProvider struct {
+	*mocks.MockGitHubClient
+	stat      github.FileStat
+	content   string
+	downloads int
+}
+
+func (p *statProvider) StatFile(owner, repo, path, ref string) (*github.FileStat, error) {
+	stat := p.stat
+	return &stat, nil
+}
+
+func (p *statProvider) GetRawFile(owner, repo, path, ref string) ([]byte, error) {
+	p.downloads++
+	return []byte(p.content), nil
+}
+
+func TestLargeAssetIsOnlyDownloadedWhenItChanges(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	item := config.SyncItem{
+		Name:   "model",
+		Source: config.SyncSource{Owner: "acme", Repo: "ml", Path: "model.bin", Branch: "main"},
+		Target: config.SyncTarget{Path: "model.bin", Type: "asset"},
+	}
+	writeTestFile(t, item.Target.Path, "old weights")
+
+	mock := mocks.NewMockGitHubClient(gomock.NewController(t))
+	for i, since := range []string{"c0", "c1", "c2"} {
+		commit := github.CommitInfo{SHA: fmt.Sprintf("c%d", i+1)}
+		mock.EXPECT().GetCommitsSince("acme", "ml", "model.bin", "main", time.Time{}, since).
+			Return([]github.CommitInfo{commit}, nil)
+	}
+	source := &statProvider{
+		MockGitHubClient: mock,
+		stat:             github.FileStat{Size: 300 << 20, ETag: `"v1"`},
+		content:          "new weights",
+	}
+
+	cfg := &config.Config{Version: "1.0", Items: []config.SyncItem{item}}
+	sm, err := NewSyncManager(cfg, t.TempDir(), WithProvider(config.ProviderGitHub, source))
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	if err := sm.saveState(item.Name, State{LastCommitID: "c0", CurrentLocalHash: assetHash("old weights")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sm.SyncItem(item); err != nil {
+		t.Fatalf("First sync failed: %v", err)
+	}
+	if content, _ := os.ReadFile(item.Target.Path); string(content) != "new weights" || source.downloads != 1 {
+		t.Fatalf("Expected the changed asset to be downloaded and written, got %q after %d downloads", content, source.downloads)
+	}
+
+	// A commit that leaves the asset alone doesn't download it
+	report, err := sm.SyncItem(item)
+	if err != nil {
+		t.Fatalf("Second sync failed: %v", err)
+	}
+	if source.downloads != 1 || len(report.UpdatedFiles) != 0 || report.State.LastCommitID != "c2" {
+		t.Errorf("Expected the unchanged asset to be skipped, got %d downloads and %+v", source.downloads, report.State)
+	}
+
+	source.stat.ETag = `"v2"`
+	source.content = "newer weights"
+	if _, err := sm.SyncItem(item); err != nil {
+		t.Fatalf("Third sync failed: %v", err)
+	}
+	if content, _ := os.ReadFile(item.Target.Path); string(content) != "newer weights" || source.downloads != 2 {
+		t.Errorf("Expected the changed asset to be downloaded again, got %q after %d downloads", content, source.downloads)
+	}
+}
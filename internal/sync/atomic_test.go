@@ -0,0 +1,59 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+func TestWriteTarget(t *testing.T) {
+	t.Chdir(t.TempDir())
+	sm := newTestManager(t)
+
+	item := config.SyncItem{
+		Name:   "deploy",
+		Source: config.SyncSource{Owner: "acme", Repo: "tools", Path: "deploy.sh", Branch: "main"},
+		Target: config.SyncTarget{Path: "scripts/deploy.sh", Type: "file"},
+	}
+	writeTestFile(t, "scripts/deploy.sh", "#!/bin/sh\n")
+	if err := os.Chmod("scripts/deploy.sh", 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("scripts/deploy.sh", "deploy.sh"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The executable bit survives an update
+	if err := sm.updateLocalFile(item, "#!/bin/sh\necho new\n"); err != nil {
+		t.Fatalf("updateLocalFile failed: %v", err)
+	}
+	if info, err := os.Stat("scripts/deploy.sh"); err != nil || info.Mode().Perm() != 0750 {
+		t.Errorf("Expected the file to keep mode 0750, got %v, %v", info.Mode(), err)
+	}
+
+	// A symlinked target stays a symlink to the updated file
+	item.Target.Path = "deploy.sh"
+	item.Target.Mode = "0700"
+	if err := sm.updateLocalFile(item, "#!/bin/sh\necho newer\n"); err != nil {
+		t.Fatalf("updateLocalFile failed: %v", err)
+	}
+	if info, err := os.Lstat("deploy.sh"); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Expected the symlink to stay, got %v, %v", info.Mode(), err)
+	}
+	if content, _ := os.ReadFile("scripts/deploy.sh"); string(content) != "#!/bin/sh\necho newer\n" {
+		t.Errorf("Expected the linked file to be updated, got %q", content)
+	}
+	if info, err := os.Stat("scripts/deploy.sh"); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("Expected the configured mode 0700, got %v, %v", info.Mode(), err)
+	}
+
+	// Nothing is left behind
+	if entries, _ := os.ReadDir("scripts"); len(entries) != 1 {
+		t.Errorf("Expected only the target in its directory, got %v", entries)
+	}
+	if matches, _ := filepath.Glob(".*codesync-*"); len(matches) != 0 {
+		t.Errorf("Expected no temporary files, got %v", matches)
+	}
+}
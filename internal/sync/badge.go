@@ -0,0 +1,76 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+// Badge is a shields.io endpoint badge describing an item's freshness. See
+// https://shields.io/badges/endpoint-badge.
+type Badge struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color"`
+}
+
+// ItemBadge returns the badge for an item given its stored state, which is
+// nil if the item has never been synced
+func ItemBadge(item config.SyncItem, state *State) Badge {
+	badge := Badge{SchemaVersion: 1, Label: item.Name}
+
+	switch {
+	case item.Disabled:
+		badge.Message, badge.Color = "disabled", "lightgrey"
+	case state == nil:
+		badge.Message, badge.Color = "not synced", "lightgrey"
+	case state.HasLocalChanges && state.HasRemoteChanges:
+		badge.Message, badge.Color = "conflict", "orange"
+	case state.Failing:
+		badge.Message, badge.Color = "sync failing", "red"
+	case state.HasRemoteChanges && state.CommitsBehind == 1:
+		badge.Message, badge.Color = "1 commit behind", "yellow"
+	case state.HasRemoteChanges && state.CommitsBehind > 1:
+		badge.Message, badge.Color = fmt.Sprintf("%d commits behind", state.CommitsBehind), "yellow"
+	case state.HasRemoteChanges:
+		badge.Message, badge.Color = "behind", "yellow"
+	default:
+		badge.Message, badge.Color = "up to date", "brightgreen"
+	}
+
+	return badge
+}
+
+// Badge returns the badge for a configured item
+func (sm *SyncManager) Badge(item config.SyncItem) Badge {
+	state, err := sm.ItemState(item.Name)
+	if err != nil {
+		return ItemBadge(item, nil)
+	}
+	return ItemBadge(item, &state)
+}
+
+// WriteBadges writes the badge of every item to <dir>/<item>.json, for
+// serving from a static site or committing next to a README
+func (sm *SyncManager) WriteBadges(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create badge directory: %w", err)
+	}
+
+	for _, item := range sm.Items() {
+		data, err := json.Marshal(sm.Badge(item))
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, sanitizeFilename(item.Name)+".json")
+		if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+			return fmt.Errorf("failed to write badge: %w", err)
+		}
+	}
+
+	return nil
+}
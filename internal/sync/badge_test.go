@@ -0,0 +1,74 @@
+package sync
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+func TestItemBadge(t *testing.T) {
+	item := config.SyncItem{Name: "logger"}
+
+	tests := []struct {
+		name    string
+		item    config.SyncItem
+		state   *State
+		message string
+		color   string
+	}{
+		{"never synced", item, nil, "not synced", "lightgrey"},
+		{"disabled", config.SyncItem{Name: "logger", Disabled: true}, &State{}, "disabled", "lightgrey"},
+		{"up to date", item, &State{}, "up to date", "brightgreen"},
+		{"one behind", item, &State{HasRemoteChanges: true, CommitsBehind: 1}, "1 commit behind", "yellow"},
+		{"several behind", item, &State{HasRemoteChanges: true, CommitsBehind: 4}, "4 commits behind", "yellow"},
+		{"behind unknown", item, &State{HasRemoteChanges: true}, "behind", "yellow"},
+		{"conflict", item, &State{HasRemoteChanges: true, HasLocalChanges: true}, "conflict", "orange"},
+		{"failing", item, &State{Failing: true}, "sync failing", "red"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			badge := ItemBadge(tt.item, tt.state)
+			if badge.SchemaVersion != 1 || badge.Label != "logger" {
+				t.Errorf("Unexpected badge header: %+v", badge)
+			}
+			if badge.Message != tt.message || badge.Color != tt.color {
+				t.Errorf("Expected %q/%q, got %q/%q", tt.message, tt.color, badge.Message, badge.Color)
+			}
+		})
+	}
+}
+
+func TestWriteBadges(t *testing.T) {
+	sm, err := NewSyncManager(&config.Config{
+		Version:     "1.0",
+		GitHubToken: "test-token",
+		Items:       []config.SyncItem{{Name: "team/logger"}},
+	}, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	if err := sm.saveState("team/logger", State{HasRemoteChanges: true, CommitsBehind: 2}); err != nil {
+		t.Fatalf("saveState failed: %v", err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "badges")
+	if err := sm.WriteBadges(dir); err != nil {
+		t.Fatalf("WriteBadges failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, sanitizeFilename("team/logger")+".json"))
+	if err != nil {
+		t.Fatalf("Badge not written: %v", err)
+	}
+	var badge Badge
+	if err := json.Unmarshal(data, &badge); err != nil {
+		t.Fatalf("Invalid badge JSON: %v", err)
+	}
+	if badge.Message != "2 commits behind" {
+		t.Errorf("Unexpected badge: %+v", badge)
+	}
+}
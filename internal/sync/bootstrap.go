@@ -0,0 +1,68 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+// goPackageClause matches the package clause of a Go file
+var goPackageClause = regexp.MustCompile(`(?m)^package\s+(\w+)`)
+
+// bootstrapFile returns a minimal valid file for a function target that
+// doesn't exist yet, with the function appended. Go files get the package
+// of their siblings, or one named after their directory.
+func bootstrapFile(item config.SyncItem, absPath, function string) (string, error) {
+	header := fmt.Sprintf("Synced from %s/%s/%s by codesync.", item.Source.Owner, item.Source.Repo, item.Source.Path)
+
+	var content string
+	switch item.Target.Language {
+	case "go":
+		content = fmt.Sprintf("// %s\n\npackage %s\n", header, goPackageName(absPath))
+	case "python":
+		content = fmt.Sprintf("\"\"\"%s\"\"\"\n", header)
+	case "javascript":
+		content = fmt.Sprintf("// %s\n", header)
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedLanguage, item.Target.Language)
+	}
+
+	return content + "\n" + strings.TrimRight(function, "\n") + "\n", nil
+}
+
+// goPackageName picks the package of a new Go file: that of another Go file
+// in the same directory, or else the directory's name
+func goPackageName(absPath string) string {
+	dir := filepath.Dir(absPath)
+	siblings, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, sibling := range siblings {
+		if strings.HasSuffix(sibling, "_test.go") {
+			continue
+		}
+		content, err := os.ReadFile(sibling)
+		if err != nil {
+			continue
+		}
+		if m := goPackageClause.FindSubmatch(content); m != nil {
+			return string(m[1])
+		}
+	}
+
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return -1
+	}, filepath.Base(dir))
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return "main"
+	}
+	return name
+}
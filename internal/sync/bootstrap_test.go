@@ -0,0 +1,62 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdateLocalFunctionBootstrap(t *testing.T) {
+	t.Chdir(t.TempDir())
+	sm := newTestManager(t)
+	item := functionItem("")
+	remote := "package strings\n\n" + trimAll
+
+	if err := sm.updateLocalFunction(item, remote); err == nil {
+		t.Fatal("Expected a missing target to fail without bootstrap")
+	}
+
+	item.Target.Bootstrap = true
+	if changed, _, err := sm.checkLocalChanges(item, ""); err != nil || changed {
+		t.Errorf("Expected a missing bootstrap target to be unchanged, got %v, %v", changed, err)
+	}
+	if err := sm.updateLocalFunction(item, remote); err != nil {
+		t.Fatalf("updateLocalFunction failed: %v", err)
+	}
+
+	content, err := os.ReadFile(item.Target.Path)
+	if err != nil {
+		t.Fatalf("Expected the target to be created: %v", err)
+	}
+	if !strings.Contains(string(content), "\npackage util\n") || !strings.HasSuffix(string(content), trimAll) {
+		t.Errorf("Unexpected bootstrapped file:\n%s", content)
+	}
+
+	// An existing file is updated as before
+	if err := sm.updateLocalFunction(item, remote); err != nil {
+		t.Fatalf("updateLocalFunction failed on the bootstrapped file: %v", err)
+	}
+}
+
+func TestBootstrapFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "text", "case.go"), "// Package strutil ...\npackage strutil\n")
+	item := functionItem("")
+
+	content, err := bootstrapFile(item, filepath.Join(dir, "text", "trim.go"), trimAll)
+	if err != nil || !strings.Contains(content, "\npackage strutil\n") {
+		t.Errorf("Expected the package of the other files, got %q, %v", content, err)
+	}
+
+	if name := goPackageName(filepath.Join(dir, "My-Lib", "trim.go")); name != "mylib" {
+		t.Errorf("Expected a package named after the directory, got %s", name)
+	}
+
+	item.Target.Language = "python"
+	content, err = bootstrapFile(item, filepath.Join(dir, "trim.py"), "def trim():\n    pass\n")
+	want := "\"\"\"Synced from acme/utils/strings.go by codesync.\"\"\"\n\ndef trim():\n    pass\n"
+	if err != nil || content != want {
+		t.Errorf("Expected %q, got %q, %v", want, content, err)
+	}
+}
@@ -0,0 +1,468 @@
+package sync
+
+import (
+	"archive/tar"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+	"github.com/klauspost/compress/zstd"
+)
+
+// bundleVersion is the version of the bundle format CreateBundle writes
+const bundleVersion = 1
+
+// Names in bundles
+const (
+	bundleDataName      = "bundle.json"
+	bundleSignatureName = "bundle.sig"
+)
+
+// defaultBundleKeyEnv holds the private key bundles are signed with, unless
+// bundles.privateKeyEnv names another variable
+const defaultBundleKeyEnv = "CODESYNC_BUNDLE_KEY"
+
+// Bundle holds the upstream content that syncing its items needs, fetched by
+// CreateBundle where the sources can be reached, so that ApplyBundle can sync
+// them where they can't. Content is keyed by the provider calls that return
+// it.
+type Bundle struct {
+	Version     int                                    `json:"version"`
+	Created     time.Time                              `json:"created"`
+	Items       []string                               `json:"items"`                 // Names of the items the bundle syncs
+	Commits     map[string]BundledCommits              `json:"commits"`               // By source and ref
+	Files       map[string]*github.FileInfo            `json:"files,omitempty"`       // By source and commit
+	Directories map[string]map[string]*github.FileInfo `json:"directories,omitempty"` // By source directory and commit
+	Diffs       map[string]string                      `json:"diffs,omitempty"`       // By source and commits compared
+	Releases    map[string][]*github.ReleaseInfo       `json:"releases,omitempty"`    // By repository
+	Notes       map[string]*github.ReleaseInfo         `json:"notes,omitempty"`       // Release of a tag, by repository and tag
+	Functions   map[string]string                      `json:"functions,omitempty"`   // Extracted by plugin providers, by hash of their input
+
+	mu sync.Mutex // Serializes recording by items synced at once
+}
+
+// BundledCommits are the upstream commits of a source after the one its item
+// last synced where the bundle was created
+type BundledCommits struct {
+	Since   string              `json:"since,omitempty"`
+	Commits []github.CommitInfo `json:"commits"` // Newest first
+}
+
+// GenerateBundleKey returns a new base64 Ed25519 key pair for signing bundles
+func GenerateBundleKey() (publicKey, privateKey string, err error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(public), base64.StdEncoding.EncodeToString(private), nil
+}
+
+// CreateBundle fetches what syncing the named items, or every enabled item
+// if there are none, needs from upstream and writes it to w as a signed
+// bundle for ApplyBundle. Nothing is written to the targets or state. The
+// commits are listed since the ones in this workspace's state, so a bundle
+// only applies to workspaces that last synced those commits or later ones it
+// includes. It must not run while items sync.
+func (sm *SyncManager) CreateBundle(w io.Writer, names []string) (*Bundle, error) {
+	key, err := sm.bundlePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, ok := sm.Item(name); !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownItem, name)
+		}
+		wanted[name] = true
+	}
+
+	bundle := newBundle(sm.Now().UTC())
+	sm.recording = bundle
+	defer func() { sm.recording = nil }()
+
+	for _, item := range sm.Items() {
+		if item.Disabled || (len(wanted) > 0 && !wanted[item.Name]) {
+			continue
+		}
+		if err := sm.fetchForBundle(item); err != nil {
+			return nil, fmt.Errorf("item %s: %s", item.Name, sm.redactor.String(err.Error()))
+		}
+		bundle.Items = append(bundle.Items, item.Name)
+	}
+
+	data, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal bundle: %w", err)
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, data))
+
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	tw := tar.NewWriter(zw)
+	if err := writeExportEntry(tw, bundleDataName, 0644, data); err != nil {
+		return nil, err
+	}
+	if err := writeExportEntry(tw, bundleSignatureName, 0644, []byte(signature)); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// newBundle returns an empty bundle for provider calls to be recorded in
+func newBundle(created time.Time) *Bundle {
+	return &Bundle{
+		Version:     bundleVersion,
+		Created:     created,
+		Commits:     make(map[string]BundledCommits),
+		Files:       make(map[string]*github.FileInfo),
+		Directories: make(map[string]map[string]*github.FileInfo),
+		Diffs:       make(map[string]string),
+		Releases:    make(map[string][]*github.ReleaseInfo),
+		Notes:       make(map[string]*github.ReleaseInfo),
+		Functions:   make(map[string]string),
+	}
+}
+
+// fetchForBundle makes the provider calls that syncing an item makes, so
+// that they are recorded in the bundle being created
+func (sm *SyncManager) fetchForBundle(item config.SyncItem) error {
+	state, err := sm.loadState(item.Name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	report := &SyncReport{}
+
+	item, err = sm.resolveRelease(item, &state, report)
+	if err != nil {
+		return err
+	}
+	_, _, _, commitID, err := sm.checkRemoteChanges(item, state.LastCommitID, report)
+	if err != nil {
+		return err
+	}
+	if item.Target.Type == "directory" && commitID != "" && commitID != state.LastCommitID {
+		if _, err := sm.getDirectory(item, commitID); err != nil {
+			return fmt.Errorf("failed to get directory: %w", err)
+		}
+	}
+	if item.Changelog {
+		sm.releaseNotes(item, report)
+	}
+	return nil
+}
+
+// ApplyBundle verifies a bundle written by CreateBundle against the
+// configured public key and syncs its items from it, as SyncItems does from
+// their sources. Items the bundle doesn't cover the state of fail, as do
+// syncs that need content the bundle doesn't have.
+func (sm *SyncManager) ApplyBundle(r io.Reader) (*Bundle, []*SyncReport, error) {
+	bundle, err := sm.readBundle(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sm.replaying = bundle
+	defer func() { sm.replaying = nil }()
+	reports, err := sm.SyncItems(bundle.Items)
+	return bundle, reports, err
+}
+
+// readBundle reads a bundle and checks its signature
+func (sm *SyncManager) readBundle(r io.Reader) (*Bundle, error) {
+	if sm.config.Bundles == nil {
+		return nil, fmt.Errorf("bundles aren't configured: set bundles.publicKey")
+	}
+	// Checked when the config is validated
+	publicKey, err := base64.StdEncoding.DecodeString(sm.config.Bundles.PublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("bundles.publicKey must be a base64 Ed25519 public key")
+	}
+
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+
+	entries := make(map[string][]byte)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("not a codesync bundle: %w", err)
+		}
+		if header.Name != bundleDataName && header.Name != bundleSignatureName {
+			return nil, fmt.Errorf("unexpected bundle entry %s", header.Name)
+		}
+		if entries[header.Name], err = io.ReadAll(tr); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+	}
+
+	data, ok := entries[bundleDataName]
+	if !ok {
+		return nil, fmt.Errorf("not a codesync bundle")
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(entries[bundleSignatureName])))
+	if err != nil || !ed25519.Verify(publicKey, data, signature) {
+		return nil, fmt.Errorf("bundle signature doesn't match bundles.publicKey")
+	}
+
+	var bundle Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	if bundle.Version != bundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", bundle.Version)
+	}
+	return &bundle, nil
+}
+
+// bundlePrivateKey loads the key bundles are signed with from the environment
+func (sm *SyncManager) bundlePrivateKey() (ed25519.PrivateKey, error) {
+	b := sm.config.Bundles
+	if b == nil {
+		return nil, fmt.Errorf("bundles aren't configured: set bundles.publicKey")
+	}
+	env := b.PrivateKeyEnv
+	if env == "" {
+		env = defaultBundleKeyEnv
+	}
+	encoded := os.Getenv(env)
+	if encoded == "" {
+		return nil, fmt.Errorf("%s must hold the private key to sign bundles with", env)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("%s must be a base64 Ed25519 private key", env)
+	}
+
+	private := ed25519.PrivateKey(key)
+	if base64.StdEncoding.EncodeToString(private.Public().(ed25519.PublicKey)) != b.PublicKey {
+		return nil, fmt.Errorf("the private key in %s doesn't match bundles.publicKey", env)
+	}
+	return private, nil
+}
+
+// bundleScope identifies the code host of an item's source, so that sources
+// with the same path on different hosts don't share content in a bundle
+func bundleScope(item config.SyncItem) string {
+	return strings.Join([]string{item.Source.ProviderName(), item.Source.GitHubBaseURL, item.Source.URL}, " ")
+}
+
+// bundleKey names the content of a provider call in a bundle
+func bundleKey(scope string, parts ...string) string {
+	return scope + " " + strings.Join(parts, " ")
+}
+
+// functionKey names a function extracted from content
+func functionKey(scope, content, language, functionName string) string {
+	sum := sha256.Sum256([]byte(language + "\x00" + functionName + "\x00" + content))
+	return bundleKey(scope, hex.EncodeToString(sum[:]))
+}
+
+// record adds a provider call's result to the bundle
+func (b *Bundle) record(add func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	add()
+}
+
+// recordingProvider passes calls on to an item's provider and records the
+// results in the bundle being created
+type recordingProvider struct {
+	source SourceProvider
+	bundle *Bundle
+	scope  string
+}
+
+func (p *recordingProvider) GetFile(owner, repo, path, ref string) (*github.FileInfo, error) {
+	file, err := p.source.GetFile(owner, repo, path, ref)
+	if err == nil {
+		p.bundle.record(func() { p.bundle.Files[bundleKey(p.scope, owner, repo, path, ref)] = file })
+	}
+	return file, err
+}
+
+func (p *recordingProvider) GetDirectory(owner, repo, path, ref string) (map[string]*github.FileInfo, error) {
+	files, err := p.source.GetDirectory(owner, repo, path, ref)
+	if err == nil {
+		p.bundle.record(func() { p.bundle.Directories[bundleKey(p.scope, owner, repo, path, ref)] = files })
+	}
+	return files, err
+}
+
+// GetArchive fetches a directory from an archive if the provider can. Either
+// way the files are replayed as the directory.
+func (p *recordingProvider) GetArchive(owner, repo, path, ref string) (map[string]*github.FileInfo, error) {
+	archiver, ok := p.source.(Archiver)
+	if !ok {
+		return p.GetDirectory(owner, repo, path, ref)
+	}
+	files, err := archiver.GetArchive(owner, repo, path, ref)
+	if err == nil {
+		p.bundle.record(func() { p.bundle.Directories[bundleKey(p.scope, owner, repo, path, ref)] = files })
+	}
+	return files, err
+}
+
+func (p *recordingProvider) GetCommitsSince(owner, repo, path, ref string, since time.Time, sinceCommit string) ([]github.CommitInfo, error) {
+	commits, err := p.source.GetCommitsSince(owner, repo, path, ref, since, sinceCommit)
+	if err == nil {
+		p.bundle.record(func() {
+			p.bundle.Commits[bundleKey(p.scope, owner, repo, path, ref)] = BundledCommits{Since: sinceCommit, Commits: commits}
+		})
+	}
+	return commits, err
+}
+
+func (p *recordingProvider) GetFileDiff(owner, repo, path, baseRef, headRef string) (string, error) {
+	d, err := p.source.GetFileDiff(owner, repo, path, baseRef, headRef)
+	if err == nil {
+		p.bundle.record(func() { p.bundle.Diffs[bundleKey(p.scope, owner, repo, path, baseRef, headRef)] = d })
+	}
+	return d, err
+}
+
+func (p *recordingProvider) ListReleases(owner, repo string) ([]*github.ReleaseInfo, error) {
+	lister, ok := p.source.(ReleaseLister)
+	if !ok {
+		return nil, fmt.Errorf("source provider doesn't list releases")
+	}
+	releases, err := lister.ListReleases(owner, repo)
+	if err == nil {
+		p.bundle.record(func() { p.bundle.Releases[bundleKey(p.scope, owner, repo)] = releases })
+	}
+	return releases, err
+}
+
+func (p *recordingProvider) GetRelease(owner, repo, tag string) (*github.ReleaseInfo, error) {
+	finder, ok := p.source.(ReleaseFinder)
+	if !ok {
+		return nil, fmt.Errorf("source provider doesn't publish releases")
+	}
+	release, err := finder.GetRelease(owner, repo, tag)
+	if err == nil {
+		p.bundle.record(func() { p.bundle.Notes[bundleKey(p.scope, owner, repo, tag)] = release })
+	}
+	return release, err
+}
+
+func (p *recordingProvider) ExtractFunction(content, language, functionName string) (string, error) {
+	extractor, ok := p.source.(FunctionExtractor)
+	if !ok {
+		return github.ExtractFunction(content, language, functionName)
+	}
+	function, err := extractor.ExtractFunction(content, language, functionName)
+	if err == nil {
+		p.bundle.record(func() { p.bundle.Functions[functionKey(p.scope, content, language, functionName)] = function })
+	}
+	return function, err
+}
+
+// bundleProvider replays the calls recorded in a bundle for an item's
+// provider
+type bundleProvider struct {
+	bundle *Bundle
+	scope  string
+}
+
+// missing reports content that isn't in the bundle
+func missing(what string) error {
+	return fmt.Errorf("%s isn't in the bundle: %w", what, ErrNotFound)
+}
+
+func (p *bundleProvider) GetFile(owner, repo, path, ref string) (*github.FileInfo, error) {
+	file, ok := p.bundle.Files[bundleKey(p.scope, owner, repo, path, ref)]
+	if !ok {
+		return nil, missing(fmt.Sprintf("%s/%s/%s@%s", owner, repo, path, ref))
+	}
+	return file, nil
+}
+
+func (p *bundleProvider) GetDirectory(owner, repo, path, ref string) (map[string]*github.FileInfo, error) {
+	files, ok := p.bundle.Directories[bundleKey(p.scope, owner, repo, path, ref)]
+	if !ok {
+		return nil, missing(fmt.Sprintf("directory %s/%s/%s@%s", owner, repo, path, ref))
+	}
+	return files, nil
+}
+
+// GetCommitsSince returns the bundled commits after sinceCommit, which must
+// be the commit the bundle lists them since or one of them
+func (p *bundleProvider) GetCommitsSince(owner, repo, path, ref string, since time.Time, sinceCommit string) ([]github.CommitInfo, error) {
+	bundled, ok := p.bundle.Commits[bundleKey(p.scope, owner, repo, path, ref)]
+	if !ok {
+		return nil, missing(fmt.Sprintf("history of %s/%s/%s@%s", owner, repo, path, ref))
+	}
+	if sinceCommit == bundled.Since {
+		return bundled.Commits, nil
+	}
+	for i, commit := range bundled.Commits {
+		if commit.SHA == sinceCommit {
+			return bundled.Commits[:i], nil
+		}
+	}
+	if sinceCommit == "" {
+		return nil, fmt.Errorf("the bundle only has commits after %s; create it from a workspace that hasn't synced the item", bundled.Since)
+	}
+	return nil, fmt.Errorf("the bundle doesn't cover %s, which was synced last; create it from a workspace that synced that commit or an earlier one", sinceCommit)
+}
+
+func (p *bundleProvider) GetFileDiff(owner, repo, path, baseRef, headRef string) (string, error) {
+	d, ok := p.bundle.Diffs[bundleKey(p.scope, owner, repo, path, baseRef, headRef)]
+	if !ok {
+		return "", missing(fmt.Sprintf("diff of %s/%s/%s %s..%s", owner, repo, path, baseRef, headRef))
+	}
+	return d, nil
+}
+
+func (p *bundleProvider) ListReleases(owner, repo string) ([]*github.ReleaseInfo, error) {
+	releases, ok := p.bundle.Releases[bundleKey(p.scope, owner, repo)]
+	if !ok {
+		return nil, missing(fmt.Sprintf("releases of %s/%s", owner, repo))
+	}
+	return releases, nil
+}
+
+func (p *bundleProvider) GetRelease(owner, repo, tag string) (*github.ReleaseInfo, error) {
+	release, ok := p.bundle.Notes[bundleKey(p.scope, owner, repo, tag)]
+	if !ok {
+		return nil, missing(fmt.Sprintf("release %s of %s/%s", tag, owner, repo))
+	}
+	return release, nil
+}
+
+// ExtractFunction returns what the item's provider extracted when the bundle
+// was created, or extracts the function itself if the provider didn't
+func (p *bundleProvider) ExtractFunction(content, language, functionName string) (string, error) {
+	if function, ok := p.bundle.Functions[functionKey(p.scope, content, language, functionName)]; ok {
+		return function, nil
+	}
+	return github.ExtractFunction(content, language, functionName)
+}
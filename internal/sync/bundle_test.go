@@ -0,0 +1,147 @@
+package sync
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+	"github.com/exitflynn/codesync/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+// newBundleConfig returns a config with a new bundle key pair, whose private
+// key is in the environment
+func newBundleConfig(t *testing.T, item config.SyncItem) *config.Config {
+	t.Helper()
+	public, private, err := GenerateBundleKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(defaultBundleKeyEnv, private)
+	return &config.Config{Version: "1.0", Items: []config.SyncItem{item}, Bundles: &config.BundleConfig{PublicKey: public}}
+}
+
+// newBundleWorkspace changes to a new workspace whose item last synced
+// commit with the local file content
+func newBundleWorkspace(t *testing.T, cfg *config.Config, commit, content string) *SyncManager {
+	t.Helper()
+	t.Chdir(t.TempDir())
+
+	sm, err := NewSyncManager(cfg, t.TempDir(), Offline())
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	item := cfg.Items[0]
+	writeTestFile(t, item.Target.Path, content)
+	_, hash, err := sm.checkLocalChanges(item, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.saveState(item.Name, State{LastCommitID: commit, CurrentLocalHash: hash}); err != nil {
+		t.Fatal(err)
+	}
+	return sm
+}
+
+func TestBundle(t *testing.T) {
+	item := config.SyncItem{
+		Name:   "lib",
+		Source: config.SyncSource{Owner: "acme", Repo: "lib", Path: "lib.go", Branch: "main"},
+		Target: config.SyncTarget{Path: "lib.go", Type: "file"},
+	}
+	cfg := newBundleConfig(t, item)
+
+	// Created where the item last synced c1
+	creator := newBundleWorkspace(t, cfg, "c1", "package lib // 1\n")
+	mock := mocks.NewMockGitHubClient(gomock.NewController(t))
+	mock.EXPECT().GetCommitsSince("acme", "lib", "lib.go", "main", time.Time{}, "c1").
+		Return([]github.CommitInfo{{SHA: "c3"}, {SHA: "c2"}}, nil)
+	mock.EXPECT().GetFile("acme", "lib", "lib.go", "c3").
+		Return(&github.FileInfo{Content: "package lib // 3\n"}, nil)
+	creator.SetProvider(config.ProviderGitHub, mock)
+
+	var buf bytes.Buffer
+	bundle, err := creator.CreateBundle(&buf, nil)
+	if err != nil {
+		t.Fatalf("CreateBundle failed: %v", err)
+	}
+	if len(bundle.Items) != 1 {
+		t.Fatalf("Expected the item to be bundled, got %v", bundle.Items)
+	}
+	if content, _ := os.ReadFile("lib.go"); string(content) != "package lib // 1\n" {
+		t.Error("Expected creating a bundle to leave the target alone")
+	}
+	if state, _ := creator.loadState("lib"); state.LastCommitID != "c1" {
+		t.Errorf("Expected creating a bundle to leave the state alone, got %+v", state)
+	}
+
+	// Applied where the item already synced c2, without a provider
+	applier := newBundleWorkspace(t, cfg, "c2", "package lib // 2\n")
+	_, reports, err := applier.ApplyBundle(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("ApplyBundle failed: %v", err)
+	}
+	if len(reports) != 1 || len(reports[0].Errors) > 0 {
+		t.Fatalf("Expected the item to sync, got %+v", reports)
+	}
+	if len(reports[0].Commits) != 1 || reports[0].Commits[0].SHA != "c3" {
+		t.Errorf("Expected only the commit after c2, got %+v", reports[0].Commits)
+	}
+	if content, _ := os.ReadFile("lib.go"); string(content) != "package lib // 3\n" {
+		t.Errorf("Expected the bundled content, got %q", content)
+	}
+	if state, _ := applier.loadState("lib"); state.LastCommitID != "c3" {
+		t.Errorf("Expected the state to record c3, got %+v", state)
+	}
+
+	// Applying it again finds nothing new
+	_, reports, err = applier.ApplyBundle(bytes.NewReader(buf.Bytes()))
+	if err != nil || len(reports) != 1 || len(reports[0].Errors) > 0 || len(reports[0].UpdatedFiles) > 0 {
+		t.Errorf("Expected a repeated apply to change nothing, got %+v, %v", reports, err)
+	}
+
+	// A workspace the bundle doesn't cover can't sync from it
+	behind := newBundleWorkspace(t, cfg, "c0", "package lib // 0\n")
+	_, reports, _ = behind.ApplyBundle(bytes.NewReader(buf.Bytes()))
+	if len(reports) != 1 || !strings.Contains(strings.Join(reports[0].Errors, "; "), "doesn't cover c0") {
+		t.Errorf("Expected the item to fail, got %+v", reports)
+	}
+	if content, _ := os.ReadFile("lib.go"); string(content) != "package lib // 0\n" {
+		t.Error("Expected the target to stay as it was")
+	}
+}
+
+func TestBundleSignature(t *testing.T) {
+	item := config.SyncItem{
+		Name:   "lib",
+		Source: config.SyncSource{Owner: "acme", Repo: "lib", Path: "lib.go", Branch: "main"},
+		Target: config.SyncTarget{Path: "lib.go", Type: "file"},
+	}
+	cfg := newBundleConfig(t, item)
+	creator := newBundleWorkspace(t, cfg, "c1", "package lib\n")
+	mock := mocks.NewMockGitHubClient(gomock.NewController(t))
+	mock.EXPECT().GetCommitsSince("acme", "lib", "lib.go", "main", time.Time{}, "c1").Return(nil, nil)
+	creator.SetProvider(config.ProviderGitHub, mock)
+
+	var buf bytes.Buffer
+	if _, err := creator.CreateBundle(&buf, nil); err != nil {
+		t.Fatalf("CreateBundle failed: %v", err)
+	}
+
+	// Another key doesn't verify it
+	other := newBundleConfig(t, item)
+	applier := newBundleWorkspace(t, other, "c1", "package lib\n")
+	if _, _, err := applier.ApplyBundle(bytes.NewReader(buf.Bytes())); err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Errorf("Expected the signature to be rejected, got %v", err)
+	}
+
+	// The other private key, now in the environment, can't sign for the
+	// first public key either
+	if _, err := creator.CreateBundle(&bytes.Buffer{}, nil); err == nil || !strings.Contains(err.Error(), "doesn't match") {
+		t.Errorf("Expected the private key to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+// changelogName is the file applied syncs are recorded in
+const changelogName = "CHANGES.codesync.md"
+
+// releaseNotesLimit bounds the release notes copied into a changelog entry
+const releaseNotesLimit = 2000
+
+var htmlCommentPattern = regexp.MustCompile(`(?s)<!--.*?-->`)
+
+const changelogHeader = `# Vendored code changes
+
+This file is maintained by codesync. Each entry records a sync of upstream
+code into this directory.
+`
+
+// changelogPath returns the changelog of an item: in a directory target
+// itself, or else in the directory holding the target. Fan-out targets use
+// the directory above their first wildcard.
+func changelogPath(item config.SyncItem) string {
+	if item.Target.Type == "directory" {
+		return filepath.Join(item.Target.Path, changelogName)
+	}
+	dir := filepath.Dir(item.Target.Path)
+	for strings.ContainsAny(dir, "*?[") {
+		dir = filepath.Dir(dir)
+	}
+	return filepath.Join(dir, changelogName)
+}
+
+// withoutChangelog drops the changelog of an item from the files of its
+// directory target, which codesync writes but upstream doesn't have
+func withoutChangelog(item config.SyncItem, files map[string]string) map[string]string {
+	if item.Changelog {
+		delete(files, changelogName)
+	}
+	return files
+}
+
+// appendChangelog records an applied sync in the item's changelog: when it
+// happened, the upstream commits it brought in and the files it changed
+func appendChangelog(files *workspaceFiles, item config.SyncItem, from, to string, report *SyncReport, now time.Time) error {
+	path := changelogPath(item)
+
+	content, err := files.readFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(content) == 0 {
+		content = []byte(changelogHeader)
+	}
+
+	entry := changelogEntry(item, from, to, report, now)
+	content = append([]byte(strings.TrimRight(string(content), "\n")+"\n\n"), entry...)
+
+	if err := files.mkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return files.writeFile(path, content, 0644)
+}
+
+// changelogEntry renders the changelog entry for a sync
+func changelogEntry(item config.SyncItem, from, to string, report *SyncReport, now time.Time) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "## %s %s\n\n", now.Format("2006-01-02"), item.Name)
+
+	source := fmt.Sprintf("%s/%s/%s", item.Source.Owner, item.Source.Repo, item.Source.Path)
+	if ref := item.Source.Ref(); ref != "" {
+		source += " (" + ref + ")"
+	}
+	if from == "" {
+		fmt.Fprintf(&sb, "Synced %s at %s.\n", source, shortSHA(to))
+	} else {
+		fmt.Fprintf(&sb, "Synced %s from %s to %s.\n", source, shortSHA(from), shortSHA(to))
+	}
+
+	if len(report.Commits) > 0 {
+		sb.WriteString("\n")
+		for _, commit := range report.Commits {
+			subject, _, _ := strings.Cut(commit.Message, "\n")
+			fmt.Fprintf(&sb, "- %s %s", shortSHA(commit.SHA), strings.TrimSpace(subject))
+			if commit.Author != "" {
+				fmt.Fprintf(&sb, " (%s)", commit.Author)
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	if release := report.Release; release != nil && strings.TrimSpace(release.Body) != "" {
+		title := release.Tag
+		if release.Name != "" && release.Name != release.Tag {
+			title += " " + release.Name
+		}
+		fmt.Fprintf(&sb, "\nRelease notes for %s:\n\n%s", title, quoteNotes(release.Body, release.URL))
+	}
+
+	sb.WriteString("\nUpdated files:\n\n")
+	for _, file := range report.UpdatedFiles {
+		fmt.Fprintf(&sb, "- %s", filepath.ToSlash(file))
+		if d, ok := report.Diffs[file]; ok {
+			fmt.Fprintf(&sb, " (+%d -%d)", d.Stats.Added, d.Stats.Removed)
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+// shortSHA abbreviates commit hashes; other revisions, like tags, are kept
+func shortSHA(ref string) string {
+	if len(ref) == 40 && strings.Trim(ref, "0123456789abcdef") == "" {
+		return ref[:7]
+	}
+	return ref
+}
+
+// releaseNotes looks up the upstream release of a pinned revision or tag for the
+// changelog. Release notes are a nice-to-have, so a failed lookup is ignored.
+func (sm *SyncManager) releaseNotes(item config.SyncItem, report *SyncReport) {
+	tag := item.Source.Revision
+	if tag == "" {
+		tag = item.Source.Tag
+	}
+	finder, ok := sm.source(item).(ReleaseFinder)
+	if tag == "" || !ok || report.Release != nil {
+		return
+	}
+	if release, err := finder.GetRelease(item.Source.Owner, item.Source.Repo, tag); err == nil {
+		report.Release = release
+	}
+}
+
+// quoteNotes renders release notes as a blockquote, so their headings don't
+// break up the changelog. HTML comments, often left over from release
+// templates, are dropped and long notes are truncated with a link to the
+// release.
+func quoteNotes(body, url string) string {
+	body = strings.ReplaceAll(body, "\r\n", "\n")
+	body = strings.TrimSpace(htmlCommentPattern.ReplaceAllString(body, ""))
+
+	if len(body) > releaseNotesLimit {
+		cut := releaseNotesLimit
+		if i := strings.LastIndex(body[:cut], "\n"); i > 0 {
+			cut = i
+		}
+		for cut > 0 && !utf8.RuneStart(body[cut]) {
+			cut--
+		}
+		body = strings.TrimSpace(body[:cut]) + "\n\n…"
+		if url != "" {
+			body += " see " + url + " for the full notes"
+		}
+	}
+
+	var sb strings.Builder
+	for _, line := range strings.Split(body, "\n") {
+		if line = strings.TrimRight(line, " \t"); line == "" {
+			sb.WriteString(">\n")
+		} else {
+			sb.WriteString("> " + line + "\n")
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,105 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/diff"
+	"github.com/exitflynn/codesync/internal/github"
+)
+
+func TestChangelogEntry(t *testing.T) {
+	item := config.SyncItem{
+		Name:   "strings",
+		Source: config.SyncSource{Owner: "acme", Repo: "utils", Path: "strings.go", Branch: "main"},
+		Target: config.SyncTarget{Path: "pkg/strings.go", Type: "file"},
+	}
+	report := &SyncReport{
+		UpdatedFiles: []string{"pkg/strings.go"},
+		Diffs:        map[string]*diff.DiffResult{"pkg/strings.go": {Stats: diff.DiffStats{Added: 4, Removed: 1}}},
+		Commits: []github.CommitInfo{
+			{SHA: "2222222bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", Message: "Fix TrimAll\n\nDetails.", Author: "Bob"},
+			{SHA: "1111111aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", Message: "Add TrimAll"},
+		},
+	}
+
+	got := changelogEntry(item, "0000000aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "2222222bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", report, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+	want := `## 2024-05-01 strings
+
+Synced acme/utils/strings.go (main) from 0000000 to 2222222.
+
+- 2222222 Fix TrimAll (Bob)
+- 1111111 Add TrimAll
+
+Updated files:
+
+- pkg/strings.go (+4 -1)
+`
+	if got != want {
+		t.Errorf("Unexpected entry:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestAppendChangelog(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	item := config.SyncItem{
+		Name:   "vpc",
+		Source: config.SyncSource{Owner: "acme", Repo: "modules", Path: "vpc"},
+		Target: config.SyncTarget{Path: "vendor/vpc", Type: "directory"},
+	}
+	report := &SyncReport{UpdatedFiles: []string{"vendor/vpc/main.tf"}}
+
+	if err := appendChangelog(&workspaceFiles{}, item, "", "v1.0.0", report, time.Now()); err != nil {
+		t.Fatalf("appendChangelog failed: %v", err)
+	}
+	if err := appendChangelog(&workspaceFiles{}, item, "v1.0.0", "v1.1.0", report, time.Now()); err != nil {
+		t.Fatalf("appendChangelog failed: %v", err)
+	}
+
+	content, err := os.ReadFile("vendor/vpc/" + changelogName)
+	if err != nil {
+		t.Fatalf("Expected changelog in the target directory: %v", err)
+	}
+	text := string(content)
+	if !strings.HasPrefix(text, "# Vendored code changes") || strings.Count(text, "## ") != 2 {
+		t.Errorf("Unexpected changelog:\n%s", text)
+	}
+	if strings.Index(text, "at v1.0.0") > strings.Index(text, "from v1.0.0 to v1.1.0") {
+		t.Errorf("Expected entries in order:\n%s", text)
+	}
+
+	item.Target = config.SyncTarget{Path: "vendor/retry.go", Type: "file"}
+	if got := changelogPath(item); got != filepath.Join("vendor", changelogName) {
+		t.Errorf("Unexpected changelog path for file target: %s", got)
+	}
+
+	item.Target.Path = "services/*/Dockerfile"
+	if got := changelogPath(item); got != "services/"+changelogName {
+		t.Errorf("Unexpected changelog path for fan-out target: %s", got)
+	}
+}
+
+func TestQuoteNotes(t *testing.T) {
+	got := quoteNotes("## Fixes\r\n\r\n<!-- template -->\r\n- Fixed a leak\r\n", "")
+	if got != "> ## Fixes\n>\n>\n> - Fixed a leak\n" {
+		t.Errorf("Unexpected notes:\n%q", got)
+	}
+
+	long := strings.Repeat("- entry\n", releaseNotesLimit)
+	got = quoteNotes(long, "https://github.com/acme/utils/releases/tag/v2.0.0")
+	if len(got) > releaseNotesLimit*2 || !strings.HasSuffix(got, "> … see https://github.com/acme/utils/releases/tag/v2.0.0 for the full notes\n") {
+		t.Errorf("Expected truncated notes, got %d bytes ending in %q", len(got), got[len(got)-80:])
+	}
+
+	report := &SyncReport{Release: &github.ReleaseInfo{Tag: "v2.0.0", Name: "Spring release", Body: "Faster."}}
+	item := config.SyncItem{Name: "utils", Source: config.SyncSource{Owner: "acme", Repo: "utils", Path: "lib", Revision: "v2.0.0"}}
+	entry := changelogEntry(item, "v1.0.0", "v2.0.0", report, time.Now())
+	if !strings.Contains(entry, "Release notes for v2.0.0 Spring release:\n\n> Faster.\n") {
+		t.Errorf("Expected release notes in entry:\n%s", entry)
+	}
+}
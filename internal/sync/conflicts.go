@@ -0,0 +1,434 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+// conflictsName is where the conflict inbox is stored
+const conflictsName = "conflicts.json"
+
+// ConflictStatus is where a conflict is in triage
+type ConflictStatus string
+
+const (
+	ConflictOpen      ConflictStatus = "open"      // Waiting for someone to look at it
+	ConflictResolved  ConflictStatus = "resolved"  // Settled; the item syncs again
+	ConflictDismissed ConflictStatus = "dismissed" // Ignored until either side changes again
+)
+
+// Conflict is a sync that found changes on both sides which couldn't be
+// merged. The same local and upstream versions of an item always give the
+// same ID, so a conflict is only opened once however often it is found.
+type Conflict struct {
+	ID         string         `json:"id"`
+	Item       string         `json:"item"`
+	Status     ConflictStatus `json:"status"`
+	Message    string         `json:"message"`
+	CommitID   string         `json:"commitId"`           // Upstream commit that conflicts
+	LocalHash  string         `json:"localHash"`          // Local content that conflicts
+	Upstream   string         `json:"upstream,omitempty"` // Upstream content at CommitID, after transforms
+	Detected   time.Time      `json:"detected"`
+	LastSeen   time.Time      `json:"lastSeen"`
+	Closed     time.Time      `json:"closed,omitzero"`
+	Resolution string         `json:"resolution,omitempty"` // "local", "upstream", "synced" or "superseded"
+}
+
+// conflictID derives the ID of a conflict from what conflicts
+func conflictID(itemName, commitID, localHash string) string {
+	sum := sha256.Sum256([]byte(itemName + "\x00" + commitID + "\x00" + localHash))
+	return fmt.Sprintf("%x", sum[:4])
+}
+
+// Conflicts returns the conflicts in the inbox, most recently detected first.
+// Closed conflicts are only included if all is set.
+func (sm *SyncManager) Conflicts(all bool) ([]Conflict, error) {
+	sm.conflictsMu.Lock()
+	defer sm.conflictsMu.Unlock()
+
+	conflicts, err := sm.loadConflicts()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Conflict
+	for _, c := range conflicts {
+		if all || c.Status == ConflictOpen {
+			result = append(result, c)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Detected.After(result[j].Detected)
+	})
+	return result, nil
+}
+
+// Conflict returns the conflict with the given ID, which may be shortened to
+// any unique prefix
+func (sm *SyncManager) Conflict(id string) (Conflict, error) {
+	sm.conflictsMu.Lock()
+	defer sm.conflictsMu.Unlock()
+
+	conflicts, err := sm.loadConflicts()
+	if err != nil {
+		return Conflict{}, err
+	}
+	i, err := findConflict(conflicts, id)
+	if err != nil {
+		return Conflict{}, err
+	}
+	return conflicts[i], nil
+}
+
+// ResolveConflict settles an open conflict. Taking "local" keeps the target
+// as it is, typically after merging both sides by hand, and records it as
+// synced with the conflicting upstream commit. Taking "upstream" overwrites
+// the target with the upstream version, which is supported for file and
+// function targets.
+func (sm *SyncManager) ResolveConflict(id, take string) (Conflict, error) {
+	sm.conflictsMu.Lock()
+	defer sm.conflictsMu.Unlock()
+
+	conflicts, err := sm.loadConflicts()
+	if err != nil {
+		return Conflict{}, err
+	}
+	i, err := findConflict(conflicts, id)
+	if err != nil {
+		return Conflict{}, err
+	}
+	conflict := &conflicts[i]
+	if conflict.Status != ConflictOpen {
+		return Conflict{}, fmt.Errorf("conflict %s is already %s", conflict.ID, conflict.Status)
+	}
+
+	item, ok := sm.Item(conflict.Item)
+	if !ok {
+		return Conflict{}, fmt.Errorf("conflict %s belongs to %s, which is no longer configured", conflict.ID, conflict.Item)
+	}
+	state, err := sm.loadState(item.Name)
+	if err != nil {
+		return Conflict{}, fmt.Errorf("failed to load state of %s: %w", item.Name, err)
+	}
+
+	switch take {
+	case "local":
+	case "upstream":
+		if err := sm.takeUpstream(item, conflict.Upstream); err != nil {
+			return Conflict{}, err
+		}
+		if err := sm.saveSnapshot(item.Name, conflict.Upstream); err != nil {
+			return Conflict{}, err
+		}
+	default:
+		return Conflict{}, fmt.Errorf("unknown side %q: take local or upstream", take)
+	}
+
+	_, localHash, err := sm.checkLocalChanges(item, "")
+	if err != nil {
+		return Conflict{}, err
+	}
+	state.LastCommitID = conflict.CommitID
+	state.CurrentLocalHash = localHash
+	state.HasLocalChanges = false
+	state.HasRemoteChanges = false
+	state.CommitsBehind = 0
+	if err := sm.saveState(item.Name, state); err != nil {
+		return Conflict{}, err
+	}
+
+	conflict.Status = ConflictResolved
+	conflict.Resolution = take
+	conflict.Closed = sm.Now()
+	return *conflict, sm.saveConflicts(conflicts)
+}
+
+// takeUpstream overwrites an item's target with upstream content
+func (sm *SyncManager) takeUpstream(item config.SyncItem, upstream string) error {
+	if upstream == "" {
+		return fmt.Errorf("the upstream version of %s wasn't recorded", item.Name)
+	}
+	switch {
+	case item.Target.Type == "function":
+		return sm.updateLocalFunction(item, upstream)
+	case item.Target.Type == "file" && !item.Target.Structured() && !isNotebook(item):
+		return sm.updateLocalFile(item, upstream)
+	default:
+		return fmt.Errorf("%s targets can't take the upstream version; merge by hand and take local", item.Target.Type)
+	}
+}
+
+// DismissConflict closes an open conflict without changing the item. It
+// stays dismissed while the same versions conflict; a new change on either
+// side opens a new conflict.
+func (sm *SyncManager) DismissConflict(id string) (Conflict, error) {
+	sm.conflictsMu.Lock()
+	defer sm.conflictsMu.Unlock()
+
+	conflicts, err := sm.loadConflicts()
+	if err != nil {
+		return Conflict{}, err
+	}
+	i, err := findConflict(conflicts, id)
+	if err != nil {
+		return Conflict{}, err
+	}
+	if conflicts[i].Status != ConflictOpen {
+		return Conflict{}, fmt.Errorf("conflict %s is already %s", conflicts[i].ID, conflicts[i].Status)
+	}
+
+	conflicts[i].Status = ConflictDismissed
+	conflicts[i].Closed = sm.Now()
+	return conflicts[i], sm.saveConflicts(conflicts)
+}
+
+// recordConflict adds a conflict found by a sync to the inbox, or updates it
+// if it was found before. It reports whether the conflict is newly open, so
+// that notifiers hear about each conflict once.
+func (sm *SyncManager) recordConflict(item config.SyncItem, localHash, commitID, upstream, message string) (Conflict, bool, error) {
+	sm.conflictsMu.Lock()
+	defer sm.conflictsMu.Unlock()
+
+	conflicts, err := sm.loadConflicts()
+	if err != nil {
+		return Conflict{}, false, err
+	}
+
+	now := sm.Now()
+	id := conflictID(item.Name, commitID, localHash)
+
+	// A change on either side supersedes the item's earlier conflicts
+	for i := range conflicts {
+		if c := &conflicts[i]; c.Item == item.Name && c.ID != id && c.Status == ConflictOpen {
+			c.Status = ConflictResolved
+			c.Resolution = "superseded"
+			c.Closed = now
+		}
+	}
+
+	opened := true
+	for i := range conflicts {
+		c := &conflicts[i]
+		if c.ID != id {
+			continue
+		}
+		c.LastSeen = now
+		c.Message = message
+		// A conflict resolved as local but back again has to be looked at again
+		opened = c.Status == ConflictResolved
+		if opened {
+			c.Status = ConflictOpen
+			c.Closed = time.Time{}
+			c.Resolution = ""
+		}
+		return *c, opened, sm.saveConflicts(conflicts)
+	}
+
+	conflict := Conflict{
+		ID:        id,
+		Item:      item.Name,
+		Status:    ConflictOpen,
+		Message:   message,
+		CommitID:  commitID,
+		LocalHash: localHash,
+		Upstream:  upstream,
+		Detected:  now,
+		LastSeen:  now,
+	}
+	return conflict, opened, sm.saveConflicts(append(conflicts, conflict))
+}
+
+// closeConflicts resolves the open conflicts of an item that synced cleanly,
+// e.g. because the local change was reverted
+func (sm *SyncManager) closeConflicts(itemName string) error {
+	sm.conflictsMu.Lock()
+	defer sm.conflictsMu.Unlock()
+
+	conflicts, err := sm.loadConflicts()
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for i := range conflicts {
+		if conflicts[i].Item == itemName && conflicts[i].Status == ConflictOpen {
+			conflicts[i].Status = ConflictResolved
+			conflicts[i].Resolution = "synced"
+			conflicts[i].Closed = sm.Now()
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return sm.saveConflicts(conflicts)
+}
+
+// findConflict returns the index of the conflict whose ID starts with id
+func findConflict(conflicts []Conflict, id string) (int, error) {
+	found := -1
+	for i, c := range conflicts {
+		if id != "" && strings.HasPrefix(c.ID, id) {
+			if found >= 0 {
+				return -1, fmt.Errorf("conflict ID %s is ambiguous", id)
+			}
+			found = i
+		}
+	}
+	if found < 0 {
+		return -1, fmt.Errorf("no conflict %s", id)
+	}
+	return found, nil
+}
+
+func (sm *SyncManager) loadConflicts() ([]Conflict, error) {
+	data, err := sm.store.read(conflictsName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read conflicts: %w", err)
+	}
+
+	var conflicts []Conflict
+	if err := json.Unmarshal(data, &conflicts); err != nil {
+		return nil, fmt.Errorf("invalid conflicts file: %w", err)
+	}
+	return conflicts, nil
+}
+
+func (sm *SyncManager) saveConflicts(conflicts []Conflict) error {
+	data, err := json.MarshalIndent(conflicts, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := sm.store.write(conflictsName, data); err != nil {
+		return fmt.Errorf("failed to write conflicts: %w", err)
+	}
+	return nil
+}
+
+// backupsDir holds copies of local files that a sync overwrote
+const backupsDir = "backups"
+
+// Backup is a copy of an item's target files that a sync overwrote with
+// upstream's changes
+type Backup struct {
+	Name    string       `json:"name"`
+	Item    string       `json:"item"`
+	Created time.Time    `json:"created"`
+	Files   []BackupFile `json:"files"`
+}
+
+// BackupFile is a target file as a backup kept it
+type BackupFile struct {
+	Path    string      `json:"path"` // As the item's target names it
+	Mode    fs.FileMode `json:"mode"`
+	Content []byte      `json:"content"`
+}
+
+// backupName names where a backup is stored
+func backupName(name string) string {
+	return backupsDir + "/" + name + ".json"
+}
+
+// backupTarget copies the target files of an item into a new backup in the
+// state directory, before upstream's changes overwrite the local ones, and
+// returns the backup's name. Backups are stored like the rest of the state,
+// so they're encrypted with it.
+func (sm *SyncManager) backupTarget(item config.SyncItem, state State) (string, error) {
+	files, err := syncedFiles(item, state)
+	if err != nil {
+		return "", err
+	}
+	backup := Backup{
+		Name:    sanitizeFilename(item.Name) + "-" + sm.Now().UTC().Format(runIDFormat),
+		Item:    item.Name,
+		Created: sm.Now(),
+	}
+	for _, file := range files {
+		path := filepath.FromSlash(file)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		backup.Files = append(backup.Files, BackupFile{Path: file, Mode: info.Mode().Perm(), Content: content})
+	}
+
+	data, err := json.Marshal(backup)
+	if err != nil {
+		return "", err
+	}
+	if err := sm.store.write(backupName(backup.Name), data); err != nil {
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+	return backup.Name, nil
+}
+
+// Backups returns the names of the backups in the state directory, oldest
+// first within each item
+func (sm *SyncManager) Backups() ([]string, error) {
+	entries, err := os.ReadDir(sm.store.path(backupsDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), ".json"); ok && !entry.IsDir() {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// LoadBackup reads a backup from the state directory
+func (sm *SyncManager) LoadBackup(name string) (*Backup, error) {
+	if !filepath.IsLocal(name) || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid backup name: %s", name)
+	}
+	data, err := sm.store.read(backupName(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup %s: %w", name, err)
+	}
+	var backup Backup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return nil, fmt.Errorf("invalid backup %s: %w", name, err)
+	}
+	return &backup, nil
+}
+
+// RestoreBackup writes the files of a backup back to where they were and
+// returns their paths. It doesn't change the item's state, so the next sync
+// sees them as local changes.
+func (sm *SyncManager) RestoreBackup(name string) ([]string, error) {
+	backup, err := sm.LoadBackup(name)
+	if err != nil {
+		return nil, err
+	}
+	var restored []string
+	for _, file := range backup.Files {
+		path := absPath(filepath.FromSlash(file.Path))
+		if err := sm.files.mkdirAll(filepath.Dir(path), 0755); err != nil {
+			return restored, err
+		}
+		if err := sm.files.writeFileMode(path, file.Content, file.Mode); err != nil {
+			return restored, fmt.Errorf("failed to restore %s: %w", file.Path, err)
+		}
+		restored = append(restored, file.Path)
+	}
+	return restored, nil
+}
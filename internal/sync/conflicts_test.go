@@ -0,0 +1,186 @@
+package sync
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+	"github.com/exitflynn/codesync/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func conflictingManager(t *testing.T) (*SyncManager, config.SyncItem) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+
+	item := config.SyncItem{
+		Name:   "logger",
+		Source: config.SyncSource{Owner: "acme", Repo: "utils", Path: "log.go", Branch: "main"},
+		Target: config.SyncTarget{Path: "log.go", Type: "file"},
+	}
+	writeTestFile(t, item.Target.Path, "package log // edited locally\n")
+
+	source := mocks.NewMockGitHubClient(gomock.NewController(t))
+	source.EXPECT().GetCommitsSince("acme", "utils", "log.go", "main", time.Time{}, "").
+		Return([]github.CommitInfo{{SHA: "abc123"}}, nil).AnyTimes()
+	source.EXPECT().GetFile("acme", "utils", "log.go", "abc123").
+		Return(&github.FileInfo{Content: "package log // upstream\n", CommitID: "abc123"}, nil).AnyTimes()
+
+	cfg := &config.Config{Version: "1.0", Items: []config.SyncItem{item}}
+	sm, err := NewSyncManager(cfg, t.TempDir(), WithProvider(config.ProviderGitHub, source))
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	if err := sm.saveState(item.Name, State{CurrentLocalHash: calculateHash("package log\n")}); err != nil {
+		t.Fatal(err)
+	}
+	return sm, item
+}
+
+func TestConflictInbox(t *testing.T) {
+	sm, item := conflictingManager(t)
+
+	report, _ := sm.SyncItemByName(item.Name)
+	if !report.Conflict || report.ConflictID == "" || !report.NewConflict {
+		t.Fatalf("Expected a new conflict, got %+v", report)
+	}
+	if events := reportEvents(report); len(events) != 1 || events[0].ConflictID != report.ConflictID {
+		t.Errorf("Expected a conflict event with the ID, got %+v", events)
+	}
+
+	// Finding the same conflict again doesn't announce it again
+	again, _ := sm.SyncItemByName(item.Name)
+	if again.ConflictID != report.ConflictID || again.NewConflict {
+		t.Errorf("Expected the same conflict, got %s (new: %v)", again.ConflictID, again.NewConflict)
+	}
+	if events := reportEvents(again); len(events) != 0 {
+		t.Errorf("Expected no events for a known conflict, got %+v", events)
+	}
+
+	open, err := sm.Conflicts(false)
+	if err != nil || len(open) != 1 || open[0].Item != item.Name || open[0].CommitID != "abc123" {
+		t.Fatalf("Unexpected open conflicts: %+v, %v", open, err)
+	}
+
+	resolved, err := sm.ResolveConflict(report.ConflictID[:4], "upstream")
+	if err != nil {
+		t.Fatalf("ResolveConflict failed: %v", err)
+	}
+	if resolved.Status != ConflictResolved || resolved.Resolution != "upstream" {
+		t.Errorf("Unexpected resolved conflict: %+v", resolved)
+	}
+	if got, _ := os.ReadFile(item.Target.Path); string(got) != "package log // upstream\n" {
+		t.Errorf("Expected the upstream version, got %q", got)
+	}
+	if state, _ := sm.ItemState(item.Name); state.LastCommitID != "abc123" || state.HasLocalChanges {
+		t.Errorf("Expected the item to be synced with the upstream commit, got %+v", state)
+	}
+
+	if open, _ := sm.Conflicts(false); len(open) != 0 {
+		t.Errorf("Expected no open conflicts, got %+v", open)
+	}
+	if all, _ := sm.Conflicts(true); len(all) != 1 {
+		t.Errorf("Expected the resolved conflict to be kept, got %+v", all)
+	}
+	if _, err := sm.DismissConflict(report.ConflictID); err == nil {
+		t.Error("Expected a resolved conflict not to be dismissable")
+	}
+}
+
+func TestDismissConflict(t *testing.T) {
+	sm, item := conflictingManager(t)
+
+	report, _ := sm.SyncItemByName(item.Name)
+	if _, err := sm.DismissConflict(report.ConflictID); err != nil {
+		t.Fatalf("DismissConflict failed: %v", err)
+	}
+
+	// The same versions stay dismissed
+	again, _ := sm.SyncItemByName(item.Name)
+	if again.NewConflict {
+		t.Error("Expected a dismissed conflict not to be reopened")
+	}
+	if open, _ := sm.Conflicts(false); len(open) != 0 {
+		t.Errorf("Expected no open conflicts, got %+v", open)
+	}
+
+	// A new local edit is a new conflict, which supersedes nothing open
+	writeTestFile(t, item.Target.Path, "package log // edited locally, again\n")
+	edited, _ := sm.SyncItemByName(item.Name)
+	if !edited.NewConflict || edited.ConflictID == report.ConflictID {
+		t.Errorf("Expected a new conflict after a local edit, got %s (new: %v)", edited.ConflictID, edited.NewConflict)
+	}
+
+	if _, err := sm.ResolveConflict(edited.ConflictID, "both"); err == nil {
+		t.Error("Expected an unknown side to fail")
+	}
+	if _, err := sm.Conflict("ffffffff"); err == nil {
+		t.Error("Expected an unknown ID to fail")
+	}
+}
+
+func TestOnConflict(t *testing.T) {
+	t.Run("ours", func(t *testing.T) {
+		sm, item := conflictingManager(t)
+		item.OnConflict = config.ConflictOurs
+		sm.SetItems([]config.SyncItem{item})
+
+		report, err := sm.SyncItemByName(item.Name)
+		if err != nil || report.Conflict || len(report.Warnings) != 1 {
+			t.Fatalf("Expected the local changes to be kept, got %+v, %v", report, err)
+		}
+		if content, _ := os.ReadFile(item.Target.Path); string(content) != "package log // edited locally\n" {
+			t.Errorf("Expected the local file to be left alone, got %q", content)
+		}
+		state, _ := sm.ItemState(item.Name)
+		if state.LastCommitID != "abc123" || state.CurrentLocalHash != calculateHash("package log\n") {
+			t.Errorf("Expected the commit to be synced with the local change kept a change, got %+v", state)
+		}
+	})
+
+	t.Run("theirs", func(t *testing.T) {
+		sm, item := conflictingManager(t)
+		item.OnConflict = config.ConflictTheirs
+		sm.SetItems([]config.SyncItem{item})
+		sm.SetClock(func() time.Time { return time.Date(2025, 3, 14, 10, 0, 0, 0, time.UTC) })
+
+		report, err := sm.SyncItemByName(item.Name)
+		if err != nil || report.Conflict {
+			t.Fatalf("Expected upstream's changes to be taken, got %+v, %v", report, err)
+		}
+		if content, _ := os.ReadFile(item.Target.Path); string(content) != "package log // upstream\n" {
+			t.Errorf("Expected the upstream file, got %q", content)
+		}
+		backup, err := sm.LoadBackup("logger-20250314T100000Z")
+		if err != nil || len(backup.Files) != 1 || string(backup.Files[0].Content) != "package log // edited locally\n" {
+			t.Fatalf("Expected the local file to be backed up, got %+v, %v", backup, err)
+		}
+		if names, _ := sm.Backups(); len(names) != 1 || names[0] != backup.Name {
+			t.Errorf("Expected the backup to be listed, got %v", names)
+		}
+
+		if _, err := sm.RestoreBackup(backup.Name); err != nil {
+			t.Fatalf("RestoreBackup failed: %v", err)
+		}
+		if content, _ := os.ReadFile(item.Target.Path); string(content) != "package log // edited locally\n" {
+			t.Errorf("Expected the local file to be restored, got %q", content)
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		sm, item := conflictingManager(t)
+		item.OnConflict = config.ConflictFail
+		sm.SetItems([]config.SyncItem{item})
+		// The changes would merge, but the conflict is left for a human
+		if err := sm.saveSnapshot(item.Name, "package log // edited locally\n"); err != nil {
+			t.Fatal(err)
+		}
+
+		report, _ := sm.SyncItemByName(item.Name)
+		if !report.Conflict {
+			t.Errorf("Expected a conflict, got %+v", report)
+		}
+	})
+}
@@ -0,0 +1,168 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+	"github.com/exitflynn/codesync/internal/region"
+)
+
+// ContributeOptions customizes the pull request Contribute opens
+type ContributeOptions struct {
+	Title  string // Title and commit message (default: "Update <upstream path>")
+	Branch string // Branch created for the change (default: codesync/<item>-<hash of the content>)
+	Fork   string // github.ForkAuto (default), github.ForkAlways or github.ForkNever
+}
+
+// branchUnsafe matches what item names may contain that branch names can't
+var branchUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Contribute proposes the local version of an item upstream: the local file,
+// or the upstream file with the local function or region in it, is committed
+// to a new branch starting at the upstream commit last synced, and a pull
+// request is opened against the item's branch. Items whose local content
+// isn't upstream's, such as transformed ones, can't be contributed.
+func (sm *SyncManager) Contribute(itemName string, opts ContributeOptions) (*github.PullRequest, error) {
+	item, ok := sm.Item(itemName)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownItem, itemName)
+	}
+	switch opts.Fork {
+	case "", github.ForkAuto, github.ForkAlways, github.ForkNever:
+	default:
+		return nil, fmt.Errorf("invalid fork strategy '%s'", opts.Fork)
+	}
+	if item.Target.Transform != "" || item.Target.TransformPlugin != "" {
+		return nil, fmt.Errorf("%s is transformed, so its local content isn't upstream's", itemName)
+	}
+
+	contributor, ok := sm.source(item).(Contributor)
+	if !ok {
+		return nil, fmt.Errorf("%s sources don't support contributing", item.Source.ProviderName())
+	}
+	state, err := sm.loadState(itemName)
+	if err != nil || state.LastCommitID == "" {
+		return nil, fmt.Errorf("%s hasn't been synced, so there's no upstream version to change", itemName)
+	}
+	if state.RelocatedPath != "" {
+		item.Target.Path = state.RelocatedPath
+	}
+
+	upstream, err := sm.source(item).GetFile(item.Source.Owner, item.Source.Repo, item.Source.Path, state.LastCommitID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the upstream file: %w", err)
+	}
+	content, err := sm.contributedContent(item, upstream.Content)
+	if err != nil {
+		return nil, err
+	}
+	if content == upstream.Content {
+		return nil, fmt.Errorf("%s has no local changes to contribute", itemName)
+	}
+
+	if opts.Title == "" {
+		opts.Title = "Update " + item.Source.Path
+	}
+	if opts.Branch == "" {
+		sum := sha256.Sum256([]byte(content))
+		opts.Branch = fmt.Sprintf("codesync/%s-%x", strings.Trim(branchUnsafe.ReplaceAllString(item.Name, "-"), "-"), sum[:4])
+	}
+
+	return contributor.Contribute(github.Contribution{
+		Owner:   item.Source.Owner,
+		Repo:    item.Source.Repo,
+		Base:    item.Source.Branch,
+		Parent:  state.LastCommitID,
+		Branch:  opts.Branch,
+		Path:    item.Source.Path,
+		Content: content,
+		Title:   opts.Title,
+		Body:    sm.contributionBody(item, state.LastCommitID),
+		Fork:    opts.Fork,
+	})
+}
+
+// contributedContent returns the upstream file as it would be with the local
+// version of an item
+func (sm *SyncManager) contributedContent(item config.SyncItem, upstream string) (string, error) {
+	switch {
+	case item.Target.Type == "file" && !item.Target.Structured():
+		absPath, err := item.Target.GetAbsolutePath("")
+		if err != nil {
+			return "", err
+		}
+		content, err := os.ReadFile(absPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read local file: %w", err)
+		}
+		return string(content), nil
+
+	case item.Target.Type == "function":
+		absPath, err := item.Target.GetAbsolutePath("")
+		if err != nil {
+			return "", err
+		}
+		local, err := os.ReadFile(absPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read local file: %w", err)
+		}
+		function, err := sm.extractFunction(item, string(local))
+		if err != nil {
+			return "", fmt.Errorf("failed to extract local function: %w", err)
+		}
+		return replaceFunction(upstream, item.Target.Language, item.Target.Function, function)
+
+	case item.Target.Type == "region":
+		targets, err := regionTargets(item)
+		if err != nil {
+			return "", err
+		}
+		var body string
+		for i, path := range targets {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return "", fmt.Errorf("failed to read %s: %w", path, err)
+			}
+			b, err := region.Extract(string(content), item.Target.Marker)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", path, err)
+			}
+			if i > 0 && b != body {
+				return "", fmt.Errorf("the region differs between %s and %s, so it's unclear which to contribute", targets[0], path)
+			}
+			body = b
+		}
+		if region.Has(upstream, item.Target.Marker) {
+			return region.Replace(upstream, item.Target.Marker, body)
+		}
+		return body, nil
+	}
+	return "", fmt.Errorf("only file, function and region items can be contributed, not %s", item.Target.Type)
+}
+
+// contributionBody describes where a contributed change comes from
+func (sm *SyncManager) contributionBody(item config.SyncItem, commitID string) string {
+	from := "a project"
+	if sm.config.ProjectName != "" {
+		from = sm.config.ProjectName
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "This change was made in %s to its copy of `%s`, which codesync last synced from %s (item `%s`).\n",
+		from, item.Source.Path, commitID, item.Name)
+	if item.Owner != "" || len(item.Contacts) > 0 {
+		sb.WriteString("\n")
+		if item.Owner != "" {
+			fmt.Fprintf(&sb, "Owner: %s\n", item.Owner)
+		}
+		if len(item.Contacts) > 0 {
+			fmt.Fprintf(&sb, "Contacts: %s\n", strings.Join(item.Contacts, ", "))
+		}
+	}
+	return sb.String()
+}
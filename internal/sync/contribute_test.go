@@ -0,0 +1,99 @@
+package sync
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+	"github.com/exitflynn/codesync/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+// contributingProvider records the contributions made to it
+type contributingProvider struct {
+	*mocks.MockGitHubClient
+	contributions []github.Contribution
+}
+
+func (p *contributingProvider) Contribute(c github.Contribution) (*github.PullRequest, error) {
+	p.contributions = append(p.contributions, c)
+	return &github.PullRequest{Number: 7, URL: "https://github.com/acme/lib/pull/7"}, nil
+}
+
+func TestContribute(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	items := []config.SyncItem{
+		{
+			Name:   "lib",
+			Owner:  "platform",
+			Source: config.SyncSource{Owner: "acme", Repo: "lib", Path: "lib.go", Branch: "main"},
+			Target: config.SyncTarget{Path: "lib.go", Type: "file"},
+		},
+		{
+			Name:   "add",
+			Source: config.SyncSource{Owner: "acme", Repo: "lib", Path: "math.go", Branch: "main"},
+			Target: config.SyncTarget{Path: "math.go", Type: "function", Language: "go", Function: "Add"},
+		},
+		{
+			Name:   "unsynced",
+			Source: config.SyncSource{Owner: "acme", Repo: "lib", Path: "other.go", Branch: "main"},
+			Target: config.SyncTarget{Path: "other.go", Type: "file"},
+		},
+	}
+	provider := &contributingProvider{MockGitHubClient: mocks.NewMockGitHubClient(gomock.NewController(t))}
+	provider.EXPECT().GetFile("acme", "lib", "lib.go", "c1").
+		Return(&github.FileInfo{Content: "package lib\n"}, nil).Times(2)
+	provider.EXPECT().GetFile("acme", "lib", "math.go", "c2").
+		Return(&github.FileInfo{Content: "package lib\n\nfunc Add(a, b int) int {\n\treturn a + b\n}\n\nfunc Sub(a, b int) int {\n\treturn a - b\n}\n"}, nil)
+	provider.EXPECT().ExtractFunction(gomock.Any(), "go", "Add").
+		Return("func Add(a, b int) int {\n\treturn b + a\n}", nil)
+
+	sm, err := NewSyncManager(&config.Config{Version: "1.0", ProjectName: "billing", Items: items}, t.TempDir(), WithProvider(config.ProviderGitHub, provider))
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	sm.saveState("lib", State{LastCommitID: "c1"})
+	sm.saveState("add", State{LastCommitID: "c2"})
+
+	// A file goes upstream as it is locally
+	writeTestFile(t, "lib.go", "package lib // fixed\n")
+	pr, err := sm.Contribute("lib", ContributeOptions{Fork: github.ForkAlways})
+	if err != nil || pr.Number != 7 {
+		t.Fatalf("Contribute failed: %v", err)
+	}
+	c := provider.contributions[0]
+	if c.Parent != "c1" || c.Base != "main" || c.Path != "lib.go" || c.Content != "package lib // fixed\n" || c.Fork != github.ForkAlways {
+		t.Errorf("Unexpected contribution %+v", c)
+	}
+	if c.Title != "Update lib.go" || !strings.HasPrefix(c.Branch, "codesync/lib-") {
+		t.Errorf("Unexpected title %q or branch %q", c.Title, c.Branch)
+	}
+	if !strings.Contains(c.Body, "made in billing") || !strings.Contains(c.Body, "Owner: platform") {
+		t.Errorf("Unexpected body %q", c.Body)
+	}
+
+	// A function goes into the upstream file, leaving the rest of it alone
+	writeTestFile(t, "math.go", "package local\n\nfunc Add(a, b int) int {\n\treturn b + a\n}\n")
+	if _, err := sm.Contribute("add", ContributeOptions{Title: "Fix Add", Branch: "fix-add"}); err != nil {
+		t.Fatalf("Contribute failed: %v", err)
+	}
+	c = provider.contributions[1]
+	want := "package lib\n\nfunc Add(a, b int) int {\n\treturn b + a\n}\n\nfunc Sub(a, b int) int {\n\treturn a - b\n}\n"
+	if c.Content != want || c.Title != "Fix Add" || c.Branch != "fix-add" {
+		t.Errorf("Unexpected contribution %+v", c)
+	}
+
+	// Nothing to contribute, or nothing to base it on
+	writeTestFile(t, "lib.go", "package lib\n")
+	if _, err := sm.Contribute("lib", ContributeOptions{}); err == nil || !strings.Contains(err.Error(), "no local changes") {
+		t.Errorf("Expected an unchanged item to fail, got %v", err)
+	}
+	if _, err := sm.Contribute("unsynced", ContributeOptions{}); err == nil || !strings.Contains(err.Error(), "hasn't been synced") {
+		t.Errorf("Expected an item never synced to fail, got %v", err)
+	}
+	if len(provider.contributions) != 2 {
+		t.Errorf("Expected 2 contributions, got %d", len(provider.contributions))
+	}
+}
@@ -0,0 +1,175 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/diff"
+)
+
+// syncDirectory mirrors the upstream directory at commitID into the target
+// directory: new files are created, changed ones rewritten and files upstream
+// no longer has are deleted, along with directories left empty. Upstream
+// files go where the target's rename rules put them. The sha256 of each file
+// written is kept in the state, by local path, for editedFiles. The writes are
+// journaled, so an interrupted update is rolled back or forward by the next
+// sync.
+func (sm *SyncManager) syncDirectory(item config.SyncItem, commitID string, state *State, report *SyncReport) error {
+	files, err := sm.getDirectory(item, commitID)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("Failed to fetch directory: %v", err))
+		return err
+	}
+
+	prefix := path.Clean(item.Source.Path) + "/"
+	upstream := make(map[string]string)
+	renamed := make(map[string]string)
+	for filePath, info := range files {
+		name := renamePath(item.Target.Rename, strings.TrimPrefix(filePath, prefix))
+		if !localPath(name) {
+			err := fmt.Errorf("upstream path %s is outside the directory as %s", filePath, name)
+			report.Errors = append(report.Errors, err.Error())
+			return err
+		}
+		if other, ok := renamed[name]; ok {
+			err := fmt.Errorf("upstream paths %s and %s both map to %s", other, filePath, name)
+			report.Errors = append(report.Errors, err.Error())
+			return err
+		}
+		renamed[name] = filePath
+		upstream[name] = info.Content
+	}
+
+	absPath, err := item.Target.GetAbsolutePath("")
+	if err != nil {
+		return err
+	}
+	local, err := readTree(absPath)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("Failed to read local directory: %v", err))
+		return err
+	}
+	local = withoutChangelog(item, local)
+
+	// Directories in Git always hold files, so an empty listing means the
+	// source is missing something rather than that every file was deleted
+	if len(upstream) == 0 && len(local) > 0 {
+		err := fmt.Errorf("upstream directory %s has no files; not deleting the %d local ones", item.Source.Path, len(local))
+		report.Errors = append(report.Errors, err.Error())
+		return err
+	}
+
+	hashes := make(map[string]string, len(upstream))
+	journal := &Journal{Item: item.Name, CommitID: commitID, Root: absPath, Files: hashes}
+	for _, name := range sortedNames(upstream) {
+		content := upstream[name]
+		hashes[name] = assetHash(content)
+		previous, exists := local[name]
+		if exists && previous == content {
+			continue
+		}
+
+		journal.Writes = append(journal.Writes, JournalWrite{
+			Path:     filepath.Join(absPath, filepath.FromSlash(name)),
+			Content:  []byte(content),
+			Previous: []byte(previous),
+			Existed:  exists,
+		})
+
+		target := filepath.Join(item.Target.Path, filepath.FromSlash(name))
+		report.UpdatedFiles = append(report.UpdatedFiles, target)
+		if !exists {
+			report.CreatedFiles = append(report.CreatedFiles, target)
+		}
+		report.Diffs[target] = diff.GenerateDiff(previous, content)
+	}
+
+	for _, name := range sortedNames(local) {
+		if _, ok := upstream[name]; ok {
+			continue
+		}
+		journal.Writes = append(journal.Writes, JournalWrite{
+			Path:     filepath.Join(absPath, filepath.FromSlash(name)),
+			Remove:   true,
+			Previous: []byte(local[name]),
+			Existed:  true,
+		})
+
+		target := filepath.Join(item.Target.Path, filepath.FromSlash(name))
+		report.UpdatedFiles = append(report.UpdatedFiles, target)
+		report.DeletedFiles = append(report.DeletedFiles, target)
+		report.Diffs[target] = diff.GenerateDiff(local[name], "")
+	}
+
+	if err := sm.writeJournaled(journal); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("Failed to update directory: %v", err))
+		return err
+	}
+
+	state.Files = hashes
+	return nil
+}
+
+// editedFiles returns the files of a directory target that were edited, added
+// or deleted locally since its last sync, sorted. A directory whose state
+// doesn't hold its files' hashes yet has none.
+func editedFiles(item config.SyncItem, state State) ([]string, error) {
+	if state.Files == nil {
+		return nil, nil
+	}
+	absPath, err := item.Target.GetAbsolutePath("")
+	if err != nil {
+		return nil, err
+	}
+	local, err := readTree(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read local directory: %w", err)
+	}
+	local = withoutChangelog(item, local)
+
+	var edited []string
+	for name, content := range local {
+		if hash, ok := state.Files[name]; !ok || !fileHashMatches(hash, content) {
+			edited = append(edited, name)
+		}
+	}
+	for name := range state.Files {
+		if _, ok := local[name]; !ok {
+			edited = append(edited, name)
+		}
+	}
+	sort.Strings(edited)
+	return edited, nil
+}
+
+// fileHashMatches reports whether content has a hash kept in a directory
+// target's state. Older states kept lengths rather than sha256 hashes.
+func fileHashMatches(hash, content string) bool {
+	if len(hash) == sha256.Size*2 {
+		return hash == assetHash(content)
+	}
+	return hash == calculateHash(content)
+}
+
+// renamePath applies the first rename rule of a directory target that
+// matches an upstream path, relative to the directory
+func renamePath(rules []config.PathRule, name string) string {
+	for _, rule := range rules {
+		from, to, _ := rule.Split()
+		if re, _ := rule.Pattern(); re != nil {
+			if match := re.FindStringSubmatchIndex(name); match != nil {
+				return string(re.ExpandString(nil, to, name, match))
+			}
+			continue
+		}
+		if from == name || from == "" || strings.HasSuffix(from, "/") && strings.HasPrefix(name, from) {
+			return to + strings.TrimPrefix(name, from)
+		}
+	}
+	return name
+}
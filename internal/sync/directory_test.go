@@ -0,0 +1,176 @@
+package sync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+	"github.com/exitflynn/codesync/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestSyncDirectory(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	item := config.SyncItem{
+		Name:      "docs",
+		Source:    config.SyncSource{Owner: "acme", Repo: "tools", Path: "docs", Branch: "main"},
+		Target:    config.SyncTarget{Path: "docs", Type: "directory"},
+		Changelog: true,
+	}
+	mock := mocks.NewMockGitHubClient(gomock.NewController(t))
+	sm, err := NewSyncManager(&config.Config{Version: "1.0", Items: []config.SyncItem{item}}, t.TempDir(), WithProvider(config.ProviderGitHub, mock))
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+
+	// The first sync creates the directory
+	mock.EXPECT().GetCommitsSince("acme", "tools", "docs", "main", time.Time{}, "").
+		Return([]github.CommitInfo{{SHA: "c1"}}, nil)
+	mock.EXPECT().GetDirectory("acme", "tools", "docs", "c1").Return(map[string]*github.FileInfo{
+		"docs/index.md":         {Content: "# Index\n"},
+		"docs/guide/install.md": {Content: "# Install\n"},
+	}, nil)
+
+	report, err := sm.SyncItem(item)
+	if err != nil || len(report.Errors) > 0 {
+		t.Fatalf("SyncItem failed: %v %v", err, report.Errors)
+	}
+	install := filepath.Join("docs", "guide", "install.md")
+	index := filepath.Join("docs", "index.md")
+	if !slices.Equal(report.CreatedFiles, []string{install, index}) || len(report.UpdatedFiles) != 2 {
+		t.Errorf("Expected both files to be created, got %v", report.CreatedFiles)
+	}
+	if content, _ := os.ReadFile(install); string(content) != "# Install\n" {
+		t.Errorf("Expected the nested file to be written, got %q", content)
+	}
+	state, _ := sm.loadState("docs")
+	if len(state.Files) != 2 || state.Files["guide/install.md"] != assetHash("# Install\n") {
+		t.Errorf("Expected the file hashes in the state, got %v", state.Files)
+	}
+	if _, err := sm.store.read(journalName("docs")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the journal to be cleared once the state was saved, got %v", err)
+	}
+
+	// The next one updates, adds and deletes files
+	mock.EXPECT().GetCommitsSince("acme", "tools", "docs", "main", time.Time{}, "c1").
+		Return([]github.CommitInfo{{SHA: "c2"}}, nil)
+	mock.EXPECT().GetDirectory("acme", "tools", "docs", "c2").Return(map[string]*github.FileInfo{
+		"docs/index.md": {Content: "# Index v2\n"},
+		"docs/new.md":   {Content: "# New\n"},
+	}, nil)
+
+	report, err = sm.SyncItem(item)
+	if err != nil || len(report.Errors) > 0 {
+		t.Fatalf("SyncItem failed: %v %v", err, report.Errors)
+	}
+	newFile := filepath.Join("docs", "new.md")
+	if !slices.Equal(report.UpdatedFiles, []string{index, newFile, install}) {
+		t.Errorf("Unexpected updated files %v", report.UpdatedFiles)
+	}
+	if !slices.Equal(report.CreatedFiles, []string{newFile}) || !slices.Equal(report.DeletedFiles, []string{install}) {
+		t.Errorf("Expected %s created and %s deleted, got %v and %v", newFile, install, report.CreatedFiles, report.DeletedFiles)
+	}
+	if report.Diffs[index] == nil || report.Diffs[install] == nil {
+		t.Error("Expected a diff per changed file")
+	}
+	if _, err := os.Stat(filepath.Join("docs", "guide")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the empty directory to be removed, got %v", err)
+	}
+	if state, _ := sm.loadState("docs"); len(state.Files) != 2 || state.HasLocalChanges {
+		t.Errorf("Unexpected state %+v", state)
+	}
+	if content, _ := os.ReadFile(filepath.Join("docs", changelogName)); strings.Count(string(content), "## ") != 2 {
+		t.Errorf("Expected the changelog in the directory to be kept and appended to, got:\n%s", content)
+	}
+
+	// Local edits aren't overwritten
+	writeTestFile(t, "docs/local.md", "mine\n")
+	mock.EXPECT().GetCommitsSince("acme", "tools", "docs", "main", time.Time{}, "c2").
+		Return([]github.CommitInfo{{SHA: "c3"}}, nil)
+
+	report, err = sm.SyncItem(item)
+	if !errors.Is(err, ErrConflict) || !report.Conflict {
+		t.Fatalf("Expected a conflict, got %v", err)
+	}
+	if _, err := os.Stat("docs/local.md"); err != nil {
+		t.Errorf("Expected the local file to be kept, got %v", err)
+	}
+
+	// Nor are edits that keep a file's length
+	os.Remove("docs/local.md")
+	writeTestFile(t, "docs/index.md", "# Index v3\n")
+	mock.EXPECT().GetCommitsSince("acme", "tools", "docs", "main", time.Time{}, "c2").
+		Return([]github.CommitInfo{{SHA: "c3"}}, nil)
+
+	report, err = sm.SyncItem(item)
+	if !errors.Is(err, ErrConflict) || !report.Conflict {
+		t.Fatalf("Expected a conflict, got %v", err)
+	}
+	if content, _ := os.ReadFile(index); string(content) != "# Index v3\n" {
+		t.Errorf("Expected the edit to be kept, got %q", content)
+	}
+}
+
+func TestSyncDirectoryRename(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	item := config.SyncItem{
+		Name:   "tools",
+		Source: config.SyncSource{Owner: "acme", Repo: "tools", Path: "tools", Branch: "main"},
+		Target: config.SyncTarget{Path: "third_party/tools", Type: "directory", Rename: []config.PathRule{
+			"src/main.go -> cmd/tools/main.go",
+			`/^src/(.*)_gen\.go$/ -> gen/$1.go`,
+			"src/ -> pkg/",
+		}},
+	}
+	mock := mocks.NewMockGitHubClient(gomock.NewController(t))
+	sm, err := NewSyncManager(&config.Config{Version: "1.0", Items: []config.SyncItem{item}}, t.TempDir(), WithProvider(config.ProviderGitHub, mock))
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	mock.EXPECT().GetCommitsSince("acme", "tools", "tools", "main", time.Time{}, "").
+		Return([]github.CommitInfo{{SHA: "c1"}}, nil)
+	mock.EXPECT().GetDirectory("acme", "tools", "tools", "c1").Return(map[string]*github.FileInfo{
+		"tools/src/main.go":      {Content: "package main\n"},
+		"tools/src/util/util.go": {Content: "package util\n"},
+		"tools/src/api_gen.go":   {Content: "package api\n"},
+		"tools/README.md":        {Content: "# Tools\n"},
+	}, nil)
+
+	report, err := sm.SyncItem(item)
+	if err != nil || len(report.Errors) > 0 {
+		t.Fatalf("SyncItem failed: %v %v", err, report.Errors)
+	}
+	for path, content := range map[string]string{
+		"cmd/tools/main.go": "package main\n",
+		"pkg/util/util.go":  "package util\n",
+		"gen/api.go":        "package api\n",
+		"README.md":         "# Tools\n",
+	} {
+		if got, _ := os.ReadFile(filepath.Join("third_party", "tools", path)); string(got) != content {
+			t.Errorf("Expected %s to hold %q, got %q", path, content, got)
+		}
+	}
+	if state, _ := sm.loadState("tools"); state.Files["cmd/tools/main.go"] == "" {
+		t.Errorf("Expected the state to hash files by local path, got %v", state.Files)
+	}
+
+	// Two upstream files can't end up in the same place
+	item.Target.Rename = []config.PathRule{"src/main.go -> README.md"}
+	mock.EXPECT().GetCommitsSince("acme", "tools", "tools", "main", time.Time{}, "c1").
+		Return([]github.CommitInfo{{SHA: "c2"}}, nil)
+	mock.EXPECT().GetDirectory("acme", "tools", "tools", "c2").Return(map[string]*github.FileInfo{
+		"tools/src/main.go": {Content: "package main\n"},
+		"tools/README.md":   {Content: "# Tools\n"},
+	}, nil)
+	if _, err := sm.SyncItem(item); err == nil || !strings.Contains(err.Error(), "both map to README.md") {
+		t.Errorf("Expected the clash to fail, got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package sync
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// workspaceFiles reads and writes the files items sync into. In a dry run,
+// files written or removed are kept in memory instead, and reads see them;
+// listing directories doesn't.
+type workspaceFiles struct {
+	mu      sync.Mutex
+	pending map[string][]byte // By absolute path, nil if removed; set in dry runs
+}
+
+// dryRun reports whether writes are kept in memory
+func (w *workspaceFiles) dryRun() bool {
+	return w.pending != nil
+}
+
+// pendingFile returns what a dry run wrote to path, if it wrote or removed it
+func (w *workspaceFiles) pendingFile(path string) ([]byte, bool) {
+	if w.pending == nil {
+		return nil, false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	data, ok := w.pending[absPath(path)]
+	return data, ok
+}
+
+func (w *workspaceFiles) readFile(path string) ([]byte, error) {
+	if data, ok := w.pendingFile(path); ok {
+		if data == nil {
+			return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+		}
+		return append([]byte{}, data...), nil
+	}
+	return os.ReadFile(path)
+}
+
+// writeFile replaces a file atomically. An existing file keeps its
+// permissions; a new one gets perm.
+func (w *workspaceFiles) writeFile(path string, data []byte, perm fs.FileMode) error {
+	return w.write(path, data, perm, true)
+}
+
+// writeFileMode replaces a file atomically and sets its permissions to perm,
+// which a dry run doesn't keep
+func (w *workspaceFiles) writeFileMode(path string, data []byte, perm fs.FileMode) error {
+	return w.write(path, data, perm, false)
+}
+
+func (w *workspaceFiles) write(path string, data []byte, perm fs.FileMode, keepMode bool) error {
+	if w.pending == nil {
+		return writeAtomic(path, data, perm, keepMode)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending[absPath(path)] = append([]byte{}, data...)
+	return nil
+}
+
+// mkdirAll creates a directory for files to be written to, which a dry run
+// only pretends to
+func (w *workspaceFiles) mkdirAll(path string, perm fs.FileMode) error {
+	if w.pending == nil {
+		return os.MkdirAll(path, perm)
+	}
+	return nil
+}
+
+func (w *workspaceFiles) remove(path string) error {
+	if w.pending == nil {
+		return os.Remove(path)
+	}
+	if _, err := w.readFile(path); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending[absPath(path)] = nil
+	return nil
+}
+
+// removeEmptyDirs removes dir and its parents up to, but not including, root
+// while they are empty. Directories stay in a dry run.
+func (w *workspaceFiles) removeEmptyDirs(dir, root string) {
+	if w.pending != nil {
+		return
+	}
+	for dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// absPath returns the absolute form of path, or path itself if the working
+// directory is unknown
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,87 @@
+package sync
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+	"github.com/exitflynn/codesync/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestDryRun(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	lib := config.SyncItem{
+		Name:      "lib",
+		Source:    config.SyncSource{Owner: "acme", Repo: "lib", Path: "lib.go", Branch: "main"},
+		Target:    config.SyncTarget{Path: "vendor/lib.go", Type: "file"},
+		Changelog: true,
+	}
+	docs := config.SyncItem{
+		Name:   "docs",
+		Source: config.SyncSource{Owner: "acme", Repo: "lib", Path: "docs", Branch: "main"},
+		Target: config.SyncTarget{Path: "docs", Type: "directory"},
+	}
+	mock := mocks.NewMockGitHubClient(gomock.NewController(t))
+	mock.EXPECT().GetCommitsSince("acme", "lib", "lib.go", "main", time.Time{}, "").
+		Return([]github.CommitInfo{{SHA: "c1"}}, nil)
+	mock.EXPECT().GetFile("acme", "lib", "lib.go", "c1").
+		Return(&github.FileInfo{Content: "package lib // new\n"}, nil)
+	mock.EXPECT().GetCommitsSince("acme", "lib", "docs", "main", time.Time{}, "").
+		Return([]github.CommitInfo{{SHA: "c1"}}, nil)
+	mock.EXPECT().GetDirectory("acme", "lib", "docs", "c1").
+		Return(map[string]*github.FileInfo{"docs/index.md": {Content: "# Lib\n"}}, nil)
+
+	stateDir := t.TempDir()
+	cfg := &config.Config{Version: "1.0", Items: []config.SyncItem{lib, docs}}
+	sm, err := NewSyncManager(cfg, stateDir, WithProvider(config.ProviderGitHub, mock), DryRun())
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	writeTestFile(t, "vendor/lib.go", "package lib // old\n")
+	_, hash, err := sm.checkLocalChanges(lib, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.saveState("lib", State{CurrentLocalHash: hash}); err != nil {
+		t.Fatal(err)
+	}
+
+	reports, err := sm.SyncAll()
+	if err != nil {
+		t.Fatalf("SyncAll failed: %v", err)
+	}
+	for _, report := range reports {
+		if len(report.Errors) > 0 {
+			t.Fatalf("%s failed: %v", report.SyncItem.Name, report.Errors)
+		}
+	}
+
+	// The would-be changes are reported
+	docsReport, libReport := reports[0], reports[1]
+	if len(libReport.UpdatedFiles) != 1 || libReport.Diffs["vendor/lib.go"] == nil {
+		t.Errorf("Expected the file's change to be reported, got %v", libReport.UpdatedFiles)
+	}
+	if len(docsReport.CreatedFiles) != 1 || docsReport.CreatedFiles[0] != "docs/index.md" {
+		t.Errorf("Expected the new directory file to be reported, got %v", docsReport.CreatedFiles)
+	}
+	if state, _ := sm.ItemState("lib"); state.LastCommitID != "c1" {
+		t.Errorf("Expected the manager to see the would-be state, got %+v", state)
+	}
+
+	// Nothing is written
+	if content, _ := os.ReadFile("vendor/lib.go"); string(content) != "package lib // old\n" {
+		t.Errorf("Expected the target to be left alone, got %q", content)
+	}
+	for _, path := range []string{"docs", "vendor/" + changelogName} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected %s not to be written, got %v", path, err)
+		}
+	}
+	if entries, _ := os.ReadDir(stateDir); len(entries) != 0 {
+		t.Errorf("Expected the state directory to stay empty, got %v", entries)
+	}
+}
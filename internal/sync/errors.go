@@ -0,0 +1,30 @@
+package sync
+
+import (
+	"errors"
+
+	"github.com/exitflynn/codesync/internal/github"
+)
+
+// ErrConflict is returned by SyncItem when both the local copy and upstream
+// changed and no merge driver could combine them
+var ErrConflict = errors.New("conflict detected")
+
+// ErrRingUnhealthy is returned by SyncItem when a ring's check failed after
+// it got a version, which halts the rollout until it is retried
+var ErrRingUnhealthy = errors.New("ring is unhealthy")
+
+// ErrPolicyViolation is returned by SyncItem when the configured policies
+// reject an upstream change
+var ErrPolicyViolation = errors.New("upstream change violates policy")
+
+// ErrUnknownItem is matched by errors for item names that aren't configured
+var ErrUnknownItem = errors.New("unknown sync item")
+
+// Errors of the source providers, which errors from syncs match too, so that
+// callers can tell them apart without importing the providers
+var (
+	ErrNotFound            = github.ErrNotFound
+	ErrRateLimited         = github.ErrRateLimited
+	ErrUnsupportedLanguage = github.ErrUnsupportedLanguage
+)
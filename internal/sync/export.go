@@ -0,0 +1,374 @@
+package sync
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/klauspost/compress/zstd"
+)
+
+// exportVersion is the version of the archive format Export writes
+const exportVersion = 1
+
+// Names in export archives
+const (
+	exportManifestName = "manifest.json"
+	exportFilesDir     = "files/"
+	exportSnapshotsDir = "snapshots/"
+)
+
+// ExportManifest describes the items in an export archive and where their
+// files came from upstream
+type ExportManifest struct {
+	Version int            `json:"version"`
+	Items   []ExportedItem `json:"items"`
+}
+
+// ExportedItem is an item in an export archive
+type ExportedItem struct {
+	Name     string         `json:"name"`
+	ID       string         `json:"id"`
+	Source   string         `json:"source"` // owner/repo/path@ref, or the URL of a git source
+	Type     string         `json:"type"`
+	State    State          `json:"state"`              // Upstream commit, tag and hashes as of the last sync
+	Files    []ExportedFile `json:"files"`              // Target files, as they are locally
+	Snapshot string         `json:"snapshot,omitempty"` // Archive entry with the upstream content last synced
+}
+
+// ExportedFile is a target file in an export archive
+type ExportedFile struct {
+	Path   string `json:"path"` // Slash-separated, relative to the workspace
+	SHA256 string `json:"sha256"`
+}
+
+// Export writes the targets of the enabled items, their state and the
+// upstream content they last synced to w as a zstd-compressed tar archive,
+// for Import to restore in another workspace, e.g. one without access to the
+// sources. File modes are kept. The archive only depends on the files and
+// state, so exporting the same workspace twice gives the same bytes. Targets
+// must be inside the working directory.
+func (sm *SyncManager) Export(w io.Writer) (*ExportManifest, error) {
+	manifest := &ExportManifest{Version: exportVersion}
+	snapshots := make(map[string]string)
+	modes := make(map[string]fs.FileMode)
+	hashes := make(map[string]string)
+
+	items := sm.Items()
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	for _, item := range items {
+		if item.Disabled {
+			continue
+		}
+		state, err := sm.loadState(item.Name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("item %s: %w", item.Name, err)
+		}
+		if state.RelocatedPath != "" {
+			item.Target.Path = state.RelocatedPath
+		}
+
+		exported := ExportedItem{
+			Name:   item.Name,
+			ID:     item.ID(),
+			Source: sourceName(item),
+			Type:   item.Target.Type,
+			State:  state,
+		}
+		files, err := targetFiles(item)
+		if err != nil {
+			return nil, fmt.Errorf("item %s: %w", item.Name, err)
+		}
+		for _, file := range files {
+			content, err := os.ReadFile(filepath.FromSlash(file))
+			if err != nil {
+				return nil, fmt.Errorf("item %s: %w", item.Name, err)
+			}
+			info, err := os.Stat(filepath.FromSlash(file))
+			if err != nil {
+				return nil, fmt.Errorf("item %s: %w", item.Name, err)
+			}
+			sum := sha256.Sum256(content)
+			exported.Files = append(exported.Files, ExportedFile{Path: file, SHA256: hex.EncodeToString(sum[:])})
+			modes[file] = info.Mode().Perm()
+			hashes[file] = hex.EncodeToString(sum[:])
+		}
+
+		if snapshot, err := sm.loadSnapshot(item.Name); err == nil {
+			exported.Snapshot = exportSnapshotsDir + sanitizeFilename(item.Name)
+			snapshots[exported.Snapshot] = snapshot
+		}
+		manifest.Items = append(manifest.Items, exported)
+	}
+
+	// A single encoder goroutine keeps the output deterministic
+	zw, err := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	tw := tar.NewWriter(zw)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := writeExportEntry(tw, exportManifestName, 0644, data); err != nil {
+		return nil, err
+	}
+
+	// Items sharing a file, like regions, store it once
+	files := make([]string, 0, len(modes))
+	for file := range modes {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		content, err := os.ReadFile(filepath.FromSlash(file))
+		if err != nil {
+			return nil, err
+		}
+		if sum := sha256.Sum256(content); hex.EncodeToString(sum[:]) != hashes[file] {
+			return nil, fmt.Errorf("%s changed during the export", file)
+		}
+		if err := writeExportEntry(tw, exportFilesDir+file, modes[file], content); err != nil {
+			return nil, err
+		}
+	}
+	for _, item := range manifest.Items {
+		if item.Snapshot == "" {
+			continue
+		}
+		if err := writeExportEntry(tw, item.Snapshot, 0600, []byte(snapshots[item.Snapshot])); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// writeExportEntry adds a file to an export archive. Owners and times are
+// left out, so that they don't make archives of the same files differ.
+func writeExportEntry(tw *tar.Writer, name string, mode fs.FileMode, content []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(mode),
+		Size:     int64(len(content)),
+		ModTime:  time.Unix(0, 0),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	_, err = tw.Write(content)
+	return err
+}
+
+// targetFiles returns the existing files an item syncs into, slash-separated
+// and relative to the working directory
+func targetFiles(item config.SyncItem) ([]string, error) {
+	targets := []string{item.Target.Path}
+	if item.Target.Type == "region" {
+		var err error
+		if targets, err = regionTargets(item); err != nil {
+			return nil, err
+		}
+	}
+
+	var files []string
+	for _, target := range targets {
+		info, err := os.Stat(target)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, target)
+			continue
+		}
+		err = filepath.WalkDir(target, func(p string, d fs.DirEntry, err error) error {
+			if err == nil && d.Type().IsRegular() {
+				files = append(files, p)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, file := range files {
+		rel, err := workspacePath(file)
+		if err != nil {
+			return nil, err
+		}
+		files[i] = rel
+	}
+	return files, nil
+}
+
+// workspacePath returns a path relative to the working directory, which it
+// must be inside of, with slashes
+func workspacePath(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(wd, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("target %s is outside the workspace", p)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// Import restores the targets, state and snapshots of an archive written by
+// Export into the working directory and state directory. Files that exist
+// locally with other content are only replaced with force; otherwise nothing
+// is written. Every file is checked against the manifest's hash.
+func (sm *SyncManager) Import(r io.Reader, force bool) (*ExportManifest, error) {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+
+	header, err := tr.Next()
+	if err != nil || header.Name != exportManifestName {
+		return nil, fmt.Errorf("not a codesync export archive")
+	}
+	var manifest ExportManifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if manifest.Version != exportVersion {
+		return nil, fmt.Errorf("unsupported export archive version %d", manifest.Version)
+	}
+
+	hashes := make(map[string]string)
+	for _, item := range manifest.Items {
+		for _, file := range item.Files {
+			if !localPath(file.Path) {
+				return nil, fmt.Errorf("item %s: invalid path %q", item.Name, file.Path)
+			}
+			hashes[file.Path] = file.SHA256
+		}
+	}
+
+	// Check for local changes first, so that a refused import writes nothing
+	if !force {
+		var changed []string
+		for file, hash := range hashes {
+			content, err := os.ReadFile(filepath.FromSlash(file))
+			if err != nil {
+				continue
+			}
+			if sum := sha256.Sum256(content); hex.EncodeToString(sum[:]) != hash {
+				changed = append(changed, file)
+			}
+		}
+		if len(changed) > 0 {
+			sort.Strings(changed)
+			return nil, fmt.Errorf("local files differ from the archive, import with force to replace them: %s", strings.Join(changed, ", "))
+		}
+	}
+
+	snapshots := make(map[string]string)
+	written := make(map[string]bool)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+
+		switch {
+		case strings.HasPrefix(header.Name, exportSnapshotsDir):
+			snapshots[header.Name] = string(content)
+		case strings.HasPrefix(header.Name, exportFilesDir):
+			file := strings.TrimPrefix(header.Name, exportFilesDir)
+			hash, ok := hashes[file]
+			if !ok {
+				return nil, fmt.Errorf("%s isn't in the manifest", header.Name)
+			}
+			if sum := sha256.Sum256(content); hex.EncodeToString(sum[:]) != hash {
+				return nil, fmt.Errorf("%s doesn't match its hash in the manifest", file)
+			}
+			if err := writeImportedFile(sm.files, file, content, fs.FileMode(header.Mode).Perm()); err != nil {
+				return nil, err
+			}
+			written[file] = true
+		default:
+			return nil, fmt.Errorf("unexpected archive entry %s", header.Name)
+		}
+	}
+	for file := range hashes {
+		if !written[file] {
+			return nil, fmt.Errorf("%s is missing from the archive", file)
+		}
+	}
+
+	// State last, so that an incomplete import doesn't claim to be synced
+	for _, item := range manifest.Items {
+		if item.Snapshot != "" {
+			if err := sm.saveSnapshot(item.Name, snapshots[item.Snapshot]); err != nil {
+				return nil, fmt.Errorf("item %s: %w", item.Name, err)
+			}
+		}
+		if err := sm.saveState(item.Name, item.State); err != nil {
+			return nil, fmt.Errorf("item %s: %w", item.Name, err)
+		}
+	}
+	return &manifest, nil
+}
+
+// localPath reports whether a slash-separated path from an archive stays
+// inside the directory it is extracted to
+func localPath(p string) bool {
+	return p != "" && !path.IsAbs(p) && filepath.IsLocal(filepath.FromSlash(p)) && path.Clean(p) == p
+}
+
+// writeImportedFile writes an imported file with its mode, which a dry run
+// doesn't keep
+func writeImportedFile(files *workspaceFiles, file string, content []byte, mode fs.FileMode) error {
+	p := filepath.FromSlash(file)
+	if err := files.mkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if !files.dryRun() {
+		if existing, err := os.ReadFile(p); err == nil && bytes.Equal(existing, content) {
+			return os.Chmod(p, mode)
+		}
+	}
+	return files.writeFileMode(p, content, mode)
+}
@@ -0,0 +1,165 @@
+package sync
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/klauspost/compress/zstd"
+)
+
+func newExportManager(t *testing.T) *SyncManager {
+	t.Helper()
+
+	cfg := &config.Config{Version: "1.0", Items: []config.SyncItem{
+		{
+			Name:   "script",
+			Source: config.SyncSource{Owner: "acme", Repo: "tools", Path: "run.sh", Branch: "main"},
+			Target: config.SyncTarget{Path: "bin/run.sh", Type: "file"},
+		},
+		{
+			Name:   "docs",
+			Source: config.SyncSource{Owner: "acme", Repo: "tools", Path: "docs", Tag: "v1.2.0"},
+			Target: config.SyncTarget{Path: "docs", Type: "directory"},
+		},
+	}}
+	sm, err := NewSyncManager(cfg, t.TempDir(), Offline())
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	return sm
+}
+
+func TestExportImport(t *testing.T) {
+	t.Chdir(t.TempDir())
+	sm := newExportManager(t)
+
+	writeTestFile(t, "bin/run.sh", "#!/bin/sh\necho run\n")
+	if err := os.Chmod("bin/run.sh", 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, "docs/a.md", "# A\n")
+	writeTestFile(t, "docs/sub/b.md", "# B\n")
+	if err := sm.saveState("script", State{LastCommitID: "abc123"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.saveState("docs", State{LastCommitID: "def456", Tag: "v1.2.0"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.saveSnapshot("script", "#!/bin/sh\necho run\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	manifest, err := sm.Export(&archive)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if len(manifest.Items) != 2 || manifest.Items[0].Name != "docs" || len(manifest.Items[0].Files) != 2 {
+		t.Fatalf("Unexpected manifest: %+v", manifest.Items)
+	}
+	if manifest.Items[1].Source != "acme/tools/run.sh@main" || manifest.Items[0].Source != "acme/tools/docs@v1.2.0" {
+		t.Errorf("Expected the upstream provenance, got %q and %q", manifest.Items[1].Source, manifest.Items[0].Source)
+	}
+
+	// Exporting again gives the same bytes
+	var again bytes.Buffer
+	if _, err := sm.Export(&again); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if !bytes.Equal(archive.Bytes(), again.Bytes()) {
+		t.Error("Expected exports of the same workspace to be identical")
+	}
+
+	t.Chdir(t.TempDir())
+	imported := newExportManager(t)
+	if _, err := imported.Import(bytes.NewReader(archive.Bytes()), false); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	for file, want := range map[string]string{
+		"bin/run.sh":    "#!/bin/sh\necho run\n",
+		"docs/a.md":     "# A\n",
+		"docs/sub/b.md": "# B\n",
+	} {
+		if content, err := os.ReadFile(file); err != nil || string(content) != want {
+			t.Errorf("%s: expected %q, got %q, %v", file, want, content, err)
+		}
+	}
+	if info, err := os.Stat("bin/run.sh"); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("Expected the script to stay executable, got %v, %v", info.Mode(), err)
+	}
+	if state, err := imported.loadState("docs"); err != nil || state.LastCommitID != "def456" || state.Tag != "v1.2.0" {
+		t.Errorf("Expected the state to be imported, got %+v, %v", state, err)
+	}
+	if snapshot, err := imported.loadSnapshot("script"); err != nil || snapshot != "#!/bin/sh\necho run\n" {
+		t.Errorf("Expected the snapshot to be imported, got %q, %v", snapshot, err)
+	}
+
+	// Importing again over identical files is fine, local edits need force
+	if _, err := imported.Import(bytes.NewReader(archive.Bytes()), false); err != nil {
+		t.Errorf("Expected a repeated import to succeed, got %v", err)
+	}
+	writeTestFile(t, "docs/a.md", "# Edited\n")
+	if _, err := imported.Import(bytes.NewReader(archive.Bytes()), false); err == nil || !strings.Contains(err.Error(), "docs/a.md") {
+		t.Errorf("Expected the edited file to block the import, got %v", err)
+	}
+	if content, _ := os.ReadFile("docs/a.md"); string(content) != "# Edited\n" {
+		t.Error("Expected a refused import to leave the files alone")
+	}
+	if _, err := imported.Import(bytes.NewReader(archive.Bytes()), true); err != nil {
+		t.Fatalf("Forced import failed: %v", err)
+	}
+	if content, _ := os.ReadFile("docs/a.md"); string(content) != "# A\n" {
+		t.Error("Expected a forced import to replace the edited file")
+	}
+}
+
+func TestExportRejectsTargetsOutsideWorkspace(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeTestFile(t, "../outside.txt", "x")
+
+	cfg := &config.Config{Version: "1.0", Items: []config.SyncItem{{
+		Name:   "outside",
+		Source: config.SyncSource{Owner: "acme", Repo: "tools", Path: "x", Branch: "main"},
+		Target: config.SyncTarget{Path: "../outside.txt", Type: "file"},
+	}}}
+	sm, err := NewSyncManager(cfg, t.TempDir(), Offline())
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	if _, err := sm.Export(&bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "outside the workspace") {
+		t.Errorf("Expected an error, got %v", err)
+	}
+}
+
+func TestImportRejectsUnsafePaths(t *testing.T) {
+	t.Chdir(t.TempDir())
+	sm := newExportManager(t)
+
+	for _, path := range []string{"../escape.txt", "/etc/passwd", "a/../../b", ""} {
+		var archive bytes.Buffer
+		zw, err := zstd.NewWriter(&archive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw := tar.NewWriter(zw)
+		data, _ := json.Marshal(ExportManifest{
+			Version: exportVersion,
+			Items:   []ExportedItem{{Name: "evil", Files: []ExportedFile{{Path: path}}}},
+		})
+		if err := writeExportEntry(tw, exportManifestName, 0644, data); err != nil {
+			t.Fatal(err)
+		}
+		tw.Close()
+		zw.Close()
+
+		if _, err := sm.Import(&archive, true); err == nil || !strings.Contains(err.Error(), "invalid path") {
+			t.Errorf("%q: expected the path to be rejected, got %v", path, err)
+		}
+	}
+}
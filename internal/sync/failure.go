@@ -0,0 +1,194 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/exitflynn/codesync/internal/bitbucket"
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/gitea"
+	"github.com/exitflynn/codesync/internal/github"
+	"github.com/exitflynn/codesync/internal/gitlab"
+	gogithub "github.com/google/go-github/v52/github"
+)
+
+// FailureKind classifies why an item failed to sync
+type FailureKind string
+
+const (
+	// FailureTransient is a network error, timeout, rate limit or GitHub
+	// outage; retrying later is likely to succeed
+	FailureTransient FailureKind = "transient"
+	// FailureConfig means the source can't be found or read with the token,
+	// which needs the config or token fixed, or a policy rejected the change
+	FailureConfig FailureKind = "config"
+	// FailureConflict means local and upstream changes need manual resolution
+	FailureConflict FailureKind = "conflict"
+	// FailureInternal is any other error, including panics
+	FailureInternal FailureKind = "internal"
+)
+
+// syncItemSafely calls SyncItem, turning a panic into an error so that one
+// item can't abort a whole run
+func (sm *SyncManager) syncItemSafely(item config.SyncItem) (report *SyncReport, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("panic syncing %s: %v\n%s", item.Name, r, debug.Stack())
+			report, err = nil, fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return sm.SyncItem(item)
+}
+
+// failureOf classifies a failed report given the error SyncItem returned, if
+// any. It returns "" if the report has no errors.
+func failureOf(report *SyncReport, err error) FailureKind {
+	if len(report.Errors) == 0 {
+		return ""
+	}
+	if report.Conflict {
+		return FailureConflict
+	}
+	if err == nil {
+		err = report.cause
+	}
+	return classifyError(err)
+}
+
+// classifyError decides whether an error is worth retrying or needs the config
+// fixed
+func classifyError(err error) FailureKind {
+	var (
+		netErr    net.Error
+		rateLimit *gogithub.RateLimitError
+		abuse     *gogithub.AbuseRateLimitError
+		limited   *github.RateLimitedError
+		response  *gogithub.ErrorResponse
+		gitlabErr *gitlab.APIError
+		bbErr     *bitbucket.APIError
+		giteaErr  *gitea.APIError
+	)
+
+	switch {
+	case err == nil:
+		return FailureInternal
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, github.ErrBudgetExhausted), errors.As(err, &netErr),
+		errors.As(err, &rateLimit), errors.As(err, &abuse), errors.As(err, &limited), errors.Is(err, ErrRateLimited):
+		return FailureTransient
+	case errors.Is(err, github.ErrBadCredentials), errors.Is(err, ErrNotFound), errors.Is(err, ErrPolicyViolation):
+		return FailureConfig
+	case errors.Is(err, ErrConflict), errors.Is(err, ErrRingUnhealthy):
+		return FailureConflict
+	case errors.As(err, &response) && response.Response != nil:
+		return classifyStatus(response.Response.StatusCode)
+	case errors.As(err, &gitlabErr):
+		return classifyStatus(gitlabErr.StatusCode)
+	case errors.As(err, &bbErr):
+		return classifyStatus(bbErr.StatusCode)
+	case errors.As(err, &giteaErr):
+		return classifyStatus(giteaErr.StatusCode)
+	}
+	return FailureInternal
+}
+
+// classifyStatus classifies an unsuccessful API response
+func classifyStatus(code int) FailureKind {
+	switch {
+	case code >= 500, code == http.StatusTooManyRequests:
+		return FailureTransient
+	case code == http.StatusUnauthorized, code == http.StatusForbidden, code == http.StatusNotFound:
+		return FailureConfig
+	}
+	return FailureInternal
+}
+
+// RunSummary counts the outcomes of a run
+type RunSummary struct {
+	Items     int `json:"items"`
+	Updated   int `json:"updated"`
+	Transient int `json:"transient,omitempty"`
+	Config    int `json:"config,omitempty"`
+	Conflict  int `json:"conflict,omitempty"`
+	Internal  int `json:"internal,omitempty"`
+}
+
+// Exit codes for runs with failures. 1 is also used for errors outside any
+// item and 2 for usage errors.
+const (
+	ExitInternal  = 1
+	ExitConflict  = 3
+	ExitTransient = 4
+	ExitConfig    = 5
+)
+
+// SummarizeRun counts the outcomes of the given reports
+func SummarizeRun(reports []*SyncReport) RunSummary {
+	summary := RunSummary{Items: len(reports)}
+	for _, report := range reports {
+		switch report.Failure {
+		case FailureTransient:
+			summary.Transient++
+		case FailureConfig:
+			summary.Config++
+		case FailureConflict:
+			summary.Conflict++
+		case FailureInternal:
+			summary.Internal++
+		default:
+			if len(report.UpdatedFiles) > 0 {
+				summary.Updated++
+			}
+		}
+	}
+	return summary
+}
+
+// Failed returns the number of items that failed
+func (s RunSummary) Failed() int {
+	return s.Transient + s.Config + s.Conflict + s.Internal
+}
+
+// ExitCode returns the process exit code for the run: 0 if every item
+// succeeded, otherwise the code of the most serious kind of failure. A run
+// that only failed transiently can simply be retried.
+func (s RunSummary) ExitCode() int {
+	switch {
+	case s.Internal > 0:
+		return ExitInternal
+	case s.Config > 0:
+		return ExitConfig
+	case s.Conflict > 0:
+		return ExitConflict
+	case s.Transient > 0:
+		return ExitTransient
+	}
+	return 0
+}
+
+// String describes the run, e.g. "5 items: 1 updated, 2 failed (1 transient,
+// 1 conflict)"
+func (s RunSummary) String() string {
+	text := fmt.Sprintf("%d items: %d updated", s.Items, s.Updated)
+	if s.Failed() == 0 {
+		return text
+	}
+
+	text += fmt.Sprintf(", %d failed (", s.Failed())
+	sep := ""
+	for _, kind := range []struct {
+		n    int
+		name FailureKind
+	}{{s.Transient, FailureTransient}, {s.Config, FailureConfig}, {s.Conflict, FailureConflict}, {s.Internal, FailureInternal}} {
+		if kind.n > 0 {
+			text += fmt.Sprintf("%s%d %s", sep, kind.n, kind.name)
+			sep = ", "
+		}
+	}
+	return text + ")"
+}
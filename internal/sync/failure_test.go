@@ -0,0 +1,106 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+	gogithub "github.com/google/go-github/v52/github"
+)
+
+func TestClassifyError(t *testing.T) {
+	status := func(code int) error {
+		return fmt.Errorf("error getting file content: %w", &gogithub.ErrorResponse{Response: &http.Response{StatusCode: code}})
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want FailureKind
+	}{
+		{"timeout", fmt.Errorf("fetch: %w", context.DeadlineExceeded), FailureTransient},
+		{"rate limited", fmt.Errorf("fetch: %w", &url.Error{Op: "Get", Err: &github.RateLimitedError{}}), FailureTransient},
+		{"rate limit", fmt.Errorf("fetch: %w", &gogithub.RateLimitError{}), FailureTransient},
+		{"server error", status(http.StatusBadGateway), FailureTransient},
+		{"not found", status(http.StatusNotFound), FailureConfig},
+		{"forbidden", status(http.StatusForbidden), FailureConfig},
+		{"bad token", github.ErrBadCredentials, FailureConfig},
+		{"missing function", fmt.Errorf("function %s %w", "Parse", ErrNotFound), FailureConfig},
+		{"raw rate limit", fmt.Errorf("error fetching asset: %w", github.ErrorForStatus(http.StatusTooManyRequests)), FailureTransient},
+		{"conflict", ErrConflict, FailureConflict},
+		{"other", errors.New("failed to write file"), FailureInternal},
+		{"none", nil, FailureInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyError(tt.err); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFailureOf(t *testing.T) {
+	if kind := failureOf(&SyncReport{}, errors.New("ignored")); kind != "" {
+		t.Errorf("Expected no failure without errors, got %s", kind)
+	}
+	if kind := failureOf(&SyncReport{Errors: []string{"conflict"}, Conflict: true}, nil); kind != FailureConflict {
+		t.Errorf("Expected conflict, got %s", kind)
+	}
+
+	report := &SyncReport{Errors: []string{"Error checking remote changes"}, cause: context.DeadlineExceeded}
+	if kind := failureOf(report, nil); kind != FailureTransient {
+		t.Errorf("Expected the recorded cause to be classified, got %s", kind)
+	}
+}
+
+func TestRunItemRecoversPanic(t *testing.T) {
+	t.Chdir(t.TempDir())
+	sm := newTestManager(t)
+	sm.githubClient = nil // Any API call panics
+
+	item := config.SyncItem{
+		Name:   "logger",
+		Source: config.SyncSource{Owner: "acme", Repo: "utils", Path: "logger.go", Branch: "main"},
+		Target: config.SyncTarget{Path: "logger.go", Type: "file"},
+	}
+
+	report := sm.runItem(item)
+	if report.Failure != FailureInternal || len(report.Errors) == 0 || !strings.HasPrefix(report.Errors[len(report.Errors)-1], "panic: ") {
+		t.Errorf("Expected the panic to be reported, got %+v", report)
+	}
+}
+
+func TestRunSummary(t *testing.T) {
+	reports := []*SyncReport{
+		{UpdatedFiles: []string{"a.go"}},
+		{},
+		{Errors: []string{"x"}, Failure: FailureTransient},
+		{Errors: []string{"y"}, Failure: FailureConflict},
+	}
+
+	summary := SummarizeRun(reports)
+	if summary.Items != 4 || summary.Updated != 1 || summary.Failed() != 2 {
+		t.Errorf("Unexpected summary: %+v", summary)
+	}
+	if got := summary.String(); got != "4 items: 1 updated, 2 failed (1 transient, 1 conflict)" {
+		t.Errorf("Unexpected summary text: %q", got)
+	}
+	if summary.ExitCode() != ExitConflict {
+		t.Errorf("Expected conflicts to outrank transient failures, got %d", summary.ExitCode())
+	}
+
+	if code := SummarizeRun(reports[:2]).ExitCode(); code != 0 {
+		t.Errorf("Expected success, got %d", code)
+	}
+	if code := SummarizeRun(reports[2:3]).ExitCode(); code != ExitTransient {
+		t.Errorf("Expected transient exit code, got %d", code)
+	}
+}
@@ -0,0 +1,241 @@
+package sync
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/gitsource"
+)
+
+// GCOptions controls garbage collection of the state directory
+type GCOptions struct {
+	DryRun bool          // Report what would be removed without removing it
+	MaxAge time.Duration // Age after which an unfinished run's progress is abandoned
+
+	ExternalItems bool // The items include those defined outside the config file, e.g. as SyncItem resources
+
+	CacheMaxAge  time.Duration // Clones and cached responses unchanged for longer are removed; 0 keeps them
+	CacheMaxSize int64         // Least recently changed clones beyond this many bytes are removed; 0 for no limit
+	BackupMaxAge time.Duration // Backups older than this are removed; 0 keeps them
+
+	Now func() time.Time // Clock the age is measured with; time.Now if nil
+}
+
+// Garbage is a file in the state directory that is no longer needed
+type Garbage struct {
+	Path   string // Relative to the state directory
+	Reason string
+	Size   int64
+}
+
+// reservedStateFiles are top-level state files that don't belong to an item
+var reservedStateFiles = map[string]bool{
+	digestName:        true, // Pending notification digest
+	conflictsName:     true, // Conflict inbox
+	externalItemsName: true, // Where items come from besides the config file
+}
+
+// externalItemsName marks a state directory whose items are defined outside
+// the config file, which CollectGarbage can't see for itself
+const externalItemsName = "external-items"
+
+// MarkExternalItems records that items are defined outside the config file,
+// by source, so that CollectGarbage refuses to run without them
+func (sm *SyncManager) MarkExternalItems(source string) error {
+	return sm.store.write(externalItemsName, []byte(source))
+}
+
+// entry is a clone or backup, which is removed as a whole
+type entry struct {
+	path     string // Relative to the state directory
+	size     int64
+	modified time.Time // Latest modification of a file in it
+}
+
+// CollectGarbage removes files in the state directory that are no longer
+// needed: the state, snapshots and undo records of removed items, clones of git remotes no
+// item uses, the progress of a run abandoned for longer than MaxAge, and
+// clones, cached responses and backups beyond the cache and backup budgets.
+// It returns what was removed, or with DryRun what would be. It refuses to
+// run on the state of items defined outside the config file unless
+// ExternalItems says they are among items.
+func CollectGarbage(stateDir string, items []config.SyncItem, opts GCOptions) ([]Garbage, error) {
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	if _, err := os.Stat(filepath.Join(stateDir, externalItemsName)); err == nil && !opts.ExternalItems {
+		return nil, fmt.Errorf("state directory %s has items defined outside the config file, whose state would be removed", stateDir)
+	}
+
+	known := make(map[string]bool, len(items))
+	clones := make(map[string]bool)
+	for _, item := range items {
+		known[sanitizeFilename(item.Name)] = true
+		if item.Source.ProviderName() == config.ProviderGit {
+			clones[gitsource.CacheKey(item.Source.URL)] = true
+		}
+	}
+
+	var garbage []Garbage
+	var cached []entry
+	err := filepath.WalkDir(stateDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(stateDir, path)
+		if err != nil {
+			return err
+		}
+
+		switch dir, name := filepath.Split(filepath.ToSlash(rel)); dir {
+		case "git/":
+			e, err := scanEntry(path, rel)
+			if err != nil {
+				return err
+			}
+			if !clones[name] {
+				garbage = append(garbage, Garbage{Path: rel, Reason: "clone of a git remote no longer configured", Size: e.size})
+			} else {
+				cached = append(cached, e)
+			}
+			return skipEntry(d)
+		case backupsDir + "/":
+			e, err := scanEntry(path, rel)
+			if err != nil {
+				return err
+			}
+			if opts.BackupMaxAge > 0 && opts.Now().Sub(e.modified) > opts.BackupMaxAge {
+				garbage = append(garbage, Garbage{Path: rel, Reason: fmt.Sprintf("backup older than %s", opts.BackupMaxAge), Size: e.size})
+			}
+			return skipEntry(d)
+		case undoDir + "/":
+			e, err := scanEntry(path, rel)
+			if err != nil {
+				return err
+			}
+			if !known[name] {
+				garbage = append(garbage, Garbage{Path: rel, Reason: "undo record of an item no longer configured", Size: e.size})
+			}
+			return skipEntry(d)
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if reason := garbageReason(filepath.ToSlash(rel), info, known, opts); reason != "" {
+			garbage = append(garbage, Garbage{Path: rel, Reason: reason, Size: info.Size()})
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to scan state directory: %w", err)
+	}
+
+	garbage = append(garbage, overBudget(cached, opts)...)
+	sort.Slice(garbage, func(i, j int) bool { return garbage[i].Path < garbage[j].Path })
+
+	if opts.DryRun {
+		return garbage, nil
+	}
+	for i, g := range garbage {
+		if err := os.RemoveAll(filepath.Join(stateDir, g.Path)); err != nil {
+			return garbage[:i], fmt.Errorf("failed to remove %s: %w", g.Path, err)
+		}
+	}
+	return garbage, nil
+}
+
+// garbageReason says why a state file can be removed, or returns "" to keep it
+func garbageReason(rel string, info fs.FileInfo, known map[string]bool, opts GCOptions) string {
+	dir, name := filepath.Split(rel)
+
+	switch dir {
+	case "":
+		if reservedStateFiles[name] {
+			return ""
+		}
+		if item, ok := strings.CutSuffix(name, ".json"); ok && !known[item] {
+			return "state of an item no longer configured"
+		}
+	case "snapshots/":
+		item := strings.TrimSuffix(strings.TrimSuffix(name, ".chain"), ".snap")
+		if !known[item] {
+			return "snapshot of an item no longer configured"
+		}
+	case "runs/":
+		if opts.MaxAge > 0 && opts.Now().Sub(info.ModTime()) > opts.MaxAge {
+			if rel != filepath.ToSlash(progressName) {
+				return fmt.Sprintf("record of a run over %s old", opts.MaxAge)
+			}
+			return fmt.Sprintf("progress of a run abandoned over %s ago", opts.MaxAge)
+		}
+	case httpCacheDir + "/":
+		if opts.CacheMaxAge > 0 && opts.Now().Sub(info.ModTime()) > opts.CacheMaxAge {
+			return fmt.Sprintf("cached response unchanged for over %s", opts.CacheMaxAge)
+		}
+	}
+	return ""
+}
+
+// overBudget returns the clones still in use that are too old, and then the
+// least recently changed ones until the rest fit the cache size. Removed
+// clones are fetched again when next needed.
+func overBudget(cached []entry, opts GCOptions) []Garbage {
+	sort.Slice(cached, func(i, j int) bool { return cached[i].modified.After(cached[j].modified) })
+
+	var garbage []Garbage
+	var total int64
+	for _, e := range cached {
+		switch {
+		case opts.CacheMaxAge > 0 && opts.Now().Sub(e.modified) > opts.CacheMaxAge:
+			garbage = append(garbage, Garbage{Path: e.path, Reason: fmt.Sprintf("clone unchanged for over %s", opts.CacheMaxAge), Size: e.size})
+		case opts.CacheMaxSize > 0 && total+e.size > opts.CacheMaxSize:
+			garbage = append(garbage, Garbage{Path: e.path, Reason: fmt.Sprintf("clone beyond the cache size of %d bytes", opts.CacheMaxSize), Size: e.size})
+		default:
+			total += e.size
+		}
+	}
+	return garbage
+}
+
+// scanEntry measures a clone or backup, which may be a file or a directory
+func scanEntry(path, rel string) (entry, error) {
+	e := entry{path: rel}
+	err := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		e.size += info.Size()
+		if info.ModTime().After(e.modified) {
+			e.modified = info.ModTime()
+		}
+		return nil
+	})
+	return e, err
+}
+
+// skipEntry stops the walk from descending into an entry scanned as a whole
+func skipEntry(d fs.DirEntry) error {
+	if d.IsDir() {
+		return filepath.SkipDir
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/gitsource"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"kept.json", "team_kept.json", "removed.json", "digest.json",
+		"snapshots/kept.chain", "snapshots/removed.chain", "snapshots/removed.snap",
+		"runs/current.json",
+	} {
+		writeTestFile(t, filepath.Join(dir, name), "{}")
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(filepath.Join(dir, "runs", "current.json"), old, old)
+
+	items := []config.SyncItem{{Name: "kept"}, {Name: "team/kept"}}
+	opts := GCOptions{DryRun: true, MaxAge: 24 * time.Hour}
+
+	garbage, err := CollectGarbage(dir, items, opts)
+	if err != nil {
+		t.Fatalf("CollectGarbage failed: %v", err)
+	}
+
+	want := []string{"removed.json", "runs/current.json", "snapshots/removed.chain", "snapshots/removed.snap"}
+	if len(garbage) != len(want) {
+		t.Fatalf("Expected %v, got %+v", want, garbage)
+	}
+	for i, g := range garbage {
+		if filepath.ToSlash(g.Path) != want[i] || g.Reason == "" || g.Size != 2 {
+			t.Errorf("Unexpected garbage %+v, want %s", g, want[i])
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "removed.json")); err != nil {
+		t.Error("Expected a dry run to keep files")
+	}
+
+	opts.DryRun = false
+	if _, err := CollectGarbage(dir, items, opts); err != nil {
+		t.Fatalf("CollectGarbage failed: %v", err)
+	}
+	for _, name := range want {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", name)
+		}
+	}
+	for _, name := range []string{"kept.json", "team_kept.json", "digest.json", "snapshots/kept.chain"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %s to be kept", name)
+		}
+	}
+}
+
+func TestCollectGarbageKeepsRecentRuns(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "runs", "current.json"), "{}")
+
+	garbage, err := CollectGarbage(dir, nil, GCOptions{MaxAge: time.Hour})
+	if err != nil || len(garbage) != 0 {
+		t.Errorf("Expected a recent run to be kept, got %+v, %v", garbage, err)
+	}
+
+	later := func() time.Time { return time.Now().Add(2 * time.Hour) }
+	garbage, err = CollectGarbage(dir, nil, GCOptions{DryRun: true, MaxAge: time.Hour, Now: later})
+	if err != nil || len(garbage) != 1 {
+		t.Errorf("Expected the run to be abandoned two hours later, got %+v, %v", garbage, err)
+	}
+}
+
+func TestCollectGarbageRemovesUnusedClones(t *testing.T) {
+	dir := t.TempDir()
+	used := gitsource.CacheKey("https://git.example.com/utils.git")
+	for _, name := range []string{"git/" + used + "/HEAD", "git/0123456789abcdef/HEAD", "git/0123456789abcdef/objects/pack/p.pack"} {
+		writeTestFile(t, filepath.Join(dir, name), "ref")
+	}
+
+	items := []config.SyncItem{{Name: "utils", Source: config.SyncSource{Provider: config.ProviderGit, URL: "https://git.example.com/utils.git"}}}
+	garbage, err := CollectGarbage(dir, items, GCOptions{})
+	if err != nil {
+		t.Fatalf("CollectGarbage failed: %v", err)
+	}
+	if len(garbage) != 1 || filepath.ToSlash(garbage[0].Path) != "git/0123456789abcdef" || garbage[0].Size != 6 {
+		t.Fatalf("Expected the unused clone, got %+v", garbage)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "git", "0123456789abcdef")); !os.IsNotExist(err) {
+		t.Error("Expected the unused clone to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "git", used, "HEAD")); err != nil {
+		t.Error("Expected the used clone to be kept")
+	}
+}
+
+func TestCollectGarbageBudgets(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	urls := []string{"https://git.example.com/a.git", "https://git.example.com/b.git", "https://git.example.com/c.git"}
+	var items []config.SyncItem
+	for i, url := range urls {
+		path := filepath.Join(dir, "git", gitsource.CacheKey(url), "pack")
+		writeTestFile(t, path, "0123456789")
+		fetched := now.Add(-time.Duration(i*10) * 24 * time.Hour)
+		os.Chtimes(path, fetched, fetched)
+		items = append(items, config.SyncItem{Name: url, Source: config.SyncSource{Provider: config.ProviderGit, URL: url}})
+	}
+	writeTestFile(t, filepath.Join(dir, "backups", "old", "state.json"), "{}")
+	writeTestFile(t, filepath.Join(dir, "backups", "new.tar"), "{}")
+	old := now.Add(-100 * 24 * time.Hour)
+	os.Chtimes(filepath.Join(dir, "backups", "old", "state.json"), old, old)
+	writeTestFile(t, filepath.Join(dir, "http", "0123"), "{}")
+	writeTestFile(t, filepath.Join(dir, "http", "4567"), "{}")
+	os.Chtimes(filepath.Join(dir, "http", "0123"), old, old)
+
+	opts := GCOptions{DryRun: true, CacheMaxAge: 15 * 24 * time.Hour, CacheMaxSize: 10, BackupMaxAge: 90 * 24 * time.Hour}
+	garbage, err := CollectGarbage(dir, items, opts)
+	if err != nil {
+		t.Fatalf("CollectGarbage failed: %v", err)
+	}
+
+	// a is kept, b is beyond the size budget and c too old
+	want := map[string]bool{
+		"backups/old":                        true,
+		"http/0123":                          true,
+		"git/" + gitsource.CacheKey(urls[1]): true,
+		"git/" + gitsource.CacheKey(urls[2]): true,
+	}
+	if len(garbage) != len(want) {
+		t.Fatalf("Expected %v, got %+v", want, garbage)
+	}
+	for _, g := range garbage {
+		if !want[filepath.ToSlash(g.Path)] {
+			t.Errorf("Unexpected garbage %+v", g)
+		}
+	}
+}
+
+func TestCollectGarbageExternalItems(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "from-crd.json"), "{}")
+	sm, err := NewSyncManager(&config.Config{Version: "1.0"}, dir, Offline())
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	if err := sm.MarkExternalItems("SyncItem resources in default"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the items defined elsewhere, their state would look unused
+	if _, err := CollectGarbage(dir, nil, GCOptions{}); err == nil {
+		t.Error("Expected gc to refuse without the external items")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "from-crd.json")); err != nil {
+		t.Errorf("Expected the state to be kept: %v", err)
+	}
+
+	garbage, err := CollectGarbage(dir, []config.SyncItem{{Name: "from-crd"}}, GCOptions{ExternalItems: true})
+	if err != nil || len(garbage) != 0 {
+		t.Errorf("Expected nothing to be removed, got %+v, %v", garbage, err)
+	}
+}
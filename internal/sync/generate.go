@@ -0,0 +1,108 @@
+package sync
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+// checkGenerated runs an item's generate command and returns the outputs it
+// changed, which were stale. The outputs are restored afterwards, so the
+// check leaves the workspace as it found it; failing to restore them is an
+// error.
+func checkGenerated(gen *config.GenerateConfig) (stale []string, err error) {
+	before, err := readOutputs(gen)
+	if err != nil {
+		return nil, err
+	}
+
+	// Put back whatever the command changed, even if it failed halfway
+	defer func() {
+		after, readErr := readOutputs(gen)
+		if readErr != nil {
+			err = errors.Join(err, fmt.Errorf("failed to restore generated outputs: %w", readErr))
+			return
+		}
+		for path := range after {
+			if _, ok := before[path]; !ok {
+				if removeErr := os.Remove(path); removeErr != nil {
+					err = errors.Join(err, fmt.Errorf("failed to remove generated %s: %w", path, removeErr))
+				}
+			}
+		}
+		for path, content := range before {
+			if !bytes.Equal(after[path], content) {
+				if writeErr := os.WriteFile(path, content, 0644); writeErr != nil {
+					err = errors.Join(err, fmt.Errorf("failed to restore %s: %w", path, writeErr))
+				}
+			}
+		}
+		if err != nil {
+			stale = nil
+		}
+	}()
+
+	cmd := exec.Command("sh", "-c", gen.Command)
+	cmd.Dir = gen.Dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("generate command failed: %w: %s", err, bytes.TrimSpace(out))
+	}
+
+	after, err := readOutputs(gen)
+	if err != nil {
+		return nil, err
+	}
+
+	for path, content := range after {
+		if previous, ok := before[path]; !ok || !bytes.Equal(previous, content) {
+			stale = append(stale, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			stale = append(stale, path)
+		}
+	}
+	sort.Strings(stale)
+
+	return stale, nil
+}
+
+// readOutputs reads the files matched by the generate outputs, descending
+// into directories
+func readOutputs(gen *config.GenerateConfig) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+
+	for _, pattern := range gen.Outputs {
+		matches, err := filepath.Glob(filepath.Join(gen.Dir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid generate output '%s': %w", pattern, err)
+		}
+
+		for _, match := range matches {
+			err := filepath.WalkDir(match, func(path string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				content, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				files[path] = content
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error reading generated output: %w", err)
+			}
+		}
+	}
+
+	return files, nil
+}
@@ -0,0 +1,62 @@
+package sync
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+func TestCheckGenerated(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	writeTestFile(t, "api.txt", "v2")
+	writeTestFile(t, "gen/client.txt", "v1")
+	writeTestFile(t, "gen/models.txt", "same")
+
+	gen := &config.GenerateConfig{
+		Command: "cp api.txt gen/client.txt && echo new > gen/extra.txt",
+		Outputs: []string{"gen"},
+	}
+
+	stale, err := checkGenerated(gen)
+	if err != nil {
+		t.Fatalf("checkGenerated failed: %v", err)
+	}
+	if len(stale) != 2 || stale[0] != "gen/client.txt" || stale[1] != "gen/extra.txt" {
+		t.Errorf("Unexpected stale outputs: %v", stale)
+	}
+
+	// The check doesn't leave changes behind
+	if content, _ := os.ReadFile("gen/client.txt"); string(content) != "v1" {
+		t.Errorf("Expected output to be restored, got %q", content)
+	}
+	if _, err := os.Stat("gen/extra.txt"); !os.IsNotExist(err) {
+		t.Error("Expected new output to be removed")
+	}
+
+	writeTestFile(t, "gen/client.txt", "v2")
+	if stale, err := checkGenerated(gen); err != nil || len(stale) != 1 {
+		t.Errorf("Expected only the extra file to be stale: %v %v", stale, err)
+	}
+
+	gen.Command = "exit 3"
+	if _, err := checkGenerated(gen); err == nil {
+		t.Error("Expected failing command to be reported")
+	}
+}
+
+func TestCheckGeneratedReportsRestoreFailure(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeTestFile(t, "gen/client.txt", "v1")
+
+	// The output is replaced by a directory, which can't be written back to
+	gen := &config.GenerateConfig{
+		Command: "rm gen/client.txt && mkdir gen/client.txt && touch gen/client.txt/x",
+		Outputs: []string{"gen"},
+	}
+	if _, err := checkGenerated(gen); err == nil || !strings.Contains(err.Error(), "failed to restore gen/client.txt") {
+		t.Errorf("Expected the restore failure to be reported, got %v", err)
+	}
+}
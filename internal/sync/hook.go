@@ -0,0 +1,100 @@
+package sync
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+// ManagedEdit is a changed path holding an item's target that was edited
+// since the item last synced
+type ManagedEdit struct {
+	Item string
+	Path string
+}
+
+// ManagedEdits returns the paths among changed that hold a synced item's
+// target whose local content no longer matches what the item last synced,
+// as a sync would report local changes. Updates written by a sync match, so
+// committing them passes.
+func (sm *SyncManager) ManagedEdits(changed []string) ([]ManagedEdit, error) {
+	paths := map[string]string{}
+	for _, p := range changed {
+		if abs, err := filepath.Abs(p); err == nil {
+			paths[abs] = p
+		}
+	}
+
+	var edits []ManagedEdit
+	for _, item := range sm.Items() {
+		if item.Disabled {
+			continue
+		}
+		state, err := sm.loadState(item.Name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if state.CurrentLocalHash == "" {
+			continue // Nothing synced to compare with
+		}
+		if state.RelocatedPath != "" {
+			item.Target.Path = state.RelocatedPath
+		}
+
+		touched := touchedTargets(item, paths)
+		if len(touched) == 0 {
+			continue
+		}
+
+		edited, _, err := sm.checkLocalChanges(item, state.CurrentLocalHash)
+		if err != nil {
+			// A deleted target is an edit too
+			edited = true
+		}
+		if !edited {
+			continue
+		}
+		for _, p := range touched {
+			edits = append(edits, ManagedEdit{Item: item.Name, Path: p})
+		}
+	}
+	return edits, nil
+}
+
+// touchedTargets returns the changed paths, keyed by absolute path, that hold
+// the item's target
+func touchedTargets(item config.SyncItem, paths map[string]string) []string {
+	targets := []string{item.Target.Path}
+	if item.Target.Type == "region" {
+		// No file having the region means none was touched
+		targets, _ = regionTargets(item)
+	}
+
+	// The changelog in a directory target is codesync's own
+	changelog := ""
+	if item.Changelog {
+		changelog, _ = filepath.Abs(changelogPath(item))
+	}
+
+	var touched []string
+	for _, target := range targets {
+		abs, err := filepath.Abs(target)
+		if err != nil {
+			continue
+		}
+		for p, changed := range paths {
+			if p == changelog {
+				continue
+			}
+			if p == abs || item.Target.Type == "directory" && strings.HasPrefix(p, abs+string(filepath.Separator)) {
+				touched = append(touched, changed)
+			}
+		}
+	}
+	sort.Strings(touched)
+	return touched
+}
@@ -0,0 +1,60 @@
+package sync
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+func TestManagedEdits(t *testing.T) {
+	t.Chdir(t.TempDir())
+	sm := newTestManager(t)
+
+	function := functionItem("off")
+	dir := config.SyncItem{
+		Name:   "protos",
+		Source: config.SyncSource{Owner: "acme", Repo: "api", Path: "proto"},
+		Target: config.SyncTarget{Path: "proto", Type: "directory"},
+	}
+	unsynced := config.SyncItem{
+		Name:   "readme",
+		Source: config.SyncSource{Owner: "acme", Repo: "api", Path: "README.md"},
+		Target: config.SyncTarget{Path: "README.md", Type: "file"},
+	}
+	sm.SetItems([]config.SyncItem{function, dir, unsynced})
+
+	writeTestFile(t, function.Target.Path, "package util\n\nfunc TrimAll(s string) string {\n\treturn s\n}\n")
+	writeTestFile(t, filepath.Join("proto", "user.proto"), "syntax = \"proto3\";\n")
+	writeTestFile(t, "README.md", "# API\n")
+	for _, item := range []config.SyncItem{function, dir} {
+		_, hash, err := sm.checkLocalChanges(item, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sm.saveState(item.Name, State{CurrentLocalHash: hash}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	changed := []string{function.Target.Path, "proto/user.proto", "README.md"}
+	if edits, err := sm.ManagedEdits(changed); err != nil || len(edits) != 0 {
+		t.Fatalf("Expected synced content to pass, got %+v %v", edits, err)
+	}
+
+	writeTestFile(t, function.Target.Path, "package util\n\nfunc TrimAll(s string) string {\n\treturn s + \"!\"\n}\n")
+	writeTestFile(t, filepath.Join("proto", "user.proto"), "syntax = \"proto2\"; // edited\n")
+	edits, err := sm.ManagedEdits(changed)
+	if err != nil {
+		t.Fatalf("ManagedEdits failed: %v", err)
+	}
+	want := []ManagedEdit{{Item: "trim", Path: function.Target.Path}, {Item: "protos", Path: "proto/user.proto"}}
+	if len(edits) != len(want) || edits[0] != want[0] || edits[1] != want[1] {
+		t.Errorf("Expected %+v, got %+v", want, edits)
+	}
+
+	// Only changed paths count
+	if edits, _ := sm.ManagedEdits([]string{"README.md"}); len(edits) != 0 {
+		t.Errorf("Expected unchanged targets not to count, got %+v", edits)
+	}
+}
@@ -0,0 +1,170 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+// journalDir holds the write-ahead journals of multi-file updates
+const journalDir = "journal"
+
+// Journal records the writes of a multi-file update before they are made,
+// so that an update a crash interrupted can be rolled back, or forward once
+// every write was made. It's removed once the item's state records the
+// update.
+type Journal struct {
+	Item     string            `json:"item"`
+	CommitID string            `json:"commitId"`        // Upstream commit the update syncs
+	Root     string            `json:"root"`            // Target directory, which directories left empty are removed up to
+	Files    map[string]string `json:"files,omitempty"` // Hashes of the directory's files once updated, by local path
+	Writes   []JournalWrite    `json:"writes"`
+	Applied  bool              `json:"applied"` // Every write was made; only the item's state is missing
+}
+
+// JournalWrite is a file written or removed by a multi-file update, with
+// what it replaces
+type JournalWrite struct {
+	Path     string `json:"path"` // Absolute
+	Content  []byte `json:"content,omitempty"`
+	Remove   bool   `json:"remove,omitempty"`
+	Previous []byte `json:"previous,omitempty"`
+	Existed  bool   `json:"existed"`
+}
+
+// journalName returns the store name of an item's journal
+func journalName(itemName string) string {
+	return filepath.Join(journalDir, sanitizeFilename(itemName)+".json")
+}
+
+func (sm *SyncManager) saveJournal(journal *Journal) error {
+	data, err := json.Marshal(journal)
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal: %w", err)
+	}
+	if err := sm.store.write(journalName(journal.Item), data); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return nil
+}
+
+// clearJournal removes an item's journal, if it has one
+func (sm *SyncManager) clearJournal(itemName string) error {
+	if err := sm.store.remove(journalName(itemName)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove journal: %w", err)
+	}
+	return nil
+}
+
+// writeJournaled makes the writes of a multi-file update, journaling them
+// first. A failed write rolls back the ones made before it. The journal stays
+// until the item's state is saved.
+func (sm *SyncManager) writeJournaled(journal *Journal) error {
+	if len(journal.Writes) == 0 {
+		return nil
+	}
+	if err := sm.saveJournal(journal); err != nil {
+		return err
+	}
+
+	for i, w := range journal.Writes {
+		if err := sm.applyWrite(journal.Root, w); err != nil {
+			if rollbackErr := sm.rollBack(journal.Root, journal.Writes[:i+1]); rollbackErr != nil {
+				return fmt.Errorf("%w; rolling back failed, so the journal is kept: %v", err, rollbackErr)
+			}
+			if clearErr := sm.clearJournal(journal.Item); clearErr != nil {
+				return fmt.Errorf("%w; %v", err, clearErr)
+			}
+			return err
+		}
+	}
+
+	journal.Applied = true
+	return sm.saveJournal(journal)
+}
+
+// applyWrite makes a journaled write. Files already removed stay removed, so
+// a write can be made again.
+func (sm *SyncManager) applyWrite(root string, w JournalWrite) error {
+	if w.Remove {
+		if err := sm.files.remove(w.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", w.Path, err)
+		}
+		sm.files.removeEmptyDirs(filepath.Dir(w.Path), root)
+		return nil
+	}
+	if err := sm.files.mkdirAll(filepath.Dir(w.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := sm.files.writeFile(w.Path, w.Content, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", w.Path, err)
+	}
+	return nil
+}
+
+// rollBack restores what journaled writes replaced, last write first
+func (sm *SyncManager) rollBack(root string, writes []JournalWrite) error {
+	for i := len(writes) - 1; i >= 0; i-- {
+		w := writes[i]
+		undo := JournalWrite{Path: w.Path, Content: w.Previous, Remove: !w.Existed}
+		if err := sm.applyWrite(root, undo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recoverJournal finishes a multi-file update of an item that an earlier run
+// was interrupted in: one whose writes were all made is rolled forward and
+// recorded in the item's state, any other is rolled back. It describes what
+// it did, or returns "" if there was nothing to recover.
+func (sm *SyncManager) recoverJournal(item config.SyncItem) (string, error) {
+	data, err := sm.store.read(journalName(item.Name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read journal: %w", err)
+	}
+	var journal Journal
+	if err := json.Unmarshal(data, &journal); err != nil {
+		return "", fmt.Errorf("invalid journal: %w", err)
+	}
+
+	if !journal.Applied {
+		if err := sm.rollBack(journal.Root, journal.Writes); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("rolled back %d file(s) of an interrupted update to %s", len(journal.Writes), journal.CommitID),
+			sm.clearJournal(item.Name)
+	}
+
+	for _, w := range journal.Writes {
+		if err := sm.applyWrite(journal.Root, w); err != nil {
+			return "", err
+		}
+	}
+	state, err := sm.loadState(item.Name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+	_, localHash, err := sm.checkLocalChanges(item, "")
+	if err != nil {
+		return "", err
+	}
+	state.LastCommitID = journal.CommitID
+	state.CurrentLocalHash = localHash
+	state.HasLocalChanges = false
+	state.HasRemoteChanges = false
+	if journal.Files != nil {
+		state.Files = journal.Files
+	}
+	if err := sm.saveState(item.Name, state); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("rolled forward an interrupted update to %s", journal.CommitID), sm.clearJournal(item.Name)
+}
@@ -0,0 +1,81 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+func TestRecoverJournal(t *testing.T) {
+	t.Chdir(t.TempDir())
+	sm := newTestManager(t)
+
+	item := config.SyncItem{
+		Name:   "docs",
+		Source: config.SyncSource{Owner: "acme", Repo: "lib", Path: "docs", Branch: "main"},
+		Target: config.SyncTarget{Path: "docs", Type: "directory"},
+	}
+	root, err := filepath.Abs("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal := func(applied bool) *Journal {
+		return &Journal{
+			Item:     item.Name,
+			CommitID: "c2",
+			Root:     root,
+			Files:    map[string]string{"index.md": calculateHash("# New\n"), "guide/new.md": calculateHash("new\n")},
+			Writes: []JournalWrite{
+				{Path: filepath.Join(root, "index.md"), Content: []byte("# New\n"), Previous: []byte("# Old\n"), Existed: true},
+				{Path: filepath.Join(root, "guide", "new.md"), Content: []byte("new\n")},
+				{Path: filepath.Join(root, "old.md"), Remove: true, Previous: []byte("old\n"), Existed: true},
+			},
+			Applied: applied,
+		}
+	}
+
+	// Interrupted after the first two writes
+	writeTestFile(t, "docs/index.md", "# New\n")
+	writeTestFile(t, "docs/guide/new.md", "new\n")
+	writeTestFile(t, "docs/old.md", "old\n")
+	if err := sm.saveJournal(journal(false)); err != nil {
+		t.Fatal(err)
+	}
+	if recovered, err := sm.recoverJournal(item); err != nil || recovered == "" {
+		t.Fatalf("Expected the update to be rolled back, got %q, %v", recovered, err)
+	}
+	if content, _ := os.ReadFile("docs/index.md"); string(content) != "# Old\n" {
+		t.Errorf("Expected the rewritten file to be restored, got %q", content)
+	}
+	if _, err := os.Stat("docs/guide"); !os.IsNotExist(err) {
+		t.Errorf("Expected the created file and its directory to be removed, got %v", err)
+	}
+	if content, _ := os.ReadFile("docs/old.md"); string(content) != "old\n" {
+		t.Errorf("Expected the removed file to stay, got %q", content)
+	}
+	if recovered, err := sm.recoverJournal(item); err != nil || recovered != "" {
+		t.Errorf("Expected the journal to be cleared, got %q, %v", recovered, err)
+	}
+
+	// Interrupted after every write, before the state was saved
+	writeTestFile(t, "docs/index.md", "# New\n")
+	os.Remove("docs/old.md")
+	if err := sm.saveJournal(journal(true)); err != nil {
+		t.Fatal(err)
+	}
+	if recovered, err := sm.recoverJournal(item); err != nil || recovered == "" {
+		t.Fatalf("Expected the update to be rolled forward, got %q, %v", recovered, err)
+	}
+	if content, _ := os.ReadFile("docs/guide/new.md"); string(content) != "new\n" {
+		t.Errorf("Expected the missing write to be made, got %q", content)
+	}
+	state, err := sm.loadState(item.Name)
+	if err != nil || state.LastCommitID != "c2" || len(state.Files) != 2 {
+		t.Fatalf("Expected the update to be recorded, got %+v, %v", state, err)
+	}
+	if changed, _, err := sm.checkLocalChanges(item, state.CurrentLocalHash); err != nil || changed {
+		t.Errorf("Expected the updated directory not to count as a local change, got %v, %v", changed, err)
+	}
+}
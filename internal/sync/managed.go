@@ -0,0 +1,92 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+// ManagedFile describes an item that syncs into a file, for editors to show
+// where the file's code comes from and how stale it is
+type ManagedFile struct {
+	Item          string    `json:"item"`
+	Source        string    `json:"source"` // owner/repo/path@branch, or the URL of a git source
+	Type          string    `json:"type"`
+	Function      string    `json:"function,omitempty"` // Synced function of a function target
+	Marker        string    `json:"marker,omitempty"`   // Synced region of a region target
+	LastSync      time.Time `json:"lastSync,omitzero"`
+	LastCommitID  string    `json:"lastCommitId,omitempty"`
+	CommitsBehind int       `json:"commitsBehind,omitempty"` // Upstream commits found by the last check and not applied
+	Edited        bool      `json:"edited,omitempty"`        // Changed locally since the item last synced
+	Conflict      string    `json:"conflict,omitempty"`      // ID of the item's open conflict
+}
+
+// Managed returns the enabled items that sync into the file at path
+func (sm *SyncManager) Managed(path string) ([]ManagedFile, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	paths := map[string]string{abs: path}
+
+	conflicts, err := sm.Conflicts(false)
+	if err != nil {
+		return nil, err
+	}
+	open := map[string]string{}
+	for _, c := range conflicts {
+		open[c.Item] = c.ID
+	}
+
+	var managed []ManagedFile
+	for _, item := range sm.Items() {
+		if item.Disabled {
+			continue
+		}
+		state, err := sm.loadState(item.Name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if state.RelocatedPath != "" {
+			item.Target.Path = state.RelocatedPath
+		}
+		if len(touchedTargets(item, paths)) == 0 {
+			continue
+		}
+
+		m := ManagedFile{
+			Item:          item.Name,
+			Source:        sourceName(item),
+			Type:          item.Target.Type,
+			Function:      item.Target.Function,
+			Marker:        item.Target.Marker,
+			LastSync:      state.LastSync,
+			LastCommitID:  state.LastCommitID,
+			CommitsBehind: state.CommitsBehind,
+			Conflict:      open[item.Name],
+		}
+		if state.CurrentLocalHash != "" {
+			edited, _, err := sm.checkLocalChanges(item, state.CurrentLocalHash)
+			m.Edited = edited || err != nil
+		}
+		managed = append(managed, m)
+	}
+	return managed, nil
+}
+
+// sourceName describes where an item syncs from
+func sourceName(item config.SyncItem) string {
+	s := item.Source
+	name := fmt.Sprintf("%s/%s/%s", s.Owner, s.Repo, s.Path)
+	if s.URL != "" {
+		name = s.URL + " " + s.Path
+	}
+	if ref := s.Ref(); ref != "" {
+		name += "@" + ref
+	}
+	return name
+}
@@ -0,0 +1,49 @@
+package sync
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/markdown"
+)
+
+// localSectionName returns the heading of the local section a markdown item
+// replaces
+func localSectionName(item config.SyncItem) string {
+	if item.Target.LocalSection != "" {
+		return item.Target.LocalSection
+	}
+	return item.Target.Section
+}
+
+// syncSection replaces the item's section of the local document with the
+// upstream one, rewriting relative links as configured
+func syncSection(item config.SyncItem, local, remote string) (string, error) {
+	section, err := markdown.Section(remote, item.Target.Section)
+	if err != nil {
+		return "", fmt.Errorf("upstream %w", err)
+	}
+
+	dir := path.Dir(item.Source.Path)
+	ref := item.Source.Ref()
+	if item.Source.Revision != "" {
+		ref = item.Source.Revision
+	}
+
+	switch item.Target.RewriteLinks {
+	case "absolute":
+		section = markdown.RewriteLinks(section, func(target string, image bool) string {
+			if image {
+				return fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/%s/%s", item.Source.Owner, item.Source.Repo, ref, path.Join(dir, target))
+			}
+			return fmt.Sprintf("https://github.com/%s/%s/blob/%s/%s", item.Source.Owner, item.Source.Repo, ref, path.Join(dir, target))
+		})
+	case "prefix":
+		section = markdown.RewriteLinks(section, func(target string, image bool) string {
+			return item.Target.LinkPrefix + path.Join(dir, target)
+		})
+	}
+
+	return markdown.ReplaceSection(local, localSectionName(item), section), nil
+}
@@ -0,0 +1,85 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/diff"
+	"github.com/exitflynn/codesync/internal/merge"
+)
+
+// errNoMerge is returned when an item's changes can't or mustn't be merged
+var errNoMerge = errors.New("changes not merged")
+
+// mergeChanges combines local edits with the upstream content using the
+// item's merge driver, or line by line without one, taking the upstream
+// content last synced as the base
+func (sm *SyncManager) mergeChanges(item config.SyncItem, lastCommit, remoteContent string) (string, error) {
+	// Structured items only take selected keys from upstream, which a whole
+	// file merge would defeat
+	if item.Target.Type != "file" || item.Target.Structured() {
+		return "", errNoMerge
+	}
+
+	name := sm.config.MergeDriverFor(item)
+	var driver merge.Driver = merge.DriverFunc(mergeLines)
+	if name != "" {
+		var err error
+		if driver, err = merge.Get(name); err != nil {
+			return "", err
+		}
+	} else if isNotebook(item) {
+		// Outputs would make most line merges of notebooks conflict
+		return "", errNoMerge
+	}
+
+	base, err := sm.mergeBase(item, lastCommit)
+	if err != nil {
+		return "", err
+	}
+
+	absPath, err := item.Target.GetAbsolutePath("")
+	if err != nil {
+		return "", err
+	}
+
+	local, err := sm.files.readFile(absPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read local file: %w", err)
+	}
+
+	merged, err := driver.Merge([]byte(base), local, []byte(remoteContent))
+	if err != nil && name != "" {
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return string(merged), nil
+}
+
+// mergeBase returns the upstream content last synced for an item: its
+// snapshot, or the file at the commit last synced for items synced before
+// snapshots were kept
+func (sm *SyncManager) mergeBase(item config.SyncItem, lastCommit string) (string, error) {
+	if base, err := sm.loadSnapshot(item.Name); err == nil {
+		return base, nil
+	}
+	if lastCommit == "" {
+		return "", errors.New("no previous sync to merge from")
+	}
+
+	file, err := sm.getFile(item, item.Source.Path, lastCommit)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch the version last synced: %w", err)
+	}
+	return sm.applyTransform(item, file.Content)
+}
+
+// mergeLines is the merge driver of file items without one
+func mergeLines(base, local, remote []byte) ([]byte, error) {
+	merged, err := diff.Merge(string(base), string(local), string(remote))
+	return []byte(merged), err
+}
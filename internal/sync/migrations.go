@@ -0,0 +1,113 @@
+package sync
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/migrations"
+)
+
+// syncMigrations adds new upstream migrations to a migrations directory.
+// Existing migrations are never changed. Migrations that upstream modified,
+// renumbered or inserted before existing ones are reported as errors, and
+// renumbering or reordering blocks the sync entirely. New migrations are
+// written through the item's journal, so a crash adds all of them or none.
+func (sm *SyncManager) syncMigrations(item config.SyncItem, commitID string, report *SyncReport) error {
+	files, err := sm.getDirectory(item, commitID)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("Failed to list upstream migrations: %v", err))
+		return err
+	}
+
+	// Nested directories aren't part of the migration sequence
+	upstream := make(map[string]string)
+	for filePath, info := range files {
+		if path.Dir(filePath) == path.Clean(item.Source.Path) {
+			upstream[path.Base(filePath)] = info.Content
+		}
+	}
+
+	absPath, err := item.Target.GetAbsolutePath("")
+	if err != nil {
+		return err
+	}
+	local, err := readDirectory(absPath)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("Failed to read local migrations: %v", err))
+		return err
+	}
+	local = withoutChangelog(item, local)
+
+	plan := migrations.Compare(local, upstream)
+	problems := plan.Problems()
+	report.Errors = append(report.Errors, problems...)
+
+	if plan.Safe() {
+		journal := &Journal{Item: item.Name, CommitID: commitID, Root: absPath}
+		for _, m := range plan.Add {
+			journal.Writes = append(journal.Writes, JournalWrite{Path: filepath.Join(absPath, m.Name), Content: []byte(m.Content)})
+		}
+		if err := sm.writeJournaled(journal); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("Failed to write migrations: %v", err))
+			return err
+		}
+		for _, m := range plan.Add {
+			report.UpdatedFiles = append(report.UpdatedFiles, filepath.Join(item.Target.Path, m.Name))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("migration safeguards blocked %d change(s)", len(problems))
+	}
+	return nil
+}
+
+// readDirectory returns the files directly in a directory, by name. A
+// missing directory has no files.
+func readDirectory(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files[entry.Name()] = string(content)
+	}
+	return files, nil
+}
+
+// directoryContent flattens a directory into one string for hashing.
+// Directories include their subdirectories, except for migrations, and leave
+// out the item's changelog.
+func directoryContent(item config.SyncItem, dir string) (string, error) {
+	read := readTree
+	if item.Target.Migrations {
+		read = readDirectory
+	}
+	files, err := read(dir)
+	if err != nil {
+		return "", err
+	}
+	files = withoutChangelog(item, files)
+
+	var sb strings.Builder
+	for _, name := range sortedNames(files) {
+		fmt.Fprintf(&sb, "%s\n%s\n", name, files[name])
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,38 @@
+package sync
+
+import (
+	"strings"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/diff"
+	"github.com/exitflynn/codesync/internal/notebook"
+)
+
+// isNotebook reports whether an item syncs a Jupyter notebook
+func isNotebook(item config.SyncItem) bool {
+	return item.Target.Type == "file" && strings.HasSuffix(item.Target.Path, ".ipynb")
+}
+
+// stripNotebook returns a notebook without outputs and volatile metadata, or
+// the content unchanged if it isn't a valid notebook
+func stripNotebook(content string) string {
+	stripped, err := notebook.Strip([]byte(content))
+	if err != nil {
+		return content
+	}
+	return string(stripped)
+}
+
+// notebookDiff diffs two notebooks cell by cell, falling back to a plain
+// diff if either can't be parsed
+func notebookDiff(before, after string) *diff.DiffResult {
+	renderedBefore, err := notebook.Render([]byte(before))
+	if err != nil && before != "" {
+		return diff.GenerateDiff(before, after)
+	}
+	renderedAfter, err := notebook.Render([]byte(after))
+	if err != nil {
+		return diff.GenerateDiff(before, after)
+	}
+	return diff.GenerateDiff(renderedBefore, renderedAfter)
+}
@@ -0,0 +1,58 @@
+package sync
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/openapi"
+)
+
+// prepareSpec validates an upstream OpenAPI spec, bundles its external
+// references if asked to, and records the operations added and removed
+// compared with the local spec. It returns the content to write.
+func (sm *SyncManager) prepareSpec(item config.SyncItem, local, remote, commitID string, report *SyncReport) (string, error) {
+	doc, err := openapi.Parse([]byte(remote))
+	if err != nil {
+		return "", err
+	}
+
+	if item.Target.Bundle {
+		dir := path.Dir(item.Source.Path)
+		err := doc.Bundle(func(file string) ([]byte, error) {
+			content, err := sm.getFile(item, path.Join(dir, file), commitID)
+			if err != nil {
+				return nil, err
+			}
+			return []byte(content.Content), nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("error bundling spec: %w", err)
+		}
+	}
+
+	if err := doc.Validate(); err != nil {
+		return "", err
+	}
+
+	// A missing or unparseable local spec has nothing to compare against
+	if previous, err := openapi.Parse([]byte(local)); err == nil && local != "" {
+		changes := openapi.Compare(previous, doc)
+		for _, op := range changes.Added {
+			report.Endpoints = append(report.Endpoints, "added "+op.String())
+		}
+		for _, op := range changes.Removed {
+			report.Endpoints = append(report.Endpoints, "removed "+op.String())
+		}
+	}
+
+	if !item.Target.Bundle {
+		return remote, nil
+	}
+
+	out, err := doc.Marshal()
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
@@ -0,0 +1,40 @@
+package sync
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/exitflynn/codesync/internal/codeowners"
+)
+
+// updatedOwners returns the owners of updated files according to the
+// CODEOWNERS file of the repository in the working directory, or nil if it
+// has none. Files outside the repository have no owners.
+func updatedOwners(paths []string) ([]string, error) {
+	owners, err := codeowners.Load(".")
+	if err != nil || owners == nil {
+		return nil, err
+	}
+
+	root, err := filepath.Abs(".")
+	if err != nil {
+		return nil, err
+	}
+
+	var rel []string
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			continue
+		}
+		r, err := filepath.Rel(root, abs)
+		if err != nil {
+			continue
+		}
+		if r = filepath.ToSlash(r); r == ".." || strings.HasPrefix(r, "../") {
+			continue
+		}
+		rel = append(rel, r)
+	}
+	return owners.OwnersOf(rel), nil
+}
@@ -0,0 +1,141 @@
+package sync
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+// syncConcurrently syncs items on up to the configured number of workers and
+// returns their reports in the order of items. Items that may write the same
+// files, or read the same git clone, are synced one after another in that
+// order. Items left once their provider's API budget is spent are deferred.
+// done is called with each report as it's made, one at a time.
+func (sm *SyncManager) syncConcurrently(items []config.SyncItem, done func(*SyncReport)) []*SyncReport {
+	reports := make([]*SyncReport, len(items))
+	var doneMu sync.Mutex
+	run := func(i int) {
+		item := items[i]
+		if sm.budgetExhausted(item) {
+			reports[i] = &SyncReport{SyncItem: item, Deferred: true, Failure: FailureTransient}
+		} else {
+			reports[i] = sm.runItem(item)
+		}
+		if done != nil {
+			doneMu.Lock()
+			done(reports[i])
+			doneMu.Unlock()
+		}
+	}
+
+	groups := sm.overlapping(items)
+	workers := min(max(sm.config.Concurrency, 1), len(groups))
+	queue := make(chan []int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range queue {
+				for _, i := range group {
+					run(i)
+				}
+			}
+		}()
+	}
+	for _, group := range groups {
+		queue <- group
+	}
+	close(queue)
+	wg.Wait()
+
+	return reports
+}
+
+// overlapping groups items whose footprints overlap, by index. Groups and the
+// items in them keep the order of items.
+func (sm *SyncManager) overlapping(items []config.SyncItem) [][]int {
+	// Each item joins the group of the first earlier item it overlaps, and
+	// merges the groups of any others
+	group := make([]int, len(items))
+	footprints := make([][]string, len(items))
+	for i, item := range items {
+		group[i] = i
+		footprints[i] = sm.footprint(item)
+		for j := range i {
+			if group[j] == group[i] || !overlaps(footprints[i], footprints[j]) {
+				continue
+			}
+			from, to := max(group[i], group[j]), min(group[i], group[j])
+			for k := range i + 1 {
+				if group[k] == from {
+					group[k] = to
+				}
+			}
+		}
+	}
+
+	var groups [][]int
+	index := make(map[int]int)
+	for i, g := range group {
+		if _, ok := index[g]; !ok {
+			index[g] = len(groups)
+			groups = append(groups, nil)
+		}
+		groups[index[g]] = append(groups[index[g]], i)
+	}
+	return groups
+}
+
+// footprint returns what syncing an item may change, or must not share with
+// another item synced at the same time: the absolute paths it may write, and
+// the clone of a git source
+func (sm *SyncManager) footprint(item config.SyncItem) []string {
+	paths := []string{absPath(globRoot(item.Target.Path))}
+	if item.Target.Type == "function" {
+		// A function relocated by an earlier sync is written where it went,
+		// and one followed to another file now may be anywhere
+		if state, err := sm.loadState(item.Name); err == nil && state.RelocatedPath != "" {
+			paths = append(paths, absPath(state.RelocatedPath))
+		}
+		if item.Target.Relocate == "auto" {
+			paths = append(paths, absPath("."))
+		}
+	}
+	if item.Changelog {
+		paths = append(paths, absPath(changelogPath(item)))
+	}
+	if gen := item.Generate; gen != nil {
+		for _, output := range gen.Outputs {
+			paths = append(paths, absPath(globRoot(filepath.Join(gen.Dir, output))))
+		}
+	}
+	if item.Source.ProviderName() == config.ProviderGit {
+		paths = append(paths, "git:"+item.Source.URL)
+	}
+	return paths
+}
+
+// globRoot returns the directory a glob pattern matches files below, or the
+// path itself if it isn't a pattern
+func globRoot(pattern string) string {
+	for strings.ContainsAny(pattern, "*?[") {
+		pattern = filepath.Dir(pattern)
+	}
+	return pattern
+}
+
+// overlaps reports whether a path of one footprint is, or is inside, a path
+// of the other
+func overlaps(a, b []string) bool {
+	for _, p := range a {
+		for _, q := range b {
+			if p == q || strings.HasPrefix(p, q+string(filepath.Separator)) || strings.HasPrefix(q, p+string(filepath.Separator)) {
+				return true
+			}
+		}
+	}
+	return false
+}
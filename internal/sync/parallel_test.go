@@ -0,0 +1,69 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+func TestOverlapping(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	items := []config.SyncItem{
+		{Name: "a", Target: config.SyncTarget{Path: "vendor/a.go", Type: "file"}},
+		{Name: "b", Target: config.SyncTarget{Path: "lib/b.go", Type: "file"}},
+		{Name: "c", Target: config.SyncTarget{Path: "vendor", Type: "directory"}},
+		{Name: "d", Target: config.SyncTarget{Path: "docs/*.md", Type: "file"}},
+		{Name: "e", Target: config.SyncTarget{Path: "docs/guide/intro.md", Type: "file"}},
+		{Name: "f", Source: config.SyncSource{Provider: config.ProviderGit, URL: "https://example.com/lib.git"}, Target: config.SyncTarget{Path: "f.go", Type: "file"}},
+		{Name: "g", Source: config.SyncSource{Provider: config.ProviderGit, URL: "https://example.com/lib.git"}, Target: config.SyncTarget{Path: "g.go", Type: "file"}},
+	}
+
+	sm := newTestManager(t)
+
+	// Items writing the same files or reading the same clone run in order
+	want := [][]int{{0, 2}, {1}, {3, 4}, {5, 6}}
+	if groups := sm.overlapping(items); !reflect.DeepEqual(groups, want) {
+		t.Errorf("Expected groups %v, got %v", want, groups)
+	}
+
+	// A function relocated by an earlier sync writes where it went
+	relocated := config.SyncItem{Name: "h", Target: config.SyncTarget{Path: "util.go", Type: "function", Function: "Retry"}}
+	if err := sm.saveState("h", State{RelocatedPath: "lib/b.go"}); err != nil {
+		t.Fatal(err)
+	}
+	want = [][]int{{0, 2}, {1, 7}, {3, 4}, {5, 6}}
+	if groups := sm.overlapping(append(items, relocated)); !reflect.DeepEqual(groups, want) {
+		t.Errorf("Expected groups %v, got %v", want, groups)
+	}
+}
+
+func TestSyncAllConcurrently(t *testing.T) {
+	t.Chdir(t.TempDir())
+	sm := newFailingManager(t, "zeta", "alpha", "mid", "beta")
+	sm.config.Concurrency = 4
+
+	var reported []string
+	sm.OnReport(func(report *SyncReport) {
+		reported = append(reported, report.SyncItem.Name)
+	})
+
+	reports, err := sm.SyncAll()
+	if err != nil {
+		t.Fatalf("SyncAll failed: %v", err)
+	}
+	var names []string
+	for _, report := range reports {
+		names = append(names, report.SyncItem.Name)
+		if report.Failure != FailureTransient {
+			t.Errorf("Expected %s to fail transiently, got %q", report.SyncItem.Name, report.Failure)
+		}
+	}
+	if want := []string{"alpha", "beta", "mid", "zeta"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Expected reports sorted by name, got %v", names)
+	}
+	if len(reported) != 4 {
+		t.Errorf("Expected each item to be reported once, got %v", reported)
+	}
+}
@@ -0,0 +1,219 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/diff"
+	"github.com/exitflynn/codesync/internal/github"
+)
+
+// Patch is the change an upstream commit makes to an item's target
+type Patch struct {
+	Commit  github.CommitInfo
+	Path    string // Target path, relative to where the config's paths are
+	Before  string // Target content before the commit
+	After   string // Target content after it
+	Created bool   // Whether the patch creates the target
+}
+
+// PendingPatches returns a patch per upstream commit that the item hasn't
+// synced yet, oldest first, each applying to the target as the previous one
+// leaves it. Commits that don't change the target are skipped. An item that
+// has never synced gets a single patch for the latest upstream commit.
+func (sm *SyncManager) PendingPatches(name string) ([]Patch, error) {
+	item, ok := sm.Item(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownItem, name)
+	}
+	if !patchable(item) {
+		return nil, fmt.Errorf("item %s: patches can only be exported for file, markdown and function targets", name)
+	}
+
+	state, err := sm.loadState(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if state.RelocatedPath != "" {
+		item.Target.Path = state.RelocatedPath
+	}
+
+	commits, err := sm.source(item).GetCommitsSince(
+		item.Source.Owner,
+		item.Source.Repo,
+		item.Source.Path,
+		item.Source.Ref(),
+		time.Time{},
+		state.LastCommitID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commits: %w", err)
+	}
+	if state.LastCommitID == "" && len(commits) > 1 {
+		commits = commits[:1]
+	}
+
+	absPath, err := item.Target.GetAbsolutePath("")
+	if err != nil {
+		return nil, err
+	}
+	current, err := os.ReadFile(absPath)
+	missing := errors.Is(err, fs.ErrNotExist)
+	if err != nil && !(missing && item.Target.Type == "file") {
+		return nil, fmt.Errorf("failed to read local file: %w", err)
+	}
+
+	var patches []Patch
+	before := string(current)
+	for i := len(commits) - 1; i >= 0; i-- {
+		commit := commits[i]
+		file, err := sm.getFile(item, item.Source.Path, commit.SHA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get file content at %s: %w", commit.SHA, err)
+		}
+		content, err := sm.applyTransform(item, file.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to transform upstream content at %s: %w", commit.SHA, err)
+		}
+
+		after, err := sm.patchedTarget(item, before, content)
+		if err != nil {
+			return nil, fmt.Errorf("commit %s: %w", commit.SHA, err)
+		}
+		if after == before {
+			continue
+		}
+		patches = append(patches, Patch{Commit: commit, Path: item.Target.Path, Before: before, After: after, Created: missing && len(patches) == 0})
+		before = after
+	}
+	return patches, nil
+}
+
+// patchable reports whether patchedTarget can sync upstream content into an
+// item's target. Structured files and notebooks only take part of upstream.
+func patchable(item config.SyncItem) bool {
+	switch item.Target.Type {
+	case "file":
+		return !item.Target.Structured() && !isNotebook(item)
+	case "markdown", "function":
+		return true
+	}
+	return false
+}
+
+// patchedTarget returns the content of a target after syncing upstream
+// content into it
+func (sm *SyncManager) patchedTarget(item config.SyncItem, local, remote string) (string, error) {
+	switch item.Target.Type {
+	case "markdown":
+		return syncSection(item, local, remote)
+	case "function":
+		function, err := sm.extractFunction(item, remote)
+		if err != nil {
+			return "", fmt.Errorf("failed to extract function: %w", err)
+		}
+		return replaceFunction(local, item.Target.Language, item.Target.Function, function)
+	default:
+		return remote, nil
+	}
+}
+
+// alreadyApplied reports whether the local target already has the upstream
+// content a sync would write into it
+func (sm *SyncManager) alreadyApplied(item config.SyncItem, remote string) bool {
+	if !patchable(item) {
+		return false
+	}
+	absPath, err := item.Target.GetAbsolutePath("")
+	if err != nil {
+		return false
+	}
+	local, err := os.ReadFile(absPath)
+	if err != nil {
+		return false
+	}
+	patched, err := sm.patchedTarget(item, string(local), remote)
+	return err == nil && patched == string(local)
+}
+
+// WritePatches writes patches as a mailbox in the format of git format-patch,
+// which git am applies as commits with the upstream author, date and message
+func WritePatches(w io.Writer, item config.SyncItem, patches []Patch) error {
+	for i, p := range patches {
+		if _, err := io.WriteString(w, formatPatch(item, p, i+1, len(patches))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatPatch renders the nth of total patches as a mail message
+func formatPatch(item config.SyncItem, p Patch, n, total int) string {
+	subject, body, _ := strings.Cut(strings.TrimSpace(p.Commit.Message), "\n")
+	subject = strings.TrimSpace(subject)
+	body = strings.TrimSpace(body)
+	if total > 1 {
+		subject = fmt.Sprintf("[PATCH %d/%d] %s", n, total, subject)
+	} else {
+		subject = "[PATCH] " + subject
+	}
+
+	author := mail.Address{Name: p.Commit.Author, Address: p.Commit.Email}
+	// Some providers report the author as "Name <email>"
+	if addr, err := mail.ParseAddress(p.Commit.Author); err == nil {
+		author.Name = addr.Name
+		if author.Address == "" {
+			author.Address = addr.Address
+		}
+	}
+	if author.Name == "" {
+		author.Name = "codesync"
+	}
+	if author.Address == "" {
+		author.Address = "codesync@localhost"
+	}
+	date := p.Commit.Timestamp
+	if date.IsZero() {
+		date = time.Now()
+	}
+	sha := p.Commit.SHA
+	if len(sha) != 40 {
+		// git am splits the mailbox on lines like "From <40 hex digits> ..."
+		sha = strings.Repeat("0", 40)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "From %s Mon Sep 17 00:00:00 2001\n", sha)
+	fmt.Fprintf(&sb, "From: %s\n", author.String())
+	fmt.Fprintf(&sb, "Date: %s\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&sb, "Subject: %s\n", mime.QEncoding.Encode("utf-8", subject))
+	sb.WriteString("MIME-Version: 1.0\n")
+	sb.WriteString("Content-Type: text/plain; charset=UTF-8\n")
+	sb.WriteString("Content-Transfer-Encoding: 8bit\n\n")
+	if body != "" {
+		sb.WriteString(body + "\n\n")
+	}
+	fmt.Fprintf(&sb, "Synced from %s at %s by codesync item %s.\n", sourceName(item), p.Commit.SHA, item.Name)
+	sb.WriteString("---\n\n")
+
+	path := filepath.ToSlash(filepath.Clean(p.Path))
+	fmt.Fprintf(&sb, "diff --git a/%s b/%s\n", path, path)
+	from := "a/" + path
+	if p.Created {
+		sb.WriteString("new file mode 100644\n")
+		from = "/dev/null"
+	}
+	fmt.Fprintf(&sb, "--- %s\n+++ b/%s\n", from, path)
+	sb.WriteString(diff.Unified(p.Before, p.After))
+	sb.WriteString("-- \ncodesync\n\n")
+	return sb.String()
+}
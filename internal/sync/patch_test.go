@@ -0,0 +1,115 @@
+package sync
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+	"github.com/exitflynn/codesync/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestPendingPatches(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	item := config.SyncItem{
+		Name:   "logger",
+		Source: config.SyncSource{Owner: "acme", Repo: "utils", Path: "log.go", Branch: "main"},
+		Target: config.SyncTarget{Path: "log.go", Type: "file"},
+	}
+	writeTestFile(t, item.Target.Path, "package log\n")
+
+	const (
+		first  = "1111111aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+		second = "2222222bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+		third  = "3333333ccccccccccccccccccccccccccccccccc"
+	)
+	when := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	source := mocks.NewMockGitHubClient(gomock.NewController(t))
+	source.EXPECT().GetCommitsSince("acme", "utils", "log.go", "main", time.Time{}, "0000000").
+		Return([]github.CommitInfo{
+			{SHA: third, Message: "Rerun generator", Author: "Bob", Email: "bob@example.com", Timestamp: when.Add(2 * time.Hour)},
+			{SHA: second, Message: "Add Warn\n\nWarn logs at warning level.", Author: "Bob", Email: "bob@example.com", Timestamp: when.Add(time.Hour)},
+			{SHA: first, Message: "Add Info", Author: "Zoë", Email: "zoe@example.com", Timestamp: when},
+		}, nil)
+	source.EXPECT().GetFile("acme", "utils", "log.go", first).
+		Return(&github.FileInfo{Content: "package log\n\nfunc Info() {}\n"}, nil)
+	source.EXPECT().GetFile("acme", "utils", "log.go", second).
+		Return(&github.FileInfo{Content: "package log\n\nfunc Info() {}\n\nfunc Warn() {}\n"}, nil)
+	source.EXPECT().GetFile("acme", "utils", "log.go", third).
+		Return(&github.FileInfo{Content: "package log\n\nfunc Info() {}\n\nfunc Warn() {}\n"}, nil)
+
+	cfg := &config.Config{Version: "1.0", Items: []config.SyncItem{item}}
+	sm, err := NewSyncManager(cfg, t.TempDir(), WithProvider(config.ProviderGitHub, source))
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	if err := sm.saveState(item.Name, State{LastCommitID: "0000000"}); err != nil {
+		t.Fatal(err)
+	}
+
+	patches, err := sm.PendingPatches(item.Name)
+	if err != nil {
+		t.Fatalf("PendingPatches failed: %v", err)
+	}
+	// The third commit doesn't change the file
+	if len(patches) != 2 || patches[0].Commit.SHA != first || patches[1].Commit.SHA != second {
+		t.Fatalf("Expected patches for the first two commits, oldest first, got %+v", patches)
+	}
+	if patches[1].Before != patches[0].After {
+		t.Errorf("Expected each patch to apply on top of the previous one")
+	}
+
+	var out bytes.Buffer
+	if err := WritePatches(&out, item, patches); err != nil {
+		t.Fatalf("WritePatches failed: %v", err)
+	}
+	mbox := out.String()
+	for _, want := range []string{
+		"From " + first + " Mon Sep 17 00:00:00 2001\n",
+		"From: =?utf-8?q?Zo=C3=AB?= <zoe@example.com>\n",
+		"Subject: [PATCH 1/2] Add Info\n",
+		"Subject: [PATCH 2/2] Add Warn\n",
+		"Warn logs at warning level.\n",
+		"+func Warn() {}\n",
+	} {
+		if !strings.Contains(mbox, want) {
+			t.Errorf("Expected %q in:\n%s", want, mbox)
+		}
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL=/dev/null", "GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		cmd.Stdin = strings.NewReader(mbox)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s failed: %v\n%s", args[0], err, output)
+		}
+		return string(output)
+	}
+	git("init", "-q")
+	git("add", "log.go")
+	git("-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "Initial")
+	git("am", "-q")
+
+	if log := git("log", "--format=%an <%ae> %s", "-2"); log != "Bob <bob@example.com> Add Warn\nZoë <zoe@example.com> Add Info\n" {
+		t.Errorf("Unexpected history after git am:\n%s", log)
+	}
+	if content, _ := os.ReadFile("log.go"); string(content) != patches[1].After {
+		t.Errorf("Unexpected content after git am:\n%s", content)
+	}
+	// The next sync takes the applied upstream change rather than conflicting
+	if !sm.alreadyApplied(item, patches[1].After) {
+		t.Error("Expected the applied patches to count as upstream's change")
+	}
+}
@@ -0,0 +1,70 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/notify"
+	"github.com/exitflynn/codesync/internal/plugin"
+)
+
+// plugins are the providers, transforms and notifiers of the plugins declared
+// in a config, by name
+type plugins struct {
+	clients    []*plugin.Client // Every plugin, to stop them on Close
+	providers  map[string]SourceProvider
+	transforms map[string]*plugin.Transform
+	notifiers  map[string]notify.Notifier
+}
+
+// loadPlugins finds the binaries of the declared plugins. They are started
+// when first used.
+func loadPlugins(cfg *config.Config) (*plugins, error) {
+	loaded := &plugins{
+		providers:  make(map[string]SourceProvider),
+		transforms: make(map[string]*plugin.Transform),
+		notifiers:  make(map[string]notify.Notifier),
+	}
+	for _, p := range cfg.Plugins {
+		client, err := plugin.Load(cfg, p)
+		if err != nil {
+			return nil, err
+		}
+		loaded.clients = append(loaded.clients, client)
+		switch p.Kind {
+		case config.PluginProvider:
+			loaded.providers[p.Name] = plugin.NewProvider(client)
+		case config.PluginTransform:
+			loaded.transforms[p.Name] = plugin.NewTransform(client)
+		case config.PluginNotifier:
+			loaded.notifiers[p.Name] = plugin.NewNotifier(client)
+		}
+	}
+	return loaded, nil
+}
+
+// applyTransform passes upstream content of an item through its transform
+// plugin, if it has one
+func (sm *SyncManager) applyTransform(item config.SyncItem, content string) (string, error) {
+	if item.Target.TransformPlugin == "" {
+		return content, nil
+	}
+	transform, ok := sm.transforms[item.Target.TransformPlugin]
+	if !ok {
+		return "", fmt.Errorf("transform plugin %s is not loaded", item.Target.TransformPlugin)
+	}
+	return transform.Apply(item.Name, item.Target.Path, content)
+}
+
+// Close stops the plugins the manager started. The manager must not be used
+// afterwards.
+func (sm *SyncManager) Close() error {
+	var errs []error
+	for _, client := range sm.plugins {
+		if err := client.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("plugin %s: %w", client.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,177 @@
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+// defaultPolicyQuery is the query of policies that don't set one
+const defaultPolicyQuery = "data.codesync.deny"
+
+// PolicyInput is what policies are evaluated against, as their input
+type PolicyInput struct {
+	Item    PolicyItem     `json:"item"`
+	Commit  string         `json:"commit"`  // Upstream commit about to be applied
+	Commits []PolicyCommit `json:"commits"` // Upstream commits since the last sync, newest first
+	// How long the oldest of the commits has waited, in seconds
+	DriftSeconds int64     `json:"driftSeconds"`
+	LastSync     time.Time `json:"lastSync,omitzero"`
+	Now          time.Time `json:"now"`
+}
+
+// PolicyItem describes the item of a policy input
+type PolicyItem struct {
+	Name     string   `json:"name"`
+	Owner    string   `json:"owner,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Provider string   `json:"provider"`
+	Source   string   `json:"source"` // owner/repo, or the URL of a git source
+	Path     string   `json:"path"`   // Upstream path
+	Ref      string   `json:"ref"`
+	Target   string   `json:"target"` // Local path
+	Type     string   `json:"type"`
+}
+
+// PolicyCommit is an upstream commit in a policy input
+type PolicyCommit struct {
+	SHA     string    `json:"sha"`
+	Author  string    `json:"author"`
+	Email   string    `json:"email,omitempty"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// checkPolicies evaluates the configured policies against the upstream
+// change of an item and returns their violations
+func (sm *SyncManager) checkPolicies(item config.SyncItem, commitID string, state State, report *SyncReport) ([]string, error) {
+	policies := sm.config.Policies
+	if policies == nil {
+		return nil, nil
+	}
+
+	input, err := json.Marshal(sm.policyInput(item, commitID, state, report))
+	if err != nil {
+		return nil, err
+	}
+	return evalPolicies(policies, input)
+}
+
+// policyInput builds the input of policies for an upstream change
+func (sm *SyncManager) policyInput(item config.SyncItem, commitID string, state State, report *SyncReport) PolicyInput {
+	source := item.Source.Owner + "/" + item.Source.Repo
+	if item.Source.URL != "" {
+		source = item.Source.URL
+	}
+	input := PolicyInput{
+		Item: PolicyItem{
+			Name:     item.Name,
+			Owner:    item.Owner,
+			Tags:     item.Tags,
+			Provider: item.Source.ProviderName(),
+			Source:   source,
+			Path:     item.Source.Path,
+			Ref:      item.Source.Ref(),
+			Target:   item.Target.Path,
+			Type:     item.Target.Type,
+		},
+		Commit:   commitID,
+		Commits:  []PolicyCommit{},
+		LastSync: state.LastSync,
+		Now:      sm.Now(),
+	}
+
+	var oldest time.Time
+	for _, commit := range report.Commits {
+		input.Commits = append(input.Commits, PolicyCommit{
+			SHA:     commit.SHA,
+			Author:  commit.Author,
+			Email:   commit.Email,
+			Message: commit.Message,
+			Time:    commit.Timestamp,
+		})
+		if !commit.Timestamp.IsZero() && (oldest.IsZero() || commit.Timestamp.Before(oldest)) {
+			oldest = commit.Timestamp
+		}
+	}
+	if !oldest.IsZero() {
+		input.DriftSeconds = int64(input.Now.Sub(oldest) / time.Second)
+	}
+	return input
+}
+
+// evalPolicies runs opa eval over the policies with input and returns the
+// messages the query yields. An undefined query has no violations.
+func evalPolicies(policies *config.PolicyConfig, input []byte) ([]string, error) {
+	query := policies.Query
+	if query == "" {
+		query = defaultPolicyQuery
+	}
+	opa := policies.OPA
+	if opa == "" {
+		opa = "opa"
+	}
+
+	args := []string{"eval", "--format", "json", "--stdin-input"}
+	for _, path := range policies.Paths {
+		args = append(args, "--data", path)
+	}
+	cmd := exec.Command(opa, append(args, query)...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate policies: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	var result struct {
+		Result []struct {
+			Expressions []struct {
+				Value json.RawMessage `json:"value"`
+			} `json:"expressions"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse policy result: %w", err)
+	}
+
+	var violations []string
+	for _, r := range result.Result {
+		for _, expr := range r.Expressions {
+			violations = append(violations, policyMessages(expr.Value)...)
+		}
+	}
+	return violations, nil
+}
+
+// policyMessages turns the value of a query into violation messages: each
+// string of a set or array is one, other values are kept as JSON. A single
+// string is a violation, as is true; false is none.
+func policyMessages(value json.RawMessage) []string {
+	var list []json.RawMessage
+	if err := json.Unmarshal(value, &list); err != nil {
+		list = []json.RawMessage{value}
+	}
+
+	var messages []string
+	for _, v := range list {
+		var s string
+		var b bool
+		switch {
+		case json.Unmarshal(v, &s) == nil:
+			messages = append(messages, s)
+		case json.Unmarshal(v, &b) == nil:
+			if b {
+				messages = append(messages, "denied by policy")
+			}
+		case string(v) != "null":
+			messages = append(messages, string(v))
+		}
+	}
+	return messages
+}
@@ -0,0 +1,132 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+	"github.com/exitflynn/codesync/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+// fakeOPA writes an opa stand-in that denies changes from acme/blocked and
+// records its arguments and input
+func fakeOPA(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	script := `#!/bin/sh
+cat > "$(dirname "$0")/input.json"
+echo "$@" > "$(dirname "$0")/args"
+if grep -q '"source":"acme/blocked"' "$(dirname "$0")/input.json"; then
+	echo '{"result":[{"expressions":[{"value":["acme/blocked is not an allowed source","drift too old"]}]}]}'
+else
+	echo '{}'
+fi
+`
+	path := filepath.Join(dir, "opa")
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPolicies(t *testing.T) {
+	t.Chdir(t.TempDir())
+	opa := fakeOPA(t)
+
+	allowed := config.SyncItem{
+		Name:   "allowed",
+		Source: config.SyncSource{Owner: "acme", Repo: "lib", Path: "lib.go", Branch: "main"},
+		Target: config.SyncTarget{Path: "lib.go", Type: "file"},
+	}
+	blocked := config.SyncItem{
+		Name:   "blocked",
+		Source: config.SyncSource{Owner: "acme", Repo: "blocked", Path: "lib.go", Branch: "main"},
+		Target: config.SyncTarget{Path: "blocked.go", Type: "file"},
+	}
+	cfg := &config.Config{
+		Version:  "1.0",
+		Items:    []config.SyncItem{allowed, blocked},
+		Policies: &config.PolicyConfig{Paths: []string{"policies/"}, OPA: opa},
+	}
+	now := time.Date(2025, 3, 14, 10, 0, 0, 0, time.UTC)
+	mock := mocks.NewMockGitHubClient(gomock.NewController(t))
+	for _, repo := range []string{"lib", "blocked"} {
+		mock.EXPECT().GetCommitsSince("acme", repo, "lib.go", "main", time.Time{}, "").
+			Return([]github.CommitInfo{{SHA: "c1", Author: "ana", Timestamp: now.Add(-2 * time.Hour)}}, nil)
+		mock.EXPECT().GetFile("acme", repo, "lib.go", "c1").
+			Return(&github.FileInfo{Content: "package lib\n"}, nil)
+	}
+	sm, err := NewSyncManager(cfg, t.TempDir(), WithProvider(config.ProviderGitHub, mock))
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	sm.SetClock(func() time.Time { return now })
+	for _, item := range cfg.Items {
+		writeTestFile(t, item.Target.Path, "package lib // old\n")
+		_, hash, err := sm.checkLocalChanges(item, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sm.saveState(item.Name, State{CurrentLocalHash: hash}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A denied change isn't applied
+	report, err := sm.SyncItem(blocked)
+	if !errors.Is(err, ErrPolicyViolation) || classifyError(err) != FailureConfig {
+		t.Fatalf("Expected a policy violation, got %v", err)
+	}
+	if !slices.Equal(report.Violations, []string{"acme/blocked is not an allowed source", "drift too old"}) {
+		t.Errorf("Unexpected violations %v", report.Violations)
+	}
+	if content, _ := os.ReadFile("blocked.go"); string(content) != "package lib // old\n" {
+		t.Errorf("Expected the target to be left alone, got %q", content)
+	}
+
+	args, _ := os.ReadFile(filepath.Join(filepath.Dir(opa), "args"))
+	if strings.TrimSpace(string(args)) != "eval --format json --stdin-input --data policies/ data.codesync.deny" {
+		t.Errorf("Unexpected opa arguments %q", args)
+	}
+	var input PolicyInput
+	data, _ := os.ReadFile(filepath.Join(filepath.Dir(opa), "input.json"))
+	if err := json.Unmarshal(data, &input); err != nil {
+		t.Fatal(err)
+	}
+	if input.Commit != "c1" || len(input.Commits) != 1 || input.Commits[0].Author != "ana" || input.DriftSeconds != 7200 || input.Item.Target != "blocked.go" {
+		t.Errorf("Unexpected policy input %s", data)
+	}
+
+	// An allowed one is
+	report, err = sm.SyncItem(allowed)
+	if err != nil || len(report.Errors) > 0 || len(report.Violations) > 0 {
+		t.Fatalf("SyncItem failed: %v %v", err, report.Errors)
+	}
+	if content, _ := os.ReadFile("lib.go"); string(content) != "package lib\n" {
+		t.Errorf("Expected the target to be written, got %q", content)
+	}
+}
+
+func TestPolicyMessages(t *testing.T) {
+	for value, want := range map[string][]string{
+		`["a","b"]`:      {"a", "b"},
+		`"a"`:            {"a"},
+		`true`:           {"denied by policy"},
+		`false`:          nil,
+		`[]`:             nil,
+		`[{"msg":"a"}]`:  {`{"msg":"a"}`},
+		`[true, "a", 1]`: {"denied by policy", "a", "1"},
+	} {
+		if got := policyMessages(json.RawMessage(value)); !slices.Equal(got, want) {
+			t.Errorf("policyMessages(%s) = %q, want %q", value, got, want)
+		}
+	}
+}
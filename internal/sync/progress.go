@@ -0,0 +1,174 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/telemetry"
+)
+
+// runsDir holds the progress of the current SyncAll run and the records of
+// audited runs
+const runsDir = "runs"
+
+// progressName is where the progress of the current SyncAll run is stored
+var progressName = filepath.Join(runsDir, "current.json")
+
+// runIDFormat is the layout of run IDs, the UTC time the run started
+const runIDFormat = "20060102T150405Z"
+
+// digestName is where pending notifications of a digest are stored
+const digestName = "digest.json"
+
+// runProgress records the items a run has synced successfully, so that an
+// interrupted run can be resumed without redoing them
+type runProgress struct {
+	ID        string    `json:"id"`
+	Started   time.Time `json:"started"`
+	Completed []string  `json:"completed"`
+}
+
+// ResumeAll continues the last SyncAll run that didn't finish, or whose API
+// budget ran out, skipping the items it synced successfully. Items that failed
+// are retried. Without an unfinished run it behaves like SyncAll.
+func (sm *SyncManager) ResumeAll() ([]*SyncReport, error) {
+	return sm.syncAll(true)
+}
+
+func (sm *SyncManager) syncAll(resume bool) ([]*SyncReport, error) {
+	progress, err := sm.startProgress(resume)
+	if err != nil {
+		return nil, err
+	}
+
+	completed := make(map[string]bool, len(progress.Completed))
+	for _, name := range progress.Completed {
+		completed[name] = true
+	}
+
+	var record *RunRecord
+	if sm.config.AuditRuns {
+		// A resumed run is recorded on its own, from when it resumed
+		id := progress.ID
+		if len(progress.Completed) > 0 {
+			id = sm.Now().UTC().Format(runIDFormat)
+		}
+		if record, err = sm.startRecord(id); err != nil {
+			return nil, fmt.Errorf("failed to record run: %w", err)
+		}
+		sm.recording = record.Bundle
+		defer func() { sm.recording = nil }()
+	}
+
+	sm.resetBudgets()
+	sm.fetched = newRunCache()
+	defer func() { sm.fetched = nil }()
+
+	var pending []config.SyncItem
+	for _, item := range sm.Items() {
+		if !completed[item.Name] {
+			pending = append(pending, item)
+		}
+	}
+	sm.prefetch(pending)
+
+	var enabled []config.SyncItem
+	for _, item := range pending {
+		if !item.Disabled {
+			enabled = append(enabled, item)
+		}
+	}
+	// Items left once the API budget is spent wait for the next run
+	reports := sm.syncConcurrently(enabled, func(report *SyncReport) {
+		if report.Deferred || len(report.Errors) > 0 {
+			return
+		}
+		progress.Completed = append(progress.Completed, report.SyncItem.Name)
+		// Losing progress only costs redoing items on resume
+		if err := sm.saveProgress(progress); err != nil {
+			log.Printf("failed to record progress of run %s: %v", progress.ID, err)
+		}
+	})
+	deferred := false
+	for _, report := range reports {
+		deferred = deferred || report.Deferred
+	}
+
+	if record != nil {
+		if err := sm.finishRecord(record, reports); err != nil {
+			log.Printf("failed to record run %s: %v", record.ID, err)
+		}
+	}
+
+	SortReports(reports)
+
+	// A run with deferred items can be finished with ResumeAll
+	if !deferred {
+		if err := sm.store.remove(progressName); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("failed to clear progress of run %s: %v", progress.ID, err)
+		}
+	}
+
+	sm.reportUsage(reports)
+	return reports, sm.notify(reports)
+}
+
+// reportUsage sends anonymous usage counts of a run if the config opts in.
+// Telemetry must never get in the way of syncing, so failures are only
+// logged.
+func (sm *SyncManager) reportUsage(reports []*SyncReport) {
+	if !telemetry.Enabled(sm.config.Telemetry) || sm.files.dryRun() {
+		return
+	}
+
+	usage := telemetry.Collect(sm.Items())
+	for _, report := range reports {
+		if report.Failure != "" {
+			usage.AddError(string(report.Failure))
+		}
+	}
+	if err := telemetry.Send(sm.config.Telemetry.Endpoint, usage); err != nil {
+		log.Printf("failed to report usage: %v", err)
+	}
+}
+
+// startProgress loads the interrupted run when resuming, or starts a new one
+func (sm *SyncManager) startProgress(resume bool) (*runProgress, error) {
+	if resume {
+		data, err := sm.store.read(progressName)
+		if err == nil {
+			var progress runProgress
+			if err := json.Unmarshal(data, &progress); err != nil {
+				return nil, fmt.Errorf("invalid run progress: %w", err)
+			}
+			return &progress, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read run progress: %w", err)
+		}
+	}
+
+	now := sm.Now().UTC()
+	progress := &runProgress{ID: now.Format(runIDFormat), Started: now}
+	if err := sm.saveProgress(progress); err != nil {
+		return nil, err
+	}
+	return progress, nil
+}
+
+func (sm *SyncManager) saveProgress(progress *runProgress) error {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	if err := sm.store.write(progressName, data); err != nil {
+		return fmt.Errorf("failed to write run progress: %w", err)
+	}
+	return nil
+}
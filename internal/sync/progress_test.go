@@ -0,0 +1,156 @@
+package sync
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+)
+
+// newFailingManager returns a manager with the given items whose GitHub API
+// is down, so every item fails without touching the network
+func newFailingManager(t *testing.T, names ...string) *SyncManager {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	sm := newTestManager(t)
+	if err := sm.githubClient.SetBaseURL(server.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range names {
+		sm.config.Items = append(sm.config.Items, config.SyncItem{
+			Name:   name,
+			Source: config.SyncSource{Owner: "acme", Repo: "utils", Path: name + ".go", Branch: "main"},
+			Target: config.SyncTarget{Path: name + ".go", Type: "file"},
+		})
+	}
+	return sm
+}
+
+func TestResumeAll(t *testing.T) {
+	t.Chdir(t.TempDir())
+	sm := newFailingManager(t, "a", "b")
+
+	// A run that synced a and died
+	if err := sm.saveProgress(&runProgress{ID: "interrupted", Completed: []string{"a"}}); err != nil {
+		t.Fatalf("saveProgress failed: %v", err)
+	}
+
+	reports, err := sm.ResumeAll()
+	if err != nil {
+		t.Fatalf("ResumeAll failed: %v", err)
+	}
+	if len(reports) != 1 || reports[0].SyncItem.Name != "b" {
+		t.Fatalf("Expected only b to be synced, got %d reports", len(reports))
+	}
+	if reports[0].Failure != FailureTransient {
+		t.Errorf("Expected an outage to be transient, got %q", reports[0].Failure)
+	}
+
+	if _, err := sm.store.read(progressName); err == nil {
+		t.Error("Expected progress to be cleared once the run finished")
+	}
+
+	// Without an interrupted run, resuming syncs everything
+	if reports, _ := sm.ResumeAll(); len(reports) != 2 {
+		t.Errorf("Expected a fresh run of both items, got %d reports", len(reports))
+	}
+}
+
+func TestSyncAllDefersItemsOverBudget(t *testing.T) {
+	t.Chdir(t.TempDir())
+	sm := newFailingManager(t, "a", "b", "c")
+	sm.githubClient.SetLimits(github.Limits{MaxAPICalls: 1})
+
+	reports, err := sm.SyncAll()
+	if err != nil {
+		t.Fatalf("SyncAll failed: %v", err)
+	}
+	if len(reports) != 3 || reports[0].Deferred || !reports[1].Deferred || !reports[2].Deferred {
+		t.Fatalf("Expected b and c to be deferred, got %+v", reports)
+	}
+	if summary := SummarizeRun(reports); summary.ExitCode() != ExitTransient {
+		t.Errorf("Expected deferred items to be retryable, got exit code %d", summary.ExitCode())
+	}
+
+	// The run stays resumable, with a fresh budget
+	if _, err := sm.store.read(progressName); err != nil {
+		t.Errorf("Expected progress to be kept for deferred items: %v", err)
+	}
+	if reports, _ := sm.ResumeAll(); len(reports) != 3 || reports[0].Deferred {
+		t.Errorf("Expected the resumed run to start over with a new budget, got %+v", reports)
+	}
+}
+
+func TestSyncAllBudgetIsPerProvider(t *testing.T) {
+	t.Chdir(t.TempDir())
+	sm := newFailingManager(t, "a", "b")
+	sm.githubClient.SetLimits(github.Limits{MaxAPICalls: 1})
+	sm.config.Items = append(sm.config.Items, config.SyncItem{
+		Name:   "c",
+		Source: config.SyncSource{Provider: config.ProviderLocal, Path: "upstream.go"},
+		Target: config.SyncTarget{Path: "c.go", Type: "file"},
+	})
+
+	reports, err := sm.SyncAll()
+	if err != nil {
+		t.Fatalf("SyncAll failed: %v", err)
+	}
+	deferred := make(map[string]bool)
+	for _, report := range reports {
+		deferred[report.SyncItem.Name] = report.Deferred
+	}
+	if deferred["a"] || !deferred["b"] || deferred["c"] {
+		t.Errorf("Expected only the GitHub item b to be deferred, got %v", deferred)
+	}
+}
+
+func TestSyncAllSortsReports(t *testing.T) {
+	t.Chdir(t.TempDir())
+	sm := newFailingManager(t, "zeta", "alpha", "mid")
+
+	reports, err := sm.SyncAll()
+	if err != nil {
+		t.Fatalf("SyncAll failed: %v", err)
+	}
+	var names []string
+	for _, report := range reports {
+		names = append(names, report.SyncItem.Name)
+	}
+	if len(names) != 3 || names[0] != "alpha" || names[1] != "mid" || names[2] != "zeta" {
+		t.Errorf("Expected reports sorted by name, got %v", names)
+	}
+}
+
+func TestSyncAllReportsUsage(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("DO_NOT_TRACK", "")
+	sm := newFailingManager(t, "logger")
+
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer server.Close()
+	sm.config.Telemetry = &config.TelemetryConfig{Enabled: true, Endpoint: server.URL}
+
+	if _, err := sm.SyncAll(); err != nil {
+		t.Fatalf("SyncAll failed: %v", err)
+	}
+	if !strings.Contains(body, `"errors":{"transient":1}`) || !strings.Contains(body, `"providers":{"github":1}`) {
+		t.Errorf("Unexpected usage report: %s", body)
+	}
+	if strings.Contains(body, "logger") || strings.Contains(body, "acme") {
+		t.Errorf("Expected no names in the usage report: %s", body)
+	}
+}
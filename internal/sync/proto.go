@@ -0,0 +1,39 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/protocheck"
+)
+
+// checkBreaking compares a .proto target with its new upstream version and
+// applies the item's onBreaking policy. Breaking changes are recorded in the
+// report; with the fail policy an error stops the file from being written.
+func checkBreaking(item config.SyncItem, local, remote string, report *SyncReport) error {
+	if !strings.HasSuffix(item.Target.Path, ".proto") || item.Target.OnBreaking == "allow" || local == "" {
+		return nil
+	}
+
+	changes, err := protocheck.Breaking(local, remote)
+	if err != nil {
+		// A file we can't parse can't be checked, which the fail policy
+		// treats like a breaking change
+		if item.Target.OnBreaking == "fail" {
+			return fmt.Errorf("breaking-change check failed: %w", err)
+		}
+		report.Breaking = append(report.Breaking, fmt.Sprintf("not checked: %v", err))
+		return nil
+	}
+
+	for _, change := range changes {
+		report.Breaking = append(report.Breaking, change.String())
+	}
+
+	if len(changes) > 0 && item.Target.OnBreaking == "fail" {
+		return fmt.Errorf("upstream has %d breaking change(s); set onBreaking: warn or allow to apply them", len(changes))
+	}
+
+	return nil
+}
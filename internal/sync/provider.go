@@ -0,0 +1,414 @@
+package sync
+
+import (
+	"log"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/diff"
+	"github.com/exitflynn/codesync/internal/github"
+)
+
+// SourceProvider reads upstream files and history from a code host. Items pick
+// their host with source.provider. GetDirectory fails if any file below the
+// directory can't be read, since directory targets delete what it leaves out.
+type SourceProvider interface {
+	GetFile(owner, repo, path, ref string) (*github.FileInfo, error)
+	GetDirectory(owner, repo, path, ref string) (map[string]*github.FileInfo, error)
+	GetCommitsSince(owner, repo, path, ref string, since time.Time, sinceCommit string) ([]github.CommitInfo, error)
+	GetFileDiff(owner, repo, path, baseRef, headRef string) (string, error)
+}
+
+// FunctionExtractor is a SourceProvider that extracts functions from its
+// files itself, e.g. to support more languages. Items of other providers use
+// github.ExtractFunction.
+type FunctionExtractor interface {
+	ExtractFunction(content, language, functionName string) (string, error)
+}
+
+// Option configures a SyncManager when it is created
+type Option func(*options)
+
+type options struct {
+	providers map[string]SourceProvider
+	offline   bool
+	dryRun    bool
+}
+
+// WithProvider makes items with source.provider name sync from provider
+// instead of the built-in client or plugin, e.g. a test double. Replacing
+// "github" this way also lifts the need for a GitHub token.
+func WithProvider(name string, provider SourceProvider) Option {
+	return func(o *options) {
+		o.providers[name] = provider
+	}
+}
+
+// Offline creates a manager for commands that only work on local files and
+// state, such as Import in a workspace without access to the sources:
+// credentials are neither resolved nor required, so syncs fail.
+func Offline() Option {
+	return func(o *options) {
+		o.offline = true
+	}
+}
+
+// DryRun creates a manager that checks sources and computes the changes a
+// sync would make, reporting them as usual, without writing anything to disk:
+// targets and state are only changed in memory, for the manager's lifetime.
+// Nothing is notified, and ring checks and generators don't run.
+func DryRun() Option {
+	return func(o *options) {
+		o.dryRun = true
+	}
+}
+
+// Archiver is a SourceProvider that can fetch a directory from an archive of
+// the repository in one download, for sources with archive set
+type Archiver interface {
+	GetArchive(owner, repo, path, ref string) (map[string]*github.FileInfo, error)
+}
+
+// Prefetcher is a SourceProvider that can fetch many files in one request
+// ahead of a run, so that reading them during the run costs no requests
+type Prefetcher interface {
+	PrefetchFiles(reads []github.FileRead) error
+}
+
+// FileStatter is a SourceProvider that can describe a file without
+// downloading it, so that large assets are only downloaded once they change
+type FileStatter interface {
+	StatFile(owner, repo, path, ref string) (*github.FileStat, error)
+	GetRawFile(owner, repo, path, ref string) ([]byte, error)
+}
+
+// Blamer is a SourceProvider that can attribute each line of a file to the
+// commit that last changed it, for blameDiffs
+type Blamer interface {
+	GetBlame(owner, repo, path, ref string) ([]*diff.Attribution, error)
+}
+
+// ReleaseFinder is a SourceProvider that publishes release notes for tags,
+// which are added to the changelog of pinned items
+type ReleaseFinder interface {
+	GetRelease(owner, repo, tag string) (*github.ReleaseInfo, error)
+}
+
+// ReleaseLister is a SourceProvider that lists published releases, which
+// items with source.release follow
+type ReleaseLister interface {
+	ListReleases(owner, repo string) ([]*github.ReleaseInfo, error)
+}
+
+// Contributor is a SourceProvider that can propose a change to a file
+// upstream as a pull request
+type Contributor interface {
+	Contribute(contribution github.Contribution) (*github.PullRequest, error)
+}
+
+// SetProvider makes items with source.provider name sync from provider
+// instead of the built-in client, e.g. a test double or a client configured
+// differently. It should be called before syncing.
+func (sm *SyncManager) SetProvider(name string, provider SourceProvider) {
+	if provider == nil {
+		delete(sm.providers, name)
+		return
+	}
+	sm.providers[name] = provider
+}
+
+// getFile fetches a file of an item's source repository at ref. Items of a
+// run that read the same file share one fetch.
+func (sm *SyncManager) getFile(item config.SyncItem, path, ref string) (*github.FileInfo, error) {
+	key := bundleKey(bundleScope(item), "file", item.Source.Owner, item.Source.Repo, path, ref)
+	file, err := runFetch(sm.fetched, key, func() (*github.FileInfo, error) {
+		return sm.source(item).GetFile(item.Source.Owner, item.Source.Repo, path, ref)
+	})
+	if err != nil {
+		return nil, err
+	}
+	copied := *file
+	return &copied, nil
+}
+
+// getDirectory fetches the files below an item's source directory at ref,
+// from an archive if the source asks for one and its provider supports it.
+// Items of a run that read the same directory share one fetch.
+func (sm *SyncManager) getDirectory(item config.SyncItem, ref string) (map[string]*github.FileInfo, error) {
+	key := bundleKey(bundleScope(item), "directory", item.Source.Owner, item.Source.Repo, item.Source.Path, ref)
+	files, err := runFetch(sm.fetched, key, func() (map[string]*github.FileInfo, error) {
+		source := sm.source(item)
+		if archiver, ok := source.(Archiver); ok && item.Source.Archive {
+			return archiver.GetArchive(item.Source.Owner, item.Source.Repo, item.Source.Path, ref)
+		}
+		return source.GetDirectory(item.Source.Owner, item.Source.Repo, item.Source.Path, ref)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return maps.Clone(files), nil
+}
+
+// runCache holds what a run fetched, so that a file several items sync from
+// is downloaded once per run
+type runCache struct {
+	mu      sync.Mutex
+	fetches map[string]*cachedFetch
+}
+
+// cachedFetch is a fetch of a run, done once done is closed
+type cachedFetch struct {
+	done  chan struct{}
+	value any
+	err   error
+}
+
+func newRunCache() *runCache {
+	return &runCache{fetches: make(map[string]*cachedFetch)}
+}
+
+// runFetch calls fetch the first time a run asks for key, and gives its
+// result to the callers asking while it runs and after. Failures are only
+// shared with the callers waiting for them; later ones fetch again. Without a
+// run, fetch is always called.
+func runFetch[T any](cache *runCache, key string, fetch func() (T, error)) (T, error) {
+	if cache == nil {
+		return fetch()
+	}
+
+	cache.mu.Lock()
+	if f, ok := cache.fetches[key]; ok {
+		cache.mu.Unlock()
+		<-f.done
+		if f.err != nil {
+			var zero T
+			return zero, f.err
+		}
+		return f.value.(T), nil
+	}
+	f := &cachedFetch{done: make(chan struct{})}
+	cache.fetches[key] = f
+	cache.mu.Unlock()
+
+	value, err := fetch()
+	f.value, f.err = value, err
+	if err != nil {
+		cache.mu.Lock()
+		delete(cache.fetches, key)
+		cache.mu.Unlock()
+	}
+	close(f.done)
+	return value, err
+}
+
+// prefetch fetches the upstream files of items whose providers can batch
+// reads, where two or more items read from the same repository. Batching only
+// saves requests, so failures are logged and the files are read one by one.
+func (sm *SyncManager) prefetch(items []config.SyncItem) {
+	type repository struct {
+		prefetcher  Prefetcher
+		owner, repo string
+	}
+	byRepo := make(map[repository][]github.FileRead)
+	var order []repository
+	for _, item := range items {
+		// Items following releases only know their ref once they sync
+		if item.Disabled || item.Target.Type == "directory" || item.Source.Release != "" {
+			continue
+		}
+		prefetcher, ok := sm.source(item).(Prefetcher)
+		if !ok {
+			continue
+		}
+		key := repository{prefetcher, item.Source.Owner, item.Source.Repo}
+		if _, ok := byRepo[key]; !ok {
+			order = append(order, key)
+		}
+		byRepo[key] = append(byRepo[key], github.FileRead{
+			Owner: item.Source.Owner,
+			Repo:  item.Source.Repo,
+			Path:  item.Source.Path,
+			Ref:   item.Source.Ref(),
+		})
+	}
+
+	reads := make(map[Prefetcher][]github.FileRead)
+	var prefetchers []Prefetcher
+	for _, key := range order {
+		if len(byRepo[key]) < 2 {
+			continue
+		}
+		if _, ok := reads[key.prefetcher]; !ok {
+			prefetchers = append(prefetchers, key.prefetcher)
+		}
+		reads[key.prefetcher] = append(reads[key.prefetcher], byRepo[key]...)
+	}
+
+	for _, prefetcher := range prefetchers {
+		if err := prefetcher.PrefetchFiles(reads[prefetcher]); err != nil {
+			log.Printf("failed to prefetch files: %s", sm.redactor.String(err.Error()))
+		}
+	}
+}
+
+// extractFunction extracts the item's function from content with the item's
+// provider
+func (sm *SyncManager) extractFunction(item config.SyncItem, content string) (string, error) {
+	if extractor, ok := sm.source(item).(FunctionExtractor); ok {
+		return extractor.ExtractFunction(content, item.Target.Language, item.Target.Function)
+	}
+	return github.ExtractFunction(content, item.Target.Language, item.Target.Function)
+}
+
+// source returns the provider an item syncs from, or the bundle being
+// created or applied in its place
+func (sm *SyncManager) source(item config.SyncItem) SourceProvider {
+	switch {
+	case sm.recording != nil:
+		return &recordingProvider{source: sm.itemProvider(item), bundle: sm.recording, scope: bundleScope(item)}
+	case sm.replaying != nil:
+		return &bundleProvider{bundle: sm.replaying, scope: bundleScope(item)}
+	}
+	return sm.itemProvider(item)
+}
+
+// itemProvider returns the provider of an item's source
+func (sm *SyncManager) itemProvider(item config.SyncItem) SourceProvider {
+	if provider, ok := sm.providers[item.Source.ProviderName()]; ok {
+		return provider
+	}
+
+	switch item.Source.ProviderName() {
+	case config.ProviderGitLab:
+		return sm.gitlabClient
+	case config.ProviderBitbucket:
+		return sm.bitbucketClient
+	case config.ProviderGitea:
+		return sm.giteaClient
+	case config.ProviderGist:
+		return sm.githubFor(item).Gists()
+	case config.ProviderGit:
+		return sm.gitClient.Remote(item.Source.URL)
+	case config.ProviderLocal:
+		return sm.localClient
+	}
+	return sm.githubFor(item)
+}
+
+// newGitHubClient creates a client for github.com, or for a GitHub Enterprise
+// Server instance if baseURL is set, with the configured limits and its
+// responses cached in the store
+func newGitHubClient(cfg *config.Config, store *fileStore, baseURL, uploadURL string) (*github.Client, error) {
+	client := github.NewClient(cfg.GitHubToken)
+	if baseURL != "" {
+		var err error
+		if client, err = github.NewEnterpriseClient(cfg.GitHubToken, baseURL, uploadURL); err != nil {
+			return nil, err
+		}
+	}
+	if limits, ok := limitsOf(cfg); ok {
+		client.SetLimits(limits)
+	}
+	if l := cfg.Limits; l != nil && l.MaxRateLimitWait != "" {
+		// Checked when the config is validated
+		if wait, err := time.ParseDuration(l.MaxRateLimitWait); err == nil {
+			client.SetRateLimitWait(wait)
+		}
+	}
+	client.SetCache(storedCache{store: store, dir: httpCacheDir})
+	return client, nil
+}
+
+// limitsOf returns the configured limits, which apply to the client of each
+// code host separately
+func limitsOf(cfg *config.Config) (github.Limits, bool) {
+	l := cfg.Limits
+	if l == nil {
+		return github.Limits{}, false
+	}
+	return github.Limits{
+		MaxConcurrent:  l.MaxConcurrentDownloads,
+		MaxBytesPerSec: l.MaxBytesPerSecond,
+		MaxAPICalls:    l.MaxAPICalls,
+	}, true
+}
+
+// budgeted is a SourceProvider with an allowance of API calls per run
+type budgeted interface {
+	ResetBudget()
+	BudgetExhausted() bool
+}
+
+// budgetExhausted reports whether the API calls an item's provider may make
+// in this run are used up
+func (sm *SyncManager) budgetExhausted(item config.SyncItem) bool {
+	b, ok := sm.source(item).(budgeted)
+	return ok && b.BudgetExhausted()
+}
+
+// githubFor returns the GitHub client of an item: the default one, unless the
+// item names its own GitHub Enterprise instance. Each instance has its own
+// API budget.
+func (sm *SyncManager) githubFor(item config.SyncItem) *github.Client {
+	baseURL := item.Source.GitHubBaseURL
+	if baseURL == "" || baseURL == sm.config.GitHubBaseURL {
+		return sm.githubClient
+	}
+
+	sm.enterpriseMu.Lock()
+	defer sm.enterpriseMu.Unlock()
+	key := baseURL + " " + item.Source.GitHubUploadURL
+	if client, ok := sm.enterprise[key]; ok {
+		return client
+	}
+	// The URLs are checked when the config is validated
+	client, err := newGitHubClient(sm.config, sm.store, baseURL, item.Source.GitHubUploadURL)
+	if err != nil {
+		return sm.githubClient
+	}
+	sm.enterprise[key] = client
+	return client
+}
+
+// resetBudgets starts a new allowance of API calls on the client of every
+// code host
+func (sm *SyncManager) resetBudgets() {
+	sm.githubClient.ResetBudget()
+	sm.gitlabClient.ResetBudget()
+	sm.bitbucketClient.ResetBudget()
+	sm.giteaClient.ResetBudget()
+	sm.enterpriseMu.Lock()
+	defer sm.enterpriseMu.Unlock()
+	for _, client := range sm.enterprise {
+		client.ResetBudget()
+	}
+}
+
+// needsGitHub reports whether any item syncs through the built-in GitHub
+// client. Without items in the config they are defined elsewhere and may.
+func needsGitHub(cfg *config.Config, providers map[string]SourceProvider) bool {
+	if _, ok := providers[config.ProviderGitHub]; ok {
+		return false
+	}
+	if len(cfg.Items) == 0 {
+		return true
+	}
+	for _, item := range cfg.Items {
+		switch item.Source.ProviderName() {
+		case config.ProviderGitHub, config.ProviderGist:
+			return true
+		}
+	}
+	return false
+}
+
+// fromGitHub reports whether an item syncs through the built-in GitHub
+// client, and so uses the GitHub token and API budget
+func (sm *SyncManager) fromGitHub(item config.SyncItem) bool {
+	if _, ok := sm.providers[item.Source.ProviderName()]; ok {
+		return false
+	}
+	return item.Source.ProviderName() == config.ProviderGitHub
+}
@@ -0,0 +1,187 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/diff"
+	"github.com/exitflynn/codesync/internal/dockerfile"
+	"github.com/exitflynn/codesync/internal/region"
+)
+
+// isFanOut reports whether a region target's path is a glob, in which case
+// the region is synced into every matching file that has its markers
+func isFanOut(item config.SyncItem) bool {
+	return strings.ContainsAny(item.Target.Path, "*?[")
+}
+
+// regionTargets returns the local files a region item syncs into
+func regionTargets(item config.SyncItem) ([]string, error) {
+	if !isFanOut(item) {
+		return []string{item.Target.Path}, nil
+	}
+
+	matches, err := filepath.Glob(item.Target.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []string
+	for _, path := range matches {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue // Directories and unreadable files can't hold the region
+		}
+		if region.Has(string(content), item.Target.Marker) {
+			targets = append(targets, path)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no files matching %s have region %s", item.Target.Path, item.Target.Marker)
+	}
+	return targets, nil
+}
+
+// regionContent returns the local regions of an item, for hashing
+func regionContent(files *workspaceFiles, item config.SyncItem) (string, error) {
+	targets, err := regionTargets(item)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, path := range targets {
+		content, err := files.readFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read local file: %w", err)
+		}
+		body, err := region.Extract(string(content), item.Target.Marker)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", path, err)
+		}
+		fmt.Fprintf(&sb, "%s\n%s", path, body)
+	}
+	return sb.String(), nil
+}
+
+// syncRegions writes the upstream region into every local file of a region
+// item. If the upstream file has the same markers, only its region is
+// synced; otherwise the whole file is. Base images of Dockerfile regions are
+// checked against the item's pinDigests policy first. The files are written
+// through the item's journal, so a crash can't leave only some of them synced.
+func (sm *SyncManager) syncRegions(item config.SyncItem, remoteContent, commitID string, report *SyncReport) error {
+	body, err := regionBody(item, remoteContent, report)
+	if err != nil {
+		return err
+	}
+
+	targets, err := regionTargets(item)
+	if err != nil {
+		return err
+	}
+
+	journal := &Journal{Item: item.Name, CommitID: commitID, Root: absPath(globRoot(item.Target.Path))}
+	var written []string
+	for _, path := range targets {
+		w, err := regionWrite(sm.files, item, path, body)
+		if err != nil {
+			return err
+		}
+		if w != nil {
+			journal.Writes = append(journal.Writes, *w)
+			written = append(written, path)
+		}
+	}
+	if err := sm.writeJournaled(journal); err != nil {
+		return err
+	}
+	for i, path := range written {
+		reportRegion(report, path, journal.Writes[i])
+	}
+	return nil
+}
+
+// regionBody returns the region of an upstream file to sync, once its base
+// images pass the item's pinDigests policy
+func regionBody(item config.SyncItem, remoteContent string, report *SyncReport) (string, error) {
+	body := remoteContent
+	if region.Has(remoteContent, item.Target.Marker) {
+		var err error
+		if body, err = region.Extract(remoteContent, item.Target.Marker); err != nil {
+			return "", err
+		}
+	}
+
+	if err := checkDigests(item, body, report); err != nil {
+		return "", err
+	}
+	return body, nil
+}
+
+// writeRegion replaces the region of a local file with body, if it differs
+func writeRegion(files *workspaceFiles, item config.SyncItem, path, body string, report *SyncReport) error {
+	w, err := regionWrite(files, item, path, body)
+	if err != nil || w == nil {
+		return err
+	}
+	if err := files.writeFile(path, w.Content, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	reportRegion(report, path, *w)
+	return nil
+}
+
+// regionWrite returns the write that replaces the region of a local file
+// with body, or nil if the region already is body
+func regionWrite(files *workspaceFiles, item config.SyncItem, path, body string) (*JournalWrite, error) {
+	content, err := files.readFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	updated, err := region.Replace(string(content), item.Target.Marker, body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if updated == string(content) {
+		return nil, nil
+	}
+	return &JournalWrite{Path: absPath(path), Content: []byte(updated), Previous: content, Existed: true}, nil
+}
+
+// reportRegion records the write of a region into a local file
+func reportRegion(report *SyncReport, path string, w JournalWrite) {
+	report.UpdatedFiles = append(report.UpdatedFiles, path)
+	report.Diffs[path] = diff.GenerateDiff(string(w.Previous), string(w.Content))
+}
+
+// checkDigests applies the pinDigests policy to the base images of a
+// Dockerfile region. Regions synced into other files aren't checked.
+func checkDigests(item config.SyncItem, body string, report *SyncReport) error {
+	if item.Target.PinDigests == "off" || !dockerfile.IsName(item.Target.Path) {
+		return nil
+	}
+
+	unpinned := dockerfile.Unpinned(body)
+	if len(unpinned) == 0 {
+		return nil
+	}
+	if item.Target.PinDigests == "fail" {
+		return errors.New("upstream base images aren't pinned by digest: " + imageList(unpinned))
+	}
+	for _, image := range unpinned {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("base image %s is not pinned by digest", image.Ref))
+	}
+	return nil
+}
+
+func imageList(images []dockerfile.Image) string {
+	refs := make([]string, len(images))
+	for i, image := range images {
+		refs[i] = image.Ref
+	}
+	return strings.Join(refs, ", ")
+}
@@ -0,0 +1,58 @@
+package sync
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/diff"
+)
+
+func TestSyncRegions(t *testing.T) {
+	sm := newTestManager(t)
+	t.Chdir(t.TempDir())
+
+	writeTestFile(t, "services/api/Dockerfile", "# codesync-begin preamble\nFROM alpine:3.18\n# codesync-end preamble\nCOPY api /api\n")
+	writeTestFile(t, "services/web/Dockerfile", "# codesync-begin preamble\n# codesync-end preamble\nCOPY web /web\n")
+	writeTestFile(t, "services/legacy/Dockerfile", "FROM ubuntu\n")
+
+	item := config.SyncItem{
+		Name:   "preamble",
+		Target: config.SyncTarget{Path: "services/*/Dockerfile", Type: "region", Marker: "preamble"},
+	}
+	upstream := "# Hardened base\n# codesync-begin preamble\nFROM alpine:3.19@sha256:abc\nUSER app\n# codesync-end preamble\n"
+
+	report := &SyncReport{Diffs: make(map[string]*diff.DiffResult)}
+	if err := sm.syncRegions(item, upstream, "c1", report); err != nil {
+		t.Fatalf("syncRegions failed: %v", err)
+	}
+	if len(report.UpdatedFiles) != 2 || len(report.Diffs) != 2 || len(report.Warnings) != 0 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if data, err := sm.store.read(journalName("preamble")); err != nil || !strings.Contains(string(data), `"applied":true`) {
+		t.Errorf("Expected both files to be journaled until the state is saved, got %s, %v", data, err)
+	}
+
+	api, _ := os.ReadFile("services/api/Dockerfile")
+	if string(api) != "# codesync-begin preamble\nFROM alpine:3.19@sha256:abc\nUSER app\n# codesync-end preamble\nCOPY api /api\n" {
+		t.Errorf("Unexpected Dockerfile:\n%s", api)
+	}
+	if legacy, _ := os.ReadFile("services/legacy/Dockerfile"); string(legacy) != "FROM ubuntu\n" {
+		t.Error("Expected files without markers to be left alone")
+	}
+
+	// Unpinned images are reported, or block the sync with pinDigests: fail
+	report = &SyncReport{Diffs: make(map[string]*diff.DiffResult)}
+	if err := sm.syncRegions(item, "FROM alpine:3.20\n", "c2", report); err != nil || len(report.Warnings) != 1 {
+		t.Errorf("Expected a warning for an unpinned image: %v %v", err, report.Warnings)
+	}
+
+	item.Target.PinDigests = "fail"
+	if err := sm.syncRegions(item, "FROM alpine:3.21\n", "c3", &SyncReport{Diffs: make(map[string]*diff.DiffResult)}); err == nil {
+		t.Error("Expected unpinned image to fail the sync")
+	}
+	if api, _ := os.ReadFile("services/api/Dockerfile"); string(api) != "# codesync-begin preamble\nFROM alpine:3.20\n# codesync-end preamble\nCOPY api /api\n" {
+		t.Errorf("Expected failed sync to leave files alone:\n%s", api)
+	}
+}
@@ -0,0 +1,87 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+	"github.com/exitflynn/codesync/internal/version"
+)
+
+// resolveRelease points an item following releases at the tag of the highest
+// published release in its range, and an item with an update policy at the
+// highest release the policy allows after its tag. Newer releases the policy
+// holds back are reported as available. Other items are returned as they are.
+func (sm *SyncManager) resolveRelease(item config.SyncItem, state *State, report *SyncReport) (config.SyncItem, error) {
+	if item.Source.Release == "" && item.Source.Update == "" {
+		return item, nil
+	}
+
+	lister, ok := sm.source(item).(ReleaseLister)
+	if !ok {
+		return item, fmt.Errorf("source provider %s doesn't list releases", item.Source.ProviderName())
+	}
+	releases, err := lister.ListReleases(item.Source.Owner, item.Source.Repo)
+	if err != nil {
+		return item, fmt.Errorf("failed to list releases: %w", err)
+	}
+
+	r := item.Source.Release
+	if item.Source.Update != "" {
+		r = updateRange(item.Source.Tag, item.Source.Update)
+	}
+	release := latestRelease(releases, r)
+	switch {
+	case release != nil:
+		item.Source.Tag = release.Tag
+		report.Release = release
+	case item.Source.Release != "":
+		return item, fmt.Errorf("release of %s/%s matching %s %w", item.Source.Owner, item.Source.Repo, item.Source.Release, ErrNotFound)
+	}
+	// Otherwise the tag has no release, and nothing newer is allowed
+
+	// Each held back release is reported once; status keeps showing it
+	available := ""
+	if newest := latestRelease(releases, "latest"); item.Source.Update != "" && newest != nil && version.Compare(newest.Tag, item.Source.Tag) > 0 {
+		available = newest.Tag
+	}
+	if available != "" && available != state.Available {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("%s is available but not synced: update policy is %s", available, item.Source.Update))
+	}
+	state.Available = available
+	return item, nil
+}
+
+// updateRange returns the range of releases an update policy allows for an
+// item at tag
+func updateRange(tag, policy string) string {
+	switch policy {
+	case config.UpdatePatch:
+		return "~" + tag
+	case config.UpdateMinor:
+		return "^" + tag
+	case config.UpdateLatest:
+		return ">= " + tag
+	}
+	return "= " + tag
+}
+
+// latestRelease returns the release with the highest version in a range, or
+// nil if none is. Releases marked as prereleases are skipped unless the range
+// names a prerelease, like prerelease versions.
+func latestRelease(releases []*github.ReleaseInfo, r string) *github.ReleaseInfo {
+	var latest *github.ReleaseInfo
+	for _, release := range releases {
+		if release.Prerelease && !strings.Contains(r, "-") {
+			continue
+		}
+		if ok, err := version.InRange(release.Tag, r); err != nil || !ok {
+			continue
+		}
+		if latest == nil || version.Compare(release.Tag, latest.Tag) > 0 {
+			latest = release
+		}
+	}
+	return latest
+}
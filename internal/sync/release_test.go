@@ -0,0 +1,163 @@
+package sync
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+	"github.com/exitflynn/codesync/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+// releaseProvider publishes releases
+type releaseProvider struct {
+	*mocks.MockGitHubClient
+	releases []*github.ReleaseInfo
+}
+
+func (p *releaseProvider) ListReleases(owner, repo string) ([]*github.ReleaseInfo, error) {
+	return p.releases, nil
+}
+
+func TestLatestRelease(t *testing.T) {
+	releases := []*github.ReleaseInfo{
+		{Tag: "v2.0.0-rc.1", Prerelease: true},
+		{Tag: "v1.10.0"},
+		{Tag: "v1.9.2"},
+		{Tag: "nightly"},
+		{Tag: "v1.2.0"},
+		{Tag: "v0.9.0"},
+	}
+	for _, tt := range []struct {
+		r    string
+		want string
+	}{
+		{"latest", "v1.10.0"},
+		{"^1.2", "v1.10.0"},
+		{"~1.9", "v1.9.2"},
+		{"^0.9", "v0.9.0"},
+		{">= 2.0.0-rc.0", "v2.0.0-rc.1"},
+		{"^3", ""},
+	} {
+		tag := ""
+		if got := latestRelease(releases, tt.r); got != nil {
+			tag = got.Tag
+		}
+		if tag != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.r, tt.want, tag)
+		}
+	}
+}
+
+func TestSyncFollowsLatestRelease(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	item := config.SyncItem{
+		Name:   "lib",
+		Source: config.SyncSource{Owner: "acme", Repo: "lib", Path: "lib.go", Branch: "main", Release: "^1.2"},
+		Target: config.SyncTarget{Path: "lib.go", Type: "file"},
+	}
+
+	mock := mocks.NewMockGitHubClient(gomock.NewController(t))
+	source := &releaseProvider{
+		MockGitHubClient: mock,
+		releases:         []*github.ReleaseInfo{{Tag: "v2.0.0"}, {Tag: "v1.3.0"}, {Tag: "v1.2.0"}},
+	}
+	// The release's tag is read instead of the branch, and its commit is
+	// what the state records
+	mock.EXPECT().GetCommitsSince("acme", "lib", "lib.go", "v1.3.0", time.Time{}, "").
+		Return([]github.CommitInfo{{SHA: "c13"}}, nil)
+	mock.EXPECT().GetFile("acme", "lib", "lib.go", "c13").
+		Return(&github.FileInfo{Content: "package lib // 1.3\n"}, nil)
+
+	cfg := &config.Config{Version: "1.0", Items: []config.SyncItem{item}}
+	sm, err := NewSyncManager(cfg, t.TempDir(), WithProvider(config.ProviderGitHub, source))
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+
+	report, err := sm.SyncItem(item)
+	if err != nil {
+		t.Fatalf("SyncItem failed: %v", err)
+	}
+	if content, _ := os.ReadFile(item.Target.Path); string(content) != "package lib // 1.3\n" {
+		t.Errorf("Expected the file at the latest matching release, got %q", content)
+	}
+	if report.State.Tag != "v1.3.0" || report.State.LastCommitID != "c13" || report.Release.Tag != "v1.3.0" {
+		t.Errorf("Expected v1.3.0 at c13 to be recorded, got %+v and release %+v", report.State, report.Release)
+	}
+
+	// Without a matching release there is nothing to sync
+	source.releases = []*github.ReleaseInfo{{Tag: "v2.0.0"}}
+	if _, err := sm.SyncItem(item); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected no matching release to fail as not found, got %v", err)
+	}
+}
+
+func TestUpdatePolicy(t *testing.T) {
+	releases := []*github.ReleaseInfo{{Tag: "v2.1.0"}, {Tag: "v1.4.1"}, {Tag: "v1.2.5"}, {Tag: "v1.2.0"}}
+	for _, tt := range []struct {
+		policy string
+		want   string
+	}{
+		{config.UpdatePin, "v1.2.0"},
+		{config.UpdatePatch, "v1.2.5"},
+		{config.UpdateMinor, "v1.4.1"},
+		{config.UpdateLatest, "v2.1.0"},
+	} {
+		if got := latestRelease(releases, updateRange("v1.2.0", tt.policy)); got == nil || got.Tag != tt.want {
+			t.Errorf("%s: expected %s, got %+v", tt.policy, tt.want, got)
+		}
+	}
+}
+
+func TestSyncReportsMajorBumps(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	item := config.SyncItem{
+		Name:   "lib",
+		Source: config.SyncSource{Owner: "acme", Repo: "lib", Path: "lib.go", Branch: "main", Tag: "v1.2.0", Update: config.UpdateMinor},
+		Target: config.SyncTarget{Path: "lib.go", Type: "file"},
+	}
+
+	mock := mocks.NewMockGitHubClient(gomock.NewController(t))
+	source := &releaseProvider{
+		MockGitHubClient: mock,
+		releases:         []*github.ReleaseInfo{{Tag: "v2.0.0"}, {Tag: "v1.4.0"}, {Tag: "v1.2.0"}},
+	}
+	mock.EXPECT().GetCommitsSince("acme", "lib", "lib.go", "v1.4.0", time.Time{}, "").
+		Return([]github.CommitInfo{{SHA: "c14"}}, nil)
+	mock.EXPECT().GetFile("acme", "lib", "lib.go", "c14").
+		Return(&github.FileInfo{Content: "package lib // 1.4\n"}, nil)
+	mock.EXPECT().GetCommitsSince("acme", "lib", "lib.go", "v1.4.0", time.Time{}, "c14").
+		Return(nil, nil)
+
+	cfg := &config.Config{Version: "1.0", Items: []config.SyncItem{item}}
+	sm, err := NewSyncManager(cfg, t.TempDir(), WithProvider(config.ProviderGitHub, source))
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+
+	report, err := sm.SyncItem(item)
+	if err != nil {
+		t.Fatalf("SyncItem failed: %v", err)
+	}
+	if content, _ := os.ReadFile(item.Target.Path); string(content) != "package lib // 1.4\n" {
+		t.Errorf("Expected the latest minor release to be synced, got %q", content)
+	}
+	if report.State.Tag != "v1.4.0" || report.State.Available != "v2.0.0" || len(report.Warnings) != 1 {
+		t.Errorf("Expected v2.0.0 to be reported but not synced, got %+v and warnings %v", report.State, report.Warnings)
+	}
+
+	// The major bump is only reported once
+	report, err = sm.SyncItem(item)
+	if err != nil {
+		t.Fatalf("Second sync failed: %v", err)
+	}
+	if report.State.Available != "v2.0.0" || len(report.Warnings) != 0 {
+		t.Errorf("Expected the major bump to stay available without another warning, got %+v and warnings %v", report.State, report.Warnings)
+	}
+}
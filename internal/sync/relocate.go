@@ -0,0 +1,186 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/discover"
+)
+
+// errFunctionNotFound is returned when no other file defines a function
+var errFunctionNotFound = errors.New("function not found elsewhere")
+
+// languageExtensions lists the file extensions searched for a moved function
+var languageExtensions = map[string][]string{
+	"go":         {".go"},
+	"python":     {".py"},
+	"javascript": {".js", ".mjs", ".cjs", ".jsx"},
+}
+
+// resolveFunctionTarget points a function item at the file that currently
+// defines the function. If the function is no longer in the configured file,
+// the workspace (or the item's search paths) is searched for it. With
+// relocate: auto the item follows the function and the new path is recorded
+// in the state; with suggest (the default) the sync fails with a hint.
+func (sm *SyncManager) resolveFunctionTarget(item config.SyncItem, state *State, report *SyncReport) (config.SyncItem, error) {
+	mode := item.Target.Relocate
+	if mode == "off" {
+		return item, nil
+	}
+
+	// A previous sync already followed the function
+	if state.RelocatedPath != "" {
+		if sm.definesFunction(state.RelocatedPath, item) {
+			item.Target.Path = state.RelocatedPath
+			return item, nil
+		}
+		state.RelocatedPath = ""
+	}
+
+	if sm.definesFunction(item.Target.Path, item) {
+		return item, nil
+	}
+
+	found, err := sm.findMovedFunction(item)
+	if errors.Is(err, errFunctionNotFound) {
+		// Nothing to follow; the regular sync reports the missing function
+		return item, nil
+	}
+	if err != nil {
+		return item, err
+	}
+
+	if mode != "auto" {
+		return item, fmt.Errorf("function %s moved to %s; update target.path or set relocate: auto", item.Target.Function, found)
+	}
+
+	state.RelocatedPath = found
+	report.Relocated = found
+
+	// Moving the function isn't a local edit of it, so compare future local
+	// changes against the new file
+	if content, err := os.ReadFile(found); err == nil {
+		state.CurrentLocalHash = calculateHash(string(content))
+	}
+
+	item.Target.Path = found
+	return item, nil
+}
+
+// definesFunction reports whether the file at path contains the item's
+// function
+func (sm *SyncManager) definesFunction(path string, item config.SyncItem) bool {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	_, err = sm.extractFunction(item, string(content))
+	return err == nil
+}
+
+// findMovedFunction searches for files defining the item's function. When
+// several do, the copy most similar to the last synced upstream version wins.
+func (sm *SyncManager) findMovedFunction(item config.SyncItem) (string, error) {
+	candidates, err := sm.searchCandidates(item)
+	if err != nil {
+		return "", err
+	}
+
+	var matches []string
+	for _, path := range candidates {
+		if filepath.Clean(path) != filepath.Clean(item.Target.Path) && sm.definesFunction(path, item) {
+			matches = append(matches, path)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", errFunctionNotFound
+	case 1:
+		return matches[0], nil
+	}
+
+	// Rank by similarity to the function as last synced from upstream
+	snapshot, err := sm.loadSnapshot(item.Name)
+	if err != nil {
+		return "", fmt.Errorf("function %s is defined in several files: %s", item.Target.Function, strings.Join(matches, ", "))
+	}
+	synced, err := sm.extractFunction(item, snapshot)
+	if err != nil {
+		return "", fmt.Errorf("function %s is defined in several files: %s", item.Target.Function, strings.Join(matches, ", "))
+	}
+
+	best, bestScore, tied := "", -1.0, false
+	for _, path := range matches {
+		content, _ := os.ReadFile(path)
+		local, _ := sm.extractFunction(item, string(content))
+
+		score := discover.Similarity(local, synced)
+		switch {
+		case score > bestScore:
+			best, bestScore, tied = path, score, false
+		case score == bestScore:
+			tied = true
+		}
+	}
+
+	if tied {
+		return "", fmt.Errorf("function %s is defined in several equally similar files: %s", item.Target.Function, strings.Join(matches, ", "))
+	}
+
+	return best, nil
+}
+
+// searchCandidates lists the files that may hold a moved function: matches of
+// the item's search paths, or every file in the workspace with a matching
+// extension
+func (sm *SyncManager) searchCandidates(item config.SyncItem) ([]string, error) {
+	if len(item.Target.SearchPaths) > 0 {
+		var paths []string
+		for _, pattern := range item.Target.SearchPaths {
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid search path '%s': %w", pattern, err)
+			}
+			paths = append(paths, matches...)
+		}
+		sort.Strings(paths)
+		return paths, nil
+	}
+
+	extensions := languageExtensions[item.Target.Language]
+	var paths []string
+	err := filepath.WalkDir(".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			name := d.Name()
+			if path != "." && (strings.HasPrefix(name, ".") || name == "vendor" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		for _, ext := range extensions {
+			if filepath.Ext(path) == ext {
+				paths = append(paths, path)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error searching workspace: %w", err)
+	}
+
+	return paths, nil
+}
@@ -0,0 +1,154 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+const trimAll = `func TrimAll(words []string, cutset string) []string {
+	result := make([]string, 0, len(words))
+	for _, word := range words {
+		if trimmed := strings.Trim(word, cutset); trimmed != "" {
+			result = append(result, trimmed)
+		}
+	}
+	return result
+}
+`
+
+func newTestManager(t *testing.T) *SyncManager {
+	t.Helper()
+
+	sm, err := NewSyncManager(&config.Config{Version: "1.0", GitHubToken: "test-token"}, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	return sm
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func functionItem(relocate string) config.SyncItem {
+	return config.SyncItem{
+		Name:   "trim",
+		Source: config.SyncSource{Owner: "acme", Repo: "utils", Path: "strings.go", Branch: "main"},
+		Target: config.SyncTarget{
+			Path:     filepath.Join("util", "strings.go"),
+			Type:     "function",
+			Language: "go",
+			Function: "TrimAll",
+			Relocate: relocate,
+		},
+	}
+}
+
+func TestResolveFunctionTarget(t *testing.T) {
+	t.Chdir(t.TempDir())
+	sm := newTestManager(t)
+
+	// The function moved from util/strings.go to text/trim.go
+	writeTestFile(t, "util/strings.go", "package util\n")
+	writeTestFile(t, "text/trim.go", "package text\n\n"+trimAll)
+
+	t.Run("unchanged", func(t *testing.T) {
+		writeTestFile(t, "same/strings.go", "package same\n\n"+trimAll)
+		item := functionItem("auto")
+		item.Target.Path = "same/strings.go"
+
+		var state State
+		resolved, err := sm.resolveFunctionTarget(item, &state, &SyncReport{})
+		if err != nil || resolved.Target.Path != "same/strings.go" || state.RelocatedPath != "" {
+			t.Errorf("Expected target to stay put: %v %+v", err, resolved.Target)
+		}
+		os.RemoveAll("same")
+	})
+
+	t.Run("suggest", func(t *testing.T) {
+		var state State
+		_, err := sm.resolveFunctionTarget(functionItem(""), &state, &SyncReport{})
+		if err == nil || !strings.Contains(err.Error(), filepath.Join("text", "trim.go")) {
+			t.Errorf("Expected a hint naming the new location, got %v", err)
+		}
+		if state.RelocatedPath != "" {
+			t.Errorf("Expected suggest mode not to relocate, got %s", state.RelocatedPath)
+		}
+	})
+
+	t.Run("off", func(t *testing.T) {
+		var state State
+		resolved, err := sm.resolveFunctionTarget(functionItem("off"), &state, &SyncReport{})
+		if err != nil || resolved.Target.Path != filepath.Join("util", "strings.go") {
+			t.Errorf("Expected off mode to leave the target alone: %v %+v", err, resolved.Target)
+		}
+	})
+
+	t.Run("auto", func(t *testing.T) {
+		var state State
+		report := &SyncReport{}
+		resolved, err := sm.resolveFunctionTarget(functionItem("auto"), &state, report)
+		if err != nil {
+			t.Fatalf("resolveFunctionTarget failed: %v", err)
+		}
+
+		want := filepath.Join("text", "trim.go")
+		if resolved.Target.Path != want || state.RelocatedPath != want || report.Relocated != want {
+			t.Errorf("Expected relocation to %s: %+v %+v", want, resolved.Target, state)
+		}
+		if state.CurrentLocalHash == "" {
+			t.Error("Expected local hash to be reset to the new file")
+		}
+
+		// Later syncs reuse the recorded location without reporting it again
+		report = &SyncReport{}
+		resolved, err = sm.resolveFunctionTarget(functionItem("auto"), &state, report)
+		if err != nil || resolved.Target.Path != want || report.Relocated != "" {
+			t.Errorf("Expected recorded location to be reused: %v %+v %+v", err, resolved.Target, report)
+		}
+	})
+
+	t.Run("search paths", func(t *testing.T) {
+		item := functionItem("auto")
+		item.Target.SearchPaths = []string{"lib/*.go"}
+
+		var state State
+		resolved, err := sm.resolveFunctionTarget(item, &state, &SyncReport{})
+		if err != nil || resolved.Target.Path != item.Target.Path {
+			t.Errorf("Expected no relocation outside the search paths: %v %+v", err, resolved.Target)
+		}
+	})
+}
+
+func TestResolveFunctionTargetPrefersSimilarCopy(t *testing.T) {
+	t.Chdir(t.TempDir())
+	sm := newTestManager(t)
+
+	writeTestFile(t, "util/strings.go", "package util\n")
+	writeTestFile(t, "a/trim.go", "package a\n\n"+trimAll)
+	writeTestFile(t, "b/trim.go", "package b\n\nfunc TrimAll(words []string, cutset string) []string {\n\treturn nil\n}\n")
+
+	var state State
+	if _, err := sm.resolveFunctionTarget(functionItem("auto"), &state, &SyncReport{}); err == nil {
+		t.Fatal("Expected ambiguity error without a snapshot")
+	}
+
+	if err := sm.saveSnapshot("trim", "package upstream\n\n"+trimAll); err != nil {
+		t.Fatalf("saveSnapshot failed: %v", err)
+	}
+
+	resolved, err := sm.resolveFunctionTarget(functionItem("auto"), &state, &SyncReport{})
+	if err != nil || resolved.Target.Path != filepath.Join("a", "trim.go") {
+		t.Errorf("Expected the copy matching the snapshot to win: %v %+v", err, resolved.Target)
+	}
+}
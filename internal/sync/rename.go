@@ -0,0 +1,143 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+// RenameItemState moves the state of an item to a new name: its state file,
+// snapshots, conflicts and its place in an unfinished run. Either everything is moved or,
+// if a step fails, whatever was already moved is put back. It returns the
+// renamed files, relative to the state directory.
+func RenameItemState(cfg *config.Config, stateDir, oldName, newName string) ([]string, error) {
+	if oldName == newName || newName == "" {
+		return nil, fmt.Errorf("new name must differ from the old one")
+	}
+
+	store, err := newFileStore(cfg, stateDir)
+	if err != nil {
+		return nil, err
+	}
+
+	moves := [][2]string{
+		{sanitizeFilename(oldName) + ".json", sanitizeFilename(newName) + ".json"},
+		{snapshotName(oldName), snapshotName(newName)},
+		{legacySnapshotName(oldName), legacySnapshotName(newName)},
+	}
+
+	var pending [][2]string
+	for _, move := range moves {
+		if _, err := os.Stat(filepath.Join(stateDir, move[0])); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		if _, err := os.Stat(filepath.Join(stateDir, move[1])); err == nil {
+			return nil, fmt.Errorf("%s already has state (%s); remove it first", newName, move[1])
+		}
+		pending = append(pending, move)
+	}
+	if len(pending) == 0 {
+		return nil, fmt.Errorf("no state found for %s", oldName)
+	}
+
+	var done []string
+	undo := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			store.rename(pending[i][1], pending[i][0])
+		}
+	}
+
+	for _, move := range pending {
+		if err := store.rename(move[0], move[1]); err != nil {
+			undo()
+			return nil, fmt.Errorf("failed to rename %s: %w", move[0], err)
+		}
+		done = append(done, move[0])
+	}
+
+	if err := renameInProgress(store, oldName, newName); err != nil {
+		undo()
+		return nil, err
+	}
+	if err := renameConflicts(store, oldName, newName); err != nil {
+		undo()
+		return nil, err
+	}
+
+	return done, nil
+}
+
+// renameInProgress renames an item among the completed items of an unfinished
+// run, so that resuming it doesn't sync the item again
+func renameInProgress(store *fileStore, oldName, newName string) error {
+	data, err := store.read(progressName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read run progress: %w", err)
+	}
+
+	var progress runProgress
+	if err := json.Unmarshal(data, &progress); err != nil {
+		return fmt.Errorf("invalid run progress: %w", err)
+	}
+
+	changed := false
+	for i, name := range progress.Completed {
+		if name == oldName {
+			progress.Completed[i] = newName
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	data, err = json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+	return store.write(progressName, data)
+}
+
+// renameConflicts moves an item's conflicts in the inbox to its new name
+func renameConflicts(store *fileStore, oldName, newName string) error {
+	data, err := store.read(conflictsName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read conflicts: %w", err)
+	}
+
+	var conflicts []Conflict
+	if err := json.Unmarshal(data, &conflicts); err != nil {
+		return fmt.Errorf("invalid conflicts file: %w", err)
+	}
+
+	changed := false
+	for i := range conflicts {
+		if conflicts[i].Item == oldName {
+			conflicts[i].Item = newName
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	data, err = json.MarshalIndent(conflicts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return store.write(conflictsName, data)
+}
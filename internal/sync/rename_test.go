@@ -0,0 +1,66 @@
+package sync
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+func TestRenameItemState(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	writeTestFile(t, filepath.Join(dir, "team_old.json"), "{}")
+	writeTestFile(t, filepath.Join(dir, "snapshots", "team_old.chain"), "{}")
+	progress, _ := json.Marshal(runProgress{ID: "run", Completed: []string{"other", "team/old"}})
+	writeTestFile(t, filepath.Join(dir, progressName), string(progress))
+
+	renamed, err := RenameItemState(cfg, dir, "team/old", "new")
+	if err != nil {
+		t.Fatalf("RenameItemState failed: %v", err)
+	}
+	if len(renamed) != 2 {
+		t.Errorf("Expected 2 renamed files, got %v", renamed)
+	}
+
+	for _, name := range []string{"new.json", "snapshots/new.chain"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %s to exist: %v", name, err)
+		}
+	}
+	for _, name := range []string{"team_old.json", "snapshots/team_old.chain"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("Expected %s to be gone", name)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, progressName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got runProgress
+	json.Unmarshal(data, &got)
+	if len(got.Completed) != 2 || got.Completed[1] != "new" {
+		t.Errorf("Expected progress to use the new name, got %v", got.Completed)
+	}
+}
+
+func TestRenameItemStateRefusesExisting(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{}
+	writeTestFile(t, filepath.Join(dir, "old.json"), "{}")
+	writeTestFile(t, filepath.Join(dir, "new.json"), "{}")
+
+	if _, err := RenameItemState(cfg, dir, "old", "new"); err == nil {
+		t.Fatal("Expected an error when the new name already has state")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.json")); err != nil {
+		t.Errorf("Expected the old state to be left alone: %v", err)
+	}
+
+	if _, err := RenameItemState(cfg, dir, "missing", "other"); err == nil {
+		t.Error("Expected an error for an item without state")
+	}
+}
@@ -0,0 +1,385 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+// runRecordVersion is the version of the run records audited runs write
+const runRecordVersion = 1
+
+// RunRecord is what an audited SyncAll run started from, fetched and
+// produced, so that Replay can re-execute it without the network
+type RunRecord struct {
+	Version int                     `json:"version"`
+	ID      string                  `json:"id"`
+	Started time.Time               `json:"started"`
+	Items   []config.SyncItem       `json:"items"`  // As configured for the run
+	Before  map[string]RecordedItem `json:"before"` // State of the enabled items before the run, by name
+	Files   map[string]RecordedFile `json:"files"`  // Their target files before the run, by workspace path
+	Bundle  *Bundle                 `json:"bundle"` // Provider calls the run made
+	Results []RunResult             `json:"results"`
+}
+
+// RecordedItem is the state of an item before an audited run
+type RecordedItem struct {
+	State    State  `json:"state"`
+	Snapshot string `json:"snapshot,omitempty"` // Upstream content last synced
+}
+
+// RecordedFile is a target file before an audited run
+type RecordedFile struct {
+	Content []byte      `json:"content"`
+	Mode    fs.FileMode `json:"mode"`
+}
+
+// RunResult is what an audited run left an item at. Deferred items have none.
+type RunResult struct {
+	Item   string         `json:"item"`
+	Commit string         `json:"commit,omitempty"` // Upstream commit last synced
+	Files  []ExportedFile `json:"files"`            // Target files after the run
+	Error  string         `json:"error,omitempty"`
+}
+
+// ReplayResult compares an item of a recorded run with its replay and with
+// the workspace
+type ReplayResult struct {
+	Item        string
+	Commit      string   // Upstream commit the run left the item at
+	Reproduced  bool     // The replay gave the files, commit and outcome the run recorded
+	Differences []string // How the replay differs from the run
+	Changed     []string // Files the run produced that differ in the workspace now
+}
+
+// runRecordName returns the store name of a run's record
+func runRecordName(id string) string {
+	return filepath.Join(runsDir, id+".json")
+}
+
+// startRecord captures the state and targets of the enabled items before an
+// audited run
+func (sm *SyncManager) startRecord(id string) (*RunRecord, error) {
+	record := &RunRecord{
+		Version: runRecordVersion,
+		ID:      id,
+		Started: sm.Now().UTC(),
+		Items:   sm.Items(),
+		Before:  make(map[string]RecordedItem),
+		Files:   make(map[string]RecordedFile),
+		Bundle:  newBundle(sm.Now().UTC()),
+	}
+
+	for _, item := range record.Items {
+		if item.Disabled {
+			continue
+		}
+		state, err := sm.loadState(item.Name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("item %s: %w", item.Name, err)
+		}
+		before := RecordedItem{State: state}
+		if snapshot, err := sm.loadSnapshot(item.Name); err == nil {
+			before.Snapshot = snapshot
+		}
+		record.Before[item.Name] = before
+
+		files, err := syncedFiles(item, state)
+		if err != nil {
+			return nil, fmt.Errorf("item %s: %w", item.Name, err)
+		}
+		for _, file := range files {
+			if _, ok := record.Files[file]; ok {
+				continue
+			}
+			content, err := os.ReadFile(filepath.FromSlash(file))
+			if err != nil {
+				return nil, fmt.Errorf("item %s: %w", item.Name, err)
+			}
+			info, err := os.Stat(filepath.FromSlash(file))
+			if err != nil {
+				return nil, fmt.Errorf("item %s: %w", item.Name, err)
+			}
+			record.Files[file] = RecordedFile{Content: content, Mode: info.Mode().Perm()}
+		}
+	}
+	return record, nil
+}
+
+// finishRecord adds what a run left its items at to the run's record and
+// stores it
+func (sm *SyncManager) finishRecord(record *RunRecord, reports []*SyncReport) error {
+	for _, report := range reports {
+		if report.Deferred {
+			continue
+		}
+		item := report.SyncItem
+		state, err := sm.loadState(item.Name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("item %s: %w", item.Name, err)
+		}
+		files, err := hashedFiles(item, state)
+		if err != nil {
+			return fmt.Errorf("item %s: %w", item.Name, err)
+		}
+		record.Results = append(record.Results, RunResult{
+			Item:   item.Name,
+			Commit: state.LastCommitID,
+			Files:  files,
+			Error:  strings.Join(report.Errors, "; "),
+		})
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run record: %w", err)
+	}
+	return sm.store.write(runRecordName(record.ID), data)
+}
+
+// syncedFiles returns the existing target files of an item, following a
+// relocated target
+func syncedFiles(item config.SyncItem, state State) ([]string, error) {
+	if state.RelocatedPath != "" {
+		item.Target.Path = state.RelocatedPath
+	}
+	return targetFiles(item)
+}
+
+// hashedFiles returns the existing target files of an item with their
+// hashes, sorted by path
+func hashedFiles(item config.SyncItem, state State) ([]ExportedFile, error) {
+	paths, err := syncedFiles(item, state)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	files := make([]ExportedFile, 0, len(paths))
+	for _, path := range paths {
+		content, err := os.ReadFile(filepath.FromSlash(path))
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(content)
+		files = append(files, ExportedFile{Path: path, SHA256: hex.EncodeToString(sum[:])})
+	}
+	return files, nil
+}
+
+// Runs returns the IDs of the recorded runs, oldest first
+func (sm *SyncManager) Runs() ([]string, error) {
+	entries, err := os.ReadDir(sm.store.path(runsDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if ok && entry.Type().IsRegular() && entry.Name() != filepath.Base(progressName) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Replay re-executes a recorded run without the network: the items are
+// synced from the run's config, state and provider responses in a scratch
+// copy of their targets as they were before it, at the time it started. The
+// result is compared with what the run recorded, and what the run produced
+// with the workspace, which is left alone. Commands the items run, such as
+// generators and ring checks, run again in the scratch copy. It changes the
+// working directory while replaying, so it must not run while items sync.
+func (sm *SyncManager) Replay(id string) ([]ReplayResult, error) {
+	data, err := sm.store.read(runRecordName(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("run %s wasn't recorded", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run record: %w", err)
+	}
+	var record RunRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("invalid run record: %w", err)
+	}
+	if record.Version > runRecordVersion {
+		return nil, fmt.Errorf("run record version %d is newer than this codesync supports", record.Version)
+	}
+	for _, item := range record.Items {
+		if !item.Disabled && filepath.IsAbs(item.Target.Path) {
+			return nil, fmt.Errorf("item %s has an absolute target, which can't be replayed in a scratch copy", item.Name)
+		}
+	}
+
+	scratch, err := os.MkdirTemp("", "codesync-replay-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(scratch)
+
+	workspace := filepath.Join(scratch, "workspace")
+	for path, file := range record.Files {
+		p := filepath.Join(workspace, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(p, file.Content, file.Mode); err != nil {
+			return nil, err
+		}
+	}
+
+	replayed, err := sm.replayRun(&record, workspace, filepath.Join(scratch, "state"))
+	if err != nil {
+		return nil, err
+	}
+
+	var results []ReplayResult
+	for _, result := range record.Results {
+		replay := replayed[result.Item]
+		r := ReplayResult{Item: result.Item, Commit: result.Commit}
+		r.Differences = compareFiles(result.Files, replay.Files)
+		if replay.Commit != result.Commit {
+			r.Differences = append(r.Differences, fmt.Sprintf("synced commit %s, not %s", orNone(replay.Commit), orNone(result.Commit)))
+		}
+		switch {
+		case replay.Error != "" && result.Error == "":
+			r.Differences = append(r.Differences, "failed: "+replay.Error)
+		case replay.Error == "" && result.Error != "":
+			r.Differences = append(r.Differences, "succeeded, but the run failed: "+result.Error)
+		}
+		r.Reproduced = len(r.Differences) == 0
+
+		for _, file := range result.Files {
+			content, err := os.ReadFile(filepath.FromSlash(file.Path))
+			if err != nil {
+				r.Changed = append(r.Changed, file.Path+" (missing)")
+				continue
+			}
+			if sum := sha256.Sum256(content); hex.EncodeToString(sum[:]) != file.SHA256 {
+				r.Changed = append(r.Changed, file.Path)
+			}
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// replayRun syncs the items of a record in a scratch workspace and state
+// directory from the record alone, and returns what it left them at by name
+func (sm *SyncManager) replayRun(record *RunRecord, workspace, stateDir string) (map[string]RunResult, error) {
+	// Only what shapes the content is kept: nothing is notified or reported
+	cfg := &config.Config{
+		Version:      sm.config.Version,
+		ProjectName:  sm.config.ProjectName,
+		Items:        record.Items,
+		MergeDrivers: sm.config.MergeDrivers,
+		Redact:       sm.config.Redact,
+		PluginDir:    sm.config.PluginDir,
+		Plugins:      sm.config.Plugins,
+	}
+	replay, err := NewSyncManager(cfg, stateDir, Offline())
+	if err != nil {
+		return nil, err
+	}
+	defer replay.Close()
+
+	for name, before := range record.Before {
+		if err := replay.saveState(name, before.State); err != nil {
+			return nil, err
+		}
+		if before.Snapshot != "" {
+			if err := replay.saveSnapshot(name, before.Snapshot); err != nil {
+				return nil, err
+			}
+		}
+	}
+	replay.replaying = record.Bundle
+	replay.SetClock(func() time.Time { return record.Started })
+
+	names := make([]string, len(record.Results))
+	for i, result := range record.Results {
+		names[i] = result.Item
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chdir(workspace); err != nil {
+		return nil, err
+	}
+	defer os.Chdir(wd)
+
+	reports, err := replay.SyncItems(names)
+	if err != nil {
+		return nil, err
+	}
+	replayed := make(map[string]RunResult, len(reports))
+	for _, report := range reports {
+		item := report.SyncItem
+		state, err := replay.loadState(item.Name)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		files, err := hashedFiles(item, state)
+		if err != nil {
+			return nil, fmt.Errorf("item %s: %w", item.Name, err)
+		}
+		replayed[item.Name] = RunResult{
+			Item:   item.Name,
+			Commit: state.LastCommitID,
+			Files:  files,
+			Error:  strings.Join(report.Errors, "; "),
+		}
+	}
+	return replayed, nil
+}
+
+// compareFiles describes how replayed target files differ from recorded ones
+func compareFiles(recorded, replayed []ExportedFile) []string {
+	hashes := make(map[string]string, len(replayed))
+	for _, file := range replayed {
+		hashes[file.Path] = file.SHA256
+	}
+
+	var differences []string
+	for _, file := range recorded {
+		hash, ok := hashes[file.Path]
+		switch {
+		case !ok:
+			differences = append(differences, file.Path+" wasn't produced")
+		case hash != file.SHA256:
+			differences = append(differences, file.Path+" has other content")
+		}
+		delete(hashes, file.Path)
+	}
+	for _, file := range replayed {
+		if _, ok := hashes[file.Path]; ok {
+			differences = append(differences, file.Path+" was produced, but not by the run")
+		}
+	}
+	return differences
+}
+
+// orNone names an empty commit
+func orNone(commit string) string {
+	if commit == "" {
+		return "none"
+	}
+	return commit
+}
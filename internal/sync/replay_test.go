@@ -0,0 +1,77 @@
+package sync
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+	"github.com/exitflynn/codesync/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestReplay(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	item := config.SyncItem{
+		Name:   "lib",
+		Source: config.SyncSource{Owner: "acme", Repo: "lib", Path: "lib.go", Branch: "main"},
+		Target: config.SyncTarget{Path: "vendor/lib.go", Type: "file"},
+	}
+	cfg := &config.Config{Version: "1.0", AuditRuns: true, Items: []config.SyncItem{item}}
+
+	// Replaying must not reach the provider again
+	mock := mocks.NewMockGitHubClient(gomock.NewController(t))
+	mock.EXPECT().GetCommitsSince("acme", "lib", "lib.go", "main", time.Time{}, "").
+		Return([]github.CommitInfo{{SHA: "c1"}}, nil).Times(1)
+	mock.EXPECT().GetFile("acme", "lib", "lib.go", "c1").
+		Return(&github.FileInfo{Content: "package lib // new\n"}, nil).Times(1)
+
+	sm, err := NewSyncManager(cfg, t.TempDir(), WithProvider(config.ProviderGitHub, mock))
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	sm.SetClock(func() time.Time { return time.Date(2025, 3, 14, 10, 0, 0, 0, time.UTC) })
+	writeTestFile(t, "vendor/lib.go", "package lib // old\n")
+	_, hash, err := sm.checkLocalChanges(item, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.saveState("lib", State{CurrentLocalHash: hash}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sm.SyncAll(); err != nil {
+		t.Fatalf("SyncAll failed: %v", err)
+	}
+	runs, err := sm.Runs()
+	if err != nil || len(runs) != 1 || runs[0] != "20250314T100000Z" {
+		t.Fatalf("Expected the run to be recorded, got %v, %v", runs, err)
+	}
+
+	results, err := sm.Replay(runs[0])
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if len(results) != 1 || !results[0].Reproduced || results[0].Commit != "c1" || len(results[0].Changed) != 0 {
+		t.Fatalf("Expected the run to be reproduced, got %+v", results)
+	}
+	if content, _ := os.ReadFile("vendor/lib.go"); string(content) != "package lib // new\n" {
+		t.Errorf("Expected the workspace to be left alone, got %q", content)
+	}
+
+	// Targets edited since the run no longer match what it produced
+	writeTestFile(t, "vendor/lib.go", "package lib // edited\n")
+	results, err = sm.Replay(runs[0])
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if !results[0].Reproduced || len(results[0].Changed) != 1 || results[0].Changed[0] != "vendor/lib.go" {
+		t.Errorf("Expected the edited target to be reported, got %+v", results)
+	}
+
+	if _, err := sm.Replay("20200101T000000Z"); err == nil {
+		t.Error("Expected replaying a run that wasn't recorded to fail")
+	}
+}
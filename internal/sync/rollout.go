@@ -0,0 +1,384 @@
+package sync
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/diff"
+	"github.com/exitflynn/codesync/internal/region"
+)
+
+// Rollout tracks an upstream version through the rings of an item
+type Rollout struct {
+	Commit   string            `json:"commit"`
+	Rings    []RingStatus      `json:"rings"`
+	Previous map[string]string `json:"previous,omitempty"` // Regions before the rollout wrote them, by file, kept to revert
+	Reverted bool              `json:"reverted,omitempty"`
+}
+
+// RingStatus is the progress of a rollout in one ring
+type RingStatus struct {
+	Name      string    `json:"name"`
+	Applied   time.Time `json:"applied,omitempty"`   // When the ring got the version
+	Approved  time.Time `json:"approved,omitempty"`  // When the ring was approved to get it
+	Unhealthy string    `json:"unhealthy,omitempty"` // Why the ring's check failed, which halts the rollout
+}
+
+// RingProgress describes a ring of a rollout for display
+type RingProgress struct {
+	Name      string
+	Files     []string
+	Applied   time.Time // When the ring got the version being rolled out, if it did
+	Approved  time.Time
+	Opens     time.Time // When the previous ring's soak ends, if the ring waits for it
+	Waiting   string    // What the ring waits for: "approval", "soak" or "ring <name>"
+	Unhealthy string    // Why the ring's check failed, if it did
+}
+
+// rollOut writes the upstream region of a region item with rings into the
+// files of each ring that is open for commitID, in order, recording the
+// progress in the state. It reports whether every ring has the version.
+// After each ring gets it, the target's ring check runs; if it fails, the
+// ring is marked unhealthy, the rollout halts with ErrRingUnhealthy and,
+// with revertOnFailure, the files it updated are restored.
+func (sm *SyncManager) rollOut(item config.SyncItem, remoteContent, commitID string, state *State, report *SyncReport) (bool, error) {
+	body, err := regionBody(item, remoteContent, report)
+	if err != nil {
+		return false, err
+	}
+	targets, err := regionTargets(item)
+	if err != nil {
+		return false, err
+	}
+
+	rollout := resumeRollout(item, state.Rollout, commitID)
+	state.Rollout = rollout
+	for _, status := range rollout.Rings {
+		if status.Unhealthy != "" {
+			report.Rollout = haltedStatus(rollout, status.Name)
+			return false, fmt.Errorf("%w: ring %s: %s", ErrRingUnhealthy, status.Name, status.Unhealthy)
+		}
+	}
+
+	files := ringFiles(item, targets)
+	now := sm.Now()
+	for i, ring := range item.Target.Rings {
+		status := &rollout.Rings[i]
+		if !status.Applied.IsZero() {
+			continue
+		}
+		if i > 0 {
+			if waiting, opens := ringGate(ring, rollout.Rings[i-1], *status, now); waiting != "" {
+				report.Rollout = fmt.Sprintf("rolled out %s to %s; ring %s %s", shortSHA(commitID), ringNames(item.Target.Rings[:i]), ring.Name, waitingFor(waiting, opens))
+				return false, nil
+			}
+		}
+		for _, path := range files[i] {
+			if item.Target.RevertOnFailure {
+				if err := keepPrevious(sm.files, item, rollout, path); err != nil {
+					return false, err
+				}
+			}
+			if err := writeRegion(sm.files, item, path, body, report); err != nil {
+				return false, err
+			}
+		}
+		status.Applied = now
+
+		if item.Target.RingCheck == "" {
+			continue
+		}
+		// The check would see the files on disk, which a dry run doesn't change
+		if sm.files.dryRun() {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("the check of ring %s doesn't run in a dry run", ring.Name))
+			continue
+		}
+		if err := runRingCheck(item, ring, commitID, files[i]); err != nil {
+			status.Unhealthy = err.Error()
+			if item.Target.RevertOnFailure {
+				if err := revertRollout(sm.files, item, rollout, report); err != nil {
+					return false, err
+				}
+			}
+			report.Rollout = haltedStatus(rollout, ring.Name)
+			return false, fmt.Errorf("%w: ring %s: %v", ErrRingUnhealthy, ring.Name, err)
+		}
+	}
+	return true, nil
+}
+
+// keepPrevious records the region of a file before the rollout first writes
+// it, so that it can be reverted
+func keepPrevious(files *workspaceFiles, item config.SyncItem, rollout *Rollout, path string) error {
+	if _, ok := rollout.Previous[path]; ok {
+		return nil
+	}
+	content, err := files.readFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	body, err := region.Extract(string(content), item.Target.Marker)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if rollout.Previous == nil {
+		rollout.Previous = make(map[string]string)
+	}
+	rollout.Previous[path] = body
+	return nil
+}
+
+// runRingCheck runs the ring check of an item for a ring that just got
+// commitID, with the ring's name and files in the environment
+func runRingCheck(item config.SyncItem, ring config.RingConfig, commitID string, files []string) error {
+	cmd := exec.Command("sh", "-c", item.Target.RingCheck)
+	cmd.Env = append(os.Environ(),
+		"CODESYNC_ITEM="+item.Name,
+		"CODESYNC_RING="+ring.Name,
+		"CODESYNC_RING_FILES="+strings.Join(files, "\n"),
+		"CODESYNC_COMMIT="+commitID,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if out = bytes.TrimSpace(out); len(out) > 0 {
+			return fmt.Errorf("ring check failed: %w: %s", err, out)
+		}
+		return fmt.Errorf("ring check failed: %w", err)
+	}
+	return nil
+}
+
+// revertRollout restores the regions the rollout wrote and resets the rings,
+// so that a retry starts over. Files written by this sync drop out of the
+// report, since they end up as they were; the others are reported as updated.
+func revertRollout(files *workspaceFiles, item config.SyncItem, rollout *Rollout, report *SyncReport) error {
+	paths := make([]string, 0, len(rollout.Previous))
+	for path := range rollout.Previous {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	reverted := &SyncReport{Diffs: make(map[string]*diff.DiffResult)}
+	for _, path := range paths {
+		if err := writeRegion(files, item, path, rollout.Previous[path], reverted); err != nil {
+			return fmt.Errorf("failed to revert: %w", err)
+		}
+	}
+	for _, path := range reverted.UpdatedFiles {
+		if _, ok := report.Diffs[path]; ok {
+			delete(report.Diffs, path)
+			report.UpdatedFiles = slices.DeleteFunc(report.UpdatedFiles, func(p string) bool { return p == path })
+			continue
+		}
+		report.UpdatedFiles = append(report.UpdatedFiles, path)
+		report.Diffs[path] = reverted.Diffs[path]
+	}
+
+	for i := range rollout.Rings {
+		rollout.Rings[i].Applied = time.Time{}
+	}
+	rollout.Reverted = true
+	return nil
+}
+
+// haltedStatus describes a rollout halted by an unhealthy ring
+func haltedStatus(rollout *Rollout, ring string) string {
+	status := fmt.Sprintf("rollout of %s halted: ring %s is unhealthy", shortSHA(rollout.Commit), ring)
+	if rollout.Reverted {
+		status += "; the files it updated were reverted"
+	}
+	return status
+}
+
+// resumeRollout returns the rollout of commitID in progress, or starts one.
+// Rings keep their progress by name if the config changed since.
+func resumeRollout(item config.SyncItem, previous *Rollout, commitID string) *Rollout {
+	rollout := &Rollout{Commit: commitID}
+	if previous != nil && previous.Commit == commitID {
+		rollout.Previous = previous.Previous
+		rollout.Reverted = previous.Reverted
+	}
+	for _, ring := range item.Target.Rings {
+		status := RingStatus{Name: ring.Name}
+		if previous != nil && previous.Commit == commitID {
+			for _, s := range previous.Rings {
+				if s.Name == ring.Name {
+					status = s
+				}
+			}
+		}
+		rollout.Rings = append(rollout.Rings, status)
+	}
+	return rollout
+}
+
+// ringGate returns what a ring still waits for before it gets a version, and
+// when its soak ends if it waits for that. An approval opens it at once.
+func ringGate(ring config.RingConfig, previous, status RingStatus, now time.Time) (string, time.Time) {
+	switch {
+	case previous.Applied.IsZero():
+		return "ring " + previous.Name, time.Time{}
+	case !status.Approved.IsZero():
+		return "", time.Time{}
+	case ring.Approval:
+		return "approval", time.Time{}
+	}
+	// Checked when the config is validated
+	soak, _ := time.ParseDuration(ring.Soak)
+	if opens := previous.Applied.Add(soak); now.Before(opens) {
+		return "soak", opens
+	}
+	return "", time.Time{}
+}
+
+// waitingFor describes what a ring waits for
+func waitingFor(waiting string, opens time.Time) string {
+	switch waiting {
+	case "approval":
+		return "awaits approval"
+	case "soak":
+		return "follows after the soak, at " + opens.Format(time.RFC3339)
+	}
+	return "waits for " + waiting
+}
+
+// ringFiles assigns the fan-out files of an item to its rings: each file
+// goes to the first ring with a matching path, or to the last ring
+func ringFiles(item config.SyncItem, targets []string) [][]string {
+	rings := item.Target.Rings
+	files := make([][]string, len(rings))
+	for _, path := range targets {
+		i := len(rings) - 1
+		for j, ring := range rings {
+			if ringMatches(ring, path) {
+				i = j
+				break
+			}
+		}
+		files[i] = append(files[i], path)
+	}
+	return files
+}
+
+// ringMatches reports whether one of a ring's paths matches a file
+func ringMatches(ring config.RingConfig, path string) bool {
+	for _, pattern := range ring.Paths {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ringNames lists the names of rings
+func ringNames(rings []config.RingConfig) string {
+	names := make([]string, len(rings))
+	for i, ring := range rings {
+		names[i] = ring.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// ApproveRing lets a ring of the rollout in progress get its version on the
+// next sync, without waiting for the previous ring's soak
+func (sm *SyncManager) ApproveRing(itemName, ringName string) error {
+	item, ok := sm.Item(itemName)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownItem, itemName)
+	}
+	state, err := sm.loadState(itemName)
+	if err != nil || state.Rollout == nil {
+		return fmt.Errorf("%s has no rollout in progress", itemName)
+	}
+
+	rollout := resumeRollout(item, state.Rollout, state.Rollout.Commit)
+	for i := range rollout.Rings {
+		status := &rollout.Rings[i]
+		if status.Name != ringName {
+			continue
+		}
+		if !status.Applied.IsZero() {
+			return fmt.Errorf("ring %s already has %s", ringName, shortSHA(rollout.Commit))
+		}
+		status.Approved = sm.Now()
+		state.Rollout = rollout
+		return sm.saveState(itemName, state)
+	}
+	return fmt.Errorf("%s has no ring %s", itemName, ringName)
+}
+
+// RolloutProgress returns the upstream commit an item with rings last rolled
+// out, or is rolling out, and where each ring stands
+func (sm *SyncManager) RolloutProgress(itemName string) (string, []RingProgress, error) {
+	item, ok := sm.Item(itemName)
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s", ErrUnknownItem, itemName)
+	}
+	if len(item.Target.Rings) == 0 {
+		return "", nil, fmt.Errorf("%s has no rings", itemName)
+	}
+	state, _ := sm.loadState(itemName)
+	commit := ""
+	if state.Rollout != nil {
+		commit = state.Rollout.Commit
+	}
+	rollout := resumeRollout(item, state.Rollout, commit)
+
+	// Files may have been added since, so they're listed as they are now
+	targets, _ := regionTargets(item)
+	files := ringFiles(item, targets)
+	now := sm.Now()
+	var progress []RingProgress
+	for i, ring := range item.Target.Rings {
+		p := RingProgress{
+			Name:      ring.Name,
+			Files:     files[i],
+			Applied:   rollout.Rings[i].Applied,
+			Approved:  rollout.Rings[i].Approved,
+			Unhealthy: rollout.Rings[i].Unhealthy,
+		}
+		if i > 0 && p.Applied.IsZero() && commit != "" {
+			p.Waiting, p.Opens = ringGate(ring, rollout.Rings[i-1], rollout.Rings[i], now)
+		}
+		progress = append(progress, p)
+	}
+	return commit, progress, nil
+}
+
+// RetryRollout clears the unhealthy rings of an item's rollout, so that the
+// next sync gives them the version again and reruns their check. A reverted
+// rollout starts over from the first ring.
+func (sm *SyncManager) RetryRollout(itemName string) error {
+	item, ok := sm.Item(itemName)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownItem, itemName)
+	}
+	state, err := sm.loadState(itemName)
+	if err != nil || state.Rollout == nil {
+		return fmt.Errorf("%s has no rollout in progress", itemName)
+	}
+
+	rollout := resumeRollout(item, state.Rollout, state.Rollout.Commit)
+	retried := false
+	for i := range rollout.Rings {
+		status := &rollout.Rings[i]
+		if status.Unhealthy != "" {
+			status.Unhealthy = ""
+			status.Applied = time.Time{}
+			retried = true
+		}
+	}
+	if !retried {
+		return fmt.Errorf("the rollout of %s isn't halted", itemName)
+	}
+	rollout.Reverted = false
+	state.Rollout = rollout
+	return sm.saveState(itemName, state)
+}
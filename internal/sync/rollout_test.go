@@ -0,0 +1,202 @@
+package sync
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+	"github.com/exitflynn/codesync/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestRollout(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	for _, service := range []string{"canary", "api", "web", "worker"} {
+		writeTestFile(t, "services/"+service+"/Dockerfile", "# codesync-begin preamble\nFROM alpine:3.18@sha256:old\n# codesync-end preamble\n")
+	}
+
+	item := config.SyncItem{
+		Name:   "preamble",
+		Source: config.SyncSource{Owner: "acme", Repo: "security", Path: "preamble.Dockerfile", Branch: "main"},
+		Target: config.SyncTarget{
+			Path:   "services/*/Dockerfile",
+			Type:   "region",
+			Marker: "preamble",
+			Rings: []config.RingConfig{
+				{Name: "canary", Paths: []string{"services/canary/*"}},
+				{Name: "early", Paths: []string{"services/api/*"}, Soak: "24h"},
+				{Name: "rest", Approval: true},
+			},
+		},
+	}
+	mock := mocks.NewMockGitHubClient(gomock.NewController(t))
+	mock.EXPECT().GetCommitsSince("acme", "security", "preamble.Dockerfile", "main", time.Time{}, "").
+		Return([]github.CommitInfo{{SHA: "c1"}}, nil).AnyTimes()
+	mock.EXPECT().GetFile("acme", "security", "preamble.Dockerfile", "c1").
+		Return(&github.FileInfo{Content: "FROM alpine:3.19@sha256:new\n"}, nil).AnyTimes()
+
+	sm, err := NewSyncManager(&config.Config{Version: "1.0", Items: []config.SyncItem{item}}, t.TempDir(), WithProvider(config.ProviderGitHub, mock))
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	// The regions are as upstream had them before
+	_, hash, err := sm.checkLocalChanges(item, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.saveState("preamble", State{CurrentLocalHash: hash}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 3, 14, 10, 0, 0, 0, time.UTC)
+	sm.SetClock(func() time.Time { return now })
+
+	updated := func(service string) bool {
+		content, _ := os.ReadFile("services/" + service + "/Dockerfile")
+		return strings.Contains(string(content), "sha256:new")
+	}
+	sync := func() *SyncReport {
+		t.Helper()
+		report, err := sm.SyncItem(item)
+		if err != nil || len(report.Errors) > 0 {
+			t.Fatalf("SyncItem failed: %v %v", err, report.Errors)
+		}
+		return report
+	}
+
+	// The canary gets it first, the next ring soaks
+	report := sync()
+	if !updated("canary") || updated("api") || len(report.UpdatedFiles) != 1 {
+		t.Fatalf("Expected only the canary to be updated, got %v", report.UpdatedFiles)
+	}
+	if !strings.Contains(report.Rollout, "ring early follows after the soak") {
+		t.Errorf("Unexpected rollout status %q", report.Rollout)
+	}
+	if state, _ := sm.loadState("preamble"); state.LastCommitID != "" || !state.HasRemoteChanges {
+		t.Errorf("Expected the version not to be synced yet, got %+v", state)
+	}
+
+	// Before the soak ends, nothing moves, and the canary isn't a local change
+	now = now.Add(time.Hour)
+	if report := sync(); len(report.UpdatedFiles) != 0 || updated("api") {
+		t.Errorf("Expected nothing to be updated during the soak, got %v", report.UpdatedFiles)
+	}
+
+	// After it, the early ring gets it and the rest waits for approval
+	now = now.Add(24 * time.Hour)
+	report = sync()
+	if !updated("api") || updated("web") || !strings.Contains(report.Rollout, "ring rest awaits approval") {
+		t.Errorf("Expected the early ring to be updated, got %v, %q", report.UpdatedFiles, report.Rollout)
+	}
+
+	commit, rings, err := sm.RolloutProgress("preamble")
+	if err != nil || commit != "c1" || len(rings) != 3 {
+		t.Fatalf("RolloutProgress failed: %v", err)
+	}
+	if rings[1].Applied.IsZero() || rings[2].Waiting != "approval" || len(rings[2].Files) != 2 {
+		t.Errorf("Unexpected progress %+v", rings)
+	}
+
+	if err := sm.ApproveRing("preamble", "canary"); err == nil {
+		t.Error("Expected approving a ring that has the version to fail")
+	}
+	if err := sm.ApproveRing("preamble", "rest"); err != nil {
+		t.Fatalf("ApproveRing failed: %v", err)
+	}
+	report = sync()
+	if !updated("web") || !updated("worker") || report.Rollout != "" {
+		t.Errorf("Expected the rest to be updated, got %v, %q", report.UpdatedFiles, report.Rollout)
+	}
+	if state, _ := sm.loadState("preamble"); state.LastCommitID != "c1" || state.HasRemoteChanges {
+		t.Errorf("Expected the version to be synced, got %+v", state)
+	}
+}
+
+func TestRolloutHaltsOnFailedCheck(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	for _, service := range []string{"canary", "api"} {
+		writeTestFile(t, "services/"+service+"/Dockerfile", "# codesync-begin preamble\nFROM alpine:3.18@sha256:old\n# codesync-end preamble\n")
+	}
+
+	// The check fails while the broken file exists
+	item := config.SyncItem{
+		Name:   "preamble",
+		Source: config.SyncSource{Owner: "acme", Repo: "security", Path: "preamble.Dockerfile", Branch: "main"},
+		Target: config.SyncTarget{
+			Path:   "services/*/Dockerfile",
+			Type:   "region",
+			Marker: "preamble",
+			Rings: []config.RingConfig{
+				{Name: "canary", Paths: []string{"services/canary/*"}},
+				{Name: "rest"},
+			},
+			RingCheck:       `test ! -e broken || { echo "$CODESYNC_RING: $CODESYNC_RING_FILES"; exit 1; }`,
+			RevertOnFailure: true,
+		},
+	}
+	mock := mocks.NewMockGitHubClient(gomock.NewController(t))
+	mock.EXPECT().GetCommitsSince("acme", "security", "preamble.Dockerfile", "main", time.Time{}, "").
+		Return([]github.CommitInfo{{SHA: "c1"}}, nil).AnyTimes()
+	mock.EXPECT().GetFile("acme", "security", "preamble.Dockerfile", "c1").
+		Return(&github.FileInfo{Content: "FROM alpine:3.19@sha256:new\n"}, nil).AnyTimes()
+
+	sm, err := NewSyncManager(&config.Config{Version: "1.0", Items: []config.SyncItem{item}}, t.TempDir(), WithProvider(config.ProviderGitHub, mock))
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	_, hash, err := sm.checkLocalChanges(item, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.saveState("preamble", State{CurrentLocalHash: hash}); err != nil {
+		t.Fatal(err)
+	}
+
+	updated := func(service string) bool {
+		content, _ := os.ReadFile("services/" + service + "/Dockerfile")
+		return strings.Contains(string(content), "sha256:new")
+	}
+
+	// The canary fails its check and is reverted
+	writeTestFile(t, "broken", "")
+	report, err := sm.SyncItem(item)
+	if !errors.Is(err, ErrRingUnhealthy) || !strings.Contains(err.Error(), "canary: services/canary/Dockerfile") {
+		t.Fatalf("Expected the canary to be unhealthy, got %v", err)
+	}
+	if updated("canary") || updated("api") || len(report.UpdatedFiles) != 0 {
+		t.Errorf("Expected the canary to be reverted, got %v", report.UpdatedFiles)
+	}
+	if !strings.Contains(report.Rollout, "ring canary is unhealthy; the files it updated were reverted") {
+		t.Errorf("Unexpected rollout status %q", report.Rollout)
+	}
+
+	// The rollout stays halted even once the check would pass
+	os.Remove("broken")
+	if _, err := sm.SyncItem(item); !errors.Is(err, ErrRingUnhealthy) || updated("canary") {
+		t.Errorf("Expected the rollout to stay halted, got %v", err)
+	}
+	_, rings, _ := sm.RolloutProgress("preamble")
+	if rings[0].Unhealthy == "" {
+		t.Errorf("Expected the canary to show as unhealthy, got %+v", rings)
+	}
+
+	// A retry starts it over
+	if err := sm.RetryRollout("preamble"); err != nil {
+		t.Fatalf("RetryRollout failed: %v", err)
+	}
+	if err := sm.RetryRollout("preamble"); err == nil {
+		t.Error("Expected retrying a rollout that isn't halted to fail")
+	}
+	report, err = sm.SyncItem(item)
+	if err != nil || len(report.Errors) > 0 {
+		t.Fatalf("SyncItem failed: %v %v", err, report.Errors)
+	}
+	if !updated("canary") || !updated("api") || report.Rollout != "" {
+		t.Errorf("Expected every ring to be updated, got %v, %q", report.UpdatedFiles, report.Rollout)
+	}
+}
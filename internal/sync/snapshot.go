@@ -0,0 +1,137 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/exitflynn/codesync/internal/diff"
+)
+
+// maxSnapshotDeltas is how many versions are chained onto a snapshot base
+// before it is re-baselined
+const maxSnapshotDeltas = 32
+
+// snapshotChain stores every version of an item's upstream content applied
+// since the last re-baselining: the oldest in full and each later one as a
+// delta from the version before it
+type snapshotChain struct {
+	Base   string   `json:"base"`
+	Deltas []string `json:"deltas,omitempty"`
+}
+
+// snapshotName returns the store name of the snapshot chain for an item
+func snapshotName(itemName string) string {
+	return filepath.Join("snapshots", sanitizeFilename(itemName)+".chain")
+}
+
+// legacySnapshotName is where snapshots were stored in full before chains
+func legacySnapshotName(itemName string) string {
+	return filepath.Join("snapshots", sanitizeFilename(itemName)+".snap")
+}
+
+// saveSnapshot records the upstream content applied for a sync item as the
+// newest version of its snapshot chain. The chain starts over from the new
+// content once it is long, or its deltas outweigh the base.
+func (sm *SyncManager) saveSnapshot(itemName, content string) error {
+	// A missing or unreadable chain starts over
+	chain, err := sm.loadChain(itemName)
+	var versions []string
+	if err == nil {
+		versions, err = chain.versions()
+	}
+
+	switch {
+	case err != nil:
+		chain = &snapshotChain{Base: content}
+	case versions[len(versions)-1] == content:
+		return nil
+	default:
+		chain.Deltas = append(chain.Deltas, diff.Delta(versions[len(versions)-1], content))
+		if len(chain.Deltas) > maxSnapshotDeltas || deltaSize(chain.Deltas) > len(chain.Base) {
+			chain = &snapshotChain{Base: content}
+		}
+	}
+
+	data, err := json.Marshal(chain)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if err := sm.store.write(snapshotName(itemName), data); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	// The chain supersedes a full snapshot from an older version
+	if err := sm.store.remove(legacySnapshotName(itemName)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to remove old snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// loadSnapshot returns the upstream content last applied for a sync item
+func (sm *SyncManager) loadSnapshot(itemName string) (string, error) {
+	versions, err := sm.snapshotVersions(itemName)
+	if err != nil {
+		return "", err
+	}
+	return versions[len(versions)-1], nil
+}
+
+// snapshotVersions reconstructs the versions of an item's snapshot chain,
+// oldest first. A full snapshot from an older version is a single version.
+func (sm *SyncManager) snapshotVersions(itemName string) ([]string, error) {
+	chain, err := sm.loadChain(itemName)
+	if errors.Is(err, fs.ErrNotExist) {
+		data, legacyErr := sm.store.read(legacySnapshotName(itemName))
+		if legacyErr != nil {
+			return nil, err
+		}
+		return []string{string(data)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := chain.versions()
+	if err != nil {
+		return nil, fmt.Errorf("snapshot of %s is corrupt: %w", itemName, err)
+	}
+	return versions, nil
+}
+
+// versions applies the chain's deltas in turn, returning every version
+func (c *snapshotChain) versions() ([]string, error) {
+	versions := []string{c.Base}
+	for i, delta := range c.Deltas {
+		version, err := diff.Undelta(versions[i], delta)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+func (sm *SyncManager) loadChain(itemName string) (*snapshotChain, error) {
+	data, err := sm.store.read(snapshotName(itemName))
+	if err != nil {
+		return nil, err
+	}
+
+	var chain snapshotChain
+	if err := json.Unmarshal(data, &chain); err != nil {
+		return nil, fmt.Errorf("invalid snapshot of %s: %w", itemName, err)
+	}
+	return &chain, nil
+}
+
+func deltaSize(deltas []string) int {
+	size := 0
+	for _, delta := range deltas {
+		size += len(delta)
+	}
+	return size
+}
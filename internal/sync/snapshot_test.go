@@ -0,0 +1,93 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotChain(t *testing.T) {
+	sm := newTestManager(t)
+
+	base := strings.Repeat("unchanged line\n", 100)
+	var want []string
+	for i := 0; i < 5; i++ {
+		content := base + fmt.Sprintf("version %d\n", i)
+		want = append(want, content)
+		if err := sm.saveSnapshot("item", content); err != nil {
+			t.Fatalf("saveSnapshot failed: %v", err)
+		}
+	}
+	// Saving the same content again doesn't add a version
+	if err := sm.saveSnapshot("item", want[4]); err != nil {
+		t.Fatalf("saveSnapshot failed: %v", err)
+	}
+
+	versions, err := sm.snapshotVersions("item")
+	if err != nil {
+		t.Fatalf("snapshotVersions failed: %v", err)
+	}
+	if len(versions) != len(want) {
+		t.Fatalf("Expected %d versions, got %d", len(want), len(versions))
+	}
+	for i := range want {
+		if versions[i] != want[i] {
+			t.Errorf("Version %d doesn't round-trip", i)
+		}
+	}
+
+	chain, err := sm.loadChain("item")
+	if err != nil {
+		t.Fatalf("loadChain failed: %v", err)
+	}
+	if chain.Base != want[0] || len(chain.Deltas) != 4 || deltaSize(chain.Deltas) > len(base) {
+		t.Errorf("Expected later versions to be stored as small deltas, got %d deltas of %d bytes", len(chain.Deltas), deltaSize(chain.Deltas))
+	}
+
+	latest, err := sm.loadSnapshot("item")
+	if err != nil || latest != want[4] {
+		t.Errorf("Expected the latest version, got %q, %v", latest, err)
+	}
+}
+
+func TestSnapshotChainRebaselines(t *testing.T) {
+	sm := newTestManager(t)
+
+	for i := 0; i <= maxSnapshotDeltas+1; i++ {
+		if err := sm.saveSnapshot("item", strings.Repeat("line\n", 200)+fmt.Sprint(i)); err != nil {
+			t.Fatalf("saveSnapshot failed: %v", err)
+		}
+	}
+
+	chain, err := sm.loadChain("item")
+	if err != nil {
+		t.Fatalf("loadChain failed: %v", err)
+	}
+	if len(chain.Deltas) > maxSnapshotDeltas {
+		t.Errorf("Expected the chain to be re-baselined, got %d deltas", len(chain.Deltas))
+	}
+	if latest, _ := sm.loadSnapshot("item"); !strings.HasSuffix(latest, fmt.Sprint(maxSnapshotDeltas+1)) {
+		t.Errorf("Expected the latest version after re-baselining, got %q", latest[len(latest)-5:])
+	}
+}
+
+func TestLegacySnapshot(t *testing.T) {
+	sm := newTestManager(t)
+
+	if err := sm.store.write(legacySnapshotName("item"), []byte("full copy")); err != nil {
+		t.Fatal(err)
+	}
+	if latest, err := sm.loadSnapshot("item"); err != nil || latest != "full copy" {
+		t.Errorf("Expected the full snapshot to be read, got %q, %v", latest, err)
+	}
+
+	if err := sm.saveSnapshot("item", "new copy"); err != nil {
+		t.Fatalf("saveSnapshot failed: %v", err)
+	}
+	if _, err := sm.store.read(legacySnapshotName("item")); err == nil {
+		t.Error("Expected the full snapshot to be replaced by a chain")
+	}
+	if latest, _ := sm.loadSnapshot("item"); latest != "new copy" {
+		t.Errorf("Unexpected snapshot: %q", latest)
+	}
+}
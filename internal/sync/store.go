@@ -0,0 +1,373 @@
+package sync
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/secrets"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressedMagic prefixes files written with compression enabled so they can
+// be told apart from plain files written by older versions
+var compressedMagic = []byte("CSZ1")
+
+// encryptedMagic prefixes files encrypted with AES-GCM. The file's name is
+// authenticated along with it, so an encrypted file can't be swapped for
+// another one in the store.
+var encryptedMagic = []byte("CSE2")
+
+// legacyEncryptedMagic prefixes encrypted files written by older versions,
+// which authenticated only the magic
+var legacyEncryptedMagic = []byte("CSE1")
+
+// fileStore reads and writes files in the state directory. When compression is
+// enabled, files are stored as zstd frames along with a SHA-256 checksum of the
+// uncompressed data which is verified on read. When a key is set, files are
+// additionally encrypted with AES-GCM. Reads handle compressed and plain files
+// regardless of the current settings; encrypted files require the key.
+type fileStore struct {
+	dir      string
+	compress bool
+	key      []byte
+
+	// In a dry run, files written or removed are kept here instead, nil if
+	// removed
+	mu      sync.Mutex
+	pending map[string][]byte
+}
+
+// newFileStore creates a store for the state directory with the config's
+// compression and encryption settings
+func newFileStore(cfg *config.Config, stateDir string) (*fileStore, error) {
+	store := &fileStore{dir: stateDir, compress: cfg.CompressState}
+	if cfg.StateEncryption != nil {
+		key, err := loadStateKey(cfg.StateEncryption)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load state key: %w", err)
+		}
+		store.key = key
+	}
+	return store, nil
+}
+
+// path returns the location of a named file in the store
+func (s *fileStore) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// dryRun keeps the store's changes in memory from now on
+func (s *fileStore) dryRun() {
+	s.pending = make(map[string][]byte)
+}
+
+// write stores data under the given name
+func (s *fileStore) write(name string, data []byte) error {
+	if s.pending != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.pending[name] = append([]byte{}, data...)
+		return nil
+	}
+	path := s.path(name)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	if s.compress {
+		data = compressData(data)
+	}
+
+	if s.key != nil {
+		encrypted, err := encryptData(s.key, data, storeAAD(name))
+		if err != nil {
+			return err
+		}
+		data = encrypted
+	}
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	// Files written by older versions keep their mode otherwise
+	return os.Chmod(path, 0600)
+}
+
+// read loads the file stored under the given name
+func (s *fileStore) read(name string) ([]byte, error) {
+	if data, ok := s.pendingFile(name); ok {
+		if data == nil {
+			return nil, &fs.PathError{Op: "open", Path: s.path(name), Err: fs.ErrNotExist}
+		}
+		return append([]byte{}, data...), nil
+	}
+
+	data, err := os.ReadFile(s.path(name))
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(data, encryptedMagic) || bytes.HasPrefix(data, legacyEncryptedMagic) {
+		if s.key == nil {
+			return nil, fmt.Errorf("%s is encrypted but no state key is configured", name)
+		}
+
+		aad := storeAAD(name)
+		if bytes.HasPrefix(data, legacyEncryptedMagic) {
+			aad = legacyEncryptedMagic
+		}
+		data, err = decryptData(s.key, data, aad)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	if !bytes.HasPrefix(data, compressedMagic) {
+		return data, nil
+	}
+
+	decoded, err := decompressData(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return decoded, nil
+}
+
+// pendingFile returns what a dry run wrote under the given name, if it
+// wrote or removed it
+func (s *fileStore) pendingFile(name string) ([]byte, bool) {
+	if s.pending == nil {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.pending[name]
+	return data, ok
+}
+
+// remove deletes the file stored under the given name
+func (s *fileStore) remove(name string) error {
+	if s.pending != nil {
+		if _, err := s.read(name); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.pending[name] = nil
+		return nil
+	}
+	return os.Remove(s.path(name))
+}
+
+// rename moves a stored file to a new name. Encrypted files are bound to
+// their name, so they are re-encrypted under the new one.
+func (s *fileStore) rename(from, to string) error {
+	if s.pending != nil {
+		data, err := s.read(from)
+		if err != nil {
+			return err
+		}
+		if err := s.write(to, data); err != nil {
+			return err
+		}
+		return s.remove(from)
+	}
+
+	data, err := os.ReadFile(s.path(from))
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(data, encryptedMagic) && !bytes.HasPrefix(data, legacyEncryptedMagic) {
+		return os.Rename(s.path(from), s.path(to))
+	}
+
+	data, err = s.read(from)
+	if err != nil {
+		return err
+	}
+	if err := s.write(to, data); err != nil {
+		return err
+	}
+	return s.remove(from)
+}
+
+// storedFile is a single file in the store, for packages that persist their
+// own state
+type storedFile struct {
+	store *fileStore
+	name  string
+}
+
+func (f storedFile) Load() ([]byte, error) {
+	return f.store.read(f.name)
+}
+
+func (f storedFile) Save(data []byte) error {
+	return f.store.write(f.name, data)
+}
+
+// httpCacheDir holds the responses the GitHub clients cache for conditional
+// requests
+const httpCacheDir = "http"
+
+// storedCache is a directory of cache entries in the store
+type storedCache struct {
+	store *fileStore
+	dir   string
+}
+
+func (c storedCache) Load(key string) ([]byte, error) {
+	return c.store.read(filepath.Join(c.dir, key))
+}
+
+func (c storedCache) Save(key string, data []byte) error {
+	return c.store.write(filepath.Join(c.dir, key), data)
+}
+
+// storeAAD is the additional data an encrypted file is authenticated with:
+// the magic and the file's slash-separated name in the store
+func storeAAD(name string) []byte {
+	return append(append(append([]byte{}, encryptedMagic...), 0), filepath.ToSlash(name)...)
+}
+
+// compressData encodes data as magic + checksum + zstd frame
+func compressData(data []byte) []byte {
+	encoder, _ := zstd.NewWriter(nil)
+	defer encoder.Close()
+
+	sum := sha256.Sum256(data)
+
+	out := make([]byte, 0, len(compressedMagic)+len(sum)+len(data)/2)
+	out = append(out, compressedMagic...)
+	out = append(out, sum[:]...)
+	return encoder.EncodeAll(data, out)
+}
+
+// decompressData reverses compressData and verifies the checksum
+func decompressData(data []byte) ([]byte, error) {
+	headerLen := len(compressedMagic) + sha256.Size
+	if len(data) < headerLen {
+		return nil, fmt.Errorf("compressed file is truncated")
+	}
+
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create decoder: %w", err)
+	}
+	defer decoder.Close()
+
+	decoded, err := decoder.DecodeAll(data[headerLen:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+
+	sum := sha256.Sum256(decoded)
+	if !bytes.Equal(sum[:], data[len(compressedMagic):headerLen]) {
+		return nil, fmt.Errorf("checksum mismatch")
+	}
+
+	return decoded, nil
+}
+
+// encryptData encodes data as magic + nonce + AES-GCM ciphertext,
+// authenticating aad along with it
+func encryptData(key, data, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := make([]byte, 0, len(encryptedMagic)+len(nonce)+len(data)+gcm.Overhead())
+	out = append(out, encryptedMagic...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, data, aad), nil
+}
+
+// decryptData reverses encryptData, failing if the data was tampered with or
+// aad doesn't match
+func decryptData(key, data, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	headerLen := len(encryptedMagic) + gcm.NonceSize()
+	if len(data) < headerLen {
+		return nil, fmt.Errorf("encrypted file is truncated")
+	}
+
+	decrypted, err := gcm.Open(nil, data[len(encryptedMagic):headerLen], data[headerLen:], aad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %w", err)
+	}
+
+	return decrypted, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid state key: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// loadStateKey resolves the state encryption key from the environment, the
+// configured key command, or a secrets provider
+func loadStateKey(enc *config.StateEncryption) ([]byte, error) {
+	var encoded string
+
+	switch {
+	case enc.KeyEnv != "":
+		encoded = os.Getenv(enc.KeyEnv)
+		if encoded == "" {
+			return nil, fmt.Errorf("environment variable %s is not set", enc.KeyEnv)
+		}
+
+	case enc.KeyCommand != "":
+		out, err := exec.Command("sh", "-c", enc.KeyCommand).Output()
+		if err != nil {
+			return nil, fmt.Errorf("key command failed: %w", err)
+		}
+		encoded = string(out)
+
+	case enc.KeySecret != nil:
+		value, err := secrets.Resolve(enc.KeySecret)
+		if err != nil {
+			return nil, err
+		}
+		encoded = value
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("state key is not valid base64: %w", err)
+	}
+
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("state key must be 16, 24 or 32 bytes, got %d", len(key))
+	}
+}
@@ -0,0 +1,189 @@
+package sync
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+func TestFileStoreRoundTrip(t *testing.T) {
+	content := []byte(strings.Repeat("func main() {}\n", 100))
+
+	for _, compress := range []bool{false, true} {
+		store := &fileStore{dir: t.TempDir(), compress: compress}
+
+		if err := store.write("snapshots/item.snap", content); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+
+		got, err := store.read("snapshots/item.snap")
+		if err != nil {
+			t.Fatalf("read failed: %v", err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("compress=%v: content mismatch after round trip", compress)
+		}
+
+		raw, err := os.ReadFile(store.path("snapshots/item.snap"))
+		if err != nil {
+			t.Fatalf("Failed to read raw file: %v", err)
+		}
+		if compress && len(raw) >= len(content) {
+			t.Errorf("Expected compressed file to be smaller, got %d bytes for %d", len(raw), len(content))
+		}
+	}
+}
+
+func TestFileStoreReadsPlainWhenCompressing(t *testing.T) {
+	plain := &fileStore{dir: t.TempDir()}
+	if err := plain.write("item.json", []byte(`{"lastCommitID":"abc"}`)); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	compressed := &fileStore{dir: plain.dir, compress: true}
+	got, err := compressed.read("item.json")
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if string(got) != `{"lastCommitID":"abc"}` {
+		t.Errorf("Unexpected content: %s", got)
+	}
+}
+
+func TestFileStoreDetectsCorruption(t *testing.T) {
+	store := &fileStore{dir: t.TempDir(), compress: true}
+	if err := store.write("item.json", []byte("some state")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	raw, err := os.ReadFile(store.path("item.json"))
+	if err != nil {
+		t.Fatalf("Failed to read raw file: %v", err)
+	}
+
+	// Flip a bit in the stored checksum
+	raw[len(compressedMagic)] ^= 0xff
+	if err := os.WriteFile(store.path("item.json"), raw, 0644); err != nil {
+		t.Fatalf("Failed to write corrupted file: %v", err)
+	}
+
+	if _, err := store.read("item.json"); err == nil {
+		t.Error("Expected checksum error, got nil")
+	}
+
+	// Truncated file
+	if err := os.WriteFile(store.path("item.json"), raw[:10], 0644); err != nil {
+		t.Fatalf("Failed to write truncated file: %v", err)
+	}
+
+	if _, err := store.read("item.json"); err == nil {
+		t.Error("Expected truncation error, got nil")
+	}
+}
+
+func TestFileStoreEncryption(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	store := &fileStore{dir: t.TempDir(), compress: true, key: key}
+
+	if err := store.write("item.json", []byte("proprietary upstream code")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	raw, err := os.ReadFile(store.path("item.json"))
+	if err != nil {
+		t.Fatalf("Failed to read raw file: %v", err)
+	}
+	if !bytes.HasPrefix(raw, encryptedMagic) || bytes.Contains(raw, []byte("proprietary")) {
+		t.Error("Expected file to be stored encrypted")
+	}
+
+	got, err := store.read("item.json")
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if string(got) != "proprietary upstream code" {
+		t.Errorf("Unexpected content: %s", got)
+	}
+
+	// Reading without the key must fail
+	if _, err := (&fileStore{dir: store.dir}).read("item.json"); err == nil {
+		t.Error("Expected error reading encrypted file without key")
+	}
+
+	// Reading with the wrong key must fail
+	wrong := &fileStore{dir: store.dir, key: bytes.Repeat([]byte{8}, 32)}
+	if _, err := wrong.read("item.json"); err == nil {
+		t.Error("Expected error reading encrypted file with wrong key")
+	}
+}
+
+func TestFileStoreEncryptionBindsName(t *testing.T) {
+	store := &fileStore{dir: t.TempDir(), key: bytes.Repeat([]byte{7}, 32)}
+
+	if err := store.write("a.json", []byte("state of a")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if info, err := os.Stat(store.path("a.json")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected an encrypted file only its owner can read, got %v %v", info.Mode(), err)
+	}
+
+	// A file copied over another one's name no longer decrypts
+	raw, _ := os.ReadFile(store.path("a.json"))
+	if err := os.WriteFile(store.path("b.json"), raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.read("b.json"); err == nil {
+		t.Error("Expected a file stored under another name to fail")
+	}
+
+	// Renaming through the store re-encrypts under the new name
+	if err := store.rename("a.json", "c.json"); err != nil {
+		t.Fatalf("rename failed: %v", err)
+	}
+	if got, err := store.read("c.json"); err != nil || string(got) != "state of a" {
+		t.Errorf("Unexpected renamed file: %q, %v", got, err)
+	}
+
+	// Files from older versions are authenticated with the magic only
+	gcm, _ := newGCM(store.key)
+	nonce := make([]byte, gcm.NonceSize())
+	legacy := gcm.Seal(append(append([]byte{}, legacyEncryptedMagic...), nonce...), nonce, []byte("old state"), legacyEncryptedMagic)
+	if err := os.WriteFile(store.path("old.json"), legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.read("old.json"); err != nil || string(got) != "old state" {
+		t.Errorf("Expected a legacy file to be readable, got %q, %v", got, err)
+	}
+}
+
+func TestLoadStateKey(t *testing.T) {
+	t.Setenv("TEST_STATE_KEY", "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=")
+
+	key, err := loadStateKey(&config.StateEncryption{KeyEnv: "TEST_STATE_KEY"})
+	if err != nil {
+		t.Fatalf("loadStateKey failed: %v", err)
+	}
+	if len(key) != 32 {
+		t.Errorf("Expected 32 byte key, got %d", len(key))
+	}
+
+	key, err = loadStateKey(&config.StateEncryption{KeyCommand: "echo MDEyMzQ1Njc4OWFiY2RlZg=="})
+	if err != nil {
+		t.Fatalf("loadStateKey with command failed: %v", err)
+	}
+	if string(key) != "0123456789abcdef" {
+		t.Errorf("Unexpected key from command: %q", key)
+	}
+
+	if _, err := loadStateKey(&config.StateEncryption{KeyEnv: "TEST_STATE_KEY_MISSING"}); err == nil {
+		t.Error("Expected error for unset key variable")
+	}
+
+	t.Setenv("TEST_STATE_KEY", "c2hvcnQ=")
+	if _, err := loadStateKey(&config.StateEncryption{KeyEnv: "TEST_STATE_KEY"}); err == nil {
+		t.Error("Expected error for short key")
+	}
+}
@@ -0,0 +1,61 @@
+package sync
+
+import (
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/markdown"
+	"github.com/exitflynn/codesync/internal/structured"
+	"github.com/exitflynn/codesync/internal/workflow"
+)
+
+// applySelection copies the keys selected by a structured item from the
+// upstream document into the local one
+func applySelection(item config.SyncItem, local, remote string) (string, error) {
+	var out []byte
+	var err error
+	if len(item.Target.JSONPath) > 0 {
+		out, err = structured.SyncJSON([]byte(local), []byte(remote), item.Target.JSONPath)
+	} else {
+		out, err = structured.SyncYAML([]byte(local), []byte(remote), item.Target.YAMLPath)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// hashedContent returns the part of a local file whose changes count as local
+// changes: the selected keys for structured items, the cells of notebooks,
+// the synced section of markdown, workflows without their local overrides,
+// otherwise the whole file. Unparseable files are hashed whole.
+func hashedContent(item config.SyncItem, content string) string {
+	if isNotebook(item) {
+		return stripNotebook(content)
+	}
+	if item.Target.Type == "workflow" {
+		if rest, err := workflow.Without([]byte(content), keptPaths(item)); err == nil {
+			return rest
+		}
+		return content
+	}
+	if item.Target.Type == "markdown" {
+		if section, err := markdown.Section(content, localSectionName(item)); err == nil {
+			return section
+		}
+		return content
+	}
+	if !item.Target.Structured() {
+		return content
+	}
+
+	var selected string
+	var err error
+	if len(item.Target.JSONPath) > 0 {
+		selected, err = structured.SelectJSON([]byte(content), item.Target.JSONPath)
+	} else {
+		selected, err = structured.SelectYAML([]byte(content), item.Target.YAMLPath)
+	}
+	if err != nil {
+		return content
+	}
+	return selected
+}
@@ -2,15 +2,28 @@ package sync
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/exitflynn/codesync/internal/bitbucket"
 	"github.com/exitflynn/codesync/internal/config"
 	"github.com/exitflynn/codesync/internal/diff"
+	"github.com/exitflynn/codesync/internal/gitea"
 	"github.com/exitflynn/codesync/internal/github"
+	"github.com/exitflynn/codesync/internal/gitlab"
+	"github.com/exitflynn/codesync/internal/gitsource"
+	"github.com/exitflynn/codesync/internal/localsource"
+	"github.com/exitflynn/codesync/internal/notify"
+	"github.com/exitflynn/codesync/internal/plugin"
+	"github.com/exitflynn/codesync/internal/redact"
+	"github.com/exitflynn/codesync/internal/secrets"
 )
 
 type State struct {
@@ -20,68 +33,477 @@ type State struct {
 	CurrentRemoteHash string    `json:"currentRemoteHash"`
 	HasLocalChanges   bool      `json:"hasLocalChanges"`
 	HasRemoteChanges  bool      `json:"hasRemoteChanges"`
+	Failing           bool      `json:"failing,omitempty"`
+	RelocatedPath     string    `json:"relocatedPath,omitempty"` // Where a moved target function now lives
+	StaleOutputs      []string  `json:"staleOutputs,omitempty"`  // Generated files that are out of date
+	AssetHash         string    `json:"assetHash,omitempty"`     // Upstream content hash of the asset last synced
+	CommitsBehind     int       `json:"commitsBehind,omitempty"` // Upstream commits not applied yet
+	Tag               string    `json:"tag,omitempty"`           // Upstream tag last synced, for items with a source tag or release
+	Available         string    `json:"available,omitempty"`     // Newer release that the update policy doesn't sync
+
+	Files   map[string]string `json:"files,omitempty"`   // Hashes of a directory target's files as of the last sync, by relative path
+	Rollout *Rollout          `json:"rollout,omitempty"` // Progress of the latest upstream version through the rings
+
+	UpstreamChanges []time.Time `json:"upstreamChanges,omitempty"` // Times of the latest upstream commits, newest first
+	QuietSyncs      int         `json:"quietSyncs,omitempty"`      // Syncs in a row that found no upstream change
 }
 
 type SyncReport struct {
 	SyncItem     config.SyncItem
 	State        State
 	UpdatedFiles []string
+	CreatedFiles []string // Of the updated files, those a directory sync added
+	DeletedFiles []string // Of the updated files, those a directory sync removed
 	Diffs        map[string]*diff.DiffResult
 	Errors       []string
+	Conflict     bool
+	Recovered    bool                // The item succeeded after previously failing
+	Relocated    string              // New target path, set when the target function moved
+	Breaking     []string            // Breaking changes found in an upstream .proto file
+	Endpoints    []string            // Operations added to or removed from an OpenAPI spec
+	Stale        []string            // Generated outputs that don't match the synced target
+	Warnings     []string            // Problems worth attention that didn't stop the sync
+	Owners       []string            // CODEOWNERS of the updated files
+	Commits      []github.CommitInfo // Upstream commits since the last sync, newest first
+	Release      *github.ReleaseInfo // Upstream release of the pinned revision or followed release, if looked up
+	Failure      FailureKind         // Why the item failed, if it has errors
+	Deferred     bool                // Skipped because the run's API call budget ran out
+	ConflictID   string              // Conflict in the inbox, if the item conflicted
+	NewConflict  bool                // The conflict was opened by this sync
+	Rollout      string              // Why a rollout stopped before the last ring, if it did
+	Violations   []string            // Policies the upstream change violates, which kept it from being applied
+
+	cause error // Error behind a failure that SyncItem recorded without returning
 }
 
 type SyncManager struct {
-	config       *config.Config
-	githubClient *github.Client
-	stateDir     string
+	itemsMu         sync.RWMutex // Guards config.Items, which SetItems may replace
+	config          *config.Config
+	githubClient    *github.Client
+	enterpriseMu    sync.Mutex
+	enterprise      map[string]*github.Client // GitHub clients of items with their own githubBaseURL
+	gitlabClient    *gitlab.Client
+	bitbucketClient *bitbucket.Client
+	giteaClient     *gitea.Client
+	gitClient       *gitsource.Client
+	localClient     *localsource.Client
+	providers       map[string]SourceProvider // From plugins or SetProvider, by provider name
+	transforms      map[string]*plugin.Transform
+	plugins         []*plugin.Client // Started on first use, stopped by Close
+	stateDir        string
+	store           *fileStore
+	notifier        notify.Notifier
+	redactor        *redact.Redactor
+	onReport        func(*SyncReport)
+	onReportMu      sync.Mutex       // Serializes calls of onReport by items synced at once
+	conflictsMu     sync.Mutex       // Serializes updates of the conflict inbox
+	clockMu         sync.RWMutex     // Guards now, which SetClock may replace while syncing
+	now             func() time.Time // Clock for state, progress and notifications; time.Now if nil
+	files           *workspaceFiles  // Targets, kept in memory in a dry run
+	recording       *Bundle          // Bundle that CreateBundle records provider calls in
+	replaying       *Bundle          // Bundle that ApplyBundle syncs items from instead of their providers
+	fetched         *runCache        // What the current run fetched, shared between its items
 }
 
-func NewSyncManager(cfg *config.Config, stateDir string) (*SyncManager, error) {
-	if cfg.GitHubToken == "" {
-		return nil, fmt.Errorf("GitHub token is required")
+func NewSyncManager(cfg *config.Config, stateDir string, opts ...Option) (*SyncManager, error) {
+	o := options{providers: make(map[string]SourceProvider)}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if !o.offline {
+		if err := resolveCredentials(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// Fall back to a token stored by codesync login
+	if cfg.GitHubToken == "" && cfg.GitHubTokenSecret == nil && needsGitHub(cfg, o.providers) && !o.offline {
+		token, err := secrets.NewKeychain().LoginToken(cfg.GitHubHost())
+		if err != nil {
+			return nil, fmt.Errorf("failed to load GitHub token: %w", err)
+		}
+		cfg.GitHubToken = token
 	}
 
-	githubClient := github.NewClient(cfg.GitHubToken)
+	if cfg.GitHubToken == "" && needsGitHub(cfg, o.providers) && !o.offline {
+		return nil, fmt.Errorf("GitHub token is required")
+	}
 
 	if stateDir == "" {
 		stateDir = ".codesync"
 	}
 
-	if err := os.MkdirAll(stateDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	if !o.dryRun {
+		if err := os.MkdirAll(stateDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create state directory: %w", err)
+		}
+	}
+
+	store, err := newFileStore(cfg, stateDir)
+	if err != nil {
+		return nil, err
+	}
+	files := &workspaceFiles{}
+	if o.dryRun {
+		store.dryRun()
+		files.pending = make(map[string][]byte)
+	}
+
+	githubClient, err := newGitHubClient(cfg, store, cfg.GitHubBaseURL, cfg.GitHubUploadURL)
+	if err != nil {
+		return nil, err
+	}
+
+	redactor, err := redact.New(configSecrets(cfg), cfg.Redact)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redact pattern: %w", err)
+	}
+
+	loaded, err := loadPlugins(cfg)
+	if err != nil {
+		return nil, err
+	}
+	for name, provider := range o.providers {
+		loaded.providers[name] = provider
+	}
+
+	gitlabClient := gitlab.NewClient(cfg.GitLabURL, cfg.GitLabToken)
+	bitbucketClient := bitbucket.NewClient(cfg.BitbucketUsername, cfg.BitbucketAppPassword)
+	giteaClient := gitea.NewClient(cfg.GiteaURL, cfg.GiteaToken)
+	if limits, ok := limitsOf(cfg); ok {
+		gitlabClient.SetLimits(limits)
+		bitbucketClient.SetLimits(limits)
+		giteaClient.SetLimits(limits)
+	}
+
+	sm := &SyncManager{
+		config:          cfg,
+		githubClient:    githubClient,
+		enterprise:      make(map[string]*github.Client),
+		gitlabClient:    gitlabClient,
+		bitbucketClient: bitbucketClient,
+		giteaClient:     giteaClient,
+		gitClient:       gitsource.NewClient(gitCacheDir(cfg, stateDir, o.dryRun)),
+		localClient:     localsource.NewClient(),
+		providers:       loaded.providers,
+		transforms:      loaded.transforms,
+		plugins:         loaded.clients,
+		stateDir:        stateDir,
+		store:           store,
+		redactor:        redactor,
+		files:           files,
+	}
+
+	if cfg.Notifications != nil && !o.dryRun {
+		// The digest follows the manager's clock
+		notifier, err := notify.New(cfg.Notifications, storedFile{store, digestName}, loaded.notifiers, sm.Now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up notifications: %w", err)
+		}
+		sm.notifier = notifier
 	}
 
-	return &SyncManager{
-		config:       cfg,
-		githubClient: githubClient,
-		stateDir:     stateDir,
-	}, nil
+	return sm, nil
 }
 
+// resolveCredentials fetches the credentials that are configured as secret
+// references. Values set directly or through the environment take precedence.
+func resolveCredentials(cfg *config.Config) error {
+	for _, c := range []struct {
+		name  string
+		value *string
+		ref   *config.SecretRef
+	}{
+		{"GitHub token", &cfg.GitHubToken, cfg.GitHubTokenSecret},
+		{"GitLab token", &cfg.GitLabToken, cfg.GitLabTokenSecret},
+		{"Bitbucket app password", &cfg.BitbucketAppPassword, cfg.BitbucketAppPasswordSecret},
+		{"Gitea token", &cfg.GiteaToken, cfg.GiteaTokenSecret},
+	} {
+		if *c.value != "" || c.ref == nil {
+			continue
+		}
+		value, err := secrets.Resolve(c.ref)
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", c.name, err)
+		}
+		*c.value = value
+	}
+	return nil
+}
+
+// gitCacheDir returns where git sources are cloned. Clones can't go through
+// the state store, so with state encryption they are kept in memory rather
+// than written to disk in plain text, as they are in a dry run.
+func gitCacheDir(cfg *config.Config, stateDir string, dryRun bool) string {
+	if cfg.StateEncryption != nil || dryRun {
+		return ""
+	}
+	return filepath.Join(stateDir, "git")
+}
+
+// configSecrets returns the credentials held in the config, which are masked
+// wherever text leaves the process
+func configSecrets(cfg *config.Config) []string {
+	secrets := []string{cfg.GitHubToken, cfg.GitLabToken, cfg.BitbucketAppPassword, cfg.GiteaToken}
+	if cfg.Notifications != nil {
+		for _, notifier := range cfg.Notifications.Notifiers {
+			secrets = append(secrets, notifier.Key)
+			// The whole URL is the credential for incoming webhooks
+			if notifier.Type == "slack" || notifier.Type == "webhook" {
+				secrets = append(secrets, notifier.URL)
+			}
+		}
+	}
+	return secrets
+}
+
+// Redactor returns the redactor masking the config's secrets
+func (sm *SyncManager) Redactor() *redact.Redactor {
+	return sm.redactor
+}
+
+// SyncAll syncs every enabled item. Progress is recorded as items complete,
+// so a run that dies part way can be continued with ResumeAll.
 func (sm *SyncManager) SyncAll() ([]*SyncReport, error) {
-	var reports []*SyncReport
+	return sm.syncAll(false)
+}
 
-	for _, item := range sm.config.Items {
-		if item.Disabled {
-			continue
+// SyncItemByName syncs a single configured item, with the same error handling
+// and notifications as SyncAll
+func (sm *SyncManager) SyncItemByName(name string) (*SyncReport, error) {
+	item, ok := sm.Item(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownItem, name)
+	}
+
+	sm.resetBudgets()
+	report := sm.runItem(item)
+	return report, sm.notify([]*SyncReport{report})
+}
+
+// SyncItems syncs the named items in one run, with the API budget and
+// notifications of SyncAll. Unknown and disabled items are skipped, and items
+// left once the budget is spent are reported as deferred. Progress isn't
+// recorded, so the run can't be resumed.
+func (sm *SyncManager) SyncItems(names []string) ([]*SyncReport, error) {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	sm.resetBudgets()
+	sm.fetched = newRunCache()
+	defer func() { sm.fetched = nil }()
+
+	var items []config.SyncItem
+	for _, item := range sm.Items() {
+		if wanted[item.Name] {
+			items = append(items, item)
 		}
+	}
+	sm.prefetch(items)
 
-		report, err := sm.SyncItem(item)
-		if err != nil {
-			if report == nil {
-				report = &SyncReport{
-					SyncItem: item,
-					Errors:   []string{err.Error()},
-				}
-			} else {
-				report.Errors = append(report.Errors, err.Error())
+	var enabled []config.SyncItem
+	for _, item := range items {
+		if !item.Disabled {
+			enabled = append(enabled, item)
+		}
+	}
+	reports := sm.syncConcurrently(enabled, nil)
+
+	SortReports(reports)
+	sm.reportUsage(reports)
+	return reports, sm.notify(reports)
+}
+
+// Items returns the configured sync items
+func (sm *SyncManager) Items() []config.SyncItem {
+	sm.itemsMu.RLock()
+	defer sm.itemsMu.RUnlock()
+
+	return append([]config.SyncItem(nil), sm.config.Items...)
+}
+
+// SetItems replaces the sync items, e.g. when they are defined outside the
+// config file
+func (sm *SyncManager) SetItems(items []config.SyncItem) {
+	sm.itemsMu.Lock()
+	defer sm.itemsMu.Unlock()
+
+	sm.config.Items = items
+}
+
+// SetClock replaces the clock used for sync times, run progress, changelog
+// entries, notifications and the digest schedule, e.g. to test staleness. A
+// nil clock restores time.Now.
+func (sm *SyncManager) SetClock(now func() time.Time) {
+	sm.clockMu.Lock()
+	defer sm.clockMu.Unlock()
+	sm.now = now
+}
+
+// Now returns the current time according to the manager's clock
+func (sm *SyncManager) Now() time.Time {
+	sm.clockMu.RLock()
+	now := sm.now
+	sm.clockMu.RUnlock()
+
+	if now != nil {
+		return now()
+	}
+	return time.Now()
+}
+
+// Item returns the configured sync item with the given name
+func (sm *SyncManager) Item(name string) (config.SyncItem, bool) {
+	for _, item := range sm.Items() {
+		if item.Name == name {
+			return item, true
+		}
+	}
+	return config.SyncItem{}, false
+}
+
+// OnReport registers a function called with each item's report as soon as
+// the item has been synced. Items synced at once call it one at a time.
+func (sm *SyncManager) OnReport(fn func(*SyncReport)) {
+	sm.onReport = fn
+}
+
+// ItemState returns the stored state of a sync item
+func (sm *SyncManager) ItemState(name string) (State, error) {
+	return sm.loadState(name)
+}
+
+// runItem syncs an item and folds any error into its report
+func (sm *SyncManager) runItem(item config.SyncItem) *SyncReport {
+	report, err := sm.syncItemSafely(item)
+	if err != nil {
+		if report == nil {
+			report = &SyncReport{
+				SyncItem: item,
+				Errors:   []string{err.Error()},
+			}
+		} else {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+
+	recovered, healthErr := sm.updateHealth(item.Name, len(report.Errors) > 0)
+	if healthErr != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("Failed to save state: %v", healthErr))
+	}
+	report.Recovered = recovered
+	report.Failure = failureOf(report, err)
+	sort.Strings(report.UpdatedFiles)
+
+	sm.redactor.Strings(report.Errors)
+	sm.redactor.Strings(report.Warnings)
+
+	if sm.onReport != nil {
+		sm.onReportMu.Lock()
+		sm.onReport(report)
+		sm.onReportMu.Unlock()
+	}
+
+	return report
+}
+
+// SortReports orders reports by item name and ID, so that the output of
+// consecutive runs can be compared
+func SortReports(reports []*SyncReport) {
+	sort.SliceStable(reports, func(i, j int) bool {
+		a, b := reports[i].SyncItem, reports[j].SyncItem
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.ID() < b.ID()
+	})
+}
+
+// notify sends notification events for the given reports
+func (sm *SyncManager) notify(reports []*SyncReport) error {
+	if sm.notifier == nil {
+		return nil
+	}
+
+	var events []notify.Event
+	for _, report := range reports {
+		events = append(events, reportEvents(report)...)
+	}
+	for i := range events {
+		events[i].Message = sm.redactor.String(events[i].Message)
+		events[i].Time = sm.Now()
+	}
+
+	if err := sm.notifier.Notify(events); err != nil {
+		return fmt.Errorf("failed to send notifications: %s", sm.redactor.String(err.Error()))
+	}
+
+	return nil
+}
+
+// updateHealth records whether an item is failing and reports whether it has
+// just recovered from an earlier failure
+func (sm *SyncManager) updateHealth(itemName string, failing bool) (bool, error) {
+	state, err := sm.loadState(itemName)
+	if err != nil && !failing {
+		return false, nil
+	}
+
+	if state.Failing == failing {
+		return false, nil
+	}
+
+	recovered := state.Failing && !failing
+	state.Failing = failing
+
+	return recovered, sm.saveState(itemName, state)
+}
+
+// reportEvents converts a sync report into notification events
+func reportEvents(report *SyncReport) []notify.Event {
+	var events []notify.Event
+	name := report.SyncItem.Name
+
+	switch {
+	case report.Conflict:
+		// Each conflict is announced once, when it's opened
+		if report.NewConflict {
+			event := notify.NewEvent(name, notify.EventConflict, strings.Join(report.Errors, "; "))
+			event.ConflictID = report.ConflictID
+			events = append(events, event)
+		}
+	case len(report.Errors) > 0:
+		events = append(events, notify.NewEvent(name, notify.EventError, strings.Join(report.Errors, "; ")))
+	case len(report.UpdatedFiles) > 0:
+		event := notify.NewEvent(name, notify.EventUpdated, "updated "+strings.Join(report.UpdatedFiles, ", "))
+		// Notifiers strip what their content policy doesn't allow
+		for _, path := range report.UpdatedFiles {
+			file := notify.File{Path: path}
+			if d := report.Diffs[path]; d != nil {
+				file.Added, file.Removed = d.Stats.Added, d.Stats.Removed
+				file.Diff = diff.FormatDiff(d, false)
 			}
+			event.Files = append(event.Files, file)
 		}
+		events = append(events, event)
+	}
+
+	if report.Recovered {
+		events = append(events, notify.NewEvent(name, notify.EventRecovered, "sync succeeded again"))
+	}
 
-		reports = append(reports, report)
+	for i := range events {
+		events[i].ItemID = report.SyncItem.ID()
+		events[i].Tags = report.SyncItem.Tags
+		events[i].Owners = report.Owners
+		events[i].Owner = report.SyncItem.Owner
+		events[i].Contacts = report.SyncItem.Contacts
 	}
 
-	return reports, nil
+	return events
 }
 
 func (sm *SyncManager) SyncItem(item config.SyncItem) (*SyncReport, error) {
@@ -91,6 +513,16 @@ func (sm *SyncManager) SyncItem(item config.SyncItem) (*SyncReport, error) {
 		Errors:   []string{},
 	}
 
+	// A multi-file update an earlier run was interrupted in is finished first
+	recovered, err := sm.recoverJournal(item)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("Failed to recover an interrupted update: %v", err))
+		return report, err
+	}
+	if recovered != "" {
+		report.Warnings = append(report.Warnings, recovered)
+	}
+
 	state, err := sm.loadState(item.Name)
 	if err != nil {
 		state = State{
@@ -98,6 +530,24 @@ func (sm *SyncManager) SyncItem(item config.SyncItem) (*SyncReport, error) {
 		}
 	}
 
+	// Items following releases sync from the tag of the latest one
+	item, err = sm.resolveRelease(item, &state, report)
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		return report, err
+	}
+
+	if item.Target.Type == "function" {
+		item, err = sm.resolveFunctionTarget(item, &state, report)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			return report, err
+		}
+	}
+
+	// The local content as of the last sync, kept if the item conflicts
+	syncedLocalHash := state.CurrentLocalHash
+
 	hasLocalChanges, localHash, err := sm.checkLocalChanges(item, state.CurrentLocalHash)
 	if err != nil {
 		report.Errors = append(report.Errors, fmt.Sprintf("Error checking local changes: %v", err))
@@ -106,36 +556,268 @@ func (sm *SyncManager) SyncItem(item config.SyncItem) (*SyncReport, error) {
 		state.CurrentLocalHash = localHash
 	}
 
-	hasRemoteChanges, remoteContent, remoteHash, commitID, err := sm.checkRemoteChanges(item, state.LastCommitID)
+	// The directory's hash misses edits that keep its length, so mirrored
+	// directories also compare each file with the hash it was synced with
+	if item.Target.Type == "directory" && !item.Target.Migrations && item.Target.Terraform == nil && !state.HasLocalChanges {
+		edited, err := editedFiles(item, state)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("Error checking local changes: %v", err))
+		}
+		state.HasLocalChanges = len(edited) > 0
+	}
+
+	// The last synced commit, for the changelog
+	previousCommit := state.LastCommitID
+
+	hasRemoteChanges, remoteContent, remoteHash, commitID, err := sm.checkRemoteChanges(item, state.LastCommitID, report)
+	if err == nil && remoteContent != "" {
+		if remoteContent, err = sm.applyTransform(item, remoteContent); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("Failed to transform upstream content: %v", err))
+			return report, err
+		}
+	}
 	if err != nil {
 		report.Errors = append(report.Errors, fmt.Sprintf("Error checking remote changes: %v", err))
+		report.cause = err
 	} else {
 		state.HasRemoteChanges = hasRemoteChanges
 		state.CurrentRemoteHash = remoteHash
-	}
+		state.CommitsBehind = 0
+		state.observeActivity(report.Commits)
+		if hasRemoteChanges {
+			state.CommitsBehind = len(report.Commits)
+		}
 
-	if state.HasLocalChanges && state.HasRemoteChanges {
-		report.Errors = append(report.Errors, "Both local and remote have changes. Manual resolution required.")
+		// Assets are only compared by hash, so a commit that rewrote the
+		// same bytes isn't a change
+		if hasRemoteChanges && item.Target.Type == "asset" && remoteHash == state.AssetHash {
+			state.HasRemoteChanges = false
+			state.LastCommitID = commitID
+			state.CommitsBehind = 0
+		}
 
-		state.LastSync = time.Now()
-		if err := sm.saveState(item.Name, state); err != nil {
-			report.Errors = append(report.Errors, fmt.Sprintf("Failed to save state: %v", err))
+		// A fingerprinted asset changed, so it's downloaded now
+		if state.HasRemoteChanges && item.Target.Type == "asset" && remoteContent == "" && remoteHash != assetHash("") {
+			if remoteContent, err = sm.downloadAsset(item, commitID); err != nil {
+				report.Errors = append(report.Errors, err.Error())
+				return report, err
+			}
+		}
+
+		// A new tag that didn't change the source is synced as it is
+		if !state.HasRemoteChanges {
+			state.Tag = item.Source.Tag
+		}
+	}
+
+	// Content written for a file target: upstream's, or the merge of both
+	// sides when a merge driver resolves a conflict
+	fileContent := remoteContent
+
+	// Set when the item keeps its local changes over upstream's, which are
+	// then recorded as synced without being written
+	keepLocal := false
+
+	// Migrations directories never overwrite local files, so local changes
+	// can't conflict, nor can local changes that already apply upstream's,
+	// e.g. exported patches
+	if state.HasLocalChanges && state.HasRemoteChanges && !item.Target.Migrations && !sm.alreadyApplied(item, remoteContent) {
+		var err error
+		switch item.OnConflict {
+		case config.ConflictOurs:
+			keepLocal = true
+			report.Warnings = append(report.Warnings, "Both local and remote have changes; kept the local ones.")
+		case config.ConflictTheirs:
+			var backup string
+			if backup, err = sm.backupTarget(item, state); err == nil {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("Both local and remote have changes; took the remote ones and backed up the local ones as %s.", backup))
+			}
+		case config.ConflictFail:
+			err = errNoMerge
+		default:
+			fileContent, err = sm.mergeChanges(item, state.LastCommitID, remoteContent)
 		}
+		if err != nil {
+			switch {
+			case errors.Is(err, errNoMerge):
+				report.Errors = append(report.Errors, "Both local and remote have changes. Manual resolution required.")
+			case item.OnConflict == config.ConflictTheirs:
+				report.Errors = append(report.Errors, fmt.Sprintf("Both local and remote have changes and backing up the local ones failed (%v). Manual resolution required.", err))
+			default:
+				report.Errors = append(report.Errors, fmt.Sprintf("Both local and remote have changes and the merge failed (%v). Manual resolution required.", err))
+			}
+			report.Conflict = true
+
+			conflict, opened, err := sm.recordConflict(item, localHash, commitID, remoteContent, strings.Join(report.Errors, "; "))
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("Failed to record conflict: %v", err))
+			} else {
+				report.ConflictID = conflict.ID
+				report.NewConflict = opened
+			}
 
-		return report, fmt.Errorf("conflict detected")
+			// Until it's resolved, the local change stays a change, so the
+			// next sync can't overwrite it
+			state.CurrentLocalHash = syncedLocalHash
+			state.LastSync = sm.Now()
+			if err := sm.saveState(item.Name, state); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("Failed to save state: %v", err))
+			}
+
+			return report, ErrConflict
+		}
 	}
 
+	// Policies see the upstream change before it's applied
 	if state.HasRemoteChanges {
+		violations, err := sm.checkPolicies(item, commitID, state, report)
+		if err == nil && len(violations) > 0 {
+			err = fmt.Errorf("%w: %s", ErrPolicyViolation, strings.Join(violations, "; "))
+		}
+		if err != nil {
+			report.Violations = violations
+			report.Errors = append(report.Errors, err.Error())
+			return report, err
+		}
+	}
+
+	// Set while later rings wait for a version, which isn't synced until
+	// they have it
+	rollingOut := false
+
+	// What the update replaces, kept so that it can be undone
+	var undo *undoCapture
+
+	if keepLocal {
+		// Upstream's change counts as synced, while the local change stays a
+		// change, so later upstream changes conflict with it again. The
+		// snapshot stays at what was last applied, the base of any merge.
+		state.LastCommitID = commitID
+		state.Tag = item.Source.Tag
+		state.HasRemoteChanges = false
+		state.CommitsBehind = 0
+		state.CurrentLocalHash = syncedLocalHash
+	} else if state.HasRemoteChanges {
+		if undo, err = sm.captureUndo(item, state); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("Failed to read what the update replaces: %v", err))
+			return report, err
+		}
+		before := sm.readLocalTarget(item)
+
 		switch item.Target.Type {
 		case "file":
-			if err := sm.updateLocalFile(item, remoteContent); err != nil {
+			if err := checkBreaking(item, before, remoteContent, report); err != nil {
+				report.Errors = append(report.Errors, err.Error())
+				return report, err
+			}
+			if item.Target.Structured() {
+				selected, err := applySelection(item, sm.readLocalTarget(item), remoteContent)
+				if err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("Failed to sync selected keys: %v", err))
+					return report, err
+				}
+				fileContent = selected
+			}
+			if isNotebook(item) {
+				// Outputs and execution counts aren't synced, so an upstream
+				// commit that only reran the notebook changes nothing
+				fileContent = stripNotebook(fileContent)
+				if fileContent == stripNotebook(before) {
+					break
+				}
+			}
+			if err := sm.updateLocalFile(item, fileContent); err != nil {
 				report.Errors = append(report.Errors, fmt.Sprintf("Failed to update local file: %v", err))
 				return report, err
 			}
 			report.UpdatedFiles = append(report.UpdatedFiles, item.Target.Path)
 
 		case "directory":
-			report.Errors = append(report.Errors, "Directory sync not fully implemented yet")
+			switch {
+			case item.Target.Migrations:
+				if err := sm.syncMigrations(item, commitID, report); err != nil {
+					return report, err
+				}
+			case item.Target.Terraform != nil:
+				if err := sm.vendorModule(item, commitID, report); err != nil {
+					return report, err
+				}
+			default:
+				if err := sm.syncDirectory(item, commitID, &state, report); err != nil {
+					return report, err
+				}
+			}
+
+		case "openapi":
+			spec, err := sm.prepareSpec(item, before, remoteContent, commitID, report)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("Rejected upstream spec: %v", err))
+				return report, err
+			}
+			if err := sm.updateLocalFile(item, spec); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("Failed to update local file: %v", err))
+				return report, err
+			}
+			report.UpdatedFiles = append(report.UpdatedFiles, item.Target.Path)
+
+		case "markdown":
+			updated, err := syncSection(item, before, remoteContent)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("Failed to sync section: %v", err))
+				return report, err
+			}
+			if err := sm.updateLocalFile(item, updated); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("Failed to update local file: %v", err))
+				return report, err
+			}
+			report.UpdatedFiles = append(report.UpdatedFiles, item.Target.Path)
+
+		case "workflow":
+			updated, err := syncWorkflow(item, before, remoteContent)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("Rejected upstream workflow: %v", err))
+				return report, err
+			}
+			if err := sm.updateLocalFile(item, updated); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("Failed to update local file: %v", err))
+				return report, err
+			}
+			report.UpdatedFiles = append(report.UpdatedFiles, item.Target.Path)
+
+		case "asset":
+			processed, err := processAsset(item, remoteContent)
+			if err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("Failed to process asset: %v", err))
+				return report, err
+			}
+			if err := sm.updateLocalFile(item, processed); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("Failed to update local file: %v", err))
+				return report, err
+			}
+			report.UpdatedFiles = append(report.UpdatedFiles, item.Target.Path)
+			state.AssetHash = remoteHash
+
+		case "region":
+			if len(item.Target.Rings) > 0 {
+				complete, err := sm.rollOut(item, remoteContent, commitID, &state, report)
+				if err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("Failed to roll out region: %v", err))
+					if errors.Is(err, ErrRingUnhealthy) {
+						// The halt, and any revert, must outlive this sync
+						if _, localHash, err := sm.checkLocalChanges(item, ""); err == nil {
+							state.CurrentLocalHash = localHash
+						}
+						if err := sm.saveState(item.Name, state); err != nil {
+							report.Errors = append(report.Errors, fmt.Sprintf("Failed to save state: %v", err))
+						}
+					}
+					return report, err
+				}
+				rollingOut = !complete
+			} else if err := sm.syncRegions(item, remoteContent, commitID, report); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("Failed to sync region: %v", err))
+				return report, err
+			}
 
 		case "function":
 			if err := sm.updateLocalFunction(item, remoteContent); err != nil {
@@ -145,25 +827,102 @@ func (sm *SyncManager) SyncItem(item config.SyncItem) (*SyncReport, error) {
 			report.UpdatedFiles = append(report.UpdatedFiles, item.Target.Path)
 		}
 
-		state.LastCommitID = commitID
-		state.HasRemoteChanges = false
+		// Binary assets aren't diffed or snapshotted; their hashes are enough.
+		// Regions are diffed per file as they are written.
+		after := before
+		if item.Target.Type != "asset" && item.Target.Type != "region" {
+			after = sm.readLocalTarget(item)
+		}
+		if after != before {
+			var d *diff.DiffResult
+			if isNotebook(item) {
+				d = notebookDiff(before, after)
+			} else {
+				d = diff.GenerateDiff(before, after)
+			}
+
+			// Blame is a nice-to-have, so a failed lookup doesn't fail the sync
+			if blamer, ok := sm.source(item).(Blamer); ok && sm.config.BlameDiffs {
+				if blame, err := blamer.GetBlame(item.Source.Owner, item.Source.Repo, item.Source.Path, commitID); err == nil {
+					diff.Annotate(d, strings.Split(remoteContent, "\n"), blame)
+				}
+			}
+
+			report.Diffs[item.Target.Path] = d
+		}
+
+		if item.Target.Type != "asset" && !rollingOut {
+			if err := sm.saveSnapshot(item.Name, remoteContent); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("Failed to save snapshot: %v", err))
+			}
+		}
+
+		if !rollingOut {
+			state.LastCommitID = commitID
+			state.Tag = item.Source.Tag
+			state.HasRemoteChanges = false
+			state.CommitsBehind = 0
+		}
 		state.HasLocalChanges = false
+
+		// Our own write isn't a local change
+		if _, localHash, err := sm.checkLocalChanges(item, ""); err == nil {
+			state.CurrentLocalHash = localHash
+		}
 	}
 
-	state.LastSync = time.Now()
+	if len(report.UpdatedFiles) > 0 && item.Changelog {
+		sm.releaseNotes(item, report)
+		if err := appendChangelog(sm.files, item, previousCommit, commitID, report, sm.Now()); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("Failed to update changelog: %v", err))
+		}
+	}
+
+	if len(report.UpdatedFiles) > 0 {
+		owners, err := updatedOwners(report.UpdatedFiles)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("Failed to read CODEOWNERS: %v", err))
+		}
+		report.Owners = owners
+	}
+
+	// Generators run over the files on disk, which a dry run doesn't change
+	if item.Generate != nil && sm.files.dryRun() {
+		report.Warnings = append(report.Warnings, "generated code isn't checked in a dry run")
+	} else if item.Generate != nil {
+		stale, err := checkGenerated(item.Generate)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("Failed to check generated code: %v", err))
+		} else {
+			state.StaleOutputs = stale
+			report.Stale = stale
+		}
+	}
+
+	if len(report.Errors) == 0 {
+		if err := sm.closeConflicts(item.Name); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+	}
+
+	state.LastSync = sm.Now()
 	report.State = state
 
 	if err := sm.saveState(item.Name, state); err != nil {
 		report.Errors = append(report.Errors, fmt.Sprintf("Failed to save state: %v", err))
+	} else if err := sm.clearJournal(item.Name); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	} else if undo != nil && len(report.UpdatedFiles) > 0 && len(report.Errors) == 0 {
+		if err := sm.saveUndo(item, undo, commitID, report); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("Failed to keep what the update replaced: %v", err))
+		}
 	}
 
 	return report, nil
 }
 
 func (sm *SyncManager) loadState(itemName string) (State, error) {
-	statePath := filepath.Join(sm.stateDir, sanitizeFilename(itemName)+".json")
-
-	data, err := os.ReadFile(statePath)
+	data, err := sm.store.read(sanitizeFilename(itemName) + ".json")
 	if err != nil {
 		return State{}, err
 	}
@@ -175,14 +934,12 @@ func (sm *SyncManager) loadState(itemName string) (State, error) {
 
 // saveState saves the state for a sync item
 func (sm *SyncManager) saveState(itemName string, state State) error {
-	statePath := filepath.Join(sm.stateDir, sanitizeFilename(itemName)+".json")
-
 	data, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal state: %w", err)
 	}
 
-	if err := os.WriteFile(statePath, data, 0644); err != nil {
+	if err := sm.store.write(sanitizeFilename(itemName)+".json", data); err != nil {
 		return fmt.Errorf("failed to write state file: %w", err)
 	}
 
@@ -197,23 +954,61 @@ func (sm *SyncManager) checkLocalChanges(item config.SyncItem, lastHash string)
 		return false, "", err
 	}
 
+	if item.Target.Type == "region" {
+		content, err := regionContent(sm.files, item)
+		if err != nil {
+			return false, "", err
+		}
+		currentHash := calculateHash(content)
+		return currentHash != lastHash, currentHash, nil
+	}
+
+	if item.Target.Type == "directory" {
+		content, err := directoryContent(item, absPath)
+		if err != nil {
+			return false, "", fmt.Errorf("failed to read local directory: %w", err)
+		}
+		currentHash := calculateHash(content)
+		// An empty directory that never synced is waiting for its first sync
+		if lastHash == "" && content == "" {
+			return false, currentHash, nil
+		}
+		return currentHash != lastHash, currentHash, nil
+	}
+
 	// Read local file
-	content, err := os.ReadFile(absPath)
+	content, err := sm.files.readFile(absPath)
+	if errors.Is(err, fs.ErrNotExist) && item.Target.Type == "function" && item.Target.Bootstrap {
+		// The first sync creates it
+		return false, "", nil
+	}
 	if err != nil {
 		return false, "", fmt.Errorf("failed to read local file: %w", err)
 	}
 
-	currentHash := calculateHash(string(content))
+	currentHash := calculateHash(hashedContent(item, string(content)))
+	if item.Target.Type == "asset" {
+		currentHash = assetHash(string(content))
+	}
 
 	hasChanges := currentHash != lastHash
 	return hasChanges, currentHash, nil
 }
 
-func (sm *SyncManager) checkRemoteChanges(item config.SyncItem, lastCommitID string) (bool, string, string, string, error) {
-	commits, err := sm.githubClient.GetCommitsSince(
+// checkRemoteChanges fetches the latest upstream content of an item and
+// records the upstream commits since lastCommitID in the report
+func (sm *SyncManager) checkRemoteChanges(item config.SyncItem, lastCommitID string, report *SyncReport) (bool, string, string, string, error) {
+	// Vendored modules are pinned, so only a new revision is a change
+	if item.Target.Terraform != nil {
+		revision := item.Source.Revision
+		return revision != lastCommitID, "", revision, revision, nil
+	}
+
+	commits, err := sm.source(item).GetCommitsSince(
 		item.Source.Owner,
 		item.Source.Repo,
 		item.Source.Path,
+		item.Source.Ref(),
 		time.Time{},
 		lastCommitID,
 	)
@@ -226,45 +1021,84 @@ func (sm *SyncManager) checkRemoteChanges(item config.SyncItem, lastCommitID str
 	}
 
 	latestCommit := commits[0]
-	content, err := sm.githubClient.GetFile(
-		item.Source.Owner,
-		item.Source.Repo,
-		item.Source.Path,
-		latestCommit.SHA,
-	)
+	report.Commits = commits
+
+	// Directories are fetched file by file when they are synced
+	if item.Target.Type == "directory" {
+		return latestCommit.SHA != lastCommitID, "", latestCommit.SHA, latestCommit.SHA, nil
+	}
+
+	// Large assets are only downloaded once they have to be written
+	if item.Target.Type == "asset" {
+		if fingerprint, ok := sm.assetFingerprint(item, latestCommit.SHA); ok {
+			hasChanges := fingerprint != item.Source.Revision && latestCommit.SHA != lastCommitID
+			return hasChanges, "", fingerprint, latestCommit.SHA, nil
+		}
+	}
+
+	content, err := sm.getFile(item, item.Source.Path, latestCommit.SHA)
 	if err != nil {
 		return false, "", "", "", fmt.Errorf("failed to get file content: %w", err)
 	}
 
 	remoteHash := calculateHash(content.Content)
+	if item.Target.Type == "asset" {
+		remoteHash = assetHash(content.Content)
+	}
 
 	hasChanges := remoteHash != item.Source.Revision && latestCommit.SHA != lastCommitID
 	return hasChanges, content.Content, remoteHash, latestCommit.SHA, nil
 }
 
+// readLocalTarget returns the content of a file target, or an empty string if
+// it can't be read
+func (sm *SyncManager) readLocalTarget(item config.SyncItem) string {
+	absPath, err := item.Target.GetAbsolutePath("")
+	if err != nil {
+		return ""
+	}
+
+	content, err := sm.files.readFile(absPath)
+	if err != nil {
+		return ""
+	}
+
+	return string(content)
+}
+
 func (sm *SyncManager) updateLocalFile(item config.SyncItem, remoteContent string) error {
 	absPath, err := item.Target.GetAbsolutePath("")
 	if err != nil {
 		return err
 	}
 
-	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+	if err := sm.files.mkdirAll(filepath.Dir(absPath), 0755); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	if err := os.WriteFile(absPath, []byte(remoteContent), 0644); err != nil {
+	return sm.writeTarget(item, absPath, remoteContent)
+}
+
+// writeTarget replaces the content of an item's target file atomically. The
+// file keeps its permissions unless the target configures a mode.
+func (sm *SyncManager) writeTarget(item config.SyncItem, absPath, content string) error {
+	mode, err := item.Target.FileMode()
+	if err != nil {
+		return err
+	}
+	if mode != 0 {
+		err = sm.files.writeFileMode(absPath, []byte(content), mode)
+	} else {
+		err = sm.files.writeFile(absPath, []byte(content), 0644)
+	}
+	if err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
-
 	return nil
 }
 
 func (sm *SyncManager) updateLocalFunction(item config.SyncItem, remoteContent string) error {
-	functionContent, err := sm.githubClient.ExtractFunction(
-		remoteContent,
-		item.Target.Language,
-		item.Target.Function,
-	)
+	functionContent, err := sm.extractFunction(item, remoteContent)
 	if err != nil {
 		return fmt.Errorf("failed to extract function: %w", err)
 	}
@@ -274,11 +1108,25 @@ func (sm *SyncManager) updateLocalFunction(item config.SyncItem, remoteContent s
 		return err
 	}
 
-	localContent, err := os.ReadFile(absPath)
+	localContent, err := sm.files.readFile(absPath)
+	if errors.Is(err, fs.ErrNotExist) && item.Target.Bootstrap {
+		content, err := bootstrapFile(item, absPath, functionContent)
+		if err != nil {
+			return fmt.Errorf("failed to create file: %w", err)
+		}
+		return sm.updateLocalFile(item, content)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to read local file: %w", err)
 	}
 
+	// Apply only what changed upstream since the last sync, so local
+	// formatting and unrelated edits in the function survive. Fall back to
+	// replacing the whole function if that doesn't work.
+	if patched, err := sm.minimalFunctionPatch(item, string(localContent), functionContent); err == nil {
+		functionContent = patched
+	}
+
 	updatedContent, err := replaceFunction(
 		string(localContent),
 		item.Target.Language,
@@ -289,11 +1137,28 @@ func (sm *SyncManager) updateLocalFunction(item config.SyncItem, remoteContent s
 		return fmt.Errorf("failed to replace function: %w", err)
 	}
 
-	if err := os.WriteFile(absPath, []byte(updatedContent), 0644); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+	return sm.writeTarget(item, absPath, updatedContent)
+}
+
+// minimalFunctionPatch applies the upstream change between the last synced
+// version of the function and the new one to the local copy of the function
+func (sm *SyncManager) minimalFunctionPatch(item config.SyncItem, localContent, remoteFunction string) (string, error) {
+	snapshot, err := sm.loadSnapshot(item.Name)
+	if err != nil {
+		return "", err
 	}
 
-	return nil
+	base, err := sm.extractFunction(item, snapshot)
+	if err != nil {
+		return "", err
+	}
+
+	local, err := sm.extractFunction(item, localContent)
+	if err != nil {
+		return "", err
+	}
+
+	return diff.Rebase(base, remoteFunction, local)
 }
 
 func replaceFunction(localContent, language, functionName, newFunctionContent string) (string, error) {
@@ -305,14 +1170,14 @@ func replaceFunction(localContent, language, functionName, newFunctionContent st
 	case "javascript":
 		return replaceJavaScriptFunction(localContent, functionName, newFunctionContent)
 	default:
-		return "", fmt.Errorf("unsupported language: %s", language)
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedLanguage, language)
 	}
 }
 
 func replaceGoFunction(content, functionName, newFunction string) (string, error) {
 	start := strings.Index(content, "func "+functionName)
 	if start == -1 {
-		return "", fmt.Errorf("function %s not found", functionName)
+		return "", fmt.Errorf("function %s %w", functionName, ErrNotFound)
 	}
 
 	end := start
@@ -335,7 +1200,7 @@ func replaceGoFunction(content, functionName, newFunction string) (string, error
 func replacePythonFunction(content, functionName, newFunction string) (string, error) {
 	start := strings.Index(content, "def "+functionName)
 	if start == -1 {
-		return "", fmt.Errorf("function %s not found", functionName)
+		return "", fmt.Errorf("function %s %w", functionName, ErrNotFound)
 	}
 
 	end := start
@@ -363,7 +1228,7 @@ func replaceJavaScriptFunction(content, functionName, newFunction string) (strin
 	if start == -1 {
 		start = strings.Index(content, functionName+" = ")
 		if start == -1 {
-			return "", fmt.Errorf("function %s not found", functionName)
+			return "", fmt.Errorf("function %s %w", functionName, ErrNotFound)
 		}
 	}
 
@@ -0,0 +1,589 @@
+package sync
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/bitbucket"
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/diff"
+	"github.com/exitflynn/codesync/internal/gitea"
+	"github.com/exitflynn/codesync/internal/github"
+	"github.com/exitflynn/codesync/internal/gitlab"
+	"github.com/exitflynn/codesync/internal/gitsource"
+	"github.com/exitflynn/codesync/internal/localsource"
+	"github.com/exitflynn/codesync/internal/plugin"
+	"github.com/exitflynn/codesync/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestUpdateLocalFunctionAppliesMinimalPatch(t *testing.T) {
+	t.Chdir(t.TempDir())
+	sm := newTestManager(t)
+	item := functionItem("off")
+
+	base := "package upstream\n\nfunc TrimAll(words []string, cutset string) []string {\n\tresult := make([]string, 0, len(words))\n\tfor _, word := range words {\n\t\tresult = append(result, strings.Trim(word, cutset))\n\t}\n\treturn result\n}\n"
+	updated := strings.Replace(base, "make([]string, 0, len(words))", "make([]string, 0, len(words)+1)", 1)
+
+	// The local copy has an extra comment that upstream doesn't
+	local := "package util\n\nfunc TrimAll(words []string, cutset string) []string {\n\tresult := make([]string, 0, len(words))\n\tfor _, word := range words {\n\t\t// local note\n\t\tresult = append(result, strings.Trim(word, cutset))\n\t}\n\treturn result\n}\n"
+	writeTestFile(t, item.Target.Path, local)
+
+	if err := sm.saveSnapshot(item.Name, base); err != nil {
+		t.Fatalf("saveSnapshot failed: %v", err)
+	}
+
+	if err := sm.updateLocalFunction(item, updated); err != nil {
+		t.Fatalf("updateLocalFunction failed: %v", err)
+	}
+
+	got, _ := os.ReadFile(item.Target.Path)
+	if !strings.Contains(string(got), "len(words)+1") {
+		t.Errorf("Expected upstream change to be applied:\n%s", got)
+	}
+	if !strings.Contains(string(got), "// local note") {
+		t.Errorf("Expected local edit to be preserved:\n%s", got)
+	}
+}
+
+func TestUpdateLocalFunctionFallsBackToReplacement(t *testing.T) {
+	t.Chdir(t.TempDir())
+	sm := newTestManager(t)
+	item := functionItem("off")
+
+	updated := "package upstream\n\nfunc TrimAll(words []string, cutset string) []string {\n\treturn words\n}\n"
+	writeTestFile(t, item.Target.Path, "package util\n\nfunc TrimAll(words []string, cutset string) []string {\n\treturn nil\n}\n")
+
+	// Without a snapshot there is no base to patch from
+	if err := sm.updateLocalFunction(item, updated); err != nil {
+		t.Fatalf("updateLocalFunction failed: %v", err)
+	}
+
+	got, _ := os.ReadFile(item.Target.Path)
+	if !strings.Contains(string(got), "return words") || strings.Contains(string(got), "return nil") {
+		t.Errorf("Expected the function to be replaced:\n%s", got)
+	}
+}
+
+// FuzzReplaceFunction replaces functions in malformed local files, which
+// mustn't lose the new function or the rest of the file
+func FuzzReplaceFunction(f *testing.F) {
+	f.Add("package util\n\nfunc Trim(s string) string {\n\treturn s\n}\n", uint8(0), "Trim")
+	f.Add("def trim(s):\n\treturn s\n\ndef other():\n    pass\n", uint8(1), "trim")
+	f.Add("const trim = (s) => { return s; };\n", uint8(2), "trim")
+	f.Add("func Trim() {"+strings.Repeat("{", 1000), uint8(0), "Trim")
+	f.Add("function trim() }}}{{{", uint8(2), "trim")
+	f.Add("def ünïcödé(\x00\xff", uint8(1), "ünïcödé")
+
+	languages := []string{"go", "python", "javascript"}
+	f.Fuzz(func(t *testing.T, content string, language uint8, name string) {
+		const replacement = "<replacement>"
+		got, err := replaceFunction(content, languages[int(language)%len(languages)], name, replacement)
+		if err != nil {
+			return
+		}
+		if !strings.Contains(got, replacement) {
+			t.Errorf("Expected the new function in %q", got)
+		}
+		if len(got) > len(content)+len(replacement) {
+			t.Errorf("Expected at most the new function to be added, got %q", got)
+		}
+	})
+}
+
+func TestMergeChanges(t *testing.T) {
+	t.Chdir(t.TempDir())
+	sm := newTestManager(t)
+	sm.config.MergeDrivers = []config.MergeDriverRule{{Path: "*.json", Driver: "json-merge"}}
+
+	item := config.SyncItem{
+		Name:   "settings",
+		Source: config.SyncSource{Owner: "acme", Repo: "utils", Path: "settings.json", Branch: "main"},
+		Target: config.SyncTarget{Path: "config/settings.json", Type: "file"},
+	}
+	writeTestFile(t, item.Target.Path, `{"timeout": 30, "retries": 5}`)
+
+	// No snapshot means no base to merge from
+	if _, err := sm.mergeChanges(item, "", `{"timeout": 60, "retries": 3}`); err == nil {
+		t.Fatal("Expected merge without a snapshot to fail")
+	}
+
+	if err := sm.saveSnapshot(item.Name, `{"timeout": 30, "retries": 3}`); err != nil {
+		t.Fatalf("saveSnapshot failed: %v", err)
+	}
+
+	merged, err := sm.mergeChanges(item, "", `{"timeout": 60, "retries": 3}`)
+	if err != nil {
+		t.Fatalf("mergeChanges failed: %v", err)
+	}
+	if !strings.Contains(merged, `"timeout": 60`) || !strings.Contains(merged, `"retries": 5`) {
+		t.Errorf("Expected both changes to be kept:\n%s", merged)
+	}
+
+	// Structured items aren't merged as whole files
+	item.Target.JSONPath = config.Selectors{"$.timeout"}
+	if _, err := sm.mergeChanges(item, "", ""); !errors.Is(err, errNoMerge) {
+		t.Errorf("Expected no merge driver, got %v", err)
+	}
+}
+
+func TestMergeChangesLineByLine(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	item := config.SyncItem{
+		Name:   "retry",
+		Source: config.SyncSource{Owner: "acme", Repo: "utils", Path: "retry.go", Branch: "main"},
+		Target: config.SyncTarget{Path: "pkg/retry.go", Type: "file"},
+	}
+	// Without a snapshot, the base is fetched from the commit last synced
+	mock := mocks.NewMockGitHubClient(gomock.NewController(t))
+	mock.EXPECT().GetFile("acme", "utils", "retry.go", "c1").
+		Return(&github.FileInfo{Content: "package retry\n\nconst attempts = 3\n\nconst delay = 1\n"}, nil).Times(2)
+	sm, err := NewSyncManager(&config.Config{Version: "1.0"}, t.TempDir(), WithProvider(config.ProviderGitHub, mock))
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	writeTestFile(t, item.Target.Path, "package retry\n\nconst attempts = 5\n\nconst delay = 1\n")
+
+	merged, err := sm.mergeChanges(item, "c1", "package retry\n\nconst attempts = 3\n\nconst delay = 2\n")
+	if err != nil {
+		t.Fatalf("mergeChanges failed: %v", err)
+	}
+	if merged != "package retry\n\nconst attempts = 5\n\nconst delay = 2\n" {
+		t.Errorf("Expected both changes to be kept:\n%s", merged)
+	}
+
+	// Only changes to the same lines conflict
+	if _, err := sm.mergeChanges(item, "c1", "package retry\n\nconst attempts = 4\n\nconst delay = 1\n"); !errors.Is(err, diff.ErrConflict) {
+		t.Errorf("Expected a conflict, got %v", err)
+	}
+}
+
+func TestCheckBreaking(t *testing.T) {
+	local := "syntax = \"proto3\";\nmessage User {\n  string id = 1;\n  string email = 2;\n}\n"
+	remote := "syntax = \"proto3\";\nmessage User {\n  string id = 1;\n}\n"
+
+	item := config.SyncItem{Target: config.SyncTarget{Path: "api/user.proto", Type: "file"}}
+
+	report := &SyncReport{}
+	if err := checkBreaking(item, local, remote, report); err != nil || len(report.Breaking) != 1 {
+		t.Errorf("Expected warn policy to record the change: %v %v", err, report.Breaking)
+	}
+
+	item.Target.OnBreaking = "fail"
+	if err := checkBreaking(item, local, remote, &SyncReport{}); err == nil {
+		t.Error("Expected fail policy to stop the sync")
+	}
+
+	item.Target.OnBreaking = "allow"
+	report = &SyncReport{}
+	if err := checkBreaking(item, local, remote, report); err != nil || len(report.Breaking) != 0 {
+		t.Errorf("Expected allow policy to skip the check: %v %v", err, report.Breaking)
+	}
+
+	// Other files aren't checked
+	item = config.SyncItem{Target: config.SyncTarget{Path: "api/user.txt", Type: "file", OnBreaking: "fail"}}
+	if err := checkBreaking(item, local, remote, &SyncReport{}); err != nil {
+		t.Errorf("Expected non-proto files to be skipped: %v", err)
+	}
+}
+
+func TestNotebookDiff(t *testing.T) {
+	before := `{"cells": [{"cell_type": "code", "source": "a = 1", "outputs": [{"text": "noise"}]}]}`
+	after := `{"cells": [{"cell_type": "code", "source": "a = 2", "outputs": []}]}`
+
+	rendered := diff.FormatDiff(notebookDiff(before, after), false)
+	if !strings.Contains(rendered, "a = 2") || strings.Contains(rendered, "noise") || strings.Contains(rendered, "outputs") {
+		t.Errorf("Expected a cell-level source diff:\n%s", rendered)
+	}
+	if !isNotebook(config.SyncItem{Target: config.SyncTarget{Path: "analysis.ipynb", Type: "file"}}) {
+		t.Error("Expected .ipynb files to be notebooks")
+	}
+}
+
+func TestSyncSection(t *testing.T) {
+	item := config.SyncItem{
+		Source: config.SyncSource{Owner: "acme", Repo: "tool", Path: "docs/README.md", Branch: "main"},
+		Target: config.SyncTarget{Path: "site/install.md", Type: "markdown", Section: "Install", LocalSection: "Installing the tool", RewriteLinks: "absolute"},
+	}
+	remote := "# Tool\n\n## Install\n\nSee [the guide](guide.md).\n\n## Usage\n"
+	local := "# Our docs\n\n## Installing the tool\n\nOutdated.\n\n## Next steps\n"
+
+	got, err := syncSection(item, local, remote)
+	if err != nil {
+		t.Fatalf("syncSection failed: %v", err)
+	}
+	want := "# Our docs\n\n## Install\n\nSee [the guide](https://github.com/acme/tool/blob/main/docs/guide.md).\n\n## Next steps\n"
+	if got != want {
+		t.Errorf("Unexpected result:\n%q\nwant:\n%q", got, want)
+	}
+
+	item.Target.RewriteLinks = "prefix"
+	item.Target.LinkPrefix = "/upstream/"
+	got, _ = syncSection(item, local, remote)
+	if !strings.Contains(got, "[the guide](/upstream/docs/guide.md)") {
+		t.Errorf("Expected prefixed link:\n%s", got)
+	}
+}
+
+func TestUpdatedOwners(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	if owners, err := updatedOwners([]string{"main.go"}); owners != nil || err != nil {
+		t.Errorf("Expected no owners without CODEOWNERS, got %v, %v", owners, err)
+	}
+
+	writeTestFile(t, ".github/CODEOWNERS", "* @acme/platform\n/docs/ @acme/docs\n")
+	owners, err := updatedOwners([]string{"docs/install.md", "../elsewhere/file.go", "Makefile"})
+	if err != nil {
+		t.Fatalf("updatedOwners failed: %v", err)
+	}
+	if strings.Join(owners, " ") != "@acme/docs @acme/platform" {
+		t.Errorf("Unexpected owners: %v", owners)
+	}
+}
+
+func TestConfigSecretsAreRedacted(t *testing.T) {
+	sm, err := NewSyncManager(&config.Config{
+		Version:     "1.0",
+		GitHubToken: "test-token-123",
+		Notifications: &config.NotificationsConfig{Notifiers: []config.NotifierConfig{
+			{Name: "hook", Type: "webhook", URL: "https://example.com/hooks/abcdef"},
+			{Name: "pager", Type: "pagerduty", URL: "https://events.example.com", Key: "routing-key-1"},
+		}},
+	}, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+
+	got := sm.Redactor().String("token test-token-123 failed posting to https://example.com/hooks/abcdef with routing-key-1 via https://events.example.com")
+	want := "token [REDACTED] failed posting to [REDACTED] with [REDACTED] via https://events.example.com"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestGitLabOnlyConfigNeedsNoGitHubToken(t *testing.T) {
+	cfg := &config.Config{
+		Version: "1.0",
+		Items: []config.SyncItem{{
+			Name:   "logger",
+			Source: config.SyncSource{Provider: "gitlab", Owner: "acme/platform", Repo: "utils", Path: "log.go"},
+			Target: config.SyncTarget{Path: "log.go", Type: "file"},
+		}},
+	}
+
+	sm, err := NewSyncManager(cfg, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	if _, ok := sm.source(cfg.Items[0]).(*gitlab.Client); !ok {
+		t.Errorf("Expected the GitLab client for a gitlab source")
+	}
+	bitbucketItem := cfg.Items[0]
+	bitbucketItem.Source.Provider = "bitbucket"
+	if _, ok := sm.source(bitbucketItem).(*bitbucket.Client); !ok {
+		t.Errorf("Expected the Bitbucket client for a bitbucket source")
+	}
+	giteaItem := cfg.Items[0]
+	giteaItem.Source.Provider = "gitea"
+	if _, ok := sm.source(giteaItem).(*gitea.Client); !ok {
+		t.Errorf("Expected the Gitea client for a gitea source")
+	}
+	gitItem := cfg.Items[0]
+	gitItem.Source.Provider = "git"
+	if _, ok := sm.source(gitItem).(*gitsource.Remote); !ok {
+		t.Errorf("Expected a git remote for a git source")
+	}
+	localItem := cfg.Items[0]
+	localItem.Source.Provider = "local"
+	if _, ok := sm.source(localItem).(*localsource.Client); !ok {
+		t.Errorf("Expected the local client for a local source")
+	}
+	gistItem := cfg.Items[0]
+	gistItem.Source.Provider = "gist"
+	if _, ok := sm.source(gistItem).(*github.Gists); !ok {
+		t.Errorf("Expected the gists of the GitHub client for a gist source")
+	}
+	if warnings, err := sm.CheckToken(); err != nil || len(warnings) != 0 {
+		t.Errorf("Expected no GitHub token check without GitHub sources, got %v, %v", warnings, err)
+	}
+
+	cfg.Items[0].Source.Provider = ""
+	if _, err := NewSyncManager(cfg, t.TempDir()); err == nil {
+		t.Error("Expected a GitHub token to be required for GitHub sources")
+	}
+}
+
+func TestGitHubEnterpriseClients(t *testing.T) {
+	cfg := &config.Config{Version: "1.0", GitHubToken: "test-token", GitHubBaseURL: "https://github.example.com"}
+	sm, err := NewSyncManager(cfg, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+
+	item := config.SyncItem{Source: config.SyncSource{Owner: "acme", Repo: "utils", Path: "log.go"}}
+	if sm.githubFor(item) != sm.githubClient {
+		t.Error("Expected the default client without an item URL")
+	}
+	item.Source.GitHubBaseURL = cfg.GitHubBaseURL
+	if sm.githubFor(item) != sm.githubClient {
+		t.Error("Expected the default client for the global URL")
+	}
+
+	item.Source.GitHubBaseURL = "https://ghe.other.example.com"
+	other := sm.githubFor(item)
+	if other == sm.githubClient || sm.githubFor(item) != other || sm.source(item) != other {
+		t.Error("Expected one client of its own for an item's instance")
+	}
+
+	cfg.GitHubBaseURL = "://bad"
+	if _, err := NewSyncManager(cfg, t.TempDir()); err == nil {
+		t.Error("Expected an invalid GitHub URL to fail")
+	}
+}
+
+func TestSetProvider(t *testing.T) {
+	t.Chdir(t.TempDir())
+	sm := newTestManager(t)
+	item := config.SyncItem{
+		Name:   "logger",
+		Source: config.SyncSource{Owner: "acme", Repo: "utils", Path: "log.go", Branch: "main"},
+		Target: config.SyncTarget{Path: "pkg/log.go", Type: "file"},
+	}
+	sm.config.Items = []config.SyncItem{item}
+	writeTestFile(t, item.Target.Path, "package old\n")
+	if err := sm.saveState(item.Name, State{CurrentLocalHash: calculateHash("package old\n")}); err != nil {
+		t.Fatalf("saveState failed: %v", err)
+	}
+
+	ctrl := gomock.NewController(t)
+	source := mocks.NewMockGitHubClient(ctrl)
+	source.EXPECT().GetCommitsSince("acme", "utils", "log.go", "main", time.Time{}, "").
+		Return([]github.CommitInfo{{SHA: "abc123", Message: "Add logger"}}, nil)
+	source.EXPECT().GetFile("acme", "utils", "log.go", "abc123").
+		Return(&github.FileInfo{Content: "package log\n", SHA: "f1", CommitID: "abc123"}, nil)
+	sm.SetProvider(config.ProviderGitHub, source)
+
+	report, err := sm.SyncItemByName("logger")
+	if err != nil || len(report.Errors) > 0 {
+		t.Fatalf("SyncItemByName failed: %v %v", err, report.Errors)
+	}
+	if got, _ := os.ReadFile(item.Target.Path); string(got) != "package log\n" {
+		t.Errorf("Expected the content from the provider, got %q", got)
+	}
+
+	sm.SetProvider(config.ProviderGitHub, nil)
+	if sm.source(item) != sm.githubClient {
+		t.Error("Expected the built-in client after removing the provider")
+	}
+}
+
+func TestWithProvider(t *testing.T) {
+	t.Chdir(t.TempDir())
+	item := functionItem("off")
+	local := "package util\n\nfunc TrimAll() {\n}\n"
+	writeTestFile(t, item.Target.Path, local)
+
+	ctrl := gomock.NewController(t)
+	source := mocks.NewMockGitHubClient(ctrl)
+	source.EXPECT().GetCommitsSince("acme", "utils", "strings.go", "main", time.Time{}, "").
+		Return([]github.CommitInfo{{SHA: "abc123", Message: "Trim more"}}, nil)
+	source.EXPECT().GetFile("acme", "utils", "strings.go", "abc123").
+		Return(&github.FileInfo{Content: "package upstream\n\nfunc TrimAll() {\n\treturn\n}\n", CommitID: "abc123"}, nil)
+	source.EXPECT().ExtractFunction(gomock.Any(), "go", "TrimAll").
+		Return("func TrimAll() {\n\treturn\n}", nil).AnyTimes()
+
+	// Replacing the GitHub provider lifts the need for a token
+	cfg := &config.Config{Version: "1.0", Items: []config.SyncItem{item}}
+	sm, err := NewSyncManager(cfg, t.TempDir(), WithProvider(config.ProviderGitHub, source))
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	if warnings, err := sm.CheckToken(); err != nil || len(warnings) > 0 {
+		t.Errorf("Expected no token check for a replaced provider, got %v %v", warnings, err)
+	}
+	if err := sm.saveState(item.Name, State{CurrentLocalHash: calculateHash(local)}); err != nil {
+		t.Fatalf("saveState failed: %v", err)
+	}
+
+	report, err := sm.SyncItemByName(item.Name)
+	if err != nil || len(report.Errors) > 0 {
+		t.Fatalf("SyncItemByName failed: %v %v", err, report.Errors)
+	}
+	if got, _ := os.ReadFile(item.Target.Path); !strings.Contains(string(got), "\treturn\n") {
+		t.Errorf("Expected the function from the provider, got %q", got)
+	}
+}
+
+func TestSetClockDrivesDigest(t *testing.T) {
+	var sent atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent.Add(1)
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		Version:     "1.0",
+		GitHubToken: "test-token",
+		Notifications: &config.NotificationsConfig{
+			Notifiers: []config.NotifierConfig{{Name: "hook", Type: "webhook", URL: server.URL}},
+			Digest:    &config.DigestConfig{Times: []string{"09:00"}},
+		},
+	}
+	sm, err := NewSyncManager(cfg, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+
+	report := &SyncReport{SyncItem: config.SyncItem{Name: "logger"}, UpdatedFiles: []string{"log.go"}}
+	if err := sm.notify([]*SyncReport{report}); err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+	if sent.Load() != 0 {
+		t.Fatalf("Expected the update to wait for the digest, got %d requests", sent.Load())
+	}
+
+	// A day later by the manager's clock, the digest is due
+	later := time.Now().Add(25 * time.Hour)
+	sm.SetClock(func() time.Time { return later })
+	if err := sm.notify(nil); err != nil {
+		t.Fatalf("notify failed: %v", err)
+	}
+	if sent.Load() != 1 {
+		t.Errorf("Expected the digest to be sent, got %d requests", sent.Load())
+	}
+}
+
+func TestSetClock(t *testing.T) {
+	t.Chdir(t.TempDir())
+	sm := newFailingManager(t, "logger")
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	sm.SetClock(func() time.Time { return now })
+
+	if _, err := sm.SyncItemByName("logger"); err != nil {
+		t.Fatalf("SyncItemByName failed: %v", err)
+	}
+	state, err := sm.loadState("logger")
+	if err != nil {
+		t.Fatalf("loadState failed: %v", err)
+	}
+	if !state.LastSync.Equal(now) {
+		t.Errorf("Expected the sync time from the clock, got %v", state.LastSync)
+	}
+
+	sm.SetClock(nil)
+	if time.Since(sm.Now()) > time.Minute {
+		t.Errorf("Expected the real time without a clock, got %v", sm.Now())
+	}
+}
+
+func TestCloseStopsPlugins(t *testing.T) {
+	dir := t.TempDir()
+	stopped := filepath.Join(dir, "stopped")
+	// Answers one JSON-RPC call, then records that stdin was closed
+	script := "#!/bin/sh\nread req\necho '{\"id\":0,\"result\":\"changed\",\"error\":null}'\ncat >/dev/null\ntouch " + stopped + "\n"
+	if err := os.WriteFile(filepath.Join(dir, plugin.BinaryPrefix+"header"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	item := functionItem("off")
+	item.Target.TransformPlugin = "header"
+	cfg := &config.Config{
+		Version:   "1.0",
+		PluginDir: dir,
+		Plugins:   []config.PluginConfig{{Name: "header", Kind: config.PluginTransform}},
+		Items:     []config.SyncItem{item},
+	}
+	sm, err := NewSyncManager(cfg, t.TempDir(), WithProvider(config.ProviderGitHub, mocks.NewMockGitHubClient(gomock.NewController(t))))
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	if got, err := sm.applyTransform(item, "original"); err != nil || got != "changed" {
+		t.Fatalf("Unexpected transform: %q, %v", got, err)
+	}
+
+	if err := sm.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if _, err := os.Stat(stopped); err != nil {
+		t.Errorf("Expected the plugin to be stopped: %v", err)
+	}
+}
+
+func TestResolveCredentials(t *testing.T) {
+	t.Setenv("TEST_GITLAB_TOKEN", "glpat-secret")
+	t.Setenv("TEST_GITEA_TOKEN", "gitea-secret")
+
+	cfg := &config.Config{
+		GiteaToken:        "configured",
+		GitLabTokenSecret: &config.SecretRef{Provider: "env", Name: "TEST_GITLAB_TOKEN"},
+		GiteaTokenSecret:  &config.SecretRef{Provider: "env", Name: "TEST_GITEA_TOKEN"},
+	}
+	if err := resolveCredentials(cfg); err != nil {
+		t.Fatalf("resolveCredentials failed: %v", err)
+	}
+	if cfg.GitLabToken != "glpat-secret" {
+		t.Errorf("Expected the GitLab token from the secret, got %q", cfg.GitLabToken)
+	}
+	if cfg.GiteaToken != "configured" {
+		t.Errorf("Expected the configured Gitea token to take precedence, got %q", cfg.GiteaToken)
+	}
+
+	cfg.BitbucketAppPasswordSecret = &config.SecretRef{Provider: "env", Name: "TEST_BITBUCKET_MISSING"}
+	if err := resolveCredentials(cfg); err == nil || !strings.Contains(err.Error(), "Bitbucket app password") {
+		t.Errorf("Expected a missing secret to fail, got %v", err)
+	}
+}
+
+func TestSharedFetches(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	source := config.SyncSource{Owner: "acme", Repo: "utils", Path: "retry.go", Branch: "main"}
+	items := []config.SyncItem{
+		{Name: "api", Source: source, Target: config.SyncTarget{Path: "api/retry.go", Type: "file"}},
+		{Name: "worker", Source: source, Target: config.SyncTarget{Path: "worker/retry.go", Type: "file"}},
+	}
+
+	// Both items read the file at the same commit, which is fetched once
+	mock := mocks.NewMockGitHubClient(gomock.NewController(t))
+	mock.EXPECT().GetCommitsSince("acme", "utils", "retry.go", "main", time.Time{}, "").
+		Return([]github.CommitInfo{{SHA: "c1"}}, nil).Times(2)
+	mock.EXPECT().GetFile("acme", "utils", "retry.go", "c1").
+		Return(&github.FileInfo{Content: "package retry\n"}, nil).Times(1)
+
+	sm, err := NewSyncManager(&config.Config{Version: "1.0", Items: items}, t.TempDir(), WithProvider(config.ProviderGitHub, mock))
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	for _, item := range items {
+		writeTestFile(t, item.Target.Path, "package retry // old\n")
+		_, hash, err := sm.checkLocalChanges(item, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sm.saveState(item.Name, State{CurrentLocalHash: hash}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reports, err := sm.SyncAll()
+	if err != nil {
+		t.Fatalf("SyncAll failed: %v", err)
+	}
+	for _, report := range reports {
+		if len(report.Errors) > 0 {
+			t.Fatalf("%s failed: %v", report.SyncItem.Name, report.Errors)
+		}
+		if content, _ := os.ReadFile(report.SyncItem.Target.Path); string(content) != "package retry\n" {
+			t.Errorf("Expected %s to be written, got %q", report.SyncItem.Target.Path, content)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package sync
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/terraform"
+)
+
+// vendorModule copies the Terraform module at the pinned revision into the
+// target directory, replacing the previous copy, then points the configured
+// module blocks at it. A changed required_version is reported as a warning.
+func (sm *SyncManager) vendorModule(item config.SyncItem, ref string, report *SyncReport) error {
+	files, err := sm.getDirectory(item, ref)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("Failed to fetch module: %v", err))
+		return err
+	}
+
+	prefix := path.Clean(item.Source.Path) + "/"
+	upstream := make(map[string]string)
+	for filePath, info := range files {
+		upstream[strings.TrimPrefix(filePath, prefix)] = info.Content
+	}
+
+	absPath, err := item.Target.GetAbsolutePath("")
+	if err != nil {
+		return err
+	}
+	local, err := readTree(absPath)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("Failed to read vendored module: %v", err))
+		return err
+	}
+	local = withoutChangelog(item, local)
+
+	before, after := terraform.RequiredVersions(local), terraform.RequiredVersions(upstream)
+	if len(local) > 0 && strings.Join(before, ", ") != strings.Join(after, ", ") {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("required_version changed from %s to %s", constraintList(before), constraintList(after)))
+	}
+
+	// The copy is journaled; rewritten module blocks are not
+	journal := &Journal{Item: item.Name, CommitID: ref, Root: absPath}
+	for _, name := range sortedNames(upstream) {
+		content, ok := local[name]
+		if ok && content == upstream[name] {
+			continue
+		}
+		journal.Writes = append(journal.Writes, JournalWrite{
+			Path:     filepath.Join(absPath, filepath.FromSlash(name)),
+			Content:  []byte(upstream[name]),
+			Previous: []byte(content),
+			Existed:  ok,
+		})
+		report.UpdatedFiles = append(report.UpdatedFiles, filepath.Join(item.Target.Path, filepath.FromSlash(name)))
+	}
+	for _, name := range sortedNames(local) {
+		if _, ok := upstream[name]; ok {
+			continue
+		}
+		journal.Writes = append(journal.Writes, JournalWrite{
+			Path:     filepath.Join(absPath, filepath.FromSlash(name)),
+			Remove:   true,
+			Previous: []byte(local[name]),
+			Existed:  true,
+		})
+		report.UpdatedFiles = append(report.UpdatedFiles, filepath.Join(item.Target.Path, filepath.FromSlash(name)))
+	}
+	if err := sm.writeJournaled(journal); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("Failed to vendor module: %v", err))
+		return err
+	}
+
+	if err := rewriteModuleSources(sm.files, item, absPath, report); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("Failed to rewrite module sources: %v", err))
+		return err
+	}
+	return nil
+}
+
+// rewriteModuleSources points module blocks that use the upstream module, by
+// its GitHub address or one of the configured aliases, at the vendored copy
+func rewriteModuleSources(files *workspaceFiles, item config.SyncItem, vendorDir string, report *SyncReport) error {
+	match := func(source string) bool {
+		if s, ok := terraform.ParseGitHubSource(source); ok {
+			return s.Matches(item.Source.Owner, item.Source.Repo, item.Source.Path)
+		}
+		for _, alias := range item.Target.Terraform.Sources {
+			if source == alias {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, pattern := range item.Target.Terraform.Rewrite {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		for _, file := range matches {
+			absFile, err := filepath.Abs(file)
+			if err != nil {
+				return err
+			}
+			// Files inside the vendored module belong to upstream
+			if strings.HasPrefix(absFile, vendorDir+string(filepath.Separator)) {
+				continue
+			}
+
+			content, err := files.readFile(absFile)
+			if err != nil {
+				return err
+			}
+			updated, n := terraform.RewriteSources(string(content), match, localModulePath(filepath.Dir(absFile), vendorDir))
+			if n == 0 {
+				continue
+			}
+			if err := files.writeFile(absFile, []byte(updated), 0644); err != nil {
+				return err
+			}
+			report.UpdatedFiles = append(report.UpdatedFiles, file)
+		}
+	}
+	return nil
+}
+
+// localModulePath returns the module source for dir as seen from a file in
+// from. Terraform only treats sources starting with ./ or ../ as local paths.
+func localModulePath(from, dir string) string {
+	rel, err := filepath.Rel(from, dir)
+	if err != nil {
+		return filepath.ToSlash(dir)
+	}
+	rel = filepath.ToSlash(rel)
+	if !strings.HasPrefix(rel, "../") {
+		rel = "./" + rel
+	}
+	return rel
+}
+
+// readTree returns the files under a directory by slash-separated relative
+// path. A missing directory has no files.
+func readTree(dir string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(content)
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	return files, err
+}
+
+func constraintList(constraints []string) string {
+	if len(constraints) == 0 {
+		return "none"
+	}
+	return `"` + strings.Join(constraints, `", "`) + `"`
+}
+
+func sortedNames(files map[string]string) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
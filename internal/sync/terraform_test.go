@@ -0,0 +1,62 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+func TestRewriteModuleSources(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	writeTestFile(t, "envs/prod/main.tf", `module "vpc" {
+  source  = "acme/vpc/aws"
+  version = "1.2.0"
+}
+`)
+	writeTestFile(t, "envs/dev/main.tf", `module "vpc" {
+  source = "git::https://github.com/acme/modules.git//vpc?ref=v1.1.0"
+}
+`)
+	writeTestFile(t, "vendor/vpc/main.tf", `module "subnet" {
+  source = "github.com/acme/modules//vpc"
+}
+`)
+
+	item := config.SyncItem{
+		Source: config.SyncSource{Owner: "acme", Repo: "modules", Path: "vpc", Revision: "v1.2.0"},
+		Target: config.SyncTarget{
+			Path: "vendor/vpc",
+			Type: "directory",
+			Terraform: &config.TerraformConfig{
+				Rewrite: []string{"envs/*/*.tf", "vendor/vpc/*.tf"},
+				Sources: []string{"acme/vpc/aws"},
+			},
+		},
+	}
+
+	report := &SyncReport{}
+	if err := rewriteModuleSources(&workspaceFiles{}, item, filepath.Join(dir, "vendor", "vpc"), report); err != nil {
+		t.Fatalf("rewriteModuleSources failed: %v", err)
+	}
+	if len(report.UpdatedFiles) != 2 {
+		t.Errorf("Expected two rewritten files, got %v", report.UpdatedFiles)
+	}
+
+	prod, _ := os.ReadFile("envs/prod/main.tf")
+	if string(prod) != "module \"vpc\" {\n  source  = \"../../vendor/vpc\"\n}\n" {
+		t.Errorf("Unexpected prod config:\n%s", prod)
+	}
+	dev, _ := os.ReadFile("envs/dev/main.tf")
+	if !strings.Contains(string(dev), `source = "../../vendor/vpc"`) {
+		t.Errorf("Unexpected dev config:\n%s", dev)
+	}
+	vendored, _ := os.ReadFile("vendor/vpc/main.tf")
+	if !strings.Contains(string(vendored), "github.com/acme/modules//vpc") {
+		t.Error("Expected the vendored module to be left alone")
+	}
+}
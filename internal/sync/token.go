@@ -0,0 +1,162 @@
+package sync
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+)
+
+// tokenInspector is a SourceProvider that can report what its token may
+// access, as the built-in GitHub client does
+type tokenInspector interface {
+	TokenScopes() ([]string, bool, error)
+	GetRepository(owner, repo string) (*github.RepositoryInfo, error)
+}
+
+// inspector returns the provider of an item that uses the GitHub token
+func (sm *SyncManager) inspector(item config.SyncItem) tokenInspector {
+	return sm.source(item).(tokenInspector)
+}
+
+// CheckToken verifies that the GitHub token can read every configured
+// source. It fails with a hint about the missing permission when a source
+// can't be seen, and returns warnings for scopes the config doesn't need.
+// codesync only reads from GitHub, so any write scope is more than it needs.
+// Sources on other GitHub Enterprise instances are checked against their own
+// instance, whose findings are prefixed with its host.
+func (sm *SyncManager) CheckToken() ([]string, error) {
+	var inspectors []tokenInspector
+	groups := make(map[tokenInspector][]config.SyncItem)
+	for _, item := range sm.Items() {
+		if item.Disabled || !sm.fromGitHub(item) {
+			continue
+		}
+		inspector := sm.inspector(item)
+		if _, ok := groups[inspector]; !ok {
+			inspectors = append(inspectors, inspector)
+		}
+		groups[inspector] = append(groups[inspector], item)
+	}
+
+	var warnings []string
+	for _, inspector := range inspectors {
+		items := groups[inspector]
+		found, err := checkAccess(inspector, items)
+
+		prefix := ""
+		if len(inspectors) > 1 {
+			prefix = sm.githubHost(items[0]) + ": "
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s%w", prefix, err)
+		}
+		for _, warning := range found {
+			warnings = append(warnings, prefix+warning)
+		}
+	}
+	return warnings, nil
+}
+
+// githubHost names the GitHub instance an item's source is on
+func (sm *SyncManager) githubHost(item config.SyncItem) string {
+	if u, err := url.Parse(item.Source.GitHubBaseURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return sm.config.GitHubHost()
+}
+
+// checkAccess checks the token of one GitHub instance against the sources of
+// the items on it
+func checkAccess(inspector tokenInspector, items []config.SyncItem) ([]string, error) {
+	scopes, classic, err := inspector.TokenScopes()
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	private := false
+	owners := make(map[string]bool)
+	checked := make(map[string]bool)
+	for _, item := range items {
+		source := item.Source.Owner + "/" + item.Source.Repo
+		if checked[source] {
+			continue
+		}
+		checked[source] = true
+		owners[item.Source.Owner] = true
+
+		repo, err := inspector.GetRepository(item.Source.Owner, item.Source.Repo)
+		if err != nil {
+			return nil, err
+		}
+		if repo == nil {
+			missing = append(missing, source)
+			continue
+		}
+		if repo.Private {
+			private = true
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("token cannot read %s: %s", strings.Join(missing, ", "), accessHint(classic, scopes, owners))
+	}
+	if !classic {
+		return nil, nil
+	}
+	return excessScopes(scopes, private), nil
+}
+
+// accessHint suggests why a token can't see a repository
+func accessHint(classic bool, scopes []string, owners map[string]bool) string {
+	if classic {
+		if !hasScope(scopes, "repo") {
+			return "private repositories need a token with the repo scope"
+		}
+		return "check that the token's user can access the repository and, for organizations using SSO, that the token is authorized for them"
+	}
+
+	hint := "add the repository to the token's repository access with Contents: read-only"
+	if len(owners) > 1 {
+		names := make([]string, 0, len(owners))
+		for owner := range owners {
+			names = append(names, owner)
+		}
+		sort.Strings(names)
+		hint += fmt.Sprintf("; fine-grained tokens only cover one owner but sources span %s, so use a classic token with the repo scope", strings.Join(names, ", "))
+	}
+	return hint
+}
+
+// excessScopes returns warnings for classic token scopes the config doesn't
+// need. The repo scope is only needed for private sources.
+func excessScopes(scopes []string, private bool) []string {
+	var warnings, extra []string
+	for _, scope := range scopes {
+		switch {
+		case scope == "repo" && private:
+		case scope == "repo":
+			warnings = append(warnings, "token has the repo scope but every source is public; a token with no scopes is enough")
+		default:
+			extra = append(extra, scope)
+		}
+	}
+
+	if len(extra) > 0 {
+		warnings = append(warnings, fmt.Sprintf("token has scopes codesync doesn't use: %s", strings.Join(extra, ", ")))
+	}
+	return warnings
+}
+
+func hasScope(scopes []string, name string) bool {
+	for _, scope := range scopes {
+		if scope == name {
+			return true
+		}
+	}
+	return false
+}
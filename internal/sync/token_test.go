@@ -0,0 +1,102 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+)
+
+func TestExcessScopes(t *testing.T) {
+	if warnings := excessScopes([]string{"repo"}, true); len(warnings) != 0 {
+		t.Errorf("Expected repo scope to be needed for private sources, got %v", warnings)
+	}
+	if warnings := excessScopes(nil, false); len(warnings) != 0 {
+		t.Errorf("Expected no warnings for a token without scopes, got %v", warnings)
+	}
+
+	warnings := excessScopes([]string{"repo", "workflow", "admin:org"}, false)
+	if len(warnings) != 2 {
+		t.Fatalf("Expected two warnings, got %v", warnings)
+	}
+	if !strings.Contains(warnings[0], "every source is public") {
+		t.Errorf("Expected a warning about the repo scope, got %q", warnings[0])
+	}
+	if !strings.HasSuffix(warnings[1], "workflow, admin:org") {
+		t.Errorf("Expected unused scopes to be listed, got %q", warnings[1])
+	}
+}
+
+func TestAccessHint(t *testing.T) {
+	one := map[string]bool{"acme": true}
+	two := map[string]bool{"acme": true, "globex": true}
+
+	if hint := accessHint(true, []string{"read:org"}, one); !strings.Contains(hint, "repo scope") {
+		t.Errorf("Expected classic tokens without repo to be told to add it, got %q", hint)
+	}
+	if hint := accessHint(true, []string{"repo"}, one); !strings.Contains(hint, "SSO") {
+		t.Errorf("Expected an SSO hint for classic tokens with repo, got %q", hint)
+	}
+	if hint := accessHint(false, nil, one); strings.Contains(hint, "one owner") {
+		t.Errorf("Didn't expect an owner hint for a single owner, got %q", hint)
+	}
+	if hint := accessHint(false, nil, two); !strings.Contains(hint, "acme, globex") {
+		t.Errorf("Expected fine-grained tokens spanning owners to be flagged, got %q", hint)
+	}
+}
+
+func TestCheckTokenPerInstance(t *testing.T) {
+	// A GitHub Enterprise instance whose token sees acme/utils with the repo scope
+	instance := func(status int) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-OAuth-Scopes", "repo")
+			switch {
+			case status != http.StatusOK:
+				w.WriteHeader(status)
+				fmt.Fprint(w, `{"message": "Bad credentials"}`)
+			case r.URL.Path == "/api/v3/user":
+				fmt.Fprint(w, `{"login": "octocat"}`)
+			case r.URL.Path == "/api/v3/repos/acme/utils":
+				fmt.Fprint(w, `{"name": "utils", "private": true, "owner": {"login": "acme"}}`)
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+	}
+	good, bad := instance(http.StatusOK), instance(http.StatusUnauthorized)
+	defer good.Close()
+	defer bad.Close()
+
+	item := func(name, baseURL string) config.SyncItem {
+		return config.SyncItem{
+			Name:   name,
+			Source: config.SyncSource{Owner: "acme", Repo: "utils", Path: "log.go", GitHubBaseURL: baseURL},
+			Target: config.SyncTarget{Path: "log.go", Type: "file"},
+		}
+	}
+	cfg := &config.Config{
+		Version:       "1.0",
+		GitHubToken:   "test-token",
+		GitHubBaseURL: good.URL,
+		Items:         []config.SyncItem{item("logger", "")},
+	}
+	sm, err := NewSyncManager(cfg, t.TempDir())
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	if warnings, err := sm.CheckToken(); err != nil || len(warnings) != 0 {
+		t.Errorf("Expected a private source to need the repo scope, got %v %v", warnings, err)
+	}
+
+	// An item on another instance is checked with that instance's client
+	sm.SetItems(append(cfg.Items, item("other", bad.URL)))
+	_, err = sm.CheckToken()
+	if !errors.Is(err, github.ErrBadCredentials) || !strings.HasPrefix(err.Error(), strings.TrimPrefix(bad.URL, "http://")+": ") {
+		t.Errorf("Expected the other instance's token to be rejected, got %v", err)
+	}
+}
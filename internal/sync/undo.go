@@ -0,0 +1,275 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+// undoDir holds, per item, what undoing its last sync restores: a record of
+// the sync and the content it replaced, stored by SHA-256
+const undoDir = "undo"
+
+// UndoRecord is what the last sync of an item that changed files replaced
+type UndoRecord struct {
+	Item     string     `json:"item"`
+	Synced   time.Time  `json:"synced"`
+	CommitID string     `json:"commitId"`           // Upstream commit the sync applied
+	State    State      `json:"state"`              // Before the sync
+	Snapshot string     `json:"snapshot,omitempty"` // SHA-256 of the stored snapshot chain before the sync, if there was one
+	Files    []UndoFile `json:"files"`
+}
+
+// UndoFile is a file a sync wrote or deleted
+type UndoFile struct {
+	Path     string `json:"path"`               // As the sync reported it
+	Previous string `json:"previous,omitempty"` // SHA-256 of the content before the sync; empty if the sync created the file
+	Written  string `json:"written,omitempty"`  // SHA-256 of the content after the sync; empty if the sync deleted the file
+}
+
+// undoRecordName returns the store name of an item's undo record
+func undoRecordName(itemName string) string {
+	return filepath.Join(undoDir, sanitizeFilename(itemName), "last.json")
+}
+
+// undoObjectName returns the store name of content kept to undo a sync
+func undoObjectName(itemName, hash string) string {
+	return filepath.Join(undoDir, sanitizeFilename(itemName), hash)
+}
+
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// undoCapture is what a sync of an item may replace, read before it runs
+type undoCapture struct {
+	state    State
+	snapshot []byte            // Stored snapshot chain, nil if there is none
+	files    map[string][]byte // Existing target files, by absolute path
+}
+
+// captureUndo reads what a sync of an item may replace: its stored state and
+// snapshot, and the files it may write
+func (sm *SyncManager) captureUndo(item config.SyncItem, state State) (*undoCapture, error) {
+	capture := &undoCapture{files: make(map[string][]byte)}
+
+	stored, err := sm.loadState(item.Name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	capture.state = stored
+	if capture.snapshot, err = sm.store.read(snapshotName(item.Name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	paths, err := syncedFiles(item, state)
+	if err != nil {
+		return nil, err
+	}
+	if item.Changelog {
+		paths = append(paths, changelogPath(item))
+	}
+	for _, path := range paths {
+		content, err := sm.files.readFile(filepath.FromSlash(path))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		capture.files[absPath(filepath.FromSlash(path))] = content
+	}
+	return capture, nil
+}
+
+// saveUndo records what a sync replaced, so that Rollback can restore it. It
+// replaces the record of the sync before.
+func (sm *SyncManager) saveUndo(item config.SyncItem, capture *undoCapture, commitID string, report *SyncReport) error {
+	record := &UndoRecord{Item: item.Name, Synced: sm.Now(), CommitID: commitID, State: capture.state}
+	objects := make(map[string][]byte)
+
+	paths := report.UpdatedFiles
+	if item.Changelog {
+		paths = append(paths[:len(paths):len(paths)], changelogPath(item))
+	}
+	for _, path := range paths {
+		file := UndoFile{Path: path}
+		if previous, ok := capture.files[absPath(path)]; ok {
+			file.Previous = contentHash(previous)
+			objects[file.Previous] = previous
+		}
+		current, err := sm.files.readFile(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if err == nil {
+			file.Written = contentHash(current)
+		}
+		if file.Written != file.Previous {
+			record.Files = append(record.Files, file)
+		}
+	}
+	if len(record.Files) == 0 {
+		return nil
+	}
+	if capture.snapshot != nil {
+		record.Snapshot = contentHash(capture.snapshot)
+		objects[record.Snapshot] = capture.snapshot
+	}
+
+	old, err := sm.loadUndo(item.Name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for hash, content := range objects {
+		if err := sm.store.write(undoObjectName(item.Name, hash), content); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal undo record: %w", err)
+	}
+	if err := sm.store.write(undoRecordName(item.Name), data); err != nil {
+		return err
+	}
+
+	// Content only the replaced record kept isn't needed anymore
+	if old != nil {
+		for _, hash := range old.objects() {
+			if _, ok := objects[hash]; ok {
+				continue
+			}
+			if err := sm.store.remove(undoObjectName(item.Name, hash)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// objects returns the hashes of the content a record keeps
+func (r *UndoRecord) objects() []string {
+	var hashes []string
+	if r.Snapshot != "" {
+		hashes = append(hashes, r.Snapshot)
+	}
+	for _, file := range r.Files {
+		if file.Previous != "" {
+			hashes = append(hashes, file.Previous)
+		}
+	}
+	return hashes
+}
+
+func (sm *SyncManager) loadUndo(itemName string) (*UndoRecord, error) {
+	data, err := sm.store.read(undoRecordName(itemName))
+	if err != nil {
+		return nil, err
+	}
+	var record UndoRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("invalid undo record: %w", err)
+	}
+	return &record, nil
+}
+
+// Rollback undoes the last sync of an item that changed files: the files it
+// wrote or deleted get their previous content back, and the item its previous
+// state and snapshot, so the next sync applies the upstream change again.
+// Files changed since that sync aren't overwritten; it fails naming them
+// instead. Only the last sync can be undone, once. It returns the restored
+// files.
+func (sm *SyncManager) Rollback(itemName string) ([]string, error) {
+	item, ok := sm.Item(itemName)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownItem, itemName)
+	}
+	record, err := sm.loadUndo(itemName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s has no sync to undo", itemName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read undo record: %w", err)
+	}
+
+	var changed []string
+	for _, file := range record.Files {
+		current, err := sm.files.readFile(file.Path)
+		hash := ""
+		if err == nil {
+			hash = contentHash(current)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if hash != file.Written {
+			changed = append(changed, file.Path)
+		}
+	}
+	if len(changed) > 0 {
+		return nil, fmt.Errorf("%s changed since the sync was made, so undoing it would lose those changes", strings.Join(changed, ", "))
+	}
+
+	// Everything is read before anything is written
+	contents := make(map[string][]byte)
+	for _, hash := range record.objects() {
+		content, err := sm.store.read(undoObjectName(itemName, hash))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read kept content: %w", err)
+		}
+		if contentHash(content) != hash {
+			return nil, fmt.Errorf("kept content %s is corrupt", hash)
+		}
+		contents[hash] = content
+	}
+
+	root := absPath(item.Target.Path)
+	var restored []string
+	for _, file := range record.Files {
+		if file.Previous == "" {
+			if err := sm.files.remove(file.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return restored, err
+			}
+			sm.files.removeEmptyDirs(filepath.Dir(absPath(file.Path)), root)
+		} else {
+			if err := sm.files.mkdirAll(filepath.Dir(file.Path), 0755); err != nil {
+				return restored, err
+			}
+			if err := sm.files.writeFile(file.Path, contents[file.Previous], 0644); err != nil {
+				return restored, err
+			}
+		}
+		restored = append(restored, file.Path)
+	}
+
+	if record.Snapshot != "" {
+		if err := sm.store.write(snapshotName(itemName), contents[record.Snapshot]); err != nil {
+			return restored, err
+		}
+	} else if err := sm.store.remove(snapshotName(itemName)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return restored, err
+	}
+	if err := sm.saveState(itemName, record.State); err != nil {
+		return restored, err
+	}
+
+	// Undoing twice would restore the same content over itself
+	for _, hash := range record.objects() {
+		if err := sm.store.remove(undoObjectName(itemName, hash)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return restored, err
+		}
+	}
+	if err := sm.store.remove(undoRecordName(itemName)); err != nil {
+		return restored, err
+	}
+	return restored, nil
+}
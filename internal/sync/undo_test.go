@@ -0,0 +1,87 @@
+package sync
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/github"
+	"github.com/exitflynn/codesync/mocks"
+	"go.uber.org/mock/gomock"
+)
+
+func TestRollback(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	item := config.SyncItem{
+		Name:      "lib",
+		Source:    config.SyncSource{Owner: "acme", Repo: "lib", Path: "lib.go", Branch: "main"},
+		Target:    config.SyncTarget{Path: "vendor/lib.go", Type: "file"},
+		Changelog: true,
+	}
+	mock := mocks.NewMockGitHubClient(gomock.NewController(t))
+	mock.EXPECT().GetCommitsSince("acme", "lib", "lib.go", "main", time.Time{}, "c1").
+		Return([]github.CommitInfo{{SHA: "c2"}}, nil)
+	mock.EXPECT().GetFile("acme", "lib", "lib.go", "c2").
+		Return(&github.FileInfo{Content: "package lib // new\n"}, nil)
+
+	cfg := &config.Config{Version: "1.0", Items: []config.SyncItem{item}}
+	sm, err := NewSyncManager(cfg, t.TempDir(), WithProvider(config.ProviderGitHub, mock))
+	if err != nil {
+		t.Fatalf("NewSyncManager failed: %v", err)
+	}
+	writeTestFile(t, "vendor/lib.go", "package lib // old\n")
+	_, hash, err := sm.checkLocalChanges(item, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.saveState(item.Name, State{LastCommitID: "c1", CurrentLocalHash: hash}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.saveSnapshot(item.Name, "package lib // old\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sm.Rollback(item.Name); err == nil {
+		t.Error("Expected an item that hasn't synced to have nothing to undo")
+	}
+	if report, err := sm.SyncItem(item); err != nil || len(report.Errors) > 0 {
+		t.Fatalf("SyncItem failed: %v, %v", err, report.Errors)
+	}
+
+	// A file changed since the sync isn't overwritten
+	writeTestFile(t, "vendor/lib.go", "package lib // edited\n")
+	if _, err := sm.Rollback(item.Name); err == nil || !strings.Contains(err.Error(), "vendor/lib.go") {
+		t.Errorf("Expected the edited file to stop the undo, got %v", err)
+	}
+	writeTestFile(t, "vendor/lib.go", "package lib // new\n")
+
+	restored, err := sm.Rollback(item.Name)
+	if err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if len(restored) != 2 {
+		t.Errorf("Expected the target and changelog to be restored, got %v", restored)
+	}
+	if content, _ := os.ReadFile("vendor/lib.go"); string(content) != "package lib // old\n" {
+		t.Errorf("Expected the previous content back, got %q", content)
+	}
+	if _, err := os.Stat("vendor/" + changelogName); !os.IsNotExist(err) {
+		t.Errorf("Expected the changelog the sync created to be removed, got %v", err)
+	}
+	if state, err := sm.loadState(item.Name); err != nil || state.LastCommitID != "c1" {
+		t.Errorf("Expected the previous state back, got %+v, %v", state, err)
+	}
+	if snapshot, err := sm.loadSnapshot(item.Name); err != nil || snapshot != "package lib // old\n" {
+		t.Errorf("Expected the previous snapshot back, got %q, %v", snapshot, err)
+	}
+
+	if _, err := sm.Rollback(item.Name); err == nil {
+		t.Error("Expected a sync to be undone only once")
+	}
+	if entries, _ := os.ReadDir(sm.store.path(undoDir + "/lib")); len(entries) != 0 {
+		t.Errorf("Expected the kept content to be removed, got %v", entries)
+	}
+}
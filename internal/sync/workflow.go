@@ -0,0 +1,36 @@
+package sync
+
+import (
+	"fmt"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/workflow"
+)
+
+// keptPaths returns the workflow keys whose local values survive a sync
+func keptPaths(item config.SyncItem) []string {
+	if len(item.Target.Keep) > 0 {
+		return item.Target.Keep
+	}
+	return workflow.DefaultKeep
+}
+
+// syncWorkflow validates an upstream workflow and applies the local
+// overrides of the kept keys to it
+func syncWorkflow(item config.SyncItem, local, remote string) (string, error) {
+	if err := workflow.Validate([]byte(remote)); err != nil {
+		return "", err
+	}
+	if local == "" {
+		return remote, nil
+	}
+
+	merged, err := workflow.Merge([]byte(local), []byte(remote), keptPaths(item))
+	if err != nil {
+		return "", err
+	}
+	if err := workflow.Validate(merged); err != nil {
+		return "", fmt.Errorf("local overrides: %w", err)
+	}
+	return string(merged), nil
+}
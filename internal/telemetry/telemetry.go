@@ -0,0 +1,96 @@
+// Package telemetry reports anonymous, aggregate usage to help decide what to
+// work on next. It is off unless a config enables it with an endpoint, and
+// only ever sends counts: never item names, paths, repositories or content.
+package telemetry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/exitflynn/codesync/internal/config"
+	"github.com/exitflynn/codesync/internal/version"
+)
+
+// Usage is the report sent after each run
+type Usage struct {
+	Version   string         `json:"version"`
+	OS        string         `json:"os"`
+	Arch      string         `json:"arch"`
+	Items     int            `json:"items"`
+	ItemTypes map[string]int `json:"itemTypes"`           // By target type
+	Languages map[string]int `json:"languages,omitempty"` // Of function targets
+	Providers map[string]int `json:"providers"`           // By source provider; all plugins count as "plugin"
+	Errors    map[string]int `json:"errors,omitempty"`    // Failed items by failure category
+}
+
+// Collect counts the enabled items of a config
+func Collect(items []config.SyncItem) *Usage {
+	usage := &Usage{
+		Version:   version.Version,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		ItemTypes: make(map[string]int),
+		Languages: make(map[string]int),
+		Providers: make(map[string]int),
+		Errors:    make(map[string]int),
+	}
+	for _, item := range items {
+		if item.Disabled {
+			continue
+		}
+		usage.Items++
+		usage.ItemTypes[item.Target.Type]++
+		// Plugin names are chosen by users, so they are never sent
+		provider := item.Source.ProviderName()
+		if !config.BuiltinProvider(provider) {
+			provider = "plugin"
+		}
+		usage.Providers[provider]++
+		if item.Target.Language != "" {
+			usage.Languages[item.Target.Language]++
+		}
+	}
+	return usage
+}
+
+// AddError counts a failed item
+func (u *Usage) AddError(category string) {
+	u.Errors[category]++
+}
+
+// Enabled reports whether usage is sent: the config has to opt in, and the
+// DO_NOT_TRACK convention always opts out
+func Enabled(cfg *config.TelemetryConfig) bool {
+	if cfg == nil || !cfg.Enabled || cfg.Endpoint == "" {
+		return false
+	}
+	if v := os.Getenv("DO_NOT_TRACK"); v != "" && v != "0" {
+		return false
+	}
+	return true
+}
+
+// Send posts a usage report to an endpoint
+func Send(endpoint string, usage *Usage) error {
+	body, err := json.Marshal(usage)
+	if err != nil {
+		return fmt.Errorf("error encoding usage: %w", err)
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error sending usage: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("error sending usage: received status code %d", resp.StatusCode)
+	}
+	return nil
+}
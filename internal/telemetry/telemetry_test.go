@@ -0,0 +1,71 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/exitflynn/codesync/internal/config"
+)
+
+func TestCollect(t *testing.T) {
+	usage := Collect([]config.SyncItem{
+		{Name: "secret-name", Source: config.SyncSource{Owner: "acme"}, Target: config.SyncTarget{Type: "function", Language: "go"}},
+		{Source: config.SyncSource{Provider: "gitlab"}, Target: config.SyncTarget{Type: "file"}},
+		{Source: config.SyncSource{Provider: "acme-internal-forge"}, Target: config.SyncTarget{Type: "file"}},
+		{Disabled: true, Target: config.SyncTarget{Type: "directory"}},
+	})
+	usage.AddError("transient")
+
+	if usage.Items != 3 || usage.ItemTypes["function"] != 1 || usage.ItemTypes["directory"] != 0 {
+		t.Errorf("Unexpected item counts: %+v", usage)
+	}
+	if usage.Languages["go"] != 1 || usage.Providers["github"] != 1 || usage.Providers["gitlab"] != 1 || usage.Providers["plugin"] != 1 || usage.Providers["acme-internal-forge"] != 0 {
+		t.Errorf("Unexpected language or provider counts: %+v", usage)
+	}
+	if usage.Errors["transient"] != 1 {
+		t.Errorf("Unexpected error counts: %+v", usage.Errors)
+	}
+}
+
+func TestEnabled(t *testing.T) {
+	t.Setenv("DO_NOT_TRACK", "")
+	if Enabled(nil) || Enabled(&config.TelemetryConfig{Endpoint: "https://example.com"}) {
+		t.Error("Expected telemetry to be off unless enabled")
+	}
+	cfg := &config.TelemetryConfig{Enabled: true, Endpoint: "https://example.com"}
+	if !Enabled(cfg) {
+		t.Error("Expected telemetry to be on when enabled")
+	}
+	t.Setenv("DO_NOT_TRACK", "1")
+	if Enabled(cfg) {
+		t.Error("Expected DO_NOT_TRACK to turn telemetry off")
+	}
+}
+
+func TestSend(t *testing.T) {
+	var got Usage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	usage := Collect([]config.SyncItem{{Target: config.SyncTarget{Type: "file"}}})
+	if err := Send(server.URL, usage); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if got.Items != 1 || got.ItemTypes["file"] != 1 || got.Version != usage.Version {
+		t.Errorf("Unexpected report: %+v", got)
+	}
+
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	if err := Send(server.URL, usage); err == nil {
+		t.Error("Expected a rejected report to fail")
+	}
+}
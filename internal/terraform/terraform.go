@@ -0,0 +1,181 @@
+// Package terraform rewrites module sources in Terraform configurations and
+// reads their version constraints. It scans HCL line by line, which is enough
+// for the attributes it cares about without a full parser.
+package terraform
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	moduleBlockPattern     = regexp.MustCompile(`^\s*module\s+"[^"]*"\s*\{\s*$`)
+	terraformBlockPattern  = regexp.MustCompile(`^\s*terraform\s*\{\s*$`)
+	sourcePattern          = regexp.MustCompile(`^(\s*source\s*=\s*)"([^"]*)"(.*)$`)
+	versionPattern         = regexp.MustCompile(`^\s*version\s*=`)
+	requiredVersionPattern = regexp.MustCompile(`^\s*required_version\s*=\s*"([^"]*)"`)
+
+	// GitHub module addresses: github.com/o/r, git::https://github.com/o/r.git
+	// and git@github.com:o/r.git, each with an optional //subdir and ?ref=
+	githubSourcePattern = regexp.MustCompile(`^(?:git::)?(?:https://|ssh://git@|git@)?github\.com[/:]([^/]+)/([^/?]+?)(?:\.git)?(?://([^?]*))?(?:\?.*)?$`)
+)
+
+// GitHubSource is a module address pointing at a GitHub repository
+type GitHubSource struct {
+	Owner  string
+	Repo   string
+	Subdir string // Directory of the module in the repository, "" for the root
+}
+
+// ParseGitHubSource parses a GitHub module address. It returns false for
+// other sources, like registry addresses and local paths.
+func ParseGitHubSource(source string) (GitHubSource, bool) {
+	m := githubSourcePattern.FindStringSubmatch(source)
+	if m == nil {
+		return GitHubSource{}, false
+	}
+	return GitHubSource{Owner: m[1], Repo: m[2], Subdir: cleanSubdir(m[3])}, true
+}
+
+// Matches reports whether a source address refers to the module at dir in
+// owner/repo
+func (s GitHubSource) Matches(owner, repo, dir string) bool {
+	return strings.EqualFold(s.Owner, owner) && strings.EqualFold(s.Repo, repo) && s.Subdir == cleanSubdir(dir)
+}
+
+func cleanSubdir(dir string) string {
+	dir = path.Clean("/" + dir)
+	return strings.TrimPrefix(dir, "/")
+}
+
+// RewriteSources points the module blocks in a configuration whose source
+// satisfies match at localPath. Version arguments of rewritten blocks are
+// removed, since local modules can't have one. It returns the new content and
+// the number of blocks rewritten.
+func RewriteSources(content string, match func(source string) bool, localPath string) (string, int) {
+	var out, block []string
+	rewritten := 0
+	depth := 0
+	for _, line := range strings.Split(content, "\n") {
+		if depth == 0 && moduleBlockPattern.MatchString(line) {
+			block = []string{}
+		}
+		if block != nil {
+			block = append(block, line)
+		} else {
+			out = append(out, line)
+		}
+
+		depth += braceDelta(line)
+		if depth <= 0 {
+			depth = 0
+			if block != nil {
+				var ok bool
+				if block, ok = rewriteModule(block, match, localPath); ok {
+					rewritten++
+				}
+				out = append(out, block...)
+				block = nil
+			}
+		}
+	}
+
+	// An unterminated block is left as it is
+	out = append(out, block...)
+	return strings.Join(out, "\n"), rewritten
+}
+
+// rewriteModule rewrites the source of a module block if it satisfies match
+// and drops its version argument
+func rewriteModule(block []string, match func(string) bool, localPath string) ([]string, bool) {
+	source := -1
+	depth := 0
+	for i, line := range block {
+		if depth == 1 {
+			if m := sourcePattern.FindStringSubmatch(line); m != nil && match(m[2]) {
+				source = i
+			}
+		}
+		depth += braceDelta(line)
+	}
+	if source < 0 {
+		return block, false
+	}
+
+	out := make([]string, 0, len(block))
+	depth = 0
+	for i, line := range block {
+		switch {
+		case i == source:
+			m := sourcePattern.FindStringSubmatch(line)
+			line = m[1] + `"` + localPath + `"` + m[3]
+		case depth == 1 && versionPattern.MatchString(line):
+			continue
+		}
+		depth += braceDelta(line)
+		out = append(out, line)
+	}
+	return out, true
+}
+
+// braceDelta counts the braces a line opens minus those it closes, ignoring
+// braces in strings and comments
+func braceDelta(line string) int {
+	delta := 0
+	inString := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '#' || (c == '/' && i+1 < len(line) && line[i+1] == '/'):
+			return delta
+		case c == '{':
+			delta++
+		case c == '}':
+			delta--
+		}
+	}
+	return delta
+}
+
+// RequiredVersions returns the required_version constraints set in the
+// terraform blocks of a module's files, sorted and without duplicates
+func RequiredVersions(files map[string]string) []string {
+	seen := make(map[string]bool)
+	for name, content := range files {
+		if !strings.HasSuffix(name, ".tf") {
+			continue
+		}
+
+		depth := 0
+		inTerraform := false
+		for _, line := range strings.Split(content, "\n") {
+			if depth == 0 && terraformBlockPattern.MatchString(line) {
+				inTerraform = true
+			} else if inTerraform && depth == 1 {
+				if m := requiredVersionPattern.FindStringSubmatch(line); m != nil {
+					seen[strings.TrimSpace(m[1])] = true
+				}
+			}
+
+			depth += braceDelta(line)
+			if depth <= 0 {
+				depth = 0
+				inTerraform = false
+			}
+		}
+	}
+
+	constraints := make([]string, 0, len(seen))
+	for c := range seen {
+		constraints = append(constraints, c)
+	}
+	sort.Strings(constraints)
+	return constraints
+}
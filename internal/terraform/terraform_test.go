@@ -0,0 +1,92 @@
+package terraform
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseGitHubSource(t *testing.T) {
+	tests := []struct {
+		source string
+		want   GitHubSource
+		ok     bool
+	}{
+		{"github.com/acme/modules//network/vpc?ref=v1.2.0", GitHubSource{"acme", "modules", "network/vpc"}, true},
+		{"git::https://github.com/acme/modules.git//network/vpc/?ref=v1", GitHubSource{"acme", "modules", "network/vpc"}, true},
+		{"git@github.com:acme/vpc.git", GitHubSource{"acme", "vpc", ""}, true},
+		{"git::ssh://git@github.com/acme/vpc.git?ref=main", GitHubSource{"acme", "vpc", ""}, true},
+		{"hashicorp/consul/aws", GitHubSource{}, false},
+		{"./modules/vpc", GitHubSource{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseGitHubSource(tt.source)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("ParseGitHubSource(%q) = %+v, %v; want %+v, %v", tt.source, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	s, _ := ParseGitHubSource("github.com/Acme/modules//network/vpc")
+	if !s.Matches("acme", "modules", "/network/vpc/") || s.Matches("acme", "modules", "network") {
+		t.Error("Unexpected Matches result")
+	}
+}
+
+func TestRewriteSources(t *testing.T) {
+	content := `module "vpc" {
+  version = "~> 1.0" # registry version
+  source  = "github.com/acme/modules//vpc?ref=v1.2.0"
+
+  tags = {
+    version = "keep me"
+  }
+}
+
+module "other" {
+  source  = "hashicorp/consul/aws"
+  version = "0.1.0"
+}
+`
+	match := func(source string) bool {
+		s, ok := ParseGitHubSource(source)
+		return ok && s.Matches("acme", "modules", "vpc")
+	}
+
+	got, n := RewriteSources(content, match, "../vendor/vpc")
+	if n != 1 {
+		t.Fatalf("Expected 1 rewritten block, got %d", n)
+	}
+	want := `module "vpc" {
+  source  = "../vendor/vpc"
+
+  tags = {
+    version = "keep me"
+  }
+}
+
+module "other" {
+  source  = "hashicorp/consul/aws"
+  version = "0.1.0"
+}
+`
+	if got != want {
+		t.Errorf("Unexpected rewrite:\n%s\nwant:\n%s", got, want)
+	}
+
+	if again, n := RewriteSources(got, match, "../vendor/vpc"); n != 0 || again != got {
+		t.Error("Expected rewriting to be idempotent")
+	}
+}
+
+func TestRequiredVersions(t *testing.T) {
+	files := map[string]string{
+		"versions.tf": "terraform {\n  required_version = \">= 1.5\"\n  required_providers {\n    aws = { source = \"hashicorp/aws\" }\n  }\n}\n",
+		"main.tf":     "# required_version = \"0.12\"\nterraform {\n  required_version = \">= 1.5\"\n}\n",
+		"README.md":   "terraform {\n  required_version = \"1.0\"\n}\n",
+	}
+
+	got := RequiredVersions(files)
+	if strings.Join(got, ",") != ">= 1.5" {
+		t.Errorf("Unexpected constraints: %v", got)
+	}
+}
@@ -0,0 +1,191 @@
+// Package version holds the version of the codesync binary and checks it
+// against the requiredVersion constraint of a config.
+package version
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// Version is the release this binary was built from, set at build time with
+// -ldflags "-X github.com/exitflynn/codesync/internal/version.Version=v1.2.3".
+// Builds from source are "dev".
+var Version = "dev"
+
+// Release reports whether the binary is a tagged release
+func Release() bool {
+	return Valid(Version)
+}
+
+// Valid reports whether v is a semantic version, with or without the "v"
+// prefix
+func Valid(v string) bool {
+	return semver.IsValid(canonical(v))
+}
+
+// Check reports an error if the binary's version doesn't satisfy a
+// constraint: comma-separated comparisons like ">= 1.4, < 2", where a bare
+// version means at least that version. Development builds satisfy every
+// constraint.
+func Check(constraint string) error {
+	ok, err := Satisfies(Version, constraint)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("config requires codesync %s, but this is %s; run 'codesync self-update'", constraint, Version)
+	}
+	return nil
+}
+
+// Satisfies reports whether a version satisfies a constraint, which it
+// always does if it isn't a release version
+func Satisfies(version, constraint string) (bool, error) {
+	if strings.TrimSpace(constraint) == "" {
+		return true, nil
+	}
+
+	v := canonical(version)
+	for _, part := range strings.Split(constraint, ",") {
+		op, want, err := parseComparison(part)
+		if err != nil {
+			return false, err
+		}
+		if !semver.IsValid(v) {
+			continue
+		}
+
+		if !compare(v, op, want) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// compare reports whether canonical version v compares to want as op says
+func compare(v, op, want string) bool {
+	cmp := semver.Compare(v, want)
+	switch op {
+	case ">=":
+		return cmp >= 0
+	case ">":
+		return cmp > 0
+	case "<=":
+		return cmp <= 0
+	case "<":
+		return cmp < 0
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	}
+	return false
+}
+
+// InRange reports whether a release version is in a range: comparisons like
+// Satisfies takes, "^1.2" for versions compatible with 1.2 (below 2.0, or
+// below 0.3 for ^0.2) or "~1.2" for patches of 1.2. An empty range, "*" and
+// "latest" match every release. Versions that aren't semver never match, nor
+// do prereleases unless the range names one.
+func InRange(version, r string) (bool, error) {
+	comparisons, err := parseRange(r)
+	if err != nil {
+		return false, err
+	}
+
+	v := canonical(version)
+	if !semver.IsValid(v) || semver.Prerelease(v) != "" && !strings.Contains(r, "-") {
+		return false, nil
+	}
+	for _, c := range comparisons {
+		if !compare(v, c[0], c[1]) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ValidRange reports an error if r isn't a range InRange understands
+func ValidRange(r string) error {
+	_, err := parseRange(r)
+	return err
+}
+
+// parseRange splits a range into comparisons of an operator and a canonical
+// version, expanding ^ and ~ into a lower and an upper bound
+func parseRange(r string) ([][2]string, error) {
+	r = strings.TrimSpace(r)
+	if r == "" || r == "*" || r == "latest" {
+		return nil, nil
+	}
+
+	var comparisons [][2]string
+	for _, part := range strings.Split(r, ",") {
+		part = strings.TrimSpace(part)
+		if !strings.HasPrefix(part, "^") && !strings.HasPrefix(part, "~") {
+			op, want, err := parseComparison(part)
+			if err != nil {
+				return nil, err
+			}
+			comparisons = append(comparisons, [2]string{op, want})
+			continue
+		}
+
+		lower := semver.Canonical(canonical(strings.TrimSpace(part[1:])))
+		var major, minor, patch int
+		if _, err := fmt.Sscanf(lower, "v%d.%d.%d", &major, &minor, &patch); err != nil {
+			return nil, fmt.Errorf("invalid version range '%s'", part)
+		}
+
+		// The components given decide what may change: ~1 and ^1 allow any
+		// 1.x, ~1.2 only 1.2.x
+		given := strings.Count(strings.SplitN(part, "-", 2)[0], ".") + 1
+		var upper string
+		switch {
+		case given == 1 || part[0] == '^' && major > 0:
+			upper = fmt.Sprintf("v%d.0.0", major+1)
+		case part[0] == '~' || minor > 0 || given == 2:
+			upper = fmt.Sprintf("v%d.%d.0", major, minor+1)
+		default:
+			upper = fmt.Sprintf("v%d.%d.%d", major, minor, patch+1)
+		}
+		comparisons = append(comparisons, [2]string{">=", lower}, [2]string{"<", upper})
+	}
+	return comparisons, nil
+}
+
+// parseComparison splits a comparison like ">= 1.4" into its operator and
+// canonical version
+func parseComparison(s string) (string, string, error) {
+	s = strings.TrimSpace(s)
+	op := ">="
+	for _, candidate := range []string{">=", "<=", "!=", ">", "<", "="} {
+		if strings.HasPrefix(s, candidate) {
+			op = candidate
+			s = strings.TrimSpace(s[len(candidate):])
+			break
+		}
+	}
+
+	v := canonical(s)
+	if !semver.IsValid(v) {
+		return "", "", fmt.Errorf("invalid version constraint '%s'", s)
+	}
+	return op, v, nil
+}
+
+// canonical adds the "v" prefix semver expects
+func canonical(v string) string {
+	if v != "" && !strings.HasPrefix(v, "v") {
+		v = "v" + v
+	}
+	return v
+}
+
+// Compare compares two versions like semver.Compare, accepting versions
+// without the "v" prefix
+func Compare(a, b string) int {
+	return semver.Compare(canonical(a), canonical(b))
+}
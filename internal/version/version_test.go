@@ -0,0 +1,88 @@
+package version
+
+import "testing"
+
+func TestSatisfies(t *testing.T) {
+	tests := []struct {
+		version    string
+		constraint string
+		want       bool
+	}{
+		{"v1.4.0", "", true},
+		{"v1.4.0", "1.4", true},
+		{"v1.3.9", ">= 1.4", false},
+		{"1.5.0", ">=1.4, <2", true},
+		{"v2.0.0", ">=1.4, <2", false},
+		{"v1.4.0", "!= 1.4.0", false},
+		{"dev", ">= 9", true},
+	}
+	for _, tt := range tests {
+		got, err := Satisfies(tt.version, tt.constraint)
+		if err != nil {
+			t.Errorf("Satisfies(%q, %q) failed: %v", tt.version, tt.constraint, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Satisfies(%q, %q) = %v, want %v", tt.version, tt.constraint, got, tt.want)
+		}
+	}
+
+	if _, err := Satisfies("dev", ">= one"); err == nil {
+		t.Error("Expected an invalid constraint to fail, even for development builds")
+	}
+}
+
+func TestInRange(t *testing.T) {
+	tests := []struct {
+		version string
+		r       string
+		want    bool
+	}{
+		{"v1.2.0", "^1.2", true},
+		{"v1.9.3", "^1.2", true},
+		{"v1.1.9", "^1.2", false},
+		{"v2.0.0", "^1.2", false},
+		{"v0.2.5", "^0.2", true},
+		{"v0.3.0", "^0.2", false},
+		{"v0.0.4", "^0.0.3", false},
+		{"v1.2.7", "~1.2", true},
+		{"v1.3.0", "~1.2", false},
+		{"v1.8.0", "~1", true},
+		{"v1.4.0", ">= 1.2, < 1.5", true},
+		{"v3.0.0", "latest", true},
+		{"v3.0.0", "", true},
+		{"v2.0.0-rc.1", "^2", false},
+		{"v2.0.0-rc.1", ">= 2.0.0-rc.0", true},
+		{"nightly", "*", false},
+	}
+	for _, tt := range tests {
+		got, err := InRange(tt.version, tt.r)
+		if err != nil {
+			t.Errorf("InRange(%q, %q) failed: %v", tt.version, tt.r, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("InRange(%q, %q) = %v, want %v", tt.version, tt.r, got, tt.want)
+		}
+	}
+
+	for _, r := range []string{"^one", "~", ">= 1, ^x"} {
+		if err := ValidRange(r); err == nil {
+			t.Errorf("Expected range %q to be invalid", r)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	old := Version
+	t.Cleanup(func() { Version = old })
+
+	Version = "v1.3.0"
+	if err := Check(">= 1.4"); err == nil {
+		t.Error("Expected an older binary to be refused")
+	}
+	Version = "v1.4.1"
+	if err := Check(">= 1.4"); err != nil {
+		t.Errorf("Expected a newer binary to pass, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+// Package workflow validates GitHub Actions workflows and merges shared
+// workflow templates with a repository's local overrides
+package workflow
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/exitflynn/codesync/internal/structured"
+	"gopkg.in/yaml.v3"
+)
+
+// Dir is where GitHub looks for workflows. Subdirectories aren't searched.
+const Dir = ".github/workflows"
+
+// DefaultKeep lists the keys whose local values survive a sync by default:
+// repositories commonly change a shared workflow's triggers and environment
+var DefaultKeep = []string{"on", "env"}
+
+// IsWorkflowPath reports whether a path is somewhere GitHub runs workflows
+// from
+func IsWorkflowPath(p string) bool {
+	p = path.Clean(strings.ReplaceAll(p, "\\", "/"))
+	ext := path.Ext(p)
+	dir := path.Dir(p)
+	return (ext == ".yml" || ext == ".yaml") && (dir == Dir || strings.HasSuffix(dir, "/"+Dir))
+}
+
+// Validate checks that data is a workflow GitHub would accept: valid YAML
+// with triggers and at least one job, each of which runs steps on a runner
+// or calls a reusable workflow
+func Validate(data []byte) error {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("invalid workflow YAML: %w", err)
+	}
+	if doc == nil {
+		return fmt.Errorf("workflow is empty")
+	}
+
+	var problems []string
+	if _, ok := doc["on"]; !ok {
+		problems = append(problems, "no triggers (on)")
+	}
+
+	jobs, ok := doc["jobs"].(map[string]interface{})
+	if !ok || len(jobs) == 0 {
+		problems = append(problems, "no jobs")
+	}
+	names := make([]string, 0, len(jobs))
+	for name := range jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		job, ok := jobs[name].(map[string]interface{})
+		if !ok {
+			problems = append(problems, fmt.Sprintf("job %s is not a mapping", name))
+			continue
+		}
+		_, runsOn := job["runs-on"]
+		_, uses := job["uses"]
+		if !runsOn && !uses {
+			problems = append(problems, fmt.Sprintf("job %s has neither runs-on nor uses", name))
+		}
+		if steps, ok := job["steps"]; ok {
+			if _, ok := steps.([]interface{}); !ok {
+				problems = append(problems, fmt.Sprintf("job %s: steps must be a list", name))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid workflow: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Merge returns the upstream workflow with the local values of the kept
+// paths. Kept paths that aren't set locally take the upstream value.
+func Merge(local, upstream []byte, keep []string) ([]byte, error) {
+	var overrides []string
+	for _, selector := range keep {
+		ok, err := has(local, selector)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing local workflow: %w", err)
+		}
+		if ok {
+			overrides = append(overrides, selector)
+		}
+	}
+	if len(overrides) == 0 {
+		return upstream, nil
+	}
+
+	// Copying the local overrides into the upstream document keeps the
+	// upstream layout and comments everywhere else
+	return structured.SyncYAML(upstream, local, overrides)
+}
+
+// Without returns a workflow without the kept paths, in a canonical form, so
+// that local overrides don't count as local changes
+func Without(data []byte, keep []string) (string, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return "", err
+	}
+	if len(doc.Content) == 0 {
+		return "", nil
+	}
+
+	for _, selector := range keep {
+		p, err := structured.ParsePath(selector)
+		if err != nil {
+			return "", err
+		}
+		remove(doc.Content[0], p)
+	}
+
+	var buf bytes.Buffer
+	if err := yaml.NewEncoder(&buf).Encode(&doc); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// has reports whether a document sets a path
+func has(data []byte, selector string) (bool, error) {
+	p, err := structured.ParsePath(selector)
+	if err != nil {
+		return false, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return false, err
+	}
+	if len(doc.Content) == 0 {
+		return false, nil
+	}
+	node := doc.Content[0]
+	for _, seg := range p {
+		if node = child(node, seg); node == nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// remove deletes the mapping key at a path, if it's there
+func remove(node *yaml.Node, p structured.Path) {
+	if len(p) == 0 {
+		return
+	}
+	for _, seg := range p[:len(p)-1] {
+		if node = child(node, seg); node == nil {
+			return
+		}
+	}
+
+	last := p[len(p)-1]
+	if node.Kind != yaml.MappingNode || last.Key == "" {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == last.Key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+func child(node *yaml.Node, seg structured.Segment) *yaml.Node {
+	switch {
+	case seg.Key != "" && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == seg.Key {
+				return node.Content[i+1]
+			}
+		}
+	case seg.Key == "" && node.Kind == yaml.SequenceNode && seg.Index < len(node.Content):
+		return node.Content[seg.Index]
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package workflow
+
+import (
+	"strings"
+	"testing"
+)
+
+const upstream = `name: CI
+
+# Shared by the platform team
+on:
+  push:
+    branches: [main]
+
+env:
+  GO_VERSION: "1.22"
+
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+      - run: make test
+`
+
+func TestValidate(t *testing.T) {
+	if err := Validate([]byte(upstream)); err != nil {
+		t.Errorf("Expected valid workflow, got %v", err)
+	}
+
+	tests := map[string]string{
+		"bad yaml":  "on: [push\n",
+		"no jobs":   "on: push\n",
+		"no runner": "on: push\njobs:\n  test:\n    steps:\n      - run: make\n",
+		"steps":     "on: push\njobs:\n  test:\n    runs-on: ubuntu-latest\n    steps: make\n",
+		"no on":     "jobs:\n  call:\n    uses: acme/ci/.github/workflows/go.yml@v1\n",
+	}
+	for name, workflow := range tests {
+		if err := Validate([]byte(workflow)); err == nil {
+			t.Errorf("%s: expected workflow to be rejected", name)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	local := `name: CI
+on:
+  pull_request:
+env:
+  GO_VERSION: "1.21"
+  EXTRA: "1"
+jobs:
+  test:
+    runs-on: self-hosted
+`
+	got, err := Merge([]byte(local), []byte(upstream), DefaultKeep)
+	if err != nil {
+		t.Fatalf("Merge failed: %v", err)
+	}
+	out := string(got)
+
+	for _, want := range []string{"# Shared by the platform team", "pull_request:", `EXTRA: "1"`, "runs-on: ubuntu-latest", "make test"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in merged workflow:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "branches: [main]") || strings.Contains(out, "self-hosted") {
+		t.Errorf("Unexpected values in merged workflow:\n%s", out)
+	}
+
+	// Without local overrides the upstream workflow is used as it is
+	got, _ = Merge([]byte("jobs: {}\n"), []byte(upstream), DefaultKeep)
+	if string(got) != upstream {
+		t.Errorf("Expected upstream workflow, got:\n%s", got)
+	}
+}
+
+func TestWithout(t *testing.T) {
+	a, _ := Without([]byte(upstream), DefaultKeep)
+	b, _ := Without([]byte(strings.Replace(upstream, `"1.22"`, `"1.21"`, 1)), DefaultKeep)
+	if a != b || strings.Contains(a, "GO_VERSION") {
+		t.Errorf("Expected kept keys to be ignored:\n%s", a)
+	}
+}
+
+func TestIsWorkflowPath(t *testing.T) {
+	for p, want := range map[string]bool{
+		".github/workflows/ci.yml":        true,
+		"repo/.github/workflows/ci.yaml":  true,
+		".github/workflows/nested/ci.yml": false,
+		".github/workflows/README.md":     false,
+		"workflows/ci.yml":                false,
+	} {
+		if got := IsWorkflowPath(p); got != want {
+			t.Errorf("IsWorkflowPath(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
@@ -57,31 +57,61 @@ func (mr *MockGitHubClientMockRecorder) ExtractFunction(content, language, funct
 }
 
 // GetCommitsSince mocks base method.
-func (m *MockGitHubClient) GetCommitsSince(owner, repo, path string, since time.Time, until string) ([]github.Commit, error) {
+func (m *MockGitHubClient) GetCommitsSince(owner, repo, path, ref string, since time.Time, sinceCommit string) ([]github.CommitInfo, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetCommitsSince", owner, repo, path, since, until)
-	ret0, _ := ret[0].([]github.Commit)
+	ret := m.ctrl.Call(m, "GetCommitsSince", owner, repo, path, ref, since, sinceCommit)
+	ret0, _ := ret[0].([]github.CommitInfo)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetCommitsSince indicates an expected call of GetCommitsSince.
-func (mr *MockGitHubClientMockRecorder) GetCommitsSince(owner, repo, path, since, until any) *gomock.Call {
+func (mr *MockGitHubClientMockRecorder) GetCommitsSince(owner, repo, path, ref, since, sinceCommit any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCommitsSince", reflect.TypeOf((*MockGitHubClient)(nil).GetCommitsSince), owner, repo, path, since, until)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCommitsSince", reflect.TypeOf((*MockGitHubClient)(nil).GetCommitsSince), owner, repo, path, ref, since, sinceCommit)
+}
+
+// GetDirectory mocks base method.
+func (m *MockGitHubClient) GetDirectory(owner, repo, path, ref string) (map[string]*github.FileInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDirectory", owner, repo, path, ref)
+	ret0, _ := ret[0].(map[string]*github.FileInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDirectory indicates an expected call of GetDirectory.
+func (mr *MockGitHubClientMockRecorder) GetDirectory(owner, repo, path, ref any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDirectory", reflect.TypeOf((*MockGitHubClient)(nil).GetDirectory), owner, repo, path, ref)
 }
 
 // GetFile mocks base method.
-func (m *MockGitHubClient) GetFile(owner, repo, path, revision string) (*github.FileContent, error) {
+func (m *MockGitHubClient) GetFile(owner, repo, path, ref string) (*github.FileInfo, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetFile", owner, repo, path, revision)
-	ret0, _ := ret[0].(*github.FileContent)
+	ret := m.ctrl.Call(m, "GetFile", owner, repo, path, ref)
+	ret0, _ := ret[0].(*github.FileInfo)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetFile indicates an expected call of GetFile.
-func (mr *MockGitHubClientMockRecorder) GetFile(owner, repo, path, revision any) *gomock.Call {
+func (mr *MockGitHubClientMockRecorder) GetFile(owner, repo, path, ref any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFile", reflect.TypeOf((*MockGitHubClient)(nil).GetFile), owner, repo, path, ref)
+}
+
+// GetFileDiff mocks base method.
+func (m *MockGitHubClient) GetFileDiff(owner, repo, path, baseRef, headRef string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFileDiff", owner, repo, path, baseRef, headRef)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFileDiff indicates an expected call of GetFileDiff.
+func (mr *MockGitHubClientMockRecorder) GetFileDiff(owner, repo, path, baseRef, headRef any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFile", reflect.TypeOf((*MockGitHubClient)(nil).GetFile), owner, repo, path, revision)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFileDiff", reflect.TypeOf((*MockGitHubClient)(nil).GetFileDiff), owner, repo, path, baseRef, headRef)
 }